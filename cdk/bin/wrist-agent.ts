@@ -12,6 +12,7 @@ const modelId = process.env.BEDROCK_MODEL_ID || 'anthropic.claude-haiku-4-5-2025
 const geoRegion = (process.env.BEDROCK_GEO_REGION || 'US') as 'US' | 'EU';
 const clientTokenParamName = process.env.CLIENT_TOKEN_PARAM_NAME || '/wrist-agent/client-token';
 const clientTokenValue = process.env.CLIENT_TOKEN || crypto.randomBytes(32).toString('base64');
+const optionalNumber = (value?: string) => (value ? Number(value) : undefined);
 
 new WristAgentStack(app, 'WristAgentStack', {
   env: {
@@ -25,8 +26,126 @@ new WristAgentStack(app, 'WristAgentStack', {
   config: {
     region: region,
     modelId: modelId,
+    modelFamily: process.env.BEDROCK_MODEL_FAMILY as 'anthropic' | 'nova' | 'llama' | undefined,
     geoRegion: geoRegion,
     clientTokenParamName: clientTokenParamName,
     clientTokenValue: clientTokenValue,
+    sinks: process.env.SINKS,
+    sinksParamName: process.env.SINKS_PARAM_NAME,
+    sinkWebhookUrl: process.env.SINK_WEBHOOK_URL,
+    postProcess: process.env.POSTPROCESS,
+    postProcessParamName: process.env.POSTPROCESS_PARAM_NAME,
+    notionDatabaseId: process.env.NOTION_DATABASE_ID,
+    notionTokenParamName: process.env.NOTION_TOKEN_PARAM_NAME,
+    notionTitleProperty: process.env.NOTION_TITLE_PROPERTY,
+    notionTagsProperty: process.env.NOTION_TAGS_PROPERTY,
+    notionDueProperty: process.env.NOTION_DUE_PROPERTY,
+    googleCalendarCredentialsParamName: process.env.GOOGLE_CALENDAR_CREDENTIALS_PARAM_NAME,
+    googleCalendarId: process.env.GOOGLE_CALENDAR_ID,
+    caldavSecretArn: process.env.CALDAV_SECRET_ARN,
+    caldavTargets: process.env.CALDAV_TARGETS,
+    icsDelivery: process.env.ICS_DELIVERY as 'inline' | 's3' | undefined,
+    redactionDenylist: process.env.REDACTION_DENYLIST,
+    redactionGuardrailId: process.env.REDACTION_GUARDRAIL_ID,
+    redactionGuardrailVersion: process.env.REDACTION_GUARDRAIL_VERSION,
+    strictRequestFields: process.env.STRICT_REQUEST_FIELDS as 'off' | 'v2' | 'all' | undefined,
+    pollyVoiceId: process.env.POLLY_VOICE_ID,
+    shortTextMaxWords: optionalNumber(process.env.SHORT_TEXT_MAX_WORDS),
+    tagMaxCount: optionalNumber(process.env.TAG_MAX_COUNT),
+    titleMaxChars: optionalNumber(process.env.TITLE_MAX_CHARS),
+    titleGeneration: process.env.TITLE_GENERATION === 'true',
+    titleModelId: process.env.TITLE_MODEL_ID,
+    journalTimezone: process.env.JOURNAL_TIMEZONE,
+    todoistTokenParamName: process.env.TODOIST_TOKEN_PARAM_NAME,
+    todoistProjectId: process.env.TODOIST_PROJECT_ID,
+    slackWebhookParamName: process.env.SLACK_WEBHOOK_PARAM_NAME,
+    slackBotTokenParamName: process.env.SLACK_BOT_TOKEN_PARAM_NAME,
+    slackChannel: process.env.SLACK_CHANNEL,
+    sesFromAddress: process.env.SES_FROM_ADDRESS,
+    sesAllowedRecipients: process.env.SES_ALLOWED_RECIPIENTS,
+    callbackAllowedHosts: process.env.CALLBACK_ALLOWED_HOSTS,
+    callbackSecretParamName: process.env.CALLBACK_SECRET_PARAM_NAME,
+    responseSigningParamName: process.env.RESPONSE_SIGNING_PARAM_NAME,
+    replayProtection: process.env.REPLAY_PROTECTION as 'off' | 'optional' | 'required' | undefined,
+    replayWindowSeconds: optionalNumber(process.env.REPLAY_WINDOW_SECONDS),
+    authMode: process.env.AUTH_MODE as 'token' | 'apple' | 'both' | undefined,
+    appleClientIds: process.env.APPLE_CLIENT_IDS,
+    quotaDailyRequests: optionalNumber(process.env.QUOTA_DAILY_REQUESTS),
+    quotaMonthlyRequests: optionalNumber(process.env.QUOTA_MONTHLY_REQUESTS),
+    quotaDailyTokens: optionalNumber(process.env.QUOTA_DAILY_TOKENS),
+    quotaMonthlyTokens: optionalNumber(process.env.QUOTA_MONTHLY_TOKENS),
+    budgetMonthlyUsd: optionalNumber(process.env.BUDGET_MONTHLY_USD),
+    budgetGlobalMonthlyUsd: optionalNumber(process.env.BUDGET_GLOBAL_MONTHLY_USD),
+    budgetTenantMonthlyUsd: optionalNumber(process.env.BUDGET_TENANT_MONTHLY_USD),
+    budgetFallbackModelId: process.env.BUDGET_FALLBACK_MODEL_ID,
+    costClassEconomyModelId: process.env.COST_CLASS_ECONOMY_MODEL_ID,
+    costClassPremiumModelId: process.env.COST_CLASS_PREMIUM_MODEL_ID,
+    auditRetentionDays: optionalNumber(process.env.AUDIT_RETENTION_DAYS),
+    ipAllowlist: process.env.IP_ALLOWLIST,
+    ipDenylist: process.env.IP_DENYLIST,
+    ipListsParamName: process.env.IP_LISTS_PARAM_NAME,
+    ssmFailoverRegion: process.env.SSM_FAILOVER_REGION,
+    circuitBreakerThreshold: optionalNumber(process.env.CIRCUIT_BREAKER_THRESHOLD),
+    circuitBreakerTimeoutSeconds: optionalNumber(process.env.CIRCUIT_BREAKER_TIMEOUT_SECONDS),
+    circuitBreakerHalfOpenProbes: optionalNumber(process.env.CIRCUIT_BREAKER_HALF_OPEN_PROBES),
+    bedrockBreakerThreshold: optionalNumber(process.env.BEDROCK_CIRCUIT_BREAKER_THRESHOLD),
+    bedrockBreakerTimeoutSeconds: optionalNumber(process.env.BEDROCK_CIRCUIT_BREAKER_TIMEOUT_SECONDS),
+    faultInjectionEnabled: process.env.FAULT_INJECTION_ENABLED === 'true',
+    anthropicFallbackEnabled: process.env.ANTHROPIC_FALLBACK_ENABLED === 'true',
+    anthropicApiKeySecretArn: process.env.ANTHROPIC_API_KEY_SECRET_ARN,
+    anthropicFallbackModel: process.env.ANTHROPIC_FALLBACK_MODEL,
+    queueWhenDown: process.env.QUEUE_WHEN_DOWN === 'true',
+    pendingDrainSchedule: process.env.PENDING_DRAIN_SCHEDULE,
+    bedrockMaxConcurrency: optionalNumber(process.env.BEDROCK_MAX_CONCURRENCY),
+    bedrockMaxConcurrencyPerInstance: optionalNumber(process.env.BEDROCK_MAX_CONCURRENCY_PER_INSTANCE),
+    bedrockConcurrencyWaitMs: optionalNumber(process.env.BEDROCK_CONCURRENCY_WAIT_MS),
+    bedrockMaxContinuations: optionalNumber(process.env.BEDROCK_MAX_CONTINUATIONS),
+    modelContextTokens: optionalNumber(process.env.MODEL_CONTEXT_TOKENS),
+    maxRequestCostUsd: optionalNumber(process.env.MAX_REQUEST_COST_USD),
+    bedrockInputUsdPerMtok: optionalNumber(process.env.BEDROCK_INPUT_USD_PER_MTOK),
+    bedrockOutputUsdPerMtok: optionalNumber(process.env.BEDROCK_OUTPUT_USD_PER_MTOK),
+    useParamsExtension: process.env.USE_PARAMS_EXTENSION === 'true',
+    maxBodyBytes: optionalNumber(process.env.MAX_BODY_BYTES),
+    maxTextChars: optionalNumber(process.env.MAX_TEXT_CHARS),
+    summarizeMaxTextChars: optionalNumber(process.env.SUMMARIZE_MAX_TEXT_CHARS),
+    summarizeChunkChars: optionalNumber(process.env.SUMMARIZE_CHUNK_CHARS),
+    textTruncatePercent: optionalNumber(process.env.TEXT_TRUNCATE_PERCENT),
+    maxImageBytes: optionalNumber(process.env.MAX_IMAGE_BYTES),
+    maxAudioBytes: optionalNumber(process.env.MAX_AUDIO_BYTES),
+    transcribeLanguageCode: process.env.TRANSCRIBE_LANGUAGE_CODE,
+    transcribeTimeoutSeconds: optionalNumber(process.env.TRANSCRIBE_TIMEOUT_SECONDS),
+    corsAllowedOrigins: process.env.CORS_ALLOWED_ORIGINS,
+    corsAllowedHeaders: process.env.CORS_ALLOWED_HEADERS,
+    corsAllowedMethods: process.env.CORS_ALLOWED_METHODS,
+    compressionMinBytes: optionalNumber(process.env.COMPRESSION_MIN_BYTES),
+    jobMaxAttempts: optionalNumber(process.env.JOB_MAX_ATTEMPTS),
+    sseMaxWaitSeconds: optionalNumber(process.env.SSE_MAX_WAIT_SECONDS),
+    telegramSecretParamName: process.env.TELEGRAM_SECRET_PARAM_NAME,
+    telegramChats: process.env.TELEGRAM_CHATS,
+    inboundEmailAddresses: process.env.INBOUND_EMAIL_ADDRESSES,
+    inboundEmailSenders: process.env.INBOUND_EMAIL_SENDERS,
+    alexaSkillId: process.env.ALEXA_SKILL_ID,
+    functionUrl: process.env.FUNCTION_URL === 'true',
+    researchWorkflow: process.env.RESEARCH_WORKFLOW === 'true',
+    researchKnowledgeBaseId: process.env.RESEARCH_KNOWLEDGE_BASE_ID,
+    dailyDigestPrincipals: process.env.DAILY_DIGEST_PRINCIPALS,
+    dailyDigestSchedule: process.env.DAILY_DIGEST_SCHEDULE,
+    dailyDigestEmail: process.env.DAILY_DIGEST_EMAIL,
+    dailyDigestWebhookUrl: process.env.DAILY_DIGEST_WEBHOOK_URL,
+    digestTimezone: process.env.DIGEST_TIMEZONE,
+    weeklySummaryRecipients: process.env.WEEKLY_SUMMARY_RECIPIENTS,
+    weeklySummarySchedule: process.env.WEEKLY_SUMMARY_SCHEDULE,
+    noteDeleteRetentionDays: optionalNumber(process.env.NOTE_DELETE_RETENTION_DAYS),
+    duplicateWindowHours: optionalNumber(process.env.DUPLICATE_WINDOW_HOURS),
+    duplicateThreshold: optionalNumber(process.env.DUPLICATE_THRESHOLD),
+    conversationTtlDays: optionalNumber(process.env.CONVERSATION_TTL_DAYS),
+    promptVariants: process.env.PROMPT_VARIANTS,
+    responseCacheModes: process.env.RESPONSE_CACHE_MODES,
+    responseCacheTtlHours: optionalNumber(process.env.RESPONSE_CACHE_TTL_HOURS),
+    responseCacheFreshHours: optionalNumber(process.env.RESPONSE_CACHE_FRESH_HOURS),
+    searchBackend: process.env.SEARCH_BACKEND,
+    opensearchEndpoint: process.env.OPENSEARCH_ENDPOINT,
+    opensearchIndex: process.env.OPENSEARCH_INDEX,
+    opensearchCollectionArn: process.env.OPENSEARCH_COLLECTION_ARN,
   },
 });
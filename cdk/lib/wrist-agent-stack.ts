@@ -1,9 +1,22 @@
 import * as cdk from 'aws-cdk-lib';
 import * as lambda from 'aws-cdk-lib/aws-lambda';
 import * as apigateway from 'aws-cdk-lib/aws-apigateway';
+import * as apigwv2 from 'aws-cdk-lib/aws-apigatewayv2';
+import { WebSocketLambdaIntegration } from 'aws-cdk-lib/aws-apigatewayv2-integrations';
+import { WebSocketLambdaAuthorizer } from 'aws-cdk-lib/aws-apigatewayv2-authorizers';
 import * as ssm from 'aws-cdk-lib/aws-ssm';
 import * as logs from 'aws-cdk-lib/aws-logs';
 import * as iam from 'aws-cdk-lib/aws-iam';
+import * as dynamodb from 'aws-cdk-lib/aws-dynamodb';
+import * as s3 from 'aws-cdk-lib/aws-s3';
+import * as sqs from 'aws-cdk-lib/aws-sqs';
+import * as ses from 'aws-cdk-lib/aws-ses';
+import * as sesActions from 'aws-cdk-lib/aws-ses-actions';
+import * as events from 'aws-cdk-lib/aws-events';
+import * as targets from 'aws-cdk-lib/aws-events-targets';
+import { SqsEventSource } from 'aws-cdk-lib/aws-lambda-event-sources';
+import * as sfn from 'aws-cdk-lib/aws-stepfunctions';
+import * as tasks from 'aws-cdk-lib/aws-stepfunctions-tasks';
 import { GoFunction } from '@aws-cdk/aws-lambda-go-alpha';
 import * as bedrock from '@aws-cdk/aws-bedrock-alpha';
 import { Construct } from 'constructs';
@@ -12,15 +25,135 @@ import { Construct } from 'constructs';
 const DEFAULT_THROTTLE_RATE_LIMIT = 10;
 const DEFAULT_THROTTLE_BURST_LIMIT = 20;
 const TOKEN_CACHE_TTL_SECONDS = 300; // 5 minutes
+const DEFAULT_SINKS = JSON.stringify({ '*': ['dynamodb'] });
+const DEFAULT_POSTPROCESS = JSON.stringify({ '*': [{ type: 'markdown' }] });
 
 export interface StackConfig {
   region: string;
-  modelId: string;
+  modelId: string;               // an ARN (application inference profile, provisioned throughput) replaces the default Haiku 4.5 profile
+  modelFamily?: 'anthropic' | 'nova' | 'llama'; // Optional: family behind a modelId ARN that doesn't name its model, defaults to anthropic
   geoRegion: 'US' | 'EU';
   clientTokenParamName: string;
   clientTokenValue: string;
   throttleRateLimit?: number;  // Optional: defaults to 10 requests/second
   throttleBurstLimit?: number; // Optional: defaults to 20 requests burst
+  sinks?: string;                // Optional: JSON mode→sinks routing, defaults to history table only
+  sinksParamName?: string;       // Optional: SSM parameter holding the sink routing (overrides sinks)
+  sinkWebhookUrl?: string;       // Optional: URL for the webhook sink
+  postProcess?: string;          // Optional: JSON mode→transformers run over responses before storage, defaults to markdown normalization
+  postProcessParamName?: string; // Optional: SSM parameter holding the post-processing config (overrides postProcess)
+  notionDatabaseId?: string;     // Optional: Notion database for the notion sink
+  notionTokenParamName?: string; // Optional: SSM SecureString holding the Notion integration token
+  notionTitleProperty?: string;  // Optional: Notion title property name, defaults to "Name"
+  notionTagsProperty?: string;   // Optional: Notion multi-select property for tags, defaults to "Tags"
+  notionDueProperty?: string;    // Optional: Notion date property for due/start dates, defaults to "Due"
+  googleCalendarCredentialsParamName?: string; // Optional: SSM SecureString with Google OAuth client + refresh token JSON
+  googleCalendarId?: string;     // Optional: target Google calendar, defaults to "primary"
+  caldavSecretArn?: string;      // Optional: Secrets Manager secret with CalDAV {"username","password"}
+  caldavTargets?: string;        // Optional: JSON mode/action→collection URL map for the caldav sink
+  icsDelivery?: 'inline' | 's3'; // Optional: how event .ics files are returned, defaults to inline base64
+  redactionDenylist?: string; // Optional: comma-separated terms masked when a user's redact preference includes profanity
+  redactionGuardrailId?: string; // Optional: Bedrock guardrail that checks notes of users with a redact preference
+  redactionGuardrailVersion?: string; // Optional: version of that guardrail, defaults to DRAFT
+  strictRequestFields?: 'off' | 'v2' | 'all'; // Optional: reject unknown request fields on /v2 routes or all routes, defaults to off
+  pollyVoiceId?: string;         // Optional: Polly voice for spoken replies (speak:true), defaults to Joanna
+  shortTextMaxWords?: number;    // Optional: word cap for the watch-sized shortText field, defaults to 30
+  tagMaxCount?: number;          // Optional: most tags kept per capture after normalization, defaults to 5
+  titleMaxChars?: number;        // Optional: character cap for titles (emoji count as one), defaults to 50
+  titleGeneration?: boolean;     // Optional: ask a cheap model for a title when a reply only gets the generic "Wrist Agent <Mode>" one
+  titleModelId?: string;         // Optional: Bedrock model for generated titles, defaults to the economy cost class model
+  journalTimezone?: string;      // Optional: IANA timezone deciding which day journal entries count toward, defaults to UTC
+  todoistTokenParamName?: string; // Optional: SSM SecureString holding the Todoist API token
+  todoistProjectId?: string;     // Optional: Todoist project for reminders, defaults to the inbox
+  slackWebhookParamName?: string; // Optional: SSM SecureString holding a Slack incoming webhook URL
+  slackBotTokenParamName?: string; // Optional: SSM SecureString holding a Slack bot token (with slackChannel)
+  slackChannel?: string;         // Optional: Slack channel for bot token delivery
+  sesFromAddress?: string;       // Optional: verified SES identity used by email mode with send:true
+  sesAllowedRecipients?: string; // Optional: comma-separated addresses/@domains email mode may send to (send:true is refused without it)
+  callbackAllowedHosts?: string; // Optional: comma-separated hosts (or *.domain) allowed as callbackUrl
+  callbackSecretParamName?: string; // Optional: SSM SecureString used to HMAC-sign callbacks
+  responseSigningParamName?: string; // Optional: SSM SecureString (under /wrist-agent/) used to HMAC-sign API responses
+  replayProtection?: 'off' | 'optional' | 'required'; // Optional: timestamp+nonce replay checks, defaults to optional (checked when sent)
+  replayWindowSeconds?: number;  // Optional: accepted request timestamp skew, defaults to 300
+  authMode?: 'token' | 'apple' | 'both'; // Optional: authorizer mode, defaults to the shared static token
+  appleClientIds?: string;       // Optional: comma-separated bundle/Services IDs accepted as Apple token audiences
+  quotaDailyRequests?: number;   // Optional: per-principal requests per UTC day (0/unset = unlimited)
+  quotaMonthlyRequests?: number; // Optional: per-principal requests per UTC month
+  quotaDailyTokens?: number;     // Optional: per-principal Bedrock tokens per UTC day
+  quotaMonthlyTokens?: number;   // Optional: per-principal Bedrock tokens per UTC month
+  budgetMonthlyUsd?: number;     // Optional: per-principal estimated Bedrock spend per UTC month (0/unset = none)
+  budgetGlobalMonthlyUsd?: number; // Optional: deployment-wide estimated Bedrock spend per UTC month (0/unset = none)
+  budgetTenantMonthlyUsd?: number; // Optional: per-tenant estimated Bedrock spend per UTC month (0/unset = none)
+  budgetFallbackModelId?: string; // Optional: model or inference profile used over budget (unset = refuse with 429)
+  costClassEconomyModelId?: string; // Optional: model or inference profile for costClass economy (unset = modelId)
+  costClassPremiumModelId?: string; // Optional: model or inference profile for costClass premium (unset = modelId)
+  auditRetentionDays?: number;   // Optional: days to keep authorizer decisions, defaults to 90
+  ipAllowlist?: string;          // Optional: comma-separated CIDRs/IPs allowed to call the API
+  ipDenylist?: string;           // Optional: comma-separated CIDRs/IPs always denied
+  ipListsParamName?: string;     // Optional: SSM parameter with {"allow":[...],"deny":[...]} CIDR lists
+  ssmFailoverRegion?: string;    // Optional: region holding a replica of the client token parameter
+  circuitBreakerThreshold?: number;      // Optional: SSM failures before the authorizer stops calling SSM, defaults to 3
+  circuitBreakerTimeoutSeconds?: number; // Optional: seconds the circuit stays open before probing, defaults to 30
+  circuitBreakerHalfOpenProbes?: number; // Optional: SSM calls allowed while half-open, defaults to 1
+  bedrockBreakerThreshold?: number;      // Optional: consecutive Bedrock outages before failing fast, defaults to 5
+  bedrockBreakerTimeoutSeconds?: number; // Optional: seconds to return 503 before probing Bedrock, defaults to 30
+  faultInjectionEnabled?: boolean;       // Optional: honor X-Wrist-Fault from every token, not just admins (test stacks only), defaults to false
+  anthropicFallbackEnabled?: boolean;    // Optional: answer through the Anthropic API while Bedrock is down, defaults to false
+  anthropicApiKeySecretArn?: string;     // Optional: Secrets Manager secret holding the Anthropic API key
+  anthropicFallbackModel?: string;       // Optional: Anthropic API model for the fallback, defaults to claude-haiku-4-5
+  queueWhenDown?: boolean;               // Optional: save captures as pending while the Bedrock circuit is open, defaults to false
+  pendingDrainSchedule?: string;         // Optional: EventBridge schedule that drains pending captures, defaults to rate(1 minute)
+  bedrockMaxConcurrency?: number;        // Optional: simultaneous Bedrock calls per model across all instances (0/unset = unlimited)
+  bedrockMaxConcurrencyPerInstance?: number; // Optional: simultaneous Bedrock calls per model in one instance (0/unset = unlimited)
+  bedrockConcurrencyWaitMs?: number;     // Optional: ms a request queues for a free slot before a 429, defaults to 2000
+  bedrockMaxContinuations?: number;      // Optional: extra calls that finish a reply cut off at maxTokens, defaults to 2 (0 disables)
+  modelContextTokens?: number;           // Optional: the model's context window for pre-flight checks, defaults to 200000
+  maxRequestCostUsd?: number;            // Optional: estimated per-request cost ceiling in USD (0/unset = none)
+  bedrockInputUsdPerMtok?: number;       // Optional: model input price per million tokens, defaults to 1 (Haiku 4.5)
+  bedrockOutputUsdPerMtok?: number;      // Optional: model output price per million tokens, defaults to 5 (Haiku 4.5)
+  useParamsExtension?: boolean;  // Optional: read SSM parameters via the Parameters and Secrets Lambda Extension
+  maxBodyBytes?: number;         // Optional: largest accepted request body, defaults to 65536
+  maxTextChars?: number;         // Optional: longest accepted text field, defaults to 8000
+  summarizeMaxTextChars?: number; // Optional: longest accepted text field in summarize mode, defaults to 100000
+  summarizeChunkChars?: number;  // Optional: chunk size for map-reduce summarization of long text, defaults to 24000
+  textTruncatePercent?: number;  // Optional: how far over maxTextChars text is truncated instead of rejected, defaults to 10
+  maxImageBytes?: number;        // Optional: largest accepted image for vision queries, defaults to 3932160 (Bedrock's limit)
+  maxAudioBytes?: number;        // Optional: largest accepted audio clip for transcription, defaults to 4194304
+  transcribeLanguageCode?: string;   // Optional: Amazon Transcribe language for audio requests, defaults to en-US
+  transcribeTimeoutSeconds?: number; // Optional: seconds to wait for a transcript before failing with 504, defaults to 15
+  corsAllowedOrigins?: string;   // Optional: comma-separated browser origins allowed by CORS, defaults to "*"
+  corsAllowedHeaders?: string;   // Optional: comma-separated request headers allowed by CORS
+  corsAllowedMethods?: string;   // Optional: comma-separated methods allowed by CORS
+  compressionMinBytes?: number;  // Optional: smallest response body compressed with br/gzip, defaults to 1024 (0 = off)
+  jobMaxAttempts?: number;       // Optional: attempts for async (async:true) jobs before the dead-letter queue, defaults to 3
+  sseMaxWaitSeconds?: number;    // Optional: how long GET /jobs/{id}/events waits for a new progress stage, defaults to 20
+  telegramSecretParamName?: string; // Optional: SSM SecureString (under /wrist-agent/) holding the Telegram webhook secret token; enables POST /telegram
+  telegramChats?: string;        // Optional: comma-separated Telegram chat IDs the bot answers, each optionally =principal
+  inboundEmailAddresses?: string; // Optional: comma-separated address=principal pairs; mail to them (via SES receiving) is captured
+  inboundEmailSenders?: string;  // Optional: comma-separated sender addresses or @domains allowed to email captures; they must pass DMARC (unset = anyone)
+  alexaSkillId?: string;         // Optional: Alexa skill ID allowed to invoke the function directly (unset = no Alexa skill)
+  functionUrl?: boolean;         // Optional: give the function an IAM-authenticated URL serving the REST routes, defaults to false
+  researchWorkflow?: boolean;    // Optional: run async research jobs as a Step Functions workflow (plan, lookup, synthesize, summarize)
+  researchKnowledgeBaseId?: string; // Optional: Bedrock knowledge base for research lookups (default: the model answers them)
+  dailyDigestPrincipals?: string; // Optional: comma-separated principals that get a daily digest (unset = no digest job)
+  dailyDigestSchedule?: string;  // Optional: EventBridge cron for the digest, defaults to cron(0 7 * * ? *) (07:00 UTC)
+  dailyDigestEmail?: string;     // Optional: comma-separated addresses the digest is emailed to via SES
+  dailyDigestWebhookUrl?: string; // Optional: URL the digest JSON is POSTed to
+  digestTimezone?: string;       // Optional: IANA timezone deciding the digest's "yesterday" and "today", defaults to UTC
+  weeklySummaryRecipients?: string; // Optional: comma-separated principal=address pairs opted in to the weekly summary email
+  weeklySummarySchedule?: string; // Optional: EventBridge cron for the weekly summary, defaults to cron(0 8 ? * MON *)
+  noteDeleteRetentionDays?: number; // Optional: days a deleted note is kept before the TTL purges it, defaults to 30
+  duplicateWindowHours?: number; // Optional: hours of captures checked for near-duplicates, defaults to 24 (0 disables)
+  duplicateThreshold?: number;   // Optional: similarity (0-1) at which a capture counts as a duplicate, defaults to 0.8
+  conversationTtlDays?: number;  // Optional: days an idle conversation (conversationId) is kept, defaults to 7
+  promptVariants?: string;       // Optional: JSON of mode to weighted prompt variants for A/B tests
+  responseCacheModes?: string;   // Optional: comma-separated modes whose replies are cached, defaults to research,deepthink,question
+  responseCacheTtlHours?: number; // Optional: hours a cached reply is served, defaults to 24 (0 disables)
+  responseCacheFreshHours?: number; // Optional: hours before a cached reply is refreshed in the background, defaults to 6 (0 disables)
+  searchBackend?: string;        // Optional: GET /search backend, dynamodb (default) or opensearch
+  opensearchEndpoint?: string;   // Optional: OpenSearch Serverless collection endpoint for search and the opensearch sink
+  opensearchIndex?: string;      // Optional: index captures are stored in, defaults to captures
+  opensearchCollectionArn?: string; // Optional: collection ARN the function is granted aoss:APIAccessAll on
 }
 
 export interface WristAgentStackProps extends cdk.StackProps {
@@ -41,6 +174,10 @@ export class WristAgentStack extends cdk.Stack {
     const throttleRateLimit = config.throttleRateLimit ?? DEFAULT_THROTTLE_RATE_LIMIT;
     const throttleBurstLimit = config.throttleBurstLimit ?? DEFAULT_THROTTLE_BURST_LIMIT;
 
+    // An application inference profile or provisioned throughput ARN in modelId is called
+    // directly; otherwise requests go through the Haiku 4.5 cross-region profile
+    const modelArn = config.modelId.startsWith('arn:') ? config.modelId : undefined;
+
     // Create cross-region inference profile for Claude Haiku 4.5
     const crossRegionProfile = bedrock.CrossRegionInferenceProfile.fromConfig({
       geoRegion: config.geoRegion === 'US'
@@ -62,6 +199,35 @@ export class WristAgentStack extends cdk.Stack {
       tier: ssm.ParameterTier.STANDARD,
     });
 
+    // Create registry of scoped client tokens (pk = SHA-256 hex of the token)
+    // Items: { tokenHash, name, scopes: ["mode:note", "tier:low", ...], disabled, expiresAt }
+    const tokenTable = new dynamodb.Table(this, 'TokenTable', {
+      partitionKey: { name: 'tokenHash', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      timeToLiveAttribute: 'expiresAt',
+      pointInTimeRecovery: true,
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+    });
+
+    // Create audit log of authorizer decisions (pk = UTC day, sk = timestamp#requestId)
+    const auditTable = new dynamodb.Table(this, 'AuditTable', {
+      partitionKey: { name: 'day', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'sk', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      timeToLiveAttribute: 'expiresAt',
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+    });
+
+    // Optional Parameters and Secrets Lambda Extension: serves SSM parameters from a local
+    // cache on localhost:2773, cutting cold-start latency and GetParameter call volume
+    const paramsAndSecrets = config.useParamsExtension
+      ? lambda.ParamsAndSecretsLayerVersion.fromVersion(lambda.ParamsAndSecretsVersions.V1_0_103, {
+          cacheSize: 50,
+          logLevel: lambda.ParamsAndSecretsLogLevel.WARN,
+          parameterStoreTtl: cdk.Duration.seconds(TOKEN_CACHE_TTL_SECONDS),
+        })
+      : undefined;
+
     // Create Lambda Authorizer function
     this.authorizerFn = new GoFunction(this, 'WristAgentAuthorizer', {
       entry: '../lambda-authorizer',
@@ -69,15 +235,64 @@ export class WristAgentStack extends cdk.Stack {
       runtime: lambda.Runtime.PROVIDED_AL2,
       timeout: cdk.Duration.seconds(10),
       memorySize: 128,
+      paramsAndSecrets,
       environment: {
+        USE_PARAMS_EXTENSION: String(Boolean(config.useParamsExtension)),
         CLIENT_TOKEN_PARAM_NAME: config.clientTokenParamName,
         TOKEN_CACHE_TTL_SECONDS: String(TOKEN_CACHE_TTL_SECONDS),
+        AUTH_MODE: config.authMode ?? 'token',
+        APPLE_CLIENT_IDS: config.appleClientIds ?? '',
+        TOKEN_TABLE_NAME: tokenTable.tableName,
+        AUDIT_TABLE_NAME: auditTable.tableName,
+        AUDIT_RETENTION_DAYS: String(config.auditRetentionDays ?? 90),
+        IP_ALLOWLIST: config.ipAllowlist ?? '',
+        IP_DENYLIST: config.ipDenylist ?? '',
+        IP_LISTS_PARAM_NAME: config.ipListsParamName ?? '',
+        SSM_FAILOVER_REGION: config.ssmFailoverRegion ?? '',
+        SSM_FAILOVER_PARAM_NAME: config.clientTokenParamName,
+        CIRCUIT_BREAKER_THRESHOLD: String(config.circuitBreakerThreshold ?? 3),
+        CIRCUIT_BREAKER_TIMEOUT_SECONDS: String(config.circuitBreakerTimeoutSeconds ?? 30),
+        CIRCUIT_BREAKER_HALF_OPEN_PROBES: String(config.circuitBreakerHalfOpenProbes ?? 1),
       },
       description: 'Wrist Agent API Gateway Lambda Authorizer',
     });
 
     // Grant authorizer function access to SSM parameter (both String and SecureString)
     tokenParam.grantRead(this.authorizerFn);
+    tokenTable.grantReadData(this.authorizerFn);
+    auditTable.grantWriteData(this.authorizerFn);
+
+    // Allow reading the token replica (created out of band) if a failover region is configured
+    if (config.ssmFailoverRegion) {
+      this.authorizerFn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['ssm:GetParameter'],
+        resources: [
+          `arn:aws:ssm:${config.ssmFailoverRegion}:${this.account}:parameter/${config.clientTokenParamName.replace(/^\//, '')}`,
+        ],
+      }));
+      this.authorizerFn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['kms:Decrypt'],
+        resources: [
+          `arn:aws:kms:${config.ssmFailoverRegion}:${this.account}:alias/aws/ssm`,
+        ],
+        conditions: {
+          StringEquals: {
+            'kms:ViaService': `ssm.${config.ssmFailoverRegion}.amazonaws.com`,
+          },
+        },
+      }));
+    }
+    if (config.ipListsParamName) {
+      this.authorizerFn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['ssm:GetParameter'],
+        resources: [
+          `arn:aws:ssm:${config.region}:${this.account}:parameter/${config.ipListsParamName.replace(/^\//, '')}`,
+        ],
+      }));
+    }
 
     // Grant KMS decrypt permission for SecureString parameters
     // Scoped to the AWS-managed SSM key (alias/aws/ssm) for least-privilege
@@ -94,6 +309,95 @@ export class WristAgentStack extends cdk.Stack {
       },
     }));
 
+    // Create history table for captured notes/reminders/events (dynamodb sink)
+    // Single-table design: pk = USER#<principal>, sk = CAPTURE#<id> (plus other per-user records)
+    const historyTable = new dynamodb.Table(this, 'HistoryTable', {
+      partitionKey: { name: 'pk', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'sk', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      timeToLiveAttribute: 'expiresAt',
+      pointInTimeRecovery: true,
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+    });
+
+    // Create bucket for markdown exports of captures (s3 sink)
+    const captureBucket = new s3.Bucket(this, 'CaptureBucket', {
+      blockPublicAccess: s3.BlockPublicAccess.BLOCK_ALL,
+      encryption: s3.BucketEncryption.S3_MANAGED,
+      enforceSSL: true,
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+      // Uploaded images and audio (and audio transcripts) are only needed until the request that uses them
+      lifecycleRules: [
+        { prefix: 'uploads/', expiration: cdk.Duration.days(1) },
+        { prefix: 'transcripts/', expiration: cdk.Duration.days(1) },
+        { prefix: 'speech/', expiration: cdk.Duration.days(1) }, // spoken replies (speak:true)
+        { prefix: 'exports/', expiration: cdk.Duration.days(1) }, // GET /export?delivery=url archives
+        { prefix: 'inbound/', expiration: cdk.Duration.days(1) }, // received emails, deleted once captured
+      ],
+    });
+
+    // Sink settings are only passed through when configured
+    const sinkEnvironment: Record<string, string> = {};
+    if (config.sinksParamName) sinkEnvironment.SINKS_PARAM_NAME = config.sinksParamName;
+    if (config.sinkWebhookUrl) sinkEnvironment.SINK_WEBHOOK_URL = config.sinkWebhookUrl;
+    if (config.notionDatabaseId) sinkEnvironment.NOTION_DATABASE_ID = config.notionDatabaseId;
+    if (config.notionTokenParamName) sinkEnvironment.NOTION_TOKEN_PARAM_NAME = config.notionTokenParamName;
+    if (config.notionTitleProperty) sinkEnvironment.NOTION_TITLE_PROPERTY = config.notionTitleProperty;
+    if (config.notionTagsProperty) sinkEnvironment.NOTION_TAGS_PROPERTY = config.notionTagsProperty;
+    if (config.notionDueProperty) sinkEnvironment.NOTION_DUE_PROPERTY = config.notionDueProperty;
+    if (config.googleCalendarCredentialsParamName) {
+      sinkEnvironment.GOOGLE_CALENDAR_CREDENTIALS_PARAM_NAME = config.googleCalendarCredentialsParamName;
+    }
+    if (config.googleCalendarId) sinkEnvironment.GOOGLE_CALENDAR_ID = config.googleCalendarId;
+    if (config.caldavSecretArn) sinkEnvironment.CALDAV_SECRET_ARN = config.caldavSecretArn;
+    if (config.caldavTargets) sinkEnvironment.CALDAV_TARGETS = config.caldavTargets;
+    if (config.todoistTokenParamName) sinkEnvironment.TODOIST_TOKEN_PARAM_NAME = config.todoistTokenParamName;
+    if (config.todoistProjectId) sinkEnvironment.TODOIST_PROJECT_ID = config.todoistProjectId;
+    if (config.slackWebhookParamName) sinkEnvironment.SLACK_WEBHOOK_PARAM_NAME = config.slackWebhookParamName;
+    if (config.slackBotTokenParamName) sinkEnvironment.SLACK_BOT_TOKEN_PARAM_NAME = config.slackBotTokenParamName;
+    if (config.slackChannel) sinkEnvironment.SLACK_CHANNEL = config.slackChannel;
+
+    // CORS policy shared by API Gateway preflight, gateway error responses and the handler
+    const csv = (value: string | undefined, fallback: string[]) => {
+      const items = (value ?? '').split(',').map((item) => item.trim()).filter((item) => item !== '');
+      return items.length > 0 ? items : fallback;
+    };
+    const corsOrigins = csv(config.corsAllowedOrigins, apigateway.Cors.ALL_ORIGINS);
+    const corsHeaders = csv(config.corsAllowedHeaders, ['Content-Type', 'X-Client-Token', 'X-Wrist-Timestamp', 'X-Wrist-Nonce']);
+    const corsMethods = csv(config.corsAllowedMethods, ['GET', 'POST', 'PUT', 'PATCH', 'DELETE', 'OPTIONS']);
+
+    // Response compression: the handler returns br/gzip bodies base64-encoded, and API Gateway
+    // only decodes them to binary when binaryMediaTypes matches
+    const compressionMinBytes = config.compressionMinBytes ?? 1024;
+
+    // Async capture queue (async:true): the handler enqueues validated requests and the same
+    // function consumes them; messages that fail every attempt land in the dead-letter queue
+    const jobMaxAttempts = config.jobMaxAttempts ?? 3;
+    const jobDeadLetterQueue = new sqs.Queue(this, 'JobDeadLetterQueue', {
+      retentionPeriod: cdk.Duration.days(14),
+      encryption: sqs.QueueEncryption.SQS_MANAGED,
+      enforceSSL: true,
+    });
+    const jobQueue = new sqs.Queue(this, 'JobQueue', {
+      visibilityTimeout: cdk.Duration.seconds(300 * 6), // 6x the function timeout, as AWS recommends
+      encryption: sqs.QueueEncryption.SQS_MANAGED,
+      enforceSSL: true,
+      deadLetterQueue: { queue: jobDeadLetterQueue, maxReceiveCount: jobMaxAttempts },
+    });
+
+    // Research workflow state machine. Its name is fixed so the handler can be given the ARN
+    // without a dependency cycle (the state machine invokes the handler)
+    const researchStateMachineName = `${this.stackName}-research`;
+    const researchStateMachineArn = cdk.Stack.of(this).formatArn({
+      service: 'states',
+      resource: 'stateMachine',
+      resourceName: researchStateMachineName,
+      arnFormat: cdk.ArnFormat.COLON_RESOURCE_NAME,
+    });
+    const researchEnvironment: Record<string, string> = {};
+    if (config.researchWorkflow) researchEnvironment.RESEARCH_STATE_MACHINE_ARN = researchStateMachineArn;
+    if (config.researchKnowledgeBaseId) researchEnvironment.RESEARCH_KNOWLEDGE_BASE_ID = config.researchKnowledgeBaseId;
+
     // Create main handler Lambda function
     this.fn = new GoFunction(this, 'WristAgentHandler', {
       entry: '../lambda',
@@ -101,16 +405,365 @@ export class WristAgentStack extends cdk.Stack {
       runtime: lambda.Runtime.PROVIDED_AL2,
       timeout: cdk.Duration.seconds(300),
       memorySize: 256,
+      paramsAndSecrets,
       environment: {
+        USE_PARAMS_EXTENSION: String(Boolean(config.useParamsExtension)),
         BEDROCK_REGION: config.region,
-        BEDROCK_MODEL_ID: crossRegionProfile.inferenceProfileId,
+        BEDROCK_MODEL_ID: modelArn ?? crossRegionProfile.inferenceProfileId,
+        BEDROCK_MODEL_FAMILY: config.modelFamily ?? '',
+        HISTORY_TABLE_NAME: historyTable.tableName,
+        TOKEN_TABLE_NAME: tokenTable.tableName,
+        CAPTURE_BUCKET_NAME: captureBucket.bucketName,
+        SINKS: config.sinks ?? DEFAULT_SINKS,
+        POSTPROCESS: config.postProcess ?? DEFAULT_POSTPROCESS,
+        POSTPROCESS_PARAM_NAME: config.postProcessParamName ?? '',
+        ICS_DELIVERY: config.icsDelivery ?? 'inline',
+        REDACTION_DENYLIST: config.redactionDenylist ?? '',
+        REDACTION_GUARDRAIL_ID: config.redactionGuardrailId ?? '',
+        REDACTION_GUARDRAIL_VERSION: config.redactionGuardrailVersion ?? 'DRAFT',
+        STRICT_REQUEST_FIELDS: config.strictRequestFields ?? 'off',
+        POLLY_VOICE_ID: config.pollyVoiceId ?? 'Joanna',
+        SHORT_TEXT_MAX_WORDS: String(config.shortTextMaxWords ?? 30),
+        TAG_MAX_COUNT: String(config.tagMaxCount ?? 5),
+        TITLE_MAX_CHARS: String(config.titleMaxChars ?? 50),
+        TITLE_GENERATION: String(config.titleGeneration ?? false),
+        TITLE_MODEL_ID: config.titleModelId ?? '',
+        JOURNAL_TIMEZONE: config.journalTimezone ?? 'UTC',
+        DIGEST_TIMEZONE: config.digestTimezone ?? 'UTC',
+        DAILY_DIGEST_PRINCIPALS: config.dailyDigestPrincipals ?? '',
+        DAILY_DIGEST_EMAIL: config.dailyDigestEmail ?? '',
+        DAILY_DIGEST_WEBHOOK_URL: config.dailyDigestWebhookUrl ?? '',
+        WEEKLY_SUMMARY_RECIPIENTS: config.weeklySummaryRecipients ?? '',
+        NOTE_DELETE_RETENTION_DAYS: String(config.noteDeleteRetentionDays ?? 30),
+        DUPLICATE_WINDOW_HOURS: String(config.duplicateWindowHours ?? 24),
+        DUPLICATE_THRESHOLD: String(config.duplicateThreshold ?? 0.8),
+        CONVERSATION_TTL_DAYS: String(config.conversationTtlDays ?? 7),
+        PROMPT_VARIANTS: config.promptVariants ?? '',
+        RESPONSE_CACHE_MODES: config.responseCacheModes ?? 'research,deepthink,question',
+        RESPONSE_CACHE_TTL_HOURS: String(config.responseCacheTtlHours ?? 24),
+        RESPONSE_CACHE_FRESH_HOURS: String(config.responseCacheFreshHours ?? 6),
+        SEARCH_BACKEND: config.searchBackend ?? 'dynamodb',
+        OPENSEARCH_ENDPOINT: config.opensearchEndpoint ?? '',
+        OPENSEARCH_INDEX: config.opensearchIndex ?? 'captures',
+        SES_FROM_ADDRESS: config.sesFromAddress ?? '',
+        SES_ALLOWED_RECIPIENTS: config.sesAllowedRecipients ?? '',
+        CALLBACK_ALLOWED_HOSTS: config.callbackAllowedHosts ?? '',
+        CALLBACK_SECRET_PARAM_NAME: config.callbackSecretParamName ?? '',
+        RESPONSE_SIGNING_PARAM_NAME: config.responseSigningParamName ?? '',
+        REPLAY_PROTECTION: config.replayProtection ?? 'optional',
+        REPLAY_WINDOW_SECONDS: String(config.replayWindowSeconds ?? 300),
+        QUOTA_DAILY_REQUESTS: String(config.quotaDailyRequests ?? 0),
+        QUOTA_MONTHLY_REQUESTS: String(config.quotaMonthlyRequests ?? 0),
+        QUOTA_DAILY_TOKENS: String(config.quotaDailyTokens ?? 0),
+        QUOTA_MONTHLY_TOKENS: String(config.quotaMonthlyTokens ?? 0),
+        BUDGET_MONTHLY_USD: String(config.budgetMonthlyUsd ?? 0),
+        BUDGET_GLOBAL_MONTHLY_USD: String(config.budgetGlobalMonthlyUsd ?? 0),
+        BUDGET_TENANT_MONTHLY_USD: String(config.budgetTenantMonthlyUsd ?? 0),
+        BUDGET_FALLBACK_MODEL_ID: config.budgetFallbackModelId ?? '',
+        COST_CLASS_ECONOMY_MODEL_ID: config.costClassEconomyModelId ?? '',
+        COST_CLASS_PREMIUM_MODEL_ID: config.costClassPremiumModelId ?? '',
+        BEDROCK_CIRCUIT_BREAKER_THRESHOLD: String(config.bedrockBreakerThreshold ?? 5),
+        BEDROCK_CIRCUIT_BREAKER_TIMEOUT_SECONDS: String(config.bedrockBreakerTimeoutSeconds ?? 30),
+        FAULT_INJECTION_ENABLED: String(config.faultInjectionEnabled ?? false),
+        ANTHROPIC_FALLBACK_ENABLED: String(config.anthropicFallbackEnabled ?? false),
+        ANTHROPIC_API_KEY_SECRET_ARN: config.anthropicApiKeySecretArn ?? '',
+        ANTHROPIC_FALLBACK_MODEL: config.anthropicFallbackModel ?? 'claude-haiku-4-5',
+        QUEUE_WHEN_DOWN: String(config.queueWhenDown ?? false),
+        BEDROCK_MAX_CONCURRENCY: String(config.bedrockMaxConcurrency ?? 0),
+        BEDROCK_MAX_CONCURRENCY_PER_INSTANCE: String(config.bedrockMaxConcurrencyPerInstance ?? 0),
+        BEDROCK_CONCURRENCY_WAIT_MS: String(config.bedrockConcurrencyWaitMs ?? 2000),
+        BEDROCK_MAX_CONTINUATIONS: String(config.bedrockMaxContinuations ?? 2),
+        MODEL_CONTEXT_TOKENS: String(config.modelContextTokens ?? 200000),
+        MAX_REQUEST_COST_USD: String(config.maxRequestCostUsd ?? 0),
+        BEDROCK_INPUT_USD_PER_MTOK: String(config.bedrockInputUsdPerMtok ?? 1),
+        BEDROCK_OUTPUT_USD_PER_MTOK: String(config.bedrockOutputUsdPerMtok ?? 5),
+        MAX_BODY_BYTES: String(config.maxBodyBytes ?? 65536),
+        MAX_TEXT_CHARS: String(config.maxTextChars ?? 8000),
+        SUMMARIZE_MAX_TEXT_CHARS: String(config.summarizeMaxTextChars ?? 100000),
+        SUMMARIZE_CHUNK_CHARS: String(config.summarizeChunkChars ?? 24000),
+        TEXT_TRUNCATE_PERCENT: String(config.textTruncatePercent ?? 10),
+        MAX_IMAGE_BYTES: String(config.maxImageBytes ?? 3932160),
+        MAX_AUDIO_BYTES: String(config.maxAudioBytes ?? 4194304),
+        TRANSCRIBE_LANGUAGE_CODE: config.transcribeLanguageCode ?? 'en-US',
+        TRANSCRIBE_TIMEOUT_SECONDS: String(config.transcribeTimeoutSeconds ?? 15),
+        CORS_ALLOWED_ORIGINS: corsOrigins.join(','),
+        CORS_ALLOWED_HEADERS: corsHeaders.join(','),
+        CORS_ALLOWED_METHODS: corsMethods.join(','),
+        COMPRESSION_MIN_BYTES: String(compressionMinBytes),
+        JOB_QUEUE_URL: jobQueue.queueUrl,
+        JOB_DLQ_URL: jobDeadLetterQueue.queueUrl,
+        JOB_MAX_ATTEMPTS: String(jobMaxAttempts),
+        SSE_MAX_WAIT_SECONDS: String(config.sseMaxWaitSeconds ?? 20),
+        TELEGRAM_SECRET_PARAM_NAME: config.telegramSecretParamName ?? '',
+        TELEGRAM_CHATS: config.telegramChats ?? '',
+        ALEXA_SKILL_ID: config.alexaSkillId ?? '',
+        INBOUND_EMAIL_ADDRESSES: config.inboundEmailAddresses ?? '',
+        INBOUND_EMAIL_SENDERS: config.inboundEmailSenders ?? '',
+        ...sinkEnvironment,
+        ...researchEnvironment,
       },
       description: 'Wrist Agent Lambda handler for Bedrock integration',
     });
 
+    // Email-in: SES stores mail for the capture addresses' domains under inbound/ and then
+    // invokes the function, which captures mail sent to a capture address. The rule set must
+    // be made active once (aws ses set-active-receipt-rule-set), and the domains need MX
+    // records pointing at SES receiving.
+    if (config.inboundEmailAddresses) {
+      const inboundDomains = [...new Set(config.inboundEmailAddresses.split(',')
+        .map(entry => entry.split('=')[0].trim().toLowerCase().split('@')[1])
+        .filter((domain): domain is string => !!domain))];
+      const receiptRuleSet = new ses.ReceiptRuleSet(this, 'InboundEmailRuleSet', {
+        receiptRuleSetName: 'wrist-agent-inbound',
+      });
+      receiptRuleSet.addRule('CaptureEmail', {
+        recipients: inboundDomains,
+        scanEnabled: true, // spam and virus verdicts are checked before capture
+        actions: [
+          new sesActions.S3({ bucket: captureBucket, objectKeyPrefix: 'inbound/' }),
+          new sesActions.Lambda({ function: this.fn, invocationType: sesActions.LambdaInvocationType.EVENT }),
+        ],
+      });
+    }
+
+    // The Alexa skill's endpoint is the function itself; only the configured skill may invoke it
+    if (config.alexaSkillId) {
+      this.fn.addPermission('AlexaSkillInvoke', {
+        principal: new iam.ServicePrincipal('alexa-appkit.amazon.com'),
+        action: 'lambda:InvokeFunction',
+        eventSourceToken: config.alexaSkillId,
+      });
+    }
+
+    // A function URL serves the REST routes to IAM-signed callers, bypassing API Gateway;
+    // the caller's IAM identity is the principal
+    const functionUrl = config.functionUrl
+      ? this.fn.addFunctionUrl({ authType: lambda.FunctionUrlAuthType.AWS_IAM })
+      : undefined;
+
     // Grant cross-region inference permissions
     crossRegionProfile.grantInvoke(this.fn);
 
+    // POST /tokens/count uses the model's own tokenizer
+    this.fn.addToRolePolicy(new iam.PolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['bedrock:CountTokens'],
+      resources: ['arn:aws:bedrock:*::foundation-model/*'],
+    }));
+
+    // The output filter's optional guardrail check
+    if (config.redactionGuardrailId) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['bedrock:ApplyGuardrail'],
+        resources: [`arn:aws:bedrock:${this.region}:${this.account}:guardrail/${config.redactionGuardrailId}`],
+      }));
+    }
+
+    // Application inference profiles also need access to the foundation models they route to
+    if (modelArn) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['bedrock:InvokeModel'],
+        resources: [modelArn, 'arn:aws:bedrock:*::foundation-model/*'],
+      }));
+    }
+
+    // Cost classes and over-budget requests may use other models, called directly or
+    // through a cross-region inference profile
+    const extraModelIds = [
+      config.budgetFallbackModelId,
+      config.costClassEconomyModelId,
+      config.costClassPremiumModelId,
+    ].filter((id): id is string => !!id);
+    if (extraModelIds.length > 0) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['bedrock:InvokeModel'],
+        resources: extraModelIds.flatMap((id) => [
+          `arn:aws:bedrock:*::foundation-model/${id.replace(/^(us|eu|apac|global)\./, '')}`,
+          `arn:aws:bedrock:*:${this.account}:inference-profile/${id}`,
+        ]),
+      }));
+    }
+
+    // Grant sink permissions
+    historyTable.grantReadWriteData(this.fn);
+    tokenTable.grantReadWriteData(this.fn); // admin API manages scoped tokens
+    captureBucket.grantPut(this.fn);
+    captureBucket.grantDelete(this.fn, 'captures/*'); // deleting a note removes its markdown file
+    captureBucket.grantRead(this.fn, 'ics/*'); // presigned .ics URLs are signed with the function's role
+    captureBucket.grantRead(this.fn, 'uploads/*'); // images and audio uploaded via presigned PUTs from /uploads
+    captureBucket.grantRead(this.fn, 'transcripts/*'); // Transcribe writes its output with the function's role
+    captureBucket.grantRead(this.fn, 'speech/*'); // presigned spoken reply URLs are signed with the function's role
+    captureBucket.grantRead(this.fn, 'exports/*'); // presigned export URLs are signed with the function's role
+    captureBucket.grantRead(this.fn, 'inbound/*'); // emails stored by SES receiving
+    captureBucket.grantDelete(this.fn, 'inbound/*');
+
+    // Enqueue and consume async jobs; failed messages are reported individually for retry
+    jobQueue.grantSendMessages(this.fn);
+    this.fn.addEventSource(new SqsEventSource(jobQueue, {
+      batchSize: 1,
+      reportBatchItemFailures: true,
+    }));
+    // POST /admin/reprocess replays dead-lettered jobs and deletes the ones that succeed
+    jobDeadLetterQueue.grantConsumeMessages(this.fn);
+
+    // Daily digest: a morning schedule invokes the handler with {scheduledTask: "dailyDigest"}
+    if (config.dailyDigestPrincipals) {
+      new events.Rule(this, 'DailyDigestSchedule', {
+        schedule: events.Schedule.expression(config.dailyDigestSchedule ?? 'cron(0 7 * * ? *)'),
+        targets: [new targets.LambdaFunction(this.fn, {
+          event: events.RuleTargetInput.fromObject({ scheduledTask: 'dailyDigest' }),
+          retryAttempts: 0, // a retry would deliver the digest twice
+        })],
+      });
+    }
+
+    // Weekly summary: emailed through SES, so it needs sesFromAddress as well
+    if (config.weeklySummaryRecipients) {
+      new events.Rule(this, 'WeeklySummarySchedule', {
+        schedule: events.Schedule.expression(config.weeklySummarySchedule ?? 'cron(0 8 ? * MON *)'),
+        targets: [new targets.LambdaFunction(this.fn, {
+          event: events.RuleTargetInput.fromObject({ scheduledTask: 'weeklySummary' }),
+          retryAttempts: 0, // a retry would send the email twice
+        })],
+      });
+    }
+
+    // Pending captures: saved while the Bedrock circuit was open, moved to the job queue by
+    // {scheduledTask: "pendingCaptures"} once Bedrock answers again
+    if (config.queueWhenDown) {
+      new events.Rule(this, 'PendingCapturesSchedule', {
+        schedule: events.Schedule.expression(config.pendingDrainSchedule ?? 'rate(1 minute)'),
+        targets: [new targets.LambdaFunction(this.fn, {
+          event: events.RuleTargetInput.fromObject({ scheduledTask: 'pendingCaptures' }),
+          retryAttempts: 0, // the next run picks up anything left
+        })],
+      });
+    }
+
+    // Research workflow: each step invokes the handler with {workflowStep, state} and returns
+    // the next state. Throttling and Bedrock outages are retried with back-off; anything else,
+    // or exhausted retries, records the failure on the job
+    if (config.researchWorkflow) {
+      const step = (name: string) => new tasks.LambdaInvoke(this, `Research${name[0].toUpperCase()}${name.slice(1)}`, {
+        lambdaFunction: this.fn,
+        payload: sfn.TaskInput.fromObject({ workflowStep: name, 'state.$': '$' }),
+        payloadResponseOnly: true,
+      });
+      const fail = step('fail').next(new sfn.Fail(this, 'ResearchFailed'));
+      const chain = ['plan', 'lookup', 'synthesize', 'summarize', 'finish'].map((name) => step(name)
+        .addRetry({
+          errors: ['retryableStepError'],
+          interval: cdk.Duration.seconds(10),
+          maxAttempts: 3,
+          backoffRate: 2,
+        })
+        .addCatch(fail, { resultPath: '$.error' }));
+      const definition = chain.slice(1).reduce((steps, next) => steps.next(next), sfn.Chain.start(chain[0]));
+
+      new sfn.StateMachine(this, 'ResearchStateMachine', {
+        stateMachineName: researchStateMachineName,
+        definitionBody: sfn.DefinitionBody.fromChainable(definition),
+        timeout: cdk.Duration.minutes(30),
+      });
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['states:StartExecution'],
+        resources: [researchStateMachineArn],
+      }));
+    }
+
+    // Transcribe audio requests; jobs read media and write transcripts with the function's S3 grants
+    this.fn.addToRolePolicy(new iam.PolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['transcribe:StartTranscriptionJob', 'transcribe:GetTranscriptionJob'],
+      resources: ['*'], // Transcribe doesn't support resource-level permissions
+    }));
+
+    // Spoken replies for speak:true requests
+    this.fn.addToRolePolicy(new iam.PolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['polly:SynthesizeSpeech'],
+      resources: ['*'], // Polly voices aren't resources; lexicons aren't used
+    }));
+
+    // Knowledge base lookups for research
+    if (config.researchKnowledgeBaseId) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['bedrock:Retrieve'],
+        resources: [cdk.Stack.of(this).formatArn({
+          service: 'bedrock',
+          resource: 'knowledge-base',
+          resourceName: config.researchKnowledgeBaseId,
+        })],
+      }));
+    }
+
+    // Grant read access to the CalDAV credentials secret (ARN suffix wildcard covers partial ARNs)
+    if (config.caldavSecretArn) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['secretsmanager:GetSecretValue'],
+        resources: [`${config.caldavSecretArn}*`],
+      }));
+    }
+
+    // Grant read access to the Anthropic API key used as the Bedrock fallback
+    if (config.anthropicApiKeySecretArn) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['secretsmanager:GetSecretValue'],
+        resources: [`${config.anthropicApiKeySecretArn}*`],
+      }));
+    }
+
+    // Grant SES send permission for email mode, scoped to the configured identity
+    if (config.sesFromAddress) {
+      const domain = config.sesFromAddress.split('@')[1];
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['ses:SendEmail'],
+        resources: [
+          `arn:aws:ses:${config.region}:${this.account}:identity/${config.sesFromAddress}`,
+          `arn:aws:ses:${config.region}:${this.account}:identity/${domain}`,
+        ],
+      }));
+    }
+
+    // Grant data-plane access to the OpenSearch Serverless collection; the collection's data
+    // access policy must also allow the function role on the index
+    if (config.opensearchCollectionArn) {
+      this.fn.addToRolePolicy(new iam.PolicyStatement({
+        effect: iam.Effect.ALLOW,
+        actions: ['aoss:APIAccessAll'],
+        resources: [config.opensearchCollectionArn],
+      }));
+    }
+
+    // Grant read access to runtime parameters (sink routing, integration tokens) under /wrist-agent/
+    this.fn.addToRolePolicy(new iam.PolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['ssm:GetParameter'],
+      resources: [
+        `arn:aws:ssm:${config.region}:${this.account}:parameter/wrist-agent/*`,
+      ],
+    }));
+    this.fn.addToRolePolicy(new iam.PolicyStatement({
+      effect: iam.Effect.ALLOW,
+      actions: ['kms:Decrypt'],
+      resources: [
+        `arn:aws:kms:${config.region}:${this.account}:alias/aws/ssm`,
+      ],
+      conditions: {
+        StringEquals: {
+          'kms:ViaService': `ssm.${config.region}.amazonaws.com`,
+        },
+      },
+    }));
+
     // Create REST API with logging
     const logGroup = new logs.LogGroup(this, 'ApiGatewayLogs', {
       retention: logs.RetentionDays.ONE_WEEK,
@@ -140,31 +793,72 @@ export class WristAgentStack extends cdk.Stack {
         throttlingBurstLimit: throttleBurstLimit,
       },
       // CORS Configuration:
-      // Using wildcard origins (allowOrigins: ALL_ORIGINS) for the following reasons:
-      // 1. Primary security layer: Token-based authentication via Lambda Authorizer (not browser-origin-based)
-      // 2. Apple Shortcuts limitation: Cannot set custom Origin headers, always sends "shortcuts://x-callback-url"
-      // 3. Lambda integration: Response headers from Lambda are not required for CORS since API Gateway handles preflight
-      // 4. Security trade-off: While permissive for CORS, the X-Client-Token requirement prevents unauthorized access
-      // 
-      // Alternative considered: Restricting to specific origins would block Apple Shortcuts, the primary client.
-      // If browser-based access is needed in the future, consider adding request validation or IP allowlisting.
+      // CORS only constrains browsers - Apple Shortcuts and the watch app are not subject to it,
+      // and the token authorizer remains the primary security layer. Origins default to "*";
+      // set CORS_ALLOWED_ORIGINS to lock a companion web app down to its own origin(s).
+      // API Gateway answers preflight (echoing a matching origin with Vary: Origin when an
+      // allowlist is set); the handler adds the same headers to actual responses.
       defaultCorsPreflightOptions: {
-        allowOrigins: apigateway.Cors.ALL_ORIGINS,
-        allowMethods: ['POST', 'OPTIONS'],
-        allowHeaders: ['Content-Type', 'X-Client-Token'],
+        allowOrigins: corsOrigins,
+        allowMethods: corsMethods,
+        allowHeaders: corsHeaders,
         maxAge: cdk.Duration.hours(1),
       },
       endpointTypes: [apigateway.EndpointType.REGIONAL],
+      // Request bodies then arrive base64-encoded too; the handler decodes them
+      binaryMediaTypes: compressionMinBytes > 0 ? ['*/*'] : undefined,
     });
 
     // Create REQUEST type Lambda Authorizer
+    // Apple-only mode expects "Authorization: Bearer <identity token>"; in "both" mode
+    // clients send either credential in X-Client-Token
+    const identityHeader = config.authMode === 'apple' ? 'Authorization' : 'X-Client-Token';
+    const identitySources = [apigateway.IdentitySource.header(identityHeader)];
+    // With IP lists, cache decisions per token AND source IP so an Allow isn't reused elsewhere
+    if (config.ipAllowlist || config.ipDenylist || config.ipListsParamName) {
+      identitySources.push(apigateway.IdentitySource.context('identity.sourceIp'));
+    }
     const authorizer = new apigateway.RequestAuthorizer(this, 'TokenAuthorizer', {
       handler: this.authorizerFn,
-      identitySources: [apigateway.IdentitySource.header('X-Client-Token')],
+      identitySources: identitySources,
       resultsCacheTtl: cdk.Duration.seconds(TOKEN_CACHE_TTL_SECONDS),
       authorizerName: 'WristAgentTokenAuthorizer',
     });
 
+    // Return API Gateway's own errors (authorizer denials, throttling) in the handler's
+    // error envelope: {"error": {"code", "message", "retryable", "requestId"}}
+    const gatewayErrors: [string, apigateway.ResponseType, string, string, boolean][] = [
+      ['Unauthorized', apigateway.ResponseType.UNAUTHORIZED, 'UNAUTHORIZED', 'Missing or invalid client token', false],
+      ['AccessDenied', apigateway.ResponseType.ACCESS_DENIED, 'FORBIDDEN', 'Client token rejected', false],
+      ['Throttled', apigateway.ResponseType.THROTTLED, 'THROTTLED', 'Too many requests. Please try again in a moment.', true],
+      ['AuthorizerFailure', apigateway.ResponseType.AUTHORIZER_FAILURE, 'INTERNAL_ERROR', 'Authorization failed', true],
+    ];
+    for (const [id, type, code, message, retryable] of gatewayErrors) {
+      const throttled = type === apigateway.ResponseType.THROTTLED;
+      this.api.addGatewayResponse(`${id}Response`, {
+        type,
+        responseHeaders: {
+          // Stage throttling refills every second, so a 1s back-off is enough
+          ...(throttled ? { 'Retry-After': "'1'" } : {}),
+          // Gateway responses can't echo a matched origin, so only a single origin or "*" is sent
+          ...(corsOrigins.length === 1
+            ? { 'Access-Control-Allow-Origin': `'${corsOrigins[0]}'`, 'Access-Control-Expose-Headers': "'Retry-After'" }
+            : {}),
+        },
+        templates: {
+          'application/json': JSON.stringify({
+            error: {
+              code,
+              message,
+              retryable,
+              requestId: '$context.requestId',
+              ...(throttled ? { details: { reason: 'api_rate_limit', retryAfterSeconds: 1 } } : {}),
+            },
+          }),
+        },
+      });
+    }
+
     // Create /invoke resource with POST method
     const invokeResource = this.api.root.addResource('invoke');
     invokeResource.addMethod('POST', new apigateway.LambdaIntegration(this.fn, {
@@ -175,6 +869,133 @@ export class WristAgentStack extends cdk.Stack {
       authorizationType: apigateway.AuthorizationType.CUSTOM,
     });
 
+    // Create /admin/tokens resources for token lifecycle management
+    // The handler only serves these to the owner token or tokens with the "admin" scope
+    const lambdaIntegration = new apigateway.LambdaIntegration(this.fn, { proxy: true });
+    const methodOptions: apigateway.MethodOptions = {
+      authorizer: authorizer,
+      authorizationType: apigateway.AuthorizationType.CUSTOM,
+    };
+    const adminResource = this.api.root.addResource('admin');
+    const adminTokensResource = adminResource.addResource('tokens');
+    adminTokensResource.addMethod('GET', lambdaIntegration, methodOptions);
+    adminTokensResource.addMethod('POST', lambdaIntegration, methodOptions);
+    const adminTokenResource = adminTokensResource.addResource('{id}');
+    adminTokenResource.addMethod('PATCH', lambdaIntegration, methodOptions);
+    adminTokenResource.addMethod('DELETE', lambdaIntegration, methodOptions);
+
+    // Create /admin/prompt-variants resource reporting parse-failure and fallback rates per prompt variant
+    adminResource.addResource('prompt-variants').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // Create /admin/reprocess resource replaying dead-lettered jobs and pending captures
+    adminResource.addResource('reprocess').addMethod('POST', lambdaIntegration, methodOptions);
+
+    // Versioned invoke routes: /invoke stays v1 for existing Shortcuts, /v1/invoke is the same
+    // shape, and /v2/invoke returns results as a list of items
+    for (const version of ['v1', 'v2']) {
+      this.api.root.addResource(version).addResource('invoke').addMethod('POST', lambdaIntegration, methodOptions);
+    }
+
+    // Create /jobs/{id} resources for polling async requests, and /jobs/{id}/events for
+    // their progress as Server-Sent Events
+    for (const parent of [this.api.root, this.api.root.getResource('v2')!]) {
+      const job = parent.addResource('jobs').addResource('{id}');
+      job.addMethod('GET', lambdaIntegration, methodOptions);
+      job.addResource('events').addMethod('GET', lambdaIntegration, methodOptions);
+    }
+
+    // Create /modes resource for mode discovery (read-only, filtered by token scopes)
+    this.api.root.addResource('modes').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // Create /uploads resource for presigned image and audio uploads (vision queries, transcription)
+    this.api.root.addResource('uploads').addMethod('POST', lambdaIntegration, methodOptions);
+
+    // Create /vocabulary resource for the caller's custom terms (names, jargon) used to fix misheard dictation
+    const vocabulary = this.api.root.addResource('vocabulary');
+    vocabulary.addMethod('GET', lambdaIntegration, methodOptions);
+    vocabulary.addMethod('PUT', lambdaIntegration, methodOptions);
+
+    // Create /preferences resource for the caller's profile (name, home timezone, default mode, list app, verbosity)
+    const preferences = this.api.root.addResource('preferences');
+    preferences.addMethod('GET', lambdaIntegration, methodOptions);
+    preferences.addMethod('PUT', lambdaIntegration, methodOptions);
+
+    // Create /journal/stats resource for journaling streaks and mood counts (journal mode)
+    this.api.root.addResource('journal').addResource('stats').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // Create /digest resource for fetching the daily digest on demand
+    this.api.root.addResource('digest').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // Create /shopping resources for the shopping list (shopping mode) and item check-off
+    const shopping = this.api.root.addResource('shopping');
+    shopping.addMethod('GET', lambdaIntegration, methodOptions);
+    shopping.addResource('items').addResource('{id}').addMethod('PATCH', lambdaIntegration, methodOptions);
+
+    // Create /reminders resources for listing stored reminders, snoozing and rescheduling
+    // them (PATCH /reminders/{id}) and marking them done (POST /reminders/{id}/complete)
+    const reminders = this.api.root.addResource('reminders');
+    reminders.addMethod('GET', lambdaIntegration, methodOptions);
+    const reminder = reminders.addResource('{id}');
+    reminder.addMethod('PATCH', lambdaIntegration, methodOptions);
+    reminder.addResource('complete').addMethod('POST', lambdaIntegration, methodOptions);
+
+    // Create /notes/{id} resource for correcting and deleting stored notes
+    const note = this.api.root.addResource('notes').addResource('{id}');
+    note.addMethod('PUT', lambdaIntegration, methodOptions);
+    note.addMethod('DELETE', lambdaIntegration, methodOptions);
+
+    // Create /export resource for downloading notes as a zip of markdown files
+    this.api.root.addResource('export').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // Create /import resource for seeding history with existing markdown notes
+    this.api.root.addResource('import').addMethod('POST', lambdaIntegration, methodOptions);
+
+    // Create /telegram resource for the Telegram bot's webhook. Telegram can't send a client
+    // token, so there is no authorizer: the handler checks the webhook's secret token header.
+    if (config.telegramSecretParamName) {
+      this.api.root.addResource('telegram').addMethod('POST', lambdaIntegration, {
+        authorizationType: apigateway.AuthorizationType.NONE,
+      });
+    }
+
+    // Create /search resource for keyword, date, tag and mode search over stored captures
+    this.api.root.addResource('search').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // Create /selftest resource: an admin-only canary for synthetic monitors
+    this.api.root.addResource('selftest').addMethod('POST', lambdaIntegration, methodOptions);
+
+    // Create /tokens/count resource so clients can check a transcript's size before sending it
+    this.api.root.addResource('tokens').addResource('count').addMethod('POST', lambdaIntegration, methodOptions);
+
+    // Create /openapi.json resource serving the OpenAPI 3 document generated from the handler's types
+    this.api.root.addResource('openapi.json').addMethod('GET', lambdaIntegration, methodOptions);
+
+    // WebSocket API for sessions: the phone app authenticates once on $connect and then
+    // sends invoke messages, receiving progress, streamed reply text and results
+    const webSocketAuthorizer = new WebSocketLambdaAuthorizer('WebSocketAuthorizer', this.authorizerFn, {
+      authorizerName: 'WristAgentWebSocketAuthorizer',
+      identitySource: [`route.request.header.${identityHeader}`],
+    });
+    const webSocketIntegration = new WebSocketLambdaIntegration('WebSocketIntegration', this.fn);
+    const webSocketApi = new apigwv2.WebSocketApi(this, 'WristAgentWebSocketApi', {
+      apiName: 'wrist-agent-ws',
+      description: 'WebSocket sessions for Wrist Agent',
+      connectRouteOptions: { integration: webSocketIntegration, authorizer: webSocketAuthorizer },
+      disconnectRouteOptions: { integration: webSocketIntegration },
+      defaultRouteOptions: { integration: webSocketIntegration },
+    });
+    const webSocketStage = new apigwv2.WebSocketStage(this, 'WristAgentWebSocketStage', {
+      webSocketApi,
+      stageName: 'prod',
+      autoDeploy: true,
+      throttle: {
+        rateLimit: throttleRateLimit,
+        burstLimit: throttleBurstLimit,
+      },
+    });
+    // Replies are posted back to connections through the management API
+    webSocketApi.grantManageConnections(this.fn);
+
     // Output the API Gateway URL
     new cdk.CfnOutput(this, 'ApiEndpoint', {
       value: this.api.url,
@@ -188,6 +1009,25 @@ export class WristAgentStack extends cdk.Stack {
       exportName: 'WristAgentInvokeEndpoint',
     });
 
+    new cdk.CfnOutput(this, 'WebSocketEndpoint', {
+      value: webSocketStage.url,
+      description: 'WebSocket URL for Wrist Agent sessions',
+    });
+
+    if (config.alexaSkillId) {
+      new cdk.CfnOutput(this, 'AlexaEndpointArn', {
+        value: this.fn.functionArn,
+        description: 'Default endpoint ARN for the Alexa skill',
+      });
+    }
+
+    if (functionUrl) {
+      new cdk.CfnOutput(this, 'FunctionUrl', {
+        value: functionUrl.url,
+        description: 'IAM-authenticated function URL for Wrist Agent',
+      });
+    }
+
     new cdk.CfnOutput(this, 'TokenParameterName', {
       value: tokenParam.parameterName,
       description: 'SSM parameter name for the Wrist Agent client token',
@@ -200,6 +1040,36 @@ export class WristAgentStack extends cdk.Stack {
       exportName: 'WristAgentInferenceProfileId',
     });
 
+    new cdk.CfnOutput(this, 'JobDeadLetterQueueUrl', {
+      value: jobDeadLetterQueue.queueUrl,
+      description: 'Dead-letter queue for async jobs that failed every attempt',
+      exportName: 'WristAgentJobDeadLetterQueueUrl',
+    });
+
+    new cdk.CfnOutput(this, 'HistoryTableName', {
+      value: historyTable.tableName,
+      description: 'DynamoDB table storing Wrist Agent captures',
+      exportName: 'WristAgentHistoryTableName',
+    });
+
+    new cdk.CfnOutput(this, 'TokenTableName', {
+      value: tokenTable.tableName,
+      description: 'DynamoDB registry of scoped client tokens',
+      exportName: 'WristAgentTokenTableName',
+    });
+
+    new cdk.CfnOutput(this, 'AuditTableName', {
+      value: auditTable.tableName,
+      description: 'DynamoDB audit log of authorizer decisions',
+      exportName: 'WristAgentAuditTableName',
+    });
+
+    new cdk.CfnOutput(this, 'CaptureBucketName', {
+      value: captureBucket.bucketName,
+      description: 'S3 bucket receiving markdown copies of captures',
+      exportName: 'WristAgentCaptureBucketName',
+    });
+
     // Add tags to all resources
     cdk.Tags.of(this).add('Project', 'WristAgent');
     cdk.Tags.of(this).add('Component', 'Infrastructure');
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sign in with Apple configuration
+const (
+	appleIssuer         = "https://appleid.apple.com"
+	appleJWKSCacheTTL   = 24 * time.Hour   // Apple rotates keys rarely; unknown kids force a refresh
+	appleJWKSMinRefresh = 1 * time.Minute  // Minimum interval between forced refreshes
+	appleClockSkew      = 60 * time.Second // Leeway applied to exp/iat checks
+)
+
+// appleJWKSURL is a variable so tests can point it at a local server
+var appleJWKSURL = "https://appleid.apple.com/auth/keys"
+
+var (
+	appleHTTPClient = &http.Client{Timeout: 3 * time.Second}
+	appleKeys       = &JWKSCache{}
+)
+
+// JWKSCache holds Apple's public signing keys by key ID
+type JWKSCache struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	mu        sync.RWMutex
+}
+
+// appleClaims are the identity token claims checked by the authorizer
+type appleClaims struct {
+	Issuer   string        `json:"iss"`
+	Subject  string        `json:"sub"`
+	Audience appleAudience `json:"aud"`
+	Expiry   int64         `json:"exp"`
+	IssuedAt int64         `json:"iat"`
+}
+
+// appleAudience accepts the aud claim as either a string or an array of strings
+type appleAudience []string
+
+func (a *appleAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = appleAudience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// looksLikeJWT reports whether a bearer token has the three-segment JWT shape
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// appleAudiences returns the allowed aud values from APPLE_CLIENT_IDS (comma-separated
+// bundle IDs / Services IDs)
+func appleAudiences() []string {
+	var audiences []string
+	for _, id := range strings.Split(getEnv("APPLE_CLIENT_IDS", ""), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			audiences = append(audiences, id)
+		}
+	}
+	return audiences
+}
+
+// applePrincipal maps an Apple user identifier (sub) to a principal ID
+func applePrincipal(sub string) string {
+	return "apple-" + sub
+}
+
+// verifyAppleToken validates an Apple identity token's signature, issuer, audience and
+// lifetime, returning the token's subject
+// SECURITY: Never log the token itself - only the failure reason
+func verifyAppleToken(ctx context.Context, token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("invalid header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return "", fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	key, err := appleKeys.key(ctx, header.Kid)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return "", fmt.Errorf("signature verification failed")
+	}
+
+	var claims appleClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("invalid claims: %w", err)
+	}
+	if err := claims.validate(appleAudiences(), now); err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// validate checks iss, aud, exp and iat against the configured audiences
+func (c appleClaims) validate(audiences []string, now time.Time) error {
+	if c.Issuer != appleIssuer {
+		return fmt.Errorf("unexpected issuer %q", c.Issuer)
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("missing sub claim")
+	}
+	if !audienceAllowed(c.Audience, audiences) {
+		return fmt.Errorf("audience not allowed")
+	}
+	if c.Expiry == 0 || now.After(time.Unix(c.Expiry, 0).Add(appleClockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+	if c.IssuedAt != 0 && time.Unix(c.IssuedAt, 0).After(now.Add(appleClockSkew)) {
+		return fmt.Errorf("token issued in the future")
+	}
+	return nil
+}
+
+// audienceAllowed reports whether any token audience is in the allowed list
+func audienceAllowed(tokenAud, allowed []string) bool {
+	for _, aud := range tokenAud {
+		for _, want := range allowed {
+			if aud == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment base64url-decodes a JWT segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// key returns the public key for kid, fetching Apple's JWKS when the cache is empty,
+// expired, or doesn't know the kid (keys are rotated)
+func (c *JWKSCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	now := time.Now()
+
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := now.Sub(c.fetchedAt) < appleJWKSCacheTTL
+	recentlyFetched := now.Sub(c.fetchedAt) < appleJWKSMinRefresh
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !ok && fresh && recentlyFetched {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		// Fall back to a stale key rather than locking every user out
+		if ok {
+			log.Printf("JWKS refresh failed, using stale key: %v", err)
+			return key, nil
+		}
+		return nil, &jwksError{err: err}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// refresh downloads and parses Apple's JWKS
+func (c *JWKSCache) refresh(ctx context.Context) error {
+	fetchCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, appleJWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := appleHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			log.Printf("Skipping malformed JWKS key %s", k.Kid)
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("JWKS contained no usable keys")
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	log.Printf("Apple JWKS refreshed: %d keys", len(keys))
+	return nil
+}
+
+// jwksError marks failures to reach Apple's key endpoint (vs. a bad token)
+type jwksError struct {
+	err error
+}
+
+func (e *jwksError) Error() string { return e.err.Error() }
+func (e *jwksError) Unwrap() error { return e.err }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// useAppleJWKS serves key as Apple's JWKS under kid and resets the key cache
+func useAppleJWKS(t *testing.T, kid string, key *rsa.PrivateKey) *int32 {
+	t.Helper()
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	origURL := appleJWKSURL
+	appleJWKSURL = server.URL
+	appleKeys = &JWKSCache{}
+	t.Cleanup(func() {
+		appleJWKSURL = origURL
+		appleKeys = &JWKSCache{}
+	})
+	return &fetches
+}
+
+// signAppleToken builds an RS256 JWT with the given header kid and claims
+func signAppleToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validAppleClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": appleIssuer,
+		"sub": "001234.abcdef.0987",
+		"aud": "com.example.wrist",
+		"exp": now.Add(10 * time.Minute).Unix(),
+		"iat": now.Unix(),
+	}
+}
+
+func TestVerifyAppleToken(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	t.Setenv("APPLE_CLIENT_IDS", "com.example.wrist, com.example.watch")
+	now := time.Now()
+
+	with := func(field string, value interface{}) map[string]interface{} {
+		claims := validAppleClaims(now)
+		claims[field] = value
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantSub string
+		wantErr bool
+	}{
+		{name: "valid token", token: signAppleToken(t, key, "k1", validAppleClaims(now)), wantSub: "001234.abcdef.0987"},
+		{name: "audience array", token: signAppleToken(t, key, "k1", with("aud", []string{"other", "com.example.watch"})), wantSub: "001234.abcdef.0987"},
+		{name: "wrong audience", token: signAppleToken(t, key, "k1", with("aud", "com.attacker.app")), wantErr: true},
+		{name: "wrong issuer", token: signAppleToken(t, key, "k1", with("iss", "https://evil.example")), wantErr: true},
+		{name: "expired", token: signAppleToken(t, key, "k1", with("exp", now.Add(-time.Hour).Unix())), wantErr: true},
+		{name: "issued in future", token: signAppleToken(t, key, "k1", with("iat", now.Add(time.Hour).Unix())), wantErr: true},
+		{name: "missing sub", token: signAppleToken(t, key, "k1", with("sub", "")), wantErr: true},
+		{name: "wrong signing key", token: signAppleToken(t, otherKey, "k1", validAppleClaims(now)), wantErr: true},
+		{name: "unknown kid", token: signAppleToken(t, key, "k2", validAppleClaims(now)), wantErr: true},
+		{name: "malformed", token: "not.a.jwt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAppleJWKS(t, "k1", key)
+
+			sub, err := verifyAppleToken(context.Background(), tt.token, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyAppleToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sub != tt.wantSub {
+				t.Errorf("Expected sub %q, got %q", tt.wantSub, sub)
+			}
+		})
+	}
+}
+
+func TestVerifyAppleToken_AlgNone(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	useAppleJWKS(t, "k1", key)
+	t.Setenv("APPLE_CLIENT_IDS", "com.example.wrist")
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"k1"}`))
+	payload, _ := json.Marshal(validAppleClaims(time.Now()))
+	token := header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+
+	if _, err := verifyAppleToken(context.Background(), token, time.Now()); err == nil {
+		t.Error("Expected alg=none token to be rejected")
+	}
+}
+
+func TestJWKSCache_Caching(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fetches := useAppleJWKS(t, "k1", key)
+
+	for i := 0; i < 3; i++ {
+		if _, err := appleKeys.key(context.Background(), "k1"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(fetches); got != 1 {
+		t.Errorf("Expected 1 JWKS fetch, got %d", got)
+	}
+
+	// Unknown kids right after a refresh must not hammer the endpoint
+	for i := 0; i < 3; i++ {
+		if _, err := appleKeys.key(context.Background(), "rotated"); err == nil {
+			t.Fatal("Expected unknown kid error")
+		}
+	}
+	if got := atomic.LoadInt32(fetches); got != 1 {
+		t.Errorf("Expected unknown kid lookups to be rate limited, got %d fetches", got)
+	}
+}
+
+func TestJWKSCache_FetchFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	origURL := appleJWKSURL
+	appleJWKSURL = server.URL
+	appleKeys = &JWKSCache{}
+	defer func() {
+		appleJWKSURL = origURL
+		appleKeys = &JWKSCache{}
+	}()
+
+	_, err := appleKeys.key(context.Background(), "k1")
+	if _, ok := err.(*jwksError); !ok {
+		t.Errorf("Expected jwksError, got %T (%v)", err, err)
+	}
+}
+
+func TestGetAuthMode(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: AuthModeToken},
+		{env: "apple", want: AuthModeApple},
+		{env: " BOTH ", want: AuthModeBoth},
+		{env: "saml", want: AuthModeToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("AUTH_MODE", tt.env)
+			if got := getAuthMode(); got != tt.want {
+				t.Errorf("getAuthMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_AppleMode(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	useAppleJWKS(t, "k1", key)
+	t.Setenv("APPLE_CLIENT_IDS", "com.example.wrist")
+
+	origMode := authMode
+	authMode = AuthModeApple
+	defer func() { authMode = origMode }()
+
+	token := signAppleToken(t, key, "k1", validAppleClaims(time.Now()))
+	resp, err := handler(context.Background(), events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		MethodArn: "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/invoke",
+		Headers:   map[string]string{"Authorization": "Bearer " + token},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.PolicyDocument.Statement[0].Effect != "Allow" {
+		t.Fatalf("Expected Allow, got %s", resp.PolicyDocument.Statement[0].Effect)
+	}
+	if resp.PrincipalID != "apple-001234.abcdef.0987" {
+		t.Errorf("Expected principal mapped from sub, got %s", resp.PrincipalID)
+	}
+
+	// Static tokens are not accepted in apple-only mode
+	resp, _ = handler(context.Background(), events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		MethodArn: "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/invoke",
+		Headers:   map[string]string{"X-Client-Token": "static-token"},
+	})
+	if resp.PolicyDocument.Statement[0].Effect != "Deny" || resp.Context["errorType"] != ErrInvalidToken {
+		t.Errorf("Expected Deny with invalid_token, got %+v", resp)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Default audit retention in days (can be overridden by AUDIT_RETENTION_DAYS env var)
+const defaultAuditRetentionDays = 90
+
+// auditAPI is the subset of the DynamoDB client used for the audit log
+type auditAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// AuditRecord is one authorization decision (pk = UTC day, sk = timestamp#requestId)
+// SECURITY: Records hold principal hashes only - never token values
+type AuditRecord struct {
+	Day        string `dynamodbav:"day"`
+	SK         string `dynamodbav:"sk"`
+	Timestamp  string `dynamodbav:"timestamp"`
+	Principal  string `dynamodbav:"principal"`
+	Effect     string `dynamodbav:"effect"`
+	ErrorType  string `dynamodbav:"errorType,omitempty"`
+	AuthMethod string `dynamodbav:"authMethod,omitempty"`
+	SourceIP   string `dynamodbav:"sourceIp,omitempty"`
+	UserAgent  string `dynamodbav:"userAgent,omitempty"`
+	MethodArn  string `dynamodbav:"methodArn"`
+	RequestID  string `dynamodbav:"requestId,omitempty"`
+	ExpiresAt  int64  `dynamodbav:"expiresAt"`
+}
+
+var (
+	auditClient    auditAPI
+	auditTableName string
+)
+
+// getAuditRetention reads audit retention from environment or returns default
+func getAuditRetention() time.Duration {
+	if env := os.Getenv("AUDIT_RETENTION_DAYS"); env != "" {
+		if days, err := strconv.Atoi(env); err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour
+		}
+		log.Printf("Invalid AUDIT_RETENTION_DAYS value: %s, using default", env)
+	}
+	return time.Duration(defaultAuditRetentionDays) * 24 * time.Hour
+}
+
+// newAuditRecord describes the decision in resp for the request in event
+func newAuditRecord(event events.APIGatewayCustomAuthorizerRequestTypeRequest, resp events.APIGatewayCustomAuthorizerResponse, now time.Time) AuditRecord {
+	now = now.UTC()
+	record := AuditRecord{
+		Day:       now.Format("2006-01-02"),
+		SK:        now.Format(time.RFC3339Nano) + "#" + event.RequestContext.RequestID,
+		Timestamp: now.Format(time.RFC3339Nano),
+		Principal: resp.PrincipalID,
+		Effect:    "Deny",
+		SourceIP:  event.RequestContext.Identity.SourceIP,
+		UserAgent: headerValue(event.Headers, "User-Agent"),
+		MethodArn: event.MethodArn,
+		RequestID: event.RequestContext.RequestID,
+		ExpiresAt: now.Add(getAuditRetention()).Unix(),
+	}
+	if len(resp.PolicyDocument.Statement) > 0 {
+		record.Effect = resp.PolicyDocument.Statement[0].Effect
+	}
+	record.ErrorType, _ = resp.Context["errorType"].(string)
+	record.AuthMethod, _ = resp.Context["authMethod"].(string)
+	return record
+}
+
+// headerValue returns a request header regardless of case
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// recordAuthDecision writes the decision to the audit table when AUDIT_TABLE_NAME is set.
+// Audit failures are logged and never change the decision.
+func recordAuthDecision(ctx context.Context, event events.APIGatewayCustomAuthorizerRequestTypeRequest, resp events.APIGatewayCustomAuthorizerResponse) {
+	if auditTableName == "" || auditClient == nil {
+		return
+	}
+
+	item, err := attributevalue.MarshalMap(newAuditRecord(event, resp, time.Now()))
+	if err != nil {
+		log.Printf("Failed to marshal audit record: %v", err)
+		return
+	}
+
+	// Keep the audit write from eating into the authorizer's latency budget
+	auditCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if _, err := auditClient.PutItem(auditCtx, &dynamodb.PutItemInput{
+		TableName: aws.String(auditTableName),
+		Item:      item,
+	}); err != nil {
+		log.Printf("Failed to write audit record: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// fakeAudit records audit PutItem calls
+type fakeAudit struct {
+	records []AuditRecord
+	err     error
+}
+
+func (f *fakeAudit) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var record AuditRecord
+	if err := attributevalue.UnmarshalMap(params.Item, &record); err != nil {
+		return nil, err
+	}
+	f.records = append(f.records, record)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// useFakeAudit enables the audit log with a fake client for the duration of the test
+func useFakeAudit(t *testing.T, audit *fakeAudit) {
+	t.Helper()
+	origClient, origName := auditClient, auditTableName
+	auditClient = audit
+	auditTableName = "audit"
+	t.Cleanup(func() {
+		auditClient, auditTableName = origClient, origName
+	})
+}
+
+func auditTestEvent(headers map[string]string) events.APIGatewayCustomAuthorizerRequestTypeRequest {
+	event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		MethodArn: "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/invoke",
+		Headers:   headers,
+	}
+	event.RequestContext.RequestID = "req-123"
+	event.RequestContext.Identity.SourceIP = "203.0.113.7"
+	return event
+}
+
+func TestNewAuditRecord(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 30, 0, 0, time.UTC)
+	event := auditTestEvent(map[string]string{"user-agent": "Shortcuts/1.0"})
+
+	tests := []struct {
+		name          string
+		resp          events.APIGatewayCustomAuthorizerResponse
+		wantEffect    string
+		wantErrorType string
+		wantMethod    string
+	}{
+		{
+			name:       "allow",
+			resp:       generatePolicy("user-abc", "Allow", "arn", map[string]interface{}{"authenticated": "true"}),
+			wantEffect: "Allow",
+		},
+		{
+			name:          "deny",
+			resp:          generatePolicy("user", "Deny", "arn", map[string]interface{}{"errorType": ErrTokenMismatch}),
+			wantEffect:    "Deny",
+			wantErrorType: ErrTokenMismatch,
+		},
+		{
+			name:       "apple",
+			resp:       generatePolicy("apple-001", "Allow", "arn", map[string]interface{}{"authMethod": AuthModeApple}),
+			wantEffect: "Allow",
+			wantMethod: AuthModeApple,
+		},
+		{
+			name:       "no policy",
+			resp:       events.APIGatewayCustomAuthorizerResponse{PrincipalID: "user"},
+			wantEffect: "Deny",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := newAuditRecord(event, tt.resp, now)
+			if record.Effect != tt.wantEffect || record.ErrorType != tt.wantErrorType || record.AuthMethod != tt.wantMethod {
+				t.Errorf("Unexpected record: %+v", record)
+			}
+			if record.Day != "2025-01-15" || record.SK != "2025-01-15T09:30:00Z#req-123" {
+				t.Errorf("Unexpected keys: %s / %s", record.Day, record.SK)
+			}
+			if record.SourceIP != "203.0.113.7" || record.UserAgent != "Shortcuts/1.0" {
+				t.Errorf("Expected caller details, got %+v", record)
+			}
+			if record.ExpiresAt != now.Add(90*24*time.Hour).Unix() {
+				t.Errorf("Expected default 90-day retention, got %d", record.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestGetAuditRetention(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{env: "", want: 90 * 24 * time.Hour},
+		{env: "30", want: 30 * 24 * time.Hour},
+		{env: "-1", want: 90 * 24 * time.Hour},
+		{env: "forever", want: 90 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("AUDIT_RETENTION_DAYS", tt.env)
+		if got := getAuditRetention(); got != tt.want {
+			t.Errorf("getAuditRetention() with %q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestHandler_RecordsDecision(t *testing.T) {
+	audit := &fakeAudit{}
+	useFakeAudit(t, audit)
+
+	// A missing token is denied without touching SSM
+	resp, err := handler(context.Background(), auditTestEvent(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(audit.records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d", len(audit.records))
+	}
+	if audit.records[0].Effect != "Deny" || audit.records[0].ErrorType != ErrMissingToken {
+		t.Errorf("Unexpected audit record: %+v", audit.records[0])
+	}
+	if audit.records[0].Principal != resp.PrincipalID {
+		t.Errorf("Expected principal %s, got %s", resp.PrincipalID, audit.records[0].Principal)
+	}
+}
+
+func TestHandler_AuditFailureDoesNotChangeDecision(t *testing.T) {
+	useFakeAudit(t, &fakeAudit{err: errors.New("throttled")})
+
+	resp, err := handler(context.Background(), auditTestEvent(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Context["errorType"] != ErrMissingToken {
+		t.Errorf("Expected decision unchanged, got %+v", resp.Context)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Default port of the AWS Parameters and Secrets Lambda Extension
+const defaultExtensionPort = "2773"
+
+// extensionSSM reads parameters through the AWS Parameters and Secrets Lambda Extension's
+// local HTTP endpoint, which caches them across invocations and skips SDK cold-start cost.
+// Calls that fail against the extension fall back to the SDK client.
+type extensionSSM struct {
+	endpoint   string // e.g. http://localhost:2773
+	httpClient *http.Client
+	fallback   ssmAPI
+}
+
+// extensionParameterResponse is the part of the extension's GetParameter JSON we use
+type extensionParameterResponse struct {
+	Parameter struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"Parameter"`
+}
+
+// useParamsExtension reports whether USE_PARAMS_EXTENSION enables the extension
+func useParamsExtension() bool {
+	return strings.EqualFold(os.Getenv("USE_PARAMS_EXTENSION"), "true")
+}
+
+// newExtensionSSM returns an ssmAPI backed by the extension, falling back to fallback
+func newExtensionSSM(fallback ssmAPI) *extensionSSM {
+	port := os.Getenv("PARAMETERS_SECRETS_EXTENSION_HTTP_PORT")
+	if port == "" {
+		port = defaultExtensionPort
+	}
+	log.Printf("Reading SSM parameters via the Parameters and Secrets extension on port %s", port)
+	return &extensionSSM{
+		endpoint:   "http://localhost:" + port,
+		httpClient: &http.Client{},
+		fallback:   fallback,
+	}
+}
+
+// GetParameter implements ssmAPI against the extension
+func (e *extensionSSM) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	value, err := e.getParameter(ctx, aws.ToString(params.Name), aws.ToBool(params.WithDecryption))
+	if err == nil {
+		return &ssm.GetParameterOutput{
+			Parameter: &types.Parameter{Name: params.Name, Value: aws.String(value)},
+		}, nil
+	}
+	if e.fallback == nil {
+		return nil, err
+	}
+	log.Printf("Parameters extension failed, falling back to SSM API: %v", err)
+	return e.fallback.GetParameter(ctx, params, optFns...)
+}
+
+func (e *extensionSSM) getParameter(ctx context.Context, name string, withDecryption bool) (string, error) {
+	query := url.Values{"name": {name}}
+	if withDecryption {
+		query.Set("withDecryption", "true")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.endpoint+"/systemsmanager/parameters/get?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	// The extension authenticates callers with the function's session token
+	req.Header.Set("X-Aws-Parameters-Secrets-Token", os.Getenv("AWS_SESSION_TOKEN"))
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("parameters extension request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read parameters extension response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// SECURITY: The body is an error message, never a parameter value, on non-200
+		return "", fmt.Errorf("parameters extension returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed extensionParameterResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("failed to parse parameters extension response: %w", err)
+	}
+	return parsed.Parameter.Value, nil
+}
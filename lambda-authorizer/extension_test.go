@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestExtensionSSM_GetParameter(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		fallback      *fakeSSM
+		want          string
+		wantErr       bool
+		wantFallbacks int
+	}{
+		{
+			name:   "reads value from extension",
+			status: http.StatusOK,
+			body:   `{"Parameter":{"Name":"/wrist-agent/client-token","Type":"SecureString","Value":"from-extension","LastModifiedDate":"2025-01-01T00:00:00Z"}}`,
+			want:   "from-extension",
+		},
+		{
+			name:          "falls back to SDK on extension error",
+			status:        http.StatusBadRequest,
+			body:          "not ready",
+			fallback:      &fakeSSM{values: map[string]string{"/wrist-agent/client-token": "from-sdk"}},
+			want:          "from-sdk",
+			wantFallbacks: 1,
+		},
+		{
+			name:    "errors without fallback",
+			status:  http.StatusInternalServerError,
+			body:    "boom",
+			wantErr: true,
+		},
+		{
+			name:          "falls back on malformed response",
+			status:        http.StatusOK,
+			body:          "{",
+			fallback:      &fakeSSM{values: map[string]string{"/wrist-agent/client-token": "from-sdk"}},
+			want:          "from-sdk",
+			wantFallbacks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_SESSION_TOKEN", "session")
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/systemsmanager/parameters/get" {
+					t.Errorf("path = %s", r.URL.Path)
+				}
+				if got := r.URL.Query().Get("name"); got != "/wrist-agent/client-token" {
+					t.Errorf("name = %q", got)
+				}
+				if got := r.URL.Query().Get("withDecryption"); got != "true" {
+					t.Errorf("withDecryption = %q, want true", got)
+				}
+				if got := r.Header.Get("X-Aws-Parameters-Secrets-Token"); got != "session" {
+					t.Errorf("token header = %q, want session token", got)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := &extensionSSM{endpoint: server.URL, httpClient: server.Client()}
+			if tt.fallback != nil {
+				client.fallback = tt.fallback
+			}
+
+			output, err := client.GetParameter(context.Background(), &ssm.GetParameterInput{
+				Name:           aws.String("/wrist-agent/client-token"),
+				WithDecryption: aws.Bool(true),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetParameter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && aws.ToString(output.Parameter.Value) != tt.want {
+				t.Errorf("value = %q, want %q", aws.ToString(output.Parameter.Value), tt.want)
+			}
+			if tt.fallback != nil && tt.fallback.calls != tt.wantFallbacks {
+				t.Errorf("fallback calls = %d, want %d", tt.fallback.calls, tt.wantFallbacks)
+			}
+		})
+	}
+}
+
+func TestExtensionSSM_Unreachable(t *testing.T) {
+	fallback := &fakeSSM{err: errors.New("sdk down")}
+	client := &extensionSSM{endpoint: "http://127.0.0.1:1", httpClient: &http.Client{}, fallback: fallback}
+
+	_, err := client.GetParameter(context.Background(), &ssm.GetParameterInput{Name: aws.String("p")})
+	if err == nil || err.Error() != "sdk down" {
+		t.Errorf("GetParameter() error = %v, want fallback error", err)
+	}
+	if fallback.calls != 1 {
+		t.Errorf("fallback calls = %d, want 1", fallback.calls)
+	}
+}
+
+func TestUseParamsExtension(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "true": true, "TRUE": true, "false": false, "1": false} {
+		t.Setenv("USE_PARAMS_EXTENSION", value)
+		if got := useParamsExtension(); got != want {
+			t.Errorf("useParamsExtension() with %q = %v, want %v", value, got, want)
+		}
+	}
+}
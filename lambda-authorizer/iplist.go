@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// IPRules are the CIDR allow/deny lists checked against the caller's source IP
+type IPRules struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+// ipListsParam is the JSON shape of the IP_LISTS_PARAM_NAME parameter
+type ipListsParam struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// IPRulesCache holds the SSM-sourced rules with expiration
+type IPRulesCache struct {
+	rules      *IPRules
+	expiration time.Time
+	mu         sync.RWMutex
+}
+
+var ipRulesCache = &IPRulesCache{}
+
+// parseCIDRList parses comma- or space-separated CIDRs; bare IPs become single-host ranges
+func parseCIDRList(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		for _, field := range strings.FieldsFunc(entry, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if !strings.Contains(field, "/") {
+				ip := net.ParseIP(field)
+				if ip == nil {
+					return nil, fmt.Errorf("invalid IP %q", field)
+				}
+				bits := 128
+				if ip.To4() != nil {
+					bits = 32
+				}
+				field = fmt.Sprintf("%s/%d", field, bits)
+			}
+			_, ipNet, err := net.ParseCIDR(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", field)
+			}
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets, nil
+}
+
+// loadIPRules merges IP_ALLOWLIST / IP_DENYLIST with the JSON lists in the SSM parameter
+// named by IP_LISTS_PARAM_NAME ({"allow": [...], "deny": [...]})
+func loadIPRules(ctx context.Context) (*IPRules, error) {
+	allow, err := parseCIDRList([]string{os.Getenv("IP_ALLOWLIST")})
+	if err != nil {
+		return nil, fmt.Errorf("IP_ALLOWLIST: %w", err)
+	}
+	deny, err := parseCIDRList([]string{os.Getenv("IP_DENYLIST")})
+	if err != nil {
+		return nil, fmt.Errorf("IP_DENYLIST: %w", err)
+	}
+	rules := &IPRules{Allow: allow, Deny: deny}
+
+	if paramName := strings.TrimSpace(os.Getenv("IP_LISTS_PARAM_NAME")); paramName != "" {
+		ssmRules, err := getSSMIPRules(ctx, paramName)
+		if err != nil {
+			return nil, err
+		}
+		rules.Allow = append(rules.Allow, ssmRules.Allow...)
+		rules.Deny = append(rules.Deny, ssmRules.Deny...)
+	}
+	return rules, nil
+}
+
+// getSSMIPRules fetches and caches the SSM IP lists, returning stale rules if SSM fails
+func getSSMIPRules(ctx context.Context, paramName string) (*IPRules, error) {
+	now := time.Now()
+
+	ipRulesCache.mu.RLock()
+	cached, expiration := ipRulesCache.rules, ipRulesCache.expiration
+	ipRulesCache.mu.RUnlock()
+
+	if cached != nil && now.Before(expiration) {
+		return cached, nil
+	}
+
+	// Add timeout to prevent indefinite blocking on SSM call
+	ssmCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	output, err := ssmClient.GetParameter(ssmCtx, &ssm.GetParameterInput{
+		Name:           aws.String(paramName),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		if cached != nil {
+			log.Printf("SSM GetParameter failed for IP lists, using stale rules: %v", err)
+			return cached, nil
+		}
+		return nil, fmt.Errorf("failed to get SSM parameter %s: %w", paramName, err)
+	}
+
+	var param ipListsParam
+	if err := json.Unmarshal([]byte(aws.ToString(output.Parameter.Value)), &param); err != nil {
+		return nil, fmt.Errorf("invalid IP lists in %s: %w", paramName, err)
+	}
+	allow, err := parseCIDRList(param.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow list in %s: %w", paramName, err)
+	}
+	deny, err := parseCIDRList(param.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list in %s: %w", paramName, err)
+	}
+
+	rules := &IPRules{Allow: allow, Deny: deny}
+	ipRulesCache.mu.Lock()
+	ipRulesCache.rules = rules
+	ipRulesCache.expiration = now.Add(cacheDuration)
+	ipRulesCache.mu.Unlock()
+	return rules, nil
+}
+
+// permits reports whether sourceIP may call the API: deny entries always win, and a
+// non-empty allow list must contain the IP
+func (r *IPRules) permits(sourceIP string) bool {
+	if len(r.Allow) == 0 && len(r.Deny) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(sourceIP))
+	if ip == nil {
+		// Without a parseable IP only an empty allow list can pass
+		return len(r.Allow) == 0
+	}
+
+	for _, ipNet := range r.Deny {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, ipNet := range r.Allow {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSSM serves parameter values from memory
+type fakeSSM struct {
+	values map[string]string
+	err    error
+	calls  int
+}
+
+func (f *fakeSSM) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	value, ok := f.values[aws.ToString(params.Name)]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(value)}}, nil
+}
+
+// useFakeSSM swaps in a fake SSM client and clears the IP rules cache
+func useFakeSSM(t *testing.T, fake *fakeSSM) {
+	t.Helper()
+	origClient := ssmClient
+	ssmClient = fake
+	ipRulesCache = &IPRulesCache{}
+	t.Cleanup(func() {
+		ssmClient = origClient
+		ipRulesCache = &IPRulesCache{}
+	})
+}
+
+func TestParseCIDRList(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    int
+		wantErr bool
+	}{
+		{name: "empty", entries: []string{""}, want: 0},
+		{name: "cidrs", entries: []string{"10.0.0.0/8, 192.168.1.0/24"}, want: 2},
+		{name: "bare ipv4", entries: []string{"203.0.113.7"}, want: 1},
+		{name: "bare ipv6", entries: []string{"2001:db8::1"}, want: 1},
+		{name: "multiple entries", entries: []string{"10.0.0.0/8", "172.16.0.0/12"}, want: 2},
+		{name: "invalid ip", entries: []string{"not-an-ip"}, wantErr: true},
+		{name: "invalid cidr", entries: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCIDRList(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCIDRList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("Expected %d networks, got %d", tt.want, len(got))
+			}
+		})
+	}
+}
+
+func TestIPRulesPermits(t *testing.T) {
+	mustParse := func(entries ...string) *IPRules {
+		nets, err := parseCIDRList(entries)
+		if err != nil {
+			t.Fatalf("parseCIDRList() error = %v", err)
+		}
+		return &IPRules{Allow: nets}
+	}
+	allowHome := mustParse("198.51.100.0/24", "2001:db8::/32")
+	denyOne := &IPRules{Deny: mustParse("203.0.113.7").Allow}
+	both := &IPRules{Allow: mustParse("198.51.100.0/24").Allow, Deny: mustParse("198.51.100.66").Allow}
+
+	tests := []struct {
+		name  string
+		rules *IPRules
+		ip    string
+		want  bool
+	}{
+		{name: "no rules", rules: &IPRules{}, ip: "203.0.113.7", want: true},
+		{name: "no rules, no ip", rules: &IPRules{}, ip: "", want: true},
+		{name: "allowlisted", rules: allowHome, ip: "198.51.100.20", want: true},
+		{name: "allowlisted ipv6", rules: allowHome, ip: "2001:db8::42", want: true},
+		{name: "not allowlisted", rules: allowHome, ip: "203.0.113.7", want: false},
+		{name: "allowlist without ip", rules: allowHome, ip: "", want: false},
+		{name: "denylisted", rules: denyOne, ip: "203.0.113.7", want: false},
+		{name: "not denylisted", rules: denyOne, ip: "203.0.113.8", want: true},
+		{name: "deny wins over allow", rules: both, ip: "198.51.100.66", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.permits(tt.ip); got != tt.want {
+				t.Errorf("permits(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIPRules_SSM(t *testing.T) {
+	fake := &fakeSSM{values: map[string]string{
+		"/wrist-agent/ip-lists": `{"allow":["198.51.100.0/24"],"deny":["198.51.100.66"]}`,
+	}}
+	useFakeSSM(t, fake)
+	t.Setenv("IP_ALLOWLIST", "10.0.0.0/8")
+	t.Setenv("IP_LISTS_PARAM_NAME", "/wrist-agent/ip-lists")
+
+	origDuration := cacheDuration
+	cacheDuration = time.Minute
+	defer func() { cacheDuration = origDuration }()
+
+	rules, err := loadIPRules(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules.Allow) != 2 || len(rules.Deny) != 1 {
+		t.Errorf("Expected env and SSM lists merged, got %+v", rules)
+	}
+
+	// Cached rules survive an SSM outage
+	fake.err = errors.New("unavailable")
+	ipRulesCache.mu.Lock()
+	ipRulesCache.expiration = time.Now().Add(-time.Second)
+	ipRulesCache.mu.Unlock()
+	if _, err := loadIPRules(context.Background()); err != nil {
+		t.Errorf("Expected stale rules on SSM failure, got %v", err)
+	}
+}
+
+func TestLoadIPRules_Errors(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/bad": `{"allow":["nope"]}`}})
+
+	t.Setenv("IP_ALLOWLIST", "garbage")
+	if _, err := loadIPRules(context.Background()); err == nil {
+		t.Error("Expected invalid IP_ALLOWLIST to fail")
+	}
+
+	t.Setenv("IP_ALLOWLIST", "")
+	t.Setenv("IP_LISTS_PARAM_NAME", "/bad")
+	if _, err := loadIPRules(context.Background()); err == nil {
+		t.Error("Expected invalid SSM list to fail")
+	}
+
+	t.Setenv("IP_LISTS_PARAM_NAME", "/missing")
+	if _, err := loadIPRules(context.Background()); err == nil {
+		t.Error("Expected missing parameter without cache to fail")
+	}
+}
+
+func TestHandler_IPNotAllowed(t *testing.T) {
+	t.Setenv("IP_ALLOWLIST", "198.51.100.0/24")
+
+	event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		MethodArn: "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/invoke",
+		Headers:   map[string]string{"X-Client-Token": "any-token"},
+	}
+	event.RequestContext.Identity.SourceIP = "203.0.113.7"
+
+	resp, err := handler(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.PolicyDocument.Statement[0].Effect != "Deny" || resp.Context["errorType"] != ErrIPNotAllowed {
+		t.Errorf("Expected Deny with ip_not_allowed, got %+v", resp)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -16,27 +17,44 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 // Authorization error types for debugging (returned in policy context)
 // These help identify the reason for authorization failures without leaking sensitive data
 const (
-	ErrMissingToken  = "missing_token"
-	ErrInvalidToken  = "invalid_token"
-	ErrTokenMismatch = "token_mismatch"
-	ErrSSMFailure    = "ssm_failure"
+	ErrMissingToken    = "missing_token"
+	ErrInvalidToken    = "invalid_token"
+	ErrTokenMismatch   = "token_mismatch"
+	ErrSSMFailure      = "ssm_failure"
+	ErrJWKSFailure     = "jwks_failure"
+	ErrRegistryFailure = "registry_failure"
+	ErrIPNotAllowed    = "ip_not_allowed"
+)
+
+// Authentication modes (AUTH_MODE env var)
+const (
+	AuthModeToken = "token" // shared static token from SSM (default)
+	AuthModeApple = "apple" // Sign in with Apple identity tokens only
+	AuthModeBoth  = "both"  // Apple identity tokens, falling back to the static token
 )
 
 // Default cache duration in seconds (can be overridden by TOKEN_CACHE_TTL_SECONDS env var)
 const defaultCacheDurationSeconds = 300 // 5 minutes
 
-// Circuit breaker configuration
+// Circuit breaker defaults (overridable via CIRCUIT_BREAKER_* env vars)
 const (
-	circuitBreakerThreshold = 3                // Number of failures before opening circuit
-	circuitBreakerTimeout   = 30 * time.Second // How long to wait before trying again
+	circuitBreakerThreshold      = 3                // Number of failures before opening circuit
+	circuitBreakerTimeout        = 30 * time.Second // How long to wait before trying again
+	circuitBreakerHalfOpenProbes = 1                // Calls let through while half-open
 )
 
+// ssmAPI is the subset of the SSM client used by the authorizer
+type ssmAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
 // TokenCache holds cached token with expiration
 type TokenCache struct {
 	token      string
@@ -45,19 +63,32 @@ type TokenCache struct {
 }
 
 // CircuitBreaker tracks SSM failures to prevent cascading failures
+// States: closed (failures < threshold), open (until timeout after the last failure),
+// and half-open (up to maxProbes calls allowed through to test recovery)
 type CircuitBreaker struct {
-	failures    int
-	lastFailure time.Time
-	mu          sync.RWMutex
+	failures     int
+	lastFailure  time.Time
+	probes       int // probe calls handed out in the current half-open period
+	probeStarted time.Time
+	threshold    int
+	timeout      time.Duration
+	maxProbes    int
+	mu           sync.RWMutex
 }
 
 var (
-	ssmClient      *ssm.Client
+	ssmClient      ssmAPI
 	tokenParamName string
 	region         string
 	tokenCache     = &TokenCache{}
 	circuitBreaker = &CircuitBreaker{}
 	cacheDuration  time.Duration
+	authMode       string
+
+	// Optional replica of the token parameter in another region
+	failoverSSMClient ssmAPI
+	failoverRegion    string
+	failoverParamName string
 )
 
 // getCacheDuration reads cache TTL from environment or returns default
@@ -72,9 +103,16 @@ func getCacheDuration() time.Duration {
 }
 
 func init() {
+	// SECURITY: Scrub anything that looks like a credential from every log line
+	log.SetOutput(&redactingWriter{out: os.Stderr})
+
 	region = getEnv("AWS_REGION", "us-west-2")
 	tokenParamName = strings.TrimSpace(getEnv("CLIENT_TOKEN_PARAM_NAME", "/wrist-agent/client-token"))
 	cacheDuration = getCacheDuration()
+	circuitBreaker = newCircuitBreaker()
+	authMode = getAuthMode()
+	tokenRegistryName = strings.TrimSpace(os.Getenv("TOKEN_TABLE_NAME"))
+	auditTableName = strings.TrimSpace(os.Getenv("AUDIT_TABLE_NAME"))
 
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
 	if err != nil {
@@ -82,12 +120,64 @@ func init() {
 	}
 
 	ssmClient = ssm.NewFromConfig(cfg)
-	log.Printf("Lambda Authorizer initialized - Region: %s, TokenParam: %s, CacheTTL: %v", region, tokenParamName, cacheDuration)
+	if useParamsExtension() {
+		ssmClient = newExtensionSSM(ssmClient)
+	}
+
+	failoverRegion = strings.TrimSpace(os.Getenv("SSM_FAILOVER_REGION"))
+	if failoverRegion != "" && failoverRegion != region {
+		failoverParamName = strings.TrimSpace(getEnv("SSM_FAILOVER_PARAM_NAME", tokenParamName))
+		failoverSSMClient = ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+			o.Region = failoverRegion
+		})
+	}
+
+	ddbClient := dynamodb.NewFromConfig(cfg)
+	registryClient = ddbClient
+	auditClient = ddbClient
+	log.Printf("Lambda Authorizer initialized - Region: %s, FailoverRegion: %s, AuthMode: %s, TokenParam: %s, TokenTable: %s, CacheTTL: %v", region, failoverRegion, authMode, tokenParamName, tokenRegistryName, cacheDuration)
+}
+
+// getAuthMode reads AUTH_MODE from environment or returns the static token mode
+func getAuthMode() string {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_MODE")))
+	switch mode {
+	case "":
+		return AuthModeToken
+	case AuthModeToken, AuthModeApple, AuthModeBoth:
+		return mode
+	default:
+		log.Printf("Invalid AUTH_MODE value: %s, using default", mode)
+		return AuthModeToken
+	}
 }
 
 func handler(ctx context.Context, event events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	resp, err := authorize(ctx, event)
+	recordAuthDecision(ctx, event, resp)
+	return resp, err
+}
+
+// authorize decides whether the request may proceed and returns the resulting policy
+func authorize(ctx context.Context, event events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
 	log.Printf("Authorizer invoked for method: %s", event.MethodArn)
 
+	// Reject callers outside the configured networks before looking at credentials
+	ipRules, err := loadIPRules(ctx)
+	if err != nil {
+		// Fail closed: an allowlist that can't be read must not let everyone in
+		log.Printf("Authorization error: failed to load IP rules: %v", err)
+		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
+			"errorType": ErrSSMFailure,
+		}), nil
+	}
+	if !ipRules.permits(event.RequestContext.Identity.SourceIP) {
+		log.Printf("Authorization denied: source IP %s not allowed", event.RequestContext.Identity.SourceIP)
+		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
+			"errorType": ErrIPNotAllowed,
+		}), nil
+	}
+
 	// Extract token from header
 	token := extractToken(event)
 	if token == "" {
@@ -97,18 +187,35 @@ func handler(ctx context.Context, event events.APIGatewayCustomAuthorizerRequest
 		}), nil
 	}
 
+	// Apple identity tokens are JWTs; static tokens never contain two dots
+	if authMode != AuthModeToken && looksLikeJWT(token) {
+		return authorizeAppleToken(ctx, token, event.MethodArn), nil
+	}
+	if authMode == AuthModeApple {
+		log.Printf("Authorization denied: expected Apple identity token")
+		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
+			"errorType": ErrInvalidToken,
+		}), nil
+	}
+
 	// Get expected token from SSM (with caching)
 	expectedToken, err := getExpectedToken(ctx)
 	if err != nil {
 		log.Printf("Authorization error: failed to retrieve expected token: %v", err)
-		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
-			"errorType": ErrSSMFailure,
-		}), nil
 	}
 
 	// Validate token
 	// SECURITY: Never log actual token values - only metadata about the validation result
-	if token != expectedToken {
+	if err != nil || token != expectedToken {
+		// Not the unrestricted static token - try the scoped token registry
+		if tokenRegistryName != "" {
+			return authorizeRegisteredToken(ctx, token, event.MethodArn), nil
+		}
+		if err != nil {
+			return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
+				"errorType": ErrSSMFailure,
+			}), nil
+		}
 		log.Printf("Authorization denied: token mismatch")
 		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
 			"errorType": ErrTokenMismatch,
@@ -118,11 +225,80 @@ func handler(ctx context.Context, event events.APIGatewayCustomAuthorizerRequest
 	// Use hashed token as principal ID for audit trail
 	principalID := hashToken(token)
 	log.Printf("Authorization granted for principal: %s", principalID)
-	return generatePolicy(principalID, "Allow", event.MethodArn, map[string]interface{}{
+	return generatePolicy(principalID, "Allow", stageResource(event.MethodArn), map[string]interface{}{
 		"authenticated": "true",
+		"role":          "admin", // the SSM token is the unrestricted owner credential
 	}), nil
 }
 
+// authorizeAppleToken validates a Sign in with Apple identity token and maps its
+// subject to the principal ID
+func authorizeAppleToken(ctx context.Context, token, methodArn string) events.APIGatewayCustomAuthorizerResponse {
+	sub, err := verifyAppleToken(ctx, token, time.Now())
+	if err != nil {
+		errorType := ErrInvalidToken
+		var fetchErr *jwksError
+		if errors.As(err, &fetchErr) {
+			errorType = ErrJWKSFailure
+		}
+		log.Printf("Authorization denied: Apple identity token rejected: %v", err)
+		return generatePolicy("user", "Deny", methodArn, map[string]interface{}{
+			"errorType": errorType,
+		})
+	}
+
+	principalID := applePrincipal(sub)
+	log.Printf("Authorization granted for principal: %s", principalID)
+	return generatePolicy(principalID, "Allow", stageResource(methodArn), map[string]interface{}{
+		"authenticated": "true",
+		"authMethod":    AuthModeApple,
+	})
+}
+
+// authorizeRegisteredToken validates a token against the scoped token registry and passes
+// its scopes, tenant and device profile to the handler in the policy context
+func authorizeRegisteredToken(ctx context.Context, token, methodArn string) events.APIGatewayCustomAuthorizerResponse {
+	registered, err := lookupRegisteredToken(ctx, token, time.Now())
+	if err != nil {
+		log.Printf("Authorization error: %v", err)
+		return generatePolicy("user", "Deny", methodArn, map[string]interface{}{
+			"errorType": ErrRegistryFailure,
+		})
+	}
+	if registered == nil {
+		log.Printf("Authorization denied: token mismatch")
+		return generatePolicy("user", "Deny", methodArn, map[string]interface{}{
+			"errorType": ErrTokenMismatch,
+		})
+	}
+
+	principalID := hashToken(token)
+	log.Printf("Authorization granted for principal: %s (registered token %q)", principalID, registered.Name)
+	policyContext := map[string]interface{}{
+		"authenticated": "true",
+		"tokenName":     registered.Name,
+		"scopes":        scopesContext(registered.Scopes),
+	}
+	if registered.Tenant != "" {
+		policyContext["tenantId"] = registered.Tenant
+	}
+	if profile := profileContext(registered.Profile); profile != "" {
+		policyContext["deviceProfile"] = profile
+	}
+	return generatePolicy(principalID, "Allow", stageResource(methodArn), policyContext)
+}
+
+// stageResource widens a method ARN to every method in its stage, so a cached Allow for
+// one route (API Gateway caches by token) also covers the others. Route-level access is
+// enforced by the handler using the policy context.
+func stageResource(methodArn string) string {
+	parts := strings.SplitN(methodArn, "/", 3)
+	if len(parts) < 3 {
+		return methodArn
+	}
+	return parts[0] + "/" + parts[1] + "/*"
+}
+
 // extractToken gets the token from request headers
 func extractToken(event events.APIGatewayCustomAuthorizerRequestTypeRequest) string {
 	// Check X-Client-Token header (case-insensitive)
@@ -156,13 +332,50 @@ func hashToken(token string) string {
 	return "user-" + hex.EncodeToString(hash[:8]) // Use first 8 bytes (16 hex chars) for readability
 }
 
+// newCircuitBreaker builds a circuit breaker from CIRCUIT_BREAKER_THRESHOLD,
+// CIRCUIT_BREAKER_TIMEOUT_SECONDS and CIRCUIT_BREAKER_HALF_OPEN_PROBES, using defaults for
+// unset or invalid values
+func newCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: getEnvInt("CIRCUIT_BREAKER_THRESHOLD", circuitBreakerThreshold),
+		timeout:   time.Duration(getEnvInt("CIRCUIT_BREAKER_TIMEOUT_SECONDS", int(circuitBreakerTimeout/time.Second))) * time.Second,
+		maxProbes: getEnvInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", circuitBreakerHalfOpenProbes),
+	}
+}
+
+// failureThreshold returns the configured threshold (zero value = default)
+func (cb *CircuitBreaker) failureThreshold() int {
+	if cb.threshold > 0 {
+		return cb.threshold
+	}
+	return circuitBreakerThreshold
+}
+
+// openTimeout returns the configured open duration (zero value = default)
+func (cb *CircuitBreaker) openTimeout() time.Duration {
+	if cb.timeout > 0 {
+		return cb.timeout
+	}
+	return circuitBreakerTimeout
+}
+
+// halfOpenProbes returns the configured probe allowance (zero value = default)
+func (cb *CircuitBreaker) halfOpenProbes() int {
+	if cb.maxProbes > 0 {
+		return cb.maxProbes
+	}
+	return circuitBreakerHalfOpenProbes
+}
+
 // isOpen checks if the circuit breaker is open
-// After timeout expires, the circuit transitions to "half-open" state where the next
-// SSM call will be attempted. If it succeeds, reset() is called. If it fails, failures
-// are incremented and circuit re-opens.
+// After timeout expires, the circuit transitions to "half-open" state where a limited
+// number of probe SSM calls are let through while everyone else keeps seeing an open
+// circuit. A successful probe calls reset() and closes the circuit; a failed probe calls
+// recordFailure(), which re-opens it for another timeout. Probe slots that never report
+// back are reclaimed after one timeout so the circuit can't wedge half-open.
 func (cb *CircuitBreaker) isOpen() bool {
 	cb.mu.RLock()
-	if cb.failures < circuitBreakerThreshold {
+	if cb.failures < cb.failureThreshold() {
 		cb.mu.RUnlock()
 		return false
 	}
@@ -172,20 +385,35 @@ func (cb *CircuitBreaker) isOpen() bool {
 	cb.mu.RUnlock()
 
 	timeSinceFailure := time.Since(lastFailureTime)
-	if timeSinceFailure < circuitBreakerTimeout {
+	if timeSinceFailure < cb.openTimeout() {
 		return true
 	}
 
-	// Timeout passed - upgrade to write lock and reset
+	// Timeout passed - upgrade to write lock to hand out a probe slot
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
 	// Double-check after acquiring write lock to avoid race condition
-	// Recalculate time to ensure timeout truly passed (guards against concurrent updates)
-	if cb.failures >= circuitBreakerThreshold && time.Since(cb.lastFailure) >= circuitBreakerTimeout {
-		cb.failures = 0
-		log.Printf("Circuit breaker RESET after timeout")
+	// (a concurrent reset or failure may have changed the state)
+	now := time.Now()
+	if cb.failures < cb.failureThreshold() {
+		return false
+	}
+	if now.Sub(cb.lastFailure) < cb.openTimeout() {
+		return true
+	}
+
+	if cb.probes > 0 && now.Sub(cb.probeStarted) >= cb.openTimeout() {
+		cb.probes = 0
+	}
+	if cb.probes >= cb.halfOpenProbes() {
+		return true
 	}
+	if cb.probes == 0 {
+		cb.probeStarted = now
+		log.Printf("Circuit breaker HALF-OPEN after timeout, allowing %d probe(s)", cb.halfOpenProbes())
+	}
+	cb.probes++
 	return false
 }
 
@@ -194,12 +422,16 @@ func (cb *CircuitBreaker) recordFailure() {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	wasOpen := cb.failures >= circuitBreakerThreshold
+	wasOpen := cb.failures >= cb.failureThreshold()
+	halfOpen := cb.probes > 0
 	cb.failures++
 	cb.lastFailure = time.Now()
+	cb.probes = 0
 
-	// Log when circuit opens
-	if !wasOpen && cb.failures >= circuitBreakerThreshold {
+	// Log when circuit opens (or a half-open probe fails)
+	if halfOpen {
+		log.Printf("Circuit breaker RE-OPENED after failed probe (%d failures)", cb.failures)
+	} else if !wasOpen && cb.failures >= cb.failureThreshold() {
 		log.Printf("Circuit breaker OPENED after %d failures", cb.failures)
 	}
 }
@@ -211,22 +443,34 @@ func (cb *CircuitBreaker) getFailures() int {
 	return cb.failures
 }
 
-// reset resets the circuit breaker
+// reset closes the circuit breaker after a successful call
 func (cb *CircuitBreaker) reset() {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
 	if cb.failures > 0 {
-		log.Printf("Circuit breaker CLOSED (manual reset from %d failures)", cb.failures)
+		log.Printf("Circuit breaker CLOSED (reset from %d failures)", cb.failures)
 	}
 	cb.failures = 0
+	cb.probes = 0
+}
+
+// getEnvInt reads a positive integer from environment or returns the default
+func getEnvInt(key string, defaultValue int) int {
+	if env := os.Getenv(key); env != "" {
+		if value, err := strconv.Atoi(env); err == nil && value > 0 {
+			return value
+		}
+		log.Printf("Invalid %s value: %s, using default", key, env)
+	}
+	return defaultValue
 }
 
 // getExpectedToken retrieves and caches the expected token from SSM
 func getExpectedToken(ctx context.Context) (string, error) {
 	// Capture current time once for consistency across checks
 	now := time.Now()
-	
+
 	// Read token and expiration atomically to avoid race condition
 	tokenCache.mu.RLock()
 	token := tokenCache.token
@@ -261,14 +505,7 @@ func getExpectedToken(ctx context.Context) (string, error) {
 		return tokenCache.token, nil
 	}
 
-	// Add timeout to prevent indefinite blocking on SSM call
-	ssmCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
-
-	output, err := ssmClient.GetParameter(ssmCtx, &ssm.GetParameterInput{
-		Name:           aws.String(tokenParamName),
-		WithDecryption: aws.Bool(true),
-	})
+	output, err := fetchTokenParameter(ctx)
 	if err != nil {
 		circuitBreaker.recordFailure()
 		failureCount := circuitBreaker.getFailures()
@@ -290,7 +527,6 @@ func getExpectedToken(ctx context.Context) (string, error) {
 	if token == "" {
 		return "", fmt.Errorf("SSM parameter %s returned empty value", tokenParamName)
 	}
-	
 
 	tokenCache.token = token
 	tokenCache.expiration = time.Now().Add(cacheDuration)
@@ -299,6 +535,35 @@ func getExpectedToken(ctx context.Context) (string, error) {
 	return token, nil
 }
 
+// fetchTokenParameter reads the token from SSM in the primary region, falling back to the
+// replica in SSM_FAILOVER_REGION so a regional SSM outage doesn't open the circuit breaker
+func fetchTokenParameter(ctx context.Context) (*ssm.GetParameterOutput, error) {
+	output, err := getTokenParameter(ctx, ssmClient, tokenParamName)
+	if err == nil || failoverSSMClient == nil {
+		return output, err
+	}
+
+	log.Printf("SSM GetParameter failed in %s, trying failover region %s: %v", region, failoverRegion, err)
+	output, failoverErr := getTokenParameter(ctx, failoverSSMClient, failoverParamName)
+	if failoverErr != nil {
+		log.Printf("SSM GetParameter failed in failover region %s: %v", failoverRegion, failoverErr)
+		return nil, err
+	}
+	return output, nil
+}
+
+// getTokenParameter fetches a (possibly SecureString) parameter with a bounded timeout
+func getTokenParameter(ctx context.Context, client ssmAPI, name string) (*ssm.GetParameterOutput, error) {
+	// Add timeout to prevent indefinite blocking on SSM call
+	ssmCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return client.GetParameter(ssmCtx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+}
+
 // generatePolicy creates an IAM policy document for API Gateway
 func generatePolicy(principalID, effect, resource string, context map[string]interface{}) events.APIGatewayCustomAuthorizerResponse {
 	authResponse := events.APIGatewayCustomAuthorizerResponse{
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"sync"
 	"testing"
@@ -519,9 +520,9 @@ func TestCircuitBreaker_Timeout(t *testing.T) {
 	cb.lastFailure = time.Now().Add(-circuitBreakerTimeout - time.Second)
 	cb.mu.Unlock()
 
-	// Circuit should now be considered closed (timeout passed)
+	// Timeout passed - the circuit goes half-open and lets a probe through
 	if cb.isOpen() {
-		t.Error("Circuit should be closed after timeout")
+		t.Error("Circuit should allow a probe after timeout")
 	}
 }
 
@@ -648,17 +649,152 @@ func TestCircuitBreaker_AutoResetRaceCondition(t *testing.T) {
 	wg.Wait()
 	close(results)
 	
-	// All should see circuit as closed (false)
+	// Exactly one goroutine gets the half-open probe; everyone else still sees it open
+	closed := 0
 	for isOpen := range results {
-		if isOpen {
-			t.Error("Circuit should be closed after timeout for all goroutines")
+		if !isOpen {
+			closed++
 		}
 	}
-	
-	// Verify failures were actually reset to 0
+	if closed != circuitBreakerHalfOpenProbes {
+		t.Errorf("Expected %d probe(s) through the half-open circuit, got %d", circuitBreakerHalfOpenProbes, closed)
+	}
+
+	// Half-open must not forget the failures until a probe succeeds
 	failCount := cb.getFailures()
-	if failCount != 0 {
-		t.Errorf("Expected failures to be reset to 0, got %d", failCount)
+	if failCount != circuitBreakerThreshold {
+		t.Errorf("Expected failures to stay at %d while half-open, got %d", circuitBreakerThreshold, failCount)
+	}
+}
+
+// openedBreaker returns cb with the circuit opened and its timeout already elapsed
+func openedBreaker(t *testing.T, cb *CircuitBreaker) *CircuitBreaker {
+	t.Helper()
+	for i := 0; i < cb.failureThreshold(); i++ {
+		cb.recordFailure()
+	}
+	if !cb.isOpen() {
+		t.Fatal("Circuit should be open")
+	}
+	cb.mu.Lock()
+	cb.lastFailure = time.Now().Add(-cb.openTimeout() - time.Second)
+	cb.mu.Unlock()
+	return cb
+}
+
+// Test half-open probe limits and transitions
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	t.Run("limits probes", func(t *testing.T) {
+		cb := openedBreaker(t, &CircuitBreaker{maxProbes: 2})
+		got := []bool{cb.isOpen(), cb.isOpen(), cb.isOpen()}
+		want := []bool{false, false, true}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("isOpen() call %d = %v, want %v", i+1, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("failed probe re-opens", func(t *testing.T) {
+		cb := openedBreaker(t, &CircuitBreaker{})
+		if cb.isOpen() {
+			t.Fatal("Probe should be allowed")
+		}
+		cb.recordFailure()
+		if !cb.isOpen() {
+			t.Error("Circuit should re-open after a failed probe")
+		}
+		if cb.probes != 0 {
+			t.Errorf("Expected probes to be cleared, got %d", cb.probes)
+		}
+	})
+
+	t.Run("successful probe closes", func(t *testing.T) {
+		cb := openedBreaker(t, &CircuitBreaker{})
+		if cb.isOpen() {
+			t.Fatal("Probe should be allowed")
+		}
+		cb.reset()
+		for i := 0; i < 3; i++ {
+			if cb.isOpen() {
+				t.Error("Circuit should be closed after a successful probe")
+			}
+		}
+	})
+
+	t.Run("abandoned probe slot expires", func(t *testing.T) {
+		cb := openedBreaker(t, &CircuitBreaker{})
+		if cb.isOpen() {
+			t.Fatal("Probe should be allowed")
+		}
+		if !cb.isOpen() {
+			t.Fatal("Second caller should wait for the probe")
+		}
+		cb.mu.Lock()
+		cb.probeStarted = time.Now().Add(-cb.openTimeout() - time.Second)
+		cb.mu.Unlock()
+		if cb.isOpen() {
+			t.Error("Abandoned probe slot should be reclaimed")
+		}
+	})
+}
+
+// Test circuit breaker configuration from environment
+func TestNewCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantThreshold int
+		wantTimeout   time.Duration
+		wantProbes    int
+	}{
+		{
+			name:          "defaults",
+			env:           map[string]string{},
+			wantThreshold: circuitBreakerThreshold,
+			wantTimeout:   circuitBreakerTimeout,
+			wantProbes:    circuitBreakerHalfOpenProbes,
+		},
+		{
+			name: "custom values",
+			env: map[string]string{
+				"CIRCUIT_BREAKER_THRESHOLD":        "5",
+				"CIRCUIT_BREAKER_TIMEOUT_SECONDS":  "120",
+				"CIRCUIT_BREAKER_HALF_OPEN_PROBES": "3",
+			},
+			wantThreshold: 5,
+			wantTimeout:   2 * time.Minute,
+			wantProbes:    3,
+		},
+		{
+			name: "invalid values fall back to defaults",
+			env: map[string]string{
+				"CIRCUIT_BREAKER_THRESHOLD":        "0",
+				"CIRCUIT_BREAKER_TIMEOUT_SECONDS":  "soon",
+				"CIRCUIT_BREAKER_HALF_OPEN_PROBES": "-1",
+			},
+			wantThreshold: circuitBreakerThreshold,
+			wantTimeout:   circuitBreakerTimeout,
+			wantProbes:    circuitBreakerHalfOpenProbes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"CIRCUIT_BREAKER_THRESHOLD", "CIRCUIT_BREAKER_TIMEOUT_SECONDS", "CIRCUIT_BREAKER_HALF_OPEN_PROBES"} {
+				t.Setenv(key, tt.env[key])
+			}
+			cb := newCircuitBreaker()
+			if got := cb.failureThreshold(); got != tt.wantThreshold {
+				t.Errorf("failureThreshold() = %d, want %d", got, tt.wantThreshold)
+			}
+			if got := cb.openTimeout(); got != tt.wantTimeout {
+				t.Errorf("openTimeout() = %v, want %v", got, tt.wantTimeout)
+			}
+			if got := cb.halfOpenProbes(); got != tt.wantProbes {
+				t.Errorf("halfOpenProbes() = %d, want %d", got, tt.wantProbes)
+			}
+		})
 	}
 }
 
@@ -725,3 +861,105 @@ func TestSSMEmptyTokenValidation(t *testing.T) {
 }
 
 
+
+func TestStageResource(t *testing.T) {
+	tests := []struct {
+		methodArn string
+		want      string
+	}{
+		{
+			methodArn: "arn:aws:execute-api:us-west-2:123456789012:abc123/prod/POST/invoke",
+			want:      "arn:aws:execute-api:us-west-2:123456789012:abc123/prod/*",
+		},
+		{
+			methodArn: "arn:aws:execute-api:us-west-2:123456789012:abc123/prod/GET/admin/tokens",
+			want:      "arn:aws:execute-api:us-west-2:123456789012:abc123/prod/*",
+		},
+		{methodArn: "arn", want: "arn"},
+	}
+
+	for _, tt := range tests {
+		if got := stageResource(tt.methodArn); got != tt.want {
+			t.Errorf("stageResource(%q) = %q, want %q", tt.methodArn, got, tt.want)
+		}
+	}
+}
+
+// useTokenSSM installs primary and failover SSM fakes with an empty token cache
+func useTokenSSM(t *testing.T, primary, failover *fakeSSM) {
+	t.Helper()
+	origPrimary, origFailover := ssmClient, failoverSSMClient
+	origParam, origFailoverParam, origFailoverRegion := tokenParamName, failoverParamName, failoverRegion
+	origCache, origBreaker := tokenCache, circuitBreaker
+
+	ssmClient = primary
+	failoverSSMClient = nil
+	if failover != nil {
+		failoverSSMClient = failover
+	}
+	tokenParamName = "/wrist-agent/client-token"
+	failoverParamName = "/wrist-agent/client-token"
+	failoverRegion = "us-east-1"
+	tokenCache = &TokenCache{}
+	circuitBreaker = &CircuitBreaker{}
+
+	t.Cleanup(func() {
+		ssmClient, failoverSSMClient = origPrimary, origFailover
+		tokenParamName, failoverParamName, failoverRegion = origParam, origFailoverParam, origFailoverRegion
+		tokenCache, circuitBreaker = origCache, origBreaker
+	})
+}
+
+func TestGetExpectedToken_RegionalFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		primary      *fakeSSM
+		failover     *fakeSSM
+		wantToken    string
+		wantErr      bool
+		wantFailures int
+	}{
+		{
+			name:      "primary healthy",
+			primary:   &fakeSSM{values: map[string]string{"/wrist-agent/client-token": "primary-token"}},
+			failover:  &fakeSSM{values: map[string]string{"/wrist-agent/client-token": "replica-token"}},
+			wantToken: "primary-token",
+		},
+		{
+			name:      "primary down, replica healthy",
+			primary:   &fakeSSM{err: errors.New("service unavailable")},
+			failover:  &fakeSSM{values: map[string]string{"/wrist-agent/client-token": "replica-token"}},
+			wantToken: "replica-token",
+		},
+		{
+			name:         "both regions down",
+			primary:      &fakeSSM{err: errors.New("service unavailable")},
+			failover:     &fakeSSM{err: errors.New("service unavailable")},
+			wantErr:      true,
+			wantFailures: 1,
+		},
+		{
+			name:         "no failover configured",
+			primary:      &fakeSSM{err: errors.New("service unavailable")},
+			wantErr:      true,
+			wantFailures: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTokenSSM(t, tt.primary, tt.failover)
+
+			token, err := getExpectedToken(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getExpectedToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if token != tt.wantToken {
+				t.Errorf("Expected token %q, got %q", tt.wantToken, token)
+			}
+			if got := circuitBreaker.getFailures(); got != tt.wantFailures {
+				t.Errorf("Expected %d circuit breaker failures, got %d", tt.wantFailures, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Placeholder written in place of anything that looks like a credential
+const redacted = "[REDACTED]"
+
+// credentialPatterns match credentials that are unambiguous on their own
+var credentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`),                                              // AWS access key IDs
+	regexp.MustCompile(`\bABSK[A-Za-z0-9+/=]{20,}`),                                                  // Bedrock API keys
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),                     // JWTs
+	regexp.MustCompile(`(?i)\bBearer\s+[A-Za-z0-9._~+/=-]+`),                                         // Authorization headers
+	regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/]+`),                           // Slack webhooks
+	regexp.MustCompile(`\b(?:xox[abposr]|secret_|ntn_)[A-Za-z0-9-_]{10,}`),                           // Slack/Notion tokens
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), // PEM keys
+}
+
+// credentialAssignment matches key/value pairs whose key names a credential, e.g.
+// token=abc, "apiKey": "abc", secret: abc; the key is kept and the value redacted
+var credentialAssignment = regexp.MustCompile(`(?i)((?:token|secret|password|api[_-]?key|access[_-]?key|authorization|x-api-key)["']?\s*[:=]\s*["']?)([^\s"',}&]+)`)
+
+// opaqueValue matches long base64/base64url/hex runs; only high-entropy ones are redacted
+var opaqueValue = regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`)
+
+// redact scrubs anything in s that looks like a credential or token
+func redact(s string) string {
+	for _, pattern := range credentialPatterns {
+		s = pattern.ReplaceAllString(s, redacted)
+	}
+	s = credentialAssignment.ReplaceAllString(s, "${1}"+redacted)
+	return opaqueValue.ReplaceAllStringFunc(s, func(match string) string {
+		if looksRandom(match) {
+			return redacted
+		}
+		return match
+	})
+}
+
+// looksRandom reports whether a long run mixes digits with upper- and lowercase letters,
+// as generated tokens do and paths, ARNs and log group names don't. A run mixing "/" with
+// "-" or "_" can't be a single base64 value, so it's treated as a path (e.g. an S3 key).
+func looksRandom(s string) bool {
+	if strings.HasPrefix(s, "/") || (strings.Contains(s, "/") && strings.ContainsAny(s, "-_")) {
+		return false
+	}
+
+	var digit, upper, lower bool
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		}
+	}
+	return digit && upper && lower
+}
+
+// redactingWriter scrubs credentials from everything written through the log package.
+// It is installed with log.SetOutput in init so no log line can leak a token, however
+// it was formatted.
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
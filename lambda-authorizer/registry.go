@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tokenRegistryAPI is the subset of the DynamoDB client used for the token registry
+type tokenRegistryAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// RegisteredToken is a scoped client token in the registry table (keyed by SHA-256 of the token)
+// SECURITY: Only token hashes are stored - the raw token is never persisted
+type RegisteredToken struct {
+	TokenHash string   `dynamodbav:"tokenHash"`
+	Name      string   `dynamodbav:"name"`
+	Scopes    []string `dynamodbav:"scopes"`
+	Disabled  bool     `dynamodbav:"disabled"`
+	ExpiresAt int64    `dynamodbav:"expiresAt,omitempty"` // Unix seconds; 0 = never
+	Tenant    string   `dynamodbav:"tenantId,omitempty"`  // "" = the owner's own devices
+
+	// Profile is the device's request defaults, validated by the admin API and
+	// passed through to the handler
+	Profile map[string]interface{} `dynamodbav:"profile,omitempty"`
+}
+
+// maxRegistryCacheEntries bounds the registry cache, so a flood of random bearer tokens
+// can't grow a warm authorizer's memory without limit
+const maxRegistryCacheEntries = 1000
+
+// RegistryCache holds registry lookups (including misses) with per-entry expiration
+type RegistryCache struct {
+	entries map[string]registryEntry
+	mu      sync.RWMutex
+}
+
+type registryEntry struct {
+	token      *RegisteredToken // nil when the hash isn't registered
+	expiration time.Time
+}
+
+var (
+	registryClient    tokenRegistryAPI
+	tokenRegistryName string
+	registryCache     = &RegistryCache{entries: map[string]registryEntry{}}
+)
+
+// registryKey returns the registry partition key for a token
+func registryKey(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// lookupRegisteredToken returns the registry entry for token, or nil if the token is not
+// registered, disabled or expired. Lookups are cached for cacheDuration.
+func lookupRegisteredToken(ctx context.Context, token string, now time.Time) (*RegisteredToken, error) {
+	key := registryKey(token)
+
+	registryCache.mu.RLock()
+	entry, ok := registryCache.entries[key]
+	registryCache.mu.RUnlock()
+
+	if !ok || !now.Before(entry.expiration) {
+		// Add timeout to prevent indefinite blocking on DynamoDB call
+		ddbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+
+		output, err := registryClient.GetItem(ddbCtx, &dynamodb.GetItemInput{
+			TableName: aws.String(tokenRegistryName),
+			Key: map[string]types.AttributeValue{
+				"tokenHash": &types.AttributeValueMemberS{Value: key},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("token registry lookup failed: %w", err)
+		}
+
+		entry = registryEntry{expiration: now.Add(cacheDuration)}
+		if output.Item != nil {
+			var registered RegisteredToken
+			if err := attributevalue.UnmarshalMap(output.Item, &registered); err != nil {
+				return nil, fmt.Errorf("invalid token registry item: %w", err)
+			}
+			entry.token = &registered
+		}
+
+		registryCache.store(key, entry, now)
+	}
+
+	registered := entry.token
+	if registered == nil || registered.Disabled {
+		return nil, nil
+	}
+	if registered.ExpiresAt != 0 && !now.Before(time.Unix(registered.ExpiresAt, 0)) {
+		return nil, nil
+	}
+	return registered, nil
+}
+
+// store caches entry under key. When the cache is full, expired entries are swept first
+// and then the entry closest to expiring (the oldest, as every entry lives for
+// cacheDuration) is evicted to make room.
+func (c *RegistryCache) store(key string, entry registryEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxRegistryCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expiration) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxRegistryCacheEntries {
+			oldest := ""
+			for k, e := range c.entries {
+				if oldest == "" || e.expiration.Before(c.entries[oldest].expiration) {
+					oldest = k
+				}
+			}
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = entry
+}
+
+// profileContext encodes a device profile for the policy context as JSON, or "" when the
+// device has none
+func profileContext(profile map[string]interface{}) string {
+	if len(profile) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(profile)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// scopesContext joins scopes for the policy context (API Gateway only passes scalar values)
+func scopesContext(scopes []string) string {
+	cleaned := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			cleaned = append(cleaned, scope)
+		}
+	}
+	return strings.Join(cleaned, " ")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeRegistry serves registered tokens from memory, keyed by token hash
+type fakeRegistry struct {
+	items map[string]RegisteredToken
+	err   error
+	calls int
+}
+
+func (f *fakeRegistry) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	key := params.Key["tokenHash"].(*types.AttributeValueMemberS).Value
+	registered, ok := f.items[key]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	item, err := attributevalue.MarshalMap(registered)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: item}, nil
+}
+
+// useFakeRegistry installs a fake registry with fresh caches for the duration of the test
+func useFakeRegistry(t *testing.T, registry *fakeRegistry) {
+	t.Helper()
+	origClient, origName := registryClient, tokenRegistryName
+	registryClient = registry
+	tokenRegistryName = "tokens"
+	registryCache = &RegistryCache{entries: map[string]registryEntry{}}
+	t.Cleanup(func() {
+		registryClient, tokenRegistryName = origClient, origName
+		registryCache = &RegistryCache{entries: map[string]registryEntry{}}
+	})
+}
+
+func TestLookupRegisteredToken(t *testing.T) {
+	now := time.Now()
+	registry := &fakeRegistry{items: map[string]RegisteredToken{
+		registryKey("notes-only"): {TokenHash: registryKey("notes-only"), Name: "watch", Scopes: []string{"mode:note"}},
+		registryKey("disabled"):   {TokenHash: registryKey("disabled"), Name: "old", Disabled: true},
+		registryKey("expired"):    {TokenHash: registryKey("expired"), Name: "temp", ExpiresAt: now.Add(-time.Hour).Unix()},
+		registryKey("future"):     {TokenHash: registryKey("future"), Name: "temp", ExpiresAt: now.Add(time.Hour).Unix()},
+	}}
+	useFakeRegistry(t, registry)
+
+	tests := []struct {
+		token     string
+		wantFound bool
+	}{
+		{token: "notes-only", wantFound: true},
+		{token: "disabled", wantFound: false},
+		{token: "expired", wantFound: false},
+		{token: "future", wantFound: true},
+		{token: "unknown", wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			registered, err := lookupRegisteredToken(context.Background(), tt.token, now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (registered != nil) != tt.wantFound {
+				t.Errorf("Expected found=%v, got %+v", tt.wantFound, registered)
+			}
+		})
+	}
+}
+
+func TestLookupRegisteredToken_Caching(t *testing.T) {
+	registry := &fakeRegistry{items: map[string]RegisteredToken{}}
+	useFakeRegistry(t, registry)
+
+	origDuration := cacheDuration
+	cacheDuration = time.Minute
+	defer func() { cacheDuration = origDuration }()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		_, _ = lookupRegisteredToken(context.Background(), "unknown", now)
+	}
+	if registry.calls != 1 {
+		t.Errorf("Expected misses to be cached (1 call), got %d calls", registry.calls)
+	}
+
+	_, _ = lookupRegisteredToken(context.Background(), "unknown", now.Add(2*time.Minute))
+	if registry.calls != 2 {
+		t.Errorf("Expected expired cache entry to be refetched, got %d calls", registry.calls)
+	}
+}
+
+func TestLookupRegisteredToken_CacheBounded(t *testing.T) {
+	useFakeRegistry(t, &fakeRegistry{items: map[string]RegisteredToken{}})
+
+	origDuration := cacheDuration
+	cacheDuration = time.Minute
+	defer func() { cacheDuration = origDuration }()
+
+	now := time.Now()
+	for i := 0; i < maxRegistryCacheEntries+50; i++ {
+		_, _ = lookupRegisteredToken(context.Background(), fmt.Sprint("random-", i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if got := len(registryCache.entries); got != maxRegistryCacheEntries {
+		t.Errorf("Expected the cache capped at %d entries, got %d", maxRegistryCacheEntries, got)
+	}
+	if _, ok := registryCache.entries[registryKey("random-0")]; ok {
+		t.Error("Expected the oldest entry to be evicted")
+	}
+
+	// Once entries expire they are swept rather than evicted one at a time
+	_, _ = lookupRegisteredToken(context.Background(), "late", now.Add(2*time.Minute))
+	if got := len(registryCache.entries); got != 1 {
+		t.Errorf("Expected expired entries to be swept, got %d entries", got)
+	}
+}
+
+func TestAuthorizeRegisteredToken(t *testing.T) {
+	arn := "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/invoke"
+	useFakeRegistry(t, &fakeRegistry{items: map[string]RegisteredToken{
+		registryKey("scoped"): {TokenHash: registryKey("scoped"), Name: "kid-watch", Scopes: []string{"mode:note", " -feature:send ", ""}},
+		registryKey("tenant"): {TokenHash: registryKey("tenant"), Name: "mum-phone", Tenant: "smith-family",
+			Profile: map[string]interface{}{"mode": "shopping", "sinks": []interface{}{"notion"}}},
+	}})
+
+	resp := authorizeRegisteredToken(context.Background(), "scoped", arn)
+	if resp.PolicyDocument.Statement[0].Effect != "Allow" {
+		t.Fatalf("Expected Allow, got %s", resp.PolicyDocument.Statement[0].Effect)
+	}
+	if resp.Context["scopes"] != "mode:note -feature:send" {
+		t.Errorf("Expected scopes in context, got %q", resp.Context["scopes"])
+	}
+	if resp.PrincipalID != hashToken("scoped") {
+		t.Errorf("Expected hashed principal, got %s", resp.PrincipalID)
+	}
+	if _, ok := resp.Context["tenantId"]; ok {
+		t.Errorf("Expected no tenant for an owner device, got %q", resp.Context["tenantId"])
+	}
+
+	resp = authorizeRegisteredToken(context.Background(), "tenant", arn)
+	if resp.Context["tenantId"] != "smith-family" {
+		t.Errorf("Expected tenant in context, got %q", resp.Context["tenantId"])
+	}
+	if resp.Context["deviceProfile"] != `{"mode":"shopping","sinks":["notion"]}` {
+		t.Errorf("Expected device profile in context, got %q", resp.Context["deviceProfile"])
+	}
+
+	resp = authorizeRegisteredToken(context.Background(), "unknown", arn)
+	if resp.PolicyDocument.Statement[0].Effect != "Deny" || resp.Context["errorType"] != ErrTokenMismatch {
+		t.Errorf("Expected Deny with token_mismatch, got %+v", resp)
+	}
+}
+
+func TestAuthorizeRegisteredToken_LookupFailure(t *testing.T) {
+	useFakeRegistry(t, &fakeRegistry{err: errors.New("throttled")})
+
+	resp := authorizeRegisteredToken(context.Background(), "scoped", "arn")
+	if resp.Context["errorType"] != ErrRegistryFailure {
+		t.Errorf("Expected registry_failure, got %+v", resp.Context)
+	}
+}
+
+func TestHandler_RegisteredToken(t *testing.T) {
+	useFakeRegistry(t, &fakeRegistry{items: map[string]RegisteredToken{
+		registryKey("scoped"): {TokenHash: registryKey("scoped"), Name: "watch", Scopes: []string{"tier:low"}},
+	}})
+
+	// Seed the static token cache so the handler doesn't call SSM
+	tokenCache.mu.Lock()
+	origToken, origExpiration := tokenCache.token, tokenCache.expiration
+	tokenCache.token, tokenCache.expiration = "static-token", time.Now().Add(time.Minute)
+	tokenCache.mu.Unlock()
+	defer func() {
+		tokenCache.mu.Lock()
+		tokenCache.token, tokenCache.expiration = origToken, origExpiration
+		tokenCache.mu.Unlock()
+	}()
+
+	tests := []struct {
+		token      string
+		wantEffect string
+		wantScopes interface{}
+	}{
+		{token: "static-token", wantEffect: "Allow", wantScopes: nil},
+		{token: "scoped", wantEffect: "Allow", wantScopes: "tier:low"},
+		{token: "wrong", wantEffect: "Deny", wantScopes: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			resp, err := handler(context.Background(), events.APIGatewayCustomAuthorizerRequestTypeRequest{
+				MethodArn: "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/invoke",
+				Headers:   map[string]string{"X-Client-Token": tt.token},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.PolicyDocument.Statement[0].Effect != tt.wantEffect {
+				t.Errorf("Expected %s, got %s", tt.wantEffect, resp.PolicyDocument.Statement[0].Effect)
+			}
+			if resp.Context["scopes"] != tt.wantScopes {
+				t.Errorf("Expected scopes %v, got %v", tt.wantScopes, resp.Context["scopes"])
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// actionSynonyms maps actions the model sometimes invents onto the ones clients switch
+// on. Mode names map to their mode's action (see modes), e.g. research -> note.
+var actionSynonyms = map[string]string{
+	"task": "reminder", "todo": "reminder", "to-do": "reminder", "alarm": "reminder",
+	"calendar": "event", "calendar-event": "event", "meeting": "event", "appointment": "event",
+	"memo": "note", "idea": "note", "answer": "note", "summary": "note", "list": "note",
+	"mail": "email", "draft": "email", "message": "email",
+	"grocery": "shopping", "groceries": "shopping", "shopping-list": "shopping",
+	"diary": "journal", "journal-entry": "journal",
+	"vcard": "contact", "person": "contact",
+	"translation": "translate",
+	"countdown":   "timer", "stopwatch": "timer",
+}
+
+// isValidAction reports whether action is one a mode produces
+func isValidAction(action string) bool {
+	for _, mode := range modes {
+		if mode.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// modeAction returns the action a mode produces, or "" for an unknown mode
+func modeAction(name string) string {
+	for _, mode := range modes {
+		if mode.Name == name {
+			return mode.Action
+		}
+	}
+	return ""
+}
+
+// canonicalAction maps a model's action onto a valid one, or "" when it can't be
+// recognised: case, spacing, underscores and plurals are ignored, then synonyms and mode
+// names are tried
+func canonicalAction(action string) string {
+	key := strings.Join(strings.FieldsFunc(strings.ToLower(action), func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-'
+	}), "-")
+	for _, candidate := range []string{key, strings.TrimSuffix(key, "s")} {
+		if isValidAction(candidate) {
+			return candidate
+		}
+		if action, ok := actionSynonyms[candidate]; ok {
+			return action
+		}
+		if action := modeAction(candidate); action != "" {
+			return action
+		}
+	}
+	return ""
+}
+
+// finalizeAction makes sure the response's action is one the Shortcut's switch handles,
+// remapping near-misses ("task", "Calendar") and replacing anything else with the
+// mode's own action
+func finalizeAction(mode string, resp *Response) {
+	action := canonicalAction(resp.Action)
+	if action == "" {
+		action = modeAction(mode)
+	}
+	if action == "" {
+		action = modeAction(defaultMode)
+	}
+	if action != resp.Action {
+		log.Printf("Remapped model action %q to %q", resp.Action, action)
+		resp.Action = action
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestFinalizeAction(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		action string
+		want   string
+	}{
+		{"valid", "note", "reminder", "reminder"},
+		{"case and spacing", "note", " Event ", "event"},
+		{"task", "note", "task", "reminder"},
+		{"to do", "reminder", "To_Do", "reminder"},
+		{"calendar", "event", "calendar", "event"},
+		{"calendar event", "event", "Calendar Event", "event"},
+		{"plural", "reminder", "reminders", "reminder"},
+		{"mode name", "research", "research", "note"},
+		{"unknown uses the mode's action", "shopping", "purchase", "shopping"},
+		{"missing uses the mode's action", "journal", "", "journal"},
+		{"unknown mode uses note", "", "whatever", "note"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := Response{Action: tt.action}
+			finalizeAction(tt.mode, &resp)
+			if resp.Action != tt.want {
+				t.Errorf("Action = %q, want %q", resp.Action, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionSynonymsAreValid(t *testing.T) {
+	for from, to := range actionSynonyms {
+		if !isValidAction(to) {
+			t.Errorf("actionSynonyms[%q] = %q, which no mode produces", from, to)
+		}
+	}
+}
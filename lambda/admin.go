@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Length of a token ID: the first 8 bytes of the token hash, matching the
+// authorizer's "user-<id>" principal for the token
+const tokenIDLength = 16
+
+// Maximum scoped tokens listed or scanned by the admin API
+const maxAdminTokens = 500
+
+// validScope matches the scopes understood by tokenScopes, plus "admin"
+var validScope = regexp.MustCompile(`^(-?(mode|feature):[a-z*]+|tier:(low|standard|high)|class:(economy|standard|premium)|admin)$`)
+
+// tokenTableName is the scoped token registry shared with the authorizer
+var tokenTableName string
+
+// AdminToken is a registry item as stored by the admin API and read by the authorizer
+// SECURITY: Only the SHA-256 of the token is stored; the token is shown once at creation
+type AdminToken struct {
+	TokenHash string   `dynamodbav:"tokenHash" json:"-"`
+	ID        string   `dynamodbav:"-" json:"id"`
+	Name      string   `dynamodbav:"name" json:"name"`
+	Scopes    []string `dynamodbav:"scopes" json:"scopes"`
+	Disabled  bool     `dynamodbav:"disabled" json:"disabled"`
+	CreatedAt string   `dynamodbav:"createdAt" json:"createdAt"`
+	ExpiresAt int64    `dynamodbav:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	Tenant    string   `dynamodbav:"tenantId,omitempty" json:"tenantId,omitempty"` // "" = the owner's own devices
+
+	Profile *DeviceProfile `dynamodbav:"profile,omitempty" json:"profile,omitempty"` // the device's request defaults
+}
+
+// adminTokenRequest is the body of create (POST) and update (PATCH) calls
+type adminTokenRequest struct {
+	Name      *string  `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt int64    `json:"expiresAt"` // Unix seconds; 0 = never
+	Tenant    *string  `json:"tenantId"`  // set by deployment admins only; "" on update removes it
+
+	Profile *DeviceProfile `json:"profile"` // {} on update removes it
+}
+
+// isAdminRequest reports whether the route is part of the admin API
+func isAdminRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.HasPrefix(path, "/admin/")
+}
+
+// callerIsAdmin reports whether the authorizer granted admin rights: the owner's SSM
+// token (role=admin) or a registered token with the "admin" scope
+func callerIsAdmin(event events.APIGatewayProxyRequest) bool {
+	if role, _ := event.RequestContext.Authorizer["role"].(string); role == "admin" {
+		return true
+	}
+	for _, scope := range scopesFromEvent(event) {
+		if scope == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// grantorScopes are the scopes an admin caller may hand out (see tokenScopes.grants):
+// nil, unlimited, for the owner's SSM token, otherwise the caller's own
+func grantorScopes(event events.APIGatewayProxyRequest) tokenScopes {
+	if role, _ := event.RequestContext.Authorizer["role"].(string); role == "admin" {
+		return nil
+	}
+	return append(tokenScopes{}, scopesFromEvent(event)...)
+}
+
+// handleAdmin serves /admin/tokens (GET list, POST create), /admin/tokens/{id}
+// (PATCH rename/rescope, DELETE revoke), /admin/prompt-variants (GET) and
+// /admin/reprocess (POST). A tenant's admins only manage their tenant's tokens; the
+// other routes span the whole deployment, so they are for deployment admins.
+func handleAdmin(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if !callerIsAdmin(event) {
+		log.Printf("Admin request denied for principal %s", principalFromEvent(event))
+		return errorResponse(ctx, apierror.Forbidden("admin access required"))
+	}
+	tenant := tenantFromEvent(event)
+	if tenant != "" && (isPromptVariantsRequest(event) || isReprocessRequest(event)) {
+		log.Printf("Deployment admin request denied for principal %s", principalFromEvent(event))
+		return errorResponse(ctx, apierror.Forbidden("deployment admin access required"))
+	}
+	if isPromptVariantsRequest(event) {
+		return handlePromptVariants(ctx, event)
+	}
+	if isReprocessRequest(event) {
+		return handleReprocess(ctx, event)
+	}
+	if tokenTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("token registry not configured"))
+	}
+
+	id := event.PathParameters["id"]
+	switch {
+	case id == "" && event.HTTPMethod == "GET":
+		return listAdminTokens(ctx, tenant, event.QueryStringParameters["cursor"])
+	case id == "" && event.HTTPMethod == "POST":
+		return createAdminToken(ctx, tenant, grantorScopes(event), event.Body)
+	case id != "" && event.HTTPMethod == "PATCH":
+		return updateAdminToken(ctx, tenant, grantorScopes(event), id, event.Body)
+	case id != "" && event.HTTPMethod == "DELETE":
+		return revokeAdminToken(ctx, tenant, id)
+	default:
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+}
+
+// listAdminTokens returns a page of the registered tokens the caller manages: all of
+// them for a deployment admin (tenant ""), otherwise its tenant's, filtered in the scan
+// so a tenant's page isn't used up by other tenants' tokens. nextCursor fetches the
+// next page. The token and its hash are never returned.
+func listAdminTokens(ctx context.Context, tenant, cursor string) events.APIGatewayProxyResponse {
+	var filter string
+	var values map[string]types.AttributeValue
+	if tenant != "" {
+		filter = "tenantId = :tenant"
+		values = map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: tenant}}
+	}
+	tokens, next, err := scanAdminTokens(ctx, filter, values, cursor)
+	if errors.Is(err, errInvalidCursor) {
+		return errorResponse(ctx, apierror.InvalidRequest("invalid cursor"))
+	}
+	if err != nil {
+		log.Printf("Failed to list tokens: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to list tokens"))
+	}
+	body := map[string]interface{}{"tokens": tokens}
+	if next != "" {
+		body["nextCursor"] = next
+	}
+	return apiResponse(200, body)
+}
+
+// tokenTenant resolves the tenantId of a create or update request. Deployment admins
+// may set any valid tenant; a tenant's admins can only name their own.
+func tokenTenant(callerTenant string, requested *string) (string, *apierror.Error) {
+	if requested == nil {
+		return callerTenant, nil
+	}
+	if callerTenant != "" {
+		if *requested != callerTenant {
+			return "", apierror.Forbidden("tenant admins can only manage their own tenant's tokens")
+		}
+		return callerTenant, nil
+	}
+	if *requested != "" && !validTenant.MatchString(*requested) {
+		return "", apierror.InvalidRequest("tenantId must be 1-63 lowercase letters, digits or '-'")
+	}
+	return *requested, nil
+}
+
+// createAdminToken generates a new token, stores its hash and returns the token once.
+// A tenant admin's tokens always belong to its tenant, and a registered admin token's
+// never get scopes beyond its own.
+func createAdminToken(ctx context.Context, callerTenant string, grantor tokenScopes, body string) events.APIGatewayProxyResponse {
+	var req adminTokenRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		return errorResponse(ctx, apierror.InvalidRequest("name field is required"))
+	}
+	if err := validateScopes(req.Scopes); err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+	}
+	if err := grantor.grants(req.Scopes); err != nil {
+		return errorResponse(ctx, apierror.Forbidden(err.Error()))
+	}
+	tenant, apiErr := tokenTenant(callerTenant, req.Tenant)
+	if apiErr != nil {
+		return errorResponse(ctx, apiErr)
+	}
+	if req.Profile != nil {
+		if err := validateDeviceProfile(*req.Profile); err != nil {
+			return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+		}
+		if req.Profile.isEmpty() {
+			req.Profile = nil
+		}
+	}
+
+	token, err := generateClientToken()
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to create token"))
+	}
+
+	record := AdminToken{
+		TokenHash: tokenHash(token),
+		Name:      strings.TrimSpace(*req.Name),
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		ExpiresAt: req.ExpiresAt,
+		Tenant:    tenant,
+		Profile:   req.Profile,
+	}
+	if record.Scopes == nil {
+		record.Scopes = []string{}
+	}
+	record.ID = record.TokenHash[:tokenIDLength]
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return errorResponse(ctx, apierror.Internal("Failed to create token"))
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(tokenTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(tokenHash)"),
+	})
+	if err != nil {
+		log.Printf("Failed to store token: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to create token"))
+	}
+
+	// SECURITY: The token is returned exactly once and never logged
+	log.Printf("Created token %s (%q) with scopes %v in tenant %q", record.ID, record.Name, record.Scopes, record.Tenant)
+	return apiResponse(201, map[string]interface{}{
+		"token":   token,
+		"details": record,
+	})
+}
+
+// updateAdminToken renames a token's device, replaces its scopes (within the grantor's
+// own) or device profile and/or (for deployment admins) moves it to another tenant
+func updateAdminToken(ctx context.Context, callerTenant string, grantor tokenScopes, id, body string) events.APIGatewayProxyResponse {
+	var req adminTokenRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+
+	updates := []string{}
+	values := map[string]types.AttributeValue{}
+	names := map[string]string{}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return errorResponse(ctx, apierror.InvalidRequest("name cannot be empty"))
+		}
+		updates = append(updates, "#name = :name")
+		names["#name"] = "name"
+		values[":name"] = &types.AttributeValueMemberS{Value: strings.TrimSpace(*req.Name)}
+	}
+	if req.Scopes != nil {
+		if err := validateScopes(req.Scopes); err != nil {
+			return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+		}
+		if err := grantor.grants(req.Scopes); err != nil {
+			return errorResponse(ctx, apierror.Forbidden(err.Error()))
+		}
+		scopes, _ := attributevalue.Marshal(req.Scopes)
+		updates = append(updates, "scopes = :scopes")
+		values[":scopes"] = scopes
+	}
+	var removes []string
+	if req.Tenant != nil {
+		tenant, apiErr := tokenTenant(callerTenant, req.Tenant)
+		if apiErr != nil {
+			return errorResponse(ctx, apiErr)
+		}
+		if tenant == "" {
+			removes = append(removes, "tenantId")
+		} else {
+			updates = append(updates, "tenantId = :tenant")
+			values[":tenant"] = &types.AttributeValueMemberS{Value: tenant}
+		}
+	}
+	if req.Profile != nil {
+		if err := validateDeviceProfile(*req.Profile); err != nil {
+			return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+		}
+		if req.Profile.isEmpty() {
+			removes = append(removes, "profile")
+		} else {
+			profile, _ := attributevalue.Marshal(req.Profile)
+			updates = append(updates, "profile = :profile")
+			values[":profile"] = profile
+		}
+	}
+	if len(updates) == 0 && len(removes) == 0 {
+		return errorResponse(ctx, apierror.InvalidRequest("nothing to update (name, scopes, tenantId, profile)"))
+	}
+
+	var clauses []string
+	if len(updates) > 0 {
+		clauses = append(clauses, "SET "+strings.Join(updates, ", "))
+	}
+	if len(removes) > 0 {
+		clauses = append(clauses, "REMOVE "+strings.Join(removes, ", "))
+	}
+	return applyTokenUpdate(ctx, callerTenant, id, strings.Join(clauses, " "), names, values)
+}
+
+// revokeAdminToken disables a token; the item is kept so the revocation is auditable
+func revokeAdminToken(ctx context.Context, callerTenant, id string) events.APIGatewayProxyResponse {
+	return applyTokenUpdate(ctx, callerTenant, id, "SET disabled = :disabled", nil, map[string]types.AttributeValue{
+		":disabled": &types.AttributeValueMemberBOOL{Value: true},
+	})
+}
+
+// applyTokenUpdate resolves a token ID to its registry key and applies an update
+// expression. Another tenant's token is reported as not found, so tenant admins can't
+// probe for it.
+func applyTokenUpdate(ctx context.Context, callerTenant, id, expression string, names map[string]string, values map[string]types.AttributeValue) events.APIGatewayProxyResponse {
+	if !isTokenID(id) {
+		return errorResponse(ctx, apierror.InvalidRequest("invalid token id"))
+	}
+
+	var match *AdminToken
+	cursor := ""
+	for match == nil {
+		matches, next, err := scanAdminTokens(ctx, "begins_with(tokenHash, :id)", map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: id},
+		}, cursor)
+		if err != nil {
+			log.Printf("Failed to look up token %s: %v", id, err)
+			return errorResponse(ctx, apierror.Internal("Failed to update token"))
+		}
+		for i := range matches {
+			if matches[i].ID == id && (callerTenant == "" || matches[i].Tenant == callerTenant) {
+				match = &matches[i]
+				break
+			}
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	if match == nil {
+		return errorResponse(ctx, apierror.NotFound("token not found"))
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(tokenTableName),
+		Key: map[string]types.AttributeValue{
+			"tokenHash": &types.AttributeValueMemberS{Value: match.TokenHash},
+		},
+		UpdateExpression: aws.String(expression),
+		// A token deleted since the scan must not come back as a partial item
+		ConditionExpression: aws.String("attribute_exists(tokenHash)"),
+		ReturnValues:        types.ReturnValueAllNew,
+	}
+	if len(names) > 0 {
+		input.ExpressionAttributeNames = names
+	}
+	if len(values) > 0 {
+		input.ExpressionAttributeValues = values
+	}
+
+	output, err := dynamoClient.UpdateItem(ctx, input)
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return errorResponse(ctx, apierror.NotFound("token not found"))
+	}
+	if err != nil {
+		log.Printf("Failed to update token %s: %v", id, err)
+		return errorResponse(ctx, apierror.Internal("Failed to update token"))
+	}
+
+	var updated AdminToken
+	if err := attributevalue.UnmarshalMap(output.Attributes, &updated); err != nil {
+		return errorResponse(ctx, apierror.Internal("Failed to update token"))
+	}
+	updated.ID = id
+	log.Printf("Updated token %s: %s", id, expression)
+	return apiResponse(200, updated)
+}
+
+// scanAdminTokens scans a page of registry items matching filter (a FilterExpression
+// using values, or "" for every item), resuming from cursor. It stops once it has
+// maxAdminTokens tokens and returns the cursor to continue from, "" at the end of the
+// table. The registry holds a handful of devices per owner, so a scan is cheaper than
+// maintaining an index.
+func scanAdminTokens(ctx context.Context, filter string, values map[string]types.AttributeValue, cursor string) ([]AdminToken, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(tokenTableName),
+		Limit:     aws.Int32(maxAdminTokens),
+	}
+	if filter != "" {
+		input.FilterExpression = aws.String(filter)
+		input.ExpressionAttributeValues = values
+	}
+	if cursor != "" {
+		hash, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(hash) == 0 {
+			return nil, "", errInvalidCursor
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"tokenHash": &types.AttributeValueMemberS{Value: string(hash)},
+		}
+	}
+
+	tokens := []AdminToken{}
+	for {
+		output, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return nil, "", err
+		}
+		var page []AdminToken
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return nil, "", err
+		}
+		for _, token := range page {
+			if len(token.TokenHash) >= tokenIDLength {
+				token.ID = token.TokenHash[:tokenIDLength]
+			}
+			tokens = append(tokens, token)
+		}
+		if output.LastEvaluatedKey == nil {
+			return tokens, "", nil
+		}
+		if len(tokens) >= maxAdminTokens {
+			var last struct {
+				TokenHash string `dynamodbav:"tokenHash"`
+			}
+			if err := attributevalue.UnmarshalMap(output.LastEvaluatedKey, &last); err != nil {
+				return nil, "", err
+			}
+			return tokens, base64.RawURLEncoding.EncodeToString([]byte(last.TokenHash)), nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// validateScopes rejects scopes the handler wouldn't understand
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !validScope.MatchString(scope) {
+			return fmt.Errorf("invalid scope: %s", strconv.Quote(scope))
+		}
+	}
+	return nil
+}
+
+// generateClientToken returns a random 256-bit token (URL-safe base64)
+func generateClientToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// tokenHash returns the registry key for a token (hex SHA-256, as the authorizer computes it)
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// isTokenID reports whether id looks like a token ID (16 lowercase hex chars)
+func isTokenID(id string) bool {
+	if len(id) != tokenIDLength {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
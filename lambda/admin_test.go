@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// useTokenTable swaps in a fake DynamoDB client and token registry for the test
+func useTokenTable(t *testing.T, db *fakeDynamo) {
+	t.Helper()
+	origClient, origTable := dynamoClient, tokenTableName
+	dynamoClient = db
+	tokenTableName = "tokens"
+	t.Cleanup(func() {
+		dynamoClient, tokenTableName = origClient, origTable
+	})
+}
+
+// adminEvent builds an admin API request authorized with the owner token
+func adminEvent(method, resource, id, body string) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod: method,
+		Resource:   resource,
+		Body:       body,
+	}
+	if id != "" {
+		event.PathParameters = map[string]string{"id": id}
+	}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-owner", "role": "admin"}
+	return event
+}
+
+func registryItem(t *testing.T, token AdminToken) map[string]types.AttributeValue {
+	t.Helper()
+	item, err := attributevalue.MarshalMap(token)
+	if err != nil {
+		t.Fatalf("MarshalMap() error = %v", err)
+	}
+	return item
+}
+
+func TestCallerIsAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		want       bool
+	}{
+		{name: "owner token", authorizer: map[string]interface{}{"role": "admin"}, want: true},
+		{name: "admin scope", authorizer: map[string]interface{}{"scopes": "mode:note admin"}, want: true},
+		{name: "scoped token", authorizer: map[string]interface{}{"scopes": "mode:note"}, want: false},
+		{name: "apple user", authorizer: map[string]interface{}{"principalId": "apple-001"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{}
+			event.RequestContext.Authorizer = tt.authorizer
+			if got := callerIsAdmin(event); got != tt.want {
+				t.Errorf("callerIsAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleAdmin_RequiresAdmin(t *testing.T) {
+	useTokenTable(t, &fakeDynamo{})
+
+	event := adminEvent("GET", "/admin/tokens", "", "")
+	event.RequestContext.Authorizer = map[string]interface{}{"scopes": "mode:note"}
+
+	resp, _ := handler(context.Background(), event)
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleAdmin_CreateToken(t *testing.T) {
+	db := &fakeDynamo{}
+	useTokenTable(t, db)
+
+	resp, _ := handler(context.Background(), adminEvent("POST", "/admin/tokens", "", `{"name":"Kid's Watch","scopes":["mode:note","tier:low"]}`))
+	if resp.StatusCode != 201 {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	var body struct {
+		Token   string `json:"token"`
+		Details struct {
+			ID     string   `json:"id"`
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(body.Token) < 40 {
+		t.Errorf("Expected a 256-bit token, got %q", body.Token)
+	}
+	if body.Details.ID != tokenHash(body.Token)[:16] {
+		t.Errorf("Expected ID to be the token hash prefix, got %s", body.Details.ID)
+	}
+	if strings.Contains(resp.Body, tokenHash(body.Token)) {
+		t.Error("Response must not expose the full token hash")
+	}
+
+	if len(db.items) != 1 {
+		t.Fatalf("Expected 1 stored item, got %d", len(db.items))
+	}
+	stored := db.items[0]
+	if stored["tokenHash"] != tokenHash(body.Token) || stored["name"] != "Kid's Watch" {
+		t.Errorf("Unexpected stored item: %v", stored)
+	}
+	for _, value := range stored {
+		if value == body.Token {
+			t.Error("Raw token must never be stored")
+		}
+	}
+}
+
+func TestHandleAdmin_CreateValidation(t *testing.T) {
+	useTokenTable(t, &fakeDynamo{})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "missing name", body: `{"scopes":["mode:note"]}`},
+		{name: "blank name", body: `{"name":"  "}`},
+		{name: "unknown scope", body: `{"name":"x","scopes":["superuser"]}`},
+		{name: "unknown tier", body: `{"name":"x","scopes":["tier:platinum"]}`},
+		{name: "unknown cost class", body: `{"name":"x","scopes":["class:luxury"]}`},
+		{name: "invalid json", body: `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := handler(context.Background(), adminEvent("POST", "/admin/tokens", "", tt.body))
+			if resp.StatusCode != 400 {
+				t.Errorf("Expected 400, got %d: %s", resp.StatusCode, resp.Body)
+			}
+		})
+	}
+}
+
+func TestHandleAdmin_ListTokens(t *testing.T) {
+	hash := tokenHash("secret-token")
+	useTokenTable(t, &fakeDynamo{scanItems: []map[string]types.AttributeValue{
+		registryItem(t, AdminToken{TokenHash: hash, Name: "Watch", Scopes: []string{"mode:note"}, CreatedAt: "2025-01-15T09:00:00Z"}),
+	}})
+
+	resp, _ := handler(context.Background(), adminEvent("GET", "/admin/tokens", "", ""))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if strings.Contains(resp.Body, hash) {
+		t.Error("List must not expose token hashes")
+	}
+	if !strings.Contains(resp.Body, `"id":"`+hash[:16]+`"`) || !strings.Contains(resp.Body, `"name":"Watch"`) {
+		t.Errorf("Unexpected list body: %s", resp.Body)
+	}
+}
+
+func TestHandleAdmin_ListTokensPages(t *testing.T) {
+	var items []map[string]types.AttributeValue
+	for i := 0; i < maxAdminTokens+10; i++ {
+		tenant := "jones"
+		if i >= maxAdminTokens {
+			tenant = "smith-family"
+		}
+		items = append(items, registryItem(t, AdminToken{TokenHash: tokenHash(fmt.Sprint("token-", i)), Name: fmt.Sprint("Device ", i), Tenant: tenant}))
+	}
+	useTokenTable(t, &fakeDynamo{scanItems: items})
+	ctx := context.Background()
+
+	list := func(event events.APIGatewayProxyRequest, cursor string) (tokens []AdminToken, next string) {
+		t.Helper()
+		event.QueryStringParameters = map[string]string{"cursor": cursor}
+		resp, _ := handler(ctx, event)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, resp.Body)
+		}
+		var body struct {
+			Tokens     []AdminToken `json:"tokens"`
+			NextCursor string       `json:"nextCursor"`
+		}
+		json.Unmarshal([]byte(resp.Body), &body)
+		return body.Tokens, body.NextCursor
+	}
+
+	// The tenant's tokens sit past the first page of the table, and are still found
+	tokens, next := list(tenantAdminEvent("GET", "/admin/tokens", "", ""), "")
+	for next != "" {
+		var more []AdminToken
+		more, next = list(tenantAdminEvent("GET", "/admin/tokens", "", ""), next)
+		tokens = append(tokens, more...)
+	}
+	if len(tokens) != 10 {
+		t.Errorf("Expected the tenant's 10 tokens, got %d", len(tokens))
+	}
+
+	tokens, next = list(adminEvent("GET", "/admin/tokens", "", ""), "")
+	if len(tokens) != maxAdminTokens || next == "" {
+		t.Fatalf("Expected a full first page and a cursor, got %d tokens, cursor %q", len(tokens), next)
+	}
+	if tokens, next = list(adminEvent("GET", "/admin/tokens", "", ""), next); len(tokens) != 10 || next != "" {
+		t.Errorf("Expected the last 10 tokens and no cursor, got %d tokens, cursor %q", len(tokens), next)
+	}
+
+	event := adminEvent("GET", "/admin/tokens", "", "")
+	event.QueryStringParameters = map[string]string{"cursor": "not base64!"}
+	if resp, _ := handler(ctx, event); resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for an invalid cursor, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleAdmin_RenameAndRevoke(t *testing.T) {
+	hash := tokenHash("secret-token")
+	db := &fakeDynamo{scanItems: []map[string]types.AttributeValue{
+		registryItem(t, AdminToken{TokenHash: hash, Name: "Watch"}),
+	}}
+	useTokenTable(t, db)
+	id := hash[:16]
+
+	resp, _ := handler(context.Background(), adminEvent("PATCH", "/admin/tokens/{id}", id, `{"name":"Work Watch"}`))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200 for rename, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	rename := db.updates[0]
+	if aws.ToString(rename.UpdateExpression) != "SET #name = :name" {
+		t.Errorf("Unexpected rename expression: %s", aws.ToString(rename.UpdateExpression))
+	}
+	if key := rename.Key["tokenHash"].(*types.AttributeValueMemberS).Value; key != hash {
+		t.Errorf("Expected update keyed by full hash, got %s", key)
+	}
+
+	resp, _ = handler(context.Background(), adminEvent("DELETE", "/admin/tokens/{id}", id, ""))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200 for revoke, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if aws.ToString(db.updates[1].UpdateExpression) != "SET disabled = :disabled" {
+		t.Errorf("Unexpected revoke expression: %s", aws.ToString(db.updates[1].UpdateExpression))
+	}
+	if aws.ToString(db.updates[1].ConditionExpression) != "attribute_exists(tokenHash)" {
+		t.Errorf("Expected the revoke to require an existing item, got %q", aws.ToString(db.updates[1].ConditionExpression))
+	}
+}
+
+func TestHandleAdmin_UnknownToken(t *testing.T) {
+	useTokenTable(t, &fakeDynamo{})
+
+	tests := []struct {
+		id         string
+		wantStatus int
+	}{
+		{id: "0123456789abcdef", wantStatus: 404},
+		{id: "not-a-token-id", wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		resp, _ := handler(context.Background(), adminEvent("DELETE", "/admin/tokens/{id}", tt.id, ""))
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("DELETE %s: expected %d, got %d", tt.id, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+// tenantAdminEvent builds an admin API request from a tenant's admin token
+func tenantAdminEvent(method, resource, id, body string) events.APIGatewayProxyRequest {
+	event := adminEvent(method, resource, id, body)
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-parent", "scopes": "admin", "tenantId": "smith-family"}
+	return event
+}
+
+func TestHandleAdmin_TenantScope(t *testing.T) {
+	own, other := tokenHash("own-token"), tokenHash("other-token")
+	db := &fakeDynamo{scanItems: []map[string]types.AttributeValue{
+		registryItem(t, AdminToken{TokenHash: own, Name: "Kid's Watch", Tenant: "smith-family"}),
+		registryItem(t, AdminToken{TokenHash: other, Name: "Neighbour", Tenant: "jones"}),
+	}}
+	useTokenTable(t, db)
+	ctx := context.Background()
+
+	resp, _ := handler(ctx, tenantAdminEvent("GET", "/admin/tokens", "", ""))
+	if resp.StatusCode != 200 || !strings.Contains(resp.Body, "Kid's Watch") || strings.Contains(resp.Body, "Neighbour") {
+		t.Errorf("Expected only the tenant's tokens, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = handler(ctx, adminEvent("GET", "/admin/tokens", "", ""))
+	if !strings.Contains(resp.Body, "Neighbour") || !strings.Contains(resp.Body, `"tenantId":"jones"`) {
+		t.Errorf("Expected the owner to see every tenant, got %s", resp.Body)
+	}
+
+	resp, _ = handler(ctx, tenantAdminEvent("DELETE", "/admin/tokens/{id}", other[:16], ""))
+	if resp.StatusCode != 404 {
+		t.Errorf("Expected 404 revoking another tenant's token, got %d", resp.StatusCode)
+	}
+	resp, _ = handler(ctx, tenantAdminEvent("DELETE", "/admin/tokens/{id}", own[:16], ""))
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected 200 revoking the tenant's token, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = handler(ctx, tenantAdminEvent("POST", "/admin/tokens", "", `{"name":"Tablet"}`))
+	if resp.StatusCode != 201 || db.items[0]["tenantId"] != "smith-family" {
+		t.Errorf("Expected the new token in the caller's tenant, got %d: %v", resp.StatusCode, db.items)
+	}
+	resp, _ = handler(ctx, tenantAdminEvent("POST", "/admin/tokens", "", `{"name":"Tablet","tenantId":"jones"}`))
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected 403 creating a token in another tenant, got %d", resp.StatusCode)
+	}
+	resp, _ = handler(ctx, tenantAdminEvent("GET", "/admin/prompt-variants", "", ""))
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected 403 for deployment-wide routes, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleAdmin_ScopesWithinGrant(t *testing.T) {
+	hash := tokenHash("kid-token")
+	db := &fakeDynamo{scanItems: []map[string]types.AttributeValue{
+		registryItem(t, AdminToken{TokenHash: hash, Name: "Kid's Watch", Tenant: "smith-family", Scopes: []string{"mode:note"}}),
+	}}
+	useTokenTable(t, db)
+	ctx := context.Background()
+	limited := func(method, resource, id, body string) events.APIGatewayProxyRequest {
+		event := tenantAdminEvent(method, resource, id, body)
+		event.RequestContext.Authorizer["scopes"] = "admin mode:note class:economy"
+		return event
+	}
+
+	for _, body := range []string{`{"name":"Tablet","scopes":["class:premium"]}`, `{"name":"Tablet"}`, `{"name":"Tablet","scopes":["mode:note"]}`} {
+		if resp, _ := handler(ctx, limited("POST", "/admin/tokens", "", body)); resp.StatusCode != 403 {
+			t.Errorf("%s: expected 403, got %d: %s", body, resp.StatusCode, resp.Body)
+		}
+	}
+	if len(db.items) != 0 {
+		t.Fatalf("Expected no token stored, got %v", db.items)
+	}
+	resp, _ := handler(ctx, limited("POST", "/admin/tokens", "", `{"name":"Tablet","scopes":["mode:note","class:economy"]}`))
+	if resp.StatusCode != 201 {
+		t.Errorf("Expected 201 within the caller's scopes, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = handler(ctx, limited("PATCH", "/admin/tokens/{id}", hash[:16], `{"scopes":[]}`))
+	if resp.StatusCode != 403 || len(db.updates) != 0 {
+		t.Errorf("Expected 403 lifting the limits, got %d with %d updates", resp.StatusCode, len(db.updates))
+	}
+	// The owner may hand out anything
+	resp, _ = handler(ctx, adminEvent("PATCH", "/admin/tokens/{id}", hash[:16], `{"scopes":["class:premium"]}`))
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected 200 for the owner, got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestHandleAdmin_AssignTenant(t *testing.T) {
+	hash := tokenHash("secret-token")
+	db := &fakeDynamo{scanItems: []map[string]types.AttributeValue{
+		registryItem(t, AdminToken{TokenHash: hash, Name: "Watch", Tenant: "jones"}),
+	}}
+	useTokenTable(t, db)
+	id := hash[:16]
+
+	resp, _ := handler(context.Background(), adminEvent("POST", "/admin/tokens", "", `{"name":"x","tenantId":"Smith Family"}`))
+	if resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for an invalid tenantId, got %d", resp.StatusCode)
+	}
+
+	resp, _ = handler(context.Background(), adminEvent("PATCH", "/admin/tokens/{id}", id, `{"tenantId":"smith-family"}`))
+	if resp.StatusCode != 200 || aws.ToString(db.updates[0].UpdateExpression) != "SET tenantId = :tenant" {
+		t.Errorf("Unexpected move: %d %s", resp.StatusCode, aws.ToString(db.updates[0].UpdateExpression))
+	}
+	resp, _ = handler(context.Background(), adminEvent("PATCH", "/admin/tokens/{id}", id, `{"tenantId":""}`))
+	if resp.StatusCode != 200 || aws.ToString(db.updates[1].UpdateExpression) != "REMOVE tenantId" || db.updates[1].ExpressionAttributeValues != nil {
+		t.Errorf("Unexpected removal: %d %s", resp.StatusCode, aws.ToString(db.updates[1].UpdateExpression))
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Alexa skill adapter. The skill's endpoint is this function's ARN, so Alexa invokes it
+// directly (the function only accepts the skill in ALEXA_SKILL_ID). The skill uses
+// account linking: the linked access token is a registered client token, looked up in
+// the token registry exactly as the authorizer does, so the skill runs as that token's
+// principal with its scopes and device profile.
+//
+// Interaction model: CaptureIntent with an AMAZON.SearchQuery slot "text" (e.g. "note
+// {text}", "remind me {text}") and an optional "mode" slot holding a mode name; without
+// one the mode is inferred from the text.
+const (
+	alexaCaptureIntent = "CaptureIntent"
+	alexaTextSlot      = "text"
+	alexaModeSlot      = "mode"
+)
+
+// alexaRequest is the part of an Alexa Skills Kit request envelope the adapter reads
+type alexaRequest struct {
+	Version string `json:"version"`
+	Session struct {
+		SessionID string `json:"sessionId"`
+	} `json:"session"`
+	Context struct {
+		System struct {
+			Application struct {
+				ApplicationID string `json:"applicationId"`
+			} `json:"application"`
+			User struct {
+				AccessToken string `json:"accessToken"`
+			} `json:"user"`
+		} `json:"System"`
+	} `json:"context"`
+	Request struct {
+		Type      string `json:"type"`
+		RequestID string `json:"requestId"`
+		Locale    string `json:"locale"`
+		Intent    struct {
+			Name  string `json:"name"`
+			Slots map[string]struct {
+				Value string `json:"value"`
+			} `json:"slots"`
+		} `json:"intent"`
+	} `json:"request"`
+}
+
+// alexaResponse is an Alexa Skills Kit response envelope
+type alexaResponse struct {
+	Version  string            `json:"version"`
+	Response alexaResponseBody `json:"response"`
+}
+
+type alexaResponseBody struct {
+	OutputSpeech     *alexaSpeech `json:"outputSpeech,omitempty"`
+	Card             *alexaCard   `json:"card,omitempty"`
+	Reprompt         *alexaPrompt `json:"reprompt,omitempty"`
+	ShouldEndSession bool         `json:"shouldEndSession"`
+}
+
+type alexaSpeech struct {
+	Type string `json:"type"`
+	SSML string `json:"ssml"`
+}
+
+type alexaPrompt struct {
+	OutputSpeech alexaSpeech `json:"outputSpeech"`
+}
+
+type alexaCard struct {
+	Type    string `json:"type"`
+	Title   string `json:"title,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// handleAlexa answers an Alexa request with speech. Requests from other skills are
+// refused with an error, which Alexa reports as a failed skill call.
+func handleAlexa(ctx context.Context, req alexaRequest) (*alexaResponse, error) {
+	skillID := os.Getenv("ALEXA_SKILL_ID")
+	if skillID == "" || req.Context.System.Application.ApplicationID != skillID {
+		return nil, fmt.Errorf("alexa request from unexpected skill %q", req.Context.System.Application.ApplicationID)
+	}
+
+	switch req.Request.Type {
+	case "LaunchRequest":
+		return alexaAsk("What should I capture?", "You can say, remind me to call mom at five."), nil
+	case "SessionEndedRequest":
+		return &alexaResponse{Version: "1.0", Response: alexaResponseBody{ShouldEndSession: true}}, nil
+	case "IntentRequest":
+	default:
+		return alexaTell("Sorry, I can't do that yet.", nil), nil
+	}
+
+	switch req.Request.Intent.Name {
+	case alexaCaptureIntent:
+	case "AMAZON.HelpIntent":
+		return alexaAsk("Tell me what to capture, like: note, pick up the dry cleaning. Or: remind me to call mom at five.", "What should I capture?"), nil
+	case "AMAZON.CancelIntent", "AMAZON.StopIntent":
+		return alexaTell("Okay.", nil), nil
+	default:
+		return alexaAsk("Sorry, I didn't catch that. What should I capture?", "What should I capture?"), nil
+	}
+
+	text := strings.TrimSpace(req.Request.Intent.Slots[alexaTextSlot].Value)
+	if text == "" {
+		return alexaAsk("What should I capture?", "What should I capture?"), nil
+	}
+	authorizerContext, err := alexaAuthorizer(ctx, req.Context.System.User.AccessToken)
+	if err != nil {
+		log.Printf("Alexa token lookup failed: %v", err)
+		return alexaTell("Sorry, I couldn't check your account. Please try again.", nil), nil
+	}
+	if authorizerContext == nil {
+		resp := alexaTell("Please link your Wrist Agent account in the Alexa app first.", nil)
+		resp.Response.Card = &alexaCard{Type: "LinkAccount"}
+		return resp, nil
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(req.Request.Intent.Slots[alexaModeSlot].Value))
+	if _, ok := lookupMode(mode); !ok {
+		mode = inferMode(text)
+	}
+	result := runCapture(ctx, CaptureRequest{
+		Source:    "alexa",
+		RequestID: req.Request.RequestID,
+		Caller:    authorizerContext,
+		Fields:    map[string]interface{}{"text": text, "mode": mode},
+	})
+	if result.Status >= 300 {
+		return alexaTell("Sorry, that didn't work. "+result.Error, nil), nil
+	}
+	if result.Response == nil {
+		return alexaTell("Sorry, something went wrong. Please try again.", nil), nil
+	}
+	return alexaTell(spokenConfirmation(*result.Response), &alexaCard{
+		Type:    "Simple",
+		Title:   result.Response.Title,
+		Content: truncateRunes(plainText(result.Response.Markdown), 8000),
+	}), nil
+}
+
+// alexaAuthorizer builds the authorizer context for a linked access token from the token
+// registry, or returns nil when the token isn't registered, is disabled or has expired.
+// The principal matches the one the authorizer gives the token on the REST API.
+func alexaAuthorizer(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	if accessToken == "" || tokenTableName == "" {
+		return nil, nil
+	}
+	hash := tokenHash(accessToken)
+	output, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tokenTableName),
+		Key:       map[string]types.AttributeValue{"tokenHash": &types.AttributeValueMemberS{Value: hash}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token registry lookup failed: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+	var token AdminToken
+	if err := attributevalue.UnmarshalMap(output.Item, &token); err != nil {
+		return nil, fmt.Errorf("invalid token registry item: %w", err)
+	}
+	if token.Disabled || (token.ExpiresAt != 0 && !time.Now().Before(time.Unix(token.ExpiresAt, 0))) {
+		return nil, nil
+	}
+
+	authorizerContext := map[string]interface{}{
+		"principalId":   "user-" + hash[:tokenIDLength],
+		"authenticated": "true",
+		"tokenName":     token.Name,
+		"scopes":        strings.Join(token.Scopes, " "),
+	}
+	if token.Tenant != "" {
+		authorizerContext["tenantId"] = token.Tenant
+	}
+	if token.Profile != nil {
+		profile, _ := json.Marshal(token.Profile)
+		authorizerContext["deviceProfile"] = string(profile)
+	}
+	return authorizerContext, nil
+}
+
+// alexaTell speaks text and ends the session
+func alexaTell(text string, card *alexaCard) *alexaResponse {
+	return &alexaResponse{Version: "1.0", Response: alexaResponseBody{
+		OutputSpeech:     alexaSSML(text),
+		Card:             card,
+		ShouldEndSession: true,
+	}}
+}
+
+// alexaAsk speaks text and keeps the session open for an answer
+func alexaAsk(text, reprompt string) *alexaResponse {
+	return &alexaResponse{Version: "1.0", Response: alexaResponseBody{
+		OutputSpeech: alexaSSML(text),
+		Reprompt:     &alexaPrompt{OutputSpeech: *alexaSSML(reprompt)},
+	}}
+}
+
+// alexaSSML wraps text as SSML speech, escaping it
+func alexaSSML(text string) *alexaSpeech {
+	return &alexaSpeech{Type: "SSML", SSML: "<speak>" + html.EscapeString(text) + "</speak>"}
+}
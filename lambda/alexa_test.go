@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// alexaPayload builds an Alexa request for the test skill, as the Lambda receives it
+func alexaPayload(requestType, intent, text, mode, accessToken string) json.RawMessage {
+	slots := map[string]interface{}{"text": map[string]string{"name": "text", "value": text}}
+	if mode != "" {
+		slots["mode"] = map[string]string{"name": "mode", "value": mode}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"version": "1.0",
+		"session": map[string]interface{}{"sessionId": "amzn1.echo-api.session.1"},
+		"context": map[string]interface{}{"System": map[string]interface{}{
+			"application": map[string]string{"applicationId": "amzn1.ask.skill.test"},
+			"user":        map[string]string{"userId": "amzn1.ask.account.1", "accessToken": accessToken},
+		}},
+		"request": map[string]interface{}{
+			"type":      requestType,
+			"requestId": "amzn1.echo-api.request.1",
+			"intent":    map[string]interface{}{"name": intent, "slots": slots},
+		},
+	})
+	return payload
+}
+
+// invokeAlexa runs a payload through the Lambda entry point
+func invokeAlexa(t *testing.T, payload json.RawMessage) *alexaResponse {
+	t.Helper()
+	out, err := invoke(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	resp, ok := out.(*alexaResponse)
+	if !ok {
+		t.Fatalf("Expected an Alexa response, got %T", out)
+	}
+	return resp
+}
+
+func TestHandleAlexa_Capture(t *testing.T) {
+	t.Setenv("ALEXA_SKILL_ID", "amzn1.ask.skill.test")
+	db := &fakeDynamo{items: []map[string]interface{}{
+		{"tokenHash": tokenHash("linked-token"), "name": "Kitchen Echo", "scopes": []string{"mode:reminder"}},
+	}}
+	useTokenTable(t, db)
+	model := &fakeBedrock{text: `{"action":"reminder","title":"Call mom","markdown":"Call mom","dueISO":"2025-03-03T17:00:00Z","shortText":"Call mom"}`}
+	useFakeBedrock(t, model)
+
+	resp := invokeAlexa(t, alexaPayload("IntentRequest", "CaptureIntent", "remind me to call mom at 5 & check in", "", "linked-token"))
+	if want := "<speak>Reminder set: Call mom, Monday, March 3 at 5:00 PM.</speak>"; resp.Response.OutputSpeech.SSML != want {
+		t.Errorf("SSML = %q, want %q", resp.Response.OutputSpeech.SSML, want)
+	}
+	if !resp.Response.ShouldEndSession || resp.Response.Card == nil || resp.Response.Card.Title != "Call mom" {
+		t.Errorf("Unexpected response: %+v", resp.Response)
+	}
+	if !strings.Contains(string(model.body), "check in") {
+		t.Errorf("Expected the utterance sent to the model")
+	}
+
+	// The token's scopes apply, so a mode it doesn't allow is refused
+	resp = invokeAlexa(t, alexaPayload("IntentRequest", "CaptureIntent", "an idea for the garden", "note", "linked-token"))
+	if !strings.HasPrefix(resp.Response.OutputSpeech.SSML, "<speak>Sorry, that didn&#39;t work.") {
+		t.Errorf("Expected the scope error spoken, got %q", resp.Response.OutputSpeech.SSML)
+	}
+}
+
+func TestHandleAlexa_Session(t *testing.T) {
+	t.Setenv("ALEXA_SKILL_ID", "amzn1.ask.skill.test")
+	useTokenTable(t, &fakeDynamo{})
+
+	resp := invokeAlexa(t, alexaPayload("LaunchRequest", "", "", "", ""))
+	if resp.Response.ShouldEndSession || resp.Response.Reprompt == nil {
+		t.Errorf("Expected launch to ask for a capture, got %+v", resp.Response)
+	}
+	resp = invokeAlexa(t, alexaPayload("IntentRequest", "AMAZON.StopIntent", "", "", ""))
+	if !resp.Response.ShouldEndSession {
+		t.Errorf("Expected stop to end the session")
+	}
+
+	// Unlinked and unregistered tokens are asked to link their account
+	for _, token := range []string{"", "unknown-token"} {
+		resp = invokeAlexa(t, alexaPayload("IntentRequest", "CaptureIntent", "buy milk", "", token))
+		if resp.Response.Card == nil || resp.Response.Card.Type != "LinkAccount" {
+			t.Errorf("Expected a LinkAccount card for token %q, got %+v", token, resp.Response)
+		}
+	}
+
+	// Other skills are refused
+	t.Setenv("ALEXA_SKILL_ID", "amzn1.ask.skill.other")
+	if _, err := invoke(context.Background(), alexaPayload("LaunchRequest", "", "", "", "")); err == nil {
+		t.Error("Expected a request from another skill to fail")
+	}
+}
+
+func TestAlexaAuthorizer(t *testing.T) {
+	hash := tokenHash("linked-token")
+	db := &fakeDynamo{items: []map[string]interface{}{
+		{"tokenHash": hash, "name": "Echo", "scopes": []string{"mode:note", "-feature:send"}, "tenantId": "family", "profile": map[string]interface{}{"mode": "note"}},
+	}}
+	useTokenTable(t, db)
+
+	got, err := alexaAuthorizer(context.Background(), "linked-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["principalId"] != "user-"+hash[:16] || got["scopes"] != "mode:note -feature:send" || got["tenantId"] != "family" || got["deviceProfile"] != `{"mode":"note"}` {
+		t.Errorf("Unexpected authorizer context: %v", got)
+	}
+
+	db.items[0]["disabled"] = true
+	if got, _ := alexaAuthorizer(context.Background(), "linked-token"); got != nil {
+		t.Errorf("Expected a disabled token to be refused, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Upper bound on alternative datetimes offered for an ambiguous date
+const maxDateAlternatives = 4
+
+// dateContextPrompt gives the model the current time in the request's timezone, so it
+// knows which day "today" and "Friday" are when it writes date expressions
+func dateContextPrompt(now time.Time) string {
+	return "\n\nCurrent time: " + now.Format(time.RFC3339) + " (" + now.Weekday().String() + ")"
+}
+
+// finalizeDateAmbiguity validates dueConfidence and alternatives for reminders (dueISO)
+// and events (startISO). Alternatives must parse and differ from the chosen datetime;
+// a missing confidence is derived from how many alternatives remain. Other actions,
+// and items without a date, carry neither field.
+func finalizeDateAmbiguity(resp *Response) {
+	var chosen *string
+	switch resp.Action {
+	case "reminder":
+		chosen = resp.DueISO
+	case "event":
+		chosen = resp.StartISO
+	}
+	if chosen == nil {
+		resp.DueConfidence = nil
+		resp.Alternatives = nil
+		return
+	}
+	chosenTime, err := time.Parse(time.RFC3339, *chosen)
+	if err != nil {
+		resp.DueConfidence = nil
+		resp.Alternatives = nil
+		return
+	}
+
+	seen := map[int64]bool{chosenTime.Unix(): true}
+	var alternatives []string
+	for _, alternative := range resp.Alternatives {
+		t, err := time.Parse(time.RFC3339, alternative)
+		if err != nil || seen[t.Unix()] {
+			continue
+		}
+		seen[t.Unix()] = true
+		alternatives = append(alternatives, alternative)
+		if len(alternatives) == maxDateAlternatives {
+			break
+		}
+	}
+	resp.Alternatives = alternatives
+
+	var confidence float64
+	switch {
+	case resp.DueConfidence != nil && !math.IsNaN(*resp.DueConfidence):
+		confidence = math.Max(0, math.Min(1, *resp.DueConfidence))
+	case len(alternatives) > 0:
+		// Equally likely candidates
+		confidence = math.Round(100/float64(len(alternatives)+1)) / 100
+	default:
+		confidence = 1
+	}
+	resp.DueConfidence = &confidence
+}
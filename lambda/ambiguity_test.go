@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFinalizeDateAmbiguity(t *testing.T) {
+	due := "2025-01-17T09:00:00Z"
+	tests := []struct {
+		name       string
+		resp       Response
+		confidence *float64
+		alts       []string
+	}{
+		{"confident", Response{Action: "reminder", DueISO: &due}, floatPtr(1), nil},
+		{"model confidence kept",
+			Response{Action: "reminder", DueISO: &due, DueConfidence: floatPtr(0.6), Alternatives: []string{"2025-01-24T09:00:00Z"}},
+			floatPtr(0.6), []string{"2025-01-24T09:00:00Z"}},
+		{"confidence clamped", Response{Action: "event", StartISO: &due, DueConfidence: floatPtr(1.7)}, floatPtr(1), nil},
+		{"invalid and duplicate alternatives dropped",
+			Response{Action: "event", StartISO: &due, Alternatives: []string{"next friday", "2025-01-17T10:00:00+01:00", "2025-01-24T09:00:00Z", "2025-01-24T09:00:00Z"}},
+			floatPtr(0.5), []string{"2025-01-24T09:00:00Z"}},
+		{"alternatives capped",
+			Response{Action: "reminder", DueISO: &due, Alternatives: []string{"2025-01-18T09:00:00Z", "2025-01-19T09:00:00Z", "2025-01-20T09:00:00Z", "2025-01-21T09:00:00Z", "2025-01-22T09:00:00Z"}},
+			floatPtr(0.2), []string{"2025-01-18T09:00:00Z", "2025-01-19T09:00:00Z", "2025-01-20T09:00:00Z", "2025-01-21T09:00:00Z"}},
+		{"no date", Response{Action: "reminder", DueConfidence: floatPtr(0.4), Alternatives: []string{due}}, nil, nil},
+		{"note", Response{Action: "note", DueISO: &due, DueConfidence: floatPtr(0.4)}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.resp
+			finalizeDateAmbiguity(&resp)
+			if !reflect.DeepEqual(resp.DueConfidence, tt.confidence) {
+				t.Errorf("DueConfidence = %v, want %v", deref(resp.DueConfidence), deref(tt.confidence))
+			}
+			if !reflect.DeepEqual(resp.Alternatives, tt.alts) {
+				t.Errorf("Alternatives = %v, want %v", resp.Alternatives, tt.alts)
+			}
+		})
+	}
+}
+
+func TestDateContextPrompt(t *testing.T) {
+	got := dateContextPrompt(time.Date(2025, 1, 15, 8, 30, 0, 0, time.UTC))
+	if !strings.Contains(got, "2025-01-15T08:30:00Z (Wednesday)") {
+		t.Errorf("dateContextPrompt() = %q", got)
+	}
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
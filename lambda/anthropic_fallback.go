@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Direct Anthropic API defaults for the Bedrock fallback
+const (
+	defaultAnthropicAPIURL        = "https://api.anthropic.com/v1/messages"
+	defaultAnthropicFallbackModel = "claude-haiku-4-5"
+	anthropicAPIVersion           = "2023-06-01"
+)
+
+// anthropicHTTPClient calls the Anthropic API; it allows less than the Lambda timeout so
+// a slow fallback still fails cleanly
+var anthropicHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// anthropicFallbackEnabled reports whether requests may fall back to the Anthropic API:
+// ANTHROPIC_FALLBACK_ENABLED must be true and ANTHROPIC_API_KEY_SECRET_ARN set
+func anthropicFallbackEnabled() bool {
+	return strings.EqualFold(os.Getenv("ANTHROPIC_FALLBACK_ENABLED"), "true") && os.Getenv("ANTHROPIC_API_KEY_SECRET_ARN") != ""
+}
+
+// shouldFallBackToAnthropic reports whether a Bedrock failure is an outage worth the
+// fallback: the circuit is open or Bedrock itself failed. Caller mistakes and
+// throttling are left to the usual handling.
+func shouldFallBackToAnthropic(err error) bool {
+	var circuitOpen *CircuitOpenError
+	return anthropicFallbackEnabled() && (errors.As(err, &circuitOpen) || isBedrockOutage(err))
+}
+
+// invokeAnthropicAPI sends the call Bedrock couldn't answer to the Anthropic Messages
+// API with the key in ANTHROPIC_API_KEY_SECRET_ARN, as ANTHROPIC_FALLBACK_MODEL (default
+// Claude Haiku 4.5). Extended thinking is skipped so the fallback stays fast.
+func invokeAnthropicAPI(ctx context.Context, systemPrompt string, messages []map[string]interface{}, maxTokens int, sampling Sampling) (*BedrockResponse, error) {
+	apiKey, err := getSecret(ctx, os.Getenv("ANTHROPIC_API_KEY_SECRET_ARN"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Anthropic API key: %w", err)
+	}
+
+	body, err := anthropicProvider{}.BuildRequest(systemPrompt, messages, maxTokens, 0, sampling)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Anthropic request: %w", err)
+	}
+	// The Messages API takes the model in the body and the version as a header
+	var requestBody map[string]interface{}
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		return nil, fmt.Errorf("failed to marshal Anthropic request: %w", err)
+	}
+	delete(requestBody, "anthropic_version")
+	model := getEnv("ANTHROPIC_FALLBACK_MODEL", defaultAnthropicFallbackModel)
+	requestBody["model"] = model
+	if body, err = json.Marshal(requestBody); err != nil {
+		return nil, fmt.Errorf("failed to marshal Anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, getEnv("ANTHROPIC_API_URL", defaultAnthropicAPIURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Anthropic request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", strings.TrimSpace(apiKey))
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	callStart := time.Now()
+	httpResp, err := anthropicHTTPClient.Do(httpReq)
+	latency := time.Since(callStart)
+	if err != nil {
+		emitModelCallMetrics(model, latency, Usage{}, err)
+		return nil, fmt.Errorf("Anthropic API request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(httpResp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Anthropic response: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("Anthropic API returned status %d", httpResp.StatusCode)
+		emitModelCallMetrics(model, latency, Usage{}, err)
+		return nil, err
+	}
+
+	resp, err := anthropicProvider{}.ParseResponse(respBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Anthropic response: %w", err)
+	}
+	emitModelCallMetrics(model, latency, resp.Usage, nil)
+	if len(resp.Content) == 0 {
+		return nil, fmt.Errorf("empty response from Anthropic API")
+	}
+	log.Printf("Answered by the Anthropic API (%s) during a Bedrock outage", model)
+	return resp, nil
+}
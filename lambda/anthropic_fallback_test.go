@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+const testAnthropicSecret = "arn:aws:secretsmanager:us-west-2:123456789012:secret:anthropic"
+
+// useAnthropicAPI enables the fallback against server for one test
+func useAnthropicAPI(t *testing.T, server *httptest.Server) {
+	t.Helper()
+	t.Setenv("ANTHROPIC_FALLBACK_ENABLED", "true")
+	t.Setenv("ANTHROPIC_API_KEY_SECRET_ARN", testAnthropicSecret)
+	t.Setenv("ANTHROPIC_API_URL", server.URL)
+	useFakeSecrets(t, &fakeSecrets{values: map[string]string{testAnthropicSecret: "sk-test\n"}})
+}
+
+func TestShouldFallBackToAnthropic(t *testing.T) {
+	outage := &types.ServiceUnavailableException{}
+	if shouldFallBackToAnthropic(outage) {
+		t.Error("fallback used while disabled")
+	}
+
+	t.Setenv("ANTHROPIC_FALLBACK_ENABLED", "true")
+	t.Setenv("ANTHROPIC_API_KEY_SECRET_ARN", testAnthropicSecret)
+	if !shouldFallBackToAnthropic(outage) || !shouldFallBackToAnthropic(&CircuitOpenError{RetryAfter: time.Second}) {
+		t.Error("outages should fall back")
+	}
+	if shouldFallBackToAnthropic(&types.ThrottlingException{}) || shouldFallBackToAnthropic(&types.ValidationException{}) {
+		t.Error("throttling and validation errors should not fall back")
+	}
+}
+
+func TestCallBedrock_AnthropicFallback(t *testing.T) {
+	var got map[string]interface{}
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(BedrockResponse{
+			Content: []Content{{Type: "text", Text: `{"action":"note","title":"Tides","markdown":"Tides"}`}},
+			Usage:   Usage{InputTokens: 50, OutputTokens: 10},
+		})
+	}))
+	defer server.Close()
+	useAnthropicAPI(t, server)
+	useFakeBedrock(t, &fakeBedrock{err: &types.ServiceUnavailableException{}})
+	useBreaker(t, &CircuitBreaker{})
+
+	response, err := callBedrock(context.Background(), &Req{Text: "note about tides", Mode: "note", MaxTokens: 800, ThinkingTokens: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Title != "Tides" || response.usage.InputTokens != 50 {
+		t.Errorf("response = %+v", response)
+	}
+	if headers.Get("x-api-key") != "sk-test" || headers.Get("anthropic-version") != anthropicAPIVersion {
+		t.Errorf("headers = %v", headers)
+	}
+	if got["model"] != defaultAnthropicFallbackModel || got["anthropic_version"] != nil || got["thinking"] != nil {
+		t.Errorf("request body = %v", got)
+	}
+}
+
+func TestCallBedrock_AnthropicFallbackFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	useAnthropicAPI(t, server)
+	cb := &CircuitBreaker{}
+	tripBreaker(cb, time.Now())
+	useBreaker(t, cb)
+
+	// The Bedrock error is reported, so clients still get the circuit's Retry-After
+	_, err := callBedrock(context.Background(), &Req{Text: "hello", Mode: "note", MaxTokens: 100})
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("callBedrock() error = %v, want *CircuitOpenError", err)
+	}
+}
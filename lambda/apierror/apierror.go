@@ -0,0 +1,192 @@
+// Package apierror defines the error envelope returned by the Wrist Agent API:
+//
+//	{"error": {"code": "INVALID_REQUEST", "message": "...", "retryable": false, "requestId": "...", "details": {...}}}
+//
+// Clients branch on code and retryable; message is for humans and may change.
+package apierror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Code is a stable, machine-readable error identifier
+type Code string
+
+const (
+	CodeInvalidJSON        Code = "INVALID_JSON"        // Body is not valid JSON
+	CodeInvalidRequest     Code = "INVALID_REQUEST"     // A field failed validation
+	CodeUnauthorized       Code = "UNAUTHORIZED"        // No or invalid credentials
+	CodeForbidden          Code = "FORBIDDEN"           // Credentials lack permission (scopes, admin)
+	CodeNotFound           Code = "NOT_FOUND"           // Resource does not exist
+	CodeMethodNotAllowed   Code = "METHOD_NOT_ALLOWED"  // HTTP method not supported on the route
+	CodePayloadTooLarge    Code = "PAYLOAD_TOO_LARGE"   // Body or text over the size limit
+	CodeQuotaExceeded      Code = "QUOTA_EXCEEDED"      // Per-principal usage quota used up
+	CodeBudgetExceeded     Code = "BUDGET_EXCEEDED"     // Monthly spend budget (principal or global) used up
+	CodeThrottled          Code = "THROTTLED"           // Upstream (Bedrock) throttling or service quota
+	CodeUpstreamTimeout    Code = "UPSTREAM_TIMEOUT"    // Bedrock timed out
+	CodeServiceUnavailable Code = "SERVICE_UNAVAILABLE" // Bedrock down or circuit open
+	CodeNotConfigured      Code = "NOT_CONFIGURED"      // Feature not enabled in this deployment
+	CodeInternal           Code = "INTERNAL_ERROR"      // Anything else
+)
+
+// Error is an API error and its HTTP status
+type Error struct {
+	Status    int                    `json:"-"`
+	Code      Code                   `json:"code"`
+	Message   string                 `json:"message"`
+	Retryable bool                   `json:"retryable"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+
+	// RetryAfter, when set, is sent as the Retry-After header and details.retryAfterSeconds
+	RetryAfter time.Duration `json:"-"`
+}
+
+// FieldError is one request field that failed validation, listed in details.fields
+type FieldError struct {
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"` // the field the client probably meant
+}
+
+// Envelope is the response body wrapping an Error
+type Envelope struct {
+	Error *Error `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// New returns an error with the given status, code and message. Throttling and
+// availability statuses (429, 502, 503, 504) are retryable by default.
+func New(status int, code Code, message string) *Error {
+	return &Error{
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		Retryable: retryableStatus(status),
+	}
+}
+
+// Newf is New with a formatted message
+func Newf(status int, code Code, format string, args ...interface{}) *Error {
+	return New(status, code, fmt.Sprintf(format, args...))
+}
+
+// WithDetail returns a copy of e with key set in its details
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	c := *e
+	c.Details = make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		c.Details[k] = v
+	}
+	c.Details[key] = value
+	return &c
+}
+
+// WithFields returns a copy of e listing the fields that failed in details.fields
+func (e *Error) WithFields(fields []FieldError) *Error {
+	return e.WithDetail("fields", fields)
+}
+
+// WithRetryable returns a copy of e with Retryable overridden
+func (e *Error) WithRetryable(retryable bool) *Error {
+	c := *e
+	c.Retryable = retryable
+	return &c
+}
+
+// WithReason returns a copy of e with a machine-readable details.reason, e.g.
+// "bedrock_throttled", so clients can tell apart errors sharing a code
+func (e *Error) WithReason(reason string) *Error {
+	return e.WithDetail("reason", reason)
+}
+
+// WithRetryAfter returns a copy of e telling the client how long to back off (at least 1s)
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	if d < time.Second {
+		d = time.Second
+	}
+	c := e.WithDetail("retryAfterSeconds", 0)
+	c.RetryAfter = d
+	c.Details["retryAfterSeconds"] = c.RetryAfterSeconds()
+	return c
+}
+
+// RetryAfterSeconds is RetryAfter rounded up to whole seconds, or 0 if unset
+func (e *Error) RetryAfterSeconds() int {
+	if e.RetryAfter <= 0 {
+		return 0
+	}
+	seconds := int(e.RetryAfter / time.Second)
+	if e.RetryAfter > time.Duration(seconds)*time.Second {
+		seconds++
+	}
+	return seconds
+}
+
+// Envelope returns the response body for e, stamped with the request ID from ctx
+func (e *Error) Envelope(ctx context.Context) Envelope {
+	c := *e
+	c.RequestID = RequestID(ctx)
+	return Envelope{Error: &c}
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the API Gateway request ID for error envelopes
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored by WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Convenience constructors for the common cases
+
+func InvalidJSON() *Error {
+	return New(http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON payload")
+}
+
+func InvalidRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func MethodNotAllowed() *Error {
+	return New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
+
+func PayloadTooLarge(message string) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, message)
+}
+
+func NotConfigured(message string) *Error {
+	return New(http.StatusServiceUnavailable, CodeNotConfigured, message).WithRetryable(false)
+}
+
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, message)
+}
@@ -0,0 +1,135 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNew_Retryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{400, false},
+		{403, false},
+		{413, false},
+		{429, true},
+		{500, false},
+		{502, true},
+		{503, true},
+		{504, true},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.status, CodeInternal, "x").Retryable; got != tt.want {
+			t.Errorf("New(%d).Retryable = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           *Error
+		wantStatus    int
+		wantCode      Code
+		wantRetryable bool
+	}{
+		{"invalid json", InvalidJSON(), 400, CodeInvalidJSON, false},
+		{"invalid request", InvalidRequest("bad"), 400, CodeInvalidRequest, false},
+		{"forbidden", Forbidden("no"), 403, CodeForbidden, false},
+		{"not found", NotFound("gone"), 404, CodeNotFound, false},
+		{"method not allowed", MethodNotAllowed(), 405, CodeMethodNotAllowed, false},
+		{"payload too large", PayloadTooLarge("big"), 413, CodePayloadTooLarge, false},
+		{"not configured", NotConfigured("off"), 503, CodeNotConfigured, false},
+		{"internal", Internal("oops"), 500, CodeInternal, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Status != tt.wantStatus || tt.err.Code != tt.wantCode || tt.err.Retryable != tt.wantRetryable {
+				t.Errorf("got %d/%s/%v, want %d/%s/%v", tt.err.Status, tt.err.Code, tt.err.Retryable, tt.wantStatus, tt.wantCode, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestWithDetail_DoesNotMutate(t *testing.T) {
+	base := New(429, CodeQuotaExceeded, "quota").WithDetail("window", "daily")
+	derived := base.WithDetail("resetAt", "2025-03-02T00:00:00Z")
+
+	if len(base.Details) != 1 {
+		t.Errorf("base details mutated: %v", base.Details)
+	}
+	if derived.Details["window"] != "daily" || derived.Details["resetAt"] != "2025-03-02T00:00:00Z" {
+		t.Errorf("derived details = %v", derived.Details)
+	}
+}
+
+func TestWithRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		in   time.Duration
+		want int
+	}{
+		{"whole seconds", 30 * time.Second, 30},
+		{"rounds up", 1500 * time.Millisecond, 2},
+		{"at least one second", 0, 1},
+		{"negative clamps", -time.Minute, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New(429, CodeThrottled, "slow down").WithRetryAfter(tt.in)
+			if got := err.RetryAfterSeconds(); got != tt.want {
+				t.Errorf("RetryAfterSeconds() = %d, want %d", got, tt.want)
+			}
+			if got := err.Details["retryAfterSeconds"]; got != tt.want {
+				t.Errorf("details.retryAfterSeconds = %v, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := New(429, CodeThrottled, "x").RetryAfterSeconds(); got != 0 {
+		t.Errorf("RetryAfterSeconds() without WithRetryAfter = %d, want 0", got)
+	}
+}
+
+func TestWithReason(t *testing.T) {
+	err := New(429, CodeThrottled, "x").WithReason("bedrock_throttled")
+	if err.Details["reason"] != "bedrock_throttled" {
+		t.Errorf("details.reason = %v", err.Details["reason"])
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	err := InvalidRequest("unknown field: maxtokens").WithFields([]FieldError{{Field: "maxtokens", Message: "unknown field", Suggestion: "maxTokens"}})
+	body, _ := json.Marshal(err.Details)
+	if want := `{"fields":[{"field":"maxtokens","message":"unknown field","suggestion":"maxTokens"}]}`; string(body) != want {
+		t.Errorf("details = %s, want %s", body, want)
+	}
+}
+
+func TestEnvelope_JSON(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-123")
+	body, err := json.Marshal(Forbidden("mode deepthink is not permitted").Envelope(ctx))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	want := `{"error":{"code":"FORBIDDEN","message":"mode deepthink is not permitted","retryable":false,"requestId":"req-123"}}`
+	if string(body) != want {
+		t.Errorf("envelope = %s, want %s", body, want)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if got := RequestID(context.Background()); got != "" {
+		t.Errorf("RequestID() without value = %q, want empty", got)
+	}
+	if got := RequestID(WithRequestID(context.Background(), "abc")); got != "abc" {
+		t.Errorf("RequestID() = %q, want abc", got)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Presigned .ics links stay valid long enough for the Shortcut to open them
+const icsURLExpiry = time.Hour
+
+// s3PresignAPI is the subset of the S3 presign client used by the handler
+type s3PresignAPI interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+var s3Presigner s3PresignAPI
+
+// attachICS renders an event response as an .ics file and attaches it either inline
+// (base64, the default) or as a presigned S3 URL when ICS_DELIVERY=s3. Failures are
+// logged and leave the response without an attachment rather than failing the request.
+func attachICS(ctx context.Context, meta captureMeta, resp *Response) {
+	event, err := buildVEvent(meta.ID+"@wrist-agent", *resp, meta.CreatedAt, meta.Timezone)
+	if err != nil {
+		log.Printf("Skipping .ics attachment: %v", err)
+		return
+	}
+	ics := icsCalendar(event)
+
+	if getEnv("ICS_DELIVERY", "inline") != "s3" {
+		resp.ICSBase64 = base64.StdEncoding.EncodeToString([]byte(ics))
+		return
+	}
+
+	url, err := uploadICS(ctx, meta, ics)
+	if err != nil {
+		log.Printf("Failed to upload .ics, falling back to inline: %v", err)
+		resp.ICSBase64 = base64.StdEncoding.EncodeToString([]byte(ics))
+		return
+	}
+	resp.ICSURL = url
+}
+
+// uploadICS stores the calendar file under ics/<principal>/<id>.ics and presigns a GET for it
+func uploadICS(ctx context.Context, meta captureMeta, ics string) (string, error) {
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" {
+		return "", fmt.Errorf("CAPTURE_BUCKET_NAME not configured")
+	}
+	key := fmt.Sprintf("ics/%s/%s.ics", meta.Principal, meta.ID)
+
+	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(key),
+		Body:               strings.NewReader(ics),
+		ContentType:        aws.String("text/calendar; charset=utf-8"),
+		ContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="%s.ics"`, meta.ID)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("S3 PutObject failed: %w", err)
+	}
+
+	presigned, err := s3Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(icsURLExpiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign .ics URL: %w", err)
+	}
+	return presigned.URL, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakePresigner returns a deterministic URL for the requested key
+type fakePresigner struct {
+	err error
+}
+
+func (f *fakePresigner) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &v4.PresignedHTTPRequest{URL: "https://bucket.s3.amazonaws.com/" + aws.ToString(params.Key) + "?sig=1"}, nil
+}
+
+func (f *fakePresigner) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &v4.PresignedHTTPRequest{URL: "https://bucket.s3.amazonaws.com/" + aws.ToString(params.Key) + "?sig=put", Method: "PUT"}, nil
+}
+
+// useFakeS3 swaps the S3 and presign clients for one test
+func useFakeS3(t *testing.T, store *fakeS3, presigner *fakePresigner) {
+	t.Helper()
+	origClient, origPresigner := s3Client, s3Presigner
+	s3Client, s3Presigner = store, presigner
+	t.Cleanup(func() { s3Client, s3Presigner = origClient, origPresigner })
+}
+
+func TestAttachICS_Inline(t *testing.T) {
+	t.Setenv("ICS_DELIVERY", "")
+	resp := &Response{Title: "Standup", Action: "event", StartISO: strPtr("2025-01-15T09:00:00Z"), Recurrence: strPtr("FREQ=WEEKLY;BYDAY=MO")}
+
+	attachICS(context.Background(), testMeta(), resp)
+
+	decoded, err := base64.StdEncoding.DecodeString(resp.ICSBase64)
+	if err != nil {
+		t.Fatalf("Expected valid base64, got error: %v", err)
+	}
+	if !strings.Contains(string(decoded), "RRULE:FREQ=WEEKLY;BYDAY=MO\r\n") {
+		t.Errorf("Expected RRULE in .ics, got %s", decoded)
+	}
+	if resp.ICSURL != "" {
+		t.Error("Expected no URL for inline delivery")
+	}
+}
+
+func TestAttachICS_S3(t *testing.T) {
+	t.Setenv("ICS_DELIVERY", "s3")
+	t.Setenv("CAPTURE_BUCKET_NAME", "bucket")
+	store := &fakeS3{}
+	useFakeS3(t, store, &fakePresigner{})
+
+	resp := &Response{Action: "event", StartISO: strPtr("2025-01-15T09:00:00Z")}
+	attachICS(context.Background(), testMeta(), resp)
+
+	if store.key != "ics/user-123/20250115T090000Z-abcd1234.ics" {
+		t.Errorf("Unexpected object key %s", store.key)
+	}
+	if !strings.HasPrefix(resp.ICSURL, "https://bucket.s3.amazonaws.com/ics/") || resp.ICSBase64 != "" {
+		t.Errorf("Expected presigned URL only, got url=%q inline=%q", resp.ICSURL, resp.ICSBase64)
+	}
+}
+
+func TestAttachICS_S3FallsBackToInline(t *testing.T) {
+	t.Setenv("ICS_DELIVERY", "s3")
+	t.Setenv("CAPTURE_BUCKET_NAME", "bucket")
+	useFakeS3(t, &fakeS3{}, &fakePresigner{err: errors.New("no creds")})
+
+	resp := &Response{Action: "event", StartISO: strPtr("2025-01-15T09:00:00Z")}
+	attachICS(context.Background(), testMeta(), resp)
+
+	if resp.ICSBase64 == "" || resp.ICSURL != "" {
+		t.Errorf("Expected inline fallback, got url=%q inline=%q", resp.ICSURL, resp.ICSBase64)
+	}
+}
+
+func TestAttachICS_NoStart(t *testing.T) {
+	resp := &Response{Action: "event"}
+	attachICS(context.Background(), testMeta(), resp)
+
+	if resp.ICSBase64 != "" || resp.ICSURL != "" {
+		t.Error("Expected no attachment without a start time")
+	}
+}
+
+func TestNormalizeRRule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "FREQ=WEEKLY;BYDAY=MO", want: "FREQ=WEEKLY;BYDAY=MO"},
+		{in: "RRULE:freq=daily;count=5", want: "FREQ=DAILY;COUNT=5"},
+		{in: "FREQ=SECONDLY", want: ""},
+		{in: "BYDAY=MO", want: ""},
+		{in: "FREQ=DAILY\r\nX-EVIL:1", want: ""},
+		{in: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeRRule(tt.in); got != tt.want {
+			t.Errorf("normalizeRRule(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// Bedrock circuit breaker defaults (overridable via BEDROCK_CIRCUIT_BREAKER_* env vars)
+const (
+	bedrockBreakerThreshold      = 5                // Consecutive Bedrock outages before opening circuit
+	bedrockBreakerTimeout        = 30 * time.Second // How long to fail fast before probing again
+	bedrockBreakerHalfOpenProbes = 1                // Calls let through while half-open
+)
+
+// CircuitBreaker tracks Bedrock outages so sustained failures fail fast instead of
+// burning the Lambda timeout on every request. Mirrors the authorizer's breaker:
+// closed (failures < threshold), open (until timeout after the last failure),
+// and half-open (up to maxProbes calls allowed through to test recovery)
+type CircuitBreaker struct {
+	failures     int
+	lastFailure  time.Time
+	probes       int // probe calls handed out in the current half-open period
+	probeStarted time.Time
+	threshold    int
+	timeout      time.Duration
+	maxProbes    int
+	mu           sync.Mutex
+}
+
+// bedrockBreaker guards InvokeModel
+var bedrockBreaker = newBedrockBreaker()
+
+// newBedrockBreaker builds the breaker from BEDROCK_CIRCUIT_BREAKER_THRESHOLD,
+// BEDROCK_CIRCUIT_BREAKER_TIMEOUT_SECONDS and BEDROCK_CIRCUIT_BREAKER_HALF_OPEN_PROBES
+func newBedrockBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: breakerEnv("BEDROCK_CIRCUIT_BREAKER_THRESHOLD", bedrockBreakerThreshold),
+		timeout:   time.Duration(breakerEnv("BEDROCK_CIRCUIT_BREAKER_TIMEOUT_SECONDS", int(bedrockBreakerTimeout/time.Second))) * time.Second,
+		maxProbes: breakerEnv("BEDROCK_CIRCUIT_BREAKER_HALF_OPEN_PROBES", bedrockBreakerHalfOpenProbes),
+	}
+}
+
+func breakerEnv(key string, defaultValue int) int {
+	if env := os.Getenv(key); env != "" {
+		if value, err := strconv.Atoi(env); err == nil && value > 0 {
+			return value
+		}
+		log.Printf("Invalid %s value: %s, using default", key, env)
+	}
+	return defaultValue
+}
+
+// failureThreshold returns the configured threshold (zero value = default)
+func (cb *CircuitBreaker) failureThreshold() int {
+	if cb.threshold > 0 {
+		return cb.threshold
+	}
+	return bedrockBreakerThreshold
+}
+
+// openTimeout returns the configured open duration (zero value = default)
+func (cb *CircuitBreaker) openTimeout() time.Duration {
+	if cb.timeout > 0 {
+		return cb.timeout
+	}
+	return bedrockBreakerTimeout
+}
+
+// halfOpenProbes returns the configured probe allowance (zero value = default)
+func (cb *CircuitBreaker) halfOpenProbes() int {
+	if cb.maxProbes > 0 {
+		return cb.maxProbes
+	}
+	return bedrockBreakerHalfOpenProbes
+}
+
+// allow reports whether a call may proceed. While open it returns false and how long
+// the caller should wait; once the timeout passes a limited number of probes get through.
+// Probe slots that never report back are reclaimed after one timeout.
+func (cb *CircuitBreaker) allow(now time.Time) (bool, time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.failures < cb.failureThreshold() {
+		return true, 0
+	}
+	if wait := cb.openTimeout() - now.Sub(cb.lastFailure); wait > 0 {
+		return false, wait
+	}
+
+	if cb.probes > 0 && now.Sub(cb.probeStarted) >= cb.openTimeout() {
+		cb.probes = 0
+	}
+	if cb.probes >= cb.halfOpenProbes() {
+		// Another request is already probing; ask the caller to come back after it
+		return false, time.Second
+	}
+	if cb.probes == 0 {
+		cb.probeStarted = now
+		log.Printf("Bedrock circuit breaker HALF-OPEN, allowing %d probe(s)", cb.halfOpenProbes())
+	}
+	cb.probes++
+	return true, 0
+}
+
+// closed reports whether calls go through normally, without taking a half-open probe slot
+func (cb *CircuitBreaker) closed() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.failures < cb.failureThreshold()
+}
+
+// recordFailure counts a Bedrock outage, re-opening the circuit if a probe failed
+func (cb *CircuitBreaker) recordFailure(now time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	wasOpen := cb.failures >= cb.failureThreshold()
+	halfOpen := cb.probes > 0
+	cb.failures++
+	cb.lastFailure = now
+	cb.probes = 0
+
+	if halfOpen {
+		log.Printf("Bedrock circuit breaker RE-OPENED after failed probe (%d failures)", cb.failures)
+	} else if !wasOpen && cb.failures >= cb.failureThreshold() {
+		log.Printf("Bedrock circuit breaker OPENED after %d failures", cb.failures)
+	}
+}
+
+// reset closes the circuit after a successful call
+func (cb *CircuitBreaker) reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.failures >= cb.failureThreshold() {
+		log.Printf("Bedrock circuit breaker CLOSED (reset from %d failures)", cb.failures)
+	}
+	cb.failures = 0
+	cb.probes = 0
+}
+
+// isBedrockOutage reports whether err means Bedrock itself is unhealthy. Caller mistakes
+// (validation, access, throttling, quotas) don't count toward opening the circuit.
+func isBedrockOutage(err error) bool {
+	var internalServerErr *types.InternalServerException
+	var unavailableErr *types.ServiceUnavailableException
+	var modelTimeoutErr *types.ModelTimeoutException
+	var notReadyErr *types.ModelNotReadyException
+
+	return errors.As(err, &internalServerErr) ||
+		errors.As(err, &unavailableErr) ||
+		errors.As(err, &modelTimeoutErr) ||
+		errors.As(err, &notReadyErr) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// CircuitOpenError is returned instead of calling Bedrock while the circuit is open
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("bedrock circuit breaker open, retry after %s", e.RetryAfter.Round(time.Second))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// useBreaker swaps in cb as the Bedrock breaker for the duration of the test
+func useBreaker(t *testing.T, cb *CircuitBreaker) {
+	t.Helper()
+	previous := bedrockBreaker
+	bedrockBreaker = cb
+	t.Cleanup(func() { bedrockBreaker = previous })
+}
+
+// tripBreaker records enough failures at now to open cb
+func tripBreaker(cb *CircuitBreaker, now time.Time) {
+	for i := 0; i < cb.failureThreshold(); i++ {
+		cb.recordFailure(now)
+	}
+}
+
+func TestCircuitBreaker_Allow(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("closed below threshold", func(t *testing.T) {
+		cb := &CircuitBreaker{}
+		for i := 0; i < cb.failureThreshold()-1; i++ {
+			cb.recordFailure(now)
+		}
+		if ok, _ := cb.allow(now); !ok {
+			t.Error("Circuit should stay closed below the threshold")
+		}
+	})
+
+	t.Run("open reports remaining wait", func(t *testing.T) {
+		cb := &CircuitBreaker{timeout: time.Minute}
+		tripBreaker(cb, now)
+		ok, wait := cb.allow(now.Add(20 * time.Second))
+		if ok {
+			t.Fatal("Circuit should be open")
+		}
+		if wait != 40*time.Second {
+			t.Errorf("wait = %v, want 40s", wait)
+		}
+	})
+
+	t.Run("half-open limits probes", func(t *testing.T) {
+		cb := &CircuitBreaker{maxProbes: 2}
+		tripBreaker(cb, now)
+		later := now.Add(cb.openTimeout())
+		got := []bool{}
+		for i := 0; i < 3; i++ {
+			ok, _ := cb.allow(later)
+			got = append(got, ok)
+		}
+		want := []bool{true, true, false}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("allow() call %d = %v, want %v", i+1, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("failed probe re-opens", func(t *testing.T) {
+		cb := &CircuitBreaker{}
+		tripBreaker(cb, now)
+		later := now.Add(cb.openTimeout())
+		if ok, _ := cb.allow(later); !ok {
+			t.Fatal("Probe should be allowed")
+		}
+		cb.recordFailure(later)
+		if ok, wait := cb.allow(later); ok || wait != cb.openTimeout() {
+			t.Errorf("allow() = %v, %v; want open for %v", ok, wait, cb.openTimeout())
+		}
+	})
+
+	t.Run("successful probe closes", func(t *testing.T) {
+		cb := &CircuitBreaker{}
+		tripBreaker(cb, now)
+		later := now.Add(cb.openTimeout())
+		if ok, _ := cb.allow(later); !ok {
+			t.Fatal("Probe should be allowed")
+		}
+		cb.reset()
+		for i := 0; i < 3; i++ {
+			if ok, _ := cb.allow(later); !ok {
+				t.Error("Circuit should be closed after a successful probe")
+			}
+		}
+	})
+
+	t.Run("abandoned probe slot expires", func(t *testing.T) {
+		cb := &CircuitBreaker{}
+		tripBreaker(cb, now)
+		later := now.Add(cb.openTimeout())
+		cb.allow(later)
+		if ok, _ := cb.allow(later); ok {
+			t.Fatal("Second caller should wait for the probe")
+		}
+		if ok, _ := cb.allow(later.Add(cb.openTimeout())); !ok {
+			t.Error("Abandoned probe slot should be reclaimed")
+		}
+	})
+}
+
+func TestNewBedrockBreaker(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     string
+		timeout       string
+		probes        string
+		wantThreshold int
+		wantTimeout   time.Duration
+		wantProbes    int
+	}{
+		{
+			name:          "defaults",
+			wantThreshold: bedrockBreakerThreshold,
+			wantTimeout:   bedrockBreakerTimeout,
+			wantProbes:    bedrockBreakerHalfOpenProbes,
+		},
+		{
+			name:          "custom values",
+			threshold:     "2",
+			timeout:       "90",
+			probes:        "3",
+			wantThreshold: 2,
+			wantTimeout:   90 * time.Second,
+			wantProbes:    3,
+		},
+		{
+			name:          "invalid values fall back to defaults",
+			threshold:     "-1",
+			timeout:       "later",
+			probes:        "0",
+			wantThreshold: bedrockBreakerThreshold,
+			wantTimeout:   bedrockBreakerTimeout,
+			wantProbes:    bedrockBreakerHalfOpenProbes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BEDROCK_CIRCUIT_BREAKER_THRESHOLD", tt.threshold)
+			t.Setenv("BEDROCK_CIRCUIT_BREAKER_TIMEOUT_SECONDS", tt.timeout)
+			t.Setenv("BEDROCK_CIRCUIT_BREAKER_HALF_OPEN_PROBES", tt.probes)
+
+			cb := newBedrockBreaker()
+			if got := cb.failureThreshold(); got != tt.wantThreshold {
+				t.Errorf("failureThreshold() = %d, want %d", got, tt.wantThreshold)
+			}
+			if got := cb.openTimeout(); got != tt.wantTimeout {
+				t.Errorf("openTimeout() = %v, want %v", got, tt.wantTimeout)
+			}
+			if got := cb.halfOpenProbes(); got != tt.wantProbes {
+				t.Errorf("halfOpenProbes() = %d, want %d", got, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func TestIsBedrockOutage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"internal server", &types.InternalServerException{}, true},
+		{"service unavailable", &types.ServiceUnavailableException{}, true},
+		{"model timeout", &types.ModelTimeoutException{}, true},
+		{"model not ready", &types.ModelNotReadyException{}, true},
+		{"deadline", fmt.Errorf("invoke: %w", context.DeadlineExceeded), true},
+		{"wrapped internal", fmt.Errorf("Bedrock InvokeModel failed: %w", &types.InternalServerException{}), true},
+		{"validation", &types.ValidationException{}, false},
+		{"throttling", &types.ThrottlingException{}, false},
+		{"access denied", &types.AccessDeniedException{}, false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBedrockOutage(tt.err); got != tt.want {
+				t.Errorf("isBedrockOutage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallBedrock_CircuitOpen(t *testing.T) {
+	cb := &CircuitBreaker{}
+	tripBreaker(cb, time.Now())
+	useBreaker(t, cb)
+
+	// bedrockClient is never touched while the circuit is open
+	_, err := callBedrock(context.Background(), &Req{Text: "hello", Mode: "note", MaxTokens: 100})
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("callBedrock() error = %v, want *CircuitOpenError", err)
+	}
+	if circuitErr.RetryAfter <= 0 || circuitErr.RetryAfter > cb.openTimeout() {
+		t.Errorf("RetryAfter = %v, want within (0, %v]", circuitErr.RetryAfter, cb.openTimeout())
+	}
+}
+
+func TestBedrockError_CircuitOpen(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		want       string
+	}{
+		{"whole seconds", 30 * time.Second, "30"},
+		{"rounds up", 12500 * time.Millisecond, "13"},
+		{"at least one second", 0, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := errorResponse(context.Background(), bedrockError(&CircuitOpenError{RetryAfter: tt.retryAfter}))
+			if resp.StatusCode != 503 {
+				t.Errorf("StatusCode = %d, want 503", resp.StatusCode)
+			}
+			if got := resp.Headers["Retry-After"]; got != tt.want {
+				t.Errorf("Retry-After = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Partition key of the deployment-wide spend counters in the history table; principals'
+// items all start with USER# or TENANT#, so it can't collide. Sort keys match the usage
+// counters'. Each tenant's counters are under tenantSpendPK.
+const globalSpendPK = "SPEND"
+
+// Spend is stored in whole micro-dollars so DynamoDB's ADD stays exact
+const microsPerUSD = 1e6
+
+// SpendBudgetExceeded says which monthly budget a request ran into
+type SpendBudgetExceeded struct {
+	Scope    string // principal (BUDGET_MONTHLY_USD), tenant (BUDGET_TENANT_MONTHLY_USD) or global (BUDGET_GLOBAL_MONTHLY_USD)
+	LimitUSD float64
+	SpentUSD float64
+	ResetAt  time.Time
+}
+
+func (e *SpendBudgetExceeded) Error() string {
+	return fmt.Sprintf("%s monthly budget of $%.2f used up ($%.2f spent), resets at %s",
+		e.Scope, e.LimitUSD, e.SpentUSD, e.ResetAt.Format(time.RFC3339))
+}
+
+// spendMicros converts a call's usage on a model to micro-dollars, rounding up
+func spendMicros(model string, usage Usage) int64 {
+	return int64(math.Ceil(modelPrice(model).cost(usage) * microsPerUSD))
+}
+
+// checkSpendBudget compares this month's estimated spend with the principal's
+// (BUDGET_MONTHLY_USD), its tenant's (BUDGET_TENANT_MONTHLY_USD) and the deployment's
+// (BUDGET_GLOBAL_MONTHLY_USD) budgets, 0 = none
+func checkSpendBudget(ctx context.Context, principal string, now time.Time) (*SpendBudgetExceeded, error) {
+	if historyTableName == "" {
+		return nil, nil
+	}
+	month := usageWindows(QuotaLimits{}, now)[1]
+	// Principals without a tenant have no tenant budget
+	tenant, _ := splitPrincipal(principal)
+	tenantLimit := 0.0
+	if tenant != "" {
+		tenantLimit = usdEnv("BUDGET_TENANT_MONTHLY_USD", 0)
+	}
+	budgets := []struct {
+		scope string
+		limit float64
+		pk    string
+	}{
+		{"principal", usdEnv("BUDGET_MONTHLY_USD", 0), historyPK(principal)},
+		{"tenant", tenantLimit, tenantSpendPK(tenant)},
+		{"global", usdEnv("BUDGET_GLOBAL_MONTHLY_USD", 0), globalSpendPK},
+	}
+	for _, b := range budgets {
+		if b.limit == 0 {
+			continue
+		}
+		spent, err := monthlySpend(ctx, b.pk, month.SK)
+		if err != nil {
+			return nil, err
+		}
+		if spent >= b.limit {
+			return &SpendBudgetExceeded{Scope: b.scope, LimitUSD: b.limit, SpentUSD: spent, ResetAt: month.ResetAt}, nil
+		}
+	}
+	return nil, nil
+}
+
+// monthlySpend reads a spend counter, in USD
+func monthlySpend(ctx context.Context, pk, sk string) (float64, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: pk},
+			"sk": &types.AttributeValueMemberS{Value: sk},
+		},
+		ProjectionExpression: aws.String("spendMicros"),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	n, ok := out.Item["spendMicros"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, nil
+	}
+	micros, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid spendMicros %q: %w", n.Value, err)
+	}
+	return float64(micros) / microsPerUSD, nil
+}
+
+// applySpendBudget enforces the monthly budgets before a request spends anything. Over
+// budget, the request is degraded to BUDGET_FALLBACK_MODEL_ID (with extended thinking
+// off) when one is configured, and refused otherwise. Storage errors fail open.
+func applySpendBudget(ctx context.Context, req *Req, principal string, now time.Time) *apierror.Error {
+	exceeded, err := checkSpendBudget(ctx, principal, now)
+	if err != nil {
+		log.Printf("Budget check failed, allowing request: %v", err)
+		return nil
+	}
+	if exceeded == nil {
+		return nil
+	}
+	if fallback := os.Getenv("BUDGET_FALLBACK_MODEL_ID"); fallback != "" {
+		log.Printf("Degrading request for principal %s to %s: %v", principal, fallback, exceeded)
+		req.model = fallback
+		req.ThinkingTokens = 0
+		req.warnings = append(req.warnings, fmt.Sprintf("%s monthly budget reached; answered by the fallback model", exceeded.Scope))
+		return nil
+	}
+	log.Printf("Refusing request for principal %s: %v", principal, exceeded)
+	return apierror.Newf(429, apierror.CodeBudgetExceeded, "Monthly %s spend budget exceeded", exceeded.Scope).
+		WithReason("budget_"+exceeded.Scope).
+		WithDetail("limitUsd", exceeded.LimitUSD).
+		WithDetail("resetAt", exceeded.ResetAt.Format(time.RFC3339)).
+		WithRetryAfter(time.Until(exceeded.ResetAt))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCheckSpendBudget(t *testing.T) {
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	db := &fakeDynamo{items: []map[string]interface{}{
+		{"pk": historyPK("user-123"), "sk": "USAGE#M#2025-03", "spendMicros": 4200000},
+		{"pk": globalSpendPK, "sk": "USAGE#M#2025-03", "spendMicros": 90000000},
+	}}
+	useFakeDynamo(t, db)
+	ctx := context.Background()
+
+	if exceeded, err := checkSpendBudget(ctx, "user-123", now); err != nil || exceeded != nil {
+		t.Errorf("no budgets: got %+v, %v", exceeded, err)
+	}
+
+	t.Setenv("BUDGET_MONTHLY_USD", "5")
+	if exceeded, _ := checkSpendBudget(ctx, "user-123", now); exceeded != nil {
+		t.Errorf("under budget: got %+v", exceeded)
+	}
+	t.Setenv("BUDGET_MONTHLY_USD", "4")
+	exceeded, _ := checkSpendBudget(ctx, "user-123", now)
+	if exceeded == nil || exceeded.Scope != "principal" || exceeded.SpentUSD != 4.2 || !exceeded.ResetAt.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("over principal budget: got %+v", exceeded)
+	}
+	if exceeded, _ := checkSpendBudget(ctx, "user-456", now); exceeded != nil {
+		t.Errorf("other principal: got %+v", exceeded)
+	}
+
+	t.Setenv("BUDGET_GLOBAL_MONTHLY_USD", "90")
+	if exceeded, _ := checkSpendBudget(ctx, "user-456", now); exceeded == nil || exceeded.Scope != "global" {
+		t.Errorf("over global budget: got %+v", exceeded)
+	}
+}
+
+func TestCheckSpendBudget_Tenant(t *testing.T) {
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	useFakeDynamo(t, &fakeDynamo{items: []map[string]interface{}{
+		{"pk": tenantSpendPK("smith-family"), "sk": "USAGE#M#2025-03", "spendMicros": 12000000},
+	}})
+	t.Setenv("BUDGET_TENANT_MONTHLY_USD", "10")
+	ctx := context.Background()
+
+	exceeded, _ := checkSpendBudget(ctx, "smith-family/user-123", now)
+	if exceeded == nil || exceeded.Scope != "tenant" || exceeded.SpentUSD != 12 {
+		t.Errorf("over tenant budget: got %+v", exceeded)
+	}
+	if exceeded, _ := checkSpendBudget(ctx, "jones/user-123", now); exceeded != nil {
+		t.Errorf("other tenant: got %+v", exceeded)
+	}
+	if exceeded, _ := checkSpendBudget(ctx, "user-123", now); exceeded != nil {
+		t.Errorf("no tenant: got %+v", exceeded)
+	}
+}
+
+func TestHandler_SpendBudget(t *testing.T) {
+	useSinks(t, &stubSink{name: "ok"})
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["ok"]}`)
+	t.Setenv("BUDGET_MONTHLY_USD", "1")
+	month := usageWindows(QuotaLimits{}, time.Now())[1].SK
+	useFakeDynamo(t, &fakeDynamo{items: []map[string]interface{}{
+		{"pk": historyPK("user-123"), "sk": month, "spendMicros": 1500000},
+	}})
+	model := &fakeBedrock{text: `{"action":"note","title":"Tides","markdown":"Tides","shortText":"Tides"}`}
+	useFakeBedrock(t, model)
+	call := func() (events.APIGatewayProxyResponse, map[string]interface{}) {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: `{"text":"note about tides","mode":"note","thinkingTokens":1024}`}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-123"}
+		resp, _ := handler(context.Background(), event)
+		var body map[string]interface{}
+		json.Unmarshal([]byte(resp.Body), &body)
+		return resp, body
+	}
+
+	resp, body := call()
+	if resp.StatusCode != 429 || model.calls != 0 {
+		t.Fatalf("no fallback: got %d after %d calls: %s", resp.StatusCode, model.calls, resp.Body)
+	}
+	if apiErr := body["error"].(map[string]interface{}); apiErr["code"] != "BUDGET_EXCEEDED" || resp.Headers["Retry-After"] == "" {
+		t.Errorf("no fallback: got %s, headers %v", resp.Body, resp.Headers)
+	}
+
+	t.Setenv("BUDGET_FALLBACK_MODEL_ID", "anthropic.claude-3-haiku-20240307-v1:0")
+	resp, body = call()
+	if resp.StatusCode != 200 || model.model != "anthropic.claude-3-haiku-20240307-v1:0" {
+		t.Fatalf("fallback: got %d from %q: %s", resp.StatusCode, model.model, resp.Body)
+	}
+	if warnings, _ := body["warnings"].([]interface{}); len(warnings) != 1 {
+		t.Errorf("fallback: warnings = %v", body["warnings"])
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callbacks get a short timeout so a slow receiver can't hold the watch request open
+const callbackTimeout = 5 * time.Second
+
+var callbackHTTPClient = &http.Client{
+	Timeout: callbackTimeout,
+	// Don't follow redirects - they could bypass the host allowlist
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// validateCallbackURL requires an https URL whose host matches CALLBACK_ALLOWED_HOSTS
+// (comma-separated hostnames; "*.example.com" matches subdomains). With no allowlist
+// configured, callbacks are disabled.
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("callbackUrl must be an absolute URL")
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("callbackUrl must use https")
+	}
+	if u.User != nil {
+		return fmt.Errorf("callbackUrl must not contain credentials")
+	}
+
+	allowlist := os.Getenv("CALLBACK_ALLOWED_HOSTS")
+	if allowlist == "" {
+		return fmt.Errorf("callbacks are not enabled")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+		} else if host == entry {
+			return nil
+		}
+	}
+	return fmt.Errorf("callbackUrl host %s is not allowed", host)
+}
+
+// signPayload computes the hex HMAC-SHA256 of "<timestamp>.<body>"
+func signPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverCallback POSTs the final response to the request's callbackUrl, signed with
+// X-Wrist-Timestamp and X-Wrist-Signature (sha256=<hex HMAC of "<timestamp>.<body>">)
+// using the secret in CALLBACK_SECRET_PARAM_NAME.
+func deliverCallback(ctx context.Context, callbackURL string, resp Response) DeliveryResult {
+	result := DeliveryResult{Sink: "callback"}
+
+	secretParam := os.Getenv("CALLBACK_SECRET_PARAM_NAME")
+	if secretParam == "" {
+		result.Error = "callback signing secret not configured"
+		return result
+	}
+	secret, err := getParameter(ctx, secretParam)
+	if err != nil {
+		log.Printf("Failed to load callback secret: %v", err)
+		result.Error = "callback signing secret unavailable"
+		return result
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		result.Error = "failed to marshal callback payload"
+		return result
+	}
+
+	callbackCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(callbackCtx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = "failed to build callback request"
+		return result
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(timestampHeader, timestamp)
+	httpReq.Header.Set(signatureHeader, "sha256="+signPayload([]byte(secret), timestamp, body))
+
+	httpResp, err := callbackHTTPClient.Do(httpReq)
+	if err != nil {
+		log.Printf("Callback delivery failed: %v", err)
+		result.Error = "callback request failed"
+		return result
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("callback returned status %d", httpResp.StatusCode)
+		return result
+	}
+	result.OK = true
+	return result
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Default smallest body worth compressing (overridable via COMPRESSION_MIN_BYTES, 0 = off)
+const defaultCompressionMinBytes = 1024
+
+// Brotli quality: 5 is close to gzip's speed with noticeably smaller output for text
+const brotliQuality = 5
+
+// negotiateEncoding picks "br" or "gzip" from an Accept-Encoding header, honoring
+// q-values and preferring br on ties; "" means send the body uncompressed
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch name {
+		case "br", "gzip":
+		case "*":
+			name = "br"
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && q > 0 && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	if bestQ <= 0 {
+		return ""
+	}
+	return best
+}
+
+// compressBody encodes body with the given encoding
+func compressBody(body []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "br":
+		w = brotli.NewWriterLevel(&buf, brotliQuality)
+	default:
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressResponse compresses resp in place when the client accepts it and the body is
+// large enough. The proxy integration carries binary bodies base64-encoded with
+// isBase64Encoded set; API Gateway (binaryMediaTypes */*) decodes them on the way out.
+func compressResponse(event events.APIGatewayProxyRequest, resp *events.APIGatewayProxyResponse) {
+	minBytes := limitEnv("COMPRESSION_MIN_BYTES", defaultCompressionMinBytes, 0)
+	if minBytes == 0 || resp.IsBase64Encoded || len(resp.Body) < minBytes {
+		return
+	}
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	// The body varies by Accept-Encoding once it's above the threshold, whatever this client sent
+	addVary(resp.Headers, "Accept-Encoding")
+
+	encoding := negotiateEncoding(requestHeader(event, "Accept-Encoding"))
+	if encoding == "" || resp.Headers["Content-Encoding"] != "" {
+		return
+	}
+
+	compressed, err := compressBody([]byte(resp.Body), encoding)
+	if err != nil {
+		log.Printf("Failed to %s response, sending uncompressed: %v", encoding, err)
+		return
+	}
+	if len(compressed) >= len(resp.Body) {
+		return
+	}
+
+	resp.Body = base64.StdEncoding.EncodeToString(compressed)
+	resp.IsBase64Encoded = true
+	resp.Headers["Content-Encoding"] = encoding
+}
+
+// decodeRequestBody undoes the base64 encoding API Gateway applies to request bodies
+// when binaryMediaTypes matches them
+func decodeRequestBody(event *events.APIGatewayProxyRequest) error {
+	if !event.IsBase64Encoded {
+		return nil
+	}
+	body, err := base64.StdEncoding.DecodeString(event.Body)
+	if err != nil {
+		return err
+	}
+	event.Body = string(body)
+	event.IsBase64Encoded = false
+	return nil
+}
+
+// addVary appends value to the Vary header unless it's already listed
+func addVary(headers map[string]string, value string) {
+	existing := headers["Vary"]
+	for _, v := range strings.Split(existing, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return
+		}
+	}
+	if existing == "" {
+		headers["Vary"] = value
+	} else {
+		headers["Vary"] = existing + ", " + value
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"gzip only", "gzip", "gzip"},
+		{"prefers br on tie", "gzip, deflate, br", "br"},
+		{"honors q-values", "br;q=0.5, gzip;q=0.9", "gzip"},
+		{"excluded with q=0", "br;q=0, gzip;q=0", ""},
+		{"wildcard", "*", "br"},
+		{"unsupported only", "deflate, identity", ""},
+		{"case insensitive", "GZIP", "gzip"},
+		{"malformed q skipped", "br;q=abc, gzip", "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// decompress reverses compressResponse for assertions
+func decompress(t *testing.T, resp events.APIGatewayProxyResponse) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		t.Fatalf("Body is not base64: %v", err)
+	}
+	var r io.Reader
+	switch resp.Headers["Content-Encoding"] {
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(raw))
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("gzip.NewReader failed: %v", err)
+		}
+		r = gz
+	default:
+		t.Fatalf("Unexpected Content-Encoding %q", resp.Headers["Content-Encoding"])
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	return string(out)
+}
+
+func TestCompressResponse(t *testing.T) {
+	large := `{"markdown":"` + strings.Repeat("research findings ", 200) + `"}`
+
+	tests := []struct {
+		name           string
+		accept         string
+		body           string
+		minBytes       string
+		wantEncoding   string
+		wantCompressed bool
+	}{
+		{"brotli", "gzip, br", large, "", "br", true},
+		{"gzip", "gzip", large, "", "gzip", true},
+		{"no accept-encoding", "", large, "", "", false},
+		{"small body", "br", `{"ok":true}`, "", "", false},
+		{"disabled", "br", large, "0", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COMPRESSION_MIN_BYTES", tt.minBytes)
+			event := events.APIGatewayProxyRequest{Headers: map[string]string{"Accept-Encoding": tt.accept}}
+			resp := events.APIGatewayProxyResponse{
+				StatusCode: 200,
+				Headers:    map[string]string{"Content-Type": "application/json", "Vary": "Origin"},
+				Body:       tt.body,
+			}
+
+			compressResponse(event, &resp)
+
+			if resp.IsBase64Encoded != tt.wantCompressed {
+				t.Fatalf("IsBase64Encoded = %v, want %v", resp.IsBase64Encoded, tt.wantCompressed)
+			}
+			if resp.Headers["Content-Encoding"] != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", resp.Headers["Content-Encoding"], tt.wantEncoding)
+			}
+			if !tt.wantCompressed {
+				if resp.Body != tt.body {
+					t.Error("Uncompressed body should be unchanged")
+				}
+				return
+			}
+			if got := decompress(t, resp); got != tt.body {
+				t.Error("Decompressed body does not match original")
+			}
+			if resp.Headers["Vary"] != "Origin, Accept-Encoding" {
+				t.Errorf("Vary = %q, want Origin, Accept-Encoding", resp.Headers["Vary"])
+			}
+		})
+	}
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	event := events.APIGatewayProxyRequest{
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"text":"hi"}`)),
+		IsBase64Encoded: true,
+	}
+	if err := decodeRequestBody(&event); err != nil {
+		t.Fatalf("decodeRequestBody() error = %v", err)
+	}
+	if event.Body != `{"text":"hi"}` || event.IsBase64Encoded {
+		t.Errorf("decoded event = %q (base64 %v)", event.Body, event.IsBase64Encoded)
+	}
+
+	bad := events.APIGatewayProxyRequest{Body: "not base64!", IsBase64Encoded: true}
+	if err := decodeRequestBody(&bad); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+}
+
+func TestHandler_Base64RequestBody(t *testing.T) {
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:      "POST",
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"text":""}`)),
+		IsBase64Encoded: true,
+	})
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	// The decoded body reaches validation (empty text), proving it was parsed as JSON
+	if resp.StatusCode != 400 || !strings.Contains(resp.Body, "text field is required") {
+		t.Errorf("Expected validation error for decoded body, got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	headers := map[string]string{}
+	addVary(headers, "Origin")
+	addVary(headers, "Accept-Encoding")
+	addVary(headers, "origin")
+	if headers["Vary"] != "Origin, Accept-Encoding" {
+		t.Errorf("Vary = %q", headers["Vary"])
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Partition key prefix of the shared concurrency slots in the history table, one
+// partition per model; principals' items all start with USER# or TENANT#, so they
+// can't collide
+const concurrencyPKPrefix = "CONCURRENCY#"
+
+// Bedrock concurrency gate defaults (BEDROCK_MAX_CONCURRENCY* env vars turn it on)
+const (
+	defaultBedrockConcurrencyWaitMs = 2000
+	concurrencyRetryInterval        = 100 * time.Millisecond
+	// A slot held by an invocation that died without releasing it is reclaimed after
+	// this long, or at the holder's deadline when it has one
+	concurrencyLeaseDuration = 5 * time.Minute
+)
+
+// ConcurrencyLimitError is returned instead of calling Bedrock when every slot stayed
+// taken for the whole BEDROCK_CONCURRENCY_WAIT_MS
+type ConcurrencyLimitError struct {
+	Limit  int
+	Scope  string // instance (in-process gate) or account (shared DynamoDB gate)
+	Waited time.Duration
+}
+
+func (e *ConcurrencyLimitError) Error() string {
+	return fmt.Sprintf("bedrock %s concurrency limit of %d reached after waiting %s", e.Scope, e.Limit, e.Waited.Round(time.Millisecond))
+}
+
+// localGates are the in-process semaphores, one per model
+var localGates = struct {
+	mu    sync.Mutex
+	gates map[string]chan struct{}
+}{gates: map[string]chan struct{}{}}
+
+// localGate returns the model's semaphore, replacing it if the limit changed
+func localGate(model string, limit int) chan struct{} {
+	localGates.mu.Lock()
+	defer localGates.mu.Unlock()
+	gate, ok := localGates.gates[model]
+	if !ok || cap(gate) != limit {
+		gate = make(chan struct{}, limit)
+		localGates.gates[model] = gate
+	}
+	return gate
+}
+
+// acquireBedrockSlot waits for a free InvokeModel slot for the model, first in this
+// process (BEDROCK_MAX_CONCURRENCY_PER_INSTANCE) and then across every instance
+// (BEDROCK_MAX_CONCURRENCY, coordinated through the history table). Requests queue for up
+// to BEDROCK_CONCURRENCY_WAIT_MS and are then shed with a ConcurrencyLimitError. The
+// returned release must be called once the call is done. Storage errors fail open.
+func acquireBedrockSlot(ctx context.Context, model string) (release func(), err error) {
+	start := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(limitEnv("BEDROCK_CONCURRENCY_WAIT_MS", defaultBedrockConcurrencyWaitMs, 0))*time.Millisecond)
+	defer cancel()
+	release = func() {}
+
+	if limit := limitEnv("BEDROCK_MAX_CONCURRENCY_PER_INSTANCE", 0, 0); limit > 0 {
+		gate := localGate(model, limit)
+		select {
+		case gate <- struct{}{}:
+			release = func() { <-gate }
+		case <-waitCtx.Done():
+			return nil, &ConcurrencyLimitError{Limit: limit, Scope: "instance", Waited: time.Since(start)}
+		}
+	}
+
+	limit := limitEnv("BEDROCK_MAX_CONCURRENCY", 0, 0)
+	if limit == 0 || historyTableName == "" {
+		return release, nil
+	}
+	holder := newCaptureID()
+	for {
+		slot, err := claimConcurrencySlot(ctx, model, holder, limit, time.Now())
+		if err != nil {
+			log.Printf("Concurrency gate unavailable, calling Bedrock anyway: %v", err)
+			return release, nil
+		}
+		if slot >= 0 {
+			releaseLocal := release
+			return func() {
+				releaseConcurrencySlot(context.WithoutCancel(ctx), model, slot, holder)
+				releaseLocal()
+			}, nil
+		}
+		select {
+		case <-time.After(concurrencyRetryInterval):
+		case <-waitCtx.Done():
+			release()
+			return nil, &ConcurrencyLimitError{Limit: limit, Scope: "account", Waited: time.Since(start)}
+		}
+	}
+}
+
+// claimConcurrencySlot tries each of the model's slots once, starting at a random one so
+// instances don't all contend for slot 0, and returns the slot taken or -1 when all are
+// held. A slot is free when it has no holder or its holder's lease has run out.
+func claimConcurrencySlot(ctx context.Context, model, holder string, limit int, now time.Time) (int, error) {
+	lease := now.Add(concurrencyLeaseDuration)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(lease) {
+		lease = deadline
+	}
+	first := rand.Intn(limit)
+	for i := 0; i < limit; i++ {
+		slot := (first + i) % limit
+		_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(historyTableName),
+			Key:                 concurrencySlotKey(model, slot),
+			UpdateExpression:    aws.String("SET holder = :holder, leaseUntil = :lease, expiresAt = :lease"),
+			ConditionExpression: aws.String("attribute_not_exists(holder) OR leaseUntil < :now"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":holder": &types.AttributeValueMemberS{Value: holder},
+				":lease":  &types.AttributeValueMemberN{Value: strconv.FormatInt(lease.Unix(), 10)},
+				":now":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			continue
+		}
+		if err != nil {
+			return -1, fmt.Errorf("DynamoDB UpdateItem failed: %w", err)
+		}
+		return slot, nil
+	}
+	return -1, nil
+}
+
+// releaseConcurrencySlot frees a slot if this invocation still holds it. Errors are
+// logged; the lease frees the slot eventually.
+func releaseConcurrencySlot(ctx context.Context, model string, slot int, holder string) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(historyTableName),
+		Key:                 concurrencySlotKey(model, slot),
+		UpdateExpression:    aws.String("REMOVE holder, leaseUntil"),
+		ConditionExpression: aws.String("holder = :holder"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":holder": &types.AttributeValueMemberS{Value: holder},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionErr) {
+		log.Printf("Failed to release Bedrock concurrency slot %d: %v", slot, err)
+	}
+}
+
+// concurrencySlotKey is the history table key of one of a model's slots
+func concurrencySlotKey(model string, slot int) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: concurrencyPKPrefix + model},
+		"sk": &types.AttributeValueMemberS{Value: "SLOT#" + strconv.Itoa(slot)},
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// slotDynamo evaluates the concurrency gate's conditional slot updates
+type slotDynamo struct {
+	fakeDynamo
+	mu      sync.Mutex
+	holders map[string]string
+}
+
+func (f *slotDynamo) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var key map[string]string
+	attributevalue.UnmarshalMap(params.Key, &key)
+	holder := params.ExpressionAttributeValues[":holder"].(*types.AttributeValueMemberS).Value
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	slot := key["pk"] + "/" + key["sk"]
+	if strings.HasPrefix(aws.ToString(params.UpdateExpression), "REMOVE") {
+		if f.holders[slot] != holder {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		delete(f.holders, slot)
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	if f.holders[slot] != "" {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	f.holders[slot] = holder
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestAcquireBedrockSlot_Instance(t *testing.T) {
+	t.Setenv("BEDROCK_MAX_CONCURRENCY_PER_INSTANCE", "1")
+	t.Setenv("BEDROCK_CONCURRENCY_WAIT_MS", "20")
+	ctx := context.Background()
+
+	release, err := acquireBedrockSlot(ctx, "instance-model")
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	var limitErr *ConcurrencyLimitError
+	if _, err := acquireBedrockSlot(ctx, "instance-model"); !errors.As(err, &limitErr) || limitErr.Scope != "instance" {
+		t.Fatalf("second call: err = %v, want instance ConcurrencyLimitError", err)
+	}
+	release()
+	if release, err := acquireBedrockSlot(ctx, "instance-model"); err != nil {
+		t.Errorf("after release: %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestAcquireBedrockSlot_Account(t *testing.T) {
+	db := &slotDynamo{holders: map[string]string{}}
+	origClient, origTable := dynamoClient, historyTableName
+	dynamoClient, historyTableName = db, "history"
+	t.Cleanup(func() { dynamoClient, historyTableName = origClient, origTable })
+	t.Setenv("BEDROCK_MAX_CONCURRENCY", "2")
+	t.Setenv("BEDROCK_CONCURRENCY_WAIT_MS", "150")
+	ctx := context.Background()
+
+	first, err := acquireBedrockSlot(ctx, "shared-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := acquireBedrockSlot(ctx, "shared-model")
+	if err != nil || len(db.holders) != 2 {
+		t.Fatalf("second call: err = %v, holders = %v", err, db.holders)
+	}
+	var limitErr *ConcurrencyLimitError
+	if _, err := acquireBedrockSlot(ctx, "shared-model"); !errors.As(err, &limitErr) || limitErr.Scope != "account" || limitErr.Limit != 2 {
+		t.Fatalf("third call: err = %v, want account ConcurrencyLimitError", err)
+	}
+
+	first()
+	if len(db.holders) != 1 {
+		t.Errorf("holders after release = %v", db.holders)
+	}
+	third, err := acquireBedrockSlot(ctx, "shared-model")
+	if err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	second()
+	third()
+
+	// An unreachable table fails open rather than blocking every request
+	db.err = errors.New("dynamo down")
+	if release, err := acquireBedrockSlot(ctx, "shared-model"); err != nil {
+		t.Errorf("storage error: %v", err)
+	} else {
+		release()
+	}
+}
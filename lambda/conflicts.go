@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+// Upper bound on stored events read when checking for conflicts
+const maxConflictCandidates = 1000
+
+// Conflict is a stored event overlapping a newly created one
+type Conflict struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	StartISO string  `json:"startISO"`
+	EndISO   *string `json:"endISO,omitempty"`
+}
+
+// findConflicts returns the stored events whose window overlaps resp's, earliest first.
+// Events touching end-to-start (a 9:00-10:00 and a 10:00-11:00) don't conflict; a
+// missing end counts as defaultEventDuration, as in the .ics attachment.
+func findConflicts(resp Response, stored []HistoryItem, selfID string) []Conflict {
+	start, end, err := eventWindow(resp)
+	if err != nil {
+		return nil
+	}
+
+	var conflicts []Conflict
+	for _, item := range stored {
+		if item.ID == selfID {
+			continue
+		}
+		otherStart, otherEnd, err := eventWindow(Response{StartISO: item.StartISO, EndISO: item.EndISO})
+		if err != nil || !otherStart.Before(end) || !start.Before(otherEnd) {
+			continue
+		}
+		conflicts = append(conflicts, Conflict{ID: item.ID, Title: item.Title, StartISO: *item.StartISO, EndISO: item.EndISO})
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		a, _, _ := eventWindow(Response{StartISO: &conflicts[i].StartISO})
+		b, _, _ := eventWindow(Response{StartISO: &conflicts[j].StartISO})
+		return a.Before(b)
+	})
+	return conflicts
+}
+
+// attachConflicts warns about stored events overlapping a new event. Storage errors are
+// logged and skipped - the warning is advisory and never blocks the capture.
+func attachConflicts(ctx context.Context, meta captureMeta, resp *Response) {
+	if historyTableName == "" {
+		return
+	}
+	stored, err := loadCapturesByAction(ctx, meta.Principal, "event", maxConflictCandidates)
+	if err != nil {
+		log.Printf("Failed to load stored events, skipping conflict check: %v", err)
+		return
+	}
+	resp.Conflicts = findConflicts(*resp, stored, meta.ID)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func storedEvent(id, title, start string, end *string) HistoryItem {
+	return newHistoryItem(captureMeta{ID: id, Principal: "user-1", CreatedAt: time.Now()}, Response{Action: "event", Title: title, StartISO: &start, EndISO: end})
+}
+
+func TestFindConflicts(t *testing.T) {
+	end := func(s string) *string { return &s }
+	stored := []HistoryItem{
+		storedEvent("later", "Lunch", "2025-01-15T12:30:00Z", end("2025-01-15T13:30:00Z")),
+		storedEvent("overlap", "Standup", "2025-01-15T09:30:00Z", nil), // defaults to an hour
+		storedEvent("adjacent", "Gym", "2025-01-15T08:00:00Z", end("2025-01-15T09:00:00Z")),
+		storedEvent("around", "Offsite", "2025-01-15T08:00:00Z", end("2025-01-15T18:00:00Z")),
+		storedEvent("self", "Dentist", "2025-01-15T09:00:00Z", end("2025-01-15T10:00:00Z")),
+		storedEvent("broken", "Broken", "someday", nil),
+	}
+	start := "2025-01-15T09:00:00Z"
+	resp := Response{Action: "event", StartISO: &start, EndISO: end("2025-01-15T10:00:00Z")}
+
+	conflicts := findConflicts(resp, stored, "self")
+	var ids []string
+	for _, c := range conflicts {
+		ids = append(ids, c.ID)
+	}
+	if len(ids) != 2 || ids[0] != "around" || ids[1] != "overlap" {
+		t.Errorf("conflicts = %v, want [around overlap]", ids)
+	}
+
+	if got := findConflicts(Response{Action: "event"}, stored, ""); got != nil {
+		t.Errorf("event without a start: conflicts = %v", got)
+	}
+}
+
+func TestAttachConflicts(t *testing.T) {
+	ctx := context.Background()
+	start := "2025-01-15T09:00:00Z"
+	meta := captureMeta{ID: "new", Principal: "user-1"}
+
+	t.Run("not configured", func(t *testing.T) {
+		resp := Response{Action: "event", StartISO: &start}
+		attachConflicts(ctx, meta, &resp)
+		if resp.Conflicts != nil {
+			t.Errorf("Conflicts = %v", resp.Conflicts)
+		}
+	})
+
+	t.Run("stored events", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		saveCapture(ctx, storedEvent("standup", "Standup", "2025-01-15T09:30:00Z", nil))
+		saveCapture(ctx, newHistoryItem(captureMeta{ID: "reminder", Principal: "user-1"}, Response{Action: "reminder", Title: "Call", DueISO: &start}))
+		other := storedEvent("theirs", "Theirs", start, nil)
+		other.PK = historyPK("user-2")
+		saveCapture(ctx, other)
+
+		resp := Response{Action: "event", StartISO: &start}
+		attachConflicts(ctx, meta, &resp)
+		if len(resp.Conflicts) != 1 || resp.Conflicts[0].Title != "Standup" || resp.Conflicts[0].StartISO != "2025-01-15T09:30:00Z" {
+			t.Errorf("Conflicts = %+v", resp.Conflicts)
+		}
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{err: errors.New("throttled")})
+		resp := Response{Action: "event", StartISO: &start}
+		attachConflicts(ctx, meta, &resp)
+		if resp.Conflicts != nil {
+			t.Errorf("Conflicts = %v", resp.Conflicts)
+		}
+	})
+}
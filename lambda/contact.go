@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/mail"
+	"strings"
+	"unicode"
+)
+
+// Phone numbers outside this many digits are more likely mishearings than numbers (E.164 allows 15)
+const (
+	minPhoneDigits = 7
+	maxPhoneDigits = 15
+)
+
+// Contact is the person extracted in contact mode, with a vCard ready to import into Contacts
+type Contact struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Company string `json:"company,omitempty"`
+	VCard   string `json:"vcard"` // vCard 3.0 with CRLF line endings
+}
+
+// finalizeContact validates the model's contact fields and builds the vCard. Values
+// that don't parse are dropped rather than written into the card.
+func finalizeContact(resp *Response) {
+	if resp.Contact == nil {
+		resp.Contact = &Contact{}
+	}
+	resp.Action = "contact"
+
+	contact := resp.Contact
+	contact.Name = strings.Join(strings.Fields(contact.Name), " ")
+	if contact.Name == "" {
+		contact.Name = strings.TrimSpace(resp.Title)
+	}
+	contact.Company = strings.Join(strings.Fields(contact.Company), " ")
+	contact.Phone = normalizePhone(contact.Phone)
+	contact.Email = normalizeContactEmail(contact.Email)
+	contact.VCard = buildVCard(*contact)
+}
+
+// normalizePhone keeps the digits of a number (and a leading +), returning "" when the
+// digit count can't be a phone number
+func normalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	var b strings.Builder
+	if strings.HasPrefix(phone, "+") {
+		b.WriteByte('+')
+	}
+	digits := 0
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			digits++
+		} else if unicode.IsLetter(r) {
+			// Extensions and vanity numbers aren't worth guessing at
+			return ""
+		}
+	}
+	if digits < minPhoneDigits || digits > maxPhoneDigits {
+		return ""
+	}
+	return b.String()
+}
+
+// normalizeContactEmail returns the bare address, or "" when it doesn't parse
+func normalizeContactEmail(address string) string {
+	addr, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil {
+		return ""
+	}
+	return addr.Address
+}
+
+// buildVCard renders a contact as a vCard 3.0 (RFC 2426), the version Apple Contacts
+// and most phones import without prompting. Text escaping and line folding are the
+// same as iCalendar's.
+func buildVCard(contact Contact) string {
+	lines := icalLines{"BEGIN:VCARD", "VERSION:3.0"}
+	lines.add("N", vcardName(contact.Name))
+	lines.add("FN", icalEscape(contact.Name))
+	lines.addText("ORG", contact.Company)
+	if contact.Phone != "" {
+		lines.add("TEL;TYPE=CELL", contact.Phone)
+	}
+	if contact.Email != "" {
+		lines.add("EMAIL;TYPE=INTERNET", icalEscape(contact.Email))
+	}
+	lines = append(lines, "END:VCARD")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// vcardName builds the structured N value (family;given;additional;prefix;suffix),
+// treating the last word as the family name. A single name is the given name.
+func vcardName(name string) string {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return ";;;;"
+	}
+	if len(words) == 1 {
+		return ";" + icalEscape(words[0]) + ";;;"
+	}
+	family := words[len(words)-1]
+	given := strings.Join(words[:len(words)-1], " ")
+	return icalEscape(family) + ";" + icalEscape(given) + ";;;"
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := map[string]string{
+		"+1 (555) 010-2030": "+15550102030",
+		"555.010.2030":      "5550102030",
+		"555 0102":          "5550102",
+		"12345":             "",
+		"1-800-FLOWERS":     "",
+		"":                  "",
+	}
+	for in, want := range tests {
+		if got := normalizePhone(in); got != want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFinalizeContact(t *testing.T) {
+	resp := Response{Action: "note", Title: "Jane", Contact: &Contact{
+		Name:    " Jane  van Appleseed ",
+		Phone:   "+1 555 010 2030",
+		Email:   "Jane <jane@example.com>",
+		Company: "Acme, Inc.",
+	}}
+	finalizeContact(&resp)
+
+	contact := resp.Contact
+	if resp.Action != "contact" || contact.Name != "Jane van Appleseed" || contact.Phone != "+15550102030" || contact.Email != "jane@example.com" {
+		t.Errorf("got action %q, contact %+v", resp.Action, contact)
+	}
+	want := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Appleseed;Jane van;;;\r\nFN:Jane van Appleseed\r\nORG:Acme\\, Inc.\r\n" +
+		"TEL;TYPE=CELL:+15550102030\r\nEMAIL;TYPE=INTERNET:jane@example.com\r\nEND:VCARD\r\n"
+	if contact.VCard != want {
+		t.Errorf("VCard = %q, want %q", contact.VCard, want)
+	}
+
+	t.Run("invalid fields are dropped", func(t *testing.T) {
+		resp := Response{Title: "Bob", Contact: &Contact{Phone: "five five five", Email: "bob at example"}}
+		finalizeContact(&resp)
+		if resp.Contact.Name != "Bob" || resp.Contact.Phone != "" || resp.Contact.Email != "" {
+			t.Errorf("contact = %+v", resp.Contact)
+		}
+		if strings.Contains(resp.Contact.VCard, "TEL") || strings.Contains(resp.Contact.VCard, "EMAIL") || !strings.Contains(resp.Contact.VCard, "N:;Bob;;;\r\n") {
+			t.Errorf("VCard = %q", resp.Contact.VCard)
+		}
+	})
+
+	t.Run("missing contact object", func(t *testing.T) {
+		resp := Response{Title: "Dr. Lee"}
+		finalizeContact(&resp)
+		if resp.Contact == nil || resp.Contact.Name != "Dr. Lee" || resp.Contact.VCard == "" {
+			t.Errorf("contact = %+v", resp.Contact)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Sort key prefix of conversation records in the history table
+const conversationSKPrefix = "CONVERSATION#"
+
+// Conversation size bounds: once more than maxConversationTurns are stored, all but the
+// last conversationKeepTurns are folded into the rolling summary, so the prompt stays
+// roughly the same size however long the conversation runs
+const (
+	maxConversationTurns         = 8
+	conversationKeepTurns        = 4
+	maxConversationTurnRunes     = 1500
+	maxConversationSummaryRunes  = 4000
+	conversationSummaryMaxTokens = 600
+	defaultConversationTTLDays   = 7
+)
+
+// conversationIDPattern is what callers may use as a conversationId, e.g. a UUID
+var conversationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ConversationTurn is one request and the reply to it
+type ConversationTurn struct {
+	Request string `dynamodbav:"request"`
+	Reply   string `dynamodbav:"reply"`
+	At      string `dynamodbav:"at"`
+}
+
+// Conversation is a principal's running context for follow-up requests: a summary of
+// the older turns plus the most recent ones verbatim
+type Conversation struct {
+	PK         string             `dynamodbav:"pk"`
+	SK         string             `dynamodbav:"sk"`
+	ID         string             `dynamodbav:"id"`
+	Summary    string             `dynamodbav:"summary,omitempty"`
+	Summarized int                `dynamodbav:"summarized,omitempty"` // turns folded into Summary
+	Turns      []ConversationTurn `dynamodbav:"turns"`
+	UpdatedAt  string             `dynamodbav:"updatedAt"`
+	ExpiresAt  int64              `dynamodbav:"expiresAt"`
+}
+
+// validateConversationID checks a request's conversationId, if it has one
+func validateConversationID(req *Req) error {
+	if req.ConversationID != "" && !conversationIDPattern.MatchString(req.ConversationID) {
+		return fmt.Errorf("conversationId must be 1-64 letters, digits, dashes or underscores")
+	}
+	return nil
+}
+
+// conversationTTL reads CONVERSATION_TTL_DAYS, how long an idle conversation is kept
+func conversationTTL() time.Duration {
+	days := defaultConversationTTLDays
+	if env := os.Getenv("CONVERSATION_TTL_DAYS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+			days = n
+		} else {
+			log.Printf("Invalid CONVERSATION_TTL_DAYS value: %s, using default", env)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// loadConversation reads a principal's conversation, returning nil when it doesn't exist
+func loadConversation(ctx context.Context, principal, id string) (*Conversation, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+			"sk": &types.AttributeValueMemberS{Value: conversationSKPrefix + id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	var conv Conversation
+	if err := attributevalue.UnmarshalMap(out.Item, &conv); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal conversation: %w", err)
+	}
+	return &conv, nil
+}
+
+// saveConversation writes a conversation, pushing its expiry CONVERSATION_TTL_DAYS past now
+func saveConversation(ctx context.Context, conv *Conversation, now time.Time) error {
+	conv.UpdatedAt = now.UTC().Format(time.RFC3339)
+	conv.ExpiresAt = now.Add(conversationTTL()).Unix()
+	item, err := attributevalue.MarshalMap(conv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// requestConversation loads the conversation a request continues, or starts one. Storage
+// errors are logged and the request is answered without the earlier turns.
+func requestConversation(ctx context.Context, req *Req, principal string) *Conversation {
+	if req.ConversationID == "" {
+		return nil
+	}
+	if historyTableName == "" {
+		req.warnings = append(req.warnings, "conversationId ignored: history storage is not configured")
+		req.ConversationID = ""
+		return nil
+	}
+	conv, err := loadConversation(ctx, principal, req.ConversationID)
+	if err != nil {
+		log.Printf("Failed to load conversation, continuing without it: %v", err)
+	}
+	if conv == nil {
+		conv = &Conversation{
+			PK:    historyPK(principal),
+			SK:    conversationSKPrefix + req.ConversationID,
+			ID:    req.ConversationID,
+			Turns: []ConversationTurn{},
+		}
+	}
+	return conv
+}
+
+// conversationPrompt is the system prompt section carrying the earlier turns
+func conversationPrompt(conv *Conversation) string {
+	if conv == nil || (conv.Summary == "" && len(conv.Turns) == 0) {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`
+
+Conversation so far:
+This request follows up on earlier ones. Use them to resolve references such as "it", "that one" or "move it to Friday", but respond only to the new request.`)
+	if conv.Summary != "" {
+		b.WriteString("\n\nSummary of earlier turns:\n" + conv.Summary)
+	}
+	if len(conv.Turns) > 0 {
+		b.WriteString("\n\nMost recent turns:")
+		for _, turn := range conv.Turns {
+			b.WriteString("\nUser: " + turn.Request + "\nAssistant: " + turn.Reply)
+		}
+	}
+	return b.String()
+}
+
+// summarizeConversation folds turns into the existing summary with one Bedrock call
+func summarizeConversation(ctx context.Context, summary string, turns []ConversationTurn) (string, Usage, error) {
+	system := `You maintain the running summary of a conversation between a user and a voice assistant. Rewrite the summary to include the new turns. Keep names, dates, times, places, decisions and anything the user asked to be created, changed or remembered; drop pleasantries. Write plain text, at most 200 words, and return only the summary.`
+
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("Current summary:\n" + summary + "\n\n")
+	}
+	b.WriteString("New turns:")
+	for _, turn := range turns {
+		b.WriteString("\nUser: " + turn.Request + "\nAssistant: " + turn.Reply)
+	}
+	text, usage, err := invokeModel(ctx, system, b.String(), conversationSummaryMaxTokens, 0)
+	if err != nil {
+		return "", usage, err
+	}
+	return truncateRunes(strings.TrimSpace(text), maxConversationSummaryRunes), usage, nil
+}
+
+// rememberTurn appends a request and its reply to the conversation, folding older turns
+// into the summary once there are too many, and saves it. If summarizing fails the
+// oldest turns are dropped instead, so the record stays bounded. Errors are logged and
+// skipped - the response has already been produced.
+func rememberTurn(ctx context.Context, req *Req, principal string, now time.Time, resp *Response) {
+	conv := req.conversation
+	if conv == nil {
+		return
+	}
+	reply := resp.Title
+	if resp.Markdown != "" {
+		reply += "\n" + resp.Markdown
+	}
+	conv.Turns = append(conv.Turns, ConversationTurn{
+		Request: truncateRunes(strings.TrimSpace(req.Text), maxConversationTurnRunes),
+		Reply:   truncateRunes(reply, maxConversationTurnRunes),
+		At:      now.UTC().Format(time.RFC3339),
+	})
+
+	if len(conv.Turns) > maxConversationTurns {
+		fold := conv.Turns[:len(conv.Turns)-conversationKeepTurns]
+		summary, usage, err := summarizeConversation(ctx, conv.Summary, fold)
+		recordTokenUsage(ctx, principal, now, modelFrom(ctx), usage)
+		if err != nil {
+			log.Printf("Failed to summarize conversation, dropping its oldest turns: %v", err)
+			conv.Turns = conv.Turns[len(conv.Turns)-maxConversationTurns:]
+		} else {
+			conv.Summary = summary
+			conv.Summarized += len(fold)
+			conv.Turns = append([]ConversationTurn{}, conv.Turns[len(fold):]...)
+		}
+	}
+
+	if err := saveConversation(ctx, conv, now); err != nil {
+		log.Printf("Failed to save conversation: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateConversationID(t *testing.T) {
+	for id, valid := range map[string]bool{"": true, "3f2b8c1e-9a4d-4c55-8f0e-1b2c3d4e5f60": true, "trip_planning": true, "a b": false, strings.Repeat("x", 65): false} {
+		if err := validateConversationID(&Req{ConversationID: id}); (err == nil) != valid {
+			t.Errorf("validateConversationID(%q) = %v", id, err)
+		}
+	}
+}
+
+func TestConversationPrompt(t *testing.T) {
+	if got := conversationPrompt(nil); got != "" {
+		t.Errorf("no conversation: %q", got)
+	}
+	if got := conversationPrompt(&Conversation{Turns: []ConversationTurn{}}); got != "" {
+		t.Errorf("new conversation: %q", got)
+	}
+	prompt := conversationPrompt(&Conversation{
+		Summary: "Planning a trip to Lisbon in May.",
+		Turns:   []ConversationTurn{{Request: "Remind me to book flights", Reply: "Book flights"}},
+	})
+	for _, want := range []string{"Summary of earlier turns:\nPlanning a trip to Lisbon in May.", "User: Remind me to book flights\nAssistant: Book flights"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestRememberTurn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	t.Run("not configured", func(t *testing.T) {
+		req := &Req{Text: "hi", ConversationID: "c1"}
+		if conv := requestConversation(ctx, req, "user-1"); conv != nil || req.ConversationID != "" || len(req.warnings) != 1 {
+			t.Errorf("conversation = %+v, req = %+v", conv, req)
+		}
+	})
+
+	t.Run("summarizes older turns", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		bedrock := &fakeBedrock{text: "  Planning a trip to Lisbon.  ", usage: Usage{InputTokens: 10, OutputTokens: 5}}
+		useFakeBedrock(t, bedrock)
+
+		for i := 1; i <= maxConversationTurns+1; i++ {
+			req := &Req{Text: fmt.Sprintf("request %d", i), ConversationID: "trip"}
+			req.conversation = requestConversation(ctx, req, "user-1")
+			rememberTurn(ctx, req, "user-1", now, &Response{Title: fmt.Sprintf("reply %d", i)})
+		}
+		conv, err := loadConversation(ctx, "user-1", "trip")
+		if err != nil || conv == nil {
+			t.Fatalf("loadConversation = %v, %v", conv, err)
+		}
+		if bedrock.calls != 1 || conv.Summary != "Planning a trip to Lisbon." || conv.Summarized != maxConversationTurns+1-conversationKeepTurns {
+			t.Errorf("calls = %d, conversation = %+v", bedrock.calls, conv)
+		}
+		if len(conv.Turns) != conversationKeepTurns || conv.Turns[0].Request != "request 6" || conv.Turns[3].Reply != "reply 9" {
+			t.Errorf("turns = %+v", conv.Turns)
+		}
+		if conv.ExpiresAt != now.Add(7*24*time.Hour).Unix() {
+			t.Errorf("ExpiresAt = %d", conv.ExpiresAt)
+		}
+	})
+
+	t.Run("summary failure", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		useFakeBedrock(t, &fakeBedrock{err: errors.New("throttled")})
+		turns := make([]ConversationTurn, maxConversationTurns)
+		req := &Req{Text: "one more", conversation: &Conversation{PK: historyPK("user-1"), SK: conversationSKPrefix + "c2", ID: "c2", Turns: turns}}
+		rememberTurn(ctx, req, "user-1", now, &Response{Title: "ok"})
+		if conv, _ := loadConversation(ctx, "user-1", "c2"); conv == nil || len(conv.Turns) != maxConversationTurns || conv.Turns[maxConversationTurns-1].Request != "one more" {
+			t.Errorf("conversation = %+v", conv)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Default CORS settings, matching the API Gateway preflight configuration
+const (
+	defaultCORSHeaders = "Content-Type,X-Client-Token,X-Wrist-Timestamp,X-Wrist-Nonce"
+	defaultCORSMethods = "GET,POST,PUT,PATCH,DELETE,OPTIONS"
+)
+
+// Response headers a browser client may read (Retry-After drives back-off; the
+// timestamp and signature verify signed responses)
+const corsExposeHeaders = "Retry-After," + timestampHeader + "," + signatureHeader
+
+// corsConfig is the CORS policy from CORS_ALLOWED_ORIGINS, CORS_ALLOWED_HEADERS and
+// CORS_ALLOWED_METHODS. API Gateway answers preflight requests; the handler adds the
+// matching headers to actual responses so browsers can read them.
+type corsConfig struct {
+	Origins []string // exact origins, or ["*"] for any
+	Headers string
+	Methods string
+}
+
+// loadCORSConfig reads the CORS policy from environment; unset origins allow any ("*")
+func loadCORSConfig() corsConfig {
+	cfg := corsConfig{
+		Origins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		Headers: getEnv("CORS_ALLOWED_HEADERS", defaultCORSHeaders),
+		Methods: getEnv("CORS_ALLOWED_METHODS", defaultCORSMethods),
+	}
+	if len(cfg.Origins) == 0 {
+		cfg.Origins = []string{"*"}
+	}
+	return cfg
+}
+
+// wildcard reports whether any origin is allowed
+func (c corsConfig) wildcard() bool {
+	for _, origin := range c.Origins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request Origin, or ""
+// when the origin is not allowed
+func (c corsConfig) allowOrigin(origin string) string {
+	if c.wildcard() {
+		return "*"
+	}
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range c.Origins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// apply adds CORS headers to resp for the request. With an origin allowlist the
+// response varies by Origin, so Vary is set even when the origin is rejected.
+func (c corsConfig) apply(event events.APIGatewayProxyRequest, resp *events.APIGatewayProxyResponse) {
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	if !c.wildcard() {
+		addVary(resp.Headers, "Origin")
+	}
+
+	allowOrigin := c.allowOrigin(requestHeader(event, "Origin"))
+	if allowOrigin == "" {
+		return
+	}
+	resp.Headers["Access-Control-Allow-Origin"] = allowOrigin
+	resp.Headers["Access-Control-Allow-Headers"] = c.Headers
+	resp.Headers["Access-Control-Allow-Methods"] = c.Methods
+	resp.Headers["Access-Control-Expose-Headers"] = corsExposeHeaders
+}
+
+// requestHeader returns a request header regardless of case
+func requestHeader(event events.APIGatewayProxyRequest, name string) string {
+	for key, value := range event.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLoadCORSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins string
+		headers string
+		want    corsConfig
+	}{
+		{
+			name: "defaults allow any origin",
+			want: corsConfig{Origins: []string{"*"}, Headers: defaultCORSHeaders, Methods: defaultCORSMethods},
+		},
+		{
+			name:    "allowlist and custom headers",
+			origins: " https://app.example.com, https://admin.example.com ,",
+			headers: "Content-Type,Authorization",
+			want: corsConfig{
+				Origins: []string{"https://app.example.com", "https://admin.example.com"},
+				Headers: "Content-Type,Authorization",
+				Methods: defaultCORSMethods,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+			t.Setenv("CORS_ALLOWED_HEADERS", tt.headers)
+			t.Setenv("CORS_ALLOWED_METHODS", "")
+			if got := loadCORSConfig(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadCORSConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSConfig_Apply(t *testing.T) {
+	allowlist := corsConfig{Origins: []string{"https://app.example.com/"}, Headers: defaultCORSHeaders, Methods: defaultCORSMethods}
+	wildcard := corsConfig{Origins: []string{"*"}, Headers: defaultCORSHeaders, Methods: defaultCORSMethods}
+
+	tests := []struct {
+		name       string
+		cfg        corsConfig
+		origin     string
+		wantOrigin string
+		wantVary   bool
+	}{
+		{"allowed origin is echoed", allowlist, "https://app.example.com", "https://app.example.com", true},
+		{"other origin gets no CORS headers", allowlist, "https://evil.example.com", "", true},
+		{"no origin (Shortcuts, curl)", allowlist, "", "", true},
+		{"wildcard", wildcard, "https://anything.example", "*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{Headers: map[string]string{}}
+			if tt.origin != "" {
+				event.Headers["origin"] = tt.origin
+			}
+			resp := apiResponse(200, map[string]string{"ok": "true"})
+			tt.cfg.apply(event, &resp)
+
+			if got := resp.Headers["Access-Control-Allow-Origin"]; got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := resp.Headers["Vary"] == "Origin"; got != tt.wantVary {
+				t.Errorf("Vary: Origin set = %v, want %v", got, tt.wantVary)
+			}
+			if tt.wantOrigin != "" && resp.Headers["Access-Control-Expose-Headers"] != corsExposeHeaders {
+				t.Errorf("Expected Retry-After to be exposed, got %q", resp.Headers["Access-Control-Expose-Headers"])
+			}
+		})
+	}
+}
+
+func TestHandler_CORS(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/invoke",
+		Headers:    map[string]string{"Origin": "https://app.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 405 {
+		t.Errorf("StatusCode = %d, want 405", resp.StatusCode)
+	}
+	if got := resp.Headers["Access-Control-Allow-Origin"]; got != "https://app.example.com" {
+		t.Errorf("Error responses should carry CORS headers too, got %q", got)
+	}
+}
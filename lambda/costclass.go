@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Cost classes, cheapest first. A request picks one with costClass (default standard);
+// a token's class: scope caps it.
+var costClassNames = []string{"economy", "standard", "premium"}
+
+const defaultCostClass = "standard"
+
+// costClassThinkingTokens caps thinkingTokens per cost class
+var costClassThinkingTokens = map[string]int{
+	"economy":  0,
+	"standard": 16384,
+	"premium":  65536,
+}
+
+// costClassModel returns the model a cost class is answered by:
+// COST_CLASS_ECONOMY_MODEL_ID or COST_CLASS_PREMIUM_MODEL_ID, or "" for BEDROCK_MODEL_ID
+func costClassModel(class string) string {
+	if class == "" || class == defaultCostClass {
+		return ""
+	}
+	return os.Getenv("COST_CLASS_" + strings.ToUpper(class) + "_MODEL_ID")
+}
+
+// clampCostClass fills in the request's cost class and lowers it, and thinkingTokens, to
+// what the caller's token allows, with a warning rather than an error so watch clients
+// don't need to know their token's class
+func clampCostClass(req *Req) error {
+	requested := req.CostClass
+	if req.CostClass == "" {
+		req.CostClass = defaultCostClass
+	}
+	rank := slices.Index(costClassNames, req.CostClass)
+	if rank < 0 {
+		return fmt.Errorf("invalid costClass: %s (valid: %s)", req.CostClass, strings.Join(costClassNames, ", "))
+	}
+
+	if limit := req.scopes.costClass(); rank > slices.Index(costClassNames, limit) {
+		if requested != "" {
+			req.warnings = append(req.warnings, fmt.Sprintf("costClass lowered from %s to %s, the most this token allows", req.CostClass, limit))
+		}
+		req.CostClass = limit
+	}
+
+	if ceiling := costClassThinkingTokens[req.CostClass]; req.ThinkingTokens > ceiling {
+		log.Printf("Clamping thinkingTokens from %d to %d for cost class %s", req.ThinkingTokens, ceiling, req.CostClass)
+		req.warnings = append(req.warnings, fmt.Sprintf("thinkingTokens lowered from %d to %d for cost class %s", req.ThinkingTokens, ceiling, req.CostClass))
+		req.ThinkingTokens = ceiling
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestClampCostClass(t *testing.T) {
+	tests := []struct {
+		name         string
+		scopes       tokenScopes
+		req          Req
+		wantClass    string
+		wantThinking int
+		wantWarnings int
+		wantErr      bool
+	}{
+		{name: "default", req: Req{}, wantClass: "standard"},
+		{name: "premium allowed", req: Req{CostClass: "premium", ThinkingTokens: 30000}, wantClass: "premium", wantThinking: 30000},
+		{name: "standard thinking ceiling", req: Req{ThinkingTokens: 30000}, wantClass: "standard", wantThinking: 16384, wantWarnings: 1},
+		{name: "clamped to token class", scopes: tokenScopes{"class:economy"}, req: Req{CostClass: "premium", ThinkingTokens: 1024}, wantClass: "economy", wantWarnings: 2},
+		{name: "default quietly clamped", scopes: tokenScopes{"class:economy"}, req: Req{}, wantClass: "economy"},
+		{name: "unknown token class fails closed", scopes: tokenScopes{"class:platinum"}, req: Req{CostClass: "standard"}, wantClass: "economy", wantWarnings: 1},
+		{name: "unknown class", req: Req{CostClass: "luxury"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.scopes = tt.scopes
+			err := clampCostClass(&req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clampCostClass() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if req.CostClass != tt.wantClass || req.ThinkingTokens != tt.wantThinking || len(req.warnings) != tt.wantWarnings {
+				t.Errorf("got class %s, thinkingTokens %d, warnings %q", req.CostClass, req.ThinkingTokens, req.warnings)
+			}
+		})
+	}
+}
+
+func TestRequestModel_CostClass(t *testing.T) {
+	t.Setenv("COST_CLASS_ECONOMY_MODEL_ID", "us.anthropic.claude-3-haiku-20240307-v1:0")
+
+	if got := requestModel(&Req{CostClass: "standard"}); got != modelID {
+		t.Errorf("standard: got %s", got)
+	}
+	if got := requestModel(&Req{CostClass: "premium"}); got != modelID {
+		t.Errorf("premium without a model: got %s", got)
+	}
+	if got := requestModel(&Req{CostClass: "economy"}); got != "us.anthropic.claude-3-haiku-20240307-v1:0" {
+		t.Errorf("economy: got %s", got)
+	}
+	if got := requestModel(&Req{CostClass: "economy", model: "fallback"}); got != "fallback" {
+		t.Errorf("budget fallback: got %s", got)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key prefix for stored daily digests, followed by the local date
+const dailyDigestSKPrefix = "DIGEST#"
+
+// How much history a digest reads: stored captures per action, and how far back an
+// undated reminder still counts as an open todo
+const (
+	dailyDigestCaptures = 1000
+	openTodoDays        = 7
+)
+
+// DailyDigest is the morning rollup of a principal's captures
+type DailyDigest struct {
+	PK            string `dynamodbav:"pk" json:"-"`
+	SK            string `dynamodbav:"sk" json:"-"`
+	Principal     string `dynamodbav:"principal" json:"principal"`
+	Date          string `dynamodbav:"date" json:"date"` // the day the digest covers, in DIGEST_TIMEZONE
+	Markdown      string `dynamodbav:"markdown" json:"markdown"`
+	Notes         int    `dynamodbav:"notes" json:"notes"`                 // notes captured the previous day
+	DueToday      int    `dynamodbav:"dueToday" json:"dueToday"`           // reminders due today
+	OpenTodos     int    `dynamodbav:"openTodos" json:"openTodos"`         // undated reminders from the past week
+	ShoppingItems int    `dynamodbav:"shoppingItems" json:"shoppingItems"` // unchecked shopping list items
+	GeneratedAt   string `dynamodbav:"generatedAt" json:"generatedAt"`
+}
+
+// DailyDigestRun reports what a scheduled digest run did
+type DailyDigestRun struct {
+	Principals int `json:"principals"`
+	Stored     int `json:"stored"`
+	Failed     int `json:"failed"`
+}
+
+// dailyDigestPrincipals lists the principals opted in through DAILY_DIGEST_PRINCIPALS
+func dailyDigestPrincipals() []string {
+	var principals []string
+	for _, principal := range strings.Split(os.Getenv("DAILY_DIGEST_PRINCIPALS"), ",") {
+		if principal = strings.TrimSpace(principal); principal != "" {
+			principals = append(principals, principal)
+		}
+	}
+	return principals
+}
+
+// compileDailyDigest builds the digest for the day containing now: yesterday's notes,
+// reminders due today, undated reminders from the past week and the open shopping list.
+// Completed reminders are left out.
+func compileDailyDigest(principal string, notes, reminders []HistoryItem, shopping []ShoppingItem, now time.Time, loc *time.Location) DailyDigest {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	yesterday := today.AddDate(0, 0, -1)
+	tomorrow := today.AddDate(0, 0, 1)
+	todoSince := today.AddDate(0, 0, -openTodoDays)
+
+	within := func(iso string, from, to time.Time) bool {
+		t, err := time.Parse(time.RFC3339, iso)
+		return err == nil && !t.Before(from) && t.Before(to)
+	}
+
+	var noteTitles []string
+	for _, note := range notes {
+		if within(note.CreatedAt, yesterday, today) {
+			noteTitles = append(noteTitles, note.Title)
+		}
+	}
+
+	type dueReminder struct {
+		at    time.Time
+		title string
+	}
+	var due []dueReminder
+	var todos []string
+	for _, reminder := range reminders {
+		switch {
+		case reminder.CompletedAt != "":
+			// done, nothing to show
+		case reminder.DueISO != nil && within(*reminder.DueISO, today, tomorrow):
+			at, _ := time.Parse(time.RFC3339, *reminder.DueISO)
+			due = append(due, dueReminder{at, reminder.Title})
+		case reminder.DueISO == nil && within(reminder.CreatedAt, todoSince, tomorrow):
+			todos = append(todos, reminder.Title)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+
+	var open []string
+	for _, item := range shopping {
+		if item.Checked {
+			continue
+		}
+		if item.Quantity != "" {
+			open = append(open, item.Name+" ("+item.Quantity+")")
+		} else {
+			open = append(open, item.Name)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Daily digest - %s\n", today.Format("Monday, January 2"))
+	section := func(heading string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", heading)
+		for _, line := range lines {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+	dueLines := make([]string, len(due))
+	for i, reminder := range due {
+		dueLines[i] = reminder.at.In(loc).Format("15:04") + " " + reminder.title
+	}
+	section("Due today", dueLines)
+	section("Yesterday's notes", noteTitles)
+	section("Open todos", todos)
+	section("Shopping list", open)
+	if len(due)+len(noteTitles)+len(todos)+len(open) == 0 {
+		b.WriteString("\nNothing due today and nothing captured yesterday.\n")
+	}
+
+	date := today.Format("2006-01-02")
+	return DailyDigest{
+		PK:            historyPK(principal),
+		SK:            dailyDigestSKPrefix + date,
+		Principal:     principal,
+		Date:          date,
+		Markdown:      b.String(),
+		Notes:         len(noteTitles),
+		DueToday:      len(due),
+		OpenTodos:     len(todos),
+		ShoppingItems: len(open),
+		GeneratedAt:   now.UTC().Format(time.RFC3339),
+	}
+}
+
+// buildDailyDigest loads a principal's captures and shopping list and compiles their digest
+func buildDailyDigest(ctx context.Context, principal string, now time.Time) (DailyDigest, error) {
+	notes, err := loadCapturesByAction(ctx, principal, "note", dailyDigestCaptures)
+	if err != nil {
+		return DailyDigest{}, err
+	}
+	reminders, err := loadCapturesByAction(ctx, principal, "reminder", dailyDigestCaptures)
+	if err != nil {
+		return DailyDigest{}, err
+	}
+	shopping, err := loadShoppingList(ctx, principal)
+	if err != nil {
+		return DailyDigest{}, err
+	}
+	return compileDailyDigest(principal, notes, reminders, shopping.Items, now, locationFromEnv("DIGEST_TIMEZONE")), nil
+}
+
+// saveDailyDigest stores a digest; a rerun on the same day replaces it
+func saveDailyDigest(ctx context.Context, digest DailyDigest) error {
+	item, err := attributevalue.MarshalMap(digest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal daily digest: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// deliverDailyDigest emails the digest to DAILY_DIGEST_EMAIL and posts it to
+// DAILY_DIGEST_WEBHOOK_URL, whichever are configured. Failures are logged only: the
+// digest is already stored and can be fetched with GET /digest.
+func deliverDailyDigest(ctx context.Context, digest DailyDigest) {
+	if to := os.Getenv("DAILY_DIGEST_EMAIL"); to != "" {
+		recipients := normalizeRecipients(strings.Split(to, ","))
+		if _, err := sendSESEmail(ctx, recipients, "Daily digest - "+digest.Date, digest.Markdown, ""); err != nil {
+			log.Printf("Failed to email daily digest for %s: %v", digest.Principal, err)
+		}
+	}
+
+	if url := os.Getenv("DAILY_DIGEST_WEBHOOK_URL"); url != "" {
+		if err := postDailyDigest(ctx, url, digest); err != nil {
+			log.Printf("Failed to push daily digest for %s: %v", digest.Principal, err)
+		}
+	}
+}
+
+// postDailyDigest POSTs the digest JSON and treats any non-2xx status as a failure
+func postDailyDigest(ctx context.Context, url string, digest DailyDigest) error {
+	body, err := json.Marshal(digest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal daily digest: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := sinkHTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", httpResp.StatusCode)
+	}
+	return nil
+}
+
+// runDailyDigest compiles, stores and delivers the digest for every opted-in principal.
+// A failure for one principal is logged and doesn't stop the others; the run never
+// returns an error, since a retried invocation would deliver the digests twice.
+func runDailyDigest(ctx context.Context, now time.Time) (DailyDigestRun, error) {
+	principals := dailyDigestPrincipals()
+	run := DailyDigestRun{Principals: len(principals)}
+	if historyTableName == "" {
+		log.Printf("Daily digest skipped: history table not configured")
+		return run, nil
+	}
+
+	for _, principal := range principals {
+		digest, err := buildDailyDigest(ctx, principal, now)
+		if err == nil {
+			err = saveDailyDigest(ctx, digest)
+		}
+		if err != nil {
+			log.Printf("Daily digest failed for %s: %v", principal, err)
+			run.Failed++
+			continue
+		}
+		run.Stored++
+		deliverDailyDigest(ctx, digest)
+	}
+	log.Printf("Daily digest: %d principals, %d stored, %d failed", run.Principals, run.Stored, run.Failed)
+	return run, nil
+}
+
+// loadLatestDailyDigest returns a principal's most recent digest, or nil when none is stored
+func loadLatestDailyDigest(ctx context.Context, principal string) (*DailyDigest, error) {
+	out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(historyTableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":     &types.AttributeValueMemberS{Value: historyPK(principal)},
+			":prefix": &types.AttributeValueMemberS{Value: dailyDigestSKPrefix},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB Query failed: %w", err)
+	}
+	if len(out.Items) == 0 {
+		return nil, nil
+	}
+	var digest DailyDigest
+	if err := attributevalue.UnmarshalMap(out.Items[0], &digest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal daily digest: %w", err)
+	}
+	return &digest, nil
+}
+
+// isDigestRequest reports whether the route is the daily digest endpoint
+func isDigestRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/digest"
+}
+
+// handleDigest serves GET /digest, the caller's most recent daily digest
+func handleDigest(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+	digest, err := loadLatestDailyDigest(ctx, principalFromEvent(event))
+	if err != nil {
+		log.Printf("Failed to load daily digest: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load daily digest"))
+	}
+	if digest == nil {
+		return errorResponse(ctx, apierror.NotFound("No daily digest yet"))
+	}
+	return apiResponse(200, digest)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func digestCapture(id, action, title, createdAt string, due *string) HistoryItem {
+	created, _ := time.Parse(time.RFC3339, createdAt)
+	return newHistoryItem(captureMeta{ID: id, Principal: "user-1", CreatedAt: created}, Response{Action: action, Title: title, DueISO: due})
+}
+
+func TestCompileDailyDigest(t *testing.T) {
+	at := func(s string) *string { return &s }
+	now := time.Date(2025, 1, 15, 7, 0, 0, 0, time.UTC)
+	notes := []HistoryItem{
+		digestCapture("n1", "note", "Garden ideas", "2025-01-14T18:00:00Z", nil),
+		digestCapture("n2", "note", "Too old", "2025-01-13T18:00:00Z", nil),
+		digestCapture("n3", "note", "Written today", "2025-01-15T06:00:00Z", nil),
+	}
+	reminders := []HistoryItem{
+		digestCapture("r1", "reminder", "Dentist", "2025-01-01T10:00:00Z", at("2025-01-15T16:00:00Z")),
+		digestCapture("r2", "reminder", "Call mom", "2025-01-14T10:00:00Z", at("2025-01-15T09:30:00Z")),
+		digestCapture("r3", "reminder", "Tomorrow", "2025-01-14T10:00:00Z", at("2025-01-16T09:30:00Z")),
+		digestCapture("r4", "reminder", "Renew passport", "2025-01-12T10:00:00Z", nil),
+		digestCapture("r5", "reminder", "Stale todo", "2025-01-01T10:00:00Z", nil),
+		digestCapture("r6", "reminder", "Done already", "2025-01-14T10:00:00Z", at("2025-01-15T11:00:00Z")),
+	}
+	reminders[5].CompletedAt = "2025-01-14T12:00:00Z"
+	shopping := []ShoppingItem{{Name: "milk", Quantity: "2"}, {Name: "eggs", Checked: true}}
+
+	digest := compileDailyDigest("user-1", notes, reminders, shopping, now, time.UTC)
+	if digest.Date != "2025-01-15" || digest.SK != "DIGEST#2025-01-15" {
+		t.Errorf("Date = %s, SK = %s", digest.Date, digest.SK)
+	}
+	if digest.Notes != 1 || digest.DueToday != 2 || digest.OpenTodos != 1 || digest.ShoppingItems != 1 {
+		t.Errorf("counts = %+v", digest)
+	}
+	want := `# Daily digest - Wednesday, January 15
+
+## Due today
+
+- 09:30 Call mom
+- 16:00 Dentist
+
+## Yesterday's notes
+
+- Garden ideas
+
+## Open todos
+
+- Renew passport
+
+## Shopping list
+
+- milk (2)
+`
+	if digest.Markdown != want {
+		t.Errorf("Markdown =\n%s\nwant\n%s", digest.Markdown, want)
+	}
+
+	// The day boundaries follow the timezone: at 03:00 UTC it's still the 14th in New York
+	newYork, _ := time.LoadLocation("America/New_York")
+	if got := compileDailyDigest("user-1", nil, nil, nil, now.Add(-4*time.Hour), newYork); got.Date != "2025-01-14" || !strings.Contains(got.Markdown, "Nothing due today") {
+		t.Errorf("empty digest = %+v", got)
+	}
+}
+
+func TestRunDailyDigest(t *testing.T) {
+	var pushed DailyDigest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&pushed)
+	}))
+	defer server.Close()
+
+	useFakeDynamo(t, &fakeDynamo{})
+	ses := &fakeSES{}
+	useFakeSES(t, ses)
+	t.Setenv("DAILY_DIGEST_PRINCIPALS", "user-1, user-2")
+	t.Setenv("DAILY_DIGEST_EMAIL", "me@example.com")
+	t.Setenv("DAILY_DIGEST_WEBHOOK_URL", server.URL)
+	t.Setenv("SES_FROM_ADDRESS", "agent@example.com")
+
+	now := time.Now()
+	ctx := context.Background()
+	due := now.UTC().Format(time.RFC3339)
+	saveCapture(ctx, digestCapture("r1", "reminder", "Call mom", now.UTC().Format(time.RFC3339), &due))
+
+	run, err := runDailyDigest(ctx, now)
+	if err != nil || run.Principals != 2 || run.Stored != 2 || run.Failed != 0 {
+		t.Fatalf("run = %+v, %v", run, err)
+	}
+	if ses.input == nil || ses.input.Destination.ToAddresses[0] != "me@example.com" {
+		t.Errorf("email not sent: %+v", ses.input)
+	}
+	if pushed.Principal != "user-2" {
+		t.Errorf("last pushed digest = %+v", pushed)
+	}
+
+	call := func(principal string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/digest"}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(ctx, event)
+		return resp
+	}
+	var stored DailyDigest
+	resp := call("user-1")
+	json.Unmarshal([]byte(resp.Body), &stored)
+	if resp.StatusCode != 200 || stored.DueToday != 1 || !strings.Contains(stored.Markdown, "Call mom") {
+		t.Errorf("GET /digest = %d: %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call("user-3"); resp.StatusCode != 404 {
+		t.Errorf("no digest: StatusCode = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// dateOffset matches "+2h", "+45m" and "+1h30m": a time from now (or, for endISO,
+	// from the start)
+	dateOffset = regexp.MustCompile(`^\+(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?$`)
+	// dayOffset matches "+2d", "+1w", "+1w2d", "+1mo" and "+1y": calendar days, weeks,
+	// months or years from today
+	dayOffset = regexp.MustCompile(`^\+(?:(?:(\d+)w)?(?:(\d+)d)?|(\d+)mo|(\d+)y)$`)
+	// offsetPart is one more unit of an offset said with spaces, e.g. the "30m" of "+1h 30m"
+	offsetPart = regexp.MustCompile(`^\d+(?:w|d|h|m|mo|y)$`)
+	// clockTime matches "17:30", "17:30:15", "9am" and "5:30pm"
+	clockTime = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(?::(\d{2}))?(am|pm)?$`)
+)
+
+// dateWeekdays maps the weekday names the model may use onto time.Weekday
+var dateWeekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// validateTimezone checks the request's IANA timezone, used to resolve its dates
+func validateTimezone(req *Req) error {
+	req.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+		return fmt.Errorf("timezone must be an IANA time zone, e.g. Europe/Lisbon")
+	}
+	return nil
+}
+
+// requestLocation is the timezone a request's dates are resolved in: the request's
+// timezone, then the caller's preferred one, then UTC
+func requestLocation(req *Req) *time.Location {
+	names := []string{req.Timezone}
+	if req.preferences != nil {
+		names = append(names, req.preferences.Timezone)
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// resolveDate turns a date expression from the model into a time in loc. The model
+// never does date arithmetic; it describes the date and this does the calendar work,
+// so DST changes and month ends come out right. Accepted expressions:
+//   - an RFC 3339 datetime with an offset, kept as it is
+//   - "now", or an offset from now: "+2h", "+45m", "+1h30m", "+1d2h"
+//   - a day, optionally followed by a time ("09:00", "9am"): "today", "tomorrow", "yesterday",
+//     a weekday ("friday" is the coming one, never today; "next friday" the one after
+//     it), a date ("2025-03-14"), or a calendar offset ("+2d", "+1w", "+1mo", "+1y")
+//   - a time alone ("17:30"): today, or tomorrow when that time has passed
+//
+// A day without a time is at snoozeDefaultHour, except calendar offsets, which keep the
+// current time of day. Month and year offsets stop at the end of a shorter month. The
+// reminders API reads snoozes with the same grammar (see parseSnooze).
+func resolveDate(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(expr)); err == nil {
+		return t, nil
+	}
+	expr = strings.Join(dateWords(strings.ToLower(expr)), " ")
+	local := now.In(loc)
+	if expr == "now" {
+		return local.Truncate(time.Minute), nil
+	}
+	if match := dateOffset.FindStringSubmatch(expr); match != nil && expr != "+" && (match[3] != "" || match[4] != "") {
+		weeks, _ := strconv.Atoi(match[1])
+		days, _ := strconv.Atoi(match[2])
+		hours, _ := strconv.Atoi(match[3])
+		minutes, _ := strconv.Atoi(match[4])
+		return local.AddDate(0, 0, weeks*7+days).Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute).Truncate(time.Minute), nil
+	}
+
+	// A local datetime ("2025-03-14T09:00") reads as a date and a time
+	if len(expr) > 10 && isISODate(expr[:10]) && expr[10] == 't' {
+		expr = expr[:10] + " " + expr[11:]
+	}
+	words := strings.Fields(expr)
+	if len(words) > 1 && words[0] == "next" {
+		words = append([]string{"next " + words[1]}, words[2:]...)
+	}
+	if len(words) == 0 || len(words) > 2 {
+		return time.Time{}, fmt.Errorf("unrecognised date %q", expr)
+	}
+
+	var clock *[3]int
+	if match := clockTime.FindStringSubmatch(words[len(words)-1]); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		minute, _ := strconv.Atoi(match[2])
+		second, _ := strconv.Atoi(match[3])
+		if match[4] != "" {
+			if hour < 1 || hour > 12 {
+				return time.Time{}, fmt.Errorf("invalid time of day in %q", expr)
+			}
+			hour %= 12
+			if match[4] == "pm" {
+				hour += 12
+			}
+		}
+		if hour > 23 || minute > 59 || second > 59 {
+			return time.Time{}, fmt.Errorf("invalid time of day in %q", expr)
+		}
+		clock = &[3]int{hour, minute, second}
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		// A time alone is the next time the clock shows it
+		t := time.Date(local.Year(), local.Month(), local.Day(), clock[0], clock[1], clock[2], 0, loc)
+		if !t.After(local) {
+			t = time.Date(local.Year(), local.Month(), local.Day()+1, clock[0], clock[1], clock[2], 0, loc)
+		}
+		return t, nil
+	}
+	if len(words) > 1 {
+		return time.Time{}, fmt.Errorf("unrecognised date %q", expr)
+	}
+
+	day, keepsTime, err := resolveDay(words[0], local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w in %q", err, expr)
+	}
+	switch {
+	case clock != nil:
+		return time.Date(day.Year(), day.Month(), day.Day(), clock[0], clock[1], clock[2], 0, loc), nil
+	case keepsTime:
+		return time.Date(day.Year(), day.Month(), day.Day(), local.Hour(), local.Minute(), 0, 0, loc), nil
+	default:
+		return time.Date(day.Year(), day.Month(), day.Day(), snoozeDefaultHour, 0, 0, 0, loc), nil
+	}
+}
+
+// dateWords splits a lowercase date expression into words, reading the spoken forms
+// people type: "at" is dropped, "9 am" becomes "9am" and "+1h 30m" becomes "+1h30m"
+func dateWords(expr string) []string {
+	var words []string
+	for _, word := range strings.Fields(expr) {
+		n := len(words)
+		switch {
+		case word == "at":
+			continue
+		case (word == "am" || word == "pm") && n > 0:
+			words[n-1] += word
+		case n > 0 && strings.HasPrefix(words[n-1], "+") && (words[n-1] == "+" || offsetPart.MatchString(word)):
+			words[n-1] += word
+		default:
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// resolveDay resolves the day part of a date expression against local, reporting
+// whether it is a calendar offset (which keeps the current time of day)
+func resolveDay(word string, local time.Time) (day time.Time, keepsTime bool, err error) {
+	switch word {
+	case "today":
+		return local, false, nil
+	case "tomorrow":
+		return local.AddDate(0, 0, 1), false, nil
+	case "yesterday":
+		return local.AddDate(0, 0, -1), false, nil
+	}
+	name, next := strings.CutPrefix(word, "next ")
+	if weekday, ok := dateWeekdays[name]; ok {
+		days := (int(weekday)-int(local.Weekday())+6)%7 + 1 // 1-7 days ahead
+		if next {
+			days += 7
+		}
+		return local.AddDate(0, 0, days), false, nil
+	}
+	if next {
+		return time.Time{}, false, errors.New("next must be followed by a weekday")
+	}
+	if isISODate(word) {
+		t, err := time.ParseInLocation("2006-01-02", word, local.Location())
+		if err != nil {
+			return time.Time{}, false, errors.New("invalid date")
+		}
+		return t, false, nil
+	}
+	if match := dayOffset.FindStringSubmatch(word); match != nil && word != "+" {
+		weeks, _ := strconv.Atoi(match[1])
+		days, _ := strconv.Atoi(match[2])
+		months, _ := strconv.Atoi(match[3])
+		years, _ := strconv.Atoi(match[4])
+		if months > 0 || years > 0 {
+			return addMonthsClamped(local, years*12+months), true, nil
+		}
+		return local.AddDate(0, 0, weeks*7+days), true, nil
+	}
+	return time.Time{}, false, errors.New("unrecognised day")
+}
+
+// addMonthsClamped adds months to t, landing on the last day of the target month when
+// t's day doesn't exist there (Jan 31 + 1 month is Feb 28 or 29, not Mar 3)
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(t.Day(), lastDay), t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+}
+
+// isISODate reports whether s looks like a YYYY-MM-DD date
+func isISODate(s string) bool {
+	return len(s) == 10 && s[4] == '-' && s[7] == '-'
+}
+
+// resolveDates replaces the model's date expressions in dueISO, startISO, endISO and
+// alternatives with RFC 3339 datetimes in the request's timezone (see resolveDate).
+// An offset in endISO ("+1h") counts from the start. A date that can't be read is
+// dropped with a warning rather than passed on for clients to choke on.
+func resolveDates(req *Req, now time.Time, resp *Response) {
+	loc := requestLocation(req)
+	resolve := func(field string, value *string, base time.Time) (*string, time.Time) {
+		if value == nil || strings.TrimSpace(*value) == "" || strings.EqualFold(strings.TrimSpace(*value), "null") {
+			return nil, time.Time{}
+		}
+		t, err := resolveDate(*value, base, loc)
+		if err != nil {
+			log.Printf("Dropping %s: %v", field, err)
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("%s dropped: unrecognised date %q", field, *value))
+			return nil, time.Time{}
+		}
+		formatted := t.Format(time.RFC3339)
+		return &formatted, t
+	}
+
+	resp.DueISO, _ = resolve("dueISO", resp.DueISO, now)
+	var start time.Time
+	resp.StartISO, start = resolve("startISO", resp.StartISO, now)
+	endBase := now
+	if resp.EndISO != nil && dateOffset.MatchString(strings.TrimSpace(*resp.EndISO)) && !start.IsZero() {
+		endBase = start
+	}
+	resp.EndISO, _ = resolve("endISO", resp.EndISO, endBase)
+
+	var alternatives []string
+	for _, alternative := range resp.Alternatives {
+		if t, err := resolveDate(alternative, now, loc); err == nil {
+			alternatives = append(alternatives, t.Format(time.RFC3339))
+		}
+	}
+	resp.Alternatives = alternatives
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveDate(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	// Saturday March 8 2025, 14:20 in New York; clocks go forward at 02:00 the next day
+	now := time.Date(2025, 3, 8, 14, 20, 30, 0, ny)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"2025-01-15T09:00:00Z", "2025-01-15T09:00:00Z"},
+		{"now", "2025-03-08T14:20:00-05:00"},
+		{"tomorrow 09:00", "2025-03-09T09:00:00-04:00"}, // after the DST change
+		{"Tomorrow", "2025-03-09T09:00:00-04:00"},
+		{"today 17:30", "2025-03-08T17:30:00-05:00"},
+		{"yesterday 20:00", "2025-03-07T20:00:00-05:00"},
+		{"+2h", "2025-03-08T16:20:00-05:00"},
+		{"+12h", "2025-03-09T03:20:00-04:00"}, // elapsed hours, not wall clock
+		{"+1h30m", "2025-03-08T15:50:00-05:00"},
+		{"+1d2h", "2025-03-09T16:20:00-04:00"},
+		{"+2d", "2025-03-10T14:20:00-04:00"}, // same wall clock time
+		{"+2d 09:00", "2025-03-10T09:00:00-04:00"},
+		{"+1w", "2025-03-15T14:20:00-04:00"},
+		{"saturday 10:00", "2025-03-15T10:00:00-04:00"}, // never today
+		{"monday", "2025-03-10T09:00:00-04:00"},
+		{"next monday 08:15", "2025-03-17T08:15:00-04:00"},
+		{"2025-04-01 18:00", "2025-04-01T18:00:00-04:00"},
+		{"2025-04-01T18:00", "2025-04-01T18:00:00-04:00"},
+		{"2025-12-25", "2025-12-25T09:00:00-05:00"},
+		{"17:30", "2025-03-08T17:30:00-05:00"},
+		{"08:00", "2025-03-09T08:00:00-04:00"}, // already passed today
+		{"+1mo", "2025-04-08T14:20:00-04:00"},
+		{"+1y 07:00", "2026-03-08T07:00:00-04:00"}, // DST starts that morning in 2026
+		{"tomorrow at 9am", "2025-03-09T09:00:00-04:00"},
+		{"today 5:30 PM", "2025-03-08T17:30:00-05:00"},
+		{"today 12am", "2025-03-08T00:00:00-05:00"},
+		{"+ 1h 30m", "2025-03-08T15:50:00-05:00"},
+	}
+	for _, tt := range tests {
+		got, err := resolveDate(tt.expr, now, ny)
+		if err != nil {
+			t.Errorf("resolveDate(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if s := got.Format(time.RFC3339); s != tt.want {
+			t.Errorf("resolveDate(%q) = %s, want %s", tt.expr, s, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "soon", "next week", "friday at noon", "25:00", "tomorrow 09:00 sharp", "2025-02-30", "+", "+2x", "today 13pm", "today 0am"} {
+		if got, err := resolveDate(bad, now, ny); err == nil {
+			t.Errorf("resolveDate(%q) = %s, want error", bad, got)
+		}
+	}
+}
+
+func TestResolveDate_MonthEnds(t *testing.T) {
+	now := time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+	for expr, want := range map[string]string{
+		"+1mo": "2024-02-29T10:00:00Z",
+		"+2mo": "2024-03-31T10:00:00Z",
+		"+1y":  "2025-01-31T10:00:00Z",
+		"+1d":  "2024-02-01T10:00:00Z",
+	} {
+		got, err := resolveDate(expr, now, time.UTC)
+		if err != nil || got.Format(time.RFC3339) != want {
+			t.Errorf("resolveDate(%q) = %s, %v, want %s", expr, got.Format(time.RFC3339), err, want)
+		}
+	}
+	leap := time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC)
+	if got, _ := resolveDate("+1y", leap, time.UTC); got.Format(time.RFC3339) != "2025-02-28T10:00:00Z" {
+		t.Errorf("resolveDate(+1y) from Feb 29 = %s", got.Format(time.RFC3339))
+	}
+}
+
+func TestResolveDates(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC) // 13:00 in Lisbon
+	strPtr := func(s string) *string { return &s }
+
+	req := &Req{preferences: &Preferences{Timezone: "Europe/Lisbon"}}
+	resp := &Response{StartISO: strPtr("tomorrow 15:00"), EndISO: strPtr("+1h30m"), DueISO: strPtr("null"), Alternatives: []string{"friday 15:00", "whenever"}}
+	resolveDates(req, now, resp)
+	if resp.DueISO != nil || *resp.StartISO != "2025-07-02T15:00:00+01:00" || *resp.EndISO != "2025-07-02T16:30:00+01:00" {
+		t.Errorf("resolveDates() = due %v, start %v, end %v", resp.DueISO, derefOrEmpty(resp.StartISO), derefOrEmpty(resp.EndISO))
+	}
+	if len(resp.Alternatives) != 1 || resp.Alternatives[0] != "2025-07-04T15:00:00+01:00" || len(resp.Warnings) != 0 {
+		t.Errorf("Alternatives = %v, warnings %v", resp.Alternatives, resp.Warnings)
+	}
+
+	// The request's timezone wins over the preference
+	req.Timezone = "Asia/Tokyo"
+	resp = &Response{DueISO: strPtr("today 21:00"), StartISO: strPtr("someday")}
+	resolveDates(req, now, resp)
+	if derefOrEmpty(resp.DueISO) != "2025-07-01T21:00:00+09:00" || resp.StartISO != nil {
+		t.Errorf("resolveDates() = due %v, start %v", derefOrEmpty(resp.DueISO), resp.StartISO)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], `startISO dropped: unrecognised date "someday"`) {
+		t.Errorf("Warnings = %v", resp.Warnings)
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	for _, tz := range []string{"", " Europe/Lisbon ", "UTC"} {
+		if err := validateTimezone(&Req{Timezone: tz}); err != nil {
+			t.Errorf("validateTimezone(%q) error: %v", tz, err)
+		}
+	}
+	for _, tz := range []string{"Mars/Olympus", "Local"} {
+		if err := validateTimezone(&Req{Timezone: tz}); err == nil {
+			t.Errorf("validateTimezone(%q) should fail", tz)
+		}
+	}
+}
+
+func TestProcessRequest_ResolvesDates(t *testing.T) {
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"reminder","title":"Call mom","markdown":"Call mom","dueISO":"tomorrow 09:00"}`})
+
+	req := &Req{Text: "Remind me to call mom tomorrow at 9", Mode: "reminder", MaxTokens: 800, Timezone: "America/Los_Angeles"}
+	now := time.Date(2025, 11, 1, 18, 0, 0, 0, time.UTC) // the day before the DST change there
+	response, apiErr := processRequest(context.Background(), req, "id-1", "user-1", now)
+	if apiErr != nil {
+		t.Fatalf("processRequest() error = %v", apiErr)
+	}
+	if derefOrEmpty(response.DueISO) != "2025-11-02T09:00:00-08:00" {
+		t.Errorf("DueISO = %s", derefOrEmpty(response.DueISO))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// DebugInfo is the diagnostics section added to responses for debug:true requests from
+// admin tokens. It exposes the raw model output, so it is never sent to sinks or callbacks.
+type DebugInfo struct {
+	ModelID       string           `json:"modelId"`
+	ParsePath     string           `json:"parsePath"` // structured (JSON reply) or fallback (raw text wrapped)
+	Retries       int              `json:"retries"`   // SDK retries across all model calls
+	Latency       DebugLatency     `json:"latency"`
+	ModelCalls    []DebugModelCall `json:"modelCalls"`
+	RawText       string           `json:"rawText"` // the model's reply before parsing
+	PromptVariant string           `json:"promptVariant,omitempty"`
+}
+
+// DebugLatency breaks a request's time down by pipeline stage, in milliseconds
+type DebugLatency struct {
+	PrepareMs int64 `json:"prepareMs"` // transcription, image load, vocabulary, tags, conversation
+	ModelMs   int64 `json:"modelMs"`   // every Bedrock call, including map steps
+	DeliverMs int64 `json:"deliverMs"` // finalizers, sinks and callback
+	TotalMs   int64 `json:"totalMs"`
+}
+
+// DebugModelCall is one Bedrock InvokeModel call
+type DebugModelCall struct {
+	LatencyMs    int64  `json:"latencyMs"`
+	Retries      int    `json:"retries"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
+	Error        string `json:"error,omitempty"`
+}
+
+// debugTrace collects diagnostics while a debug request is processed
+type debugTrace struct {
+	mu    sync.Mutex
+	start time.Time
+	calls []DebugModelCall
+	raw   string
+}
+
+type debugTraceKey struct{}
+
+// withDebugTrace attaches a new trace to the context passed down the pipeline
+func withDebugTrace(ctx context.Context, start time.Time) (context.Context, *debugTrace) {
+	trace := &debugTrace{start: start}
+	return context.WithValue(ctx, debugTraceKey{}, trace), trace
+}
+
+// debugTraceFrom returns the trace attached to ctx, or nil when the request isn't debugged
+func debugTraceFrom(ctx context.Context) *debugTrace {
+	trace, _ := ctx.Value(debugTraceKey{}).(*debugTrace)
+	return trace
+}
+
+// recordModelCall adds a Bedrock call to the trace, counting the SDK's retries from the
+// result metadata; safe on a nil trace
+func (t *debugTrace) recordModelCall(latency time.Duration, result *bedrockruntime.InvokeModelOutput, usage Usage, err error) {
+	if t == nil {
+		return
+	}
+	call := DebugModelCall{LatencyMs: latency.Milliseconds(), InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens}
+	if result != nil {
+		if attempts, ok := retry.GetAttemptResults(result.ResultMetadata); ok && len(attempts.Results) > 1 {
+			call.Retries = len(attempts.Results) - 1
+		}
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	t.mu.Lock()
+	t.calls = append(t.calls, call)
+	t.mu.Unlock()
+}
+
+// recordRawText keeps the reply the response was parsed from; safe on a nil trace
+func (t *debugTrace) recordRawText(text string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.raw = text
+	t.mu.Unlock()
+}
+
+// info assembles the debug section once the request is done. prepared and delivered
+// are when preparation finished and delivery started.
+func (t *debugTrace) info(resp *Response, prepared, delivered, now time.Time) *DebugInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info := &DebugInfo{
+		ModelID:       resp.model,
+		ParsePath:     resp.parsePath,
+		ModelCalls:    append([]DebugModelCall{}, t.calls...),
+		RawText:       t.raw,
+		PromptVariant: resp.PromptVariant,
+		Latency: DebugLatency{
+			PrepareMs: prepared.Sub(t.start).Milliseconds(),
+			DeliverMs: now.Sub(delivered).Milliseconds(),
+			TotalMs:   now.Sub(t.start).Milliseconds(),
+		},
+	}
+	for _, call := range t.calls {
+		info.Retries += call.Retries
+		info.Latency.ModelMs += call.LatencyMs
+	}
+	return info
+}
+
+// validateDebug allows debug:true only for admin tokens, since the section carries the
+// raw model output and prompt experiment details
+func validateDebug(req *Req) error {
+	if req.Debug && !req.admin {
+		return fmt.Errorf("%w: debug requires an admin token", errScopeDenied)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestValidateDebug(t *testing.T) {
+	if err := validateDebug(&Req{Debug: true}); !errors.Is(err, errScopeDenied) {
+		t.Errorf("non-admin: err = %v, want errScopeDenied", err)
+	}
+	if err := validateDebug(&Req{Debug: true, admin: true}); err != nil {
+		t.Errorf("admin: err = %v", err)
+	}
+}
+
+func TestDebugTraceInfo(t *testing.T) {
+	start := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	ctx, trace := withDebugTrace(context.Background(), start)
+	if debugTraceFrom(ctx) != trace || debugTraceFrom(context.Background()) != nil {
+		t.Fatal("trace not attached to the context")
+	}
+	var none *debugTrace
+	none.recordModelCall(time.Second, nil, Usage{}, nil) // no-op without a trace
+	none.recordRawText("ignored")
+
+	trace.recordModelCall(300*time.Millisecond, nil, Usage{InputTokens: 10}, errors.New("throttled"))
+	trace.recordModelCall(700*time.Millisecond, nil, Usage{InputTokens: 20, OutputTokens: 5}, nil)
+	trace.recordRawText(`{"title":"x"}`)
+
+	info := trace.info(&Response{parsePath: "structured", PromptVariant: "terse", model: modelID}, start.Add(50*time.Millisecond), start.Add(1100*time.Millisecond), start.Add(1200*time.Millisecond))
+	if info.ParsePath != "structured" || info.RawText != `{"title":"x"}` || info.PromptVariant != "terse" || info.ModelID != modelID {
+		t.Errorf("info = %+v", info)
+	}
+	if len(info.ModelCalls) != 2 || info.ModelCalls[0].Error != "throttled" || info.ModelCalls[1].OutputTokens != 5 {
+		t.Errorf("model calls = %+v", info.ModelCalls)
+	}
+	if info.Latency != (DebugLatency{PrepareMs: 50, ModelMs: 1000, DeliverMs: 100, TotalMs: 1200}) {
+		t.Errorf("latency = %+v", info.Latency)
+	}
+}
+
+func TestHandler_Debug(t *testing.T) {
+	useFakeBedrock(t, &fakeBedrock{text: "Buy milk", usage: Usage{InputTokens: 12, OutputTokens: 3}})
+	useSinks(t)
+	call := func(role string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: `{"text":"Buy milk","debug":true}`}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1", "role": role}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	if resp := call(""); resp.StatusCode != 403 {
+		t.Errorf("non-admin: StatusCode = %d, want 403", resp.StatusCode)
+	}
+
+	resp := call("admin")
+	var body Response
+	json.Unmarshal([]byte(resp.Body), &body)
+	if resp.StatusCode != 200 || body.Debug == nil {
+		t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if body.Debug.ParsePath != "fallback" || body.Debug.RawText != "Buy milk" || len(body.Debug.ModelCalls) != 1 || body.Debug.ModelCalls[0].InputTokens != 12 {
+		t.Errorf("debug = %+v", body.Debug)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DeviceProfile holds a registered device's request defaults, e.g. a kitchen iPad that
+// captures shopping lists or a watch that should stay short and cheap. It is stored on
+// the device's registry item and passed by the authorizer, so a device's requests can
+// leave out what its profile says.
+type DeviceProfile struct {
+	Mode      string   `dynamodbav:"mode,omitempty" json:"mode,omitempty"`           // used when the request has no mode
+	CostClass string   `dynamodbav:"costClass,omitempty" json:"costClass,omitempty"` // model alias: economy|standard|premium
+	MaxTokens int      `dynamodbav:"maxTokens,omitempty" json:"maxTokens,omitempty"` // used when the request has no maxTokens
+	Sinks     []string `dynamodbav:"sinks,omitempty" json:"sinks,omitempty"`         // replaces the mode's SINKS routing
+}
+
+// isEmpty reports whether the profile sets nothing
+func (p DeviceProfile) isEmpty() bool {
+	return p.Mode == "" && p.CostClass == "" && p.MaxTokens == 0 && len(p.Sinks) == 0
+}
+
+// validateDeviceProfile rejects profiles that would make every request from the device
+// fail validation or name sinks that don't exist
+func validateDeviceProfile(p DeviceProfile) error {
+	if _, ok := lookupMode(p.Mode); p.Mode != "" && !ok {
+		return fmt.Errorf("invalid profile mode: %s (valid: %s)", p.Mode, strings.Join(modeNames(), ", "))
+	}
+	if p.CostClass != "" && !slices.Contains(costClassNames, p.CostClass) {
+		return fmt.Errorf("invalid profile costClass: %s (valid: %s)", p.CostClass, strings.Join(costClassNames, ", "))
+	}
+	if p.MaxTokens < 0 || p.MaxTokens > 4096 {
+		return fmt.Errorf("profile maxTokens must be between 1 and 4096")
+	}
+	for _, name := range p.Sinks {
+		if _, ok := sinkFactories[name]; !ok {
+			return fmt.Errorf("invalid profile sink: %s", name)
+		}
+	}
+	return nil
+}
+
+// deviceProfileFromEvent returns the calling device's profile from the authorizer
+// context (JSON, since API Gateway only passes scalar values), or nil when it has none
+func deviceProfileFromEvent(event events.APIGatewayProxyRequest) *DeviceProfile {
+	raw, _ := event.RequestContext.Authorizer["deviceProfile"].(string)
+	if raw == "" {
+		return nil
+	}
+	var profile DeviceProfile
+	if err := json.Unmarshal([]byte(raw), &profile); err != nil {
+		log.Printf("Ignoring invalid device profile for principal %s: %v", principalFromEvent(event), err)
+		return nil
+	}
+	return &profile
+}
+
+// applyDeviceProfile fills in what the request left out from the device's profile. It
+// runs before validation, and before the caller's preferences, so a device's mode wins
+// over the user's default mode and the merged request is checked like any other.
+func applyDeviceProfile(req *Req, profile *DeviceProfile) {
+	if profile == nil {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = profile.Mode
+	}
+	if req.CostClass == "" {
+		req.CostClass = profile.CostClass
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = profile.MaxTokens
+	}
+	req.sinks = profile.Sinks
+}
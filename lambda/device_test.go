@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// deviceEvent builds an API request from a registered device with the given profile
+func deviceEvent(body, profile string) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: body}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-123", "deviceProfile": profile}
+	return event
+}
+
+func TestApplyDeviceProfile(t *testing.T) {
+	profile := &DeviceProfile{Mode: "reminder", CostClass: "economy", MaxTokens: 300, Sinks: []string{"notion"}}
+
+	req := &Req{Text: "x"}
+	applyDeviceProfile(req, profile)
+	if req.Mode != "reminder" || req.CostClass != "economy" || req.MaxTokens != 300 || len(req.sinks) != 1 {
+		t.Errorf("Expected the profile's defaults, got %+v", req)
+	}
+
+	req = &Req{Text: "x", Mode: "note", CostClass: "premium", MaxTokens: 1200}
+	applyDeviceProfile(req, profile)
+	if req.Mode != "note" || req.CostClass != "premium" || req.MaxTokens != 1200 {
+		t.Errorf("Expected the request's own values to win, got %+v", req)
+	}
+
+	req = &Req{Text: "x"}
+	applyDeviceProfile(req, nil)
+	if req.Mode != "" || req.sinks != nil {
+		t.Errorf("Expected no profile to change nothing, got %+v", req)
+	}
+}
+
+func TestValidateDeviceProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile DeviceProfile
+		wantErr string
+	}{
+		{name: "valid", profile: DeviceProfile{Mode: "shopping", CostClass: "economy", MaxTokens: 500, Sinks: []string{"dynamodb", "notion"}}},
+		{name: "empty", profile: DeviceProfile{}},
+		{name: "unknown mode", profile: DeviceProfile{Mode: "poetry"}, wantErr: "invalid profile mode"},
+		{name: "unknown cost class", profile: DeviceProfile{CostClass: "luxury"}, wantErr: "invalid profile costClass"},
+		{name: "too many tokens", profile: DeviceProfile{MaxTokens: 5000}, wantErr: "maxTokens"},
+		{name: "unknown sink", profile: DeviceProfile{Sinks: []string{"fax"}}, wantErr: "invalid profile sink: fax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDeviceProfile(tt.profile)
+			if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validateDeviceProfile() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeviceProfileFromEvent(t *testing.T) {
+	if profile := deviceProfileFromEvent(deviceEvent("", `{"mode":"shopping","maxTokens":300}`)); profile == nil || profile.Mode != "shopping" || profile.MaxTokens != 300 {
+		t.Errorf("Expected the context's profile, got %+v", profile)
+	}
+	if profile := deviceProfileFromEvent(deviceEvent("", `{"mode":`)); profile != nil {
+		t.Errorf("Expected an invalid profile to be ignored, got %+v", profile)
+	}
+	if profile := deviceProfileFromEvent(deviceEvent("", "")); profile != nil {
+		t.Errorf("Expected no profile, got %+v", profile)
+	}
+}
+
+func TestHandler_DeviceProfile(t *testing.T) {
+	home, notes := &stubSink{name: "ok"}, &stubSink{name: "notion"}
+	useSinks(t, home, notes)
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["ok"]}`)
+	model := &fakeBedrock{text: `{"action":"reminder","title":"Milk","markdown":"Buy milk","shortText":"Buy milk"}`}
+	useFakeBedrock(t, model)
+
+	resp, _ := handler(context.Background(), deviceEvent(`{"text":"buy milk tomorrow"}`, `{"mode":"reminder","maxTokens":300,"sinks":["notion"]}`))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	var sent struct {
+		MaxTokens int `json:"max_tokens"`
+	}
+	json.Unmarshal(model.body, &sent)
+	if sent.MaxTokens != 300 {
+		t.Errorf("Expected the profile's maxTokens sent to Bedrock, got %d", sent.MaxTokens)
+	}
+	if notes.got == nil || home.got != nil {
+		t.Errorf("Expected delivery to the profile's sinks only (notion %v, ok %v)", notes.got != nil, home.got != nil)
+	}
+
+	// The merged request is validated like any other
+	resp, _ = handler(context.Background(), deviceEvent(`{"text":"buy milk","costClass":"luxury"}`, `{"mode":"reminder"}`))
+	if resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for an invalid request field, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleAdmin_DeviceProfile(t *testing.T) {
+	hash := tokenHash("secret-token")
+	db := &fakeDynamo{scanItems: []map[string]types.AttributeValue{
+		registryItem(t, AdminToken{TokenHash: hash, Name: "Kitchen iPad"}),
+	}}
+	useTokenTable(t, db)
+	id := hash[:16]
+
+	resp, _ := handler(context.Background(), adminEvent("PATCH", "/admin/tokens/{id}", id, `{"profile":{"mode":"shopping","sinks":["notion"]}}`))
+	if resp.StatusCode != 200 || aws.ToString(db.updates[0].UpdateExpression) != "SET profile = :profile" {
+		t.Fatalf("Unexpected profile update: %d %s", resp.StatusCode, aws.ToString(db.updates[0].UpdateExpression))
+	}
+	profile := db.updates[0].ExpressionAttributeValues[":profile"].(*types.AttributeValueMemberM).Value
+	if profile["mode"].(*types.AttributeValueMemberS).Value != "shopping" {
+		t.Errorf("Unexpected stored profile: %v", profile)
+	}
+
+	resp, _ = handler(context.Background(), adminEvent("PATCH", "/admin/tokens/{id}", id, `{"name":"iPad","profile":{}}`))
+	if resp.StatusCode != 200 || aws.ToString(db.updates[1].UpdateExpression) != "SET #name = :name REMOVE profile" {
+		t.Errorf("Unexpected profile removal: %d %s", resp.StatusCode, aws.ToString(db.updates[1].UpdateExpression))
+	}
+
+	resp, _ = handler(context.Background(), adminEvent("POST", "/admin/tokens", "", `{"name":"Watch","profile":{"mode":"poetry"}}`))
+	if resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for an invalid profile, got %d", resp.StatusCode)
+	}
+}
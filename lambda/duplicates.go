@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Near-duplicate detection defaults: how far back to look, how similar two captures must
+// be, and the most stored captures compared against
+const (
+	defaultDuplicateWindowHours = 24
+	defaultDuplicateThreshold   = 0.8
+	maxDuplicateCandidates      = 200
+	minHashFunctions            = 128
+	shingleRunes                = 3
+)
+
+// duplicateActions are the captures that become entries somewhere; answers, drafts and
+// lists that merge into an existing one are never flagged
+var duplicateActions = map[string]bool{"note": true, "reminder": true, "event": true}
+
+// DuplicateRef points at the stored capture a new one repeats
+type DuplicateRef struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	CreatedAt  string  `json:"createdAt"`
+	Similarity float64 `json:"similarity"` // estimated Jaccard similarity, 0-1
+}
+
+// minHashSeeds holds the multiplier and offset of each hash function, fixed so
+// signatures are comparable across invocations
+var minHashSeeds = func() [minHashFunctions][2]uint64 {
+	var seeds [minHashFunctions][2]uint64
+	state := uint64(0x9e3779b97f4a7c15)
+	next := func() uint64 { // splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		return z ^ (z >> 31)
+	}
+	for i := range seeds {
+		seeds[i] = [2]uint64{next() | 1, next()}
+	}
+	return seeds
+}()
+
+// duplicateWindow reads DUPLICATE_WINDOW_HOURS; 0 turns detection off
+func duplicateWindow() time.Duration {
+	hours := defaultDuplicateWindowHours
+	if env := os.Getenv("DUPLICATE_WINDOW_HOURS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			hours = n
+		} else {
+			log.Printf("Invalid DUPLICATE_WINDOW_HOURS value: %s, using default", env)
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// duplicateThreshold reads DUPLICATE_THRESHOLD, the similarity at which captures match
+func duplicateThreshold() float64 {
+	if env := os.Getenv("DUPLICATE_THRESHOLD"); env != "" {
+		if f, err := strconv.ParseFloat(env, 64); err == nil && f > 0 && f <= 1 {
+			return f
+		}
+		log.Printf("Invalid DUPLICATE_THRESHOLD value: %s, using default", env)
+	}
+	return defaultDuplicateThreshold
+}
+
+// shingles splits text into overlapping character trigrams after lowercasing it and
+// reducing markdown and punctuation to single spaces
+func shingles(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	runes := []rune(strings.Join(words, " "))
+	set := map[string]bool{}
+	if len(runes) == 0 {
+		return set
+	}
+	if len(runes) < shingleRunes {
+		set[string(runes)] = true
+		return set
+	}
+	for i := 0; i+shingleRunes <= len(runes); i++ {
+		set[string(runes[i:i+shingleRunes])] = true
+	}
+	return set
+}
+
+// minHash returns the MinHash signature of a capture's title and body, or nil when
+// there is no text to compare
+func minHash(title, markdown string) []uint64 {
+	set := shingles(title + " " + markdown)
+	if len(set) == 0 {
+		return nil
+	}
+	sig := make([]uint64, minHashFunctions)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for shingle := range set {
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		x := h.Sum64()
+		for i, seed := range minHashSeeds {
+			if v := x*seed[0] + seed[1]; v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// signatureSimilarity estimates the Jaccard similarity of two shingle sets from their signatures
+func signatureSimilarity(a, b []uint64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// sameWhen reports whether two reminders or events are for the same time. Saying
+// "call mom" for Monday and again for Friday is two reminders, not a repeat.
+func sameWhen(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ta, errA := time.Parse(time.RFC3339, *a)
+	tb, errB := time.Parse(time.RFC3339, *b)
+	if errA != nil || errB != nil {
+		return *a == *b
+	}
+	return ta.Equal(tb)
+}
+
+// findDuplicate returns the most similar stored capture of the same action at or above
+// threshold, or nil when none is
+func findDuplicate(resp Response, stored []HistoryItem, selfID string, threshold float64) *DuplicateRef {
+	sig := minHash(resp.Title, resp.Markdown)
+	if sig == nil {
+		return nil
+	}
+	var best *DuplicateRef
+	for _, item := range stored {
+		if item.ID == selfID || item.Action != resp.Action || item.Deleted {
+			continue
+		}
+		if resp.Action == "reminder" && !sameWhen(resp.DueISO, item.DueISO) {
+			continue
+		}
+		if resp.Action == "event" && !sameWhen(resp.StartISO, item.StartISO) {
+			continue
+		}
+		similarity := signatureSimilarity(sig, minHash(item.Title, item.Markdown))
+		if similarity >= threshold && (best == nil || similarity > best.Similarity) {
+			best = &DuplicateRef{ID: item.ID, Title: item.Title, CreatedAt: item.CreatedAt, Similarity: similarity}
+		}
+	}
+	return best
+}
+
+// checkDuplicate flags a capture that repeats one stored within DUPLICATE_WINDOW_HOURS
+// and reports whether it should be held back from the sinks. Storage errors are logged
+// and skipped - an unchecked capture is stored as usual.
+func checkDuplicate(ctx context.Context, req *Req, meta captureMeta, resp *Response) bool {
+	if historyTableName == "" || req.AllowDuplicate || !duplicateActions[resp.Action] {
+		return false
+	}
+	window := duplicateWindow()
+	if window == 0 {
+		return false
+	}
+	stored, err := loadCapturesSince(ctx, meta.Principal, meta.CreatedAt.Add(-window), maxDuplicateCandidates)
+	if err != nil {
+		log.Printf("Failed to load recent captures, skipping duplicate check: %v", err)
+		return false
+	}
+	dup := findDuplicate(*resp, stored, meta.ID, duplicateThreshold())
+	if dup == nil {
+		return false
+	}
+	resp.Duplicate = dup
+	resp.ID = ""
+	resp.Warnings = append(resp.Warnings, fmt.Sprintf("Not saved: this looks like %q from %s. Send again with allowDuplicate to save it anyway.", dup.Title, dup.CreatedAt))
+	return true
+}
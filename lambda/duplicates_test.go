@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignatureSimilarity(t *testing.T) {
+	a := minHash("Buy milk", "- Buy **milk** and eggs")
+	if got := signatureSimilarity(a, minHash("buy milk", "Buy milk and eggs!")); got != 1 {
+		t.Errorf("same words, different markdown: similarity = %v, want 1", got)
+	}
+	if got := signatureSimilarity(a, minHash("Book flights", "Look at flights to Lisbon for May")); got > 0.2 {
+		t.Errorf("unrelated text: similarity = %v", got)
+	}
+	if minHash("", "**") != nil {
+		t.Error("minHash of no text should be nil")
+	}
+}
+
+func TestFindDuplicate(t *testing.T) {
+	due := func(s string) *string { return &s }
+	stored := []HistoryItem{
+		{ID: "note", Action: "note", Title: "Call mom", Markdown: "Call mom about the weekend"},
+		{ID: "friday", Action: "reminder", Title: "Call mom", Markdown: "Call mom about the weekend", DueISO: due("2025-01-17T18:00:00Z")},
+		{ID: "monday", Action: "reminder", Title: "Call mom", Markdown: "Call mom about the weekend.", DueISO: due("2025-01-13T18:00:00Z")},
+		{ID: "deleted", Action: "reminder", Title: "Call mom", Markdown: "Call mom about the weekend", DueISO: due("2025-01-13T18:00:00Z"), Deleted: true},
+		{ID: "other", Action: "reminder", Title: "Pay rent", Markdown: "Pay the rent", DueISO: due("2025-01-13T18:00:00Z")},
+	}
+	resp := Response{Action: "reminder", Title: "Call Mom", Markdown: "call mom about the weekend", DueISO: due("2025-01-13T19:00:00+01:00")}
+
+	dup := findDuplicate(resp, stored, "new", 0.8)
+	if dup == nil || dup.ID != "monday" || dup.Similarity != 1 {
+		t.Fatalf("duplicate = %+v, want monday", dup)
+	}
+	if dup := findDuplicate(resp, stored, "monday", 0.8); dup != nil {
+		t.Errorf("self match: duplicate = %+v", dup)
+	}
+	resp.DueISO = due("2025-01-14T18:00:00Z")
+	if dup := findDuplicate(resp, stored, "new", 0.8); dup != nil {
+		t.Errorf("different day: duplicate = %+v", dup)
+	}
+}
+
+func TestCheckDuplicate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	meta := captureMeta{ID: "new", Principal: "user-1", CreatedAt: now}
+	resp := func() *Response {
+		return &Response{Action: "note", Title: "Garden plan", Markdown: "Plant tomatoes by the fence", ID: "new"}
+	}
+	save := func(id string, created time.Time) {
+		saveCapture(ctx, newHistoryItem(captureMeta{ID: id, Principal: "user-1", Mode: "note", CreatedAt: created}, *resp()))
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if checkDuplicate(ctx, &Req{}, meta, resp()) {
+			t.Error("held back without history storage")
+		}
+	})
+
+	t.Run("recent repeat", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		save("old", now.Add(-2*time.Hour))
+		r := resp()
+		if !checkDuplicate(ctx, &Req{}, meta, r) {
+			t.Fatal("repeat was not held back")
+		}
+		if r.Duplicate == nil || r.Duplicate.ID != "old" || r.ID != "" || len(r.Warnings) != 1 {
+			t.Errorf("response = %+v", r)
+		}
+		if checkDuplicate(ctx, &Req{AllowDuplicate: true}, meta, resp()) {
+			t.Error("held back with allowDuplicate")
+		}
+		t.Setenv("DUPLICATE_WINDOW_HOURS", "1")
+		if checkDuplicate(ctx, &Req{}, meta, resp()) {
+			t.Error("held back outside the window")
+		}
+		t.Setenv("DUPLICATE_WINDOW_HOURS", "0")
+		if checkDuplicate(ctx, &Req{}, meta, resp()) {
+			t.Error("held back with detection off")
+		}
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{err: errors.New("throttled")})
+		r := resp()
+		if checkDuplicate(ctx, &Req{}, meta, r) || r.Duplicate != nil {
+			t.Errorf("response = %+v", r)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Upper bound on recipients for a dictated email
+const maxEmailRecipients = 10
+
+// sesAPI is the subset of the SES v2 client used by the handler
+type sesAPI interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+var sesClient sesAPI
+
+// EmailDraft is the email extracted in email mode; Sent/MessageID are set once dispatched via SES
+type EmailDraft struct {
+	To        []string `json:"to"`
+	Subject   string   `json:"subject"`
+	Body      string   `json:"body"`
+	Sent      bool     `json:"sent"`
+	MessageID string   `json:"messageId,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// finalizeEmail normalizes the model's draft and, when the client sent send:true, dispatches it
+// through SES. Send failures are reported on the draft so the user can retry from the phone.
+func finalizeEmail(ctx context.Context, req *Req, resp *Response) {
+	if resp.Email == nil {
+		// Fallback path (unstructured model output): draft from the title and content
+		resp.Email = &EmailDraft{Subject: resp.Title, Body: resp.Markdown}
+	}
+	resp.Action = "email"
+
+	draft := resp.Email
+	draft.To = normalizeRecipients(draft.To)
+	if strings.TrimSpace(draft.Subject) == "" {
+		draft.Subject = resp.Title
+	}
+	if strings.TrimSpace(draft.Body) == "" {
+		draft.Body = resp.Markdown
+	}
+	// Only a send below reports one; the model's claims about it are discarded
+	draft.Sent, draft.MessageID, draft.Error = false, "", ""
+
+	if !req.Send {
+		return
+	}
+
+	messageID, err := sendEmail(ctx, draft)
+	if err != nil {
+		log.Printf("Email send failed: %v", err)
+		draft.Error = err.Error()
+		return
+	}
+	draft.Sent = true
+	draft.MessageID = messageID
+}
+
+// normalizeRecipients keeps parseable, de-duplicated addresses up to maxEmailRecipients
+func normalizeRecipients(to []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, raw := range to {
+		addr, err := mail.ParseAddress(strings.TrimSpace(raw))
+		if err != nil {
+			continue
+		}
+		key := strings.ToLower(addr.Address)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, addr.Address)
+		if len(out) == maxEmailRecipients {
+			break
+		}
+	}
+	return out
+}
+
+// recipientAllowed checks an address against SES_ALLOWED_RECIPIENTS (comma-separated
+// addresses or @domain entries). An empty allowlist permits any recipient; dictated
+// emails are refused outright without one (see sendEmail).
+func recipientAllowed(address string) bool {
+	allowlist := os.Getenv("SES_ALLOWED_RECIPIENTS")
+	if allowlist == "" {
+		return true
+	}
+	address = strings.ToLower(address)
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "@") && strings.HasSuffix(address, entry) {
+			return true
+		}
+		if entry == address {
+			return true
+		}
+	}
+	return false
+}
+
+// sendEmail dispatches the draft from the verified SES_FROM_ADDRESS identity. Its
+// recipients come from dictated (or injected) text, so it fails closed: nothing is sent
+// unless SES_ALLOWED_RECIPIENTS names who may receive mail.
+func sendEmail(ctx context.Context, draft *EmailDraft) (string, error) {
+	if strings.TrimSpace(os.Getenv("SES_ALLOWED_RECIPIENTS")) == "" {
+		return "", fmt.Errorf("email sending requires SES_ALLOWED_RECIPIENTS")
+	}
+	return sendSESEmail(ctx, draft.To, draft.Subject, draft.Body, "")
+}
+
+// sendSESEmail sends a plain-text email, with an HTML alternative when html is set, from
+// SES_FROM_ADDRESS. Every recipient must pass SES_ALLOWED_RECIPIENTS.
+func sendSESEmail(ctx context.Context, to []string, subject, text, html string) (string, error) {
+	from := os.Getenv("SES_FROM_ADDRESS")
+	if from == "" {
+		return "", fmt.Errorf("email sending is not configured")
+	}
+	if len(to) == 0 {
+		return "", fmt.Errorf("no valid recipient addresses in draft")
+	}
+	for _, address := range to {
+		if !recipientAllowed(address) {
+			return "", fmt.Errorf("recipient %s is not in the allowed list", address)
+		}
+	}
+
+	body := &sestypes.Body{
+		Text: &sestypes.Content{Data: aws.String(text), Charset: aws.String("UTF-8")},
+	}
+	if html != "" {
+		body.Html = &sestypes.Content{Data: aws.String(html), Charset: aws.String("UTF-8")}
+	}
+	output, err := sesClient.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(from),
+		Destination:      &sestypes.Destination{ToAddresses: to},
+		Content: &sestypes.EmailContent{
+			Simple: &sestypes.Message{
+				Subject: &sestypes.Content{Data: aws.String(subject), Charset: aws.String("UTF-8")},
+				Body:    body,
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("SES SendEmail failed: %w", err)
+	}
+	return aws.ToString(output.MessageId), nil
+}
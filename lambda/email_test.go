@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// fakeSES records SendEmail calls
+type fakeSES struct {
+	input *sesv2.SendEmailInput
+	err   error
+}
+
+func (f *fakeSES) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	f.input = params
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sesv2.SendEmailOutput{MessageId: aws.String("msg-1")}, nil
+}
+
+func useFakeSES(t *testing.T, f *fakeSES) {
+	t.Helper()
+	orig := sesClient
+	sesClient = f
+	t.Cleanup(func() { sesClient = orig })
+}
+
+func TestNormalizeRecipients(t *testing.T) {
+	got := normalizeRecipients([]string{"Bob <bob@example.com>", "bob@example.com", "not an email", " alice@example.com "})
+	if len(got) != 2 || got[0] != "bob@example.com" || got[1] != "alice@example.com" {
+		t.Errorf("normalizeRecipients() = %v", got)
+	}
+}
+
+func TestRecipientAllowed(t *testing.T) {
+	t.Setenv("SES_ALLOWED_RECIPIENTS", "")
+	if !recipientAllowed("anyone@example.com") {
+		t.Error("Expected empty allowlist to permit any recipient")
+	}
+
+	t.Setenv("SES_ALLOWED_RECIPIENTS", "@family.example, boss@work.example")
+	if !recipientAllowed("Mom@Family.example") || !recipientAllowed("boss@work.example") {
+		t.Error("Expected domain and exact matches to be allowed")
+	}
+	if recipientAllowed("stranger@example.com") {
+		t.Error("Expected unlisted recipient to be rejected")
+	}
+}
+
+func TestFinalizeEmail_DraftOnly(t *testing.T) {
+	ses := &fakeSES{}
+	useFakeSES(t, ses)
+
+	resp := &Response{Title: "Lunch", Markdown: "Are you free?", Email: &EmailDraft{To: []string{"sam@example.com"}, Sent: true, MessageID: "fake", Error: "fake"}}
+	finalizeEmail(context.Background(), &Req{Mode: "email"}, resp)
+
+	if resp.Email.Sent || ses.input != nil {
+		t.Error("Expected draft only without send:true")
+	}
+	if resp.Email.MessageID != "" || resp.Email.Error != "" {
+		t.Errorf("Expected the model's send fields to be cleared, got %+v", resp.Email)
+	}
+	if resp.Email.Subject != "Lunch" || resp.Email.Body != "Are you free?" {
+		t.Errorf("Expected subject/body filled from response, got %+v", resp.Email)
+	}
+	if resp.Action != "email" {
+		t.Errorf("Expected action email, got %s", resp.Action)
+	}
+}
+
+func TestFinalizeEmail_Send(t *testing.T) {
+	ses := &fakeSES{}
+	useFakeSES(t, ses)
+	t.Setenv("SES_FROM_ADDRESS", "agent@example.com")
+	t.Setenv("SES_ALLOWED_RECIPIENTS", "@example.com")
+
+	resp := &Response{Email: &EmailDraft{To: []string{"sam@example.com"}, Subject: "Hi", Body: "Hello"}}
+	finalizeEmail(context.Background(), &Req{Mode: "email", Send: true}, resp)
+
+	if !resp.Email.Sent || resp.Email.MessageID != "msg-1" {
+		t.Errorf("Expected sent email, got %+v", resp.Email)
+	}
+	if aws.ToString(ses.input.FromEmailAddress) != "agent@example.com" {
+		t.Errorf("Expected verified from address, got %s", aws.ToString(ses.input.FromEmailAddress))
+	}
+}
+
+func TestFinalizeEmail_SendFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		allowed string
+		to      []string
+		sesErr  error
+	}{
+		{name: "not configured", from: "", allowed: "@example.com", to: []string{"sam@example.com"}},
+		{name: "no allowlist", from: "agent@example.com", to: []string{"sam@example.com"}},
+		{name: "no recipients", from: "agent@example.com", allowed: "@example.com", to: nil},
+		{name: "recipient not allowed", from: "agent@example.com", allowed: "@family.example", to: []string{"sam@example.com"}},
+		{name: "ses error", from: "agent@example.com", allowed: "@example.com", to: []string{"sam@example.com"}, sesErr: errors.New("not verified")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ses := &fakeSES{err: tt.sesErr}
+			useFakeSES(t, ses)
+			t.Setenv("SES_FROM_ADDRESS", tt.from)
+			t.Setenv("SES_ALLOWED_RECIPIENTS", tt.allowed)
+
+			resp := &Response{Email: &EmailDraft{To: tt.to, Subject: "Hi", Body: "Hello"}}
+			finalizeEmail(context.Background(), &Req{Mode: "email", Send: true}, resp)
+
+			if resp.Email.Sent || resp.Email.Error == "" {
+				t.Errorf("Expected send failure to be reported, got %+v", resp.Email)
+			}
+			if tt.sesErr == nil && ses.input != nil {
+				t.Error("Expected SES not to be called")
+			}
+		})
+	}
+}
+
+func TestFinalizeEmail_FallbackDraft(t *testing.T) {
+	resp := &Response{Title: "Note to self", Markdown: "Body text"}
+	finalizeEmail(context.Background(), &Req{Mode: "email"}, resp)
+
+	if resp.Email == nil || resp.Email.Subject != "Note to self" || len(resp.Email.To) != 0 {
+		t.Errorf("Expected fallback draft, got %+v", resp.Email)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"wrist-agent/apierror"
+)
+
+// Export limits: notes read per export, the largest zip returned in the response body
+// (Lambda caps responses at 6 MB, and base64 adds a third), and how long export links last
+const (
+	maxExportNotes       = 10000
+	maxInlineExportBytes = 4 << 20
+	exportURLExpiry      = time.Hour
+	exportSlugRunes      = 60
+)
+
+// ExportResult is the GET /export?delivery=url body: a presigned link to the zip
+type ExportResult struct {
+	URL       string `json:"url"`
+	Notes     int    `json:"notes"`
+	Bytes     int    `json:"bytes"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// exportSlug turns a note title into a file name: lowercase letters and digits joined by dashes
+func exportSlug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	runes := []rune(b.String())
+	if len(runes) > exportSlugRunes {
+		runes = runes[:exportSlugRunes]
+	}
+	slug := strings.TrimRight(string(runes), "-")
+	if slug == "" {
+		return "note"
+	}
+	return slug
+}
+
+// buildNotesZip writes each note as notes/<date>-<slug>.md with the same YAML
+// frontmatter the s3 sink uses, numbering names that would collide
+func buildNotesZip(notes []HistoryItem) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	used := map[string]bool{}
+	for _, note := range notes {
+		created, _ := time.Parse(time.RFC3339, note.CreatedAt)
+		base := "notes/" + created.UTC().Format("2006-01-02") + "-" + exportSlug(note.Title)
+		name := base + ".md"
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d.md", base, n)
+		}
+		used[name] = true
+
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to export: %w", name, err)
+		}
+		meta := captureMeta{ID: note.ID, Principal: note.Principal, Mode: note.Mode, CreatedAt: created}
+		if _, err := f.Write([]byte(markdownDocument(meta, historyResponse(note)))); err != nil {
+			return nil, fmt.Errorf("failed to write %s to export: %w", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish export: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// loadExportNotes returns the principal's notes that pass the filter, oldest first
+func loadExportNotes(ctx context.Context, principal string, filter SearchQuery) ([]HistoryItem, error) {
+	stored, err := loadCapturesByAction(ctx, principal, "note", maxExportNotes)
+	if err != nil {
+		return nil, err
+	}
+	var notes []HistoryItem
+	for i := len(stored) - 1; i >= 0; i-- {
+		if matchesSearch(stored[i], filter) {
+			notes = append(notes, stored[i])
+		}
+	}
+	return notes, nil
+}
+
+// uploadExport stores the zip under exports/<principal>/ and presigns a GET for it
+func uploadExport(ctx context.Context, principal, filename string, archive []byte) (string, error) {
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" {
+		return "", fmt.Errorf("CAPTURE_BUCKET_NAME not configured")
+	}
+	key := fmt.Sprintf("exports/%s/%s", principal, filename)
+	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(key),
+		Body:               bytes.NewReader(archive),
+		ContentType:        aws.String("application/zip"),
+		ContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="%s"`, filename)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("S3 PutObject failed: %w", err)
+	}
+
+	presigned, err := s3Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(exportURLExpiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign export URL: %w", err)
+	}
+	return presigned.URL, nil
+}
+
+// isExportRequest reports whether the route is the export endpoint
+func isExportRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/export"
+}
+
+// handleExport serves GET /export, a zip of the caller's notes as markdown files,
+// filtered by from, to and tag like GET /search. delivery=zip (the default) returns the
+// zip itself; delivery=url stores it in S3 and returns a presigned link, for exports too
+// large for a Lambda response.
+func handleExport(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+	filter, err := parseCaptureFilter(event.QueryStringParameters)
+	if err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+	}
+	delivery := event.QueryStringParameters["delivery"]
+	if delivery == "" {
+		delivery = "zip"
+	}
+	if delivery != "zip" && delivery != "url" {
+		return errorResponse(ctx, apierror.InvalidRequest("delivery must be zip or url"))
+	}
+
+	principal := principalFromEvent(event)
+	notes, err := loadExportNotes(ctx, principal, filter)
+	if err != nil {
+		log.Printf("Failed to load notes for export: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load notes"))
+	}
+	archive, err := buildNotesZip(notes)
+	if err != nil {
+		log.Printf("Export failed: %v", err)
+		return errorResponse(ctx, apierror.Internal("Export failed"))
+	}
+	now := time.Now().UTC()
+	filename := "wrist-agent-notes-" + now.Format("20060102T150405Z") + ".zip"
+
+	if delivery == "url" {
+		url, err := uploadExport(ctx, principal, filename, archive)
+		if err != nil {
+			log.Printf("Failed to upload export: %v", err)
+			return errorResponse(ctx, apierror.Internal("Export failed"))
+		}
+		return apiResponse(200, ExportResult{
+			URL:       url,
+			Notes:     len(notes),
+			Bytes:     len(archive),
+			ExpiresAt: now.Add(exportURLExpiry).Format(time.RFC3339),
+		})
+	}
+
+	if len(archive) > maxInlineExportBytes {
+		return errorResponse(ctx, apierror.PayloadTooLarge(fmt.Sprintf("Export is %d bytes, too large to return directly; use delivery=url", len(archive))))
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":        "application/zip",
+			"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, filename),
+		},
+		Body:            base64.StdEncoding.EncodeToString(archive),
+		IsBase64Encoded: true,
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestExportSlug(t *testing.T) {
+	tests := map[string]string{
+		"Q1 Marketing Strategy!":  "q1-marketing-strategy",
+		"  Café: crème brûlée  ":  "café-crème-brûlée",
+		"???":                     "note",
+		strings.Repeat("ab ", 40): strings.TrimSuffix(strings.Repeat("ab-", 20), "-"),
+	}
+	for title, want := range tests {
+		if got := exportSlug(title); got != want {
+			t.Errorf("exportSlug(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+// unzipExport returns the files in an export zip by name
+func unzipExport(t *testing.T, archive []byte) map[string]string {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, _ := f.Open()
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(body)
+	}
+	return files
+}
+
+func TestHandleExport(t *testing.T) {
+	call := func(params map[string]string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/export", QueryStringParameters: params}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call(nil); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503", resp.StatusCode)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+	ctx := context.Background()
+	save := func(id, action, title, createdAt string, tags ...string) {
+		created, _ := time.Parse(time.RFC3339, createdAt)
+		saveCapture(ctx, newHistoryItem(captureMeta{ID: id, Principal: "user-1", Mode: action, CreatedAt: created}, Response{Action: action, Title: title, Markdown: "Body of " + title, Tags: tags}))
+	}
+	save("20250103T090000Z-a", "note", "Garden plan", "2025-01-03T09:00:00Z", "home")
+	save("20250105T090000Z-b", "note", "Garden plan", "2025-01-03T18:00:00Z")
+	save("20250110T090000Z-c", "note", "Book list", "2025-01-10T09:00:00Z", "reading")
+	save("20250111T090000Z-d", "reminder", "Call mom", "2025-01-11T09:00:00Z")
+
+	t.Run("zip", func(t *testing.T) {
+		resp := call(nil)
+		if resp.StatusCode != 200 || !resp.IsBase64Encoded || resp.Headers["Content-Type"] != "application/zip" {
+			t.Fatalf("got %d %v: %s", resp.StatusCode, resp.Headers, resp.Body)
+		}
+		archive, _ := base64.StdEncoding.DecodeString(resp.Body)
+		files := unzipExport(t, archive)
+		var names []string
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		want := "notes/2025-01-03-garden-plan-2.md,notes/2025-01-03-garden-plan.md,notes/2025-01-10-book-list.md"
+		if strings.Join(names, ",") != want {
+			t.Fatalf("files = %v", names)
+		}
+		doc := files["notes/2025-01-03-garden-plan.md"]
+		if !strings.HasPrefix(doc, "---\nid: 20250103T090000Z-a\ntitle: \"Garden plan\"\n") || !strings.Contains(doc, "tags: [home]") || !strings.HasSuffix(doc, "Body of Garden plan\n") {
+			t.Errorf("document = %q", doc)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		resp := call(map[string]string{"from": "2025-01-04", "tag": "Reading"})
+		archive, _ := base64.StdEncoding.DecodeString(resp.Body)
+		files := unzipExport(t, archive)
+		if _, ok := files["notes/2025-01-10-book-list.md"]; !ok || len(files) != 1 {
+			t.Errorf("files = %v", files)
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		store := &fakeS3{}
+		useFakeS3(t, store, &fakePresigner{})
+		t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+		resp := call(map[string]string{"delivery": "url"})
+		var result ExportResult
+		json.Unmarshal([]byte(resp.Body), &result)
+		if resp.StatusCode != 200 || result.Notes != 3 || !strings.HasPrefix(store.key, "exports/user-1/wrist-agent-notes-") || !strings.Contains(result.URL, store.key) {
+			t.Errorf("got %d %+v, stored at %s", resp.StatusCode, result, store.key)
+		}
+		if len(unzipExport(t, []byte(store.body))) != 3 || result.Bytes != len(store.body) {
+			t.Errorf("uploaded %d bytes, reported %d", len(store.body), result.Bytes)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, params := range []map[string]string{{"delivery": "email"}, {"from": "soon"}} {
+			if resp := call(params); resp.StatusCode != 400 {
+				t.Errorf("%v: StatusCode = %d, want 400", params, resp.StatusCode)
+			}
+		}
+	})
+}
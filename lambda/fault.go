@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"wrist-agent/apierror"
+)
+
+// faultHeader asks for a forced failure so clients can exercise their error handling
+// end-to-end. It is honored for admin tokens, or for anyone when the deployment opts in.
+const faultHeader = "X-Wrist-Fault"
+
+// Faults a request can ask for
+const (
+	faultTimeout   = "timeout"        // 504 with API Gateway's integration timeout body
+	faultThrottled = "429"            // the throttling error a busy Bedrock produces, with Retry-After
+	faultMalformed = "malformed-json" // 200 whose body isn't valid JSON
+	faultTruncated = "truncated"      // the real response with its body cut off partway
+)
+
+var faultNames = []string{faultTimeout, faultThrottled, faultMalformed, faultTruncated}
+
+// faultInjectionEnabled reports whether this is a test deployment where any caller may
+// inject faults: FAULT_INJECTION_ENABLED must be true
+func faultInjectionEnabled() bool {
+	return strings.EqualFold(os.Getenv("FAULT_INJECTION_ENABLED"), "true")
+}
+
+// requestedFault returns the fault the request asks for, or "" when there is no header or
+// the caller may not inject faults. Unknown faults are an error so typos don't pass silently.
+func requestedFault(event events.APIGatewayProxyRequest) (string, error) {
+	fault := strings.ToLower(strings.TrimSpace(requestHeader(event, faultHeader)))
+	if fault == "" {
+		return "", nil
+	}
+	if !callerIsAdmin(event) && !faultInjectionEnabled() {
+		log.Printf("Ignoring %s header from non-admin principal %s", faultHeader, principalFromEvent(event))
+		return "", nil
+	}
+	for _, name := range faultNames {
+		if fault == name {
+			log.Printf("Injecting %s fault for principal %s", fault, principalFromEvent(event))
+			return fault, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s: %s (valid: %s)", faultHeader, fault, strings.Join(faultNames, ", "))
+}
+
+// faultResponse is the response for faults that replace the request entirely; ok is
+// false for faults applied to the real response instead
+func faultResponse(ctx context.Context, fault string) (resp events.APIGatewayProxyResponse, ok bool) {
+	switch fault {
+	case faultTimeout:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 504,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       `{"message": "Endpoint request timed out"}`,
+		}, true
+	case faultThrottled:
+		return errorResponse(ctx, bedrockError(&types.ThrottlingException{})), true
+	case faultMalformed:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       `{"title": "Fault injected", "markdown": "This body is not valid JSON", "shortText": }`,
+		}, true
+	}
+	return events.APIGatewayProxyResponse{}, false
+}
+
+// truncateBody cuts a response body off halfway, at a rune boundary, as if the
+// connection dropped mid-transfer
+func truncateBody(resp *events.APIGatewayProxyResponse) {
+	cut := len(resp.Body) / 2
+	for cut > 0 && !utf8.RuneStart(resp.Body[cut]) {
+		cut--
+	}
+	resp.Body = resp.Body[:cut]
+}
+
+// handleFault validates the fault header and, when a fault applies, returns the
+// response that replaces the request's
+func handleFault(ctx context.Context, event events.APIGatewayProxyRequest) (fault string, resp events.APIGatewayProxyResponse, handled bool) {
+	ctx = apierror.WithRequestID(ctx, event.RequestContext.RequestID)
+	fault, err := requestedFault(event)
+	if err != nil {
+		return "", errorResponse(ctx, apierror.InvalidRequest(err.Error())), true
+	}
+	resp, handled = faultResponse(ctx, fault)
+	return fault, resp, handled
+}
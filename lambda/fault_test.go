@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func faultEvent(stage, role, fault string) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/modes", Headers: map[string]string{"x-wrist-fault": fault}}
+	event.RequestContext.Stage = stage
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1", "role": role}
+	return event
+}
+
+func TestRequestedFault(t *testing.T) {
+	tests := []struct {
+		enabled, stage, role, header string
+		want                         string
+		wantErr                      bool
+	}{
+		{"", "prod", "", "", "", false},
+		{"", "prod", "", "429", "", false}, // ignored for ordinary tokens
+		{"", "dev", "", "429", "", false},  // whatever the stage
+		{"", "prod", "admin", "429", "429", false},
+		{"true", "dev", "", "Timeout", "timeout", false},
+		{"true", "dev", "", "slow", "", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("FAULT_INJECTION_ENABLED", tt.enabled)
+		got, err := requestedFault(faultEvent(tt.stage, tt.role, tt.header))
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s/%s/%s/%q: got %q, %v", tt.enabled, tt.stage, tt.role, tt.header, got, err)
+		}
+	}
+}
+
+func TestRequestedFault_FunctionURL(t *testing.T) {
+	// Function URL events have no stage, which must not open fault injection up
+	var req events.LambdaFunctionURLRequest
+	req.RawPath = "/modes"
+	req.RequestContext.HTTP.Method = "GET"
+	req.Headers = map[string]string{"x-wrist-fault": "429"}
+	req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+		IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserID: "AIDA123"},
+	}
+	event := functionURLEvent(req)
+	if event.RequestContext.Stage != "" {
+		t.Fatalf("Stage = %q", event.RequestContext.Stage)
+	}
+	if got, err := requestedFault(event); got != "" || err != nil {
+		t.Errorf("requestedFault() = %q, %v, want the header ignored", got, err)
+	}
+	if resp, _ := handler(context.Background(), event); resp.StatusCode == 429 {
+		t.Errorf("StatusCode = 429, fault was injected: %s", resp.Body)
+	}
+}
+
+func TestHandler_Faults(t *testing.T) {
+	t.Setenv("FAULT_INJECTION_ENABLED", "true")
+	call := func(fault string) events.APIGatewayProxyResponse {
+		resp, _ := handler(context.Background(), faultEvent("dev", "", fault))
+		return resp
+	}
+
+	if resp := call("timeout"); resp.StatusCode != 504 {
+		t.Errorf("timeout: StatusCode = %d, want 504", resp.StatusCode)
+	}
+	if resp := call("429"); resp.StatusCode != 429 || resp.Headers["Retry-After"] == "" {
+		t.Errorf("429: got %d, headers %v", resp.StatusCode, resp.Headers)
+	}
+	if resp := call("malformed-json"); resp.StatusCode != 200 || json.Valid([]byte(resp.Body)) {
+		t.Errorf("malformed-json: got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call("bogus"); resp.StatusCode != 400 {
+		t.Errorf("bogus: StatusCode = %d, want 400", resp.StatusCode)
+	}
+
+	full := call("")
+	truncated := call("truncated")
+	if truncated.StatusCode != 200 || json.Valid([]byte(truncated.Body)) || len(truncated.Body) != len(full.Body)/2 {
+		t.Errorf("truncated: got %d, %d of %d bytes", truncated.StatusCode, len(truncated.Body), len(full.Body))
+	}
+	if truncated.Headers["Access-Control-Allow-Origin"] != full.Headers["Access-Control-Allow-Origin"] {
+		t.Error("truncated response lost its CORS headers")
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// Response formats a request can ask for with "format", ?format= or an Accept header
+const (
+	formatJSON     = "json"     // the Response structure (default)
+	formatShortcut = "shortcut" // key=value lines for Apple Shortcuts
+	formatMarkdown = "markdown" // the markdown alone
+	formatText     = "text"     // the markdown with its syntax stripped
+	formatHTML     = "html"     // the markdown rendered as an HTML page
+)
+
+var responseFormats = []string{formatJSON, formatShortcut, formatMarkdown, formatText, formatHTML}
+
+// formatMediaTypes maps Accept media types to the formats they select; shortcut is only
+// chosen explicitly
+var formatMediaTypes = map[string]string{
+	"application/json": formatJSON,
+	"text/markdown":    formatMarkdown,
+	"text/plain":       formatText,
+	"text/html":        formatHTML,
+}
+
+// formatContentTypes are the Content-Type headers of the text formats
+var formatContentTypes = map[string]string{
+	formatShortcut: "text/plain; charset=utf-8",
+	formatMarkdown: "text/markdown; charset=utf-8",
+	formatText:     "text/plain; charset=utf-8",
+	formatHTML:     "text/html; charset=utf-8",
+}
+
+// negotiateFormat picks a response format from an Accept header, honoring q-values and
+// preferring json on ties so wildcard and JSON-first clients keep the JSON structure;
+// "" means the header didn't name a format
+func negotiateFormat(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		format, ok := formatMediaTypes[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		if q > bestQ || (q == bestQ && q > 0 && format == formatJSON) {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// shortcutKeys are the lines of a successful format=shortcut reply, always all of them
+// and in this order so a Shortcut can rely on them; unset values are empty
+var shortcutKeys = []string{"ok", "id", "action", "title", "shortText", "dueISO", "startISO", "endISO", "location", "priority", "tags", "warnings", "timerSeconds", "timerDuration"}
+
+// validateFormat checks the requested response format and the x-callback URLs that go
+// with format=shortcut
+func validateFormat(req *Req) error {
+	if req.Format == "" {
+		req.Format = formatJSON
+	}
+	if !slices.Contains(responseFormats, req.Format) {
+		return fmt.Errorf("invalid format: %s (valid: %s)", req.Format, strings.Join(responseFormats, ", "))
+	}
+	if (req.XSuccess != "" || req.XError != "") && req.Format != formatShortcut {
+		return fmt.Errorf("xSuccess and xError require format shortcut")
+	}
+	for name, value := range map[string]string{"xSuccess": req.XSuccess, "xError": req.XError} {
+		if err := validateCallbackScheme(value); err != nil {
+			return fmt.Errorf("%s %v", name, err)
+		}
+	}
+	return nil
+}
+
+// validateCallbackScheme accepts app URLs such as shortcuts://x-callback-url/... and
+// refuses schemes that would run or read something when opened
+func validateCallbackScheme(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("must be an absolute URL, e.g. shortcuts://x-callback-url/run-shortcut")
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "javascript", "data", "file", "vbscript":
+		return fmt.Errorf("scheme %s is not allowed", u.Scheme)
+	}
+	return nil
+}
+
+// formattedResponse renders a processed request in the format it asked for
+func formattedResponse(req *Req, version int, response *Response) events.APIGatewayProxyResponse {
+	var resp events.APIGatewayProxyResponse
+	switch req.Format {
+	case formatShortcut:
+		resp = shortcutResponse(req, response)
+	case formatMarkdown:
+		resp = plainResponse(200, response.Markdown)
+	case formatText:
+		resp = plainResponse(200, strings.TrimSpace(plainText(response.Markdown))+"\n")
+	case formatHTML:
+		resp = plainResponse(200, markdownHTMLPage(response.Title, response.Markdown))
+	default:
+		resp = apiResponse(200, renderResponse(version, response))
+	}
+	if contentType, ok := formatContentTypes[req.Format]; ok {
+		resp.Headers["Content-Type"] = contentType
+	}
+	// The same request can get a different body depending on its Accept header
+	addVary(resp.Headers, "Accept")
+	return resp
+}
+
+// shortcutResponse is the format=shortcut reply: every shortcutKeys line, plus the
+// xSuccess URL when one was given
+func shortcutResponse(req *Req, response *Response) events.APIGatewayProxyResponse {
+	values := map[string]string{
+		"ok":        "true",
+		"id":        response.ID,
+		"action":    response.Action,
+		"title":     response.Title,
+		"shortText": response.ShortText,
+		"dueISO":    derefOrEmpty(response.DueISO),
+		"startISO":  derefOrEmpty(response.StartISO),
+		"endISO":    derefOrEmpty(response.EndISO),
+		"location":  derefOrEmpty(response.Location),
+		"priority":  response.Priority,
+		"tags":      strings.Join(response.Tags, ","),
+		"warnings":  strings.Join(response.Warnings, "; "),
+	}
+	if response.Timer != nil {
+		values["timerSeconds"] = strconv.Itoa(response.Timer.Seconds)
+		values["timerDuration"] = response.Timer.Duration
+	}
+	lines := make([]string, 0, len(shortcutKeys)+1)
+	for _, key := range shortcutKeys {
+		lines = append(lines, shortcutLine(key, values[key]))
+	}
+	if req.XSuccess != "" {
+		lines = append(lines, shortcutLine("url", withQuery(req.XSuccess, url.Values{
+			"id": {response.ID}, "action": {response.Action}, "title": {response.Title}, "shortText": {response.ShortText},
+		})))
+	}
+	return plainResponse(200, strings.Join(lines, "\n")+"\n")
+}
+
+// formattedError renders an error for a request that asked for format=shortcut as
+// ok/error/message lines (plus the xError URL, following the x-callback-url
+// convention's errorCode and errorMessage). Every other format gets the JSON envelope,
+// so clients can keep branching on its code.
+func formattedError(ctx context.Context, req *Req, apiErr *apierror.Error) events.APIGatewayProxyResponse {
+	resp := errorResponse(ctx, apiErr)
+	if req.Format != formatShortcut {
+		return resp
+	}
+	lines := []string{
+		shortcutLine("ok", "false"),
+		shortcutLine("error", string(apiErr.Code)),
+		shortcutLine("message", apiErr.Message),
+	}
+	if req.XError != "" {
+		lines = append(lines, shortcutLine("url", withQuery(req.XError, url.Values{
+			"errorCode": {string(apiErr.Code)}, "errorMessage": {apiErr.Message},
+		})))
+	}
+	plain := plainResponse(apiErr.Status, strings.Join(lines, "\n")+"\n")
+	for name, value := range resp.Headers {
+		if name != "Content-Type" {
+			plain.Headers[name] = value
+		}
+	}
+	return plain
+}
+
+// shortcutLine is one key=value line; line breaks in the value become spaces so every
+// key stays on its own line
+func shortcutLine(key, value string) string {
+	return key + "=" + strings.Join(strings.Fields(strings.ReplaceAll(value, "\r", " ")), " ")
+}
+
+// withQuery adds parameters to a callback URL, keeping any it already has
+func withQuery(raw string, params url.Values) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// markdownHTMLPage renders markdown as a minimal HTML page titled with the capture's
+// title. It covers the syntax the model writes (the same the Notion sink understands):
+// headings, bulleted, numbered and task lists, quotes, fenced code, rules and
+// paragraphs with bold, italic, code and link formatting.
+func markdownHTMLPage(title, markdown string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">")
+	b.WriteString(`<meta name="viewport" content="width=device-width, initial-scale=1">`)
+	b.WriteString("<title>" + html.EscapeString(title) + "</title></head>\n<body>\n")
+	b.WriteString(markdownHTML(markdown))
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+// markdownHTML converts markdown into HTML block elements, one per line
+func markdownHTML(markdown string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+
+	var paragraph []string
+	list := "" // "ul" or "ol" while inside a list
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + inlineHTML(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	item := func(kind, content string) {
+		if list != kind {
+			flush()
+			b.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+		b.WriteString("<li>" + content + "</li>\n")
+	}
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case strings.HasPrefix(trimmed, "### "), strings.HasPrefix(trimmed, "## "), strings.HasPrefix(trimmed, "# "):
+			flush()
+			level, text, _ := strings.Cut(trimmed, " ")
+			tag := "h" + strconv.Itoa(len(level))
+			b.WriteString("<" + tag + ">" + inlineHTML(text) + "</" + tag + ">\n")
+
+		case trimmed == "---" || trimmed == "***":
+			flush()
+			b.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, "- [ ] ") || strings.HasPrefix(trimmed, "- [x] ") || strings.HasPrefix(trimmed, "- [X] "):
+			checked := ""
+			if trimmed[3] != ' ' {
+				checked = " checked"
+			}
+			item("ul", `<input type="checkbox" disabled`+checked+`> `+inlineHTML(trimmed[6:]))
+
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			item("ul", inlineHTML(trimmed[2:]))
+
+		case notionOrderedItem.MatchString(trimmed):
+			item("ol", inlineHTML(notionOrderedItem.ReplaceAllString(trimmed, "")))
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			b.WriteString("<blockquote>" + inlineHTML(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+
+		default:
+			if list != "" {
+				flush()
+			}
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// inlineHTML escapes text and renders its bold, italic, code and link formatting.
+// Only http(s) and mailto links become anchors; others keep just their text.
+func inlineHTML(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range notionInlineToken.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:m[0]]))
+		switch {
+		case m[2] >= 0:
+			b.WriteString("<strong>" + html.EscapeString(text[m[2]:m[3]]) + "</strong>")
+		case m[4] >= 0:
+			b.WriteString("<em>" + html.EscapeString(text[m[4]:m[5]]) + "</em>")
+		case m[6] >= 0:
+			b.WriteString("<em>" + html.EscapeString(text[m[6]:m[7]]) + "</em>")
+		case m[8] >= 0:
+			b.WriteString("<code>" + html.EscapeString(text[m[8]:m[9]]) + "</code>")
+		default:
+			label, href := html.EscapeString(text[m[10]:m[11]]), text[m[12]:m[13]]
+			lower := strings.ToLower(href)
+			if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "mailto:") {
+				b.WriteString(`<a href="` + html.EscapeString(href) + `">` + label + "</a>")
+			} else {
+				b.WriteString(label)
+			}
+		}
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// plainResponse is a text/plain API response
+func plainResponse(statusCode int, body string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		Body:       body,
+	}
+}
+
+// derefOrEmpty returns the string a pointer holds, or "" for nil
+func derefOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     Req
+		wantErr string
+	}{
+		{name: "default", req: Req{}},
+		{name: "shortcut", req: Req{Format: "shortcut"}},
+		{name: "callbacks", req: Req{Format: "shortcut", XSuccess: "shortcuts://x-callback-url/run-shortcut?name=Saved", XError: "shortcuts://x-callback-url/run-shortcut?name=Failed"}},
+		{name: "unknown format", req: Req{Format: "xml"}, wantErr: "invalid format: xml"},
+		{name: "callback without shortcut", req: Req{XSuccess: "shortcuts://x-callback-url/run-shortcut"}, wantErr: "require format shortcut"},
+		{name: "relative callback", req: Req{Format: "shortcut", XError: "/run"}, wantErr: "xError must be an absolute URL"},
+		{name: "script callback", req: Req{Format: "shortcut", XSuccess: "javascript:alert(1)"}, wantErr: "scheme javascript is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFormat(&tt.req)
+			if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validateFormat() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormattedResponse_Shortcut(t *testing.T) {
+	due := "2025-01-17T09:00:00Z"
+	response := &Response{ID: "abc", Action: "reminder", Title: "Call mom", ShortText: "Call mom\nat 9", DueISO: &due, Tags: []string{"family", "phone"}}
+	req := &Req{Format: formatShortcut, XSuccess: "shortcuts://x-callback-url/run-shortcut?name=Saved"}
+
+	resp := formattedResponse(req, 1, response)
+	if resp.StatusCode != 200 || resp.Headers["Content-Type"] != "text/plain; charset=utf-8" {
+		t.Fatalf("Unexpected response: %d %v", resp.StatusCode, resp.Headers)
+	}
+	lines := strings.Split(strings.TrimSuffix(resp.Body, "\n"), "\n")
+	if len(lines) != len(shortcutKeys)+1 {
+		t.Fatalf("Expected every key plus the url, got %q", resp.Body)
+	}
+	for i, key := range shortcutKeys {
+		if !strings.HasPrefix(lines[i], key+"=") {
+			t.Errorf("Expected line %d to be %s, got %q", i, key, lines[i])
+		}
+	}
+	for _, want := range []string{"ok=true", "shortText=Call mom at 9", "dueISO=2025-01-17T09:00:00Z", "tags=family,phone", "location="} {
+		if !strings.Contains(resp.Body, want+"\n") {
+			t.Errorf("Expected %q in %q", want, resp.Body)
+		}
+	}
+	callback, err := url.Parse(strings.TrimPrefix(lines[len(lines)-1], "url="))
+	if err != nil || callback.Query().Get("name") != "Saved" || callback.Query().Get("title") != "Call mom" || callback.Query().Get("id") != "abc" {
+		t.Errorf("Unexpected xSuccess URL: %s", lines[len(lines)-1])
+	}
+
+	if resp := formattedResponse(&Req{Format: formatJSON}, 1, response); resp.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Expected JSON by default, got %v", resp.Headers)
+	}
+}
+
+func TestFormattedError_Shortcut(t *testing.T) {
+	req := &Req{Format: formatShortcut, XError: "shortcuts://x-callback-url/run-shortcut?name=Failed"}
+	resp := formattedError(context.Background(), req, apierror.New(503, apierror.CodeServiceUnavailable, "Bedrock unavailable").WithRetryAfter(30*time.Second))
+	if resp.StatusCode != 503 || resp.Headers["Retry-After"] != "30" || resp.Headers["Content-Type"] != "text/plain; charset=utf-8" {
+		t.Fatalf("Unexpected error response: %d %v", resp.StatusCode, resp.Headers)
+	}
+	if !strings.HasPrefix(resp.Body, "ok=false\nerror=SERVICE_UNAVAILABLE\nmessage=Bedrock unavailable\nurl=") {
+		t.Errorf("Unexpected error body: %q", resp.Body)
+	}
+	if !strings.Contains(resp.Body, "errorCode=SERVICE_UNAVAILABLE") || !strings.Contains(resp.Body, "errorMessage=Bedrock+unavailable") {
+		t.Errorf("Expected the error in the xError URL, got %q", resp.Body)
+	}
+}
+
+func TestHandler_ShortcutFormat(t *testing.T) {
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"note","title":"Idea","markdown":"An idea","shortText":"An idea"}`})
+
+	resp, _ := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: `{"text":"an idea","format":"shortcut"}`})
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Body, "ok=true\nid=") || !strings.Contains(resp.Body, "\ntitle=Idea\n") {
+		t.Fatalf("Unexpected shortcut response: %d %q", resp.StatusCode, resp.Body)
+	}
+
+	// ?format= works for Shortcuts that can't set the body field, and errors follow it
+	resp, _ = handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:            "POST",
+		Body:                  `{"text":"an idea","mode":"poetry"}`,
+		QueryStringParameters: map[string]string{"format": "shortcut"},
+	})
+	if resp.StatusCode != 400 || !strings.HasPrefix(resp.Body, "ok=false\nerror=INVALID_REQUEST\n") {
+		t.Errorf("Unexpected shortcut error: %d %q", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"*/*", ""},
+		{"application/json", formatJSON},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatHTML},
+		{"text/plain", formatText},
+		{"text/markdown; charset=utf-8", formatMarkdown},
+		{"text/plain;q=0.5, text/markdown", formatMarkdown},
+		{"text/html, application/json", formatJSON},
+		{"text/html;q=0", ""},
+		{"image/png", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateFormat(tt.accept); got != tt.want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestFormattedResponse_TextFormats(t *testing.T) {
+	response := &Response{Title: "Trip <plan>", Markdown: "# Trip\n\n- **Pack** bags\n- Book [hotel](https://example.com)\n"}
+	tests := []struct {
+		format      string
+		contentType string
+		body        string
+	}{
+		{formatMarkdown, "text/markdown; charset=utf-8", response.Markdown},
+		{formatText, "text/plain; charset=utf-8", "Trip\n\nPack bags\nBook hotel\n"},
+	}
+	for _, tt := range tests {
+		resp := formattedResponse(&Req{Format: tt.format}, 1, response)
+		if resp.Headers["Content-Type"] != tt.contentType || resp.Body != tt.body || resp.Headers["Vary"] != "Accept" {
+			t.Errorf("format %s: got %v %q", tt.format, resp.Headers, resp.Body)
+		}
+	}
+
+	resp := formattedResponse(&Req{Format: formatHTML}, 1, response)
+	for _, want := range []string{"<title>Trip &lt;plan&gt;</title>", "<h1>Trip</h1>", "<li><strong>Pack</strong> bags</li>", `<a href="https://example.com">hotel</a>`} {
+		if !strings.Contains(resp.Body, want) {
+			t.Errorf("Expected %q in %s", want, resp.Body)
+		}
+	}
+	if resp.Headers["Content-Type"] != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected Content-Type: %s", resp.Headers["Content-Type"])
+	}
+}
+
+func TestMarkdownHTML(t *testing.T) {
+	got := markdownHTML("Intro <b>\nstill intro\n\n1. one\n2. two\n- [x] done\n> quoted\n\n```\na < b\n```\n---\n[x](javascript:void)  `code`")
+	want := "<p>Intro &lt;b&gt; still intro</p>\n" +
+		"<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n" +
+		"<ul>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n" +
+		"<blockquote>quoted</blockquote>\n" +
+		"<pre><code>a &lt; b</code></pre>\n" +
+		"<hr>\n" +
+		"<p>x  <code>code</code></p>\n"
+	if got != want {
+		t.Errorf("markdownHTML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHandler_AcceptFormat(t *testing.T) {
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"note","title":"Idea","markdown":"An **idea**","shortText":"An idea"}`})
+
+	event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: `{"text":"an idea"}`, Headers: map[string]string{"accept": "text/plain"}}
+	resp, _ := handler(context.Background(), event)
+	if resp.StatusCode != 200 || resp.Body != "An idea\n" || resp.Headers["Content-Type"] != "text/plain; charset=utf-8" {
+		t.Fatalf("Unexpected text response: %d %v %q", resp.StatusCode, resp.Headers, resp.Body)
+	}
+
+	// The format field wins over Accept
+	event.Body = `{"text":"an idea","format":"markdown"}`
+	resp, _ = handler(context.Background(), event)
+	if resp.Body != "An **idea**" {
+		t.Errorf("Expected the markdown, got %q", resp.Body)
+	}
+}
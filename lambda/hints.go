@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Longest accepted emoji, in runes; flags, skin tones and ZWJ sequences take several
+const maxEmojiRunes = 8
+
+// hintColors are the colors the watch can render, named after the SwiftUI system colors
+var hintColors = map[string]bool{
+	"red": true, "orange": true, "yellow": true, "green": true, "mint": true, "teal": true,
+	"cyan": true, "blue": true, "indigo": true, "purple": true, "pink": true, "brown": true, "gray": true,
+}
+
+// uiHint is the emoji and color an item gets when the model's suggestion is missing or unusable
+type uiHint struct {
+	emoji string
+	color string
+}
+
+// modeHints are the per-mode fallbacks; modes without an entry use defaultHint
+var modeHints = map[string]uiHint{
+	"reminder":  {"⏰", "orange"},
+	"event":     {"📅", "blue"},
+	"research":  {"🔎", "indigo"},
+	"deepthink": {"🧠", "purple"},
+	"question":  {"💡", "yellow"},
+	"email":     {"✉️", "cyan"},
+	"shopping":  {"🛒", "green"},
+	"journal":   {"📓", "brown"},
+	"contact":   {"👤", "teal"},
+	"summarize": {"📋", "gray"},
+	"translate": {"🌐", "mint"},
+	"timer":     {"⏲️", "red"},
+}
+
+var defaultHint = uiHint{"📝", "yellow"}
+
+// finalizeHints validates the model's emoji and color, falling back to the mode's
+// defaults so every response can be rendered without client-side inference
+func finalizeHints(mode string, resp *Response) {
+	hint, ok := modeHints[mode]
+	if !ok {
+		hint = defaultHint
+	}
+
+	resp.Emoji = strings.TrimSpace(resp.Emoji)
+	if !isEmoji(resp.Emoji) {
+		resp.Emoji = hint.emoji
+	}
+	resp.Color = strings.ToLower(strings.TrimSpace(resp.Color))
+	if !hintColors[resp.Color] {
+		resp.Color = hint.color
+	}
+}
+
+// isEmoji reports whether s is a single short emoji: symbols and joiners only, no
+// letters, digits or spaces (which rules out text like "calendar" or ":smile:")
+func isEmoji(s string) bool {
+	if s == "" || utf8.RuneCountInString(s) > maxEmojiRunes {
+		return false
+	}
+	symbol := false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsSpace(r), unicode.IsPunct(r):
+			return false
+		case unicode.Is(unicode.So, r):
+			symbol = true
+		}
+	}
+	return symbol
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestIsEmoji(t *testing.T) {
+	tests := map[string]bool{
+		"🦷":         true,
+		"✉️":        true, // with variation selector
+		"👍🏽":        true, // with skin tone
+		"👩‍💻":       true, // ZWJ sequence
+		"🇯🇵":        true, // flag
+		"":          false,
+		"calendar":  false,
+		":smile:":   false,
+		"🦷 teeth":   false,
+		"🦷🦷🦷🦷🦷🦷🦷🦷🦷": false,
+	}
+	for in, want := range tests {
+		if got := isEmoji(in); got != want {
+			t.Errorf("isEmoji(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestFinalizeHints(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		resp      Response
+		wantEmoji string
+		wantColor string
+	}{
+		{"model suggestion kept", "reminder", Response{Emoji: " 🦷 ", Color: " Teal "}, "🦷", "teal"},
+		{"mode fallback", "reminder", Response{Emoji: "tooth", Color: "chartreuse"}, "⏰", "orange"},
+		{"missing hints", "shopping", Response{}, "🛒", "green"},
+		{"default for notes", "note", Response{}, "📝", "yellow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.resp
+			finalizeHints(tt.mode, &resp)
+			if resp.Emoji != tt.wantEmoji || resp.Color != tt.wantColor {
+				t.Errorf("got %q %q, want %q %q", resp.Emoji, resp.Color, tt.wantEmoji, tt.wantColor)
+			}
+		})
+	}
+}
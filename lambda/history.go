@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Sort key prefix for captured items in the history table
+const captureSKPrefix = "CAPTURE#"
+
+// dynamoAPI is the subset of the DynamoDB client used by the handler
+type dynamoAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+var (
+	dynamoClient     dynamoAPI
+	historyTableName string
+)
+
+// captureMeta carries request-scoped details that sinks need but Response doesn't hold
+type captureMeta struct {
+	ID        string
+	Principal string
+	Mode      string
+	CreatedAt time.Time
+	Deliver   bool     // client opted in to external delivery (deliver:true)
+	Sinks     []string // device profile's sinks; empty = the mode's SINKS routing
+	Timezone  string   // IANA zone the request's dates were resolved in; recurring events repeat in it
+}
+
+type captureMetaKey struct{}
+
+// withCaptureMeta attaches capture metadata to the context passed to sinks
+func withCaptureMeta(ctx context.Context, meta captureMeta) context.Context {
+	return context.WithValue(ctx, captureMetaKey{}, meta)
+}
+
+// captureMetaFrom returns the capture metadata attached to ctx, if any
+func captureMetaFrom(ctx context.Context) captureMeta {
+	meta, _ := ctx.Value(captureMetaKey{}).(captureMeta)
+	return meta
+}
+
+// HistoryItem is a stored capture in the history table (pk = principal, sk = capture ID)
+type HistoryItem struct {
+	PK          string   `dynamodbav:"pk" json:"-"`
+	SK          string   `dynamodbav:"sk" json:"-"`
+	ID          string   `dynamodbav:"id" json:"id"`
+	Principal   string   `dynamodbav:"principal" json:"-"`
+	Mode        string   `dynamodbav:"mode" json:"mode"`
+	Action      string   `dynamodbav:"action" json:"action"`
+	Title       string   `dynamodbav:"title" json:"title"`
+	Markdown    string   `dynamodbav:"markdown" json:"markdown"`
+	DueISO      *string  `dynamodbav:"dueISO,omitempty" json:"dueISO,omitempty"`
+	StartISO    *string  `dynamodbav:"startISO,omitempty" json:"startISO,omitempty"`
+	EndISO      *string  `dynamodbav:"endISO,omitempty" json:"endISO,omitempty"`
+	Location    *string  `dynamodbav:"location,omitempty" json:"location,omitempty"`
+	URL         *string  `dynamodbav:"url,omitempty" json:"url,omitempty"`
+	Notes       *string  `dynamodbav:"notes,omitempty" json:"notes,omitempty"`
+	Recurrence  *string  `dynamodbav:"recurrence,omitempty" json:"recurrence,omitempty"`
+	Priority    string   `dynamodbav:"priority,omitempty" json:"priority,omitempty"`
+	Urgency     string   `dynamodbav:"urgency,omitempty" json:"urgency,omitempty"`
+	Sentiment   string   `dynamodbav:"sentiment,omitempty" json:"sentiment,omitempty"`
+	Tags        []string `dynamodbav:"tags" json:"tags"`
+	Timezone    string   `dynamodbav:"timezone,omitempty" json:"timezone,omitempty"` // IANA zone recurring events repeat in
+	CreatedAt   string   `dynamodbav:"createdAt" json:"createdAt"`
+	UpdatedAt   string   `dynamodbav:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	CompletedAt string   `dynamodbav:"completedAt,omitempty" json:"completedAt,omitempty"` // reminders marked done via PATCH /reminders/{id}
+	Deleted     bool     `dynamodbav:"deleted,omitempty" json:"deleted,omitempty"`         // notes removed via DELETE /notes/{id}, hidden until purged
+	DeletedAt   string   `dynamodbav:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	ExpiresAt   int64    `dynamodbav:"expiresAt,omitempty" json:"-"` // TTL purge time for deleted captures
+}
+
+// historyPK returns the partition key holding all items for a principal; a tenant's
+// principals are kept under the tenant (TENANT#<tenant>#USER#<id>)
+func historyPK(principal string) string {
+	if tenant, id := splitPrincipal(principal); tenant != "" {
+		return "TENANT#" + tenant + "#USER#" + id
+	}
+	return "USER#" + principal
+}
+
+// newHistoryItem builds the stored representation of a processed capture
+func newHistoryItem(meta captureMeta, resp Response) HistoryItem {
+	return HistoryItem{
+		PK:         historyPK(meta.Principal),
+		SK:         captureSKPrefix + meta.ID,
+		ID:         meta.ID,
+		Principal:  meta.Principal,
+		Mode:       meta.Mode,
+		Action:     resp.Action,
+		Title:      resp.Title,
+		Markdown:   resp.Markdown,
+		DueISO:     resp.DueISO,
+		StartISO:   resp.StartISO,
+		EndISO:     resp.EndISO,
+		Location:   resp.Location,
+		URL:        resp.URL,
+		Notes:      resp.Notes,
+		Recurrence: resp.Recurrence,
+		Priority:   resp.Priority,
+		Urgency:    resp.Urgency,
+		Sentiment:  resp.Sentiment,
+		Tags:       resp.Tags,
+		Timezone:   meta.Timezone,
+		CreatedAt:  meta.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// loadCapture reads one of a principal's stored captures, returning nil when it doesn't exist
+func loadCapture(ctx context.Context, principal, id string) (*HistoryItem, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+			"sk": &types.AttributeValueMemberS{Value: captureSKPrefix + id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	var item HistoryItem
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capture: %w", err)
+	}
+	return &item, nil
+}
+
+// loadCapturesByAction returns up to limit of a principal's stored captures with the
+// given action, newest first. Deleted captures are skipped, here and in loadCapturesSince.
+func loadCapturesByAction(ctx context.Context, principal, action string, limit int) ([]HistoryItem, error) {
+	items, _, err := loadCapturesByActionPage(ctx, principal, action, limit, "")
+	return items, err
+}
+
+// loadCapturesByActionPage is loadCapturesByAction resuming from cursor (the base64url
+// capture ID a previous page ended on, as search uses). nextCursor continues after the
+// last item returned; it is "" once there are no more captures.
+func loadCapturesByActionPage(ctx context.Context, principal, action string, limit int, cursor string) (items []HistoryItem, nextCursor string, err error) {
+	var startKey map[string]types.AttributeValue
+	if cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(id) == 0 {
+			return nil, "", errInvalidCursor
+		}
+		startKey = map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+			"sk": &types.AttributeValueMemberS{Value: captureSKPrefix + string(id)},
+		}
+	}
+	pageCursor := func() string {
+		return base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1].ID))
+	}
+	for {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(historyTableName),
+			KeyConditionExpression:   aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			FilterExpression:         aws.String("#action = :action"),
+			ExpressionAttributeNames: map[string]string{"#action": "action"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":     &types.AttributeValueMemberS{Value: historyPK(principal)},
+				":prefix": &types.AttributeValueMemberS{Value: captureSKPrefix},
+				":action": &types.AttributeValueMemberS{Value: action},
+			},
+			ScanIndexForward:  aws.Bool(false), // capture IDs sort by time, so newest first
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("DynamoDB Query failed: %w", err)
+		}
+
+		var page []HistoryItem
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal captures: %w", err)
+		}
+		for _, item := range page {
+			if item.Action != action || item.Deleted {
+				continue
+			}
+			if len(items) >= limit {
+				return items, pageCursor(), nil
+			}
+			items = append(items, item)
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return items, "", nil
+		}
+		if len(items) >= limit {
+			return items, pageCursor(), nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// loadCapturesSince returns up to limit of a principal's captures created at or after
+// since, newest first. Capture IDs sort by time, so paging stops at the first older one.
+func loadCapturesSince(ctx context.Context, principal string, since time.Time, limit int) ([]HistoryItem, error) {
+	var items []HistoryItem
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(historyTableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":     &types.AttributeValueMemberS{Value: historyPK(principal)},
+				":prefix": &types.AttributeValueMemberS{Value: captureSKPrefix},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("DynamoDB Query failed: %w", err)
+		}
+
+		var page []HistoryItem
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal captures: %w", err)
+		}
+		for _, item := range page {
+			created, err := time.Parse(time.RFC3339, item.CreatedAt)
+			if err == nil && created.Before(since) {
+				return items, nil
+			}
+			if len(items) == limit {
+				return items, nil
+			}
+			if !item.Deleted {
+				items = append(items, item)
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// saveCapture replaces a stored capture
+func saveCapture(ctx context.Context, item HistoryItem) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal capture: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// newCaptureID returns a time-sortable identifier, e.g. 20250115T090000Z-1a2b3c4d
+func newCaptureID() string {
+	return captureIDAt(time.Now())
+}
+
+// captureIDAt returns a capture ID that sorts at t, for captures dated in the past
+func captureIDAt(t time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// principalFromEvent returns the principal ID set by the Lambda Authorizer, qualified
+// with the caller's tenant if it has one
+func principalFromEvent(event events.APIGatewayProxyRequest) string {
+	principal := "anonymous"
+	if id, ok := event.RequestContext.Authorizer["principalId"].(string); ok && id != "" {
+		principal = id
+	}
+	return tenantPrincipal(tenantFromEvent(event), principal)
+}
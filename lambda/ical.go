@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iCalendar (RFC 5545) constants
+const (
+	icalProdID          = "-//Wrist Agent//Wrist Agent//EN"
+	icalTimeFormat      = "20060102T150405Z"
+	icalLocalTimeFormat = "20060102T150405"
+	icalMaxLineOctets   = 75
+)
+
+var (
+	rruleAllowed = regexp.MustCompile(`^[A-Z0-9=;,+\-]+$`)
+	rruleFreqs   = map[string]bool{"DAILY": true, "WEEKLY": true, "MONTHLY": true, "YEARLY": true}
+)
+
+// normalizeRRule validates a model-supplied recurrence rule, returning "" when it is unusable.
+// Only DAILY/WEEKLY/MONTHLY/YEARLY frequencies are accepted; an "RRULE:" prefix is stripped.
+func normalizeRRule(rule string) string {
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	if rule == "" || !rruleAllowed.MatchString(rule) {
+		return ""
+	}
+	for _, part := range strings.Split(rule, ";") {
+		if freq, ok := strings.CutPrefix(part, "FREQ="); ok {
+			if rruleFreqs[freq] {
+				return rule
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// icalEscape escapes TEXT values per RFC 5545 section 3.3.11
+func icalEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// icalFold folds a content line at 75 octets without splitting UTF-8 sequences
+func icalFold(line string) string {
+	if len(line) <= icalMaxLineOctets {
+		return line
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > icalMaxLineOctets {
+			b.WriteString("\r\n ")
+			width = 1 // the leading space counts toward the next line
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+// icalTime converts an RFC 3339 timestamp to iCalendar UTC form
+func icalTime(iso string) (string, error) {
+	t, err := time.Parse(time.RFC3339, iso)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp %q: %w", iso, err)
+	}
+	return t.UTC().Format(icalTimeFormat), nil
+}
+
+// icalLines accumulates content lines for a component
+type icalLines []string
+
+func (l *icalLines) add(name, value string) {
+	*l = append(*l, icalFold(name+":"+value))
+}
+
+func (l *icalLines) addText(name, value string) {
+	if value != "" {
+		l.add(name, icalEscape(value))
+	}
+}
+
+// icsCalendar wraps components in a VCALENDAR object with CRLF line endings
+func icsCalendar(components ...icalLines) string {
+	lines := icalLines{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:" + icalProdID, "CALSCALE:GREGORIAN"}
+	for _, c := range components {
+		lines = append(lines, c...)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// eventWindow parses an event's start and end; a missing or invalid end defaults to
+// defaultEventDuration after the start
+func eventWindow(resp Response) (time.Time, time.Time, error) {
+	if resp.StartISO == nil || *resp.StartISO == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("event has no start time")
+	}
+	start, err := time.Parse(time.RFC3339, *resp.StartISO)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid startISO %q: %w", *resp.StartISO, err)
+	}
+	end := start.Add(defaultEventDuration)
+	if resp.EndISO != nil && *resp.EndISO != "" {
+		if parsed, err := time.Parse(time.RFC3339, *resp.EndISO); err == nil && parsed.After(start) {
+			end = parsed
+		}
+	}
+	return start, end, nil
+}
+
+// eventLocation loads the IANA zone a recurring event repeats in, falling back to UTC
+func eventLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// buildVEvent renders an event response as a VEVENT. A recurring event is written in
+// local time with a TZID for timezone, so a weekly 09:00 stays at 09:00 across DST
+// changes; one-off events are written in UTC.
+func buildVEvent(uid string, resp Response, stamp time.Time, timezone string) (icalLines, error) {
+	start, end, err := eventWindow(resp)
+	if err != nil {
+		return nil, err
+	}
+	var rule string
+	if resp.Recurrence != nil {
+		rule = normalizeRRule(*resp.Recurrence)
+	}
+
+	lines := icalLines{"BEGIN:VEVENT"}
+	lines.add("UID", uid)
+	lines.add("DTSTAMP", stamp.UTC().Format(icalTimeFormat))
+	if loc := eventLocation(timezone); rule != "" && loc != time.UTC {
+		lines.add("DTSTART;TZID="+loc.String(), start.In(loc).Format(icalLocalTimeFormat))
+		lines.add("DTEND;TZID="+loc.String(), end.In(loc).Format(icalLocalTimeFormat))
+	} else {
+		lines.add("DTSTART", start.UTC().Format(icalTimeFormat))
+		lines.add("DTEND", end.UTC().Format(icalTimeFormat))
+	}
+	if rule != "" {
+		lines.add("RRULE", rule)
+	}
+	lines.addText("SUMMARY", resp.Title)
+	lines.addText("DESCRIPTION", icalDescription(resp))
+	if resp.Location != nil {
+		lines.addText("LOCATION", *resp.Location)
+	}
+	if resp.URL != nil && *resp.URL != "" {
+		lines.add("URL", *resp.URL)
+	}
+	if len(resp.Tags) > 0 {
+		lines.add("CATEGORIES", icalCategories(resp.Tags))
+	}
+	lines = append(lines, "END:VEVENT")
+	return lines, nil
+}
+
+// buildVTodo renders a reminder response as a VTODO (the component Reminders apps sync)
+func buildVTodo(uid string, resp Response, stamp time.Time) (icalLines, error) {
+	lines := icalLines{"BEGIN:VTODO"}
+	lines.add("UID", uid)
+	lines.add("DTSTAMP", stamp.UTC().Format(icalTimeFormat))
+	if resp.DueISO != nil && *resp.DueISO != "" {
+		due, err := icalTime(*resp.DueISO)
+		if err != nil {
+			return nil, err
+		}
+		lines.add("DUE", due)
+	}
+	lines.addText("SUMMARY", resp.Title)
+	lines.addText("DESCRIPTION", icalDescription(resp))
+	if len(resp.Tags) > 0 {
+		lines.add("CATEGORIES", icalCategories(resp.Tags))
+	}
+	if priority := icalPriority(resp.Priority); priority > 0 {
+		lines.add("PRIORITY", strconv.Itoa(priority))
+	}
+	lines.add("STATUS", "NEEDS-ACTION")
+	lines = append(lines, "END:VTODO")
+	return lines, nil
+}
+
+// icalDescription prefers explicit notes over the markdown body
+func icalDescription(resp Response) string {
+	if resp.Notes != nil && *resp.Notes != "" {
+		return *resp.Notes
+	}
+	return resp.Markdown
+}
+
+func icalCategories(tags []string) string {
+	escaped := make([]string, len(tags))
+	for i, tag := range tags {
+		escaped[i] = icalEscape(tag)
+	}
+	return strings.Join(escaped, ",")
+}
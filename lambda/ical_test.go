@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var icalStamp = time.Date(2025, 1, 14, 12, 0, 0, 0, time.UTC)
+
+func TestIcalEscape(t *testing.T) {
+	got := icalEscape("a, b; c\\d\nnext")
+	want := `a\, b\; c\\d\nnext`
+	if got != want {
+		t.Errorf("icalEscape() = %q, want %q", got, want)
+	}
+}
+
+func TestIcalFold(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("é", 60)
+	folded := icalFold(line)
+
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > icalMaxLineOctets {
+			t.Errorf("Folded line exceeds %d octets: %d", icalMaxLineOctets, len(part))
+		}
+	}
+	if strings.ReplaceAll(folded, "\r\n ", "") != line {
+		t.Error("Unfolding should restore the original line")
+	}
+}
+
+func TestBuildVEvent(t *testing.T) {
+	resp := Response{
+		Title:    "Team sync",
+		Markdown: "Weekly sync",
+		StartISO: strPtr("2025-01-15T09:00:00-08:00"),
+		EndISO:   strPtr("2025-01-15T09:30:00-08:00"),
+		Location: strPtr("Room 1, HQ"),
+		Tags:     []string{"work"},
+	}
+
+	lines, err := buildVEvent("abc@wrist-agent", resp, icalStamp, "")
+	if err != nil {
+		t.Fatalf("buildVEvent() error = %v", err)
+	}
+	ics := icsCalendar(lines)
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"BEGIN:VEVENT\r\n",
+		"UID:abc@wrist-agent\r\n",
+		"DTSTART:20250115T170000Z\r\n",
+		"DTEND:20250115T173000Z\r\n",
+		"LOCATION:Room 1\\, HQ\r\n",
+		"CATEGORIES:work\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in calendar:\n%s", want, ics)
+		}
+	}
+}
+
+func TestBuildVEvent_DefaultDuration(t *testing.T) {
+	lines, err := buildVEvent("uid", Response{StartISO: strPtr("2025-01-15T09:00:00Z")}, icalStamp, "")
+	if err != nil {
+		t.Fatalf("buildVEvent() error = %v", err)
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "DTEND:20250115T100000Z") {
+		t.Errorf("Expected one hour default duration, got %v", lines)
+	}
+}
+
+func TestBuildVEvent_RecurringTimezone(t *testing.T) {
+	resp := Response{StartISO: strPtr("2025-01-13T09:00:00-05:00"), Recurrence: strPtr("FREQ=WEEKLY;BYDAY=MO")}
+	lines, err := buildVEvent("uid", resp, icalStamp, "America/New_York")
+	if err != nil {
+		t.Fatalf("buildVEvent() error = %v", err)
+	}
+	joined := strings.Join(lines, "\n")
+	for _, want := range []string{"DTSTART;TZID=America/New_York:20250113T090000", "DTEND;TZID=America/New_York:20250113T100000", "RRULE:FREQ=WEEKLY;BYDAY=MO"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected %q in %s", want, joined)
+		}
+	}
+
+	// One-off events stay in UTC
+	resp.Recurrence = nil
+	lines, _ = buildVEvent("uid", resp, icalStamp, "America/New_York")
+	if joined := strings.Join(lines, "\n"); !strings.Contains(joined, "DTSTART:20250113T140000Z") {
+		t.Errorf("Expected a UTC start for a one-off event, got %s", joined)
+	}
+}
+
+func TestBuildVEvent_MissingStart(t *testing.T) {
+	if _, err := buildVEvent("uid", Response{Title: "No time"}, icalStamp, ""); err == nil {
+		t.Error("Expected error for missing start")
+	}
+}
+
+func TestBuildVTodo(t *testing.T) {
+	lines, err := buildVTodo("uid", Response{Title: "Call mom", DueISO: strPtr("2025-01-16T17:00:00Z")}, icalStamp)
+	if err != nil {
+		t.Fatalf("buildVTodo() error = %v", err)
+	}
+	joined := strings.Join(lines, "\n")
+	if !strings.Contains(joined, "DUE:20250116T170000Z") || !strings.Contains(joined, "SUMMARY:Call mom") {
+		t.Errorf("Unexpected VTODO: %s", joined)
+	}
+	if strings.Contains(joined, "PRIORITY") {
+		t.Errorf("Expected no PRIORITY without a priority: %s", joined)
+	}
+
+	lines, _ = buildVTodo("uid", Response{Title: "File taxes", Priority: "high"}, icalStamp)
+	if joined := strings.Join(lines, "\n"); !strings.Contains(joined, "PRIORITY:1") {
+		t.Errorf("Expected PRIORITY:1 for high priority: %s", joined)
+	}
+
+	if _, err := buildVTodo("uid", Response{DueISO: strPtr("soon")}, icalStamp); err == nil {
+		t.Error("Expected error for invalid due date")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"wrist-agent/apierror"
+)
+
+// Import limits: notes per request, the size of an uploaded zip, and the size of one note
+const (
+	maxImportNotes         = 500
+	maxImportZipBytes      = 20 << 20
+	maxImportMarkdownBytes = 100 << 10
+)
+
+// importUploadTypes maps the archive content types accepted by /uploads to file extensions
+var importUploadTypes = map[string]string{
+	"application/zip": "zip",
+}
+
+// captureIDPattern matches IDs made by newCaptureID, e.g. 20250115T090000Z-1a2b3c4d
+var captureIDPattern = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`)
+
+// ImportNote is one existing note to import
+type ImportNote struct {
+	ID        string   `json:"id,omitempty"` // keeps the ID of a note exported from GET /export
+	Title     string   `json:"title"`
+	Markdown  string   `json:"markdown"`
+	Tags      []string `json:"tags,omitempty"`
+	CreatedAt string   `json:"createdAt,omitempty"` // RFC 3339; defaults to now
+
+	name string // file name within an uploaded zip, for skip reports
+}
+
+// ImportRequest is the body of POST /import: notes inline, or the key of a zip of
+// markdown files uploaded via /uploads
+type ImportRequest struct {
+	Notes  []ImportNote `json:"notes,omitempty"`
+	ZipKey string       `json:"zipKey,omitempty"`
+}
+
+// ImportSkip reports a note that wasn't imported
+type ImportSkip struct {
+	Name   string `json:"name"` // file name, or title for inline notes
+	Reason string `json:"reason"`
+}
+
+// ImportResult reports what an import stored
+type ImportResult struct {
+	Imported   int          `json:"imported"`
+	Duplicates int          `json:"duplicates"`
+	IDs        []string     `json:"ids"`
+	Skipped    []ImportSkip `json:"skipped,omitempty"`
+}
+
+// noteFingerprint identifies a note by content, so the same note imported twice (or
+// already captured) is recognized whatever its ID or timestamps
+func noteFingerprint(title, markdown string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(title)) + "\n" + strings.TrimSpace(markdown)))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseFrontmatter splits a markdown document into its YAML frontmatter, read as flat
+// key: value pairs, and the body. Documents without frontmatter return no fields.
+func parseFrontmatter(doc string) (map[string]string, string) {
+	doc = strings.ReplaceAll(doc, "\r\n", "\n")
+	if !strings.HasPrefix(doc, "---\n") {
+		return nil, doc
+	}
+	header, body, ok := strings.Cut(doc[len("---\n"):], "\n---\n")
+	if !ok {
+		return nil, doc
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		fields[strings.TrimSpace(key)] = value
+	}
+	return fields, strings.TrimLeft(body, "\n")
+}
+
+// parseMarkdownNote reads a note file, using frontmatter as written by GET /export and
+// the s3 sink (id, title, created, tags) when present. Without a title, the first
+// heading or else the file name is used; without a date, the file's modified time.
+func parseMarkdownNote(name, doc string, modified time.Time) ImportNote {
+	fields, body := parseFrontmatter(doc)
+	note := ImportNote{ID: fields["id"], Title: fields["title"], Markdown: strings.TrimRight(body, "\n"), CreatedAt: fields["created"], name: name}
+
+	if tags := strings.Trim(fields["tags"], "[]"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.Trim(strings.TrimSpace(tag), `"'`); tag != "" {
+				note.Tags = append(note.Tags, tag)
+			}
+		}
+	}
+	if note.Title == "" {
+		for _, line := range strings.Split(body, "\n") {
+			if heading, ok := strings.CutPrefix(line, "# "); ok {
+				note.Title = strings.TrimSpace(heading)
+				break
+			}
+		}
+	}
+	if note.Title == "" {
+		note.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	if note.CreatedAt == "" && !modified.IsZero() {
+		note.CreatedAt = modified.UTC().Format(time.RFC3339)
+	}
+	return note
+}
+
+// readImportZip returns the markdown notes in an archive, skipping other files
+func readImportZip(archive []byte) ([]ImportNote, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid zip file")
+	}
+	var notes []ImportNote
+	for _, f := range r.File {
+		// Skip hidden files and folders, such as a vault's .obsidian settings
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, ".") || strings.Contains(f.Name, "/.") || !strings.EqualFold(path.Ext(f.Name), ".md") {
+			continue
+		}
+		if len(notes) == maxImportNotes {
+			return nil, fmt.Errorf("zip holds more than %d notes", maxImportNotes)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxImportMarkdownBytes+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		modified := f.Modified
+		if modified.Year() <= 1980 {
+			modified = time.Time{} // the zero DOS date: the file has no timestamp
+		}
+		notes = append(notes, parseMarkdownNote(f.Name, string(data), modified))
+	}
+	return notes, nil
+}
+
+// loadImportZip fetches a zip uploaded via /uploads. Callers may only use their own uploads.
+func loadImportZip(ctx context.Context, key, principal string) ([]byte, error) {
+	if !strings.HasPrefix(key, uploadKeyPrefix+principal+"/") || strings.Contains(key, "..") || path.Ext(key) != ".zip" {
+		return nil, fmt.Errorf("zipKey must be a zip key returned by /uploads")
+	}
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(os.Getenv("CAPTURE_BUCKET_NAME")),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("Failed to fetch import zip %s: %v", key, err)
+		return nil, fmt.Errorf("zipKey not found")
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(out.Body, maxImportZipBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip: %w", err)
+	}
+	if len(data) > maxImportZipBytes {
+		return nil, fmt.Errorf("%w: zip is larger than %d bytes", errPayloadTooLarge, maxImportZipBytes)
+	}
+	return data, nil
+}
+
+// prepareImport validates notes and turns the new ones into history items. Notes whose
+// content or ID matches a stored note, or an earlier note in the batch, are counted as
+// duplicates; invalid notes are skipped with a reason.
+func prepareImport(principal string, notes []ImportNote, stored []HistoryItem, now time.Time) ([]HistoryItem, ImportResult) {
+	result := ImportResult{IDs: []string{}}
+	seen := map[string]bool{}
+	ids := map[string]bool{}
+	for _, item := range stored {
+		seen[noteFingerprint(item.Title, item.Markdown)] = true
+		ids[item.ID] = true
+	}
+
+	var items []HistoryItem
+	for _, note := range notes {
+		name := note.name
+		if name == "" {
+			name = note.Title
+		}
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, ImportSkip{Name: name, Reason: reason})
+		}
+
+		note.Title = strings.TrimSpace(note.Title)
+		switch {
+		case note.Title == "":
+			skip("title is required")
+			continue
+		case strings.TrimSpace(note.Markdown) == "":
+			skip("markdown is empty")
+			continue
+		case len(note.Markdown) > maxImportMarkdownBytes:
+			skip(fmt.Sprintf("markdown is larger than %d bytes", maxImportMarkdownBytes))
+			continue
+		}
+		created := now
+		if note.CreatedAt != "" {
+			t, err := time.Parse(time.RFC3339, note.CreatedAt)
+			if err != nil {
+				skip("createdAt must be an RFC 3339 datetime")
+				continue
+			}
+			created = t
+		}
+
+		fingerprint := noteFingerprint(note.Title, note.Markdown)
+		if seen[fingerprint] || ids[note.ID] {
+			result.Duplicates++
+			continue
+		}
+		seen[fingerprint] = true
+
+		// Keep exported IDs so a re-import is recognized; otherwise date the ID by the
+		// note's creation so imports sort among existing captures
+		id := note.ID
+		if !captureIDPattern.MatchString(id) {
+			id = captureIDAt(created)
+		}
+		ids[id] = true
+
+		tags := note.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		items = append(items, newHistoryItem(
+			captureMeta{ID: id, Principal: principal, Mode: "note", CreatedAt: created.UTC()},
+			Response{Action: "note", Title: note.Title, Markdown: note.Markdown, Tags: tags},
+		))
+		result.IDs = append(result.IDs, id)
+	}
+	result.Imported = len(items)
+	return items, result
+}
+
+// indexImported sends imported notes to the opensearch sink when notes are routed to
+// it, so search covers them. Other sinks aren't sent imports: the notes already exist
+// wherever they came from.
+func indexImported(ctx context.Context, items []HistoryItem) {
+	cfg, err := loadSinkConfig(ctx)
+	if err != nil {
+		log.Printf("Failed to load sink config, imported notes not indexed: %v", err)
+		return
+	}
+	indexed := false
+	for _, name := range cfg.sinksFor("note") {
+		indexed = indexed || name == "opensearch"
+	}
+	if !indexed {
+		return
+	}
+	sink, err := resolveSink("opensearch")
+	if err != nil {
+		log.Printf("Imported notes not indexed: %v", err)
+		return
+	}
+	for _, item := range items {
+		created, _ := time.Parse(time.RFC3339, item.CreatedAt)
+		itemCtx := withCaptureMeta(ctx, captureMeta{ID: item.ID, Principal: item.Principal, Mode: item.Mode, CreatedAt: created})
+		if err := sink.Deliver(itemCtx, historyResponse(item)); err != nil {
+			log.Printf("Failed to index imported note %s: %v", item.ID, err)
+		}
+	}
+}
+
+// isImportRequest reports whether the route is the import endpoint
+func isImportRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/import"
+}
+
+// handleImport serves POST /import, which stores existing markdown notes in the
+// caller's history. Notes already stored are skipped, so an import can be retried.
+func handleImport(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "POST" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+
+	var body ImportRequest
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	if (len(body.Notes) == 0) == (body.ZipKey == "") {
+		return errorResponse(ctx, apierror.InvalidRequest("send either notes or zipKey"))
+	}
+	if len(body.Notes) > maxImportNotes {
+		return errorResponse(ctx, apierror.InvalidRequest(fmt.Sprintf("at most %d notes per import", maxImportNotes)))
+	}
+
+	principal := principalFromEvent(event)
+	notes := body.Notes
+	if body.ZipKey != "" {
+		if os.Getenv("CAPTURE_BUCKET_NAME") == "" {
+			return errorResponse(ctx, apierror.NotConfigured("Uploads are not configured"))
+		}
+		archive, err := loadImportZip(ctx, body.ZipKey, principal)
+		if errors.Is(err, errPayloadTooLarge) {
+			return errorResponse(ctx, apierror.PayloadTooLarge(err.Error()))
+		}
+		if err == nil {
+			notes, err = readImportZip(archive)
+		}
+		if err != nil {
+			return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+		}
+	}
+
+	stored, err := loadCapturesByAction(ctx, principal, "note", maxExportNotes)
+	if err != nil {
+		log.Printf("Failed to load notes for import: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load notes"))
+	}
+	preferred := requestTags(ctx, principal)
+	for i := range notes {
+		notes[i].Tags = preferTags(notes[i].Tags, preferred)
+	}
+	items, result := prepareImport(principal, notes, stored, time.Now())
+
+	for i, item := range items {
+		if err := saveCapture(ctx, item); err != nil {
+			log.Printf("Import failed after %d of %d notes: %v", i, len(items), err)
+			return errorResponse(ctx, apierror.Internal(fmt.Sprintf("Import failed after %d notes; retrying skips those already imported", i)))
+		}
+	}
+	indexImported(ctx, items)
+	log.Printf("Imported %d notes for %s (%d duplicates, %d skipped)", result.Imported, principal, result.Duplicates, len(result.Skipped))
+	return apiResponse(200, result)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestParseMarkdownNote(t *testing.T) {
+	modified := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	exported := "---\nid: 20250115T090000Z-1a2b3c4d\ntitle: \"Garden: plan\"\naction: note\ncreated: 2025-01-15T09:00:00Z\ntags: [home, garden]\n---\n\n# Garden\n\nPlant tomatoes\n"
+	note := parseMarkdownNote("notes/2025-01-15-garden.md", exported, modified)
+	if note.ID != "20250115T090000Z-1a2b3c4d" || note.Title != "Garden: plan" || note.CreatedAt != "2025-01-15T09:00:00Z" ||
+		strings.Join(note.Tags, ",") != "home,garden" || note.Markdown != "# Garden\n\nPlant tomatoes" {
+		t.Errorf("exported note = %+v", note)
+	}
+
+	plain := parseMarkdownNote("vault/Ideas.md", "Some text\n# Big idea\nmore", modified)
+	if plain.Title != "Big idea" || plain.CreatedAt != "2024-06-01T12:00:00Z" || plain.ID != "" {
+		t.Errorf("plain note = %+v", plain)
+	}
+	if untitled := parseMarkdownNote("vault/Shopping trip.md", "milk", time.Time{}); untitled.Title != "Shopping trip" || untitled.CreatedAt != "" {
+		t.Errorf("untitled note = %+v", untitled)
+	}
+}
+
+func TestPrepareImport(t *testing.T) {
+	now := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	stored := []HistoryItem{{ID: "20250101T000000Z-00000001", Title: "Garden", Markdown: "Plant tomatoes"}}
+	notes := []ImportNote{
+		{Title: "garden ", Markdown: "Plant tomatoes\n"},                          // same content as stored
+		{ID: "20250101T000000Z-00000001", Title: "Renamed", Markdown: "Edited"},   // same ID as stored
+		{Title: "Books", Markdown: "Dune", CreatedAt: "2024-12-24T18:30:00Z"},     // new
+		{Title: "Books", Markdown: "Dune"},                                        // repeated within the batch
+		{ID: "20250110T000000Z-0000abcd", Title: "Kept ID", Markdown: "Exported"}, // new, keeps its ID
+		{Title: "", Markdown: "No title"},                                         // invalid
+		{Title: "Bad date", Markdown: "x", CreatedAt: "yesterday"},                // invalid
+		{Title: "Empty", Markdown: "  ", name: "vault/empty.md"},                  // invalid
+	}
+	items, result := prepareImport("user-1", notes, stored, now)
+	if result.Imported != 2 || result.Duplicates != 3 || len(result.Skipped) != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+	if items[0].Title != "Books" || items[0].CreatedAt != "2024-12-24T18:30:00Z" || !strings.HasPrefix(items[0].ID, "20241224T183000Z-") {
+		t.Errorf("items[0] = %+v", items[0])
+	}
+	if items[1].ID != "20250110T000000Z-0000abcd" || items[1].CreatedAt != now.Format(time.RFC3339) || items[1].Mode != "note" || items[1].Tags == nil {
+		t.Errorf("items[1] = %+v", items[1])
+	}
+	if result.Skipped[2].Name != "vault/empty.md" || result.Skipped[1].Reason != "createdAt must be an RFC 3339 datetime" {
+		t.Errorf("skipped = %+v", result.Skipped)
+	}
+}
+
+func TestHandleImport(t *testing.T) {
+	call := func(body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Resource: "/import", Body: body}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call(`{"notes":[{"title":"a","markdown":"b"}]}`); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503", resp.StatusCode)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+	ctx := context.Background()
+
+	t.Run("inline notes", func(t *testing.T) {
+		body := `{"notes":[{"title":"Garden","markdown":"Plant tomatoes","tags":["home"],"createdAt":"2024-05-01T10:00:00Z"}]}`
+		var result ImportResult
+		resp := call(body)
+		json.Unmarshal([]byte(resp.Body), &result)
+		if resp.StatusCode != 200 || result.Imported != 1 || len(result.IDs) != 1 {
+			t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+		stored, _ := loadCapture(ctx, "user-1", result.IDs[0])
+		if stored == nil || stored.Title != "Garden" || stored.Action != "note" || stored.CreatedAt != "2024-05-01T10:00:00Z" {
+			t.Errorf("stored = %+v", stored)
+		}
+
+		// Importing the same notes again stores nothing new
+		json.Unmarshal([]byte(call(body).Body), &result)
+		if result.Imported != 0 || result.Duplicates != 1 {
+			t.Errorf("re-import = %+v", result)
+		}
+	})
+
+	t.Run("zip upload", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for name, doc := range map[string]string{
+			"vault/Books.md":       "# Books\n\n- Dune",
+			"vault/.obsidian/x.md": "ignored",
+			"vault/image.png":      "ignored",
+		} {
+			f, _ := w.Create(name)
+			f.Write([]byte(doc))
+		}
+		w.Close()
+		useFakeS3(t, &fakeS3{objects: map[string][]byte{"uploads/user-1/notes.zip": buf.Bytes()}}, &fakePresigner{})
+		t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+
+		var result ImportResult
+		resp := call(`{"zipKey":"uploads/user-1/notes.zip"}`)
+		json.Unmarshal([]byte(resp.Body), &result)
+		if resp.StatusCode != 200 || result.Imported != 1 {
+			t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+		if stored, _ := loadCapture(ctx, "user-1", result.IDs[0]); stored == nil || stored.Title != "Books" {
+			t.Errorf("stored = %+v", stored)
+		}
+
+		if resp := call(`{"zipKey":"uploads/user-2/notes.zip"}`); resp.StatusCode != 400 {
+			t.Errorf("another principal's upload: StatusCode = %d, want 400", resp.StatusCode)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{`{`, `{}`, `{"notes":[{"title":"a","markdown":"b"}],"zipKey":"uploads/user-1/a.zip"}`} {
+			if resp := call(body); resp.StatusCode != 400 {
+				t.Errorf("%s: StatusCode = %d, want 400", body, resp.StatusCode)
+			}
+		}
+	})
+}
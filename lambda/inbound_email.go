@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Email-in: an SES receipt rule stores mail sent to a private capture address under
+// inbound/ in the capture bucket and then invokes the function, which runs the email
+// as a capture for the address's principal: the subject is the title hint and the body
+// the text. A "+mode" tag on the address (capture+reminder@...) picks the mode;
+// otherwise it is inferred from the text.
+const (
+	inboundEmailKeyPrefix = "inbound/"
+	maxInboundEmailBytes  = 10 << 20 // larger messages (big attachments) aren't read
+	inboundEmailTTL       = 24 * time.Hour
+)
+
+var (
+	// emailSignature is the conventional "-- " line that starts a signature
+	emailSignature = regexp.MustCompile(`(?m)^-- ?$`)
+	// emailHTMLBreak matches the tags that end a line of an HTML body
+	emailHTMLBreak = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6]|tr)>`)
+	// emailHTMLSkipped matches HTML elements whose content isn't text
+	emailHTMLSkipped = regexp.MustCompile(`(?is)<(style|script|head)\b.*?</(style|script|head)>`)
+	emailHTMLTag     = regexp.MustCompile(`<[^>]*>`)
+	emailBlankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// handleInboundEmail captures each received email, then deletes the stored copy. Mail
+// that fails a check or can't be processed is logged and dropped, as SES doesn't retry
+// or bounce for the function.
+func handleInboundEmail(ctx context.Context, event events.SimpleEmailEvent) (interface{}, error) {
+	for _, record := range event.Records {
+		messageID := record.SES.Mail.MessageID
+		principal, mode, ok := inboundEmailRecipient(record.SES.Receipt.Recipients)
+		if !ok {
+			log.Printf("Inbound email %s dropped: no capture address among its recipients", messageID)
+		} else if reason := inboundEmailRejection(record.SES); reason != "" {
+			log.Printf("Inbound email %s dropped: %s", messageID, reason)
+		} else {
+			captureInboundEmail(ctx, principal, mode, messageID)
+		}
+		deleteInboundEmail(ctx, messageID)
+	}
+	return nil, nil
+}
+
+// inboundEmailAddresses reads INBOUND_EMAIL_ADDRESSES, comma-separated address=principal
+// pairs, keyed by lowercased address
+func inboundEmailAddresses() map[string]string {
+	addresses := map[string]string{}
+	for _, entry := range strings.Split(os.Getenv("INBOUND_EMAIL_ADDRESSES"), ",") {
+		address, principal, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if address, principal = strings.ToLower(strings.TrimSpace(address)), strings.TrimSpace(principal); ok && address != "" && principal != "" {
+			addresses[address] = principal
+		}
+	}
+	return addresses
+}
+
+// inboundEmailRecipient finds the first recipient that is a capture address, returning
+// its principal and the mode named by a "+mode" tag ("" when there is none)
+func inboundEmailRecipient(recipients []string) (principal, mode string, ok bool) {
+	addresses := inboundEmailAddresses()
+	for _, recipient := range recipients {
+		local, domain, found := strings.Cut(strings.ToLower(strings.TrimSpace(recipient)), "@")
+		if !found {
+			continue
+		}
+		local, tag, _ := strings.Cut(local, "+")
+		if principal, ok := addresses[local+"@"+domain]; ok {
+			if _, known := lookupMode(tag); !known {
+				tag = ""
+			}
+			return principal, tag, true
+		}
+	}
+	return "", "", false
+}
+
+// inboundEmailRejection returns why a received email may not be captured, or "": SES
+// must find no spam or virus, SPF or DKIM must pass so the sender isn't spoofed, and
+// the sender must be in INBOUND_EMAIL_SENDERS (addresses or @domains) when it is set.
+// SPF checks the envelope sender and DKIM any signing domain, so neither vouches for the
+// From header the allowlist reads; DMARC, which aligns them with it, must pass too. An
+// empty allowlist accepts mail from anyone.
+func inboundEmailRejection(ses events.SimpleEmailService) string {
+	receipt := ses.Receipt
+	if receipt.SpamVerdict.Status == "FAIL" || receipt.VirusVerdict.Status == "FAIL" {
+		return "spam or virus verdict"
+	}
+	if receipt.SPFVerdict.Status != "PASS" && receipt.DKIMVerdict.Status != "PASS" {
+		return "neither SPF nor DKIM passed"
+	}
+
+	allowed := strings.TrimSpace(os.Getenv("INBOUND_EMAIL_SENDERS"))
+	if allowed == "" {
+		return ""
+	}
+	if receipt.DMARCVerdict.Status != "PASS" {
+		return "DMARC did not pass"
+	}
+	var sender string
+	if len(ses.Mail.CommonHeaders.From) > 0 {
+		if from, err := mail.ParseAddress(ses.Mail.CommonHeaders.From[0]); err == nil {
+			sender = strings.ToLower(from.Address)
+		}
+	}
+	for _, entry := range strings.Split(allowed, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry != "" && (sender == entry || (strings.HasPrefix(entry, "@") && strings.HasSuffix(sender, entry))) {
+			return ""
+		}
+	}
+	return "sender not allowed"
+}
+
+// captureInboundEmail reads a stored email and runs it through the invoke pipeline as
+// principal. SES may invoke the function again for the same message, so each is only
+// captured once.
+func captureInboundEmail(ctx context.Context, principal, mode, messageID string) {
+	fresh, err := rememberNonce(ctx, principal, "email-"+messageID, time.Now(), time.Now().Add(inboundEmailTTL))
+	if err != nil {
+		log.Printf("Failed to record inbound email %s: %v", messageID, err)
+	} else if !fresh {
+		return
+	}
+
+	raw, err := loadInboundEmail(ctx, messageID)
+	if err != nil {
+		log.Printf("Inbound email %s dropped: %v", messageID, err)
+		return
+	}
+	subject, text, err := parseInboundEmail(raw)
+	if err != nil {
+		log.Printf("Inbound email %s dropped: %v", messageID, err)
+		return
+	}
+	if text == "" {
+		// A subject-only email is the capture itself
+		text, subject = subject, ""
+	}
+	if mode == "" {
+		mode = inferMode(text)
+	}
+
+	result := runCapture(ctx, CaptureRequest{
+		Source:    "email",
+		RequestID: "email-" + messageID,
+		Caller:    principalCaller(principal),
+		Fields:    map[string]interface{}{"text": text, "titleHint": truncateRunes(subject, maxTitleHintChars), "mode": mode},
+	})
+	if result.Status >= 300 {
+		return
+	}
+	log.Printf("Inbound email %s captured for principal %s", messageID, principal)
+}
+
+// loadInboundEmail fetches the raw message SES stored in the capture bucket
+func loadInboundEmail(ctx context.Context, messageID string) ([]byte, error) {
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(os.Getenv("CAPTURE_BUCKET_NAME")),
+		Key:    aws.String(inboundEmailKeyPrefix + messageID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message: %w", err)
+	}
+	defer out.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(out.Body, maxInboundEmailBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	if len(raw) > maxInboundEmailBytes {
+		return nil, fmt.Errorf("message is larger than %d bytes", maxInboundEmailBytes)
+	}
+	return raw, nil
+}
+
+// deleteInboundEmail removes a processed message, which holds the sender's full email
+func deleteInboundEmail(ctx context.Context, messageID string) {
+	_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(os.Getenv("CAPTURE_BUCKET_NAME")),
+		Key:    aws.String(inboundEmailKeyPrefix + messageID),
+	})
+	if err != nil {
+		log.Printf("Failed to delete inbound email %s: %v", messageID, err)
+	}
+}
+
+// parseInboundEmail returns a MIME message's decoded subject and its body as text: the
+// text/plain part, else the text of the text/html part, without the signature
+func parseInboundEmail(raw []byte) (subject, text string, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid message: %w", err)
+	}
+	decoder := mime.WordDecoder{CharsetReader: charsetReader}
+	subject, err = decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	plain, htmlBody, err := emailBodies(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if strings.TrimSpace(plain) == "" {
+		plain = htmlText(htmlBody)
+	}
+
+	text = strings.ReplaceAll(plain, "\r\n", "\n")
+	if loc := emailSignature.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	return strings.TrimSpace(subject), strings.TrimSpace(text), nil
+}
+
+// emailBodies decodes a MIME entity, returning the first text/plain and text/html bodies
+// found in it and, for multipart entities, its parts. Attachments are skipped.
+func emailBodies(contentType, transferEncoding string, body io.Reader) (plain, htmlBody string, err error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid Content-Type: %w", err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", "", fmt.Errorf("invalid multipart body: %w", err)
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+			p, h, err := emailBodies(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", "", err
+			}
+			if plain == "" {
+				plain = p
+			}
+			if htmlBody == "" {
+				htmlBody = h
+			}
+		}
+		return plain, htmlBody, nil
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", "", nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	if charset := params["charset"]; charset != "" {
+		if body, err = charsetReader(charset, body); err != nil {
+			return "", "", err
+		}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode body: %w", err)
+	}
+	if mediaType == "text/html" {
+		return "", string(data), nil
+	}
+	return string(data), "", nil
+}
+
+// charsetReader decodes text in a MIME charset to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+// htmlText reduces an HTML email body to its text, one line per block
+func htmlText(body string) string {
+	text := emailHTMLSkipped.ReplaceAllString(body, "")
+	text = emailHTMLBreak.ReplaceAllString(text, "\n")
+	text = html.UnescapeString(emailHTMLTag.ReplaceAllString(text, ""))
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return emailBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const inboundMultipart = "From: Sam <sam@example.com>\r\n" +
+	"To: capture-x7f2@in.example.com\r\n" +
+	"Subject: =?UTF-8?Q?Caf=C3=A9_ideas?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Open a caf=C3=A9 with a reading corner and a long communal table for remote w=\r\n" +
+	"orkers.\r\n" +
+	"\r\n" +
+	"-- \r\n" +
+	"Sam\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Open a caf&eacute;</p>\r\n" +
+	"--b1--\r\n"
+
+// inboundEvent is an SES receipt event for a message sent to recipient
+func inboundEvent(messageID, recipient string) json.RawMessage {
+	var record events.SimpleEmailRecord
+	record.EventSource = "aws:ses"
+	record.SES.Mail.MessageID = messageID
+	record.SES.Mail.CommonHeaders.From = []string{"Sam <sam@example.com>"}
+	record.SES.Receipt.Recipients = []string{recipient}
+	record.SES.Receipt.SpamVerdict.Status = "PASS"
+	record.SES.Receipt.VirusVerdict.Status = "PASS"
+	record.SES.Receipt.SPFVerdict.Status = "PASS"
+	record.SES.Receipt.DKIMVerdict.Status = "PASS"
+	payload, _ := json.Marshal(events.SimpleEmailEvent{Records: []events.SimpleEmailRecord{record}})
+	return payload
+}
+
+// useInboundStore serves stored messages from a fake capture bucket
+func useInboundStore(t *testing.T, objects map[string][]byte) *fakeS3 {
+	t.Helper()
+	store := &fakeS3{objects: objects}
+	orig := s3Client
+	s3Client = store
+	t.Cleanup(func() { s3Client = orig })
+	t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+	t.Setenv("INBOUND_EMAIL_ADDRESSES", "Capture-X7F2@in.example.com=user-123")
+	return store
+}
+
+func TestParseInboundEmail(t *testing.T) {
+	subject, text, err := parseInboundEmail([]byte(inboundMultipart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Café ideas" || text != "Open a café with a reading corner and a long communal table for remote workers." {
+		t.Errorf("parseInboundEmail() = %q, %q", subject, text)
+	}
+
+	// An HTML-only body in another charset, base64 encoded
+	htmlOnly := "Subject: Note\r\nContent-Type: text/html; charset=iso-8859-1\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"PHN0eWxlPnB7fTwvc3R5bGU+PHA+Q2Fm6SBsaXN0PC9wPjxwPk1pbGsgJmFtcDsgYnJlYWQ8YnI+RWdnczwvcD4=\r\n"
+	_, text, err = parseInboundEmail([]byte(htmlOnly))
+	if err != nil || text != "Café list\nMilk & bread\nEggs" {
+		t.Errorf("parseInboundEmail(html) = %q, %v", text, err)
+	}
+
+	if _, _, err := parseInboundEmail([]byte("not a message")); err == nil {
+		t.Error("Expected an invalid message to fail")
+	}
+}
+
+func TestInboundEmailRecipient(t *testing.T) {
+	t.Setenv("INBOUND_EMAIL_ADDRESSES", "capture-x7f2@in.example.com=user-123, bad-entry")
+	tests := []struct {
+		recipients    []string
+		wantPrincipal string
+		wantMode      string
+		wantOK        bool
+	}{
+		{[]string{"Capture-X7F2@in.example.com"}, "user-123", "", true},
+		{[]string{"other@in.example.com", "capture-x7f2+reminder@in.example.com"}, "user-123", "reminder", true},
+		{[]string{"capture-x7f2+poetry@in.example.com"}, "user-123", "", true},
+		{[]string{"capture@in.example.com"}, "", "", false},
+	}
+	for _, tt := range tests {
+		principal, mode, ok := inboundEmailRecipient(tt.recipients)
+		if principal != tt.wantPrincipal || mode != tt.wantMode || ok != tt.wantOK {
+			t.Errorf("inboundEmailRecipient(%v) = %q, %q, %v", tt.recipients, principal, mode, ok)
+		}
+	}
+}
+
+func TestInboundEmailRejection(t *testing.T) {
+	passing := func() events.SimpleEmailService {
+		var ses events.SimpleEmailService
+		ses.Mail.CommonHeaders.From = []string{"Sam <Sam@Example.com>"}
+		ses.Receipt.SPFVerdict.Status = "PASS"
+		ses.Receipt.DKIMVerdict.Status = "GRAY"
+		ses.Receipt.DMARCVerdict.Status = "PASS"
+		return ses
+	}
+	if reason := inboundEmailRejection(passing()); reason != "" {
+		t.Errorf("Expected SPF alone to pass, got %q", reason)
+	}
+	spam := passing()
+	spam.Receipt.SpamVerdict.Status = "FAIL"
+	if reason := inboundEmailRejection(spam); reason == "" {
+		t.Error("Expected spam to be rejected")
+	}
+	spoofed := passing()
+	spoofed.Receipt.SPFVerdict.Status = "FAIL"
+	if reason := inboundEmailRejection(spoofed); reason == "" {
+		t.Error("Expected mail failing SPF and DKIM to be rejected")
+	}
+
+	t.Setenv("INBOUND_EMAIL_SENDERS", "me@example.org, @example.com")
+	if reason := inboundEmailRejection(passing()); reason != "" {
+		t.Errorf("Expected an allowed domain to pass, got %q", reason)
+	}
+	t.Setenv("INBOUND_EMAIL_SENDERS", "me@example.org")
+	if reason := inboundEmailRejection(passing()); reason != "sender not allowed" {
+		t.Errorf("Expected an unlisted sender to be rejected, got %q", reason)
+	}
+	t.Setenv("INBOUND_EMAIL_SENDERS", "@example.com")
+	unaligned := passing()
+	unaligned.Receipt.DMARCVerdict.Status = "FAIL"
+	if reason := inboundEmailRejection(unaligned); reason != "DMARC did not pass" {
+		t.Errorf("Expected an allowed From failing DMARC to be rejected, got %q", reason)
+	}
+}
+
+func TestHandleInboundEmail(t *testing.T) {
+	store := useInboundStore(t, map[string][]byte{"inbound/msg-capture-1": []byte(inboundMultipart)})
+	model := &fakeBedrock{text: `{"action":"note","title":"Café ideas","markdown":"Open a café","shortText":"Café idea"}`}
+	useFakeBedrock(t, model)
+
+	if _, err := invoke(context.Background(), inboundEvent("msg-capture-1", "capture-x7f2+journal@in.example.com")); err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	var sent struct {
+		System   string `json:"system"`
+		Messages []struct {
+			Content interface{} `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(model.body, &sent)
+	if !strings.Contains(sent.System, "Suggested title (use it unless the text calls for a clearer one): Café ideas") || !strings.Contains(sent.System, "journal") {
+		t.Errorf("Expected the subject as the title hint in a journal prompt, got %q", sent.System)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "inbound/msg-capture-1" {
+		t.Errorf("Expected the stored message deleted, got %v", store.deleted)
+	}
+
+	// Redelivery doesn't capture the message twice
+	model.body = nil
+	invoke(context.Background(), inboundEvent("msg-capture-1", "capture-x7f2@in.example.com"))
+	if model.body != nil {
+		t.Error("Expected a redelivered message to be skipped")
+	}
+
+	// Mail to other addresses is dropped unread
+	invoke(context.Background(), inboundEvent("msg-capture-2", "someone@in.example.com"))
+	if model.body != nil || len(store.deleted) != 3 || store.deleted[2] != "inbound/msg-capture-2" {
+		t.Errorf("Expected mail to another address to be dropped, deleted %v", store.deleted)
+	}
+}
+
+func TestValidateTitleHint(t *testing.T) {
+	req := &Req{TitleHint: "  Café\n ideas  "}
+	if err := validateTitleHint(req); err != nil || req.TitleHint != "Café ideas" {
+		t.Errorf("validateTitleHint() = %v, %q", err, req.TitleHint)
+	}
+	if err := validateTitleHint(&Req{TitleHint: strings.Repeat("é", 201)}); err == nil {
+		t.Error("Expected an overlong titleHint to be refused")
+	}
+	if prompt := titleHintPrompt(&Req{}); prompt != "" {
+		t.Errorf("Expected no prompt without a hint, got %q", prompt)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key prefix for async job records in the history table
+const jobSKPrefix = "JOB#"
+
+// Job records expire (DynamoDB TTL) a week after they're created
+const jobTTL = 7 * 24 * time.Hour
+
+// Default delivery attempts before a job is marked failed; must match the queue's
+// maxReceiveCount so the last attempt is the one that lands in the dead-letter queue
+const defaultJobMaxAttempts = 3
+
+// Job states reported by GET /jobs/{id}
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobPending   = "pending" // saved while Bedrock was down, waiting for the backlog to drain
+)
+
+// sqsAPI is the subset of the SQS client used to enqueue jobs
+type sqsAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+var (
+	sqsClient   sqsAPI
+	jobQueueURL string
+)
+
+// Job is an async capture as stored in the history table (pk = principal, sk = JOB#<id>).
+// Result and error are kept as JSON so GET /jobs/{id} returns them exactly as rendered.
+type Job struct {
+	PK        string          `dynamodbav:"pk" json:"-"`
+	SK        string          `dynamodbav:"sk" json:"-"`
+	ID        string          `dynamodbav:"id" json:"id"`
+	Status    string          `dynamodbav:"status" json:"status"`
+	Mode      string          `dynamodbav:"mode" json:"mode"`
+	Attempts  int             `dynamodbav:"attempts" json:"attempts"`
+	Stage     string          `dynamodbav:"stage,omitempty" json:"stage,omitempty"`         // progress stage while running
+	Step      string          `dynamodbav:"step,omitempty" json:"step,omitempty"`           // research workflow step in progress
+	Completed []string        `dynamodbav:"completed,omitempty" json:"completed,omitempty"` // research workflow steps done
+	Result    json.RawMessage `dynamodbav:"result,omitempty" json:"result,omitempty"`
+	Error     json.RawMessage `dynamodbav:"error,omitempty" json:"error,omitempty"`
+	CreatedAt string          `dynamodbav:"createdAt" json:"createdAt"`
+	UpdatedAt string          `dynamodbav:"updatedAt" json:"updatedAt"`
+	ExpiresAt int64           `dynamodbav:"expiresAt" json:"-"`
+}
+
+// jobMessage is the SQS message body for a queued request. Scopes were already
+// enforced at enqueue time, so only the validated request travels.
+type jobMessage struct {
+	JobID      string    `json:"jobId"`
+	Principal  string    `json:"principal"`
+	APIVersion int       `json:"apiVersion"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Request    Req       `json:"request"`
+	Warnings   []string  `json:"warnings,omitempty"`
+	Sinks      []string  `json:"sinks,omitempty"` // device profile's sinks (Req.sinks isn't serialized)
+
+	Revalidate string `json:"revalidate,omitempty"` // response cache key to refresh; such messages have no job
+	Variant    string `json:"variant,omitempty"`    // prompt variant the stale reply was produced with
+}
+
+// JobAccepted is the 202 body returned for async:true requests and for captures saved
+// while Bedrock is down
+type JobAccepted struct {
+	JobID     string `json:"jobId"`
+	Status    string `json:"status"`
+	StatusURL string `json:"statusUrl"`
+	Message   string `json:"message,omitempty"` // why a capture is pending
+}
+
+// jobMaxAttempts reads JOB_MAX_ATTEMPTS, falling back to the default
+func jobMaxAttempts() int {
+	return limitEnv("JOB_MAX_ATTEMPTS", defaultJobMaxAttempts, 1)
+}
+
+// jobPath returns the status URL path for a job
+func jobPath(version int, id string) string {
+	if version == apiV2 {
+		return "/v2/jobs/" + id
+	}
+	return "/jobs/" + id
+}
+
+// newJob builds the initial (queued) record for a job
+func newJob(principal, id, mode string, now time.Time) Job {
+	return Job{
+		PK:        historyPK(principal),
+		SK:        jobSKPrefix + id,
+		ID:        id,
+		Status:    jobQueued,
+		Mode:      mode,
+		CreatedAt: now.Format(time.RFC3339),
+		UpdatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(jobTTL).Unix(),
+	}
+}
+
+// saveJob writes the job record, replacing any previous state
+func saveJob(ctx context.Context, job Job) error {
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// loadJob reads a principal's job, returning nil when it doesn't exist
+func loadJob(ctx context.Context, principal, id string) (*Job, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+			"sk": &types.AttributeValueMemberS{Value: jobSKPrefix + id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	var job Job
+	if err := attributevalue.UnmarshalMap(out.Item, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return &job, nil
+}
+
+// enqueueJob records a queued job and sends the validated request to the job queue,
+// answering 202 with the job's status URL
+func enqueueJob(ctx context.Context, req *Req, principal string, version int, now time.Time) events.APIGatewayProxyResponse {
+	workflow := usesResearchWorkflow(req)
+	if (jobQueueURL == "" && !workflow) || historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("async processing not configured"))
+	}
+
+	job := newJob(principal, newCaptureID(), req.Mode, now)
+	msg := jobMessage{
+		JobID:      job.ID,
+		Principal:  principal,
+		APIVersion: version,
+		CreatedAt:  now,
+		Request:    *req,
+		Warnings:   req.warnings,
+		Sinks:      req.sinks,
+	}
+
+	// Record the job first so a fast worker always finds it
+	if err := saveJob(ctx, job); err != nil {
+		log.Printf("Failed to record job %s: %v", job.ID, err)
+		return errorResponse(ctx, apierror.Internal("Failed to queue request"))
+	}
+	var err error
+	if workflow {
+		// Research runs as a multi-step Step Functions workflow instead of the queue
+		err = startResearchWorkflow(ctx, msg)
+	} else {
+		err = sendJobMessage(ctx, msg)
+	}
+	if err != nil {
+		log.Printf("Failed to enqueue job %s: %v", job.ID, err)
+		return errorResponse(ctx, apierror.New(503, apierror.CodeServiceUnavailable, "Failed to queue request"))
+	}
+
+	log.Printf("Queued job %s for mode: %s", job.ID, req.Mode)
+	return apiResponse(202, JobAccepted{JobID: job.ID, Status: jobQueued, StatusURL: jobPath(version, job.ID)})
+}
+
+// sendJobMessage queues a job for the SQS worker
+func sendJobMessage(ctx context.Context, msg jobMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job message: %w", err)
+	}
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(jobQueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("SendMessage failed: %w", err)
+	}
+	return nil
+}
+
+// isJobsRequest reports whether the route is part of the jobs API
+func isJobsRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.HasPrefix(path, "/jobs/")
+}
+
+// handleJobs serves GET /jobs/{id} and its event stream for the caller's own jobs
+func handleJobs(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("async processing not configured"))
+	}
+	if _, path := apiRoute(event); strings.HasSuffix(path, "/events") {
+		return handleJobEvents(ctx, event)
+	}
+
+	id := event.PathParameters["id"]
+	job, err := loadJob(ctx, principalFromEvent(event), id)
+	if err != nil {
+		log.Printf("Failed to load job %s: %v", id, err)
+		return errorResponse(ctx, apierror.Internal("Failed to load job"))
+	}
+	if job == nil {
+		return errorResponse(ctx, apierror.NotFound("job not found"))
+	}
+	return apiResponse(200, job)
+}
+
+// handleJobQueue processes queued requests. Retryable failures (throttling, Bedrock
+// outages) are returned as batch item failures so SQS redelivers them; after the last
+// attempt, or on a permanent failure, the job is marked failed.
+func handleJobQueue(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var resp events.SQSEventResponse
+	for _, record := range event.Records {
+		if retry := processJobRecord(ctx, record); retry {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+	return resp, nil
+}
+
+// processJobRecord runs one queued request and reports whether SQS should retry it
+func processJobRecord(ctx context.Context, record events.SQSMessage) bool {
+	var msg jobMessage
+	err := json.Unmarshal([]byte(record.Body), &msg)
+	if err == nil && msg.Revalidate != "" {
+		// Stale-while-revalidate refreshes share the queue but have no job record
+		refreshCachedReply(ctx, msg)
+		return false
+	}
+	if err != nil || msg.JobID == "" {
+		// Retrying can't fix a malformed message
+		log.Printf("Dropping malformed job message %s: %v", record.MessageId, err)
+		return false
+	}
+
+	attempt, _ := strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	ctx = apierror.WithRequestID(ctx, msg.JobID)
+	job := startJob(ctx, msg, attempt)
+	ctx = withProgress(ctx, func(stage string) {
+		job.Stage = stage
+		job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := saveJob(ctx, job); err != nil {
+			log.Printf("Failed to record job %s stage %s: %v", msg.JobID, stage, err)
+		}
+	})
+	response, apiErr := runJob(ctx, msg)
+
+	if apiErr != nil {
+		if apiErr.Retryable && attempt < jobMaxAttempts() {
+			log.Printf("Job %s attempt %d failed, will retry: %v", msg.JobID, attempt, apiErr)
+			job.Status, job.Stage = jobQueued, ""
+			_ = saveJob(ctx, job)
+			return true
+		}
+		if isCircuitOpen(apiErr) && queueWhenDownEnabled() && repend(ctx, msg) {
+			log.Printf("Job %s saved as pending until Bedrock recovers", msg.JobID)
+			return false
+		}
+		log.Printf("Job %s failed after %d attempt(s): %v", msg.JobID, attempt, apiErr)
+	}
+	finishJob(ctx, job, msg, response, apiErr)
+	return false
+}
+
+// startJob marks a job running on its given attempt
+func startJob(ctx context.Context, msg jobMessage, attempt int) Job {
+	job := newJob(msg.Principal, msg.JobID, msg.Request.Mode, msg.CreatedAt)
+	job.Status = jobRunning
+	job.Stage = stageThinking
+	job.Attempts = attempt
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveJob(ctx, job); err != nil {
+		log.Printf("Failed to mark job %s running: %v", msg.JobID, err)
+	}
+	return job
+}
+
+// runJob runs a queued request through the pipeline
+func runJob(ctx context.Context, msg jobMessage) (*Response, *apierror.Error) {
+	req := msg.Request
+	req.warnings = msg.Warnings
+	req.sinks = msg.Sinks
+	requestPreferences(ctx, &req, msg.Principal) // not serialized with the job
+	return processRequest(ctx, &req, msg.JobID, msg.Principal, msg.CreatedAt)
+}
+
+// finishJob records a job's result, or its error when apiErr is set
+func finishJob(ctx context.Context, job Job, msg jobMessage, response *Response, apiErr *apierror.Error) {
+	job.Stage = stageDone
+	if apiErr != nil {
+		job.Status = jobFailed
+		job.Error, _ = json.Marshal(apiErr.Envelope(ctx).Error)
+	} else {
+		job.Status = jobSucceeded
+		job.Result, _ = json.Marshal(renderResponse(msg.APIVersion, response))
+		log.Printf("Job %s succeeded", msg.JobID)
+	}
+
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveJob(ctx, job); err != nil {
+		// The result is already delivered to sinks and the callback; don't reprocess it
+		log.Printf("Failed to record job %s result: %v", msg.JobID, err)
+	}
+}
+
+// handleScheduledTask runs the task named in an EventBridge schedule's input
+func handleScheduledTask(ctx context.Context, task string) (interface{}, error) {
+	switch task {
+	case "dailyDigest":
+		return runDailyDigest(ctx, time.Now())
+	case "weeklySummary":
+		return runWeeklySummary(ctx, time.Now())
+	case "pendingCaptures":
+		return drainPendingCaptures(ctx)
+	default:
+		return nil, fmt.Errorf("unknown scheduled task %q", task)
+	}
+}
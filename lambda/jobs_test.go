@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// fakeSQS records sent message bodies
+type fakeSQS struct {
+	bodies []string
+	err    error
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.bodies = append(f.bodies, aws.ToString(params.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+// useJobQueue swaps in a fake queue (and fake history table) for the test
+func useJobQueue(t *testing.T, queue *fakeSQS, db *fakeDynamo) {
+	t.Helper()
+	useFakeDynamo(t, db)
+	origClient, origURL := sqsClient, jobQueueURL
+	sqsClient, jobQueueURL = queue, "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"
+	t.Cleanup(func() { sqsClient, jobQueueURL = origClient, origURL })
+}
+
+func asyncEvent(resource, body string) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Resource: resource, Body: body}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+	return event
+}
+
+func TestHandler_AsyncEnqueues(t *testing.T) {
+	queue, db := &fakeSQS{}, &fakeDynamo{}
+	useJobQueue(t, queue, db)
+
+	resp, err := handler(context.Background(), asyncEvent("/v2/invoke", `{"text":"research solar panels","mode":"research","async":true}`))
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("StatusCode = %d, want 202: %s", resp.StatusCode, resp.Body)
+	}
+
+	var accepted JobAccepted
+	json.Unmarshal([]byte(resp.Body), &accepted)
+	if accepted.Status != jobQueued || accepted.StatusURL != "/v2/jobs/"+accepted.JobID {
+		t.Errorf("accepted = %+v", accepted)
+	}
+
+	if len(queue.bodies) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(queue.bodies))
+	}
+	var msg jobMessage
+	json.Unmarshal([]byte(queue.bodies[0]), &msg)
+	if msg.JobID != accepted.JobID || msg.Principal != "user-1" || msg.APIVersion != 2 || msg.Request.Mode != "research" {
+		t.Errorf("message = %+v", msg)
+	}
+
+	if len(db.items) != 1 || db.items[0]["sk"] != jobSKPrefix+accepted.JobID || db.items[0]["status"] != jobQueued {
+		t.Errorf("job record = %v", db.items)
+	}
+}
+
+func TestHandler_AsyncFailures(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"hi","async":true}`))
+		if resp.StatusCode != 503 || !strings.Contains(resp.Body, "NOT_CONFIGURED") {
+			t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Run("send fails", func(t *testing.T) {
+		useJobQueue(t, &fakeSQS{err: errors.New("queue down")}, &fakeDynamo{})
+		resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"hi","async":true}`))
+		if resp.StatusCode != 503 || !strings.Contains(resp.Body, "SERVICE_UNAVAILABLE") {
+			t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Run("validation still applies", func(t *testing.T) {
+		queue := &fakeSQS{}
+		useJobQueue(t, queue, &fakeDynamo{})
+		resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"","async":true}`))
+		if resp.StatusCode != 400 || len(queue.bodies) != 0 {
+			t.Errorf("got %d with %d messages: %s", resp.StatusCode, len(queue.bodies), resp.Body)
+		}
+	})
+}
+
+func TestHandleJobs(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	job := newJob("user-1", "20250301T120000Z-abcd1234", "research", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	job.Status = jobSucceeded
+	job.Result = json.RawMessage(`{"title":"Solar panels"}`)
+	if err := saveJob(context.Background(), job); err != nil {
+		t.Fatalf("saveJob() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		principal string
+		id        string
+		wantCode  int
+	}{
+		{"own job", "GET", "user-1", job.ID, 200},
+		{"other principal", "GET", "user-2", job.ID, 404},
+		{"unknown job", "GET", "user-1", "missing", 404},
+		{"wrong method", "DELETE", "user-1", job.ID, 405},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{
+				HTTPMethod:     tt.method,
+				Resource:       "/jobs/{id}",
+				PathParameters: map[string]string{"id": tt.id},
+			}
+			event.RequestContext.Authorizer = map[string]interface{}{"principalId": tt.principal}
+
+			resp, _ := handler(context.Background(), event)
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("StatusCode = %d, want %d: %s", resp.StatusCode, tt.wantCode, resp.Body)
+			}
+			if tt.wantCode == 200 && !strings.Contains(resp.Body, `"status":"succeeded","mode":"research"`) ||
+				tt.wantCode == 200 && !strings.Contains(resp.Body, `"result":{"title":"Solar panels"}`) {
+				t.Errorf("Body = %s", resp.Body)
+			}
+		})
+	}
+}
+
+func TestHandleJobQueue(t *testing.T) {
+	message := func(attempt string) events.SQSMessage {
+		body, _ := json.Marshal(jobMessage{
+			JobID:      "job-1",
+			Principal:  "user-1",
+			APIVersion: 1,
+			CreatedAt:  time.Now().UTC(),
+			Request:    Req{Text: "hi", Mode: "note", MaxTokens: 800},
+		})
+		return events.SQSMessage{
+			MessageId:  "msg-" + attempt,
+			Body:       string(body),
+			Attributes: map[string]string{"ApproximateReceiveCount": attempt},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		record     events.SQSMessage
+		wantRetry  bool
+		wantStatus string
+	}{
+		{name: "retryable failure is redelivered", record: message("1"), wantRetry: true, wantStatus: jobQueued},
+		{name: "last attempt marks failed", record: message("3"), wantStatus: jobFailed},
+		{name: "malformed message is dropped", record: events.SQSMessage{MessageId: "bad", Body: "not json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDynamo{}
+			useFakeDynamo(t, db)
+			// An open circuit fails fast with a retryable 503, without calling Bedrock
+			cb := &CircuitBreaker{}
+			tripBreaker(cb, time.Now())
+			useBreaker(t, cb)
+
+			resp, err := handleJobQueue(context.Background(), events.SQSEvent{Records: []events.SQSMessage{tt.record}})
+			if err != nil {
+				t.Fatalf("handleJobQueue() error = %v", err)
+			}
+			if got := len(resp.BatchItemFailures) == 1; got != tt.wantRetry {
+				t.Errorf("retry = %v, want %v", got, tt.wantRetry)
+			}
+			if tt.wantStatus == "" {
+				if len(db.items) != 0 {
+					t.Errorf("malformed message should not write a job: %v", db.items)
+				}
+				return
+			}
+
+			job, _ := loadJob(context.Background(), "user-1", "job-1")
+			if job == nil || job.Status != tt.wantStatus {
+				t.Fatalf("job = %+v, want status %s", job, tt.wantStatus)
+			}
+			if tt.wantStatus == jobFailed && !strings.Contains(string(job.Error), "SERVICE_UNAVAILABLE") {
+				t.Errorf("job error = %s", job.Error)
+			}
+		})
+	}
+}
+
+func TestInvoke_Dispatch(t *testing.T) {
+	api, err := invoke(context.Background(), json.RawMessage(`{"httpMethod":"GET","resource":"/modes","path":"/modes"}`))
+	if err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	if resp, ok := api.(events.APIGatewayProxyResponse); !ok || resp.StatusCode != 200 {
+		t.Errorf("API Gateway payload returned %+v", api)
+	}
+
+	queued, err := invoke(context.Background(), json.RawMessage(`{"Records":[{"messageId":"m1","eventSource":"aws:sqs","body":"not json"}]}`))
+	if err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	if _, ok := queued.(events.SQSEventResponse); !ok {
+		t.Errorf("SQS payload returned %T, want SQSEventResponse", queued)
+	}
+
+	scheduled, err := invoke(context.Background(), json.RawMessage(`{"scheduledTask":"dailyDigest"}`))
+	if err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	if _, ok := scheduled.(DailyDigestRun); !ok {
+		t.Errorf("scheduled payload returned %T, want DailyDigestRun", scheduled)
+	}
+	if _, err := invoke(context.Background(), json.RawMessage(`{"scheduledTask":"nope"}`)); err == nil {
+		t.Error("unknown scheduled task: expected error")
+	}
+}
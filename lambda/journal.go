@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // JOURNAL_TIMEZONE must resolve without the OS zoneinfo database
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key prefix for journal entries in the history table: JOURNAL#<date>#<capture ID>,
+// so a principal's entries sort by day
+const journalSKPrefix = "JOURNAL#"
+
+// Days of entries counted in the mood and energy breakdown of GET /journal/stats
+const journalStatsWindowDays = 30
+
+// Upper bound on entries read for stats (several years of daily journaling)
+const maxJournalEntries = 5000
+
+// journalMoods are the moods the model may tag an entry with; anything else is neutral
+var journalMoods = map[string]bool{
+	"happy": true, "grateful": true, "excited": true, "calm": true, "neutral": true,
+	"tired": true, "stressed": true, "anxious": true, "sad": true, "angry": true,
+}
+
+// journalEnergyLevels are the accepted energy values
+var journalEnergyLevels = map[string]bool{"low": true, "medium": true, "high": true}
+
+// JournalEntry is the mood and energy detected in a journal mode capture
+type JournalEntry struct {
+	Date   string `json:"date"` // entry day (YYYY-MM-DD) in JOURNAL_TIMEZONE
+	Mood   string `json:"mood"`
+	Energy string `json:"energy,omitempty"` // low|medium|high
+}
+
+// JournalItem is a stored journal entry (pk = principal, sk = JOURNAL#<date>#<id>)
+type JournalItem struct {
+	PK        string `dynamodbav:"pk"`
+	SK        string `dynamodbav:"sk"`
+	ID        string `dynamodbav:"id"`
+	Date      string `dynamodbav:"date"`
+	Mood      string `dynamodbav:"mood"`
+	Energy    string `dynamodbav:"energy,omitempty"`
+	Title     string `dynamodbav:"title"`
+	CreatedAt string `dynamodbav:"createdAt"`
+}
+
+// JournalStats is the body of GET /journal/stats
+type JournalStats struct {
+	TotalEntries  int            `json:"totalEntries"`
+	DaysJournaled int            `json:"daysJournaled"`
+	CurrentStreak int            `json:"currentStreak"` // consecutive days up to today (or yesterday, if today has no entry yet)
+	LongestStreak int            `json:"longestStreak"`
+	LastEntryDate string         `json:"lastEntryDate,omitempty"`
+	WindowDays    int            `json:"windowDays"`
+	Moods         map[string]int `json:"moods"`  // entries per mood within the window
+	Energy        map[string]int `json:"energy"` // entries per energy level within the window
+}
+
+// journalLocation is the timezone that decides which day an entry belongs to
+func journalLocation() *time.Location {
+	return locationFromEnv("JOURNAL_TIMEZONE")
+}
+
+// locationFromEnv loads the IANA timezone named by an environment variable, defaulting
+// to UTC when it's unset or invalid
+func locationFromEnv(key string) *time.Location {
+	name := getEnv(key, "UTC")
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid %s %q, using UTC", key, name)
+		return time.UTC
+	}
+	return loc
+}
+
+// finalizeJournal validates the model's mood and energy, dates the entry and stores
+// it for streak tracking. Storage failures are logged; the entry is still returned.
+func finalizeJournal(ctx context.Context, meta captureMeta, resp *Response) {
+	if resp.Journal == nil {
+		resp.Journal = &JournalEntry{}
+	}
+	resp.Action = "journal"
+
+	entry := resp.Journal
+	entry.Mood = strings.ToLower(strings.TrimSpace(entry.Mood))
+	if !journalMoods[entry.Mood] {
+		entry.Mood = "neutral"
+	}
+	entry.Energy = strings.ToLower(strings.TrimSpace(entry.Energy))
+	if !journalEnergyLevels[entry.Energy] {
+		entry.Energy = ""
+	}
+	entry.Date = meta.CreatedAt.In(journalLocation()).Format("2006-01-02")
+
+	if historyTableName == "" {
+		return
+	}
+	if err := saveJournalEntry(ctx, meta, *resp); err != nil {
+		log.Printf("Failed to store journal entry: %v", err)
+	}
+}
+
+// saveJournalEntry writes the entry under the principal's JOURNAL# sort keys
+func saveJournalEntry(ctx context.Context, meta captureMeta, resp Response) error {
+	item, err := attributevalue.MarshalMap(JournalItem{
+		PK:        historyPK(meta.Principal),
+		SK:        journalSKPrefix + resp.Journal.Date + "#" + meta.ID,
+		ID:        meta.ID,
+		Date:      resp.Journal.Date,
+		Mood:      resp.Journal.Mood,
+		Energy:    resp.Journal.Energy,
+		Title:     resp.Title,
+		CreatedAt: meta.CreatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// loadJournalEntries reads a principal's journal entries, newest first
+func loadJournalEntries(ctx context.Context, principal string) ([]JournalItem, error) {
+	var entries []JournalItem
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(historyTableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":     &types.AttributeValueMemberS{Value: historyPK(principal)},
+				":prefix": &types.AttributeValueMemberS{Value: journalSKPrefix},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("DynamoDB Query failed: %w", err)
+		}
+
+		var page []JournalItem
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal journal entries: %w", err)
+		}
+		entries = append(entries, page...)
+
+		if len(out.LastEvaluatedKey) == 0 || len(entries) >= maxJournalEntries {
+			return entries, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// journalStats computes streaks and the recent mood/energy breakdown. today is the
+// current day in JOURNAL_TIMEZONE.
+func journalStats(entries []JournalItem, today time.Time) JournalStats {
+	stats := JournalStats{
+		TotalEntries: len(entries),
+		WindowDays:   journalStatsWindowDays,
+		Moods:        map[string]int{},
+		Energy:       map[string]int{},
+	}
+
+	windowStart := today.AddDate(0, 0, -(journalStatsWindowDays - 1)).Format("2006-01-02")
+	days := map[string]bool{}
+	for _, entry := range entries {
+		days[entry.Date] = true
+		if entry.Date >= windowStart {
+			stats.Moods[entry.Mood]++
+			if entry.Energy != "" {
+				stats.Energy[entry.Energy]++
+			}
+		}
+	}
+	stats.DaysJournaled = len(days)
+	if len(days) == 0 {
+		return stats
+	}
+
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	stats.LastEntryDate = dates[len(dates)-1]
+
+	// Longest run of consecutive days
+	run := 0
+	var previous time.Time
+	for _, date := range dates {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		if run > 0 && day.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		previous = day
+		if run > stats.LongestStreak {
+			stats.LongestStreak = run
+		}
+	}
+
+	// The current streak stays alive until a whole day passes without an entry
+	day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if !days[day.Format("2006-01-02")] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for days[day.Format("2006-01-02")] {
+		stats.CurrentStreak++
+		day = day.AddDate(0, 0, -1)
+	}
+	return stats
+}
+
+// isJournalRequest reports whether the route is part of the journal API
+func isJournalRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.HasPrefix(path, "/journal/")
+}
+
+// handleJournal serves GET /journal/stats for the caller's own journal
+func handleJournal(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	_, path := apiRoute(event)
+	if strings.TrimSuffix(path, "/") != "/journal/stats" {
+		return errorResponse(ctx, apierror.NotFound("Unknown journal resource"))
+	}
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("journal storage not configured"))
+	}
+
+	entries, err := loadJournalEntries(ctx, principalFromEvent(event))
+	if err != nil {
+		log.Printf("Failed to load journal entries: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load journal"))
+	}
+	return apiResponse(200, journalStats(entries, time.Now().In(journalLocation())))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestFinalizeJournal(t *testing.T) {
+	// 02:30 UTC on the 16th is still the 15th in Los Angeles
+	meta := captureMeta{ID: "cap-1", Principal: "user-1", CreatedAt: time.Date(2025, 1, 16, 2, 30, 0, 0, time.UTC)}
+
+	t.Run("validates and dates the entry", func(t *testing.T) {
+		t.Setenv("JOURNAL_TIMEZONE", "America/Los_Angeles")
+		store := &fakeDynamo{}
+		useFakeDynamo(t, store)
+
+		resp := Response{Action: "note", Title: "Long day", Journal: &JournalEntry{Mood: " Tired ", Energy: "LOW"}}
+		finalizeJournal(context.Background(), meta, &resp)
+
+		want := JournalEntry{Date: "2025-01-15", Mood: "tired", Energy: "low"}
+		if resp.Action != "journal" || *resp.Journal != want {
+			t.Errorf("got action %q, journal %+v", resp.Action, *resp.Journal)
+		}
+		if len(store.items) != 1 || store.items[0]["sk"] != "JOURNAL#2025-01-15#cap-1" || store.items[0]["pk"] != "USER#user-1" {
+			t.Errorf("stored %v", store.items)
+		}
+	})
+
+	t.Run("unknown values", func(t *testing.T) {
+		t.Setenv("JOURNAL_TIMEZONE", "Mars/Olympus_Mons")
+		resp := Response{Journal: &JournalEntry{Mood: "melancholic", Energy: "extreme"}}
+		finalizeJournal(context.Background(), meta, &resp)
+
+		want := JournalEntry{Date: "2025-01-16", Mood: "neutral"}
+		if *resp.Journal != want {
+			t.Errorf("journal = %+v, want %+v", *resp.Journal, want)
+		}
+	})
+
+	t.Run("missing journal object", func(t *testing.T) {
+		resp := Response{}
+		finalizeJournal(context.Background(), meta, &resp)
+		if resp.Journal == nil || resp.Journal.Mood != "neutral" {
+			t.Errorf("journal = %+v", resp.Journal)
+		}
+	})
+}
+
+func TestJournalStats(t *testing.T) {
+	today := time.Date(2025, 3, 10, 21, 0, 0, 0, time.UTC)
+	entry := func(date, mood, energy string) JournalItem {
+		return JournalItem{Date: date, Mood: mood, Energy: energy}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		stats := journalStats(nil, today)
+		if stats.TotalEntries != 0 || stats.CurrentStreak != 0 || stats.LongestStreak != 0 || stats.LastEntryDate != "" {
+			t.Errorf("stats = %+v", stats)
+		}
+	})
+
+	t.Run("streaks", func(t *testing.T) {
+		stats := journalStats([]JournalItem{
+			entry("2025-03-09", "calm", "medium"),
+			entry("2025-03-08", "happy", ""),
+			entry("2025-03-08", "tired", "low"),
+			entry("2025-03-07", "happy", "high"),
+			entry("2025-03-01", "sad", "low"),
+			// A four day run across the month boundary, outside the mood window
+			entry("2025-02-01", "calm", "low"),
+			entry("2025-01-31", "calm", "low"),
+			entry("2025-01-30", "calm", "low"),
+			entry("2025-01-29", "calm", "low"),
+		}, today)
+
+		if stats.TotalEntries != 9 || stats.DaysJournaled != 8 {
+			t.Errorf("TotalEntries = %d, DaysJournaled = %d", stats.TotalEntries, stats.DaysJournaled)
+		}
+		// No entry yet today, so the streak runs through yesterday
+		if stats.CurrentStreak != 3 || stats.LongestStreak != 4 || stats.LastEntryDate != "2025-03-09" {
+			t.Errorf("stats = %+v", stats)
+		}
+		if stats.Moods["happy"] != 2 || stats.Moods["calm"] != 1 || stats.Moods["sad"] != 1 || stats.Energy["low"] != 2 {
+			t.Errorf("moods = %v, energy = %v", stats.Moods, stats.Energy)
+		}
+	})
+
+	t.Run("broken streak", func(t *testing.T) {
+		stats := journalStats([]JournalItem{entry("2025-03-08", "calm", "")}, today)
+		if stats.CurrentStreak != 0 || stats.LongestStreak != 1 {
+			t.Errorf("stats = %+v", stats)
+		}
+	})
+}
+
+func TestHandleJournal(t *testing.T) {
+	call := func(method, resource, principal string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: resource}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("GET", "/journal/stats", "user-1"); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+	now := time.Now().UTC()
+	for i, principal := range []string{"user-1", "user-1", "user-2"} {
+		meta := captureMeta{ID: string(rune('a' + i)), Principal: principal, CreatedAt: now.AddDate(0, 0, -i)}
+		finalizeJournal(context.Background(), meta, &Response{Journal: &JournalEntry{Mood: "happy"}})
+	}
+
+	t.Run("stats for the caller", func(t *testing.T) {
+		resp := call("GET", "/journal/stats", "user-1")
+		if resp.StatusCode != 200 {
+			t.Fatalf("StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+		var stats JournalStats
+		json.Unmarshal([]byte(resp.Body), &stats)
+		if stats.TotalEntries != 2 || stats.CurrentStreak != 2 || stats.Moods["happy"] != 2 {
+			t.Errorf("stats = %+v", stats)
+		}
+	})
+
+	t.Run("unknown resource", func(t *testing.T) {
+		if resp := call("GET", "/journal/entries", "user-1"); resp.StatusCode != 404 {
+			t.Errorf("StatusCode = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		if resp := call("POST", "/journal/stats", "user-1"); resp.StatusCode != 405 {
+			t.Errorf("StatusCode = %d, want 405", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// promptLanguage is a language captures are detected in, with the headings the mode
+// prompts ask for ("Summary", "Action Items") as a native writer would name them
+type promptLanguage struct {
+	name      string
+	headings  [2]string
+	stopwords []string // Latin-script languages: common short words that identify them
+	letters   string   // Latin-script languages: letters that point to them
+}
+
+// promptLanguages are keyed by ISO 639-1 code, as returned in Response.language
+var promptLanguages = map[string]promptLanguage{
+	"en": {name: "English", headings: [2]string{"Summary", "Action Items"},
+		stopwords: []string{"the", "and", "to", "of", "is", "it", "that", "for", "on", "with", "my", "i", "you", "at", "this", "be", "are", "was", "have", "remind", "tomorrow", "today"}},
+	"es": {name: "Spanish", headings: [2]string{"Resumen", "Tareas pendientes"}, letters: "ñ¿¡",
+		stopwords: []string{"el", "la", "los", "las", "que", "y", "de", "en", "un", "una", "por", "para", "con", "es", "mi", "del", "al", "lo", "se", "recuérdame", "mañana", "hoy"}},
+	"fr": {name: "French", headings: [2]string{"Résumé", "Actions à faire"}, letters: "çêâîûœ",
+		stopwords: []string{"le", "la", "les", "des", "et", "est", "un", "une", "pour", "que", "qui", "dans", "avec", "sur", "pas", "je", "mon", "ma", "du", "au", "demain", "rappelle", "moi"}},
+	"de": {name: "German", headings: [2]string{"Zusammenfassung", "Aufgaben"}, letters: "ßäöü",
+		stopwords: []string{"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "ein", "eine", "zu", "den", "von", "für", "auf", "mein", "morgen", "heute", "erinnere", "mich"}},
+	"it": {name: "Italian", headings: [2]string{"Riepilogo", "Azioni da fare"}, letters: "ìò",
+		stopwords: []string{"il", "la", "di", "che", "e", "è", "un", "una", "per", "con", "non", "sono", "del", "della", "mi", "domani", "oggi", "ricordami", "alle", "lo"}},
+	"pt": {name: "Portuguese", headings: [2]string{"Resumo", "Tarefas"}, letters: "ãõç",
+		stopwords: []string{"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "é", "meu", "minha", "amanhã", "hoje", "lembre"}},
+	"nl": {name: "Dutch", headings: [2]string{"Samenvatting", "Actiepunten"},
+		stopwords: []string{"de", "het", "een", "en", "van", "ik", "te", "dat", "is", "niet", "op", "voor", "met", "mijn", "morgen", "vandaag", "herinner", "aan"}},
+	"ru": {name: "Russian", headings: [2]string{"Кратко", "Задачи"}},
+	"uk": {name: "Ukrainian", headings: [2]string{"Коротко", "Завдання"}},
+	"el": {name: "Greek", headings: [2]string{"Σύνοψη", "Ενέργειες"}},
+	"ar": {name: "Arabic", headings: [2]string{"ملخص", "المهام"}},
+	"he": {name: "Hebrew", headings: [2]string{"סיכום", "משימות"}},
+	"hi": {name: "Hindi", headings: [2]string{"सारांश", "कार्य"}},
+	"th": {name: "Thai", headings: [2]string{"สรุป", "สิ่งที่ต้องทำ"}},
+	"ja": {name: "Japanese", headings: [2]string{"要約", "やること"}},
+	"zh": {name: "Chinese", headings: [2]string{"摘要", "待办事项"}},
+	"ko": {name: "Korean", headings: [2]string{"요약", "할 일"}},
+}
+
+// scriptLanguages pick the language of text written mostly in a non-Latin script.
+// Kana decides Japanese before Han, and Ukrainian-only letters decide it over Russian.
+var scriptLanguages = []struct {
+	code   string
+	script *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"el", unicode.Greek},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"hi", unicode.Devanagari},
+	{"th", unicode.Thai},
+}
+
+// detectLanguage returns the ISO 639-1 code of the language text is written in, or ""
+// when it can't tell (too short, or no clear winner). Non-Latin text is identified by
+// its script; Latin text by its common words and accented letters.
+func detectLanguage(text string) string {
+	latin, other := 0, map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.script, r) {
+				other[script.code]++
+				break
+			}
+		}
+	}
+
+	nonLatin := 0
+	for _, count := range other {
+		nonLatin += count
+	}
+	if nonLatin > latin {
+		switch {
+		case other["ja"] > 0:
+			return "ja"
+		case other["ru"] > 0 && strings.ContainsAny(strings.ToLower(text), "іїєґ"):
+			return "uk"
+		}
+		best := ""
+		for _, script := range scriptLanguages {
+			if other[script.code] > other[best] {
+				best = script.code
+			}
+		}
+		return best
+	}
+	if latin == 0 {
+		return ""
+	}
+
+	lower := strings.ToLower(text)
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	scores := map[string]int{}
+	for code, lang := range promptLanguages {
+		for _, word := range words {
+			for _, stopword := range lang.stopwords {
+				if word == stopword {
+					scores[code]++
+				}
+			}
+		}
+		if lang.letters != "" && strings.ContainsAny(lower, lang.letters) {
+			scores[code] += 2
+		}
+	}
+
+	best, second := "", 0
+	for code, score := range scores {
+		switch {
+		case best == "" || score > scores[best]:
+			if best != "" {
+				second = max(second, scores[best])
+			}
+			best = code
+		default:
+			second = max(second, score)
+		}
+	}
+	if best == "" || scores[best] == 0 || scores[best] == second {
+		return ""
+	}
+	return best
+}
+
+// languagePrompt is the system prompt section asking for output in the language the
+// request was written in, so non-English captures don't come back with English
+// headings. English requests and translations (which have a target language) add none.
+func languagePrompt(req *Req) string {
+	lang, ok := promptLanguages[req.language]
+	if !ok || req.language == "en" || req.Mode == "translate" {
+		return ""
+	}
+	return `
+
+Language:
+The user wrote in ` + lang.name + `. Write the title, markdown (headings included), shortText and notes in ` + lang.name + `, e.g. "` + lang.headings[0] + `" instead of "Summary" and "` + lang.headings[1] + `" instead of "Action Items". Keep the JSON keys, dates and the values of action, color, sentiment, urgency and priority exactly as specified above.`
+}
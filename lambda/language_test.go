@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Remind me to call mom at 5 tomorrow", "en"},
+		{"Recuérdame llamar a mamá mañana a las cinco", "es"},
+		{"Rappelle-moi d'acheter du pain pour le dîner", "fr"},
+		{"Erinnere mich morgen an den Zahnarzttermin", "de"},
+		{"Ricordami di comprare il latte domani", "it"},
+		{"Lembre-me de comprar pão amanhã", "pt"},
+		{"Herinner me morgen aan de tandarts", "nl"},
+		{"明日の午後3時に歯医者を予約する", "ja"},
+		{"明天下午三点去看牙医", "zh"},
+		{"내일 오후 3시에 치과 예약", "ko"},
+		{"Напомни мне завтра позвонить маме", "ru"},
+		{"Нагадай мені завтра їхати до лікаря", "uk"},
+		{"Υπενθύμισέ μου να πάρω τη μαμά", "el"},
+		{"ذكرني بالاتصال بأمي غدا", "ar"},
+		{"Buy milk", ""},
+		{"", ""},
+		{"12:30 🦷", ""},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLanguagePrompt(t *testing.T) {
+	for _, req := range []*Req{
+		{Mode: "note"},
+		{Mode: "note", language: "en"},
+		{Mode: "translate", language: "es"},
+		{Mode: "note", language: "xx"},
+	} {
+		if got := languagePrompt(req); got != "" {
+			t.Errorf("languagePrompt(%s, %q) = %q, want empty", req.Mode, req.language, got)
+		}
+	}
+	got := languagePrompt(&Req{Mode: "summarize", language: "de"})
+	if !strings.Contains(got, "The user wrote in German") || !strings.Contains(got, `"Zusammenfassung" instead of "Summary"`) {
+		t.Errorf("languagePrompt() = %q", got)
+	}
+}
+
+func TestProcessRequest_Language(t *testing.T) {
+	model := &fakeBedrock{text: `{"action":"reminder","title":"Comprar leche","markdown":"Comprar leche"}`}
+	useFakeBedrock(t, model)
+
+	req := &Req{Text: "Recuérdame comprar leche mañana", Mode: "reminder", MaxTokens: 800}
+	response, apiErr := processRequest(context.Background(), req, "id-1", "user-1", time.Now())
+	if apiErr != nil {
+		t.Fatalf("processRequest() error = %v", apiErr)
+	}
+	if response.Language != "es" {
+		t.Errorf("Language = %q, want es", response.Language)
+	}
+	if !strings.Contains(string(model.body), "The user wrote in Spanish") {
+		t.Errorf("system prompt lacks the language section: %s", model.body)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Default request size limits (overridable via MAX_BODY_BYTES, MAX_TEXT_CHARS,
+// SUMMARIZE_MAX_TEXT_CHARS and TEXT_TRUNCATE_PERCENT)
+const (
+	defaultMaxBodyBytes          = 64 * 1024 // Raw request body
+	defaultMaxTextChars          = 8000      // The text field, in characters
+	defaultSummarizeMaxTextChars = 100000    // The text field in summarize mode, which is built for pasted documents
+	defaultTruncatePercent       = 10        // Texts up to this much over the limit are truncated, not rejected
+)
+
+// errPayloadTooLarge marks validation failures caused by oversize input (returned as 413)
+var errPayloadTooLarge = errors.New("payload too large")
+
+// sizeLimits caps the request body and text field
+type sizeLimits struct {
+	MaxBodyBytes          int
+	MaxTextChars          int
+	SummarizeMaxTextChars int
+	TruncatePercent       int
+}
+
+// loadSizeLimits reads the size limits from environment, using defaults for invalid values
+func loadSizeLimits() sizeLimits {
+	return sizeLimits{
+		MaxBodyBytes:          limitEnv("MAX_BODY_BYTES", defaultMaxBodyBytes, 1),
+		MaxTextChars:          limitEnv("MAX_TEXT_CHARS", defaultMaxTextChars, 1),
+		SummarizeMaxTextChars: limitEnv("SUMMARIZE_MAX_TEXT_CHARS", defaultSummarizeMaxTextChars, 1),
+		TruncatePercent:       limitEnv("TEXT_TRUNCATE_PERCENT", defaultTruncatePercent, 0),
+	}
+}
+
+// textLimit returns the longest text accepted in a mode
+func (l sizeLimits) textLimit(mode string) int {
+	if mode == "summarize" {
+		return l.SummarizeMaxTextChars
+	}
+	return l.MaxTextChars
+}
+
+func limitEnv(key string, defaultValue, minValue int) int {
+	if env := os.Getenv(key); env != "" {
+		if value, err := strconv.Atoi(env); err == nil && value >= minValue {
+			return value
+		}
+		log.Printf("Invalid %s value: %s, using default", key, env)
+	}
+	return defaultValue
+}
+
+// checkBodySize rejects bodies over MaxBodyBytes before they are fully validated.
+// Requests may be larger by the size of an inline image or audio clip they carry (up to
+// the base64 size of its limit), and summarize requests by their (worst case UTF-8) text
+// limit; limitText applies the exact text limit later. The allowances are read from the
+// parsed mode, imageBase64 and audioBase64, never from the body's text, so words in a
+// request can't raise its own limit.
+func (l sizeLimits) checkBodySize(body string) error {
+	if len(body) <= l.MaxBodyBytes {
+		return nil
+	}
+	imageAllowance := base64.StdEncoding.EncodedLen(maxImageBytes())
+	audioAllowance := base64.StdEncoding.EncodedLen(maxAudioBytes())
+	textAllowance := l.SummarizeMaxTextChars * utf8.UTFMax
+	if len(body) > l.MaxBodyBytes+imageAllowance+audioAllowance+textAllowance {
+		return fmt.Errorf("%w: request body is %d bytes, limit is %d", errPayloadTooLarge, len(body), l.MaxBodyBytes)
+	}
+
+	var fields struct {
+		Mode        string `json:"mode"`
+		ImageBase64 string `json:"imageBase64"`
+		AudioBase64 string `json:"audioBase64"`
+	}
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return fmt.Errorf("%w: request body is %d bytes, limit is %d", errPayloadTooLarge, len(body), l.MaxBodyBytes)
+	}
+	limit := l.MaxBodyBytes + min(len(fields.ImageBase64), imageAllowance) + min(len(fields.AudioBase64), audioAllowance)
+	if fields.Mode == "summarize" {
+		limit += textAllowance
+	}
+	if len(body) > limit {
+		return fmt.Errorf("%w: request body is %d bytes, limit is %d", errPayloadTooLarge, len(body), limit)
+	}
+	return nil
+}
+
+// limitText enforces the mode's text limit on req.Text. Dictated transcripts that run slightly
+// over (within TruncatePercent) are cut at a word boundary with a warning instead of failing.
+func (l sizeLimits) limitText(req *Req) error {
+	max := l.textLimit(req.Mode)
+	chars := utf8.RuneCountInString(req.Text)
+	if chars <= max {
+		return nil
+	}
+
+	tolerance := max + max*l.TruncatePercent/100
+	if chars > tolerance {
+		return fmt.Errorf("%w: text is %d characters, limit is %d", errPayloadTooLarge, chars, max)
+	}
+
+	req.Text = truncateText(req.Text, max)
+	req.warnings = append(req.warnings, fmt.Sprintf("text was truncated from %d to %d characters", chars, utf8.RuneCountInString(req.Text)))
+	log.Printf("Truncated text from %d to %d characters", chars, max)
+	return nil
+}
+
+// truncateText cuts s to at most max characters, preferring the last whitespace in the
+// final tenth so words aren't split
+func truncateText(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndexFunc(cut, func(r rune) bool { return r == ' ' || r == '\n' || r == '\t' }); i > 0 && utf8.RuneCountInString(cut[:i]) >= max*9/10 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLoadSizeLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want sizeLimits
+	}{
+		{
+			name: "defaults",
+			want: sizeLimits{MaxBodyBytes: defaultMaxBodyBytes, MaxTextChars: defaultMaxTextChars, SummarizeMaxTextChars: defaultSummarizeMaxTextChars, TruncatePercent: defaultTruncatePercent},
+		},
+		{
+			name: "custom values",
+			env:  map[string]string{"MAX_BODY_BYTES": "2048", "MAX_TEXT_CHARS": "500", "SUMMARIZE_MAX_TEXT_CHARS": "5000", "TEXT_TRUNCATE_PERCENT": "0"},
+			want: sizeLimits{MaxBodyBytes: 2048, MaxTextChars: 500, SummarizeMaxTextChars: 5000, TruncatePercent: 0},
+		},
+		{
+			name: "invalid values fall back to defaults",
+			env:  map[string]string{"MAX_BODY_BYTES": "0", "MAX_TEXT_CHARS": "lots", "SUMMARIZE_MAX_TEXT_CHARS": "-1", "TEXT_TRUNCATE_PERCENT": "-5"},
+			want: sizeLimits{MaxBodyBytes: defaultMaxBodyBytes, MaxTextChars: defaultMaxTextChars, SummarizeMaxTextChars: defaultSummarizeMaxTextChars, TruncatePercent: defaultTruncatePercent},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"MAX_BODY_BYTES", "MAX_TEXT_CHARS", "SUMMARIZE_MAX_TEXT_CHARS", "TEXT_TRUNCATE_PERCENT"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := loadSizeLimits(); got != tt.want {
+				t.Errorf("loadSizeLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitText(t *testing.T) {
+	limits := sizeLimits{MaxBodyBytes: defaultMaxBodyBytes, MaxTextChars: 100, SummarizeMaxTextChars: 1000, TruncatePercent: 10}
+
+	tests := []struct {
+		name         string
+		mode         string
+		text         string
+		wantErr      bool
+		wantChars    int // maximum length after limiting
+		wantWarnings int
+	}{
+		{
+			name:      "within limit",
+			text:      strings.Repeat("a", 100),
+			wantChars: 100,
+		},
+		{
+			name:         "slightly over is truncated",
+			text:         strings.Repeat("word ", 22), // 110 chars
+			wantChars:    100,
+			wantWarnings: 1,
+		},
+		{
+			name:    "far over is rejected",
+			text:    strings.Repeat("a", 111),
+			wantErr: true,
+		},
+		{
+			name:         "counts characters not bytes",
+			text:         strings.Repeat("é", 105),
+			wantChars:    100,
+			wantWarnings: 1,
+		},
+		{
+			name:      "summarize mode has its own limit",
+			mode:      "summarize",
+			text:      strings.Repeat("a", 1000),
+			wantChars: 1000,
+		},
+		{
+			name:    "summarize limit is enforced",
+			mode:    "summarize",
+			text:    strings.Repeat("a", 1101),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Req{Mode: tt.mode, Text: tt.text}
+			err := limits.limitText(req)
+			if tt.wantErr {
+				if !errors.Is(err, errPayloadTooLarge) {
+					t.Errorf("limitText() error = %v, want errPayloadTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("limitText() unexpected error: %v", err)
+			}
+			if got := utf8.RuneCountInString(req.Text); got > tt.wantChars {
+				t.Errorf("text is %d characters, want at most %d", got, tt.wantChars)
+			}
+			if !utf8.ValidString(req.Text) {
+				t.Error("truncated text is not valid UTF-8")
+			}
+			if len(req.warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %v, want %d", req.warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{"short text unchanged", "hello world", 20, "hello world"},
+		{"cuts at word boundary", "the quick brown fox jumps", 22, "the quick brown fox"},
+		{"hard cut without nearby space", "abcdefghijklmnopqrstuvwxyz", 10, "abcdefghij"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateText(tt.text, tt.max); got != tt.want {
+				t.Errorf("truncateText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_BodyTooLarge(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "64")
+
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Path:       "/",
+		Body:       `{"text":"` + strings.Repeat("a", 100) + `"}`,
+	})
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 413 {
+		t.Errorf("StatusCode = %d, want 413", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Body, "limit is 64") {
+		t.Errorf("Body = %s, want size limit in error", resp.Body)
+	}
+}
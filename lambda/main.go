@@ -7,24 +7,84 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/polly"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/transcribe"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+
+	"wrist-agent/apierror"
 )
 
 // Request payload structure
 type Req struct {
 	Text           string `json:"text"`
-	Mode           string `json:"mode"`           // note|reminder|event|research|deepthink
+	TitleHint      string `json:"titleHint"`      // optional suggested title, e.g. the subject of an emailed capture
+	Mode           string `json:"mode"`           // note|reminder|event|research|deepthink|email|shopping|journal|contact|translate|summarize|question|timer
 	ThinkingTokens int    `json:"thinkingTokens"` // 0..N for extended thinking
+	ThinkingPolicy string `json:"thinkingPolicy"` // optional "auto": thinkingTokens picked from the mode and text length
 	MaxTokens      int    `json:"maxTokens"`      // default 800
+	Deliver        bool   `json:"deliver"`        // opt in to external sinks (e.g. Google Calendar)
+	Send           bool   `json:"send"`           // email mode: send via SES instead of returning a draft
+	CallbackURL    string `json:"callbackUrl"`    // optional allowlisted https URL that receives the final Response
+	Async          bool   `json:"async"`          // queue for background processing; poll /jobs/{id} or use callbackUrl
+	ImageBase64    string `json:"imageBase64"`    // optional jpeg/png/gif/webp image for vision queries
+	ImageKey       string `json:"imageKey"`       // optional image uploaded via /uploads (required for async)
+	AudioBase64    string `json:"audioBase64"`    // optional spoken request, transcribed in place of text
+	AudioKey       string `json:"audioKey"`       // optional audio uploaded via /uploads (required for async)
+	Speak          bool   `json:"speak"`          // also return a spoken confirmation as audioUrl (Polly)
+	TargetLanguage string `json:"targetLanguage"` // translate mode: language to translate into, default English
+	Timezone       string `json:"timezone"`       // IANA timezone dates are resolved in, default the caller's preference, then UTC
+	AllowDuplicate bool   `json:"allowDuplicate"` // store the capture even if it repeats a recent one
+	ConversationID string `json:"conversationId"` // optional caller-chosen ID; requests sharing one see the earlier turns
+	Debug          bool   `json:"debug"`          // admin tokens only: add a debug section with model and timing diagnostics
+	CostClass      string `json:"costClass"`      // economy|standard|premium: model and thinking ceiling, default standard
+	Format         string `json:"format"`         // json (default)|shortcut|markdown|text|html; also ?format= or the Accept header
+	XSuccess       string `json:"xSuccess"`       // format shortcut: x-callback URL returned with the result as query parameters
+	XError         string `json:"xError"`         // format shortcut: x-callback URL returned with errorCode and errorMessage
+
+	Temperature   *float64 `json:"temperature"`   // optional 0-1, default 0.1
+	TopP          *float64 `json:"topP"`          // optional nucleus sampling, 0-1
+	TopK          *int     `json:"topK"`          // optional, 1-500; not supported by Llama
+	StopSequences []string `json:"stopSequences"` // optional, up to 4 strings of at most 64 characters; not supported by Llama
+
+	scopes   tokenScopes // caller restrictions from the authorizer context, never from the body
+	admin    bool        // caller has an admin token, from the authorizer context
+	dryRun   bool        // self-test canary: skip sinks, duplicate checks and experiment counters
+	model    string      // Bedrock model override, set when a spend budget degrades the request
+	warnings []string    // non-fatal adjustments made during validation (e.g. truncation)
+	image    *imageInput // decoded image, set by validateImage or loadImage
+	audio    []byte      // decoded inline audio, set by validateAudio
+
+	vocabulary    []string       // caller's custom terms, loaded by processRequest
+	preferredTags []string       // caller's most used tags, loaded by processRequest
+	conversation  *Conversation  // earlier turns when conversationId is set, loaded by processRequest
+	preferences   *Preferences   // caller's profile, loaded before validation so it can supply the mode (again by runJob)
+	variant       *PromptVariant // prompt experiment arm, picked by callBedrock or carried by a cache refresh
+	tenant        string         // caller's tenant, set by processRequest so tenants never share cached replies
+	sinks         []string       // device profile's sinks, replacing the mode's SINKS routing
+	revalidate    bool           // cache refresh: skip the cache lookup and store the new reply
+
+	transcript string // what was heard in the audio, echoed in the response
+	language   string // detected language of the text (ISO 639-1), set by processRequest
 }
 
 // Response structure
@@ -39,12 +99,59 @@ type Response struct {
 	URL      *string  `json:"url"`
 	Notes    *string  `json:"notes"`
 	Tags     []string `json:"tags"`
+
+	ShortText     string           `json:"shortText,omitempty"`           // glanceable summary for the watch, at most SHORT_TEXT_MAX_WORDS words
+	Emoji         string           `json:"emoji,omitempty"`               // single emoji for list rows and complications
+	Color         string           `json:"color,omitempty"`               // SwiftUI system color name, e.g. orange
+	Recurrence    *string          `json:"recurrence,omitempty"`          // RFC 5545 RRULE value, e.g. FREQ=WEEKLY;BYDAY=MO
+	Priority      string           `json:"priority,omitempty"`            // reminders: low|medium|high, inferred from phrasing
+	Urgency       string           `json:"urgency,omitempty"`             // low|medium|high, for sorting captures by how soon they matter
+	Sentiment     string           `json:"sentiment,omitempty"`           // positive|neutral|negative|mixed
+	Language      string           `json:"language,omitempty"`            // detected language of the request (ISO 639-1), e.g. es
+	DueConfidence *float64         `json:"dueConfidence,omitempty"`       // reminders and events: 0-1 confidence in dueISO/startISO
+	Alternatives  []string         `json:"alternatives,omitempty"`        // other plausible datetimes when the date was ambiguous
+	Conflicts     []Conflict       `json:"conflicts,omitempty"`           // events: stored events overlapping this one
+	Duplicate     *DuplicateRef    `json:"possibleDuplicateOf,omitempty"` // recent capture this one repeats; this one was not saved
+	ICSBase64     string           `json:"icsBase64,omitempty"`           // base64 .ics for event responses (ICS_DELIVERY=inline)
+	ICSURL        string           `json:"icsUrl,omitempty"`              // presigned .ics URL for event responses (ICS_DELIVERY=s3)
+	Email         *EmailDraft      `json:"email,omitempty"`               // email mode draft (and send result)
+	Journal       *JournalEntry    `json:"journal,omitempty"`             // journal mode mood and energy
+	Shopping      *ShoppingCapture `json:"shopping,omitempty"`            // shopping mode items, merged into the caller's list
+	Contact       *Contact         `json:"contact,omitempty"`             // contact mode fields and vCard
+	Answer        *Answer          `json:"answer,omitempty"`              // question mode one-screen answer
+	Digest        *Digest          `json:"digest,omitempty"`              // summarize mode bullets and action items
+	Translation   *Translation     `json:"translation,omitempty"`         // translate mode result
+	Timer         *Timer           `json:"timer,omitempty"`               // timer mode duration
+
+	ThinkingTokens *int `json:"thinkingTokens,omitempty"` // budget thinkingPolicy auto picked
+
+	ID         string           `json:"id,omitempty"`
+	Deliveries []DeliveryResult `json:"deliveries,omitempty"`
+	Callback   *DeliveryResult  `json:"callback,omitempty"`   // callbackUrl delivery result
+	Warnings   []string         `json:"warnings,omitempty"`   // request adjustments, e.g. truncated text
+	Summary    string           `json:"summary,omitempty"`    // watch-sized summary (v2, research workflow)
+	Transcript string           `json:"transcript,omitempty"` // what was heard, for audio requests
+	AudioURL   string           `json:"audioUrl,omitempty"`   // presigned MP3 of the spoken confirmation (speak:true)
+	Debug      *DebugInfo       `json:"debug,omitempty"`      // diagnostics for debug:true requests (admin only)
+
+	PromptVariant string `json:"promptVariant,omitempty"` // prompt experiment arm that produced the response (PROMPT_VARIANTS)
+
+	ConversationID string `json:"conversationId,omitempty"` // echoed from the request when conversation memory is on
+
+	Cached bool `json:"cached,omitempty"` // answered from the response cache without calling the model
+
+	usage      Usage     // Bedrock token usage, recorded against quotas but not returned
+	model      string    // Bedrock model that answered, for spend tracking and debug
+	parsePath  string    // how the model's reply was read: structured (JSON) or fallback (raw text)
+	incomplete bool      // structured reply missing title, markdown or shortText
+	cachedAt   time.Time // when a cached reply was stored; zero for fresh model replies
 }
 
 // Bedrock response structures
 type BedrockResponse struct {
-	Content []Content `json:"content"`
-	Usage   Usage     `json:"usage"`
+	Content    []Content `json:"content"`
+	Usage      Usage     `json:"usage"`
+	StopReason string    `json:"stop_reason"` // end_turn, max_tokens, stop_sequence
 }
 
 type Content struct {
@@ -57,14 +164,33 @@ type Usage struct {
 	OutputTokens int `json:"output_tokens"`
 }
 
+// Back-off hints for Bedrock throttling (short bursts), service quota errors (per-minute
+// quotas) and requests shed by the concurrency gate (slots free up as calls finish)
+const (
+	bedrockThrottleRetryAfter    = 5 * time.Second
+	bedrockQuotaRetryAfter       = 60 * time.Second
+	bedrockConcurrencyRetryAfter = 2 * time.Second
+)
+
+// defaultMaxContinuations is how many extra calls may finish a reply cut off at maxTokens
+const defaultMaxContinuations = 2
+
+// bedrockAPI is the subset of the Bedrock runtime client used by the handler
+type bedrockAPI interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+}
+
 // Global AWS clients
 var (
-	bedrockClient *bedrockruntime.Client
+	bedrockClient bedrockAPI
 	modelID       string
 	region        string
 )
 
 func init() {
+	// SECURITY: Scrub anything that looks like a credential from every log line
+	log.SetOutput(&redactingWriter{out: os.Stderr})
+
 	// Load environment variables
 	region = getEnv("BEDROCK_REGION", "us-west-2")
 	modelID = getEnv("BEDROCK_MODEL_ID", "anthropic.claude-haiku-4-5-20251001-v1:0")
@@ -75,7 +201,35 @@ func init() {
 		log.Fatalf("Failed to initialize AWS config: %v", err)
 	}
 
-	bedrockClient = bedrockruntime.NewFromConfig(cfg)
+	bedrockRuntime := bedrockruntime.NewFromConfig(cfg)
+	bedrockClient = bedrockRuntime
+	bedrockStreamClient = bedrockStreamer{client: bedrockRuntime}
+	tokenCounter = bedrockRuntime
+	guardrailClient = bedrockRuntime
+	ssmClient = ssm.NewFromConfig(cfg)
+	if useParamsExtension() {
+		ssmClient = newExtensionSSM(ssmClient)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	s3Client = s3.NewFromConfig(cfg)
+	s3Presigner = s3.NewPresignClient(s3.NewFromConfig(cfg))
+	secretsClient = secretsmanager.NewFromConfig(cfg)
+	sesClient = sesv2.NewFromConfig(cfg)
+	jobQueueClient := sqs.NewFromConfig(cfg)
+	sqsClient = jobQueueClient
+	deadLetterClient = jobQueueClient
+	sfnClient = sfn.NewFromConfig(cfg)
+	knowledgeBaseClient = bedrockagentruntime.NewFromConfig(cfg)
+	transcribeClient = transcribe.NewFromConfig(cfg)
+	pollyClient = polly.NewFromConfig(cfg)
+	awsCredentials = cfg.Credentials
+
+	historyTableName = os.Getenv("HISTORY_TABLE_NAME")
+	tokenTableName = os.Getenv("TOKEN_TABLE_NAME")
+	jobQueueURL = os.Getenv("JOB_QUEUE_URL")
+	jobDLQURL = os.Getenv("JOB_DLQ_URL")
+	researchStateMachineArn = os.Getenv("RESEARCH_STATE_MACHINE_ARN")
+	researchKnowledgeBaseID = os.Getenv("RESEARCH_KNOWLEDGE_BASE_ID")
 
 	log.Printf("Initialized Wrist Agent Lambda - Region: %s, Model: %s", region, modelID)
 }
@@ -94,88 +248,382 @@ func initializeAWSConfig() (aws.Config, error) {
 }
 
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := decodeRequestBody(&event); err != nil {
+		log.Printf("Failed to decode base64 request body: %v", err)
+		resp := errorResponse(apierror.WithRequestID(ctx, event.RequestContext.RequestID), apierror.InvalidRequest("Invalid request body encoding"))
+		loadCORSConfig().apply(event, &resp)
+		return resp, nil
+	}
+
+	// Forced failures for client resilience testing (X-Wrist-Fault)
+	fault, resp, handled := handleFault(ctx, event)
+	var err error
+	if !handled {
+		resp, err = handleRequest(ctx, event)
+	}
+	signResponse(ctx, &resp)
+	if fault == faultTruncated {
+		truncateBody(&resp)
+	}
+	loadCORSConfig().apply(event, &resp)
+	compressResponse(event, &resp)
+	return resp, err
+}
+
+func handleRequest(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	log.Printf("Processing request: %s %s", event.HTTPMethod, event.Path)
+	ctx = apierror.WithRequestID(ctx, event.RequestContext.RequestID)
 
+	version, _ := apiRoute(event)
+	if version == 0 {
+		return errorResponse(ctx, apierror.NotFound("Unsupported API version")), nil
+	}
+	if apiErr := checkReplay(ctx, event, time.Now()); apiErr != nil {
+		return errorResponse(ctx, apiErr), nil
+	}
+	if isAdminRequest(event) {
+		return handleAdmin(ctx, event), nil
+	}
+	if isTelegramRequest(event) {
+		return handleTelegram(ctx, event), nil
+	}
+	if isModesRequest(event) {
+		return handleModes(ctx, event), nil
+	}
+	if isOpenAPIRequest(event) {
+		return handleOpenAPI(ctx, event), nil
+	}
+	if isJobsRequest(event) {
+		return handleJobs(ctx, event), nil
+	}
+	if isUploadsRequest(event) {
+		return handleUploads(ctx, event), nil
+	}
+	if isVocabularyRequest(event) {
+		return handleVocabulary(ctx, event), nil
+	}
+	if isPreferencesRequest(event) {
+		return handlePreferences(ctx, event), nil
+	}
+	if isJournalRequest(event) {
+		return handleJournal(ctx, event), nil
+	}
+	if isShoppingRequest(event) {
+		return handleShopping(ctx, event), nil
+	}
+	if isRemindersRequest(event) {
+		return handleReminders(ctx, event), nil
+	}
+	if isNotesRequest(event) {
+		return handleNotes(ctx, event), nil
+	}
+	if isExportRequest(event) {
+		return handleExport(ctx, event), nil
+	}
+	if isImportRequest(event) {
+		return handleImport(ctx, event), nil
+	}
+	if isDigestRequest(event) {
+		return handleDigest(ctx, event), nil
+	}
+	if isSearchRequest(event) {
+		return handleSearch(ctx, event), nil
+	}
+	if isSelfTestRequest(event) {
+		return handleSelfTest(ctx, event), nil
+	}
+	if isTokenCountRequest(event) {
+		return handleTokenCount(ctx, event), nil
+	}
+
+	return handleInvoke(ctx, event, version), nil
+}
+
+// handleInvoke serves the invoke routes: it validates a request, then processes it,
+// queues it (async:true) or saves it for later while Bedrock is down. WebSocket
+// messages are handled here too, with the connection's authorizer context.
+func handleInvoke(ctx context.Context, event events.APIGatewayProxyRequest, version int) events.APIGatewayProxyResponse {
 	// Only allow POST requests (OPTIONS handled by API Gateway CORS)
 	if event.HTTPMethod != "POST" {
-		return apiResponse(405, map[string]string{"error": "Method not allowed"}), nil
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+
+	// Reject oversize bodies before parsing them
+	if err := loadSizeLimits().checkBodySize(event.Body); err != nil {
+		log.Printf("Request rejected: %v", err)
+		return errorResponse(ctx, apierror.PayloadTooLarge(err.Error()))
 	}
 
 	// Parse request body
 	var req Req
-	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
-		log.Printf("Failed to parse request body: %v", err)
-		return apiResponse(400, map[string]string{"error": "Invalid JSON payload"}), nil
+	if apiErr := decodeRequest(event.Body, strictFieldsEnabled(version), &req); apiErr != nil {
+		log.Printf("Failed to parse request body: %v", apiErr)
+		return errorResponse(ctx, apiErr)
 	}
 
-	// Validate request
+	// Validate request (including token scopes), after the device's profile and the
+	// caller's default mode are applied
+	if req.Format == "" {
+		req.Format = event.QueryStringParameters["format"]
+	}
+	if req.Format == "" {
+		req.Format = negotiateFormat(requestHeader(event, "Accept"))
+	}
+	applyDeviceProfile(&req, deviceProfileFromEvent(event))
+	requestPreferences(ctx, &req, principalFromEvent(event))
+	req.scopes = scopesFromEvent(event)
+	req.admin = callerIsAdmin(event)
 	if err := validateRequest(&req); err != nil {
 		log.Printf("Request validation failed: %v", err)
-		return apiResponse(400, map[string]string{"error": err.Error()}), nil
+		if errors.Is(err, errScopeDenied) {
+			return formattedError(ctx, &req, apierror.Forbidden(err.Error()))
+		}
+		if errors.Is(err, errPayloadTooLarge) {
+			return formattedError(ctx, &req, apierror.PayloadTooLarge(err.Error()))
+		}
+		return formattedError(ctx, &req, apierror.InvalidRequest(err.Error()))
 	}
 
 	// Authentication is handled by API Gateway Lambda Authorizer
 	// No need to validate token here
 
-	// Call Bedrock
-	response, err := callBedrock(ctx, &req)
-	if err != nil {
-		log.Printf("Bedrock call failed: %v", err)
-		
-		// Check for specific error types to provide better user feedback
-		var throttlingErr *types.ThrottlingException
-		var validationErr *types.ValidationException
-		var modelTimeoutErr *types.ModelTimeoutException
-		var internalServerErr *types.InternalServerException
-		var quotaErr *types.ServiceQuotaExceededException
-		
-		if errors.As(err, &throttlingErr) {
-			return apiResponse(429, map[string]string{
-				"error": "Service temporarily unavailable due to high demand. Please try again in a moment.",
-			}), nil
-		}
-		if errors.As(err, &validationErr) {
-			return apiResponse(400, map[string]string{
-				"error": "Invalid request format. Please check your input and try again.",
-			}), nil
-		}
-		if errors.As(err, &modelTimeoutErr) {
-			return apiResponse(504, map[string]string{
-				"error": "Request processing timed out. Please try again with a shorter request.",
-			}), nil
+	// Enforce per-principal usage quotas before spending Bedrock tokens
+	principal := principalFromEvent(event)
+	now := time.Now().UTC()
+	if err := reserveQuota(ctx, principal, now); err != nil {
+		var exceeded *QuotaExceeded
+		if errors.As(err, &exceeded) {
+			log.Printf("Quota exceeded for principal %s: %v", principal, err)
+			return formattedError(ctx, &req, apierror.Newf(429, apierror.CodeQuotaExceeded,
+				"%s usage quota exceeded", cases.Title(language.English).String(exceeded.Window)).
+				WithReason("usage_quota_"+exceeded.Window).
+				WithDetail("window", exceeded.Window).
+				WithDetail("resetAt", exceeded.ResetAt.Format(time.RFC3339)).
+				WithRetryAfter(time.Until(exceeded.ResetAt)))
 		}
-		if errors.As(err, &quotaErr) {
-			return apiResponse(429, map[string]string{
-				"error": "Service quota exceeded. Please try again later.",
-			}), nil
+	}
+
+	// Hand off to the job queue; the worker runs processRequest later
+	if req.Async {
+		return enqueueJob(ctx, &req, principal, version, now)
+	}
+
+	id := newCaptureID()
+	response, apiErr := processRequest(ctx, &req, id, principal, now)
+	if apiErr != nil {
+		// While Bedrock is down, save the capture for later rather than losing it
+		if canQueueWhenDown(&req, apiErr) {
+			return queuePendingCapture(ctx, &req, apiErr, id, principal, version, now)
 		}
-		if errors.As(err, &internalServerErr) {
-			return apiResponse(503, map[string]string{
-				"error": "Service temporarily unavailable. Please try again shortly.",
-			}), nil
+		return formattedError(ctx, &req, apiErr)
+	}
+	return formattedResponse(&req, version, response)
+}
+
+// processRequest runs a validated request through Bedrock, sinks and the callback. It is
+// shared by synchronous requests and the async job worker, which passes the job ID as
+// the capture ID.
+func processRequest(ctx context.Context, req *Req, id, principal string, now time.Time) (*Response, *apierror.Error) {
+	var trace *debugTrace
+	if req.Debug {
+		ctx, trace = withDebugTrace(ctx, time.Now())
+	}
+
+	// Over a monthly spend budget, degrade to the fallback model or refuse
+	if apiErr := applySpendBudget(ctx, req, principal, now); apiErr != nil {
+		return nil, apiErr
+	}
+
+	if err := transcribeAudio(ctx, req, id, principal); err != nil {
+		log.Printf("Transcription failed: %v", err)
+		return nil, transcribeError(err)
+	}
+	if err := loadImage(ctx, req, principal); err != nil {
+		log.Printf("Image load failed: %v", err)
+		if errors.Is(err, errPayloadTooLarge) {
+			return nil, apierror.PayloadTooLarge(err.Error())
 		}
-		
-		// Generic error for other cases
-		return apiResponse(500, map[string]string{"error": "Failed to process request"}), nil
+		return nil, apierror.InvalidRequest(err.Error())
 	}
+	req.tenant, _ = splitPrincipal(principal)
+	req.language = detectLanguage(req.Text)
+	req.vocabulary = requestVocabulary(ctx, principal)
+	req.preferredTags = requestTags(ctx, principal)
+	req.conversation = requestConversation(ctx, req, principal)
+	prepared := time.Now()
+
+	// Call Bedrock
+	reportProgress(ctx, stageGenerating)
+	response, err := callBedrock(ctx, req)
+	if err != nil {
+		log.Printf("Bedrock call failed: %v", err)
+
+		return nil, bedrockError(err)
+	}
+
+	recordTokenUsage(ctx, principal, now, response.model, response.usage)
+	revalidateCachedReply(ctx, req, principal, response)
+	if !req.dryRun && !response.Cached {
+		recordPromptVariant(ctx, req.Mode, response)
+	}
+	delivered := time.Now()
+	reportProgress(ctx, stageDelivering)
+	deliverResponse(ctx, req, id, principal, now, response)
+	if trace != nil {
+		response.Debug = trace.info(response, prepared, delivered, time.Now())
+	}
+	rememberTurn(ctx, req, principal, now, response)
 
 	log.Printf("Successfully processed request for mode: %s", req.Mode)
-	return apiResponse(200, response), nil
+	return response, nil
+}
+
+// deliverResponse finishes a processed request: it attaches the capture ID, warnings,
+// mode extras and configured post-processing, then fans out to sinks and the callback
+func deliverResponse(ctx context.Context, req *Req, id, principal string, now time.Time, response *Response) {
+	// Fan out to configured sinks (history table, S3, webhook, Notion)
+	meta := captureMeta{
+		ID:        id,
+		Principal: principal,
+		Mode:      req.Mode,
+		CreatedAt: now,
+		Deliver:   req.Deliver,
+		Sinks:     req.sinks,
+		Timezone:  requestLocation(req).String(),
+	}
+	response.ID = meta.ID
+	response.Warnings = req.warnings
+	response.Transcript = req.transcript
+	response.Language = req.language
+	if req.ThinkingPolicy == thinkingPolicyAuto {
+		thinkingTokens := req.ThinkingTokens
+		response.ThinkingTokens = &thinkingTokens
+	}
+	response.ConversationID = req.ConversationID
+	response.Tags = normalizeTags(preferTags(response.Tags, req.preferredTags), tagAliases(req.preferences))
+	finalizeAction(req.Mode, response)
+	resolveDates(req, now, response)
+	filterOutput(ctx, req.preferences, response)
+	if req.Mode == "translate" {
+		finalizeTranslation(req, response)
+	}
+	if req.Mode == "question" {
+		finalizeAnswer(response)
+	}
+	finalizeTitle(response, req.Mode)
+	generateTitle(ctx, req, principal, now, response)
+	finalizeShortText(response)
+	normalizePriority(response, req.Text)
+	normalizeUrgency(response, req.Text)
+	normalizeSentiment(response)
+	finalizeDateAmbiguity(response)
+	if response.Action == "event" {
+		attachICS(ctx, meta, response)
+		attachConflicts(ctx, meta, response)
+	}
+	if req.Mode == "email" {
+		finalizeEmail(ctx, req, response)
+	}
+	if req.Mode == "journal" {
+		finalizeJournal(ctx, meta, response)
+	}
+	if req.Mode == "shopping" {
+		finalizeShopping(ctx, meta, response)
+	}
+	if req.Mode == "contact" {
+		finalizeContact(response)
+	}
+	if req.Mode == "summarize" {
+		finalizeDigest(response)
+	}
+	if req.Mode == "timer" {
+		finalizeTimer(req, response)
+	}
+	finalizeHints(req.Mode, response)
+	postProcess(ctx, meta, response)
+	if req.Speak {
+		attachSpeech(ctx, meta, response)
+	}
+	if !req.dryRun && !checkDuplicate(ctx, req, meta, response) {
+		response.Deliveries = deliverToSinks(withCaptureMeta(ctx, meta), req.Mode, *response)
+	}
+
+	// The callback receives the final response (without its own delivery result)
+	if req.CallbackURL != "" {
+		result := deliverCallback(ctx, req.CallbackURL, *response)
+		response.Callback = &result
+	}
+}
+
+// bedrockError maps a Bedrock failure to user-facing feedback. Throttling and
+// availability errors carry a reason and Retry-After so the watch can back off.
+func bedrockError(err error) *apierror.Error {
+	var circuitErr *CircuitOpenError
+	var concurrencyErr *ConcurrencyLimitError
+	var budgetErr *BudgetError
+	var throttlingErr *types.ThrottlingException
+	var validationErr *types.ValidationException
+	var modelTimeoutErr *types.ModelTimeoutException
+	var internalServerErr *types.InternalServerException
+	var quotaErr *types.ServiceQuotaExceededException
+
+	switch {
+	case errors.As(err, &circuitErr):
+		return apierror.New(503, apierror.CodeServiceUnavailable, "The assistant is temporarily unavailable. Please try again shortly.").
+			WithReason("bedrock_circuit_open").
+			WithRetryAfter(circuitErr.RetryAfter)
+	case errors.As(err, &budgetErr):
+		apiErr := apierror.PayloadTooLarge(budgetErr.Error()).
+			WithReason(budgetErr.Reason).
+			WithDetail("estimatedInputTokens", budgetErr.EstimatedInputTokens).
+			WithDetail("maxTokens", budgetErr.MaxTokens)
+		if budgetErr.Reason == "cost_ceiling" {
+			return apiErr.WithDetail("estimatedCostUsd", budgetErr.EstimatedCostUSD).WithDetail("ceilingUsd", budgetErr.CeilingUSD)
+		}
+		return apiErr.WithDetail("contextTokens", budgetErr.ContextTokens)
+	case errors.As(err, &concurrencyErr):
+		return apierror.New(429, apierror.CodeThrottled, "Too many requests are in progress. Please try again in a moment.").
+			WithReason("bedrock_concurrency").
+			WithRetryAfter(bedrockConcurrencyRetryAfter)
+	case errors.As(err, &throttlingErr):
+		return apierror.New(429, apierror.CodeThrottled, "Service temporarily unavailable due to high demand. Please try again in a moment.").
+			WithReason("bedrock_throttled").
+			WithRetryAfter(bedrockThrottleRetryAfter)
+	case errors.As(err, &validationErr):
+		return apierror.InvalidRequest("Invalid request format. Please check your input and try again.")
+	case errors.As(err, &modelTimeoutErr):
+		return apierror.New(504, apierror.CodeUpstreamTimeout, "Request processing timed out. Please try again with a shorter request.")
+	case errors.As(err, &quotaErr):
+		return apierror.New(429, apierror.CodeThrottled, "Service quota exceeded. Please try again later.").
+			WithReason("bedrock_service_quota").
+			WithRetryAfter(bedrockQuotaRetryAfter)
+	case errors.As(err, &internalServerErr):
+		return apierror.New(503, apierror.CodeServiceUnavailable, "Service temporarily unavailable. Please try again shortly.").
+			WithReason("bedrock_unavailable").
+			WithRetryAfter(bedrockThrottleRetryAfter)
+	default:
+		// Generic error for other cases (including unparseable model output)
+		return apierror.Internal("Failed to process request")
+	}
 }
 
 func validateRequest(req *Req) error {
-	if strings.TrimSpace(req.Text) == "" {
+	if err := validateAudio(req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Text) == "" && req.AudioKey == "" && req.audio == nil {
 		return fmt.Errorf("text field is required")
 	}
-
-	validModes := map[string]bool{
-		"note": true, "reminder": true, "event": true, "research": true, "deepthink": true,
+	if err := loadSizeLimits().limitText(req); err != nil {
+		return err
 	}
+
 	if req.Mode == "" {
-		req.Mode = "note" // Default mode
+		req.Mode = defaultMode
 	}
-	if !validModes[req.Mode] {
-		return fmt.Errorf("invalid mode: %s (valid: note, reminder, event, research, deepthink)", req.Mode)
+	mode, ok := lookupMode(req.Mode)
+	if !ok {
+		return fmt.Errorf("invalid mode: %s (valid: %s)", req.Mode, strings.Join(modeNames(), ", "))
 	}
 
 	if req.ThinkingTokens < 0 || req.ThinkingTokens > 65536 {
@@ -183,90 +631,305 @@ func validateRequest(req *Req) error {
 	}
 
 	if req.MaxTokens <= 0 {
-		req.MaxTokens = 800 // Default
+		req.MaxTokens = mode.DefaultMaxTokens
 	}
 	if req.MaxTokens > 4096 {
 		return fmt.Errorf("maxTokens cannot exceed 4096")
 	}
 
-	return nil
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			return err
+		}
+	}
+
+	if err := validateImage(req); err != nil {
+		return err
+	}
+
+	if err := validateTranslation(req); err != nil {
+		return err
+	}
+
+	if err := validateTimezone(req); err != nil {
+		return err
+	}
+
+	if err := validateConversationID(req); err != nil {
+		return err
+	}
+
+	if err := validateTitleHint(req); err != nil {
+		return err
+	}
+
+	if err := validateDebug(req); err != nil {
+		return err
+	}
+
+	if err := clampCostClass(req); err != nil {
+		return err
+	}
+	if err := validateFormat(req); err != nil {
+		return err
+	}
+	clampSampling(req)
+	adaptToModel(req)
+	if err := resolveThinkingPolicy(req, mode); err != nil {
+		return err
+	}
+
+	return req.scopes.authorize(req)
 }
 
 func callBedrock(ctx context.Context, req *Req) (*Response, error) {
-	// Build system prompt based on mode
-	systemPrompt := buildSystemPrompt(req.Mode)
+	ctx = withModel(ctx, requestModel(req))
+
+	// Build system prompt based on mode, with the request's language, the caller's profile, vocabulary for misheard terms and established tags
+	systemPrompt := buildSystemPrompt(req.Mode) + languagePrompt(req) + translationPrompt(req) + titleHintPrompt(req) + preferencesPrompt(req.preferences, time.Now()) + vocabularyPrompt(req.vocabulary) + tagPrompt(req.preferredTags) + conversationPrompt(req.conversation) + dateContextPrompt(time.Now().In(requestLocation(req)))
+
+	// Prompt experiments: a weighted pick among the mode's variants adds its instructions
+	if !req.revalidate {
+		req.variant = pickPromptVariant(loadPromptVariants()[req.Mode], randomRoll)
+	}
+	variant := req.variant
+	systemPrompt += promptVariantPrompt(variant)
+
+	// Identical queries in cacheable modes (e.g. research) are answered from the cache
+	var cacheKey string
+	if cacheable(req) {
+		cacheKey = responseCacheKey(req, variant)
+		if response := cachedResponse(ctx, req, cacheKey); response != nil {
+			if variant != nil {
+				response.PromptVariant = variant.Name
+			}
+			response.model = requestModel(req)
+			return response, nil
+		}
+	}
+
+	// Long texts in summarize mode are condensed chunk by chunk first (map-reduce)
+	text := req.Text
+	var condenseUsage Usage
+	if req.Mode == "summarize" {
+		var err error
+		text, condenseUsage, err = condenseForSummary(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Build user message
-	userMessage := fmt.Sprintf("Process this request: %s", req.Text)
+	userMessage := fmt.Sprintf("Process this request: %s", text)
+
+	// Images go before the text so the question refers to them
+	content := []map[string]interface{}{}
+	if req.image != nil {
+		content = append(content, imageContent(req.image))
+	}
+	content = append(content, map[string]interface{}{"type": "text", "text": userMessage})
 
+	// Reject or trim requests that can't fit the context window or cost ceiling
+	if err := preflightBudget(req, systemPrompt, userMessage); err != nil {
+		return nil, err
+	}
+
+	claudeText, usage, err := invokeModelContent(streamingReply(withSampling(ctx, req.sampling())), systemPrompt, content, req.MaxTokens, req.ThinkingTokens)
+	if err != nil {
+		return nil, err
+	}
+	usage.InputTokens += condenseUsage.InputTokens
+	usage.OutputTokens += condenseUsage.OutputTokens
+	debugTraceFrom(ctx).recordRawText(claudeText)
+	response := parseModelResponse(claudeText, req.Mode, usage)
+	response.model = requestModel(req)
+	if cacheKey != "" {
+		cacheReply(ctx, req, cacheKey, claudeText, response)
+	}
+	if variant != nil {
+		response.PromptVariant = variant.Name
+	}
+	return response, nil
+}
+
+// invokeModel sends one system prompt and user message to Bedrock through the circuit
+// breaker and returns the text of the reply
+func invokeModel(ctx context.Context, systemPrompt, userMessage string, maxTokens, thinkingTokens int) (string, Usage, error) {
+	content := []map[string]interface{}{{"type": "text", "text": userMessage}}
+	return invokeModelContent(ctx, systemPrompt, content, maxTokens, thinkingTokens)
+}
+
+// invokeModelContent is invokeModel for a user message made of several content blocks
+// (e.g. an image followed by text). A reply cut off at maxTokens is continued, up to
+// BEDROCK_MAX_CONTINUATIONS more calls, by sending the text so far back as the start of
+// the assistant's turn; the parts are stitched together and their usage summed.
+func invokeModelContent(ctx context.Context, systemPrompt string, content []map[string]interface{}, maxTokens, thinkingTokens int) (string, Usage, error) {
 	// Prepare Bedrock request
 	messages := []map[string]interface{}{
 		{
-			"role": "user",
-			"content": []map[string]string{
-				{"type": "text", "text": userMessage},
-			},
+			"role":    "user",
+			"content": content,
 		},
 	}
 
-	requestBody := map[string]interface{}{
-		"anthropic_version": "bedrock-2023-05-31",
-		"system":            systemPrompt,
-		"messages":          messages,
-		"max_tokens":        req.MaxTokens,
-		"temperature":       0.1,
+	bedrockResp, err := invokeModelMessages(ctx, systemPrompt, messages, maxTokens, thinkingTokens)
+	if err != nil {
+		return "", Usage{}, err
 	}
+	text, usage := bedrockResp.Content[0].Text, bedrockResp.Usage
 
-	// Add thinking tokens if specified
-	if req.ThinkingTokens > 0 {
-		requestBody["thinking"] = map[string]interface{}{
-			"max_thinking_tokens": req.ThinkingTokens,
+	// Extended thinking doesn't allow prefilling the assistant's turn, so those replies
+	// can't be continued
+	continuations := limitEnv("BEDROCK_MAX_CONTINUATIONS", defaultMaxContinuations, 0)
+	for i := 0; bedrockResp.StopReason == "max_tokens" && thinkingTokens == 0; i++ {
+		if i == continuations {
+			log.Printf("Reply still cut off at maxTokens after %d continuation(s)", continuations)
+			break
+		}
+		// The assistant's turn can't end in whitespace; the continuation supplies it again
+		text = strings.TrimRightFunc(text, unicode.IsSpace)
+		prefilled := append(messages, map[string]interface{}{"role": "assistant", "content": text})
+		bedrockResp, err = invokeModelMessages(ctx, systemPrompt, prefilled, maxTokens, thinkingTokens)
+		if err != nil {
+			// Keep the part already written rather than failing the whole request
+			log.Printf("Continuation %d failed, returning the reply so far: %v", i+1, err)
+			break
 		}
+		text += bedrockResp.Content[0].Text
+		usage.InputTokens += bedrockResp.Usage.InputTokens
+		usage.OutputTokens += bedrockResp.Usage.OutputTokens
 	}
+	return text, usage, nil
+}
 
-	// Marshal request
-	requestJSON, err := json.Marshal(requestBody)
+// invokeModelMessages makes one model call: to Bedrock, or to the Anthropic API when
+// Bedrock is down and the fallback is enabled
+func invokeModelMessages(ctx context.Context, systemPrompt string, messages []map[string]interface{}, maxTokens, thinkingTokens int) (*BedrockResponse, error) {
+	resp, err := invokeBedrockMessages(ctx, systemPrompt, messages, maxTokens, thinkingTokens)
+	if err == nil || !shouldFallBackToAnthropic(err) {
+		return resp, err
+	}
+	log.Printf("Bedrock unavailable, falling back to the Anthropic API: %v", err)
+	fallbackResp, fallbackErr := invokeAnthropicAPI(ctx, systemPrompt, messages, maxTokens, samplingFrom(ctx))
+	if fallbackErr != nil {
+		// Report the Bedrock failure, which decides the status and Retry-After
+		log.Printf("Anthropic API fallback failed: %v", fallbackErr)
+		return nil, err
+	}
+	return fallbackResp, nil
+}
+
+// invokeBedrockMessages makes one InvokeModel call through the circuit breaker and the
+// concurrency gate
+func invokeBedrockMessages(ctx context.Context, systemPrompt string, messages []map[string]interface{}, maxTokens, thinkingTokens int) (*BedrockResponse, error) {
+	// The model's family decides the request and reply formats
+	model := modelFrom(ctx)
+	provider := providerFor(model)
+	requestJSON, err := provider.BuildRequest(systemPrompt, messages, maxTokens, thinkingTokens, samplingFrom(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal Bedrock request: %w", err)
 	}
 
-	// Call Bedrock
-	result, err := bedrockClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String(modelID),
-		ContentType: aws.String("application/json"),
-		Body:        requestJSON,
-	})
+	// Fail fast while Bedrock is known to be down
+	if ok, wait := bedrockBreaker.allow(time.Now()); !ok {
+		return nil, &CircuitOpenError{RetryAfter: wait}
+	}
+
+	// Queue for a concurrency slot so bursts don't set off account-wide throttling
+	release, err := acquireBedrockSlot(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Call Bedrock, streaming Claude's reply when a WebSocket session is waiting for its text
+	callStart := time.Now()
+	var result *bedrockruntime.InvokeModelOutput
+	var bedrockResp *BedrockResponse
+	if stream := activeReplyStream(ctx); stream != nil && bedrockStreamClient != nil && provider.Name() == familyAnthropic {
+		bedrockResp, err = streamAnthropicReply(ctx, model, requestJSON, stream)
+	} else {
+		result, err = bedrockClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(model),
+			ContentType: aws.String("application/json"),
+			Body:        requestJSON,
+		})
+	}
+	latency := time.Since(callStart)
+	if err != nil && isBedrockOutage(err) {
+		bedrockBreaker.recordFailure(time.Now())
+	} else {
+		// Any answer from Bedrock (even a rejection) means it's reachable
+		bedrockBreaker.reset()
+	}
 	if err != nil {
+		debugTraceFrom(ctx).recordModelCall(latency, nil, Usage{}, err)
+		emitModelCallMetrics(model, latency, Usage{}, err)
 		return nil, fmt.Errorf("Bedrock InvokeModel failed: %w", err)
 	}
 
 	// Parse Bedrock response
-	var bedrockResp BedrockResponse
-	if err := json.Unmarshal(result.Body, &bedrockResp); err != nil {
-		return nil, fmt.Errorf("failed to parse Bedrock response: %w", err)
+	if result != nil {
+		bedrockResp, err = provider.ParseResponse(result.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s response: %w", provider.Name(), err)
+		}
 	}
 
+	debugTraceFrom(ctx).recordModelCall(latency, result, bedrockResp.Usage, nil)
+	emitModelCallMetrics(model, latency, bedrockResp.Usage, nil)
+
 	if len(bedrockResp.Content) == 0 {
 		return nil, fmt.Errorf("empty response from Bedrock")
 	}
 
-	// Extract and parse Claude's structured response
-	claudeText := bedrockResp.Content[0].Text
+	return bedrockResp, nil
+}
 
+// parseModelResponse turns Claude's reply into a Response, falling back to wrapping
+// the raw text when it isn't the structured JSON the system prompt asks for
+func parseModelResponse(claudeText, mode string, usage Usage) *Response {
 	// Try to parse as JSON first (structured response)
 	var structuredResp Response
-	if err := json.Unmarshal([]byte(claudeText), &structuredResp); err == nil {
-		return &structuredResp, nil
+	if err := json.Unmarshal([]byte(stripCodeFence(claudeText)), &structuredResp); err == nil {
+		clearServerFields(&structuredResp)
+		structuredResp.usage = usage
+		structuredResp.parsePath = "structured"
+		structuredResp.incomplete = isIncompleteResponse(&structuredResp)
+		return &structuredResp
 	}
 
 	// Fallback: create response from raw text
 	log.Printf("Claude returned unstructured response, creating fallback response")
 	return &Response{
-		Markdown: claudeText,
-		Action:   req.Mode,
-		Title:    extractTitle(claudeText, req.Mode),
-		Tags:     []string{req.Mode},
-	}, nil
+		Markdown:  claudeText,
+		Action:    mode,
+		Title:     extractTitle(claudeText, mode),
+		Tags:      []string{mode},
+		usage:     usage,
+		parsePath: "fallback",
+	}
+}
+
+// clearServerFields zeroes the fields only the server sets. A prompt-injected capture
+// (an inbound email, an import, pasted text) could otherwise hand the watch an audio
+// URL to play, a fake calendar attachment or a delivery that never happened.
+func clearServerFields(resp *Response) {
+	resp.Conflicts = nil
+	resp.Duplicate = nil
+	resp.ICSBase64, resp.ICSURL = "", ""
+	resp.ThinkingTokens = nil
+	resp.ID = ""
+	resp.Deliveries, resp.Callback = nil, nil
+	resp.Warnings = nil
+	resp.Summary = ""
+	resp.Transcript = ""
+	resp.AudioURL = ""
+	resp.Debug = nil
+	resp.PromptVariant = ""
+	resp.ConversationID = ""
+	resp.Language = ""
+	resp.Cached = false
 }
 
 func buildSystemPrompt(mode string) string {
@@ -276,28 +939,52 @@ func buildSystemPrompt(mode string) string {
   "markdown": "formatted content here",
   "action": "note|reminder|event|none",
   "title": "extracted or generated title",
-  "dueISO": "2025-01-15T09:00:00Z or null",
-  "startISO": "2025-01-15T09:00:00Z or null",
-  "endISO": "2025-01-15T10:00:00Z or null",
+  "dueISO": "date expression (see Dates) or null",
+  "startISO": "date expression or null",
+  "endISO": "date expression or null",
   "location": "event location or null",
   "url": "https://link.example or null",
   "notes": "event notes or null",
-  "tags": ["tag1", "tag2"]
+  "recurrence": "FREQ=WEEKLY;BYDAY=MO or null",
+  "tags": ["tag1", "tag2"],
+  "shortText": "one-glance plain text summary",
+  "emoji": "one emoji that fits the content",
+  "color": "red|orange|yellow|green|mint|teal|cyan|blue|indigo|purple|pink|brown|gray",
+  "sentiment": "positive|neutral|negative|mixed",
+  "urgency": "low|medium|high",
+  "dueConfidence": 0.9,
+  "alternatives": ["next friday 09:00"]
 }
 
+Dates:
+Never work out dates yourself; describe them and the server resolves them in the user's time zone. Write dueISO, startISO, endISO and alternatives as one of:
+- "today 17:30", "tomorrow 09:00" or "yesterday 20:00" (24-hour time)
+- "friday 14:00" for the coming Friday (never today), "next friday 14:00" for the Friday after that
+- "+2d 09:00", "+1w" or "+1mo" for days, weeks or months from today
+- "+2h", "+45m" or "+1h30m" for hours and minutes from now; in endISO they count from the start
+- "2025-03-14 09:00" for a date the user said outright
+- "17:30" for a time without a day (the next time it comes round)
+Leave the time out only when the user gave none.
+
 Guidelines:
 - Extract clear, actionable titles
 - For reminders, use dueISO. For events, use startISO/endISO (leave null if unknown)
 - Include event location, URL, and notes if mentioned
+- For recurring events ("every Monday"), set recurrence to an iCalendar RRULE value without the "RRULE:" prefix
 - Use markdown formatting for content
-- Keep responses concise but complete`
+- Keep responses concise but complete
+- shortText is shown on the watch face: plain text, no markdown, at most ` + strconv.Itoa(shortTextMaxWords()) + ` words (e.g. "Call mom tomorrow at 3pm")
+- emoji and color decorate the item on the watch: pick ones that fit the subject (e.g. "🦷" and "teal" for a dentist appointment)
+- sentiment is the speaker's tone; urgency is how soon the item needs attention ("ASAP" or "today" is high, "someday" is low)
+- dueConfidence is how sure you are of dueISO/startISO (0 to 1). When a date is ambiguous ("Friday" could be this week or next), pick the likeliest, set dueConfidence below 0.8 and list the other candidates in alternatives; otherwise use an empty array`
 
 	switch mode {
 	case "reminder":
 		return basePrompt + `
 
 Mode: REMINDER
-Focus on creating reminders with due dates. Look for time references and convert them to ISO format. Set action to "reminder".`
+Focus on creating reminders with due dates. Look for time references and write them as date expressions. Set action to "reminder".
+Add "priority" to the JSON: "high" for urgent phrasing ("urgent", "ASAP", "don't forget"), "low" for relaxed phrasing ("when I get a chance", "someday"), otherwise "medium".`
 
 	case "event":
 		return basePrompt + `
@@ -317,6 +1004,70 @@ Provide detailed, well-researched responses. Include sources and comprehensive i
 Mode: DEEP THINKING
 Take time to thoroughly analyze the request. Consider multiple perspectives and provide thoughtful insights. Set action to "note".`
 
+	case "email":
+		return basePrompt + `
+
+Mode: EMAIL
+Draft an email from the dictation. Extract recipients, subject, and body, and add an "email" object to the JSON:
+"email": {"to": ["name@example.com"], "subject": "subject line", "body": "plain text body"}
+Only include recipient addresses that were spoken or spelled out; never invent addresses. Write the body in a natural, polite tone with a greeting and sign-off. Set action to "email" and put the body in markdown as well.`
+
+	case "journal":
+		return basePrompt + `
+
+Mode: JOURNAL
+Turn the dictation into a journal entry written in the first person, keeping the speaker's own words where possible. Set action to "journal" and add a "journal" object to the JSON:
+"journal": {"mood": "happy|grateful|excited|calm|neutral|tired|stressed|anxious|sad|angry", "energy": "low|medium|high"}
+Pick the single mood that best matches the entry; use "neutral" when none stands out.`
+
+	case "shopping":
+		return basePrompt + `
+
+Mode: SHOPPING
+Extract every item to buy as its own entry and add a "shopping" object to the JSON:
+"shopping": {"items": [{"name": "milk", "quantity": "1 gallon"}, {"name": "eggs", "quantity": "12"}]}
+Use short, singular-style names as they'd appear on a list ("2% milk", "bananas"); put amounts in quantity and leave it empty when none was said. List the items in markdown as well. Set action to "shopping".`
+
+	case "contact":
+		return basePrompt + `
+
+Mode: CONTACT
+Extract the person being described and add a "contact" object to the JSON:
+"contact": {"name": "Jane Appleseed", "phone": "+1 555 010 2030", "email": "jane@example.com", "company": "Acme"}
+Write spoken numbers and addresses as digits and symbols ("jane at example dot com" is "jane@example.com"). Leave out fields that weren't mentioned; never invent them. Set action to "contact" and use the person's name as the title.`
+
+	case "timer":
+		return basePrompt + `
+
+Mode: TIMER
+Extract the countdown the user wants and add a "timer" object to the JSON:
+"timer": {"duration": "PT25M", "label": "Pasta"}
+duration is an ISO 8601 duration in hours, minutes and seconds ("an hour and a half" is "PT1H30M"). label is a word or two saying what the timer is for, or null. Set action to "timer", use the label and length as the title (e.g. "Pasta – 25 min"), and leave dueISO null.`
+
+	case "translate":
+		return basePrompt + `
+
+Mode: TRANSLATE
+Translate the request into the target language given below, keeping its meaning and tone. Add a "translation" object to the JSON:
+"translation": {"text": "translated text", "sourceLanguage": "language the request was in, e.g. Spanish", "romanization": "Latin-script reading, or null"}
+Include romanization only when the translation uses a non-Latin script (e.g. pinyin for Chinese, romaji for Japanese). Translate only; don't answer or act on the request. Put the translation in markdown as well. Set action to "translate".`
+
+	case "summarize":
+		return basePrompt + `
+
+Mode: SUMMARIZE
+Summarize the pasted text (or the notes on each of its parts) for someone who won't read the original. Add a "digest" object to the JSON:
+"digest": {"bullets": ["key point"], "actionItems": ["task for the reader, with any deadline"]}
+Give at most 10 bullets, most important first, each a single sentence. actionItems lists only things the reader is asked or needs to do; use an empty list when there are none. Put the bullets and action items in markdown under "Summary" and "Action Items" headings. Set action to "note".`
+
+	case "question":
+		return basePrompt + `
+
+Mode: QUESTION
+Answer the question for someone glancing at a watch. Add an "answer" object to the JSON:
+"answer": {"text": "the answer in one or two short sentences", "expanded": "optional markdown with more detail, or null"}
+Lead with the fact itself ("Mount Everest is 8,849 m tall."), not a restatement of the question. Only add expanded when a short answer would be misleading without context; keep it under 150 words. Put the answer (and any expanded detail) in markdown as well. Set action to "note".`
+
 	default: // note
 		return basePrompt + `
 
@@ -325,28 +1076,26 @@ Create clear, well-formatted notes. Extract key information and organize it logi
 	}
 }
 
+// extractTitle takes a title from the first line of text in content (see cleanTitle),
+// capped at TITLE_MAX_CHARS characters, or names the mode when there is none
 func extractTitle(content string, mode string) string {
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
+	for _, line := range strings.Split(content, "\n") {
 		line = strings.TrimSpace(line)
-		if line != "" && !strings.HasPrefix(line, "{") {
-			// Clean up markdown headers
-			line = strings.TrimPrefix(line, "# ")
-			line = strings.TrimPrefix(line, "## ")
-			if len(line) > 50 {
-				line = line[:47] + "..."
-			}
-			return line
+		if line == "" || strings.HasPrefix(line, "{") || strings.HasPrefix(line, "```") {
+			continue
+		}
+		title := cleanTitle(line)
+		if strings.IndexFunc(title, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue // rules and other lines with nothing to read
 		}
+		return truncateTitle(title, titleMaxChars())
 	}
-	// Use cases.Title instead of deprecated strings.Title (Go 1.18+)
-	caser := cases.Title(language.English)
-	return fmt.Sprintf("Wrist Agent %s", caser.String(mode))
+	return genericTitle(mode)
 }
 
 // apiResponse creates an API Gateway proxy response
-// Note: CORS headers are handled by API Gateway's defaultCorsPreflightOptions
-// so we don't need to add them here - only Content-Type is required
+// Note: Preflight is handled by API Gateway's defaultCorsPreflightOptions and CORS
+// headers for actual responses are added once in handler - only Content-Type is set here
 func apiResponse(statusCode int, body interface{}) events.APIGatewayProxyResponse {
 	var bodyStr string
 	if body != nil {
@@ -363,6 +1112,15 @@ func apiResponse(statusCode int, body interface{}) events.APIGatewayProxyRespons
 	}
 }
 
+// errorResponse creates an API Gateway proxy response carrying an error envelope
+func errorResponse(ctx context.Context, err *apierror.Error) events.APIGatewayProxyResponse {
+	resp := apiResponse(err.Status, err.Envelope(ctx))
+	if seconds := err.RetryAfterSeconds(); seconds > 0 {
+		resp.Headers["Retry-After"] = strconv.Itoa(seconds)
+	}
+	return resp
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -371,5 +1129,5 @@ func getEnv(key, defaultValue string) string {
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(invoke)
 }
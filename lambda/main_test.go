@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"wrist-agent/apierror"
 )
 
 func TestValidateRequest(t *testing.T) {
@@ -77,6 +85,14 @@ func TestValidateRequest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid email request",
+			req: Req{
+				Text: "Email Sam asking about lunch",
+				Mode: "email",
+			},
+			wantErr: false,
+		},
 		{
 			name: "negative thinking tokens",
 			req: Req{
@@ -167,6 +183,118 @@ func TestApiResponse_NilBody(t *testing.T) {
 	}
 }
 
+func TestErrorResponse(t *testing.T) {
+	ctx := apierror.WithRequestID(context.Background(), "req-1")
+	resp := errorResponse(ctx, apierror.InvalidRequest("text field is required"))
+
+	if resp.StatusCode != 400 {
+		t.Errorf("Expected status code 400, got %d", resp.StatusCode)
+	}
+
+	var body apierror.Envelope
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		t.Fatalf("Expected error envelope, got %s", resp.Body)
+	}
+	if body.Error.Code != apierror.CodeInvalidRequest || body.Error.Message != "text field is required" || body.Error.RequestID != "req-1" {
+		t.Errorf("Unexpected envelope: %+v", body.Error)
+	}
+}
+
+func TestBedrockError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantCode       apierror.Code
+		retryable      bool
+		wantReason     string
+		wantRetryAfter string
+	}{
+		{"throttling", &types.ThrottlingException{}, 429, apierror.CodeThrottled, true, "bedrock_throttled", "5"},
+		{"validation", &types.ValidationException{}, 400, apierror.CodeInvalidRequest, false, "", ""},
+		{"model timeout", &types.ModelTimeoutException{}, 504, apierror.CodeUpstreamTimeout, true, "", ""},
+		{"service quota", &types.ServiceQuotaExceededException{}, 429, apierror.CodeThrottled, true, "bedrock_service_quota", "60"},
+		{"internal server", &types.InternalServerException{}, 503, apierror.CodeServiceUnavailable, true, "bedrock_unavailable", "5"},
+		{"concurrency limit", &ConcurrencyLimitError{Limit: 4, Scope: "account"}, 429, apierror.CodeThrottled, true, "bedrock_concurrency", "2"},
+		{"circuit open", &CircuitOpenError{RetryAfter: 20 * time.Second}, 503, apierror.CodeServiceUnavailable, true, "bedrock_circuit_open", "20"},
+		{"parse failure", errors.New("failed to parse Bedrock response"), 500, apierror.CodeInternal, false, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bedrockError(fmt.Errorf("Bedrock InvokeModel failed: %w", tt.err))
+			if got.Status != tt.wantStatus || got.Code != tt.wantCode || got.Retryable != tt.retryable {
+				t.Errorf("bedrockError() = %d/%s/%v, want %d/%s/%v", got.Status, got.Code, got.Retryable, tt.wantStatus, tt.wantCode, tt.retryable)
+			}
+			if reason, _ := got.Details["reason"].(string); reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+
+			resp := errorResponse(context.Background(), got)
+			if retryAfter := resp.Headers["Retry-After"]; retryAfter != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+// scriptedBedrock answers InvokeModel calls in turn from replies, recording request bodies
+type scriptedBedrock struct {
+	replies  []BedrockResponse
+	requests []map[string]interface{}
+}
+
+func (f *scriptedBedrock) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	var request map[string]interface{}
+	json.Unmarshal(params.Body, &request)
+	f.requests = append(f.requests, request)
+	if len(f.requests) > len(f.replies) {
+		return nil, &types.ThrottlingException{}
+	}
+	body, err := json.Marshal(f.replies[len(f.requests)-1])
+	return &bedrockruntime.InvokeModelOutput{Body: body}, err
+}
+
+func TestInvokeModelContent_Continuation(t *testing.T) {
+	part := func(text, stop string) BedrockResponse {
+		return BedrockResponse{Content: []Content{{Type: "text", Text: text}}, Usage: Usage{InputTokens: 10, OutputTokens: 5}, StopReason: stop}
+	}
+	content := []map[string]interface{}{{"type": "text", "text": "Research tides"}}
+	ctx := context.Background()
+
+	model := &scriptedBedrock{replies: []BedrockResponse{part(`{"markdown":"Tides are `, "max_tokens"), part(` caused by the moon`, "max_tokens"), part(`."}`, "end_turn")}}
+	orig := bedrockClient
+	bedrockClient = model
+	t.Cleanup(func() { bedrockClient = orig })
+
+	text, usage, err := invokeModelContent(ctx, "system", content, 100, 0)
+	if err != nil || text != `{"markdown":"Tides are caused by the moon."}` || usage != (Usage{InputTokens: 30, OutputTokens: 15}) {
+		t.Fatalf("got %q, %+v, %v", text, usage, err)
+	}
+	// Each continuation prefills the assistant turn with the text so far, minus trailing whitespace
+	messages := model.requests[2]["messages"].([]interface{})
+	if len(messages) != 2 || messages[1].(map[string]interface{})["content"] != `{"markdown":"Tides are caused by the moon` {
+		t.Errorf("continuation messages = %v", messages)
+	}
+
+	// The budget caps the extra calls, and a failed continuation keeps the text so far
+	t.Setenv("BEDROCK_MAX_CONTINUATIONS", "1")
+	bedrockClient = &scriptedBedrock{replies: []BedrockResponse{part("one ", "max_tokens"), part(" two", "max_tokens"), part(" three", "end_turn")}}
+	if text, _, _ := invokeModelContent(ctx, "system", content, 100, 0); text != "one two" {
+		t.Errorf("budget of 1: text = %q", text)
+	}
+	bedrockClient = &scriptedBedrock{replies: []BedrockResponse{part("one", "max_tokens")}}
+	if text, _, err := invokeModelContent(ctx, "system", content, 100, 0); text != "one" || err != nil {
+		t.Errorf("failed continuation: text = %q, err = %v", text, err)
+	}
+
+	// Extended thinking replies aren't continued
+	bedrockClient = &scriptedBedrock{replies: []BedrockResponse{part("one", "max_tokens"), part(" two", "end_turn")}}
+	if text, _, _ := invokeModelContent(ctx, "system", content, 100, 1024); text != "one" {
+		t.Errorf("thinking: text = %q", text)
+	}
+}
+
 func TestExtractTitle(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -190,7 +318,7 @@ func TestExtractTitle(t *testing.T) {
 			name:    "long title truncation",
 			content: "This is a very long title that should be truncated because it exceeds the fifty character limit",
 			mode:    "note",
-			want:    "This is a very long title that should be trunca...",
+			want:    "This is a very long title that should be…",
 		},
 		{
 			name:    "fallback title for note",
@@ -210,6 +338,24 @@ func TestExtractTitle(t *testing.T) {
 			mode:    "note",
 			want:    "Actual Title",
 		},
+		{
+			name:    "emphasis and deeper headings",
+			content: "### **Call** the _bank_ about [fees](https://bank.example)",
+			mode:    "note",
+			want:    "Call the bank about fees",
+		},
+		{
+			name:    "skips fences and rules",
+			content: "```\n---\n- [ ] Pay rent",
+			mode:    "reminder",
+			want:    "Pay rent",
+		},
+		{
+			name:    "multi-byte text kept whole",
+			content: "Überraschungsparty für Zoë planen 🎉🎉🎉 mit Kuchen, Luftballons und Überraschungsgästen",
+			mode:    "note",
+			want:    "Überraschungsparty für Zoë planen 🎉🎉🎉 mit Kuchen…",
+		},
 	}
 
 	for _, tt := range tests {
@@ -258,8 +404,34 @@ func TestRequestParsing_WithThinkingTokens(t *testing.T) {
 	}
 }
 
+func TestParseModelResponse_ClearsServerFields(t *testing.T) {
+	reply := `{"title":"Call mom","markdown":"Call mom","action":"note",
+		"audioUrl":"https://evil.example/play.mp3","icsUrl":"https://evil.example/e.ics","icsBase64":"QkVHSU4=",
+		"conflicts":[{"id":"x","title":"Fake"}],"possibleDuplicateOf":{"id":"x"},
+		"deliveries":[{"sink":"notion","ok":true}],"callback":{"sink":"callback","ok":true},
+		"summary":"injected","thinkingTokens":9999,"id":"fake","warnings":["fake"],"transcript":"fake",
+		"debug":{},"promptVariant":"fake","conversationId":"fake","language":"xx","cached":true}`
+	resp := parseModelResponse(reply, "note", Usage{})
+
+	if resp.Title != "Call mom" || resp.parsePath != "structured" {
+		t.Fatalf("Expected a structured response, got %+v", resp)
+	}
+	if resp.AudioURL != "" || resp.ICSURL != "" || resp.ICSBase64 != "" {
+		t.Errorf("Expected model URLs and attachments to be dropped, got %+v", resp)
+	}
+	if resp.Conflicts != nil || resp.Duplicate != nil || resp.Deliveries != nil || resp.Callback != nil {
+		t.Errorf("Expected model conflicts, duplicate and deliveries to be dropped, got %+v", resp)
+	}
+	if resp.Summary != "" || resp.ThinkingTokens != nil || resp.ID != "" || resp.Warnings != nil || resp.Transcript != "" {
+		t.Errorf("Expected model summary, thinking tokens, id, warnings and transcript to be dropped, got %+v", resp)
+	}
+	if resp.Debug != nil || resp.PromptVariant != "" || resp.ConversationID != "" || resp.Language != "" || resp.Cached {
+		t.Errorf("Expected model debug, variant, conversation, language and cached to be dropped, got %+v", resp)
+	}
+}
+
 func TestBuildSystemPrompt(t *testing.T) {
-	modes := []string{"note", "reminder", "event", "research", "deepthink"}
+	modes := []string{"note", "reminder", "event", "research", "deepthink", "email", "shopping", "journal", "contact", "summarize", "translate", "question"}
 
 	for _, mode := range modes {
 		t.Run(mode, func(t *testing.T) {
@@ -274,6 +446,9 @@ func TestBuildSystemPrompt(t *testing.T) {
 			if !contains(prompt, "action") {
 				t.Errorf("buildSystemPrompt(%s) missing 'action' field", mode)
 			}
+			if !contains(prompt, "shortText") || !contains(prompt, "at most 30 words") {
+				t.Errorf("buildSystemPrompt(%s) missing the shortText word cap", mode)
+			}
 		})
 	}
 }
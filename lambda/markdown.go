@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// markdownStyle is the house style the markdown transformer enforces
+type markdownStyle struct {
+	Bullet      string // unordered list marker: -, * or +
+	HeadingBase int    // level of the top heading, 1-6; 0 keeps the document's own
+}
+
+var (
+	mdFence        = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+-]*)\\s*$")
+	mdHeading      = regexp.MustCompile(`^\s{0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	mdHeadingNoGap = regexp.MustCompile(`^\s{0,3}(#{2,6})([^#\s].*)$`) // one # is a hashtag
+	mdRule         = regexp.MustCompile(`^\s*[-*_](?:\s*[-*_]){2,}\s*$`)
+	mdBullet       = regexp.MustCompile(`^(\s*)(?:[-*+]\s+|•\s*)(.*)$`)
+	mdOrdered      = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	mdTask         = regexp.MustCompile(`^\[([ xX]?)\]\s*`)
+)
+
+// markdownTransformer fixes common model markdown slips and enforces the configured
+// style (see normalizeMarkdown)
+type markdownTransformer struct {
+	style markdownStyle
+}
+
+func newMarkdownTransformer(spec TransformerSpec) (Transformer, error) {
+	style := markdownStyle{Bullet: spec.Bullet, HeadingBase: spec.HeadingBase}
+	switch style.Bullet {
+	case "":
+		style.Bullet = "-"
+	case "-", "*", "+":
+	default:
+		return nil, fmt.Errorf("invalid bullet %q (valid: -, *, +)", spec.Bullet)
+	}
+	if style.HeadingBase < 0 || style.HeadingBase > 6 {
+		return nil, fmt.Errorf("headingBase must be between 1 and 6")
+	}
+	return markdownTransformer{style: style}, nil
+}
+
+func (markdownTransformer) Name() string { return "markdown" }
+
+func (t markdownTransformer) Transform(_ captureMeta, resp *Response) error {
+	resp.Markdown = normalizeMarkdown(resp.Markdown, t.style)
+	return nil
+}
+
+// mdListLevel is an open list level: the item indent the model used, and where the
+// item and its content start in the output
+type mdListLevel struct {
+	indent  int
+	out     int
+	content int
+	next    int // ordered lists: the number of the next item, 0 for bullets
+}
+
+// normalizeMarkdown tidies model markdown without changing what it says:
+//   - a reply wrapped in a ```markdown fence is unwrapped, and a fence left open is closed
+//     (or dropped when nothing follows it)
+//   - headings get their space after the #s (## and deeper; #word is a hashtag), lose
+//     closing #s, start at the style's level and never skip a level
+//   - bullets (including •) use the style's marker, ordered items are numbered 1., 2., ...,
+//     task boxes read [ ] or [x], and nested items are indented under their parent's text
+//   - lists are kept tight and set off from paragraphs and headings by a blank line
+//   - trailing spaces and runs of blank lines go
+//
+// Code inside fences is left exactly as written.
+func normalizeMarkdown(md string, style markdownStyle) string {
+	if style.Bullet == "" {
+		style.Bullet = "-"
+	}
+	lines := strings.Split(unwrapMarkdownFence(strings.ReplaceAll(md, "\r\n", "\n")), "\n")
+
+	shift, lastLevel := headingShift(lines, style.HeadingBase), 0
+	var out []string
+	var list []mdListLevel
+	var fence string // the open fence's marker, "" outside code
+	fenceStart := -1
+	blank := false // a blank line is pending output
+
+	emit := func(line string, isList bool) {
+		if len(out) > 0 {
+			prevList := mdBullet.MatchString(out[len(out)-1]) || mdOrdered.MatchString(out[len(out)-1])
+			switch {
+			case blank && isList && prevList:
+				// tighten the list
+			case blank:
+				out = append(out, "")
+			case isList && !prevList && len(list) == 1 && !strings.HasPrefix(out[len(out)-1], " "):
+				out = append(out, "") // a list needs a blank line after a paragraph
+			}
+		}
+		blank = false
+		out = append(out, line)
+	}
+
+	for _, line := range lines {
+		if fence != "" {
+			out = append(out, line)
+			if match := mdFence.FindStringSubmatch(line); match != nil && match[2] == "" &&
+				match[1][0] == fence[0] && len(match[1]) >= len(fence) {
+				fence = ""
+			}
+			continue
+		}
+		line = strings.TrimRight(line, " \t")
+		if match := mdFence.FindStringSubmatch(line); match != nil {
+			if !strings.HasPrefix(line, " ") {
+				list = nil // an indented fence is code inside a list item
+			}
+			emit(line, false)
+			fence, fenceStart = match[1], len(out)-1
+			continue
+		}
+		if line == "" {
+			blank = len(out) > 0
+			continue
+		}
+
+		if match := mdHeadingNoGap.FindStringSubmatch(line); match != nil {
+			line = match[1] + " " + match[2]
+		}
+		if match := mdHeading.FindStringSubmatch(line); match != nil && match[2] != "" {
+			level := len(match[1]) + shift
+			if lastLevel > 0 && level > lastLevel+1 {
+				level = lastLevel + 1
+			}
+			level = max(1, min(level, 6))
+			lastLevel = level
+			list = nil
+			blank = len(out) > 0
+			emit(strings.Repeat("#", level)+" "+strings.TrimSpace(match[2]), false)
+			blank = true
+			continue
+		}
+		if mdRule.MatchString(line) {
+			list = nil
+			emit(strings.TrimSpace(line), false)
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if match := mdOrdered.FindStringSubmatch(line); match != nil {
+			level := openListLevel(&list, indent)
+			if level.next == 0 {
+				level.next, _ = strconv.Atoi(match[2])
+			}
+			marker := strconv.Itoa(level.next) + ". "
+			level.next++
+			level.content = level.out + len(marker)
+			emit(strings.Repeat(" ", level.out)+marker+match[3], true)
+			continue
+		}
+		if match := mdBullet.FindStringSubmatch(line); match != nil && match[2] != "" && !mdRule.MatchString(line) {
+			level := openListLevel(&list, indent)
+			level.next = 0
+			text := match[2]
+			if task := mdTask.FindStringSubmatch(text); task != nil {
+				box := "[ ] "
+				if strings.TrimSpace(task[1]) != "" {
+					box = "[x] "
+				}
+				text = box + text[len(task[0]):]
+			}
+			level.content = level.out + len(style.Bullet) + 1
+			emit(strings.Repeat(" ", level.out)+style.Bullet+" "+text, true)
+			continue
+		}
+
+		if len(list) > 0 && (indent > 0 || !blank) {
+			// An item's continuation line, lined up with the innermost item it follows
+			for len(list) > 1 && indent < list[len(list)-1].indent {
+				list = list[:len(list)-1]
+			}
+			emit(strings.Repeat(" ", list[len(list)-1].content)+strings.TrimSpace(line), false)
+			continue
+		}
+		list = nil
+		emit(line, false)
+	}
+
+	if fence != "" {
+		if strings.TrimSpace(strings.Join(out[fenceStart+1:], "")) == "" {
+			out = out[:fenceStart] // a fence opened at the very end holds nothing
+		} else {
+			out = append(out, fence)
+		}
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// openListLevel returns the list level an item at indent belongs to, closing deeper
+// levels and opening a nested one under the current item when it is indented further
+func openListLevel(list *[]mdListLevel, indent int) *mdListLevel {
+	levels := *list
+	for len(levels) > 0 && indent < levels[len(levels)-1].indent {
+		levels = levels[:len(levels)-1]
+	}
+	switch {
+	case len(levels) == 0:
+		levels = append(levels, mdListLevel{indent: indent})
+	case indent > levels[len(levels)-1].indent:
+		parent := levels[len(levels)-1]
+		levels = append(levels, mdListLevel{indent: indent, out: parent.content})
+	}
+	*list = levels
+	return &levels[len(levels)-1]
+}
+
+// headingShift is how far headings move so the top one sits at base (0 keeps them)
+func headingShift(lines []string, base int) int {
+	if base == 0 {
+		return 0
+	}
+	top, inFence := 0, false
+	for _, line := range lines {
+		if mdFence.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if match := mdHeading.FindStringSubmatch(line); match != nil && match[2] != "" {
+			if top == 0 || len(match[1]) < top {
+				top = len(match[1])
+			}
+		}
+	}
+	if top == 0 {
+		return 0
+	}
+	return base - top
+}
+
+// unwrapMarkdownFence removes a ```markdown fence around a whole reply
+func unwrapMarkdownFence(md string) string {
+	trimmed := strings.TrimSpace(md)
+	first, rest, ok := strings.Cut(trimmed, "\n")
+	if !ok {
+		return md
+	}
+	match := mdFence.FindStringSubmatch(first)
+	if match == nil || !strings.EqualFold(match[2], "markdown") && !strings.EqualFold(match[2], "md") {
+		return md
+	}
+	body, last, _ := cutLast(rest, "\n")
+	if !mdFence.MatchString(last) || strings.TrimSpace(last) != match[1] || strings.Contains(body, match[1]) {
+		return md
+	}
+	return body
+}
+
+// cutLast splits s around the last sep, like strings.Cut from the end
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return "", s, false
+}
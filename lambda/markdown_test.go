@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		style markdownStyle
+		want  string
+	}{
+		{
+			name: "whitespace",
+			in:   "First line  \r\nsecond\t\r\n\r\n\r\n\r\nThird\n\n",
+			want: "First line\nsecond\n\nThird",
+		},
+		{
+			name: "wrapped in a markdown fence",
+			in:   "```markdown\n## Groceries\n- milk\n```",
+			want: "## Groceries\n\n- milk",
+		},
+		{
+			name: "code fence kept",
+			in:   "Run:\n```bash\n  echo hi   \n\n\n- not a list\n```\nDone",
+			want: "Run:\n```bash\n  echo hi   \n\n\n- not a list\n```\nDone",
+		},
+		{
+			name: "unclosed fence closed",
+			in:   "Query:\n```sql\nselect 1;",
+			want: "Query:\n```sql\nselect 1;\n```",
+		},
+		{
+			name: "empty trailing fence dropped",
+			in:   "All done.\n\n```\n\n",
+			want: "All done.",
+		},
+		{
+			name: "heading fixes",
+			in:   "##Plan ##\nIntro\n#### Step one\n##### Detail\n## Wrap-up",
+			want: "## Plan\n\nIntro\n\n### Step one\n\n#### Detail\n\n## Wrap-up",
+		},
+		{
+			name:  "heading base",
+			in:    "### Trip\n#### Packing",
+			style: markdownStyle{HeadingBase: 1},
+			want:  "# Trip\n\n## Packing",
+		},
+		{
+			name: "hashtags aren't headings",
+			in:   "Call Sam\n#work #calls",
+			want: "Call Sam\n#work #calls",
+		},
+		{
+			name: "bullets",
+			in:   "Packing:\n* socks\n+ shirts\n• charger\n\n- passport",
+			want: "Packing:\n\n- socks\n- shirts\n- charger\n- passport",
+		},
+		{
+			name:  "bullet style",
+			in:    "- one\n- two",
+			style: markdownStyle{Bullet: "*"},
+			want:  "* one\n* two",
+		},
+		{
+			name: "ordered items renumbered",
+			in:   "Steps:\n1) preheat\n1) mix\n\n5. bake",
+			want: "Steps:\n\n1. preheat\n2. mix\n3. bake",
+		},
+		{
+			name: "ordered list keeps its start",
+			in:   "3. third\n4. fourth",
+			want: "3. third\n4. fourth",
+		},
+		{
+			name: "task boxes",
+			in:   "- [] buy milk\n- [X] pay rent\n* [ ]call mom",
+			want: "- [ ] buy milk\n- [x] pay rent\n- [ ] call mom",
+		},
+		{
+			name: "nested items",
+			in:   "1. Pack\n    * socks\n        - wool\n    * shirts\n2. Leave",
+			want: "1. Pack\n   - socks\n     - wool\n   - shirts\n2. Leave",
+		},
+		{
+			name: "continuation lines",
+			in:   "- first item\n      wraps here\n- second",
+			want: "- first item\n  wraps here\n- second",
+		},
+		{
+			name: "rules and emphasis aren't bullets",
+			in:   "Intro\n\n---\n*really* important\n**bold** too",
+			want: "Intro\n\n---\n*really* important\n**bold** too",
+		},
+		{
+			name: "paragraph after a list",
+			in:   "- a\n- b\n\nThanks",
+			want: "- a\n- b\n\nThanks",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeMarkdown(tt.in, tt.style); got != tt.want {
+				t.Errorf("normalizeMarkdown() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMarkdownTransformer_Invalid(t *testing.T) {
+	if _, err := newMarkdownTransformer(TransformerSpec{Bullet: "•"}); err == nil {
+		t.Error("bullet •: expected error")
+	}
+	if _, err := newMarkdownTransformer(TransformerSpec{HeadingBase: 7}); err == nil {
+		t.Error("headingBase 7: expected error")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const defaultMetricsNamespace = "WristAgent"
+
+// metricsOutput receives metric records; Lambda ships stdout to CloudWatch Logs, which
+// extracts them as metrics
+var metricsOutput io.Writer = os.Stdout
+
+// emitModelCallMetrics records one Bedrock call in CloudWatch Embedded Metric Format,
+// dimensioned by capacity type (on demand, inference profile, application inference
+// profile or provisioned) alone and together with the model ID
+func emitModelCallMetrics(model string, latency time.Duration, usage Usage, err error) {
+	failed := 0
+	if err != nil {
+		failed = 1
+	}
+	record := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  getEnv("METRICS_NAMESPACE", defaultMetricsNamespace),
+				"Dimensions": [][]string{{"CapacityType"}, {"CapacityType", "ModelId"}},
+				"Metrics": []map[string]string{
+					{"Name": "ModelCalls", "Unit": "Count"},
+					{"Name": "ModelErrors", "Unit": "Count"},
+					{"Name": "ModelLatency", "Unit": "Milliseconds"},
+					{"Name": "InputTokens", "Unit": "Count"},
+					{"Name": "OutputTokens", "Unit": "Count"},
+				},
+			}},
+		},
+		"CapacityType": modelCapacity(model),
+		"ModelId":      model,
+		"ModelCalls":   1,
+		"ModelErrors":  failed,
+		"ModelLatency": latency.Milliseconds(),
+		"InputTokens":  usage.InputTokens,
+		"OutputTokens": usage.OutputTokens,
+	}
+	line, marshalErr := json.Marshal(record)
+	if marshalErr != nil {
+		log.Printf("Failed to marshal model call metrics: %v", marshalErr)
+		return
+	}
+	fmt.Fprintln(metricsOutput, string(line))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// ModelPrice is a model's on-demand price in USD per million tokens
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// knownModelPrices are Bedrock on-demand prices for the models this function is usually
+// pointed at. BEDROCK_INPUT_USD_PER_MTOK and BEDROCK_OUTPUT_USD_PER_MTOK override the
+// price of BEDROCK_MODEL_ID.
+var knownModelPrices = map[string]ModelPrice{
+	"anthropic.claude-haiku-4-5-20251001-v1:0":  {Input: 1.0, Output: 5.0},
+	"anthropic.claude-sonnet-4-5-20250929-v1:0": {Input: 3.0, Output: 15.0},
+	"anthropic.claude-3-5-haiku-20241022-v1:0":  {Input: 0.8, Output: 4.0},
+	"anthropic.claude-3-haiku-20240307-v1:0":    {Input: 0.25, Output: 1.25},
+	"amazon.nova-micro-v1:0":                    {Input: 0.035, Output: 0.14},
+	"amazon.nova-lite-v1:0":                     {Input: 0.06, Output: 0.24},
+	"amazon.nova-pro-v1:0":                      {Input: 0.8, Output: 3.2},
+	"meta.llama3-1-8b-instruct-v1:0":            {Input: 0.22, Output: 0.22},
+	"meta.llama3-2-11b-instruct-v1:0":           {Input: 0.16, Output: 0.16},
+	"meta.llama3-3-70b-instruct-v1:0":           {Input: 0.72, Output: 0.72},
+}
+
+// Cross-region inference profile IDs prefix the model ID with a geography
+var inferenceProfilePrefixes = []string{"us.", "eu.", "apac.", "global."}
+
+// Capacity types a model ID can name, reported in the ModelCalls metric
+const (
+	capacityOnDemand           = "on_demand"                     // foundation model ID or ARN
+	capacityInferenceProfile   = "inference_profile"             // cross-region profile, e.g. us.anthropic...
+	capacityApplicationProfile = "application_inference_profile" // arn:...:application-inference-profile/...
+	capacityProvisioned        = "provisioned"                   // arn:...:provisioned-model/...
+)
+
+// modelPrice returns a model's price. Unknown models are priced like the default model,
+// so cost estimates err towards what the deployment is configured for.
+func modelPrice(model string) ModelPrice {
+	// Provisioned throughput is billed by the hour, not the token
+	if modelCapacity(model) == capacityProvisioned {
+		return ModelPrice{}
+	}
+	if model == modelID {
+		price, ok := lookupPrice(model)
+		if !ok {
+			price = ModelPrice{Input: defaultInputUSDPerMTok, Output: defaultOutputUSDPerMTok}
+		}
+		return ModelPrice{
+			Input:  usdEnv("BEDROCK_INPUT_USD_PER_MTOK", price.Input),
+			Output: usdEnv("BEDROCK_OUTPUT_USD_PER_MTOK", price.Output),
+		}
+	}
+	if price, ok := lookupPrice(model); ok {
+		return price
+	}
+	log.Printf("No price known for model %s, using %s's", model, modelID)
+	return modelPrice(modelID)
+}
+
+func lookupPrice(model string) (ModelPrice, bool) {
+	price, ok := knownModelPrices[baseModelID(model)]
+	return price, ok
+}
+
+// modelARNResource splits a Bedrock ARN's resource into its type and ID, e.g.
+// provisioned-model and abc123; ok is false for plain model IDs
+func modelARNResource(model string) (resourceType, id string, ok bool) {
+	if !strings.HasPrefix(model, "arn:") {
+		return "", "", false
+	}
+	parts := strings.SplitN(model, ":", 6)
+	if len(parts) < 6 {
+		return "", "", false
+	}
+	return strings.Cut(parts[5], "/")
+}
+
+// modelCapacity returns the capacity type a model ID or ARN is served by
+func modelCapacity(model string) string {
+	if resourceType, _, ok := modelARNResource(model); ok {
+		switch resourceType {
+		case "provisioned-model":
+			return capacityProvisioned
+		case "application-inference-profile":
+			return capacityApplicationProfile
+		case "inference-profile":
+			return capacityInferenceProfile
+		}
+		return capacityOnDemand
+	}
+	if baseModelID(model) != model {
+		return capacityInferenceProfile
+	}
+	return capacityOnDemand
+}
+
+// baseModelID returns the foundation model ID behind a model ID, inference profile or
+// their ARNs. Application inference profiles and provisioned models don't name their
+// model, so their ARN is returned unchanged.
+func baseModelID(model string) string {
+	if resourceType, id, ok := modelARNResource(model); ok && (resourceType == "foundation-model" || resourceType == "inference-profile") {
+		model = id
+	}
+	for _, prefix := range inferenceProfilePrefixes {
+		if base, ok := strings.CutPrefix(model, prefix); ok {
+			return base
+		}
+	}
+	return model
+}
+
+// cost is what a call with the given usage costs, in USD
+func (p ModelPrice) cost(usage Usage) float64 {
+	return (float64(usage.InputTokens)*p.Input + float64(usage.OutputTokens)*p.Output) / 1e6
+}
+
+type modelKey struct{}
+
+// withModel routes the Bedrock calls made with ctx to a model other than BEDROCK_MODEL_ID
+func withModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// modelFrom returns the model Bedrock calls made with ctx go to
+func modelFrom(ctx context.Context) string {
+	if model, ok := ctx.Value(modelKey{}).(string); ok && model != "" {
+		return model
+	}
+	return modelID
+}
+
+// requestModel returns the model a request is answered by: the budget fallback when it
+// was degraded, else its cost class's model
+func requestModel(req *Req) string {
+	if req.model != "" {
+		return req.model
+	}
+	if model := costClassModel(req.CostClass); model != "" {
+		return model
+	}
+	return modelID
+}
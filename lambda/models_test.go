@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestModelCapacity(t *testing.T) {
+	tests := []struct {
+		model, capacity, base string
+	}{
+		{"anthropic.claude-haiku-4-5-20251001-v1:0", capacityOnDemand, "anthropic.claude-haiku-4-5-20251001-v1:0"},
+		{"arn:aws:bedrock:us-west-2::foundation-model/amazon.nova-lite-v1:0", capacityOnDemand, "amazon.nova-lite-v1:0"},
+		{"us.anthropic.claude-haiku-4-5-20251001-v1:0", capacityInferenceProfile, "anthropic.claude-haiku-4-5-20251001-v1:0"},
+		{"arn:aws:bedrock:us-west-2:123456789012:inference-profile/eu.meta.llama3-3-70b-instruct-v1:0", capacityInferenceProfile, "meta.llama3-3-70b-instruct-v1:0"},
+		{"arn:aws:bedrock:us-west-2:123456789012:application-inference-profile/a1b2c3", capacityApplicationProfile, "arn:aws:bedrock:us-west-2:123456789012:application-inference-profile/a1b2c3"},
+		{"arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x9y8z7", capacityProvisioned, "arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x9y8z7"},
+	}
+	for _, tt := range tests {
+		if got := modelCapacity(tt.model); got != tt.capacity {
+			t.Errorf("modelCapacity(%s) = %s, want %s", tt.model, got, tt.capacity)
+		}
+		if got := baseModelID(tt.model); got != tt.base {
+			t.Errorf("baseModelID(%s) = %s, want %s", tt.model, got, tt.base)
+		}
+	}
+}
+
+func TestModelPrice(t *testing.T) {
+	if got := modelPrice("us.amazon.nova-micro-v1:0"); got.Input != 0.035 || got.Output != 0.14 {
+		t.Errorf("nova micro = %+v", got)
+	}
+	if got := modelPrice("arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x9y8z7"); got != (ModelPrice{}) {
+		t.Errorf("provisioned = %+v, want free per token", got)
+	}
+	t.Setenv("BEDROCK_INPUT_USD_PER_MTOK", "2")
+	if got := modelPrice(modelID); got.Input != 2 || got.Output != 5 {
+		t.Errorf("default model with override = %+v", got)
+	}
+	if got := modelPrice("acme.unknown-v1"); got.Input != 2 {
+		t.Errorf("unknown model = %+v, want the default model's price", got)
+	}
+}
+
+func TestEmitModelCallMetrics(t *testing.T) {
+	var out bytes.Buffer
+	orig := metricsOutput
+	metricsOutput = &out
+	t.Cleanup(func() { metricsOutput = orig })
+
+	emitModelCallMetrics("arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x9y8z7", 1500*time.Millisecond, Usage{InputTokens: 10, OutputTokens: 4}, nil)
+	emitModelCallMetrics("us.anthropic.claude-haiku-4-5-20251001-v1:0", time.Second, Usage{}, errors.New("throttled"))
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d records: %s", len(lines), out.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(lines[0], &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["CapacityType"] != "provisioned" || record["ModelLatency"] != 1500.0 || record["InputTokens"] != 10.0 || record["_aws"] == nil {
+		t.Errorf("record = %s", lines[0])
+	}
+	json.Unmarshal(lines[1], &record)
+	if record["CapacityType"] != "inference_profile" || record["ModelErrors"] != 1.0 {
+		t.Errorf("record = %s", lines[1])
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// bedrockStreamAPI makes a streaming InvokeModel call, passing each chunk of the reply
+// to onChunk. It wraps InvokeModelWithResponseStream, whose output can only be built by
+// the SDK, so tests can stream without it.
+type bedrockStreamAPI interface {
+	StreamModel(ctx context.Context, model string, body []byte, onChunk func([]byte) error) error
+}
+
+// bedrockStreamClient streams replies for WebSocket sessions
+var bedrockStreamClient bedrockStreamAPI
+
+// bedrockStreamer is the Bedrock runtime client's bedrockStreamAPI
+type bedrockStreamer struct {
+	client *bedrockruntime.Client
+}
+
+func (s bedrockStreamer) StreamModel(ctx context.Context, model string, body []byte, onChunk func([]byte) error) error {
+	out, err := s.client.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(model),
+		ContentType: aws.String("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return err
+	}
+	stream := out.GetStream()
+	defer stream.Close()
+	for event := range stream.Events() {
+		if chunk, ok := event.(*types.ResponseStreamMemberChunk); ok {
+			if err := onChunk(chunk.Value.Bytes); err != nil {
+				return err
+			}
+		}
+	}
+	return stream.Err()
+}
+
+// replyStream passes the reply's markdown to onText as the model writes it. The model
+// answers with the Response JSON, so only the markdown field's text is passed on, or
+// the whole reply when it isn't JSON.
+type replyStream struct {
+	onText func(text string)
+	raw    strings.Builder
+	sent   int // bytes of the extracted text already passed on
+}
+
+type replyStreamKey struct{}
+type activeReplyStreamKey struct{}
+
+// withReplyStream returns a context whose request streams its reply text to onText
+func withReplyStream(ctx context.Context, onText func(text string)) context.Context {
+	return context.WithValue(ctx, replyStreamKey{}, &replyStream{onText: onText})
+}
+
+// streamingReply marks ctx as the call writing the request's reply, so its text is
+// streamed; the pipeline's other model calls (condensing, summaries) are not
+func streamingReply(ctx context.Context) context.Context {
+	if stream, ok := ctx.Value(replyStreamKey{}).(*replyStream); ok {
+		return context.WithValue(ctx, activeReplyStreamKey{}, stream)
+	}
+	return ctx
+}
+
+// activeReplyStream returns the stream a model call should write to, or nil
+func activeReplyStream(ctx context.Context) *replyStream {
+	stream, _ := ctx.Value(activeReplyStreamKey{}).(*replyStream)
+	return stream
+}
+
+// write adds a piece of the reply and passes on the text it completes. Continuation
+// calls append to the same reply, so the markdown keeps flowing across them.
+func (s *replyStream) write(delta string) {
+	s.raw.WriteString(delta)
+	text := replyTextSoFar(s.raw.String())
+	if len(text) > s.sent {
+		s.onText(text[s.sent:])
+		s.sent = len(text)
+	}
+}
+
+// anthropicStreamEvent is one chunk of a streamed Claude reply
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage Usage `json:"usage"`
+	} `json:"message"` // message_start
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"` // content_block_delta, message_delta
+	Usage Usage `json:"usage"` // message_delta
+}
+
+// streamAnthropicReply makes a streaming Claude call, writing its text to stream as it
+// arrives and returning the reply assembled as InvokeModel would have
+func streamAnthropicReply(ctx context.Context, model string, body []byte, stream *replyStream) (*BedrockResponse, error) {
+	var text strings.Builder
+	resp := &BedrockResponse{}
+	err := bedrockStreamClient.StreamModel(ctx, model, body, func(chunk []byte) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal(chunk, &event); err != nil {
+			return fmt.Errorf("failed to parse stream event: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			resp.Usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			// Extended thinking arrives as thinking_delta blocks, which aren't part of the reply
+			if event.Delta.Type == "text_delta" {
+				text.WriteString(event.Delta.Text)
+				stream.write(event.Delta.Text)
+			}
+		case "message_delta":
+			resp.StopReason = event.Delta.StopReason
+			resp.Usage.OutputTokens = event.Usage.OutputTokens
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Content = []Content{{Type: "text", Text: text.String()}}
+	return resp, nil
+}
+
+// replyTextSoFar extracts the text to show from a partial reply: the decoded value of
+// its "markdown" field so far when the reply is JSON (possibly fenced), else the reply
+func replyTextSoFar(raw string) string {
+	trimmed := strings.TrimLeft(raw, " \t\r\n")
+	if trimmed == "" {
+		return ""
+	}
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "`") {
+		return raw
+	}
+
+	// Find "markdown" followed by a colon and the opening quote of its value
+	rest := trimmed
+	for {
+		i := strings.Index(rest, `"markdown"`)
+		if i < 0 {
+			return ""
+		}
+		rest = strings.TrimLeft(rest[i+len(`"markdown"`):], " \t\r\n")
+		if value, ok := strings.CutPrefix(rest, ":"); ok {
+			value = strings.TrimLeft(value, " \t\r\n")
+			if value, ok := strings.CutPrefix(value, `"`); ok {
+				return partialJSONString(value)
+			}
+			if value == "" {
+				return ""
+			}
+		}
+	}
+}
+
+// partialJSONString decodes a JSON string value up to its closing quote or, while it is
+// still arriving, up to the last complete character or escape
+func partialJSONString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case '"':
+			return b.String()
+		case '\\':
+			if i+1 >= len(s) {
+				return b.String()
+			}
+			if s[i+1] != 'u' {
+				if escaped, ok := jsonEscapes[s[i+1]]; ok {
+					b.WriteByte(escaped)
+				}
+				i += 2
+				continue
+			}
+			r, n := partialJSONRune(s[i:])
+			if n == 0 {
+				return b.String()
+			}
+			b.WriteRune(r)
+			i += n
+		default:
+			if !utf8.FullRuneInString(s[i:]) {
+				return b.String()
+			}
+			_, size := utf8.DecodeRuneInString(s[i:])
+			b.WriteString(s[i : i+size])
+			i += size
+		}
+	}
+	return b.String()
+}
+
+// jsonEscapes are the single-character JSON escapes and what they stand for
+var jsonEscapes = map[byte]byte{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}
+
+// partialJSONRune decodes a \uXXXX escape at the start of s, joining a UTF-16 surrogate
+// pair, and returns the rune and the bytes it used; 0 means it hasn't fully arrived
+func partialJSONRune(s string) (rune, int) {
+	if len(s) < 6 {
+		return 0, 0
+	}
+	code, err := strconv.ParseUint(s[2:6], 16, 32)
+	if err != nil {
+		return utf8.RuneError, 6
+	}
+	r := rune(code)
+	if !utf16.IsSurrogate(r) {
+		return r, 6
+	}
+	if len(s) < 12 {
+		return 0, 0
+	}
+	low, err := strconv.ParseUint(s[8:12], 16, 32)
+	if s[6] != '\\' || s[7] != 'u' || err != nil {
+		return utf8.RuneError, 6
+	}
+	return utf16.DecodeRune(r, rune(low)), 12
+}
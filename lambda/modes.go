@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// Defaults applied by validateRequest when the request leaves them unset
+const (
+	defaultMode      = "note"
+	defaultMaxTokens = 800
+)
+
+// ModeInfo describes a request mode for GET /modes, so clients can build mode pickers
+type ModeInfo struct {
+	Name                  string   `json:"name"`
+	Description           string   `json:"description"`
+	Action                string   `json:"action"` // Response.action the mode produces
+	DefaultMaxTokens      int      `json:"defaultMaxTokens"`
+	DefaultThinkingTokens int      `json:"defaultThinkingTokens"`
+	AutoThinkingTokens    int      `json:"autoThinkingTokens"` // thinkingPolicy auto's budget for short text; longer text scales it up to 4x
+	MaxTextChars          int      `json:"maxTextChars"`       // longest accepted text, from the deployment's size limits
+	RequiredFields        []string `json:"requiredFields"`
+	OptionalFields        []string `json:"optionalFields"`
+}
+
+// ModesResponse is the body of GET /modes
+type ModesResponse struct {
+	DefaultMode string     `json:"defaultMode"`
+	Modes       []ModeInfo `json:"modes"`
+}
+
+// Request fields every mode accepts besides text
+var commonOptionalFields = []string{"mode", "titleHint", "timezone", "maxTokens", "thinkingTokens", "deliver", "callbackUrl", "speak", "thinkingPolicy", "temperature", "topP", "topK", "stopSequences"}
+
+// modes lists the supported modes in display order; validateRequest and GET /modes both read it
+var modes = []ModeInfo{
+	{Name: "note", Description: "Clear, well-formatted notes", Action: "note"},
+	{Name: "reminder", Description: "Reminders with a due date", Action: "reminder"},
+	{Name: "event", Description: "Calendar events with start, end, location and recurrence", Action: "event"},
+	{Name: "research", Description: "Detailed, well-researched answers with sources", Action: "note", AutoThinkingTokens: 4096},
+	{Name: "deepthink", Description: "Thorough analysis from multiple perspectives", Action: "note", AutoThinkingTokens: 16384},
+	{Name: "question", Description: "One or two sentence answers to quick questions", Action: "note", DefaultMaxTokens: 400},
+	{Name: "email", Description: "Email drafts, optionally sent via SES", Action: "email", OptionalFields: []string{"send"}},
+	{Name: "shopping", Description: "Shopping items merged into a persistent list", Action: "shopping"},
+	{Name: "journal", Description: "Journal entries tagged with mood and energy for streak tracking", Action: "journal"},
+	{Name: "contact", Description: "Contact details with a ready-to-import vCard", Action: "contact"},
+	{Name: "summarize", Description: "Bullet summaries and action items for long pasted text", Action: "note", DefaultMaxTokens: 1200, AutoThinkingTokens: 2048},
+	{Name: "translate", Description: "Translations with the detected source language and romanization", Action: "translate", OptionalFields: []string{"targetLanguage"}},
+	{Name: "timer", Description: "Countdown timers with the duration in seconds and ISO 8601", Action: "timer", DefaultMaxTokens: 300},
+}
+
+// modeInferences infer a mode from how a message starts, for adapters without a mode picker
+// (chat bots). They are checked in order; the first match wins.
+var modeInferences = []struct {
+	mode    string
+	pattern *regexp.Regexp
+}{
+	{"timer", regexp.MustCompile(`(?i)^((set|start) (a |an )?(\d+[- ]\w+ )?(timer|countdown)|timer\b|countdown\b)`)},
+	{"reminder", regexp.MustCompile(`(?i)^(remind me|reminder\b|don'?t (let me )?forget)`)},
+	{"event", regexp.MustCompile(`(?i)^(schedule|add (an? )?(event|meeting|appointment)|(event|meeting|appointment)\b)`)},
+	{"shopping", regexp.MustCompile(`(?i)^(buy|shopping\b|groceries\b)|\b(shopping|grocery) list\b`)},
+	{"translate", regexp.MustCompile(`(?i)^translate\b`)},
+	{"summarize", regexp.MustCompile(`(?i)^(summari[sz]e|tl;?dr)\b`)},
+	{"email", regexp.MustCompile(`(?i)^((draft|write|send) (an? )?)?e-?mail\b`)},
+	{"journal", regexp.MustCompile(`(?i)^(dear diary|journal\b)`)},
+	{"contact", regexp.MustCompile(`(?i)^(new|add|save) contact\b`)},
+	{"research", regexp.MustCompile(`(?i)^research\b`)},
+}
+
+// Longest text inferMode treats as a quick question; pasted text at least
+// inferSummarizeMinChars long is summarized
+const (
+	inferQuestionMaxChars  = 200
+	inferSummarizeMinChars = 2000
+)
+
+// inferMode picks a mode for text sent without one, or "" to leave the caller's
+// default (their preferences, then note)
+func inferMode(text string) string {
+	text = strings.TrimSpace(text)
+	for _, hint := range modeInferences {
+		if hint.pattern.MatchString(text) {
+			return hint.mode
+		}
+	}
+	length := utf8.RuneCountInString(text)
+	switch {
+	case length >= inferSummarizeMinChars:
+		return "summarize"
+	case strings.HasSuffix(text, "?") && length <= inferQuestionMaxChars:
+		return "question"
+	}
+	return ""
+}
+
+// lookupMode returns the mode with the given name, with defaults and fields filled in
+func lookupMode(name string) (ModeInfo, bool) {
+	for _, mode := range modes {
+		if mode.Name == name {
+			return describeMode(mode), true
+		}
+	}
+	return ModeInfo{}, false
+}
+
+// describeMode fills in the defaults and request fields shared by every mode
+func describeMode(mode ModeInfo) ModeInfo {
+	if mode.DefaultMaxTokens == 0 {
+		mode.DefaultMaxTokens = defaultMaxTokens
+	}
+	mode.MaxTextChars = loadSizeLimits().textLimit(mode.Name)
+	mode.RequiredFields = []string{"text"}
+	mode.OptionalFields = append(append([]string{}, commonOptionalFields...), mode.OptionalFields...)
+	return mode
+}
+
+// modeNames returns the supported mode names in display order
+func modeNames() []string {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = mode.Name
+	}
+	return names
+}
+
+// isModesRequest reports whether the route is GET /modes
+func isModesRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/modes"
+}
+
+// handleModes lists the modes the caller's token may use. It is read-only and
+// doesn't count against usage quotas.
+func handleModes(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+
+	scopes := scopesFromEvent(event)
+	body := ModesResponse{DefaultMode: defaultMode, Modes: []ModeInfo{}}
+	for _, mode := range modes {
+		if scopes.allows("mode", mode.Name) {
+			body.Modes = append(body.Modes, describeMode(mode))
+		}
+	}
+
+	resp := apiResponse(200, body)
+	resp.Headers["Cache-Control"] = "private, max-age=300"
+	return resp
+}
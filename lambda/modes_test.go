@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLookupMode(t *testing.T) {
+	mode, ok := lookupMode("email")
+	if !ok {
+		t.Fatal("lookupMode(email) not found")
+	}
+	if mode.DefaultMaxTokens != defaultMaxTokens {
+		t.Errorf("DefaultMaxTokens = %d, want %d", mode.DefaultMaxTokens, defaultMaxTokens)
+	}
+	if len(mode.RequiredFields) != 1 || mode.RequiredFields[0] != "text" {
+		t.Errorf("RequiredFields = %v, want [text]", mode.RequiredFields)
+	}
+	if last := mode.OptionalFields[len(mode.OptionalFields)-1]; last != "send" {
+		t.Errorf("OptionalFields = %v, want send for email", mode.OptionalFields)
+	}
+
+	if mode.MaxTextChars != defaultMaxTextChars {
+		t.Errorf("MaxTextChars = %d, want %d", mode.MaxTextChars, defaultMaxTextChars)
+	}
+	if summarize, _ := lookupMode("summarize"); summarize.MaxTextChars != defaultSummarizeMaxTextChars {
+		t.Errorf("summarize MaxTextChars = %d, want %d", summarize.MaxTextChars, defaultSummarizeMaxTextChars)
+	}
+
+	if _, ok := lookupMode("poem"); ok {
+		t.Error("lookupMode(poem) should not be found")
+	}
+}
+
+func TestInferMode(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Remind me to call mom at 5", "reminder"},
+		{"don't forget the dentist on Friday", "reminder"},
+		{"Schedule lunch with Sam next Tuesday at noon", "event"},
+		{"buy oat milk and eggs", "shopping"},
+		{"add bananas to the grocery list", "shopping"},
+		{"Translate where is the station into Japanese", "translate"},
+		{"tl;dr of this thread", "summarize"},
+		{"Email Dana that the report is late", "email"},
+		{"draft an email to the landlord", "email"},
+		{"Dear diary, long day but a good one", "journal"},
+		{"new contact Jo Smith 555 0100", "contact"},
+		{"Set a timer for 25 minutes", "timer"},
+		{"start a 10-minute countdown", "timer"},
+		{"What's the capital of Australia?", "question"},
+		{strings.Repeat("A long pasted article. ", 100), "summarize"},
+		{"An idea for the garden: raised beds", ""},
+		{"Why does the sky look blue at noon but red at sunset, and what does that say about the atmosphere? " + strings.Repeat("More detail. ", 10) + "?", ""},
+	}
+	for _, tt := range tests {
+		if got := inferMode(tt.text); got != tt.want {
+			t.Errorf("inferMode(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIsModesRequest(t *testing.T) {
+	tests := []struct {
+		resource string
+		path     string
+		want     bool
+	}{
+		{"/modes", "/modes", true},
+		{"", "/modes/", true},
+		{"/invoke", "/invoke", false},
+		{"/admin/tokens", "/admin/tokens", false},
+	}
+
+	for _, tt := range tests {
+		event := events.APIGatewayProxyRequest{Resource: tt.resource, Path: tt.path}
+		if got := isModesRequest(event); got != tt.want {
+			t.Errorf("isModesRequest(%q, %q) = %v, want %v", tt.resource, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHandleModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		scopes    string
+		wantCode  int
+		wantModes []string
+	}{
+		{name: "unrestricted", method: "GET", wantCode: 200, wantModes: modeNames()},
+		{name: "allowlist", method: "GET", scopes: "mode:note mode:reminder", wantCode: 200, wantModes: []string{"note", "reminder"}},
+		{name: "denylist", method: "GET", scopes: "-mode:deepthink -mode:research", wantCode: 200, wantModes: []string{"note", "reminder", "event", "question", "email", "shopping", "journal", "contact", "summarize", "translate", "timer"}},
+		{name: "no modes", method: "GET", scopes: "mode:none", wantCode: 200, wantModes: []string{}},
+		{name: "post not allowed", method: "POST", wantCode: 405},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{HTTPMethod: tt.method, Resource: "/modes"}
+			if tt.scopes != "" {
+				event.RequestContext.Authorizer = map[string]interface{}{"scopes": tt.scopes}
+			}
+
+			resp := handleModes(context.Background(), event)
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("StatusCode = %d, want %d: %s", resp.StatusCode, tt.wantCode, resp.Body)
+			}
+			if tt.wantCode != 200 {
+				return
+			}
+
+			var body ModesResponse
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if body.DefaultMode != "note" {
+				t.Errorf("DefaultMode = %q, want note", body.DefaultMode)
+			}
+			if len(body.Modes) != len(tt.wantModes) {
+				t.Fatalf("got %d modes, want %v", len(body.Modes), tt.wantModes)
+			}
+			for i, mode := range body.Modes {
+				if mode.Name != tt.wantModes[i] {
+					t.Errorf("Modes[%d] = %q, want %q", i, mode.Name, tt.wantModes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_ModesRoute(t *testing.T) {
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/modes", Path: "/modes"})
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("StatusCode = %d, want 200: %s", resp.StatusCode, resp.Body)
+	}
+	if resp.Headers["Access-Control-Allow-Origin"] != "*" {
+		t.Errorf("Expected CORS headers on /modes response, got %v", resp.Headers)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key prefix for note edit records, followed by the capture ID and the edit time
+const noteEditSKPrefix = "EDIT#"
+
+// Days a deleted note is kept before the table's TTL purges it (can be overridden by
+// NOTE_DELETE_RETENTION_DAYS)
+const defaultNoteDeleteRetentionDays = 30
+
+// noteRequest is the body of PUT /notes/{id}, the note's new content. Omitted tags and
+// notes are cleared, as PUT replaces the note.
+type noteRequest struct {
+	Title    string   `json:"title"`
+	Markdown string   `json:"markdown"`
+	Tags     []string `json:"tags,omitempty"`
+	Notes    *string  `json:"notes,omitempty"`
+}
+
+// NoteResult is the stored note after an edit or delete, with the outcome of syncing the
+// change to the mode's sinks
+type NoteResult struct {
+	Note       HistoryItem      `json:"note"`
+	Deliveries []DeliveryResult `json:"deliveries,omitempty"`
+}
+
+// NoteEdit is the audit record of one change to a note. It names the changed fields but
+// keeps none of their content, so a purged note leaves nothing readable behind.
+type NoteEdit struct {
+	PK        string   `dynamodbav:"pk"`
+	SK        string   `dynamodbav:"sk"`
+	CaptureID string   `dynamodbav:"captureId"`
+	Principal string   `dynamodbav:"principal"`
+	Op        string   `dynamodbav:"op"` // update or delete
+	Fields    []string `dynamodbav:"fields,omitempty"`
+	At        string   `dynamodbav:"at"`
+}
+
+// noteDeleteRetention reads NOTE_DELETE_RETENTION_DAYS, falling back to the default
+func noteDeleteRetention() time.Duration {
+	days := defaultNoteDeleteRetentionDays
+	if env := os.Getenv("NOTE_DELETE_RETENTION_DAYS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+			days = n
+		} else {
+			log.Printf("Invalid NOTE_DELETE_RETENTION_DAYS value: %s, using default", env)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// applyNoteUpdate replaces a note's content and returns the names of the fields that changed
+func applyNoteUpdate(item *HistoryItem, body noteRequest) ([]string, error) {
+	body.Title = strings.TrimSpace(body.Title)
+	if body.Title == "" {
+		return nil, errors.New("title is required")
+	}
+	if strings.TrimSpace(body.Markdown) == "" {
+		return nil, errors.New("markdown is required")
+	}
+	if body.Tags == nil {
+		body.Tags = []string{}
+	}
+	if body.Notes != nil && *body.Notes == "" {
+		body.Notes = nil
+	}
+
+	var fields []string
+	if item.Title != body.Title {
+		fields = append(fields, "title")
+	}
+	if item.Markdown != body.Markdown {
+		fields = append(fields, "markdown")
+	}
+	if strings.Join(item.Tags, "\x00") != strings.Join(body.Tags, "\x00") {
+		fields = append(fields, "tags")
+	}
+	if aws.ToString(item.Notes) != aws.ToString(body.Notes) {
+		fields = append(fields, "notes")
+	}
+	item.Title, item.Markdown, item.Tags, item.Notes = body.Title, body.Markdown, body.Tags, body.Notes
+	return fields, nil
+}
+
+// saveNoteEdit records a change to a note in the history table
+func saveNoteEdit(ctx context.Context, item HistoryItem, op string, fields []string, now time.Time) error {
+	edit := NoteEdit{
+		PK:        historyPK(item.Principal),
+		SK:        noteEditSKPrefix + item.ID + "#" + now.UTC().Format(time.RFC3339Nano),
+		CaptureID: item.ID,
+		Principal: item.Principal,
+		Op:        op,
+		Fields:    fields,
+		At:        now.UTC().Format(time.RFC3339),
+	}
+	av, err := attributevalue.MarshalMap(edit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal note edit: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// isNotesRequest reports whether the route is part of the notes API
+func isNotesRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	path = strings.TrimSuffix(path, "/")
+	return path == "/notes" || strings.HasPrefix(path, "/notes/")
+}
+
+// handleNotes serves PUT /notes/{id}, which corrects a stored note, and DELETE
+// /notes/{id}, which marks it deleted until the TTL purges it. Either change is recorded
+// as a NoteEdit and synced to the sinks that can apply it.
+func handleNotes(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	id := event.PathParameters["id"]
+	if id == "" || (event.HTTPMethod != "PUT" && event.HTTPMethod != "DELETE") {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+
+	var body noteRequest
+	if event.HTTPMethod == "PUT" {
+		if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+			return errorResponse(ctx, apierror.InvalidJSON())
+		}
+	}
+	now := time.Now()
+
+	principal := principalFromEvent(event)
+	item, err := loadCapture(ctx, principal, id)
+	if err != nil {
+		log.Printf("Failed to load note: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load note"))
+	}
+	if item == nil || item.Action != "note" || item.Deleted {
+		return errorResponse(ctx, apierror.NotFound("Note not found"))
+	}
+
+	op := "delete"
+	var fields []string
+	if event.HTTPMethod == "PUT" {
+		op = "update"
+		body.Tags = preferTags(body.Tags, requestTags(ctx, principal))
+		if fields, err = applyNoteUpdate(item, body); err != nil {
+			return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+		}
+		if len(fields) == 0 {
+			return apiResponse(200, NoteResult{Note: *item}) // nothing changed, nothing to record or sync
+		}
+		item.UpdatedAt = now.UTC().Format(time.RFC3339)
+	} else {
+		item.Deleted = true
+		item.DeletedAt = now.UTC().Format(time.RFC3339)
+		item.ExpiresAt = now.Add(noteDeleteRetention()).Unix()
+	}
+
+	// Record the edit first, so every stored change has an audit record
+	if err := saveNoteEdit(ctx, *item, op, fields, now); err != nil {
+		log.Printf("Failed to record note edit: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to save note"))
+	}
+	if err := saveCapture(ctx, *item); err != nil {
+		log.Printf("Failed to save note: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to save note"))
+	}
+	return apiResponse(200, NoteResult{Note: *item, Deliveries: syncCapture(ctx, *item)})
+}
+
+// historyResponse rebuilds the Response sinks were given from a stored capture
+func historyResponse(item HistoryItem) Response {
+	return Response{
+		ID:         item.ID,
+		Action:     item.Action,
+		Title:      item.Title,
+		Markdown:   item.Markdown,
+		DueISO:     item.DueISO,
+		StartISO:   item.StartISO,
+		EndISO:     item.EndISO,
+		Location:   item.Location,
+		URL:        item.URL,
+		Notes:      item.Notes,
+		Recurrence: item.Recurrence,
+		Priority:   item.Priority,
+		Urgency:    item.Urgency,
+		Sentiment:  item.Sentiment,
+		Tags:       item.Tags,
+	}
+}
+
+// syncCapture pushes an edited or deleted capture to the sinks configured for its mode
+// that can apply the change (see syncedSink). Other sinks, which don't keep a handle on
+// what they created, are left out; failures are reported per sink like deliverToSinks.
+func syncCapture(ctx context.Context, item HistoryItem) []DeliveryResult {
+	cfg, err := loadSinkConfig(ctx)
+	if err != nil {
+		log.Printf("Failed to load sink config: %v", err)
+		return []DeliveryResult{{Sink: "config", OK: false, Error: "sink configuration unavailable"}}
+	}
+
+	created, _ := time.Parse(time.RFC3339, item.CreatedAt)
+	ctx = withCaptureMeta(ctx, captureMeta{ID: item.ID, Principal: item.Principal, Mode: item.Mode, CreatedAt: created, Timezone: item.Timezone})
+	resp := historyResponse(item)
+	timeout := getSinkTimeout()
+
+	var results []DeliveryResult
+	for _, name := range cfg.sinksFor(item.Mode) {
+		sink, err := resolveSink(name)
+		if err != nil {
+			continue // reported when the capture was first delivered
+		}
+		synced, ok := sink.(syncedSink)
+		if !ok {
+			continue
+		}
+
+		sinkCtx, cancel := context.WithTimeout(ctx, timeout)
+		if item.Deleted {
+			err = synced.Remove(sinkCtx)
+		} else {
+			err = sink.Deliver(sinkCtx, resp)
+		}
+		cancel()
+
+		result := DeliveryResult{Sink: name, OK: err == nil}
+		if err != nil {
+			log.Printf("Sink %s sync failed: %v", name, err)
+			result.Error = deliveryFailed
+		}
+		results = append(results, result)
+	}
+	return results
+}
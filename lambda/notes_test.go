@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestApplyNoteUpdate(t *testing.T) {
+	notes := "old notes"
+	item := HistoryItem{Title: "Garden", Markdown: "Plant tomatoes", Tags: []string{"home"}, Notes: &notes}
+
+	fields, err := applyNoteUpdate(&item, noteRequest{Title: " Garden ", Markdown: "Plant tomatoes and basil", Tags: []string{"home"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fields, ",") != "markdown,notes" {
+		t.Errorf("fields = %v", fields)
+	}
+	if item.Title != "Garden" || item.Markdown != "Plant tomatoes and basil" || item.Notes != nil {
+		t.Errorf("item = %+v", item)
+	}
+
+	fields, _ = applyNoteUpdate(&item, noteRequest{Title: "Garden", Markdown: "Plant tomatoes and basil", Tags: []string{"home"}})
+	if len(fields) != 0 {
+		t.Errorf("unchanged note reported fields %v", fields)
+	}
+	fields, _ = applyNoteUpdate(&item, noteRequest{Title: "Garden", Markdown: "Plant tomatoes and basil"})
+	if strings.Join(fields, ",") != "tags" || item.Tags == nil || len(item.Tags) != 0 {
+		t.Errorf("omitted tags: fields %v, tags %#v", fields, item.Tags)
+	}
+
+	for _, body := range []noteRequest{{Markdown: "text"}, {Title: "Title", Markdown: "  "}} {
+		if _, err := applyNoteUpdate(&item, body); err == nil {
+			t.Errorf("applyNoteUpdate(%+v) succeeded, want error", body)
+		}
+	}
+}
+
+func TestHandleNotes(t *testing.T) {
+	call := func(method, id, principal, body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/notes/{id}", Body: body}
+		event.PathParameters = map[string]string{"id": id}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("DELETE", "note-1", "user-1", ""); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	store := &fakeS3{}
+	var webhookMethod string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookMethod = r.Method
+	}))
+	defer server.Close()
+	useSinks(t, &S3Sink{client: store, bucket: "captures"}, &WebhookSink{client: server.Client(), url: server.URL}, &stubSink{name: "notion"})
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["s3","webhook","notion"]}`)
+
+	ctx := context.Background()
+	created := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "note-1", Principal: "user-1", Mode: "note", CreatedAt: created}, Response{Action: "note", Title: "Garden", Markdown: "Plant tomatoes"}))
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "rem-1", Principal: "user-1", Mode: "reminder", CreatedAt: created}, Response{Action: "reminder", Title: "Call mom"}))
+
+	t.Run("update", func(t *testing.T) {
+		resp := call("PUT", "note-1", "user-1", `{"title":"Garden","markdown":"Plant tomatoes and basil","tags":["home"]}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+		var result NoteResult
+		json.Unmarshal([]byte(resp.Body), &result)
+		if result.Note.Markdown != "Plant tomatoes and basil" || result.Note.UpdatedAt == "" {
+			t.Errorf("note = %+v", result.Note)
+		}
+		// notion can't apply edits, so only s3 and the webhook are synced
+		if len(result.Deliveries) != 2 || !result.Deliveries[0].OK || !result.Deliveries[1].OK {
+			t.Errorf("deliveries = %+v", result.Deliveries)
+		}
+		if store.key != "captures/user-1/2025/01/note-1.md" || !strings.Contains(store.body, "Plant tomatoes and basil") || webhookMethod != "POST" {
+			t.Errorf("s3 %s, webhook %s", store.key, webhookMethod)
+		}
+		stored, _ := loadCapture(ctx, "user-1", "note-1")
+		if stored == nil || stored.Markdown != "Plant tomatoes and basil" {
+			t.Errorf("stored = %+v", stored)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		before := time.Now()
+		resp := call("DELETE", "note-1", "user-1", "")
+		if resp.StatusCode != 200 {
+			t.Fatalf("StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+		stored, _ := loadCapture(ctx, "user-1", "note-1")
+		if stored == nil || !stored.Deleted || stored.DeletedAt == "" {
+			t.Fatalf("stored = %+v", stored)
+		}
+		if purge := time.Unix(stored.ExpiresAt, 0).Sub(before); purge < 29*24*time.Hour || purge > 31*24*time.Hour {
+			t.Errorf("purged after %s, want 30 days", purge)
+		}
+		if len(store.deleted) != 1 || store.deleted[0] != "captures/user-1/2025/01/note-1.md" || webhookMethod != "DELETE" {
+			t.Errorf("s3 deleted %v, webhook %s", store.deleted, webhookMethod)
+		}
+		notes, _ := loadCapturesByAction(ctx, "user-1", "note", 10)
+		if len(notes) != 0 {
+			t.Errorf("deleted note still listed: %+v", notes)
+		}
+		if resp := call("PUT", "note-1", "user-1", `{"title":"Garden","markdown":"Back"}`); resp.StatusCode != 404 {
+			t.Errorf("editing a deleted note: StatusCode = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("audit trail", func(t *testing.T) {
+		var edits []string
+		for _, item := range db.items {
+			if sk, _ := item["sk"].(string); strings.HasPrefix(sk, noteEditSKPrefix+"note-1#") {
+				edits = append(edits, item["op"].(string))
+				if _, ok := item["markdown"]; ok {
+					t.Errorf("edit record kept note content: %v", item)
+				}
+			}
+		}
+		if strings.Join(edits, ",") != "update,delete" {
+			t.Errorf("edits = %v", edits)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		saveCapture(ctx, newHistoryItem(captureMeta{ID: "note-2", Principal: "user-1", Mode: "note", CreatedAt: created}, Response{Action: "note", Title: "Books", Markdown: "Dune"}))
+		tests := []struct {
+			name, method, id, principal, body string
+			want                              int
+		}{
+			{"not a note", "PUT", "rem-1", "user-1", `{"title":"x","markdown":"y"}`, 404},
+			{"other principal", "DELETE", "note-1", "user-2", "", 404},
+			{"missing title", "PUT", "note-2", "user-1", `{"markdown":"y"}`, 400},
+			{"bad JSON", "PUT", "note-1", "user-1", `{`, 400},
+			{"wrong method", "PATCH", "note-1", "user-1", `{}`, 405},
+		}
+		for _, tt := range tests {
+			if resp := call(tt.method, tt.id, tt.principal, tt.body); resp.StatusCode != tt.want {
+				t.Errorf("%s: StatusCode = %d, want %d", tt.name, resp.StatusCode, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Notion limits the number of children blocks per create-page request
+const notionMaxBlocks = 100
+
+var (
+	notionOrderedItem = regexp.MustCompile(`^\d+[.)]\s+`)
+	notionInlineToken = regexp.MustCompile("\\*\\*([^*]+)\\*\\*|\\*([^*]+)\\*|_([^_]+)_|`([^`]+)`|\\[([^\\]]+)\\]\\(([^)\\s]+)\\)")
+)
+
+// markdownToNotionBlocks converts model markdown into Notion blocks. Supported syntax:
+// headings (#, ##, ###), bulleted/numbered lists, task items, quotes, fenced code,
+// horizontal rules, and paragraphs with bold/italic/code/link inline formatting.
+func markdownToNotionBlocks(markdown string) []map[string]interface{} {
+	blocks := []map[string]interface{}{}
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+
+	var paragraph []string
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, notionTextBlock("paragraph", strings.Join(paragraph, " ")))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flushParagraph()
+			language := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, notionCodeBlock(strings.Join(code, "\n"), language))
+
+		case strings.HasPrefix(trimmed, "### "):
+			flushParagraph()
+			blocks = append(blocks, notionTextBlock("heading_3", trimmed[4:]))
+		case strings.HasPrefix(trimmed, "## "):
+			flushParagraph()
+			blocks = append(blocks, notionTextBlock("heading_2", trimmed[3:]))
+		case strings.HasPrefix(trimmed, "# "):
+			flushParagraph()
+			blocks = append(blocks, notionTextBlock("heading_1", trimmed[2:]))
+
+		case trimmed == "---" || trimmed == "***":
+			flushParagraph()
+			blocks = append(blocks, map[string]interface{}{"object": "block", "type": "divider", "divider": map[string]interface{}{}})
+
+		case strings.HasPrefix(trimmed, "- [ ] ") || strings.HasPrefix(trimmed, "- [x] ") || strings.HasPrefix(trimmed, "- [X] "):
+			flushParagraph()
+			block := notionTextBlock("to_do", trimmed[6:])
+			block["to_do"].(map[string]interface{})["checked"] = trimmed[3] != ' '
+			blocks = append(blocks, block)
+
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			flushParagraph()
+			blocks = append(blocks, notionTextBlock("bulleted_list_item", trimmed[2:]))
+
+		case notionOrderedItem.MatchString(trimmed):
+			flushParagraph()
+			blocks = append(blocks, notionTextBlock("numbered_list_item", notionOrderedItem.ReplaceAllString(trimmed, "")))
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			blocks = append(blocks, notionTextBlock("quote", strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushParagraph()
+
+	if len(blocks) > notionMaxBlocks {
+		blocks = blocks[:notionMaxBlocks]
+	}
+	return blocks
+}
+
+// notionTextBlock builds a block of the given type holding formatted rich text
+func notionTextBlock(blockType, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"object": "block",
+		"type":   blockType,
+		blockType: map[string]interface{}{
+			"rich_text": notionInlineText(text),
+		},
+	}
+}
+
+// notionCodeBlock builds a code block; Notion requires a language so unknown ones map to "plain text"
+func notionCodeBlock(code, language string) map[string]interface{} {
+	if language == "" {
+		language = "plain text"
+	}
+	return map[string]interface{}{
+		"object": "block",
+		"type":   "code",
+		"code": map[string]interface{}{
+			"rich_text": notionRichText(code),
+			"language":  language,
+		},
+	}
+}
+
+// notionInlineText converts inline markdown (bold, italic, code, links) into annotated rich text
+func notionInlineText(text string) []map[string]interface{} {
+	parts := []map[string]interface{}{}
+	appendText := func(content string, annotations map[string]bool, link string) {
+		for _, part := range notionRichText(content) {
+			if len(annotations) > 0 {
+				part["annotations"] = annotations
+			}
+			if link != "" {
+				part["text"].(map[string]interface{})["link"] = map[string]string{"url": link}
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	last := 0
+	for _, m := range notionInlineToken.FindAllStringSubmatchIndex(text, -1) {
+		appendText(text[last:m[0]], nil, "")
+		switch {
+		case m[2] >= 0:
+			appendText(text[m[2]:m[3]], map[string]bool{"bold": true}, "")
+		case m[4] >= 0:
+			appendText(text[m[4]:m[5]], map[string]bool{"italic": true}, "")
+		case m[6] >= 0:
+			appendText(text[m[6]:m[7]], map[string]bool{"italic": true}, "")
+		case m[8] >= 0:
+			appendText(text[m[8]:m[9]], map[string]bool{"code": true}, "")
+		case m[10] >= 0:
+			appendText(text[m[10]:m[11]], nil, text[m[12]:m[13]])
+		}
+		last = m[1]
+	}
+	appendText(text[last:], nil, "")
+	return parts
+}
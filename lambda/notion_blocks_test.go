@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func blockTypes(blocks []map[string]interface{}) []string {
+	types := make([]string, len(blocks))
+	for i, b := range blocks {
+		types[i] = b["type"].(string)
+	}
+	return types
+}
+
+func TestMarkdownToNotionBlocks(t *testing.T) {
+	markdown := strings.Join([]string{
+		"# Meeting Notes",
+		"Discussed the roadmap",
+		"with the team.",
+		"",
+		"## Action Items",
+		"- Send recap",
+		"* Book room",
+		"1. First",
+		"2) Second",
+		"- [ ] Open task",
+		"- [x] Done task",
+		"> Quote",
+		"---",
+		"```go",
+		"fmt.Println(\"hi\")",
+		"```",
+		"### Done",
+	}, "\n")
+
+	got := blockTypes(markdownToNotionBlocks(markdown))
+	want := []string{
+		"heading_1", "paragraph", "heading_2",
+		"bulleted_list_item", "bulleted_list_item",
+		"numbered_list_item", "numbered_list_item",
+		"to_do", "to_do", "quote", "divider", "code", "heading_3",
+	}
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("markdownToNotionBlocks() types = %v, want %v", got, want)
+	}
+}
+
+func TestMarkdownToNotionBlocks_TodoChecked(t *testing.T) {
+	blocks := markdownToNotionBlocks("- [x] Done\n- [ ] Open")
+
+	if checked := blocks[0]["to_do"].(map[string]interface{})["checked"]; checked != true {
+		t.Errorf("Expected first to_do checked, got %v", checked)
+	}
+	if checked := blocks[1]["to_do"].(map[string]interface{})["checked"]; checked != false {
+		t.Errorf("Expected second to_do unchecked, got %v", checked)
+	}
+}
+
+func TestMarkdownToNotionBlocks_CodeLanguageDefault(t *testing.T) {
+	blocks := markdownToNotionBlocks("```\nplain\n```")
+
+	code := blocks[0]["code"].(map[string]interface{})
+	if code["language"] != "plain text" {
+		t.Errorf("Expected 'plain text' language, got %v", code["language"])
+	}
+}
+
+func TestMarkdownToNotionBlocks_CapsBlockCount(t *testing.T) {
+	markdown := strings.Repeat("- item\n", notionMaxBlocks+20)
+
+	if got := len(markdownToNotionBlocks(markdown)); got != notionMaxBlocks {
+		t.Errorf("Expected %d blocks, got %d", notionMaxBlocks, got)
+	}
+}
+
+func TestNotionInlineText(t *testing.T) {
+	parts := notionInlineText("Call **Bob** about `deploy` see [docs](https://example.com) _soon_")
+
+	var bold, code, link, italic bool
+	for _, p := range parts {
+		text := p["text"].(map[string]interface{})
+		if ann, ok := p["annotations"].(map[string]bool); ok {
+			bold = bold || (ann["bold"] && text["content"] == "Bob")
+			code = code || (ann["code"] && text["content"] == "deploy")
+			italic = italic || (ann["italic"] && text["content"] == "soon")
+		}
+		if l, ok := text["link"].(map[string]string); ok && l["url"] == "https://example.com" && text["content"] == "docs" {
+			link = true
+		}
+	}
+
+	if !bold || !code || !link || !italic {
+		t.Errorf("Expected bold, code, link, and italic parts, got %+v", parts)
+	}
+}
+
+func TestNotionSink_Properties(t *testing.T) {
+	sink := &NotionSink{titleProperty: "Name", tagsProperty: "Tags", dueProperty: "Due"}
+	start, end := "2025-01-15T09:00:00Z", "2025-01-15T10:00:00Z"
+
+	props := sink.properties(Response{Title: "Standup", StartISO: &start, EndISO: &end, Tags: []string{"work", "a,b"}})
+
+	date := props["Due"].(map[string]interface{})["date"].(map[string]string)
+	if date["start"] != start || date["end"] != end {
+		t.Errorf("Expected event start/end in date property, got %v", date)
+	}
+	options := props["Tags"].(map[string]interface{})["multi_select"].([]map[string]string)
+	if len(options) != 2 || options[1]["name"] != "a b" {
+		t.Errorf("Expected sanitized tag options, got %v", options)
+	}
+}
+
+func TestNotionSink_PropertiesDisabled(t *testing.T) {
+	sink := &NotionSink{titleProperty: "Name", tagsProperty: "none", dueProperty: "none"}
+	due := "2025-01-15T09:00:00Z"
+
+	props := sink.properties(Response{Title: "Pay rent", DueISO: &due, Tags: []string{"home"}})
+
+	if len(props) != 1 {
+		t.Errorf("Expected only the title property, got %v", props)
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// API version reported in the OpenAPI info block
+const apiVersion = "1.0.0"
+
+// openAPISpec is built once from the Go types; servers are filled in per request
+var (
+	openAPIOnce sync.Once
+	openAPISpec map[string]interface{}
+)
+
+// requiredOverride replaces the default "required unless omitempty" rule for request
+// bodies, where only validation decides what must be sent
+func requiredOverride(t reflect.Type) ([]string, bool) {
+	switch t {
+	case reflect.TypeOf(Req{}):
+		mode, _ := lookupMode(defaultMode)
+		return mode.RequiredFields, true
+	case reflect.TypeOf(adminTokenRequest{}):
+		return nil, true // name is required on create only
+	case reflect.TypeOf(TokenCountRequest{}):
+		return []string{"text"}, true
+	}
+	return nil, false
+}
+
+// schemaRegistry converts Go types to OpenAPI schemas using their json tags, collecting
+// named structs under components/schemas so the spec stays in sync with the code
+type schemaRegistry struct {
+	schemas map[string]interface{}
+}
+
+// schemaName is the component name for a struct type. Types from the apierror package
+// are prefixed so they read as ErrorEnvelope etc. in generated clients.
+func schemaName(t reflect.Type) string {
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if t.PkgPath() == reflect.TypeOf(apierror.Error{}).PkgPath() && !strings.HasPrefix(name, "Error") {
+		name = "Error" + name
+	}
+	return name
+}
+
+// ref returns the schema for t, registering struct types as components
+func (r *schemaRegistry) ref(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{} // embedded JSON of any shape
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := r.ref(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			// $ref siblings are ignored in OpenAPI 3.0, so wrap it to mark it nullable
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := r.schemas[name]; !ok {
+			r.schemas[name] = map[string]interface{}{} // reserve the name before recursing
+			r.schemas[name] = r.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": r.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": r.ref(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object builds an object schema from the exported, JSON-visible fields of t. The
+// fields of an embedded struct are inlined, as encoding/json does.
+func (r *schemaRegistry) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := r.object(field.Type)
+			for property, schema := range embedded["properties"].(map[string]interface{}) {
+				properties[property] = schema
+			}
+			if fields, ok := embedded["required"].([]string); ok {
+				required = append(required, fields...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = r.ref(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	if override, ok := requiredOverride(t); ok {
+		required = override
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// buildOpenAPISpec describes every endpoint served by the handler
+func buildOpenAPISpec() map[string]interface{} {
+	r := &schemaRegistry{schemas: map[string]interface{}{}}
+	reqSchema := r.ref(reflect.TypeOf(Req{}))
+	respSchema := r.ref(reflect.TypeOf(Response{}))
+	respV2Schema := r.ref(reflect.TypeOf(ResponseV2{}))
+	modesSchema := r.ref(reflect.TypeOf(ModesResponse{}))
+	acceptedSchema := r.ref(reflect.TypeOf(JobAccepted{}))
+	jobSchema := r.ref(reflect.TypeOf(Job{}))
+	uploadReqSchema := r.ref(reflect.TypeOf(UploadRequest{}))
+	uploadSchema := r.ref(reflect.TypeOf(UploadTicket{}))
+	vocabularySchema := r.ref(reflect.TypeOf(Vocabulary{}))
+	vocabularyReqSchema := r.ref(reflect.TypeOf(vocabularyRequest{}))
+	preferencesSchema := r.ref(reflect.TypeOf(Preferences{}))
+	preferencesReqSchema := r.ref(reflect.TypeOf(preferencesRequest{}))
+	journalStatsSchema := r.ref(reflect.TypeOf(JournalStats{}))
+	shoppingSchema := r.ref(reflect.TypeOf(ShoppingList{}))
+	shoppingItemReqSchema := r.ref(reflect.TypeOf(shoppingItemRequest{}))
+	reminderReqSchema := r.ref(reflect.TypeOf(reminderRequest{}))
+	reminderListSchema := r.ref(reflect.TypeOf(ReminderList{}))
+	reminderResultSchema := r.ref(reflect.TypeOf(ReminderResult{}))
+	noteReqSchema := r.ref(reflect.TypeOf(noteRequest{}))
+	noteResultSchema := r.ref(reflect.TypeOf(NoteResult{}))
+	exportSchema := r.ref(reflect.TypeOf(ExportResult{}))
+	importReqSchema := r.ref(reflect.TypeOf(ImportRequest{}))
+	importSchema := r.ref(reflect.TypeOf(ImportResult{}))
+	dailyDigestSchema := r.ref(reflect.TypeOf(DailyDigest{}))
+	searchSchema := r.ref(reflect.TypeOf(SearchResults{}))
+	tokenSchema := r.ref(reflect.TypeOf(AdminToken{}))
+	variantStatsSchema := r.ref(reflect.TypeOf(PromptVariantStats{}))
+	selfTestSchema := r.ref(reflect.TypeOf(SelfTestResult{}))
+	tokenCountReqSchema := r.ref(reflect.TypeOf(TokenCountRequest{}))
+	tokenCountSchema := r.ref(reflect.TypeOf(TokenCount{}))
+	tokenReqSchema := r.ref(reflect.TypeOf(adminTokenRequest{}))
+	reprocessReqSchema := r.ref(reflect.TypeOf(ReprocessRequest{}))
+	reprocessSchema := r.ref(reflect.TypeOf(ReprocessReport{}))
+	r.ref(reflect.TypeOf(apierror.Envelope{}))
+
+	// Constrain mode to the supported values
+	reqProps := r.schemas["Req"].(map[string]interface{})["properties"].(map[string]interface{})
+	reqProps["mode"].(map[string]interface{})["enum"] = modeNames()
+
+	jsonBody := func(schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+	}
+	ok := func(description string, schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"description": description, "content": jsonBody(schema)}
+	}
+	errorRef := map[string]interface{}{"$ref": "#/components/responses/Error"}
+	withErrors := func(responses map[string]interface{}) map[string]interface{} {
+		responses["default"] = errorRef
+		return responses
+	}
+	idParam := []interface{}{map[string]interface{}{
+		"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+	}}
+	queryParam := func(name, description string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name, "in": "query", "description": description, "schema": map[string]interface{}{"type": "string"},
+		}
+	}
+	textSchema := map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	invoke := func(operationID string, schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": operationID,
+				"summary":     "Process dictated text in the given mode",
+				"requestBody": map[string]interface{}{"required": true, "content": jsonBody(reqSchema)},
+				"parameters": []interface{}{
+					queryParam("format", "json (default), shortcut, markdown, text or html; overrides the Accept header"),
+				},
+				"responses": withErrors(map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Processed result, in the format asked for by format or the Accept header",
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{"schema": schema},
+							"text/markdown":    textSchema,
+							"text/plain":       textSchema,
+							"text/html":        textSchema,
+						},
+					},
+					"202": ok("Queued for background processing (async:true)", acceptedSchema),
+				}),
+			},
+		}
+	}
+	getJob := map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "getJob",
+			"summary":     "Get the status and result of an async request",
+			"parameters":  idParam,
+			"responses":   withErrors(map[string]interface{}{"200": ok("Job status; result or error once finished", jobSchema)}),
+		},
+	}
+
+	getJobEvents := map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "getJobEvents",
+			"summary":     "Stream an async request's progress stages as Server-Sent Events",
+			"description": "Events queued, thinking, generating, delivering-to-sinks and done, with the stage index as the event ID. " +
+				"Each response waits for stages past Last-Event-ID (or ?lastEventId=) and closes; 204 once done was sent.",
+			"parameters": append([]interface{}{queryParam("lastEventId", "Last-Event-ID for clients that can't set headers")}, idParam...),
+			"responses": withErrors(map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "New progress events",
+					"content":     map[string]interface{}{"text/event-stream": textSchema},
+				},
+				"204": map[string]interface{}{"description": "The done event was already sent"},
+			}),
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Wrist Agent API",
+			"version":     apiVersion,
+			"description": "Apple Watch to Bedrock integration. Errors use a shared envelope; branch on error.code and error.retryable.",
+		},
+		"security": []interface{}{map[string]interface{}{"clientToken": []string{}}},
+		"paths": map[string]interface{}{
+			// Unversioned /invoke is v1
+			"/invoke":              invoke("invoke", respSchema),
+			"/v1/invoke":           invoke("invokeV1", respSchema),
+			"/v2/invoke":           invoke("invokeV2", respV2Schema),
+			"/jobs/{id}":           getJob,
+			"/v2/jobs/{id}":        getJob,
+			"/jobs/{id}/events":    getJobEvents,
+			"/v2/jobs/{id}/events": getJobEvents,
+			"/modes": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "listModes",
+					"summary":     "List the modes the caller's token may use",
+					"responses":   withErrors(map[string]interface{}{"200": ok("Available modes", modesSchema)}),
+				},
+			},
+			"/uploads": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "createUpload",
+					"summary":     "Get a presigned URL to upload an image or audio clip; pass the key as imageKey or audioKey",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(uploadReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Presigned upload", uploadSchema)}),
+				},
+			},
+			"/vocabulary": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getVocabulary",
+					"summary":     "Get the caller's custom vocabulary",
+					"responses":   withErrors(map[string]interface{}{"200": ok("Custom vocabulary", vocabularySchema)}),
+				},
+				"put": map[string]interface{}{
+					"operationId": "putVocabulary",
+					"summary":     "Replace the names and jargon used to correct misheard dictation; an empty list clears it",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(vocabularyReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Saved vocabulary", vocabularySchema)}),
+				},
+			},
+			"/preferences": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getPreferences",
+					"summary":     "Get the caller's profile and preferences",
+					"responses":   withErrors(map[string]interface{}{"200": ok("Preferences", preferencesSchema)}),
+				},
+				"put": map[string]interface{}{
+					"operationId": "putPreferences",
+					"summary":     "Replace the caller's name, home timezone, default mode, list app and verbosity; omitted fields are cleared",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(preferencesReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Saved preferences", preferencesSchema)}),
+				},
+			},
+			"/journal/stats": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getJournalStats",
+					"summary":     "Get the caller's journaling streaks and recent mood and energy counts",
+					"responses":   withErrors(map[string]interface{}{"200": ok("Journal stats", journalStatsSchema)}),
+				},
+			},
+			"/shopping": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getShoppingList",
+					"summary":     "Get the caller's shopping list",
+					"responses":   withErrors(map[string]interface{}{"200": ok("Shopping list", shoppingSchema)}),
+				},
+			},
+			"/shopping/items/{id}": map[string]interface{}{
+				"patch": map[string]interface{}{
+					"operationId": "checkShoppingItem",
+					"summary":     "Check a shopping list item off, or back on",
+					"parameters":  idParam,
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(shoppingItemReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Updated shopping list", shoppingSchema)}),
+				},
+			},
+			"/reminders": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "listReminders",
+					"summary":     "List the caller's stored reminders, soonest due first",
+					"parameters": []interface{}{
+						queryParam("status", "pending (default), completed or all"),
+						queryParam("due_before", "Only reminders due before this, YYYY-MM-DD (start of the UTC day) or RFC 3339"),
+						queryParam("cursor", "nextCursor from the previous page"),
+					},
+					"responses": withErrors(map[string]interface{}{"200": ok("Reminders", reminderListSchema)}),
+				},
+			},
+			"/reminders/{id}": map[string]interface{}{
+				"patch": map[string]interface{}{
+					"operationId": "updateReminder",
+					"summary":     "Snooze or reschedule a stored reminder",
+					"parameters":  idParam,
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(reminderReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Updated reminder", reminderResultSchema)}),
+				},
+			},
+			"/reminders/{id}/complete": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "completeReminder",
+					"summary":     "Mark a stored reminder done",
+					"parameters":  idParam,
+					"responses":   withErrors(map[string]interface{}{"200": ok("Completed reminder", reminderResultSchema)}),
+				},
+			},
+			"/notes/{id}": map[string]interface{}{
+				"put": map[string]interface{}{
+					"operationId": "updateNote",
+					"summary":     "Replace a stored note's title, markdown, tags and notes",
+					"parameters":  idParam,
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(noteReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Updated note", noteResultSchema)}),
+				},
+				"delete": map[string]interface{}{
+					"operationId": "deleteNote",
+					"summary":     "Delete a stored note; it is purged after NOTE_DELETE_RETENTION_DAYS",
+					"parameters":  idParam,
+					"responses":   withErrors(map[string]interface{}{"200": ok("Deleted note", noteResultSchema)}),
+				},
+			},
+			"/export": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "exportNotes",
+					"summary":     "Export the caller's notes as a zip of markdown files with frontmatter",
+					"parameters": []interface{}{
+						queryParam("from", "Earliest capture date, YYYY-MM-DD or RFC 3339"),
+						queryParam("to", "Latest capture date (inclusive), YYYY-MM-DD or RFC 3339"),
+						queryParam("tag", "Comma-separated tags; every one must be present"),
+						queryParam("delivery", "zip (default) returns the archive; url returns a presigned S3 link to it"),
+					},
+					"responses": withErrors(map[string]interface{}{"200": map[string]interface{}{
+						"description": "The zip, or with delivery=url a link to it",
+						"content": map[string]interface{}{
+							"application/zip":  map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+							"application/json": map[string]interface{}{"schema": exportSchema},
+						},
+					}}),
+				},
+			},
+			"/import": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "importNotes",
+					"summary":     "Import existing markdown notes, skipping ones already stored",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(importReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("What was imported", importSchema)}),
+				},
+			},
+			"/digest": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getDailyDigest",
+					"summary":     "Get the caller's most recent daily digest",
+					"responses":   withErrors(map[string]interface{}{"200": ok("Daily digest", dailyDigestSchema)}),
+				},
+			},
+			"/search": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "searchCaptures",
+					"summary":     "Search the caller's captures by keyword, date range, tag and mode",
+					"parameters": []interface{}{
+						queryParam("q", "Keywords; every one must match"),
+						queryParam("from", "Earliest capture date, YYYY-MM-DD or RFC 3339"),
+						queryParam("to", "Latest capture date (inclusive), YYYY-MM-DD or RFC 3339"),
+						queryParam("tag", "Comma-separated tags; every one must be present"),
+						queryParam("mode", "Only captures made in this mode"),
+						queryParam("limit", "Results per page, 1-50 (default 20)"),
+						queryParam("cursor", "nextCursor from the previous page"),
+					},
+					"responses": withErrors(map[string]interface{}{"200": ok("Matching captures, newest first", searchSchema)}),
+				},
+			},
+			"/selftest": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "runSelfTest",
+					"summary":     "Run a fixed canary request through the pipeline without storing it; 503 when a check fails (admin)",
+					"responses": withErrors(map[string]interface{}{
+						"200": ok("Every check passed", selfTestSchema),
+						"503": ok("At least one check failed", selfTestSchema),
+					}),
+				},
+			},
+			"/tokens/count": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "countTokens",
+					"summary":     "Count a text's tokens for the active model, to warn before sending an oversized transcript",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(tokenCountReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Token count and the limits it's checked against", tokenCountSchema)}),
+				},
+			},
+			"/openapi.json": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getOpenAPISpec",
+					"summary":     "This document",
+					"responses": withErrors(map[string]interface{}{
+						"200": ok("OpenAPI 3 document", map[string]interface{}{"type": "object"}),
+					}),
+				},
+			},
+			"/admin/tokens": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "listTokens",
+					"summary":     "List registered client tokens (admin)",
+					"parameters":  []interface{}{queryParam("cursor", "nextCursor from the previous page")},
+					"responses": withErrors(map[string]interface{}{"200": ok("Registered tokens", map[string]interface{}{
+						"type":     "object",
+						"required": []string{"tokens"},
+						"properties": map[string]interface{}{
+							"tokens":     map[string]interface{}{"type": "array", "items": tokenSchema},
+							"nextCursor": map[string]interface{}{"type": "string", "description": "Pass back as cursor for more tokens; absent on the last page"},
+						},
+					})}),
+				},
+				"post": map[string]interface{}{
+					"operationId": "createToken",
+					"summary":     "Create a scoped client token; name is required (admin)",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(tokenReqSchema)},
+					"responses": withErrors(map[string]interface{}{"201": ok("Token created; the token is shown only once", map[string]interface{}{
+						"type":     "object",
+						"required": []string{"token", "details"},
+						"properties": map[string]interface{}{
+							"token":   map[string]interface{}{"type": "string"},
+							"details": tokenSchema,
+						},
+					})}),
+				},
+			},
+			"/admin/tokens/{id}": map[string]interface{}{
+				"patch": map[string]interface{}{
+					"operationId": "updateToken",
+					"summary":     "Rename or rescope a token (admin)",
+					"parameters":  idParam,
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(tokenReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Updated token", tokenSchema)}),
+				},
+				"delete": map[string]interface{}{
+					"operationId": "revokeToken",
+					"summary":     "Revoke a token (admin)",
+					"parameters":  idParam,
+					"responses":   withErrors(map[string]interface{}{"200": ok("Revoked token", tokenSchema)}),
+				},
+			},
+			"/admin/prompt-variants": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getPromptVariantStats",
+					"summary":     "Request counts and parse-failure and fallback rates per prompt variant (admin)",
+					"responses": withErrors(map[string]interface{}{"200": ok("Prompt variant stats", map[string]interface{}{
+						"type":       "object",
+						"required":   []string{"variants"},
+						"properties": map[string]interface{}{"variants": map[string]interface{}{"type": "array", "items": variantStatsSchema}},
+					})}),
+				},
+			},
+			"/admin/reprocess": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "reprocessCaptures",
+					"summary":     "Replay dead-lettered jobs or pending captures through the pipeline (admin)",
+					"requestBody": map[string]interface{}{"required": true, "content": jsonBody(reprocessReqSchema)},
+					"responses":   withErrors(map[string]interface{}{"200": ok("Outcome of each replayed capture", reprocessSchema)}),
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": r.schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Error envelope; 429 and 503 responses may carry a Retry-After header",
+					"headers": map[string]interface{}{
+						"Retry-After": map[string]interface{}{
+							"description": "Seconds to wait before retrying",
+							"schema":      map[string]interface{}{"type": "integer"},
+						},
+					},
+					"content": jsonBody(map[string]interface{}{"$ref": "#/components/schemas/ErrorEnvelope"}),
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"clientToken": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Client-Token"},
+			},
+		},
+	}
+}
+
+// isOpenAPIRequest reports whether the route is GET /openapi.json
+func isOpenAPIRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return path == "/openapi.json"
+}
+
+// handleOpenAPI serves the OpenAPI document with a server URL for the calling stage
+func handleOpenAPI(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	openAPIOnce.Do(func() { openAPISpec = buildOpenAPISpec() })
+
+	spec := make(map[string]interface{}, len(openAPISpec)+1)
+	for k, v := range openAPISpec {
+		spec[k] = v
+	}
+	if domain := event.RequestContext.DomainName; domain != "" {
+		url := "https://" + domain
+		if stage := event.RequestContext.Stage; stage != "" {
+			url += "/" + stage
+		}
+		spec["servers"] = []interface{}{map[string]interface{}{"url": url}}
+	}
+
+	resp := apiResponse(200, spec)
+	resp.Headers["Cache-Control"] = "private, max-age=3600"
+	return resp
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// specSchema returns a component schema from a spec round-tripped through JSON
+func specSchema(t *testing.T, spec map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	schema, ok := schemas[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("components.schemas.%s missing", name)
+	}
+	return schema
+}
+
+func decodeSpec(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &spec); err != nil {
+		t.Fatalf("Spec is not valid JSON: %v", err)
+	}
+	return spec
+}
+
+func TestBuildOpenAPISpec_Paths(t *testing.T) {
+	body, err := json.Marshal(buildOpenAPISpec())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	spec := decodeSpec(t, string(body))
+
+	want := map[string][]string{
+		"/invoke":                  {"post"},
+		"/v1/invoke":               {"post"},
+		"/v2/invoke":               {"post"},
+		"/jobs/{id}":               {"get"},
+		"/v2/jobs/{id}":            {"get"},
+		"/jobs/{id}/events":        {"get"},
+		"/v2/jobs/{id}/events":     {"get"},
+		"/modes":                   {"get"},
+		"/uploads":                 {"post"},
+		"/vocabulary":              {"get", "put"},
+		"/preferences":             {"get", "put"},
+		"/journal/stats":           {"get"},
+		"/shopping":                {"get"},
+		"/shopping/items/{id}":     {"patch"},
+		"/reminders":               {"get"},
+		"/reminders/{id}":          {"patch"},
+		"/reminders/{id}/complete": {"post"},
+		"/notes/{id}":              {"put", "delete"},
+		"/export":                  {"get"},
+		"/import":                  {"post"},
+		"/digest":                  {"get"},
+		"/search":                  {"get"},
+		"/selftest":                {"post"},
+		"/tokens/count":            {"post"},
+		"/openapi.json":            {"get"},
+		"/admin/tokens":            {"get", "post"},
+		"/admin/tokens/{id}":       {"delete", "patch"},
+		"/admin/prompt-variants":   {"get"},
+		"/admin/reprocess":         {"post"},
+	}
+	paths := spec["paths"].(map[string]interface{})
+	if len(paths) != len(want) {
+		t.Errorf("got %d paths, want %d", len(paths), len(want))
+	}
+	for path, methods := range want {
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			t.Errorf("path %s missing", path)
+			continue
+		}
+		var got []string
+		for method := range item {
+			got = append(got, method)
+		}
+		sort.Strings(got)
+		sort.Strings(methods)
+		if !reflect.DeepEqual(got, methods) {
+			t.Errorf("%s methods = %v, want %v", path, got, methods)
+		}
+	}
+}
+
+// The schemas must list exactly the fields the Go types marshal, so generated clients stay in sync
+func TestBuildOpenAPISpec_SchemasMatchTypes(t *testing.T) {
+	body, _ := json.Marshal(buildOpenAPISpec())
+	spec := decodeSpec(t, string(body))
+
+	tests := []struct {
+		schema string
+		value  interface{}
+	}{
+		{"Req", Req{}},
+		{"Response", Response{Recurrence: new(string), ICSBase64: "x", ICSURL: "x", Email: &EmailDraft{}, ID: "x",
+			Deliveries: []DeliveryResult{{}}, Callback: &DeliveryResult{}, Warnings: []string{"x"}, Summary: "x", Transcript: "x", AudioURL: "x", ShortText: "x", Priority: "x", Journal: &JournalEntry{}, Shopping: &ShoppingCapture{}, Contact: &Contact{}, Translation: &Translation{}, Timer: &Timer{}, Digest: &Digest{}, Answer: &Answer{}, Emoji: "x", Color: "x", Urgency: "x", Sentiment: "x", Language: "x", DueConfidence: new(float64), Alternatives: []string{"x"}, Conflicts: []Conflict{{}}, Duplicate: &DuplicateRef{}, ConversationID: "x", PromptVariant: "x", Debug: &DebugInfo{}, Cached: true, ThinkingTokens: new(int)}},
+		{"ResponseV2", ResponseV2{Warnings: []string{"x"}}},
+		{"ModeInfo", ModeInfo{}},
+		{"AdminToken", AdminToken{ExpiresAt: 1, Tenant: "x", Profile: &DeviceProfile{}}},
+		{"UploadTicket", UploadTicket{}},
+		{"Vocabulary", Vocabulary{UpdatedAt: "x"}},
+		{"Preferences", Preferences{UpdatedAt: "x", Redact: []string{"x"}, TagAliases: map[string]string{"x": "x"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			raw, _ := json.Marshal(tt.value)
+			var fields map[string]interface{}
+			json.Unmarshal(raw, &fields)
+
+			properties := specSchema(t, spec, tt.schema)["properties"].(map[string]interface{})
+			if len(properties) != len(fields) {
+				t.Errorf("schema has %d properties, type marshals %d fields", len(properties), len(fields))
+			}
+			for field := range fields {
+				if _, ok := properties[field]; !ok {
+					t.Errorf("property %s missing from schema", field)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildOpenAPISpec_Details(t *testing.T) {
+	body, _ := json.Marshal(buildOpenAPISpec())
+	spec := decodeSpec(t, string(body))
+
+	req := specSchema(t, spec, "Req")
+	if got := req["required"]; !reflect.DeepEqual(got, []interface{}{"text"}) {
+		t.Errorf("Req required = %v, want [text]", got)
+	}
+	mode := req["properties"].(map[string]interface{})["mode"].(map[string]interface{})
+	if enum, _ := mode["enum"].([]interface{}); len(enum) != len(modes) {
+		t.Errorf("mode enum = %v, want %d modes", mode["enum"], len(modes))
+	}
+
+	resp := specSchema(t, spec, "Response")["properties"].(map[string]interface{})
+	if due := resp["dueISO"].(map[string]interface{}); due["nullable"] != true || due["type"] != "string" {
+		t.Errorf("dueISO = %v, want nullable string", due)
+	}
+	if email := resp["email"].(map[string]interface{}); email["nullable"] != true || email["allOf"] == nil {
+		t.Errorf("email = %v, want nullable allOf $ref", email)
+	}
+
+	job := specSchema(t, spec, "Job")["properties"].(map[string]interface{})
+	if result := job["result"].(map[string]interface{}); len(result) != 0 {
+		t.Errorf("Job.result = %v, want any-JSON schema", result)
+	}
+
+	envelope := specSchema(t, spec, "ErrorEnvelope")["properties"].(map[string]interface{})
+	errRef := envelope["error"].(map[string]interface{})["allOf"].([]interface{})[0]
+	if ref := errRef.(map[string]interface{})["$ref"]; ref != "#/components/schemas/Error" {
+		t.Errorf("ErrorEnvelope.error = %v", ref)
+	}
+	errProps := specSchema(t, spec, "Error")["properties"].(map[string]interface{})
+	for _, field := range []string{"code", "message", "retryable", "requestId", "details"} {
+		if _, ok := errProps[field]; !ok {
+			t.Errorf("Error.%s missing", field)
+		}
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/openapi.json", Path: "/openapi.json"}
+	event.RequestContext.DomainName = "abc123.execute-api.us-east-1.amazonaws.com"
+	event.RequestContext.Stage = "prod"
+
+	resp, err := handler(context.Background(), event)
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("StatusCode = %d, want 200: %s", resp.StatusCode, resp.Body)
+	}
+
+	spec := decodeSpec(t, resp.Body)
+	if spec["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v", spec["openapi"])
+	}
+	servers, _ := spec["servers"].([]interface{})
+	if len(servers) != 1 || servers[0].(map[string]interface{})["url"] != "https://abc123.execute-api.us-east-1.amazonaws.com/prod" {
+		t.Errorf("servers = %v", spec["servers"])
+	}
+
+	post := handleOpenAPI(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST"})
+	if post.StatusCode != 405 {
+		t.Errorf("POST StatusCode = %d, want 405", post.StatusCode)
+	}
+}
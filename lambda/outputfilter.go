@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// Output filter categories a user can turn on with the redact preference
+const (
+	filterSecrets   = "secrets"   // credentials, as scrubbed from log lines
+	filterPhones    = "phones"    // phone numbers
+	filterProfanity = "profanity" // built-in word list plus REDACTION_DENYLIST
+)
+
+var filterCategories = []string{filterSecrets, filterPhones, filterProfanity}
+
+// phonePattern matches 10-digit numbers with an optional country code, with or without
+// separators, e.g. +1 (555) 123-4567; dates and times don't have the 3-3-4 shape
+var phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`)
+
+// defaultProfanity is the built-in word list; REDACTION_DENYLIST adds to it
+var defaultProfanity = []string{"fuck", "fucking", "motherfucker", "shit", "bullshit", "bitch", "asshole", "bastard", "cunt"}
+
+// guardrailAPI is the Bedrock runtime call behind the optional Guardrails output check
+type guardrailAPI interface {
+	ApplyGuardrail(ctx context.Context, params *bedrockruntime.ApplyGuardrailInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ApplyGuardrailOutput, error)
+}
+
+var guardrailClient guardrailAPI
+
+// normalizeRedact validates the redact preference: known categories, lowercased and
+// without repeats
+func normalizeRedact(categories []string) ([]string, error) {
+	var out []string
+	for _, category := range categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !slices.Contains(filterCategories, category) {
+			return nil, fmt.Errorf("invalid redact category: %s (valid: %s)", category, strings.Join(filterCategories, ", "))
+		}
+		if !slices.Contains(out, category) {
+			out = append(out, category)
+		}
+	}
+	return out, nil
+}
+
+// filterOutput removes what the caller's redact preference asks for from the note text
+// (title, markdown, shortText and notes) before it is stored, synced to sinks or sent to
+// the callback. A warning says how much was removed, so missing text isn't a mystery.
+func filterOutput(ctx context.Context, prefs *Preferences, response *Response) {
+	if prefs == nil || len(prefs.Redact) == 0 {
+		return
+	}
+	counts := map[string]int{}
+	filter := func(text string) string {
+		return filterText(text, prefs.Redact, counts)
+	}
+	response.Title = filter(response.Title)
+	response.Markdown = filter(response.Markdown)
+	response.ShortText = filter(response.ShortText)
+	if response.Notes != nil {
+		notes := filter(*response.Notes)
+		response.Notes = &notes
+	}
+	if masked, intervened := guardrailOutputCheck(ctx, response.Markdown); intervened {
+		response.Markdown = masked
+		counts["guardrail"]++
+	}
+
+	if len(counts) == 0 {
+		return
+	}
+	var parts []string
+	for category, n := range counts {
+		parts = append(parts, fmt.Sprintf("%s %d", category, n))
+	}
+	sort.Strings(parts)
+	response.Warnings = append(response.Warnings, "redacted from the note: "+strings.Join(parts, ", "))
+}
+
+// filterText applies the enabled categories to text, counting replacements per category
+func filterText(text string, categories []string, counts map[string]int) string {
+	if text == "" {
+		return text
+	}
+	for _, category := range categories {
+		switch category {
+		case filterSecrets:
+			before := strings.Count(text, redacted)
+			text = redact(text)
+			counts[category] += strings.Count(text, redacted) - before
+		case filterPhones:
+			text = phonePattern.ReplaceAllStringFunc(text, func(string) string {
+				counts[category]++
+				return redacted
+			})
+		case filterProfanity:
+			text = profanityPattern().ReplaceAllStringFunc(text, func(match string) string {
+				counts[category]++
+				// Keep the first letter so the sentence still reads
+				runes := []rune(match)
+				return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+			})
+		}
+	}
+	for category, n := range counts {
+		if n == 0 {
+			delete(counts, category)
+		}
+	}
+	return text
+}
+
+// profanityPattern matches the built-in list and REDACTION_DENYLIST (comma-separated) as
+// whole words, ignoring case
+func profanityPattern() *regexp.Regexp {
+	words := slices.Clone(defaultProfanity)
+	for _, word := range strings.Split(os.Getenv("REDACTION_DENYLIST"), ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)
+}
+
+// guardrailOutputCheck runs text through the Bedrock guardrail in REDACTION_GUARDRAIL_ID
+// (version REDACTION_GUARDRAIL_VERSION, default DRAFT) as model output, returning the
+// guardrail's masked text when it intervened. A failed check is logged and the
+// pattern-filtered text kept.
+func guardrailOutputCheck(ctx context.Context, text string) (string, bool) {
+	id := os.Getenv("REDACTION_GUARDRAIL_ID")
+	if id == "" || guardrailClient == nil || text == "" {
+		return text, false
+	}
+	out, err := guardrailClient.ApplyGuardrail(ctx, &bedrockruntime.ApplyGuardrailInput{
+		GuardrailIdentifier: aws.String(id),
+		GuardrailVersion:    aws.String(getEnv("REDACTION_GUARDRAIL_VERSION", "DRAFT")),
+		Source:              types.GuardrailContentSourceOutput,
+		Content: []types.GuardrailContentBlock{
+			&types.GuardrailContentBlockMemberText{Value: types.GuardrailTextBlock{Text: aws.String(text)}},
+		},
+	})
+	if err != nil {
+		log.Printf("Guardrail output check failed, keeping the pattern-filtered note: %v", err)
+		return text, false
+	}
+	if out.Action != types.GuardrailActionGuardrailIntervened || len(out.Outputs) == 0 {
+		return text, false
+	}
+	masked := make([]string, len(out.Outputs))
+	for i, output := range out.Outputs {
+		masked[i] = aws.ToString(output.Text)
+	}
+	return strings.Join(masked, "\n"), true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Default cache duration for runtime SSM parameters (sink config, integration tokens)
+const defaultParamCacheTTL = 5 * time.Minute
+
+// ssmAPI is the subset of the SSM client used by the handler
+type ssmAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// ParamCache holds SSM parameter values with per-entry expiration
+type ParamCache struct {
+	entries map[string]cachedParam
+	mu      sync.RWMutex
+}
+
+type cachedParam struct {
+	value      string
+	expiration time.Time
+}
+
+var (
+	ssmClient  ssmAPI
+	paramCache = &ParamCache{entries: map[string]cachedParam{}}
+)
+
+// getParameter retrieves a (possibly SecureString) SSM parameter, caching it for
+// defaultParamCacheTTL. On SSM failure a stale cached value is returned if available.
+// SECURITY: Never log parameter values - they hold integration tokens
+func getParameter(ctx context.Context, name string) (string, error) {
+	now := time.Now()
+
+	paramCache.mu.RLock()
+	entry, ok := paramCache.entries[name]
+	paramCache.mu.RUnlock()
+
+	if ok && now.Before(entry.expiration) {
+		return entry.value, nil
+	}
+
+	// Add timeout to prevent indefinite blocking on SSM call
+	ssmCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	output, err := ssmClient.GetParameter(ssmCtx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		if ok && entry.value != "" {
+			log.Printf("SSM GetParameter failed for %s, returning stale cached value: %v", name, err)
+			return entry.value, nil
+		}
+		return "", fmt.Errorf("failed to get SSM parameter %s: %w", name, err)
+	}
+
+	value := strings.TrimSpace(aws.ToString(output.Parameter.Value))
+	if value == "" {
+		return "", fmt.Errorf("SSM parameter %s returned empty value", name)
+	}
+
+	paramCache.mu.Lock()
+	paramCache.entries[name] = cachedParam{value: value, expiration: now.Add(defaultParamCacheTTL)}
+	paramCache.mu.Unlock()
+
+	return value, nil
+}
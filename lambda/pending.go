@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Captures accepted while Bedrock was down wait in their own partition of the history
+// table, oldest first (capture IDs sort by time), until the backlog is drained. Like the
+// global spend counters, the partition can't collide with principals' USER# or TENANT#
+// items.
+const (
+	pendingPK       = "PENDING"
+	pendingSKPrefix = "CAPTURE#"
+)
+
+// Pending captures moved to the job queue per drain
+const pendingDrainBatch = 25
+
+const pendingMessage = "Saved. The assistant is temporarily unavailable, so your capture will be processed when it recovers."
+
+// pendingCapture is a capture waiting for Bedrock to recover; message is the job message
+// the drain sends to the queue
+type pendingCapture struct {
+	PK        string `dynamodbav:"pk"`
+	SK        string `dynamodbav:"sk"`
+	Status    string `dynamodbav:"status"`
+	Message   string `dynamodbav:"message"`
+	CreatedAt string `dynamodbav:"createdAt"`
+	ExpiresAt int64  `dynamodbav:"expiresAt"`
+}
+
+// queueWhenDownEnabled reports whether captures are saved for later while the Bedrock
+// circuit is open (QUEUE_WHEN_DOWN=true). Draining needs the history table and job queue.
+func queueWhenDownEnabled() bool {
+	return strings.EqualFold(getEnv("QUEUE_WHEN_DOWN", "false"), "true") && historyTableName != "" && jobQueueURL != ""
+}
+
+// canQueueWhenDown reports whether a failed request should be saved for later: the
+// Bedrock circuit was open and the request carries no inline image or audio, which
+// can be too large for a table item (uploaded ones are fine)
+func canQueueWhenDown(req *Req, apiErr *apierror.Error) bool {
+	return queueWhenDownEnabled() && isCircuitOpen(apiErr) &&
+		req.ImageBase64 == "" && req.AudioBase64 == "" && !req.dryRun
+}
+
+// isCircuitOpen reports whether a request failed because the Bedrock circuit was open
+func isCircuitOpen(apiErr *apierror.Error) bool {
+	return apiErr.Details["reason"] == "bedrock_circuit_open"
+}
+
+// queuePendingCapture saves a request the model couldn't answer, with a pending job
+// the client can poll, and answers 202 with an apology. If it can't be saved the
+// original error is returned.
+func queuePendingCapture(ctx context.Context, req *Req, apiErr *apierror.Error, id, principal string, version int, now time.Time) events.APIGatewayProxyResponse {
+	msg := jobMessage{
+		JobID:      id,
+		Principal:  principal,
+		APIVersion: version,
+		CreatedAt:  now,
+		Request:    *req,
+		Warnings:   req.warnings,
+		Sinks:      req.sinks,
+	}
+	job := newJob(principal, id, req.Mode, now)
+	job.Status = jobPending
+	if err := savePendingCapture(ctx, msg, job); err != nil {
+		log.Printf("Failed to save pending capture %s: %v", id, err)
+		return errorResponse(ctx, apiErr)
+	}
+
+	log.Printf("Saved capture %s as pending while Bedrock is down", id)
+	return apiResponse(202, JobAccepted{JobID: id, Status: jobPending, StatusURL: jobPath(version, id), Message: pendingMessage})
+}
+
+// savePendingCapture writes the pending capture and its job record together
+func savePendingCapture(ctx context.Context, msg jobMessage, job Job) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job message: %w", err)
+	}
+	pending, err := attributevalue.MarshalMap(pendingCapture{
+		PK:        pendingPK,
+		SK:        pendingSKPrefix + msg.JobID,
+		Status:    jobPending,
+		Message:   string(body),
+		CreatedAt: msg.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: msg.CreatedAt.Add(jobTTL).Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending capture: %w", err)
+	}
+	jobItem, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: aws.String(historyTableName), Item: pending}},
+			{Put: &types.Put{TableName: aws.String(historyTableName), Item: jobItem}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB TransactWriteItems failed: %w", err)
+	}
+	return nil
+}
+
+// PendingDrainSummary reports one run of the pendingCaptures task
+type PendingDrainSummary struct {
+	Queued int `json:"queued"`
+	Failed int `json:"failed"`
+}
+
+// drainPendingCaptures moves up to pendingDrainBatch of the oldest pending captures to
+// the job queue once this instance's Bedrock circuit is closed. Each capture is claimed
+// (pending item deleted, job marked queued) before it is sent, so overlapping drains
+// don't send it twice; a capture whose send fails is saved as pending again.
+func drainPendingCaptures(ctx context.Context) (PendingDrainSummary, error) {
+	var summary PendingDrainSummary
+	if !queueWhenDownEnabled() {
+		return summary, nil
+	}
+	if !bedrockBreaker.closed() {
+		log.Printf("Bedrock circuit still open, leaving pending captures for later")
+		return summary, nil
+	}
+
+	entries, malformed, err := loadPendingCaptures(ctx, pendingDrainBatch)
+	if err != nil {
+		return summary, err
+	}
+	summary.Failed = malformed
+
+	for _, entry := range entries {
+		pending, msg := entry.item, entry.msg
+		if err := claimPendingCapture(ctx, pending, msg); err != nil {
+			log.Printf("Failed to claim pending capture %s: %v", msg.JobID, err)
+			summary.Failed++
+			continue
+		}
+		if err := sendJobMessage(ctx, msg); err != nil {
+			log.Printf("Failed to queue pending capture %s, keeping it pending: %v", msg.JobID, err)
+			repend(ctx, msg)
+			summary.Failed++
+			continue
+		}
+		summary.Queued++
+	}
+	log.Printf("Pending captures: %d queued, %d failed", summary.Queued, summary.Failed)
+	return summary, nil
+}
+
+// pendingEntry is a pending capture with its decoded job message
+type pendingEntry struct {
+	item pendingCapture
+	msg  jobMessage
+}
+
+// loadPendingCaptures reads up to limit of the oldest pending captures, skipping (and
+// counting) any that can't be decoded
+func loadPendingCaptures(ctx context.Context, limit int) ([]pendingEntry, int, error) {
+	out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(historyTableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":     &types.AttributeValueMemberS{Value: pendingPK},
+			":prefix": &types.AttributeValueMemberS{Value: pendingSKPrefix},
+		},
+		Limit: aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("DynamoDB Query failed: %w", err)
+	}
+
+	var entries []pendingEntry
+	malformed := 0
+	for _, item := range out.Items {
+		var entry pendingEntry
+		if err := attributevalue.UnmarshalMap(item, &entry.item); err != nil || json.Unmarshal([]byte(entry.item.Message), &entry.msg) != nil {
+			log.Printf("Skipping malformed pending capture %s", entry.item.SK)
+			malformed++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, malformed, nil
+}
+
+// claimPendingCapture deletes a pending capture, failing if another drain got there
+// first, and marks its job queued
+func claimPendingCapture(ctx context.Context, pending pendingCapture, msg jobMessage) error {
+	job := newJob(msg.Principal, msg.JobID, msg.Request.Mode, msg.CreatedAt)
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	jobItem, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName: aws.String(historyTableName),
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: pending.PK},
+					"sk": &types.AttributeValueMemberS{Value: pending.SK},
+				},
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			}},
+			{Put: &types.Put{TableName: aws.String(historyTableName), Item: jobItem}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB TransactWriteItems failed: %w", err)
+	}
+	return nil
+}
+
+// repend saves a capture as pending again, e.g. when the job worker's last attempt
+// found the Bedrock circuit still open
+func repend(ctx context.Context, msg jobMessage) bool {
+	job := newJob(msg.Principal, msg.JobID, msg.Request.Mode, msg.CreatedAt)
+	job.Status = jobPending
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := savePendingCapture(ctx, msg, job); err != nil {
+		log.Printf("Failed to save capture %s as pending again: %v", msg.JobID, err)
+		return false
+	}
+	return true
+}
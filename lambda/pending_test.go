@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// openBreaker swaps in a Bedrock breaker that is open for the test
+func openBreaker(t *testing.T) {
+	t.Helper()
+	cb := &CircuitBreaker{}
+	tripBreaker(cb, time.Now())
+	useBreaker(t, cb)
+}
+
+// pendingItem builds a pending capture item as savePendingCapture stores it
+func pendingItem(t *testing.T, id string) map[string]interface{} {
+	t.Helper()
+	body, _ := json.Marshal(jobMessage{
+		JobID:      id,
+		Principal:  "user-1",
+		APIVersion: 1,
+		CreatedAt:  time.Now().UTC(),
+		Request:    Req{Text: "buy milk", Mode: "reminder", MaxTokens: 800},
+	})
+	return map[string]interface{}{"pk": pendingPK, "sk": pendingSKPrefix + id, "status": jobPending, "message": string(body)}
+}
+
+func TestHandler_QueueWhenDown(t *testing.T) {
+	t.Run("saved as pending", func(t *testing.T) {
+		t.Setenv("QUEUE_WHEN_DOWN", "true")
+		db := &fakeDynamo{}
+		useJobQueue(t, &fakeSQS{}, db)
+		openBreaker(t)
+
+		resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"buy milk","mode":"reminder"}`))
+		if resp.StatusCode != 202 {
+			t.Fatalf("StatusCode = %d, want 202: %s", resp.StatusCode, resp.Body)
+		}
+		var accepted JobAccepted
+		json.Unmarshal([]byte(resp.Body), &accepted)
+		if accepted.Status != jobPending || accepted.StatusURL != "/jobs/"+accepted.JobID || accepted.Message == "" {
+			t.Errorf("accepted = %+v", accepted)
+		}
+
+		// The last transaction writes the pending capture and its job (earlier ones reserve quota)
+		save := db.transactions[len(db.transactions)-1].TransactItems
+		if len(save) != 2 || save[0].Put == nil || save[1].Put == nil {
+			t.Fatalf("transaction = %v, want the pending capture and its job", save)
+		}
+		var pending pendingCapture
+		var job Job
+		attributevalue.UnmarshalMap(save[0].Put.Item, &pending)
+		attributevalue.UnmarshalMap(save[1].Put.Item, &job)
+		if pending.PK != pendingPK || pending.SK != pendingSKPrefix+accepted.JobID || pending.Status != jobPending {
+			t.Errorf("pending capture = %+v", pending)
+		}
+		var msg jobMessage
+		json.Unmarshal([]byte(pending.Message), &msg)
+		if msg.Principal != "user-1" || msg.Request.Text != "buy milk" || msg.Request.Mode != "reminder" {
+			t.Errorf("pending message = %+v", msg)
+		}
+		if job.ID != accepted.JobID || job.Status != jobPending {
+			t.Errorf("job = %+v", job)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		useJobQueue(t, &fakeSQS{}, &fakeDynamo{})
+		openBreaker(t)
+
+		resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"buy milk","mode":"reminder"}`))
+		if resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Run("save fails", func(t *testing.T) {
+		t.Setenv("QUEUE_WHEN_DOWN", "true")
+		useJobQueue(t, &fakeSQS{}, &fakeDynamo{err: errors.New("table down")})
+		openBreaker(t)
+
+		resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"buy milk","mode":"reminder"}`))
+		if resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+}
+
+func TestDrainPendingCaptures(t *testing.T) {
+	t.Setenv("QUEUE_WHEN_DOWN", "true")
+
+	t.Run("queues the backlog", func(t *testing.T) {
+		queue := &fakeSQS{}
+		db := &fakeDynamo{items: []map[string]interface{}{pendingItem(t, "20250301T120000Z-aaaa"), pendingItem(t, "20250301T120100Z-bbbb")}}
+		useJobQueue(t, queue, db)
+		useBreaker(t, &CircuitBreaker{})
+
+		summary, err := drainPendingCaptures(context.Background())
+		if err != nil || summary.Queued != 2 || summary.Failed != 0 {
+			t.Fatalf("summary = %+v, err %v", summary, err)
+		}
+		var first jobMessage
+		json.Unmarshal([]byte(queue.bodies[0]), &first)
+		if len(queue.bodies) != 2 || first.JobID != "20250301T120000Z-aaaa" {
+			t.Errorf("queued %d messages, oldest first = %s", len(queue.bodies), first.JobID)
+		}
+		// Each capture is claimed: the pending item deleted and the job marked queued
+		claim := db.transactions[0].TransactItems
+		var job Job
+		attributevalue.UnmarshalMap(claim[1].Put.Item, &job)
+		if claim[0].Delete == nil || job.Status != jobQueued {
+			t.Errorf("claim = %+v, job %+v", claim, job)
+		}
+	})
+
+	t.Run("circuit still open", func(t *testing.T) {
+		queue := &fakeSQS{}
+		useJobQueue(t, queue, &fakeDynamo{items: []map[string]interface{}{pendingItem(t, "20250301T120000Z-aaaa")}})
+		openBreaker(t)
+
+		if summary, _ := drainPendingCaptures(context.Background()); summary.Queued != 0 || len(queue.bodies) != 0 {
+			t.Errorf("summary = %+v with %d messages", summary, len(queue.bodies))
+		}
+	})
+
+	t.Run("send fails", func(t *testing.T) {
+		db := &fakeDynamo{items: []map[string]interface{}{pendingItem(t, "20250301T120000Z-aaaa")}}
+		useJobQueue(t, &fakeSQS{err: errors.New("queue down")}, db)
+		useBreaker(t, &CircuitBreaker{})
+
+		summary, _ := drainPendingCaptures(context.Background())
+		if summary.Failed != 1 || len(db.transactions) != 2 || db.transactions[1].TransactItems[0].Put == nil {
+			t.Errorf("summary = %+v, transactions %v; want the capture saved as pending again", summary, db.transactions)
+		}
+	})
+}
+
+func TestHandleJobQueue_RependsWhenDown(t *testing.T) {
+	t.Setenv("QUEUE_WHEN_DOWN", "true")
+	db := &fakeDynamo{}
+	useJobQueue(t, &fakeSQS{}, db)
+	openBreaker(t)
+
+	body, _ := json.Marshal(jobMessage{JobID: "job-1", Principal: "user-1", APIVersion: 1, CreatedAt: time.Now().UTC(), Request: Req{Text: "hi", Mode: "note", MaxTokens: 800}})
+	record := events.SQSMessage{MessageId: "msg-3", Body: string(body), Attributes: map[string]string{"ApproximateReceiveCount": "3"}}
+	resp, _ := handleJobQueue(context.Background(), events.SQSEvent{Records: []events.SQSMessage{record}})
+	if len(resp.BatchItemFailures) != 0 {
+		t.Errorf("last attempt should not be redelivered")
+	}
+	if len(db.transactions) != 1 {
+		t.Fatalf("transactions = %v, want the job saved as pending", db.transactions)
+	}
+	var job Job
+	attributevalue.UnmarshalMap(db.transactions[0].TransactItems[1].Put.Item, &job)
+	if job.Status != jobPending {
+		t.Errorf("job status = %s, want pending", job.Status)
+	}
+}
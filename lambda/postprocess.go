@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Transformer rewrites a processed Response before it is stored, synced to sinks or
+// returned. The transformers configured for a mode run in order, each seeing the
+// previous one's output.
+type Transformer interface {
+	Name() string
+	Transform(meta captureMeta, resp *Response) error
+}
+
+// TransformerSpec configures one transformer, e.g. {"type": "tags", "map": {"todo": "tasks"}}
+type TransformerSpec struct {
+	Type        string            `json:"type"`
+	Map         map[string]string `json:"map,omitempty"`         // tags: tag -> replacement ("" drops the tag)
+	Fields      []string          `json:"fields,omitempty"`      // replace: fields to rewrite, defaults to markdown
+	Pattern     string            `json:"pattern,omitempty"`     // replace: RE2 regular expression
+	Replacement string            `json:"replacement,omitempty"` // replace: replacement, with $1-style group references
+	Template    string            `json:"template,omitempty"`    // footer: text/template appended to the markdown
+	Bullet      string            `json:"bullet,omitempty"`      // markdown: list marker, defaults to -
+	HeadingBase int               `json:"headingBase,omitempty"` // markdown: level of the top heading (unset = as written)
+}
+
+// PostProcessConfig maps a mode (or "*" for every mode) to its transformers, e.g.
+// {"*": [{"type": "markdown"}], "note": [{"type": "markdown"}, {"type": "footer", "template": "..."}]}
+type PostProcessConfig map[string][]TransformerSpec
+
+// transformerFactories builds transformers by type; a factory returns an error for an
+// invalid spec
+var transformerFactories = map[string]func(TransformerSpec) (Transformer, error){
+	"markdown": newMarkdownTransformer,
+	"tags":     newTagMapTransformer,
+	"replace":  newReplaceTransformer,
+	"footer":   newFooterTransformer,
+}
+
+// replaceableFields are the Response text fields a replace transformer can rewrite
+var replaceableFields = map[string]func(*Response) *string{
+	"title":     func(r *Response) *string { return &r.Title },
+	"markdown":  func(r *Response) *string { return &r.Markdown },
+	"shortText": func(r *Response) *string { return &r.ShortText },
+	"notes":     func(r *Response) *string { return r.Notes },
+}
+
+// postProcessPipelines caches the transformers built from the last config seen, so
+// regular expressions and templates are compiled once per config change
+var postProcessPipelines struct {
+	mu        sync.Mutex
+	raw       string
+	pipelines map[string][]Transformer
+}
+
+// loadPostProcessConfig reads the post-processing config from the SSM parameter named
+// by POSTPROCESS_PARAM_NAME, falling back to the POSTPROCESS environment variable
+func loadPostProcessConfig(ctx context.Context) (string, error) {
+	raw := os.Getenv("POSTPROCESS")
+	if paramName := os.Getenv("POSTPROCESS_PARAM_NAME"); paramName != "" {
+		value, err := getParameter(ctx, paramName)
+		if err != nil {
+			return "", err
+		}
+		raw = value
+	}
+	return raw, nil
+}
+
+// buildPostProcessPipelines builds every mode's transformers, failing on the first
+// unknown type or invalid spec
+func buildPostProcessPipelines(raw string) (map[string][]Transformer, error) {
+	var cfg PostProcessConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid post-processing config: %w", err)
+	}
+	pipelines := make(map[string][]Transformer, len(cfg))
+	for mode, specs := range cfg {
+		for i, spec := range specs {
+			factory, ok := transformerFactories[spec.Type]
+			if !ok {
+				return nil, fmt.Errorf("post-processing %s[%d]: unknown transformer type %q", mode, i, spec.Type)
+			}
+			transformer, err := factory(spec)
+			if err != nil {
+				return nil, fmt.Errorf("post-processing %s[%d]: %w", mode, i, err)
+			}
+			pipelines[mode] = append(pipelines[mode], transformer)
+		}
+	}
+	return pipelines, nil
+}
+
+// transformersFor returns the transformers configured for a mode; mode-specific entries
+// override "*"
+func transformersFor(ctx context.Context, mode string) ([]Transformer, error) {
+	raw, err := loadPostProcessConfig(ctx)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+
+	postProcessPipelines.mu.Lock()
+	defer postProcessPipelines.mu.Unlock()
+	if raw != postProcessPipelines.raw || postProcessPipelines.pipelines == nil {
+		pipelines, err := buildPostProcessPipelines(raw)
+		if err != nil {
+			return nil, err
+		}
+		postProcessPipelines.raw, postProcessPipelines.pipelines = raw, pipelines
+	}
+	if transformers, ok := postProcessPipelines.pipelines[mode]; ok {
+		return transformers, nil
+	}
+	return postProcessPipelines.pipelines["*"], nil
+}
+
+// postProcess runs the mode's transformers over a response. Post-processing never fails
+// the request: an unavailable config or a failing transformer is logged and reported as
+// a warning, and the response keeps the changes made before it.
+func postProcess(ctx context.Context, meta captureMeta, resp *Response) {
+	transformers, err := transformersFor(ctx, meta.Mode)
+	if err != nil {
+		log.Printf("Failed to load post-processing config: %v", err)
+		resp.Warnings = append(resp.Warnings, "post-processing skipped: configuration unavailable")
+		return
+	}
+	for _, transformer := range transformers {
+		if err := transformer.Transform(meta, resp); err != nil {
+			log.Printf("Post-processing %s failed: %v", transformer.Name(), err)
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("post-processing %s skipped: %v", transformer.Name(), err))
+		}
+	}
+}
+
+// tagMapTransformer renames tags through a map matched on their canonical form (see
+// canonicalTag), dropping those mapped to "" and repeats the renaming creates
+type tagMapTransformer struct {
+	mapping map[string]string
+}
+
+func newTagMapTransformer(spec TransformerSpec) (Transformer, error) {
+	if len(spec.Map) == 0 {
+		return nil, fmt.Errorf("tags transformer needs a map")
+	}
+	mapping := make(map[string]string, len(spec.Map))
+	for from, to := range spec.Map {
+		key := canonicalTag(from)
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag %q in map", from)
+		}
+		mapping[key] = strings.TrimSpace(to)
+	}
+	return tagMapTransformer{mapping: mapping}, nil
+}
+
+func (tagMapTransformer) Name() string { return "tags" }
+
+func (t tagMapTransformer) Transform(_ captureMeta, resp *Response) error {
+	if len(resp.Tags) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, tag := range resp.Tags {
+		if mapped, ok := t.mapping[canonicalTag(tag)]; ok {
+			tag = mapped
+		}
+		key := canonicalTag(tag)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	resp.Tags = tags
+	return nil
+}
+
+// replaceTransformer rewrites regular expression matches in text fields
+type replaceTransformer struct {
+	pattern     *regexp.Regexp
+	replacement string
+	fields      []string
+}
+
+func newReplaceTransformer(spec TransformerSpec) (Transformer, error) {
+	if spec.Pattern == "" {
+		return nil, fmt.Errorf("replace transformer needs a pattern")
+	}
+	pattern, err := regexp.Compile(spec.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	fields := spec.Fields
+	if len(fields) == 0 {
+		fields = []string{"markdown"}
+	}
+	for _, field := range fields {
+		if _, ok := replaceableFields[field]; !ok {
+			return nil, fmt.Errorf("invalid field %q (valid: title, markdown, shortText, notes)", field)
+		}
+	}
+	return replaceTransformer{pattern: pattern, replacement: spec.Replacement, fields: fields}, nil
+}
+
+func (replaceTransformer) Name() string { return "replace" }
+
+func (t replaceTransformer) Transform(_ captureMeta, resp *Response) error {
+	for _, field := range t.fields {
+		if value := replaceableFields[field](resp); value != nil {
+			*value = t.pattern.ReplaceAllString(*value, t.replacement)
+		}
+	}
+	return nil
+}
+
+// footerData is what a footer template can use, e.g. "Captured {{.Created.Format \"Jan 2\"}} via {{.Mode}}"
+type footerData struct {
+	ID      string
+	Mode    string
+	Action  string
+	Title   string
+	Tags    []string
+	Created time.Time
+}
+
+// footerTransformer appends a rendered template to the markdown, after a blank line
+type footerTransformer struct {
+	template *template.Template
+}
+
+func newFooterTransformer(spec TransformerSpec) (Transformer, error) {
+	if strings.TrimSpace(spec.Template) == "" {
+		return nil, fmt.Errorf("footer transformer needs a template")
+	}
+	tmpl, err := template.New("footer").Parse(spec.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return footerTransformer{template: tmpl}, nil
+}
+
+func (footerTransformer) Name() string { return "footer" }
+
+func (t footerTransformer) Transform(meta captureMeta, resp *Response) error {
+	var footer strings.Builder
+	err := t.template.Execute(&footer, footerData{
+		ID:      resp.ID,
+		Mode:    meta.Mode,
+		Action:  resp.Action,
+		Title:   resp.Title,
+		Tags:    resp.Tags,
+		Created: meta.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("footer template failed: %w", err)
+	}
+	if text := strings.TrimSpace(footer.String()); text != "" {
+		resp.Markdown = strings.TrimRight(resp.Markdown, "\n") + "\n\n" + text
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostProcess_Pipeline(t *testing.T) {
+	t.Setenv("POSTPROCESS_PARAM_NAME", "")
+	t.Setenv("POSTPROCESS", `{
+		"*": [{"type": "markdown"}],
+		"note": [
+			{"type": "markdown"},
+			{"type": "tags", "map": {"To-Do": "tasks", "misc": ""}},
+			{"type": "replace", "fields": ["title", "markdown"], "pattern": "(?i)\\bASAP\\b", "replacement": "soon"},
+			{"type": "footer", "template": "_{{.Mode}} {{.ID}}, {{.Created.Format \"Jan 2\"}}_"}
+		]
+	}`)
+	meta := captureMeta{ID: "cap-1", Mode: "note", CreatedAt: time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)}
+	resp := &Response{
+		Title:    "Call the bank asap",
+		Markdown: "Call the bank ASAP  \r\n\r\n\r\n\r\n- ask about fees\n\n",
+		Tags:     []string{"todo", "Tasks", "misc", "bank"},
+		ID:       "cap-1",
+	}
+
+	postProcess(context.Background(), meta, resp)
+	if resp.Title != "Call the bank soon" {
+		t.Errorf("Title = %q", resp.Title)
+	}
+	if want := "Call the bank soon\n\n- ask about fees\n\n_note cap-1, Mar 3_"; resp.Markdown != want {
+		t.Errorf("Markdown = %q, want %q", resp.Markdown, want)
+	}
+	if strings.Join(resp.Tags, ",") != "tasks,bank" {
+		t.Errorf("Tags = %v, want [tasks bank]", resp.Tags)
+	}
+	if len(resp.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", resp.Warnings)
+	}
+
+	// Other modes fall back to "*"
+	resp = &Response{Markdown: "a  \n\n\n\nb", Title: "asap"}
+	postProcess(context.Background(), captureMeta{Mode: "reminder"}, resp)
+	if resp.Markdown != "a\n\nb" || resp.Title != "asap" {
+		t.Errorf("reminder response = %+v", resp)
+	}
+}
+
+func TestPostProcess_FromSSM(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/postprocess": `{"*":[{"type":"footer","template":"via SSM"}]}`}})
+	t.Setenv("POSTPROCESS", `{"*":[{"type":"footer","template":"via env"}]}`)
+	t.Setenv("POSTPROCESS_PARAM_NAME", "/wrist-agent/postprocess")
+
+	resp := &Response{Markdown: "Hello"}
+	postProcess(context.Background(), captureMeta{Mode: "note"}, resp)
+	if resp.Markdown != "Hello\n\nvia SSM" {
+		t.Errorf("Markdown = %q, want the SSM footer", resp.Markdown)
+	}
+}
+
+func TestPostProcess_Unconfigured(t *testing.T) {
+	t.Setenv("POSTPROCESS_PARAM_NAME", "")
+	t.Setenv("POSTPROCESS", "")
+
+	resp := &Response{Markdown: "untouched  \n\n\n"}
+	postProcess(context.Background(), captureMeta{Mode: "note"}, resp)
+	if resp.Markdown != "untouched  \n\n\n" || len(resp.Warnings) != 0 {
+		t.Errorf("Unconfigured post-processing changed the response: %+v", resp)
+	}
+}
+
+func TestPostProcess_Errors(t *testing.T) {
+	t.Setenv("POSTPROCESS_PARAM_NAME", "")
+	t.Setenv("POSTPROCESS", `{"*":[{"type":"footer","template":"{{.Missing}}"},{"type":"footer","template":"ok"}]}`)
+
+	resp := &Response{Markdown: "Hello"}
+	postProcess(context.Background(), captureMeta{Mode: "note"}, resp)
+	if resp.Markdown != "Hello\n\nok" {
+		t.Errorf("Markdown = %q, want the later transformers to still run", resp.Markdown)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "footer") {
+		t.Errorf("Warnings = %v, want one for the failed footer", resp.Warnings)
+	}
+
+	t.Setenv("POSTPROCESS", `{"*":[{"type":"uppercase"}]}`)
+	resp = &Response{Markdown: "Hello"}
+	postProcess(context.Background(), captureMeta{Mode: "note"}, resp)
+	if resp.Markdown != "Hello" || len(resp.Warnings) != 1 {
+		t.Errorf("Invalid config: response = %+v, want it untouched with a warning", resp)
+	}
+}
+
+func TestBuildPostProcessPipelines_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":      `[`,
+		"unknown type":  `{"*":[{"type":"nope"}]}`,
+		"empty map":     `{"*":[{"type":"tags"}]}`,
+		"bad pattern":   `{"*":[{"type":"replace","pattern":"("}]}`,
+		"bad field":     `{"*":[{"type":"replace","pattern":"x","fields":["emoji"]}]}`,
+		"empty footer":  `{"*":[{"type":"footer","template":"  "}]}`,
+		"bad template":  `{"*":[{"type":"footer","template":"{{.ID"}]}`,
+		"no pattern":    `{"*":[{"type":"replace"}]}`,
+		"blank tag key": `{"*":[{"type":"tags","map":{"--":"x"}}]}`,
+	}
+	for name, raw := range tests {
+		if _, err := buildPostProcessPipelines(raw); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
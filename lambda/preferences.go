@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key of a principal's preferences in the history table
+const preferencesSK = "PREFERENCES"
+
+// Preference field caps; name and list app are added to every prompt
+const (
+	maxPreferenceNameRunes    = 64
+	maxPreferenceListAppRunes = 40
+)
+
+// verbosityPrompts are the instructions for each verbosity; normal adds none
+var verbosityPrompts = map[string]string{
+	"brief":    "Keep the markdown short: a title and a few lines at most.",
+	"normal":   "",
+	"detailed": "Be thorough in the markdown: include context, steps and details the user mentioned.",
+}
+
+// Preferences is a principal's profile, added to the system prompt of every request
+type Preferences struct {
+	PK          string            `dynamodbav:"pk" json:"-"`
+	SK          string            `dynamodbav:"sk" json:"-"`
+	Name        string            `dynamodbav:"name,omitempty" json:"name"`                       // what the assistant calls the user
+	Timezone    string            `dynamodbav:"timezone,omitempty" json:"timezone"`               // IANA zone times without an offset are read in
+	DefaultMode string            `dynamodbav:"defaultMode,omitempty" json:"defaultMode"`         // mode for requests that don't set one
+	ListApp     string            `dynamodbav:"listApp,omitempty" json:"listApp"`                 // where the user keeps lists and tasks, e.g. Todoist
+	Verbosity   string            `dynamodbav:"verbosity,omitempty" json:"verbosity"`             // brief|normal|detailed
+	Redact      []string          `dynamodbav:"redact,omitempty" json:"redact,omitempty"`         // secrets|phones|profanity removed from stored and synced notes
+	TagAliases  map[string]string `dynamodbav:"tagAliases,omitempty" json:"tagAliases,omitempty"` // tag -> replacement applied to every capture's tags
+	UpdatedAt   string            `dynamodbav:"updatedAt" json:"updatedAt,omitempty"`
+}
+
+// preferencesRequest is the body of PUT /preferences
+type preferencesRequest struct {
+	Name        string            `json:"name"`
+	Timezone    string            `json:"timezone"`
+	DefaultMode string            `json:"defaultMode"`
+	ListApp     string            `json:"listApp"`
+	Verbosity   string            `json:"verbosity"`
+	Redact      []string          `json:"redact"`
+	TagAliases  map[string]string `json:"tagAliases"`
+}
+
+// normalizePreferences trims the fields to single lines and validates them
+func normalizePreferences(body preferencesRequest) (Preferences, error) {
+	prefs := Preferences{
+		Name:        strings.Join(strings.Fields(body.Name), " "),
+		Timezone:    strings.TrimSpace(body.Timezone),
+		DefaultMode: strings.ToLower(strings.TrimSpace(body.DefaultMode)),
+		ListApp:     strings.Join(strings.Fields(body.ListApp), " "),
+		Verbosity:   strings.ToLower(strings.TrimSpace(body.Verbosity)),
+	}
+	if utf8.RuneCountInString(prefs.Name) > maxPreferenceNameRunes {
+		return Preferences{}, fmt.Errorf("name cannot exceed %d characters", maxPreferenceNameRunes)
+	}
+	if prefs.Timezone != "" {
+		if _, err := time.LoadLocation(prefs.Timezone); err != nil || prefs.Timezone == "Local" {
+			return Preferences{}, fmt.Errorf("timezone must be an IANA time zone, e.g. Europe/Lisbon")
+		}
+	}
+	if prefs.DefaultMode != "" {
+		if _, ok := lookupMode(prefs.DefaultMode); !ok {
+			return Preferences{}, fmt.Errorf("invalid defaultMode: %s (valid: %s)", prefs.DefaultMode, strings.Join(modeNames(), ", "))
+		}
+	}
+	if utf8.RuneCountInString(prefs.ListApp) > maxPreferenceListAppRunes {
+		return Preferences{}, fmt.Errorf("listApp cannot exceed %d characters", maxPreferenceListAppRunes)
+	}
+	if _, ok := verbosityPrompts[prefs.Verbosity]; !ok && prefs.Verbosity != "" {
+		return Preferences{}, fmt.Errorf("verbosity must be brief, normal or detailed")
+	}
+	categories, err := normalizeRedact(body.Redact)
+	if err != nil {
+		return Preferences{}, err
+	}
+	prefs.Redact = categories
+	aliases, err := normalizeTagAliases(body.TagAliases)
+	if err != nil {
+		return Preferences{}, err
+	}
+	prefs.TagAliases = aliases
+	return prefs, nil
+}
+
+// loadPreferences reads a principal's preferences, returning empty ones when none are stored
+func loadPreferences(ctx context.Context, principal string) (Preferences, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+			"sk": &types.AttributeValueMemberS{Value: preferencesSK},
+		},
+	})
+	if err != nil {
+		return Preferences{}, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	var prefs Preferences
+	if len(out.Item) == 0 {
+		return prefs, nil
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &prefs); err != nil {
+		return Preferences{}, fmt.Errorf("failed to unmarshal preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// savePreferences replaces a principal's preferences
+func savePreferences(ctx context.Context, principal string, prefs Preferences, now time.Time) (Preferences, error) {
+	prefs.PK = historyPK(principal)
+	prefs.SK = preferencesSK
+	prefs.UpdatedAt = now.UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(prefs)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return Preferences{}, fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return prefs, nil
+}
+
+// requestPreferences loads the caller's preferences for a request once, applying their
+// default mode when the request has none. Storage errors are logged and skipped - the
+// request is answered with the server defaults.
+func requestPreferences(ctx context.Context, req *Req, principal string) {
+	if historyTableName == "" || req.preferences != nil {
+		return
+	}
+	prefs, err := loadPreferences(ctx, principal)
+	if err != nil {
+		log.Printf("Failed to load preferences, continuing without them: %v", err)
+	}
+	req.preferences = &prefs
+	if req.Mode == "" && prefs.DefaultMode != "" {
+		req.Mode = prefs.DefaultMode
+	}
+}
+
+// preferencesPrompt is the system prompt section describing the user
+func preferencesPrompt(prefs *Preferences, now time.Time) string {
+	if prefs == nil {
+		return ""
+	}
+	var lines []string
+	if prefs.Name != "" {
+		lines = append(lines, "- The user's name is "+prefs.Name+".")
+	}
+	if loc, err := time.LoadLocation(prefs.Timezone); err == nil && prefs.Timezone != "" {
+		local := now.In(loc)
+		lines = append(lines, fmt.Sprintf("- The user lives in the %s time zone, where it is now %s (%s). Read times without a zone as %s times.",
+			prefs.Timezone, local.Format("2006-01-02T15:04:05-07:00"), local.Weekday(), prefs.Timezone))
+	}
+	if prefs.ListApp != "" {
+		lines = append(lines, "- The user keeps lists and tasks in "+prefs.ListApp+".")
+	}
+	if instruction := verbosityPrompts[prefs.Verbosity]; instruction != "" {
+		lines = append(lines, "- "+instruction)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\nAbout the user:\n" + strings.Join(lines, "\n")
+}
+
+// isPreferencesRequest reports whether the route is /preferences
+func isPreferencesRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/preferences"
+}
+
+// handlePreferences serves GET /preferences and PUT /preferences (replace them; omitted
+// fields are cleared) for the caller's own profile
+func handlePreferences(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" && event.HTTPMethod != "PUT" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("preferences storage not configured"))
+	}
+	principal := principalFromEvent(event)
+
+	if event.HTTPMethod == "GET" {
+		prefs, err := loadPreferences(ctx, principal)
+		if err != nil {
+			log.Printf("Failed to load preferences: %v", err)
+			return errorResponse(ctx, apierror.Internal("Failed to load preferences"))
+		}
+		return apiResponse(200, prefs)
+	}
+
+	var body preferencesRequest
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	prefs, err := normalizePreferences(body)
+	if err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+	}
+
+	prefs, err = savePreferences(ctx, principal, prefs, time.Now())
+	if err != nil {
+		log.Printf("Failed to save preferences: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to save preferences"))
+	}
+	return apiResponse(200, prefs)
+}
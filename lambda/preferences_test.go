@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNormalizePreferences(t *testing.T) {
+	got, err := normalizePreferences(preferencesRequest{Name: "  Siobhán\nMurphy ", Timezone: "Europe/Lisbon", DefaultMode: " Reminder", ListApp: "Todoist", Verbosity: "Brief", Redact: []string{"Phones", "secrets", "phones"}, TagAliases: map[string]string{"To-Do": "Tasks", "misc": ""}})
+	if err != nil {
+		t.Fatalf("normalizePreferences() error = %v", err)
+	}
+	if got.Name != "Siobhán Murphy" || got.DefaultMode != "reminder" || got.Verbosity != "brief" || !reflect.DeepEqual(got.Redact, []string{"phones", "secrets"}) ||
+		!reflect.DeepEqual(got.TagAliases, map[string]string{"todo": "tasks", "misc": ""}) {
+		t.Errorf("normalizePreferences() = %+v", got)
+	}
+
+	for _, body := range []preferencesRequest{
+		{Timezone: "Mars/Olympus"},
+		{Timezone: "Local"},
+		{DefaultMode: "chat"},
+		{Verbosity: "chatty"},
+		{Redact: []string{"emails"}},
+		{Name: strings.Repeat("x", maxPreferenceNameRunes+1)},
+		{ListApp: strings.Repeat("x", maxPreferenceListAppRunes+1)},
+		{TagAliases: map[string]string{"!!": "work"}},
+		{TagAliases: map[string]string{"work": "??"}},
+	} {
+		if _, err := normalizePreferences(body); err == nil {
+			t.Errorf("normalizePreferences(%+v) should fail", body)
+		}
+	}
+}
+
+func TestPreferencesPrompt(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	if got := preferencesPrompt(nil, now); got != "" {
+		t.Errorf("no preferences: %q", got)
+	}
+	if got := preferencesPrompt(&Preferences{DefaultMode: "note", Verbosity: "normal"}, now); got != "" {
+		t.Errorf("nothing to say: %q", got)
+	}
+	got := preferencesPrompt(&Preferences{Name: "Sam", Timezone: "Europe/Lisbon", ListApp: "Things", Verbosity: "brief"}, now)
+	for _, want := range []string{"name is Sam", "it is now 2025-07-01T13:00:00+01:00 (Tuesday)", "Read times without a zone as Europe/Lisbon times", "lists and tasks in Things", "Keep the markdown short"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRequestPreferences(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("default mode", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		savePreferences(ctx, "user-1", Preferences{DefaultMode: "reminder"}, time.Now())
+
+		req := &Req{}
+		requestPreferences(ctx, req, "user-1")
+		if req.Mode != "reminder" || req.preferences == nil {
+			t.Errorf("req = %+v", req)
+		}
+		req = &Req{Mode: "event"}
+		requestPreferences(ctx, req, "user-1")
+		if req.Mode != "event" {
+			t.Errorf("explicit mode replaced: %s", req.Mode)
+		}
+	})
+
+	t.Run("storage errors are skipped", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{err: errors.New("table down")})
+		req := &Req{}
+		requestPreferences(ctx, req, "user-1")
+		if req.Mode != "" || req.preferences == nil || !reflect.DeepEqual(*req.preferences, Preferences{}) {
+			t.Errorf("req = %+v", req)
+		}
+	})
+}
+
+func TestPreferences_LoadedOncePerRequest(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	bedrock := &fakeBedrock{text: `{"action":"reminder","title":"Buy milk","markdown":"Buy milk"}`}
+	useFakeBedrock(t, bedrock)
+	savePreferences(ctx, "user-1", Preferences{Name: "Ada", DefaultMode: "reminder"}, time.Now())
+
+	reads := func() int {
+		n := 0
+		for _, sk := range db.gets {
+			if sk == preferencesSK {
+				n++
+			}
+		}
+		return n
+	}
+
+	event := asyncEvent("/", `{"text":"buy milk"}`)
+	if resp, _ := handler(ctx, event); resp.StatusCode != 200 {
+		t.Fatalf("StatusCode = %d: %s", resp.StatusCode, resp.Body)
+	}
+	if n := reads(); n != 1 {
+		t.Errorf("synchronous request read preferences %d times, want 1", n)
+	}
+
+	// The field isn't serialized with a job, so the worker loads it again
+	msg := jobMessage{JobID: "job-1", Principal: "user-1", CreatedAt: time.Now().UTC(), Request: Req{Text: "buy milk", Mode: "reminder", MaxTokens: 800}}
+	if _, apiErr := runJob(ctx, msg); apiErr != nil {
+		t.Fatalf("runJob() error = %v", apiErr)
+	}
+	if n := reads(); n != 2 || !strings.Contains(string(bedrock.body), "The user's name is Ada.") {
+		t.Errorf("job read preferences %d times in total, prompt has name: %v", n, strings.Contains(string(bedrock.body), "Ada"))
+	}
+}
+
+func TestHandlePreferences(t *testing.T) {
+	call := func(method, principal, body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/preferences", Body: body}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("GET", "user-1", ""); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+
+	t.Run("put then get", func(t *testing.T) {
+		resp := call("PUT", "user-1", `{"name":"Sam","timezone":"America/New_York","defaultMode":"reminder","verbosity":"detailed"}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("PUT StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+
+		var prefs Preferences
+		json.Unmarshal([]byte(call("GET", "user-1", "").Body), &prefs)
+		if prefs.Name != "Sam" || prefs.Timezone != "America/New_York" || prefs.DefaultMode != "reminder" || prefs.UpdatedAt == "" {
+			t.Errorf("GET = %+v", prefs)
+		}
+
+		// Each principal has their own preferences
+		var other Preferences
+		json.Unmarshal([]byte(call("GET", "user-2", "").Body), &other)
+		if !reflect.DeepEqual(other, Preferences{}) {
+			t.Errorf("other principal got %+v", other)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{`{`, `{"timezone":"EST5"}`, `{"defaultMode":"chat"}`} {
+			if resp := call("PUT", "user-1", body); resp.StatusCode != 400 {
+				t.Errorf("PUT %s: StatusCode = %d, want 400", body, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		if resp := call("DELETE", "user-1", ""); resp.StatusCode != 405 {
+			t.Errorf("StatusCode = %d, want 405", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"strconv"
+	"unicode"
+)
+
+// Pre-flight budget defaults. Prices are USD per million tokens, used for a
+// BEDROCK_MODEL_ID missing from knownModelPrices; set BEDROCK_INPUT_USD_PER_MTOK and
+// BEDROCK_OUTPUT_USD_PER_MTOK to match it.
+const (
+	defaultModelContextTokens = 200000
+	defaultInputUSDPerMTok    = 1.0
+	defaultOutputUSDPerMTok   = 5.0
+
+	// maxTokens is lowered to fit a budget, but never below this; past it the request
+	// is rejected instead
+	minTrimmedMaxTokens = 256
+
+	// Images are scaled to fit imageMaxEdge pixels and cost about one token per
+	// imageTokenPixels pixels
+	imageMaxEdge     = 1568
+	imageTokenPixels = 750
+	maxImageTokens   = 1600
+)
+
+// BudgetError is returned instead of calling Bedrock when a request can't fit the
+// model's context window or the per-request cost ceiling, even with maxTokens trimmed
+type BudgetError struct {
+	Reason               string // context_window or cost_ceiling
+	EstimatedInputTokens int
+	MaxTokens            int     // output tokens the request asked for, thinking included
+	ContextTokens        int     // context_window: the model's limit
+	EstimatedCostUSD     float64 // cost_ceiling: with the smallest allowed maxTokens
+	CeilingUSD           float64
+}
+
+func (e *BudgetError) Error() string {
+	if e.Reason == "cost_ceiling" {
+		return fmt.Sprintf("request would cost an estimated $%.4f, over the $%.4f per-request ceiling (about %d input tokens)",
+			e.EstimatedCostUSD, e.CeilingUSD, e.EstimatedInputTokens)
+	}
+	return fmt.Sprintf("request needs about %d input tokens plus %d output tokens, over the model's %d-token context window",
+		e.EstimatedInputTokens, e.MaxTokens, e.ContextTokens)
+}
+
+// estimateTokens approximates Claude's tokenizer without calling it: about four
+// characters per token for ASCII text, and one token per character for other scripts,
+// which the tokenizer splits more finely. It errs on the high side.
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < unicode.MaxASCII {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// estimateImageTokens approximates an image's cost from its dimensions, assuming the
+// maximum when they can't be read (e.g. webp)
+func estimateImageTokens(img *imageInput) int {
+	if img == nil {
+		return 0
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return maxImageTokens
+	}
+	w, h := float64(cfg.Width), float64(cfg.Height)
+	if scale := imageMaxEdge / max(w, h); scale < 1 {
+		w, h = w*scale, h*scale
+	}
+	return min(int(w*h)/imageTokenPixels+1, maxImageTokens)
+}
+
+// preflightBudget checks a request against the model's context window
+// (MODEL_CONTEXT_TOKENS) and the per-request cost ceiling (MAX_REQUEST_COST_USD, 0 =
+// none) before it is sent. When only the requested output is too large, maxTokens is
+// trimmed to fit and a warning added; otherwise a BudgetError says by how much it's over.
+func preflightBudget(req *Req, systemPrompt, userMessage string) error {
+	input := estimateTokens(systemPrompt) + estimateTokens(userMessage) + estimateImageTokens(req.image)
+	output := req.MaxTokens + req.ThinkingTokens
+
+	if window := limitEnv("MODEL_CONTEXT_TOKENS", defaultModelContextTokens, 1); input+output > window {
+		allowed := window - input - req.ThinkingTokens
+		if allowed < minTrimmedMaxTokens {
+			return &BudgetError{Reason: "context_window", EstimatedInputTokens: input, MaxTokens: output, ContextTokens: window}
+		}
+		trimMaxTokens(req, allowed, "fit the model's context window")
+	}
+
+	ceiling := usdEnv("MAX_REQUEST_COST_USD", 0)
+	if ceiling == 0 {
+		return nil
+	}
+	price := modelPrice(requestModel(req))
+	inputPrice, outputPrice := price.Input/1e6, price.Output/1e6
+	if cost := float64(input)*inputPrice + float64(req.MaxTokens+req.ThinkingTokens)*outputPrice; cost <= ceiling {
+		return nil
+	}
+	allowed := int((ceiling-float64(input)*inputPrice)/outputPrice) - req.ThinkingTokens
+	if allowed < minTrimmedMaxTokens {
+		return &BudgetError{
+			Reason:               "cost_ceiling",
+			EstimatedInputTokens: input,
+			MaxTokens:            output,
+			EstimatedCostUSD:     float64(input)*inputPrice + float64(minTrimmedMaxTokens+req.ThinkingTokens)*outputPrice,
+			CeilingUSD:           ceiling,
+		}
+	}
+	trimMaxTokens(req, allowed, "stay under the per-request cost ceiling")
+	return nil
+}
+
+// trimMaxTokens lowers maxTokens, telling the caller why
+func trimMaxTokens(req *Req, allowed int, why string) {
+	log.Printf("Trimming maxTokens from %d to %d to %s", req.MaxTokens, allowed, why)
+	req.warnings = append(req.warnings, fmt.Sprintf("maxTokens lowered from %d to %d to %s", req.MaxTokens, allowed, why))
+	req.MaxTokens = allowed
+}
+
+// usdEnv reads a non-negative dollar amount from the environment
+func usdEnv(key string, defaultValue float64) float64 {
+	if env := os.Getenv(key); env != "" {
+		if f, err := strconv.ParseFloat(env, 64); err == nil && f >= 0 {
+			return f
+		}
+		log.Printf("Invalid %s value: %s, using default", key, env)
+	}
+	return defaultValue
+}
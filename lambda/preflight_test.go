@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	if got := estimateTokens("Buy milk and eggs"); got != 5 {
+		t.Errorf("ascii: got %d, want 5", got)
+	}
+	if got := estimateTokens("牛乳を買う"); got != 5 {
+		t.Errorf("japanese: got %d, want 5", got)
+	}
+}
+
+func TestEstimateImageTokens(t *testing.T) {
+	encode := func(w, h int) *imageInput {
+		var buf bytes.Buffer
+		png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)))
+		return &imageInput{MediaType: "image/png", Data: buf.Bytes()}
+	}
+	if got := estimateImageTokens(encode(300, 250)); got != 101 {
+		t.Errorf("300x250: got %d, want 101", got)
+	}
+	if got := estimateImageTokens(encode(4000, 100)); got != 82 {
+		t.Errorf("4000x100 (scaled to 1568x39): got %d, want 82", got)
+	}
+	if got := estimateImageTokens(&imageInput{MediaType: "image/webp", Data: []byte("RIFF")}); got != maxImageTokens {
+		t.Errorf("unreadable: got %d, want %d", got, maxImageTokens)
+	}
+	if estimateImageTokens(nil) != 0 {
+		t.Error("no image should cost nothing")
+	}
+}
+
+func TestPreflightBudget_ContextWindow(t *testing.T) {
+	t.Setenv("MODEL_CONTEXT_TOKENS", "2000")
+	text := strings.Repeat("word ", 1200) // 1500 tokens
+
+	req := &Req{MaxTokens: 800}
+	if err := preflightBudget(req, "", text); err != nil {
+		t.Fatal(err)
+	}
+	if req.MaxTokens != 500 || len(req.warnings) != 1 {
+		t.Errorf("maxTokens = %d, warnings = %v", req.MaxTokens, req.warnings)
+	}
+
+	var budgetErr *BudgetError
+	err := preflightBudget(&Req{MaxTokens: 800, ThinkingTokens: 300}, "", text)
+	if !errors.As(err, &budgetErr) || budgetErr.Reason != "context_window" || budgetErr.EstimatedInputTokens != 1500 || budgetErr.MaxTokens != 1100 {
+		t.Fatalf("err = %v", err)
+	}
+	apiErr := bedrockError(err)
+	if apiErr.Status != 413 || apiErr.Details["reason"] != "context_window" || apiErr.Details["contextTokens"] != 2000 {
+		t.Errorf("bedrockError = %d %v", apiErr.Status, apiErr.Details)
+	}
+}
+
+func TestPreflightBudget_CostCeiling(t *testing.T) {
+	t.Setenv("MAX_REQUEST_COST_USD", "0.01")
+	t.Setenv("BEDROCK_INPUT_USD_PER_MTOK", "1")
+	t.Setenv("BEDROCK_OUTPUT_USD_PER_MTOK", "5")
+
+	// 4000 input tokens cost $0.004, leaving $0.006 for 1200 output tokens
+	req := &Req{MaxTokens: 4000}
+	if err := preflightBudget(req, "", strings.Repeat("abcd", 4000)); err != nil {
+		t.Fatal(err)
+	}
+	if req.MaxTokens != 1200 || len(req.warnings) != 1 {
+		t.Errorf("maxTokens = %d, warnings = %v", req.MaxTokens, req.warnings)
+	}
+
+	var budgetErr *BudgetError
+	if err := preflightBudget(&Req{MaxTokens: 800}, "", strings.Repeat("abcd", 9500)); !errors.As(err, &budgetErr) || budgetErr.Reason != "cost_ceiling" {
+		t.Fatalf("err = %v", err)
+	}
+
+	t.Setenv("MAX_REQUEST_COST_USD", "0")
+	if req := (&Req{MaxTokens: 4000}); preflightBudget(req, "", strings.Repeat("abcd", 9500)) != nil || req.MaxTokens != 4000 {
+		t.Error("no ceiling should leave the request alone")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Reminder priorities, as returned in Response.priority
+const (
+	priorityLow    = "low"
+	priorityMedium = "medium"
+	priorityHigh   = "high"
+)
+
+// prioritySynonyms maps values the model sometimes returns onto the three priorities
+var prioritySynonyms = map[string]string{
+	"low": priorityLow, "minor": priorityLow, "someday": priorityLow,
+	"medium": priorityMedium, "normal": priorityMedium, "moderate": priorityMedium,
+	"high": priorityHigh, "urgent": priorityHigh, "critical": priorityHigh, "important": priorityHigh,
+}
+
+// Phrasings that set a priority when the model didn't return a usable one
+var (
+	highPriorityPhrases = regexp.MustCompile(`(?i)\b(urgent(ly)?|asap|as soon as possible|right away|immediately|high priority|critical|don'?t forget|top priority)\b`)
+	lowPriorityPhrases  = regexp.MustCompile(`(?i)\b(when i get a chance|when i have time|whenever|someday|some day|eventually|no rush|low priority|not urgent)\b`)
+)
+
+// normalizePriority validates the model's priority for reminders, falling back to the
+// phrasing of the request. Other actions never carry a priority; a reminder with no
+// recognisable priority is left empty so sinks apply their own default.
+func normalizePriority(resp *Response, text string) {
+	if resp.Action != "reminder" {
+		resp.Priority = ""
+		return
+	}
+	if priority, ok := prioritySynonyms[strings.ToLower(strings.TrimSpace(resp.Priority))]; ok {
+		resp.Priority = priority
+		return
+	}
+
+	switch {
+	case lowPriorityPhrases.MatchString(text):
+		resp.Priority = priorityLow
+	case highPriorityPhrases.MatchString(text):
+		resp.Priority = priorityHigh
+	default:
+		resp.Priority = ""
+	}
+}
+
+// todoistPriority maps a priority onto Todoist's 1 (normal) .. 4 (urgent) scale
+func todoistPriority(priority string, defaultPriority int) int {
+	switch priority {
+	case priorityLow:
+		return 1
+	case priorityMedium:
+		return 2
+	case priorityHigh:
+		return 4
+	default:
+		return defaultPriority
+	}
+}
+
+// icalPriority maps a priority onto RFC 5545 PRIORITY the way Apple Reminders reads it
+// (1 high, 5 medium, 9 low); 0 means undefined
+func icalPriority(priority string) int {
+	switch priority {
+	case priorityHigh:
+		return 1
+	case priorityMedium:
+		return 5
+	case priorityLow:
+		return 9
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestNormalizePriority(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		model  string
+		text   string
+		want   string
+	}{
+		{"model value", "reminder", "high", "call mom", "high"},
+		{"model synonym", "reminder", " Urgent ", "call mom", "high"},
+		{"model normal", "reminder", "normal", "call mom", "medium"},
+		{"invalid falls back to phrasing", "reminder", "p1", "renew passport ASAP", "high"},
+		{"relaxed phrasing", "reminder", "", "clean the garage when I get a chance", "low"},
+		{"not urgent is low", "reminder", "", "not urgent, but email Sam", "low"},
+		{"no signal", "reminder", "", "call mom at 5", ""},
+		{"non-reminder cleared", "note", "high", "urgent thoughts", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := Response{Action: tt.action, Priority: tt.model}
+			normalizePriority(&resp, tt.text)
+			if resp.Priority != tt.want {
+				t.Errorf("Priority = %q, want %q", resp.Priority, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityMappings(t *testing.T) {
+	tests := []struct {
+		priority string
+		todoist  int
+		ical     int
+	}{
+		{"high", 4, 1},
+		{"medium", 2, 5},
+		{"low", 1, 9},
+		{"", 3, 0},
+	}
+	for _, tt := range tests {
+		if got := todoistPriority(tt.priority, 3); got != tt.todoist {
+			t.Errorf("todoistPriority(%q) = %d, want %d", tt.priority, got, tt.todoist)
+		}
+		if got := icalPriority(tt.priority); got != tt.ical {
+			t.Errorf("icalPriority(%q) = %d, want %d", tt.priority, got, tt.ical)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// Progress stages of an async job, in order. The worker records each one on the job as
+// the pipeline reaches it, and GET /jobs/{id}/events streams them to the phone app.
+const (
+	stageQueued     = "queued"              // waiting for the worker
+	stageThinking   = "thinking"            // preparing context and the prompt
+	stageGenerating = "generating"          // the model is writing the reply
+	stageDelivering = "delivering-to-sinks" // saving to history, notes and other sinks
+	stageDone       = "done"                // succeeded or failed; the event carries which
+)
+
+var progressStages = []string{stageQueued, stageThinking, stageGenerating, stageDelivering, stageDone}
+
+// Default time GET /jobs/{id}/events waits for a new stage (overridable via
+// SSE_MAX_WAIT_SECONDS), well under API Gateway's 29 second integration timeout
+const defaultSSEMaxWait = 20
+
+// ssePollInterval is how often the event stream re-reads the job record
+var ssePollInterval = time.Second
+
+// sseRetryMillis is the reconnect delay sent to EventSource clients
+const sseRetryMillis = 500
+
+type progressKey struct{}
+
+// withProgress returns a context whose pipeline stages are reported to report
+func withProgress(ctx context.Context, report func(stage string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress records that the request reached a stage; synchronous requests have no
+// reporter and ignore it
+func reportProgress(ctx context.Context, stage string) {
+	if report, ok := ctx.Value(progressKey{}).(func(string)); ok {
+		report(stage)
+	}
+}
+
+// jobStage is the progress stage a job record is at. Running jobs without a recorded
+// stage (e.g. research workflow steps) count as generating.
+func jobStage(job *Job) string {
+	switch job.Status {
+	case jobSucceeded, jobFailed:
+		return stageDone
+	case jobRunning:
+		if job.Stage != "" {
+			return job.Stage
+		}
+		return stageGenerating
+	default:
+		return stageQueued
+	}
+}
+
+// progressEvent is the data of one server-sent event; done events carry the job's
+// result or error exactly as GET /jobs/{id} returns them
+type progressEvent struct {
+	JobID  string          `json:"jobId"`
+	Stage  string          `json:"stage"`
+	Status string          `json:"status"`
+	Step   string          `json:"step,omitempty"` // research workflow step in progress
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// sseMaxWait reads SSE_MAX_WAIT_SECONDS, falling back to the default
+func sseMaxWait() time.Duration {
+	return time.Duration(limitEnv("SSE_MAX_WAIT_SECONDS", defaultSSEMaxWait, 1)) * time.Second
+}
+
+// handleJobEvents serves GET /jobs/{id}/events as a Server-Sent Events stream of the
+// job's stages. API Gateway delivers a proxy response all at once, so the stream is a
+// long poll: it waits until the job moves past the client's Last-Event-ID (the index
+// of the last stage it saw), sends the stages since, and closes. EventSource then
+// reconnects with Last-Event-ID on its own; once done was sent the reply is 204, which
+// tells it to stop.
+func handleJobEvents(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	id, principal := event.PathParameters["id"], principalFromEvent(event)
+	last := -1
+	lastID := requestHeader(event, "Last-Event-ID")
+	if lastID == "" {
+		// For clients that can't set headers
+		lastID = event.QueryStringParameters["lastEventId"]
+	}
+	if lastID != "" {
+		parsed, err := strconv.Atoi(lastID)
+		if err != nil || parsed < 0 || parsed >= len(progressStages) {
+			return errorResponse(ctx, apierror.InvalidRequest(fmt.Sprintf("Last-Event-ID must be 0-%d", len(progressStages)-1)))
+		}
+		last = parsed
+	}
+	if last == len(progressStages)-1 {
+		return events.APIGatewayProxyResponse{StatusCode: 204, Headers: map[string]string{}}
+	}
+
+	deadline := time.Now().Add(sseMaxWait())
+	for {
+		job, err := loadJob(ctx, principal, id)
+		if err != nil {
+			log.Printf("Failed to load job %s: %v", id, err)
+			return errorResponse(ctx, apierror.Internal("Failed to load job"))
+		}
+		if job == nil {
+			return errorResponse(ctx, apierror.NotFound("job not found"))
+		}
+		if current := slices.Index(progressStages, jobStage(job)); current > last {
+			return sseResponse(progressEvents(job, last, current))
+		}
+		if !time.Now().Before(deadline) {
+			// Nothing new yet; the client reconnects and keeps waiting
+			return sseResponse(": waiting\n\n")
+		}
+		select {
+		case <-ctx.Done():
+			return sseResponse(": waiting\n\n")
+		case <-time.After(ssePollInterval):
+		}
+	}
+}
+
+// progressEvents formats the stages after last up to current as server-sent events,
+// with each stage's index as its event ID
+func progressEvents(job *Job, last, current int) string {
+	var b strings.Builder
+	for i := last + 1; i <= current; i++ {
+		data := progressEvent{JobID: job.ID, Stage: progressStages[i], Status: job.Status}
+		if i == current {
+			data.Step = job.Step
+		}
+		if progressStages[i] == stageDone {
+			data.Result, data.Error = job.Result, job.Error
+		}
+		body, _ := json.Marshal(data)
+		fmt.Fprintf(&b, "id: %d\nevent: %s\ndata: %s\n\n", i, progressStages[i], body)
+	}
+	return b.String()
+}
+
+// sseResponse is a text/event-stream response that sets the client's reconnect delay
+func sseResponse(body string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":  "text/event-stream; charset=utf-8",
+			"Cache-Control": "no-cache",
+		},
+		Body: fmt.Sprintf("retry: %d\n\n", sseRetryMillis) + body,
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestJobStage(t *testing.T) {
+	tests := []struct {
+		job  Job
+		want string
+	}{
+		{Job{Status: jobQueued}, stageQueued},
+		{Job{Status: jobPending}, stageQueued},
+		{Job{Status: jobRunning, Stage: stageThinking}, stageThinking},
+		{Job{Status: jobRunning, Step: "lookup"}, stageGenerating},
+		{Job{Status: jobSucceeded, Stage: stageDelivering}, stageDone},
+		{Job{Status: jobFailed}, stageDone},
+	}
+	for _, tt := range tests {
+		if got := jobStage(&tt.job); got != tt.want {
+			t.Errorf("jobStage(%+v) = %s, want %s", tt.job, got, tt.want)
+		}
+	}
+}
+
+func TestProcessRequest_ReportsProgress(t *testing.T) {
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"note","title":"Idea","markdown":"An idea"}`})
+	var stages []string
+	ctx := withProgress(context.Background(), func(stage string) { stages = append(stages, stage) })
+
+	req := &Req{Text: "an idea", Mode: "note", MaxTokens: 800}
+	if _, apiErr := processRequest(ctx, req, "id-1", "user-1", time.Now()); apiErr != nil {
+		t.Fatalf("processRequest() error = %v", apiErr)
+	}
+	if !slices.Equal(stages, []string{stageGenerating, stageDelivering}) {
+		t.Errorf("stages = %v", stages)
+	}
+}
+
+// jobEventsRequest builds a GET /jobs/{id}/events request from user-1
+func jobEventsRequest(id, lastEventID string) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod:     "GET",
+		Resource:       "/jobs/{id}/events",
+		PathParameters: map[string]string{"id": id},
+		Headers:        map[string]string{},
+	}
+	if lastEventID != "" {
+		event.Headers["Last-Event-ID"] = lastEventID
+	}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+	return event
+}
+
+func TestHandleJobEvents(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	t.Setenv("SSE_MAX_WAIT_SECONDS", "1")
+	origInterval := ssePollInterval
+	ssePollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { ssePollInterval = origInterval })
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	done := newJob("user-1", "job-done", "note", now)
+	done.Status, done.Stage = jobSucceeded, stageDone
+	done.Result = json.RawMessage(`{"title":"Idea"}`)
+	running := newJob("user-1", "job-running", "note", now)
+	running.Status, running.Stage = jobRunning, stageGenerating
+	for _, job := range []Job{done, running} {
+		if err := saveJob(context.Background(), job); err != nil {
+			t.Fatalf("saveJob() error = %v", err)
+		}
+	}
+
+	resp, _ := handler(context.Background(), jobEventsRequest("job-done", ""))
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Headers["Content-Type"], "text/event-stream") {
+		t.Fatalf("Unexpected response: %d %v %s", resp.StatusCode, resp.Headers, resp.Body)
+	}
+	for _, want := range []string{"retry: 500\n", "id: 0\nevent: queued\n", "id: 3\nevent: delivering-to-sinks\n", `id: 4` + "\nevent: done\ndata: " + `{"jobId":"job-done","stage":"done","status":"succeeded","result":{"title":"Idea"}}` + "\n\n"} {
+		if !strings.Contains(resp.Body, want) {
+			t.Errorf("Expected %q in %q", want, resp.Body)
+		}
+	}
+
+	// Reconnecting resumes after the last event seen
+	resp, _ = handler(context.Background(), jobEventsRequest("job-running", "1"))
+	if strings.Contains(resp.Body, "event: thinking") || !strings.Contains(resp.Body, "id: 2\nevent: generating\n") {
+		t.Errorf("Expected only the generating event, got %q", resp.Body)
+	}
+
+	// Nothing new before the wait runs out
+	resp, _ = handler(context.Background(), jobEventsRequest("job-running", "2"))
+	if resp.StatusCode != 200 || strings.Contains(resp.Body, "event:") {
+		t.Errorf("Expected no events, got %d %q", resp.StatusCode, resp.Body)
+	}
+
+	// After done, 204 tells EventSource to stop reconnecting
+	if resp, _ := handler(context.Background(), jobEventsRequest("job-done", "4")); resp.StatusCode != 204 {
+		t.Errorf("Expected 204 after done, got %d", resp.StatusCode)
+	}
+	if resp, _ := handler(context.Background(), jobEventsRequest("job-done", "seven")); resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for an invalid Last-Event-ID, got %d", resp.StatusCode)
+	}
+	if resp, _ := handler(context.Background(), jobEventsRequest("missing", "")); resp.StatusCode != 404 {
+		t.Errorf("Expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+}
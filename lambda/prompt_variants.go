@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Partition key of the per-variant counters in the history table; principals' items
+// all start with USER# or TENANT#, so it can't collide
+const promptVariantStatsPK = "PROMPTVARIANTS"
+
+// variantNamePattern is what a prompt variant may be called; the name is returned in
+// responses and used in counter keys
+var variantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// PromptVariant is one arm of a prompt experiment: extra instructions appended to a
+// mode's system prompt, picked for a share of requests proportional to Weight. The
+// control arm has no instructions.
+type PromptVariant struct {
+	Name         string `json:"name"`
+	Weight       int    `json:"weight"`
+	Instructions string `json:"instructions,omitempty"`
+}
+
+// PromptVariantStats is one variant's counters, as returned by GET /admin/prompt-variants
+type PromptVariantStats struct {
+	Mode             string  `json:"mode"`
+	Variant          string  `json:"variant"`
+	Weight           int     `json:"weight"` // current weight; 0 for variants no longer configured
+	Requests         int     `json:"requests"`
+	ParseFailures    int     `json:"parseFailures"` // replies that weren't valid JSON
+	Fallbacks        int     `json:"fallbacks"`     // JSON replies missing title, markdown or shortText
+	ParseFailureRate float64 `json:"parseFailureRate"`
+	FallbackRate     float64 `json:"fallbackRate"`
+}
+
+// promptVariantItem is the stored form of a variant's counters
+type promptVariantItem struct {
+	PK            string `dynamodbav:"pk"`
+	SK            string `dynamodbav:"sk"`
+	Requests      int    `dynamodbav:"requests"`
+	ParseFailures int    `dynamodbav:"parseFailures"`
+	Fallbacks     int    `dynamodbav:"fallbacks"`
+}
+
+// loadPromptVariants reads PROMPT_VARIANTS, a JSON object of mode to variants, e.g.
+// {"reminder":[{"name":"control","weight":3},{"name":"terse","weight":1,"instructions":"..."}]}.
+// Invalid configuration is logged and ignored, leaving every mode on its built-in prompt.
+func loadPromptVariants() map[string][]PromptVariant {
+	env := os.Getenv("PROMPT_VARIANTS")
+	if env == "" {
+		return nil
+	}
+	var variants map[string][]PromptVariant
+	if err := json.Unmarshal([]byte(env), &variants); err != nil {
+		log.Printf("Invalid PROMPT_VARIANTS value, ignoring it: %v", err)
+		return nil
+	}
+	if err := validatePromptVariants(variants); err != nil {
+		log.Printf("Invalid PROMPT_VARIANTS value, ignoring it: %v", err)
+		return nil
+	}
+	return variants
+}
+
+// validatePromptVariants checks modes, names and weights
+func validatePromptVariants(variants map[string][]PromptVariant) error {
+	for mode, arms := range variants {
+		if _, ok := lookupMode(mode); !ok {
+			return fmt.Errorf("unknown mode %q", mode)
+		}
+		seen := map[string]bool{}
+		total := 0
+		for _, arm := range arms {
+			if !variantNamePattern.MatchString(arm.Name) {
+				return fmt.Errorf("%s: invalid variant name %q", mode, arm.Name)
+			}
+			if seen[arm.Name] {
+				return fmt.Errorf("%s: duplicate variant %q", mode, arm.Name)
+			}
+			if arm.Weight < 0 {
+				return fmt.Errorf("%s: variant %q has a negative weight", mode, arm.Name)
+			}
+			seen[arm.Name] = true
+			total += arm.Weight
+		}
+		if total == 0 {
+			return fmt.Errorf("%s: variants need a positive total weight", mode)
+		}
+	}
+	return nil
+}
+
+// pickPromptVariant chooses one of a mode's variants with probability proportional to
+// its weight, or returns nil when the mode has none. roll returns an int in [0, n).
+func pickPromptVariant(arms []PromptVariant, roll func(n int) int) *PromptVariant {
+	total := 0
+	for _, arm := range arms {
+		total += arm.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+	r := roll(total)
+	for i := range arms {
+		if r < arms[i].Weight {
+			return &arms[i]
+		}
+		r -= arms[i].Weight
+	}
+	return nil
+}
+
+// promptVariantPrompt is the system prompt section a variant adds
+func promptVariantPrompt(variant *PromptVariant) string {
+	if variant == nil || strings.TrimSpace(variant.Instructions) == "" {
+		return ""
+	}
+	return "\n\n" + strings.TrimSpace(variant.Instructions)
+}
+
+// isIncompleteResponse reports whether a parsed reply left out a field the server then
+// has to derive: the title, the markdown or the watch-face shortText
+func isIncompleteResponse(resp *Response) bool {
+	return strings.TrimSpace(resp.Title) == "" || strings.TrimSpace(resp.Markdown) == "" || strings.TrimSpace(resp.ShortText) == ""
+}
+
+// recordPromptVariant counts a response against the variant that produced it. Errors are
+// logged and skipped - the counters are for comparing prompts, not for serving requests.
+func recordPromptVariant(ctx context.Context, mode string, resp *Response) {
+	if historyTableName == "" || resp.PromptVariant == "" {
+		return
+	}
+	parseFailure, fallback := 0, 0
+	if resp.parsePath == "fallback" {
+		parseFailure = 1
+	} else if resp.incomplete {
+		fallback = 1
+	}
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: promptVariantStatsPK},
+			"sk": &types.AttributeValueMemberS{Value: mode + "#" + resp.PromptVariant},
+		},
+		UpdateExpression: aws.String("ADD requests :one, parseFailures :parseFailure, fallbacks :fallback"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":          &types.AttributeValueMemberN{Value: "1"},
+			":parseFailure": &types.AttributeValueMemberN{Value: strconv.Itoa(parseFailure)},
+			":fallback":     &types.AttributeValueMemberN{Value: strconv.Itoa(fallback)},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to record prompt variant usage: %v", err)
+	}
+}
+
+// loadPromptVariantStats reads every variant's counters, adding configured variants that
+// haven't served a request yet, sorted by mode and variant
+func loadPromptVariantStats(ctx context.Context, configured map[string][]PromptVariant) ([]PromptVariantStats, error) {
+	byKey := map[string]*PromptVariantStats{}
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(historyTableName),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: promptVariantStatsPK},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("DynamoDB Query failed: %w", err)
+		}
+		var page []promptVariantItem
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prompt variant stats: %w", err)
+		}
+		for _, item := range page {
+			mode, variant, ok := strings.Cut(item.SK, "#")
+			if !ok {
+				continue
+			}
+			byKey[item.SK] = &PromptVariantStats{Mode: mode, Variant: variant, Requests: item.Requests, ParseFailures: item.ParseFailures, Fallbacks: item.Fallbacks}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	for mode, arms := range configured {
+		for _, arm := range arms {
+			key := mode + "#" + arm.Name
+			if byKey[key] == nil {
+				byKey[key] = &PromptVariantStats{Mode: mode, Variant: arm.Name}
+			}
+			byKey[key].Weight = arm.Weight
+		}
+	}
+
+	stats := []PromptVariantStats{}
+	for _, s := range byKey {
+		if s.Requests > 0 {
+			s.ParseFailureRate = float64(s.ParseFailures) / float64(s.Requests)
+			s.FallbackRate = float64(s.Fallbacks) / float64(s.Requests)
+		}
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Mode != stats[j].Mode {
+			return stats[i].Mode < stats[j].Mode
+		}
+		return stats[i].Variant < stats[j].Variant
+	})
+	return stats, nil
+}
+
+// isPromptVariantsRequest reports whether the route is the admin prompt variant report
+func isPromptVariantsRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/admin/prompt-variants"
+}
+
+// handlePromptVariants serves GET /admin/prompt-variants: request counts and
+// parse-failure and fallback rates for every prompt variant. The caller is already
+// known to be an admin.
+func handlePromptVariants(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+	stats, err := loadPromptVariantStats(ctx, loadPromptVariants())
+	if err != nil {
+		log.Printf("Failed to load prompt variant stats: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load prompt variant stats"))
+	}
+	return apiResponse(200, map[string]interface{}{"variants": stats})
+}
+
+// randomRoll is the production roll for pickPromptVariant
+func randomRoll(n int) int {
+	return rand.Intn(n)
+}
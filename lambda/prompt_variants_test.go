@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestLoadPromptVariants(t *testing.T) {
+	t.Setenv("PROMPT_VARIANTS", `{"reminder":[{"name":"control","weight":3},{"name":"terse","weight":1,"instructions":"Keep titles under five words."}]}`)
+	variants := loadPromptVariants()
+	if len(variants["reminder"]) != 2 || variants["reminder"][1].Instructions == "" {
+		t.Errorf("variants = %+v", variants)
+	}
+
+	for _, env := range []string{
+		`{`,
+		`{"chat":[{"name":"a","weight":1}]}`,
+		`{"note":[{"name":"A B","weight":1}]}`,
+		`{"note":[{"name":"a","weight":1},{"name":"a","weight":1}]}`,
+		`{"note":[{"name":"a","weight":0}]}`,
+		`{"note":[{"name":"a","weight":-1},{"name":"b","weight":2}]}`,
+	} {
+		t.Setenv("PROMPT_VARIANTS", env)
+		if got := loadPromptVariants(); got != nil {
+			t.Errorf("%s: variants = %+v, want nil", env, got)
+		}
+	}
+}
+
+func TestPickPromptVariant(t *testing.T) {
+	arms := []PromptVariant{{Name: "control", Weight: 3}, {Name: "off", Weight: 0}, {Name: "terse", Weight: 1}}
+	picked := map[string]int{}
+	for r := 0; r < 4; r++ {
+		variant := pickPromptVariant(arms, func(n int) int {
+			if n != 4 {
+				t.Fatalf("roll(%d), want roll(4)", n)
+			}
+			return r
+		})
+		picked[variant.Name]++
+	}
+	if picked["control"] != 3 || picked["terse"] != 1 || picked["off"] != 0 {
+		t.Errorf("picked = %v", picked)
+	}
+	if pickPromptVariant(nil, randomRoll) != nil {
+		t.Error("mode without variants should pick none")
+	}
+}
+
+func TestParseModelResponsePath(t *testing.T) {
+	complete := parseModelResponse(`{"title":"Call mom","markdown":"Call mom","shortText":"Call mom"}`, "note", Usage{})
+	if complete.parsePath != "structured" || complete.incomplete {
+		t.Errorf("complete reply: path = %s, incomplete = %v", complete.parsePath, complete.incomplete)
+	}
+	if missing := parseModelResponse(`{"title":"Call mom","markdown":"Call mom"}`, "note", Usage{}); !missing.incomplete {
+		t.Error("reply without shortText should be incomplete")
+	}
+	if raw := parseModelResponse("Call mom", "note", Usage{}); raw.parsePath != "fallback" {
+		t.Errorf("raw text: path = %s", raw.parsePath)
+	}
+}
+
+func TestRecordPromptVariant(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	ctx := context.Background()
+
+	recordPromptVariant(ctx, "note", &Response{parsePath: "structured"})
+	if len(db.updates) != 0 {
+		t.Fatalf("response without a variant recorded %d updates", len(db.updates))
+	}
+	recordPromptVariant(ctx, "note", &Response{PromptVariant: "terse", parsePath: "fallback"})
+	recordPromptVariant(ctx, "note", &Response{PromptVariant: "terse", parsePath: "structured", incomplete: true})
+	if len(db.updates) != 2 {
+		t.Fatalf("updates = %d, want 2", len(db.updates))
+	}
+	var key, values map[string]interface{}
+	attributevalue.UnmarshalMap(db.updates[0].Key, &key)
+	attributevalue.UnmarshalMap(db.updates[0].ExpressionAttributeValues, &values)
+	if key["pk"] != promptVariantStatsPK || key["sk"] != "note#terse" || values[":parseFailure"] != 1.0 || values[":fallback"] != 0.0 {
+		t.Errorf("first update: key = %v, values = %v", key, values)
+	}
+	attributevalue.UnmarshalMap(db.updates[1].ExpressionAttributeValues, &values)
+	if values[":parseFailure"] != 0.0 || values[":fallback"] != 1.0 {
+		t.Errorf("second update: values = %v", values)
+	}
+}
+
+func TestHandlePromptVariants(t *testing.T) {
+	call := func(role string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/admin/prompt-variants"}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1", "role": role}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	t.Setenv("PROMPT_VARIANTS", `{"reminder":[{"name":"control","weight":1},{"name":"terse","weight":1}]}`)
+	item, _ := attributevalue.MarshalMap(promptVariantItem{PK: promptVariantStatsPK, SK: "reminder#terse", Requests: 8, ParseFailures: 2, Fallbacks: 1})
+	db.PutItem(context.Background(), &dynamodb.PutItemInput{Item: item})
+
+	if resp := call(""); resp.StatusCode != 403 {
+		t.Errorf("non-admin: StatusCode = %d, want 403", resp.StatusCode)
+	}
+
+	resp := call("admin")
+	var body struct {
+		Variants []PromptVariantStats `json:"variants"`
+	}
+	json.Unmarshal([]byte(resp.Body), &body)
+	if resp.StatusCode != 200 || len(body.Variants) != 2 {
+		t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+	control, terse := body.Variants[0], body.Variants[1]
+	if control.Variant != "control" || control.Requests != 0 || control.Weight != 1 {
+		t.Errorf("control = %+v", control)
+	}
+	if terse.Requests != 8 || terse.ParseFailureRate != 0.25 || terse.FallbackRate != 0.125 {
+		t.Errorf("terse = %+v", terse)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+)
+
+// ModelProvider turns the pipeline's Anthropic-style messages into one model family's
+// InvokeModel request body and reads that family's reply back into a BedrockResponse.
+// Messages are maps with a role (user or assistant) and content that is either a string
+// or a list of text and base64 image blocks, as built by invokeModelContent and
+// imageContent; stop reasons are normalized to end_turn and max_tokens. Sampling controls
+// a family doesn't support are left out of its request.
+type ModelProvider interface {
+	Name() string
+	BuildRequest(systemPrompt string, messages []map[string]interface{}, maxTokens, thinkingTokens int, sampling Sampling) ([]byte, error)
+	ParseResponse(body []byte) (*BedrockResponse, error)
+}
+
+// Model families with a provider
+const (
+	familyAnthropic = "anthropic"
+	familyNova      = "nova"
+	familyLlama     = "llama"
+)
+
+// modelFamily returns the family of a model or inference profile ID. IDs that don't name
+// their model (application inference profile and provisioned throughput ARNs) are taken
+// to be BEDROCK_MODEL_FAMILY, default anthropic.
+func modelFamily(model string) string {
+	base := baseModelID(model)
+	switch {
+	case strings.HasPrefix(base, "anthropic."):
+		return familyAnthropic
+	case strings.HasPrefix(base, "amazon.nova"):
+		return familyNova
+	case strings.HasPrefix(base, "meta.llama"):
+		return familyLlama
+	}
+	switch family := strings.ToLower(os.Getenv("BEDROCK_MODEL_FAMILY")); family {
+	case familyNova, familyLlama:
+		return family
+	case "", familyAnthropic:
+	default:
+		log.Printf("Invalid BEDROCK_MODEL_FAMILY value: %s, using anthropic", family)
+	}
+	return familyAnthropic
+}
+
+// providerFor picks the provider for a model by its family
+func providerFor(model string) ModelProvider {
+	switch modelFamily(model) {
+	case familyNova:
+		return novaProvider{}
+	case familyLlama:
+		return llamaProvider{}
+	default:
+		return anthropicProvider{}
+	}
+}
+
+// supportsThinking reports whether a model accepts thinkingTokens: only Claude has
+// extended thinking, and not on provisioned throughput, whose model units are sized for
+// a fixed output length
+func supportsThinking(model string) bool {
+	return modelFamily(model) == familyAnthropic && modelCapacity(model) != capacityProvisioned
+}
+
+// adaptToModel drops request parameters the request's model doesn't support, with a
+// warning, so switching BEDROCK_MODEL_ID doesn't break clients that send them
+func adaptToModel(req *Req) {
+	if model := requestModel(req); req.ThinkingTokens > 0 && !supportsThinking(model) {
+		log.Printf("Ignoring thinkingTokens for %s", model)
+		req.warnings = append(req.warnings, "thinkingTokens ignored: the configured model has no extended thinking")
+		req.ThinkingTokens = 0
+	}
+	if model := requestModel(req); modelFamily(model) == familyLlama && (req.TopK != nil || len(req.StopSequences) > 0) {
+		log.Printf("Ignoring topK and stopSequences for %s", model)
+		req.warnings = append(req.warnings, "topK and stopSequences ignored: the configured model doesn't support them")
+		req.TopK = nil
+		req.StopSequences = nil
+	}
+}
+
+// messageBlocks returns a message's content as blocks, wrapping plain-string content
+// (e.g. a prefilled assistant turn) in a single text block
+func messageBlocks(message map[string]interface{}) []map[string]interface{} {
+	switch content := message["content"].(type) {
+	case string:
+		return []map[string]interface{}{{"type": "text", "text": content}}
+	case []map[string]interface{}:
+		return content
+	}
+	return nil
+}
+
+// imageBlockData returns an image block's media type and base64 data
+func imageBlockData(block map[string]interface{}) (mediaType, data string) {
+	source, _ := block["source"].(map[string]interface{})
+	mediaType, _ = source["media_type"].(string)
+	data, _ = source["data"].(string)
+	return mediaType, data
+}
+
+// stripCodeFence removes a ```json fence around a reply; Nova and Llama often add one
+// even when told to answer with bare JSON
+func stripCodeFence(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return text
+	}
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "```"), "```")
+	if newline := strings.IndexByte(trimmed, '\n'); newline >= 0 && !strings.ContainsAny(trimmed[:newline], "{[") {
+		trimmed = trimmed[newline+1:]
+	}
+	return strings.TrimSpace(trimmed)
+}
+
+// anthropicProvider speaks the Anthropic Messages API, which the pipeline's messages
+// already follow
+type anthropicProvider struct{}
+
+func (anthropicProvider) Name() string { return "anthropic" }
+
+func (anthropicProvider) BuildRequest(systemPrompt string, messages []map[string]interface{}, maxTokens, thinkingTokens int, sampling Sampling) ([]byte, error) {
+	requestBody := map[string]interface{}{
+		"anthropic_version": "bedrock-2023-05-31",
+		"system":            systemPrompt,
+		"messages":          messages,
+		"max_tokens":        maxTokens,
+		"temperature":       sampling.temperature(),
+	}
+	if sampling.TopP != nil {
+		requestBody["top_p"] = *sampling.TopP
+	}
+	if sampling.TopK != nil {
+		requestBody["top_k"] = *sampling.TopK
+	}
+	if len(sampling.StopSequences) > 0 {
+		requestBody["stop_sequences"] = sampling.StopSequences
+	}
+
+	// Add thinking tokens if specified
+	if thinkingTokens > 0 {
+		requestBody["thinking"] = map[string]interface{}{
+			"max_thinking_tokens": thinkingTokens,
+		}
+	}
+	return json.Marshal(requestBody)
+}
+
+func (anthropicProvider) ParseResponse(body []byte) (*BedrockResponse, error) {
+	var resp BedrockResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// novaProvider speaks Amazon Nova's messages-v1 schema. Nova has no extended thinking,
+// so thinkingTokens is ignored (adaptToModel clears it beforehand).
+type novaProvider struct{}
+
+func (novaProvider) Name() string { return "nova" }
+
+func (novaProvider) BuildRequest(systemPrompt string, messages []map[string]interface{}, maxTokens, thinkingTokens int, sampling Sampling) ([]byte, error) {
+	novaMessages := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		var content []map[string]interface{}
+		for _, block := range messageBlocks(message) {
+			switch block["type"] {
+			case "text":
+				content = append(content, map[string]interface{}{"text": block["text"]})
+			case "image":
+				mediaType, data := imageBlockData(block)
+				content = append(content, map[string]interface{}{"image": map[string]interface{}{
+					"format": strings.TrimPrefix(mediaType, "image/"),
+					"source": map[string]interface{}{"bytes": data},
+				}})
+			}
+		}
+		novaMessages = append(novaMessages, map[string]interface{}{"role": message["role"], "content": content})
+	}
+	inferenceConfig := map[string]interface{}{"maxTokens": maxTokens, "temperature": sampling.temperature()}
+	if sampling.TopP != nil {
+		inferenceConfig["topP"] = *sampling.TopP
+	}
+	if sampling.TopK != nil {
+		inferenceConfig["topK"] = *sampling.TopK
+	}
+	if len(sampling.StopSequences) > 0 {
+		inferenceConfig["stopSequences"] = sampling.StopSequences
+	}
+	return json.Marshal(map[string]interface{}{
+		"schemaVersion":   "messages-v1",
+		"system":          []map[string]interface{}{{"text": systemPrompt}},
+		"messages":        novaMessages,
+		"inferenceConfig": inferenceConfig,
+	})
+}
+
+func (novaProvider) ParseResponse(body []byte) (*BedrockResponse, error) {
+	var resp struct {
+		Output struct {
+			Message struct {
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"message"`
+		} `json:"output"`
+		StopReason string `json:"stopReason"`
+		Usage      struct {
+			InputTokens  int `json:"inputTokens"`
+			OutputTokens int `json:"outputTokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	result := &BedrockResponse{
+		StopReason: resp.StopReason,
+		Usage:      Usage{InputTokens: resp.Usage.InputTokens, OutputTokens: resp.Usage.OutputTokens},
+	}
+	var text strings.Builder
+	for _, block := range resp.Output.Message.Content {
+		text.WriteString(block.Text)
+	}
+	if text.Len() > 0 {
+		result.Content = []Content{{Type: "text", Text: text.String()}}
+	}
+	return result, nil
+}
+
+// llamaProvider speaks Meta Llama's prompt-completion format, rendering the messages with
+// the Llama 3 chat template. Images are passed to the vision models (Llama 3.2 11B/90B);
+// thinkingTokens, topK and stopSequences are ignored (adaptToModel clears them beforehand).
+type llamaProvider struct{}
+
+func (llamaProvider) Name() string { return "llama" }
+
+func (llamaProvider) BuildRequest(systemPrompt string, messages []map[string]interface{}, maxTokens, thinkingTokens int, sampling Sampling) ([]byte, error) {
+	var prompt strings.Builder
+	var images []string
+	prompt.WriteString("<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\n" + systemPrompt + "<|eot_id|>")
+	prefilled := false
+	for i, message := range messages {
+		role, _ := message["role"].(string)
+		prompt.WriteString("<|start_header_id|>" + role + "<|end_header_id|>\n\n")
+		for _, block := range messageBlocks(message) {
+			switch block["type"] {
+			case "text":
+				text, _ := block["text"].(string)
+				prompt.WriteString(text)
+			case "image":
+				_, data := imageBlockData(block)
+				images = append(images, data)
+				prompt.WriteString("<|image|>")
+			}
+		}
+		// A trailing assistant turn is a prefill the model continues, so it stays open
+		if role == "assistant" && i == len(messages)-1 {
+			prefilled = true
+			break
+		}
+		prompt.WriteString("<|eot_id|>")
+	}
+	if !prefilled {
+		prompt.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+	}
+
+	requestBody := map[string]interface{}{
+		"prompt":      prompt.String(),
+		"max_gen_len": maxTokens,
+		"temperature": sampling.temperature(),
+	}
+	if sampling.TopP != nil {
+		requestBody["top_p"] = *sampling.TopP
+	}
+	if len(images) > 0 {
+		requestBody["images"] = images
+	}
+	return json.Marshal(requestBody)
+}
+
+func (llamaProvider) ParseResponse(body []byte) (*BedrockResponse, error) {
+	var resp struct {
+		Generation           string `json:"generation"`
+		PromptTokenCount     int    `json:"prompt_token_count"`
+		GenerationTokenCount int    `json:"generation_token_count"`
+		StopReason           string `json:"stop_reason"` // stop or length
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	result := &BedrockResponse{
+		StopReason: "end_turn",
+		Usage:      Usage{InputTokens: resp.PromptTokenCount, OutputTokens: resp.GenerationTokenCount},
+	}
+	if resp.StopReason == "length" {
+		result.StopReason = "max_tokens"
+	}
+	if resp.Generation != "" {
+		result.Content = []Content{{Type: "text", Text: resp.Generation}}
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+func TestProviderFor(t *testing.T) {
+	tests := map[string]string{
+		"anthropic.claude-haiku-4-5-20251001-v1:0":                   "anthropic",
+		"us.anthropic.claude-haiku-4-5-20251001-v1:0":                "anthropic",
+		"amazon.nova-lite-v1:0":                                      "nova",
+		"eu.amazon.nova-micro-v1:0":                                  "nova",
+		"us.meta.llama3-2-11b-instruct-v1:0":                         "llama",
+		"arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x": "anthropic",
+	}
+	for model, want := range tests {
+		if got := providerFor(model).Name(); got != want {
+			t.Errorf("providerFor(%s) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestAdaptToModel(t *testing.T) {
+	req := Req{ThinkingTokens: 2000}
+	adaptToModel(&req)
+	if req.ThinkingTokens != 2000 || len(req.warnings) != 0 {
+		t.Errorf("claude: got %d thinking tokens, warnings %q", req.ThinkingTokens, req.warnings)
+	}
+
+	for _, model := range []string{"amazon.nova-pro-v1:0", "arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x9y8z7"} {
+		req := Req{ThinkingTokens: 2000, model: model}
+		adaptToModel(&req)
+		if req.ThinkingTokens != 0 || len(req.warnings) != 1 {
+			t.Errorf("%s: got %d thinking tokens, warnings %q", model, req.ThinkingTokens, req.warnings)
+		}
+	}
+
+	t.Setenv("BEDROCK_MODEL_FAMILY", "nova")
+	if got := modelFamily("arn:aws:bedrock:us-west-2:123456789012:application-inference-profile/a1b2c3"); got != familyNova {
+		t.Errorf("application profile family = %s, want nova", got)
+	}
+	if got := modelFamily("us.anthropic.claude-haiku-4-5-20251001-v1:0"); got != familyAnthropic {
+		t.Errorf("named model family = %s, want anthropic", got)
+	}
+}
+
+// continuationMessages is a user turn with an image and a prefilled assistant turn
+func continuationMessages() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"role": "user", "content": []map[string]interface{}{
+			imageContent(&imageInput{MediaType: "image/png", Data: []byte("png")}),
+			{"type": "text", "text": "What is this?"},
+		}},
+		{"role": "assistant", "content": `{"title": "A`},
+	}
+}
+
+func TestNovaProvider(t *testing.T) {
+	body, err := novaProvider{}.BuildRequest("Be brief", continuationMessages(), 500, 2000, Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request struct {
+		System   []map[string]string `json:"system"`
+		Messages []struct {
+			Role    string                   `json:"role"`
+			Content []map[string]interface{} `json:"content"`
+		} `json:"messages"`
+		InferenceConfig map[string]interface{} `json:"inferenceConfig"`
+		Thinking        interface{}            `json:"thinking"`
+	}
+	json.Unmarshal(body, &request)
+	if request.System[0]["text"] != "Be brief" || request.InferenceConfig["maxTokens"] != 500.0 || request.Thinking != nil {
+		t.Errorf("request = %s", body)
+	}
+	if len(request.Messages) != 2 || request.Messages[1].Role != "assistant" || request.Messages[1].Content[0]["text"] != `{"title": "A` {
+		t.Fatalf("messages = %s", body)
+	}
+	image, _ := request.Messages[0].Content[0]["image"].(map[string]interface{})
+	if image["format"] != "png" {
+		t.Errorf("image = %v", request.Messages[0].Content[0])
+	}
+
+	resp, err := novaProvider{}.ParseResponse([]byte(`{"output":{"message":{"role":"assistant","content":[{"text":"Hello"}]}},"stopReason":"max_tokens","usage":{"inputTokens":12,"outputTokens":3}}`))
+	if err != nil || resp.Content[0].Text != "Hello" || resp.StopReason != "max_tokens" || resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 3 {
+		t.Errorf("ParseResponse() = %+v, %v", resp, err)
+	}
+}
+
+func TestLlamaProvider(t *testing.T) {
+	body, err := llamaProvider{}.BuildRequest("Be brief", continuationMessages(), 500, 0, Sampling{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request struct {
+		Prompt    string   `json:"prompt"`
+		MaxGenLen int      `json:"max_gen_len"`
+		Images    []string `json:"images"`
+	}
+	json.Unmarshal(body, &request)
+	want := "<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nBe brief<|eot_id|>" +
+		"<|start_header_id|>user<|end_header_id|>\n\n<|image|>What is this?<|eot_id|>" +
+		"<|start_header_id|>assistant<|end_header_id|>\n\n{\"title\": \"A"
+	if request.Prompt != want || request.MaxGenLen != 500 || len(request.Images) != 1 {
+		t.Errorf("request = %s", body)
+	}
+
+	body, _ = llamaProvider{}.BuildRequest("Be brief", []map[string]interface{}{{"role": "user", "content": "Hi"}}, 500, 0, Sampling{})
+	json.Unmarshal(body, &request)
+	if !strings.HasSuffix(request.Prompt, "Hi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n") {
+		t.Errorf("prompt = %q, want an open assistant turn", request.Prompt)
+	}
+
+	resp, err := llamaProvider{}.ParseResponse([]byte(`{"generation":"Hello","prompt_token_count":40,"generation_token_count":5,"stop_reason":"length"}`))
+	if err != nil || resp.Content[0].Text != "Hello" || resp.StopReason != "max_tokens" || resp.Usage.InputTokens != 40 {
+		t.Errorf("ParseResponse() = %+v, %v", resp, err)
+	}
+}
+
+func TestStripCodeFence(t *testing.T) {
+	tests := map[string]string{
+		"```json\n{\"a\":1}\n```": `{"a":1}`,
+		"```\n{\"a\":1}\n```":     `{"a":1}`,
+		"```{\"a\":1}```":         `{"a":1}`,
+		`{"a":1}`:                 `{"a":1}`,
+		"```json\n{\"a\":1}":      "```json\n{\"a\":1}",
+	}
+	for in, want := range tests {
+		if got := stripCodeFence(in); got != want {
+			t.Errorf("stripCodeFence(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// llamaBedrock answers every call in Llama's format
+type llamaBedrock struct{ generation string }
+
+func (f llamaBedrock) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	body, _ := json.Marshal(map[string]interface{}{"generation": f.generation, "prompt_token_count": 100, "generation_token_count": 20, "stop_reason": "stop"})
+	return &bedrockruntime.InvokeModelOutput{Body: body}, nil
+}
+
+func TestCallBedrock_Llama(t *testing.T) {
+	orig := bedrockClient
+	bedrockClient = llamaBedrock{generation: "```json\n{\"action\":\"note\",\"title\":\"Tides\",\"markdown\":\"Tides\",\"shortText\":\"Tides\"}\n```"}
+	t.Cleanup(func() { bedrockClient = orig })
+
+	response, err := callBedrock(context.Background(), &Req{Text: "note about tides", Mode: "note", MaxTokens: 800, model: "us.meta.llama3-3-70b-instruct-v1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.parsePath != "structured" || response.Title != "Tides" || response.usage.InputTokens != 100 {
+		t.Errorf("response = %+v", response)
+	}
+}
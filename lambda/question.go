@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Sentences allowed in a question mode answer before the rest moves to expanded
+const maxAnswerSentences = 2
+
+// sentenceEnd matches the end of a sentence followed by whitespace
+var sentenceEnd = regexp.MustCompile(`[.!?]["')\]]*\s+`)
+
+// Answer is the question mode result: a one-screen answer, with optional detail for the phone
+type Answer struct {
+	Text     string `json:"text"`               // 1-2 sentence answer
+	Expanded string `json:"expanded,omitempty"` // optional longer explanation (markdown)
+}
+
+// finalizeAnswer keeps the answer to maxAnswerSentences, moving any overflow to the
+// start of the expanded section, and shows the answer on the watch face
+func finalizeAnswer(resp *Response) {
+	if resp.Answer == nil {
+		// Fallback path (unstructured model output): the reply is the answer
+		resp.Answer = &Answer{Text: plainText(resp.Markdown)}
+	}
+	answer := resp.Answer
+	answer.Text = strings.Join(strings.Fields(answer.Text), " ")
+	answer.Expanded = strings.TrimSpace(answer.Expanded)
+
+	if head, rest := splitSentences(answer.Text, maxAnswerSentences); rest != "" {
+		answer.Text = head
+		answer.Expanded = strings.TrimSpace(rest + "\n\n" + answer.Expanded)
+	}
+	if answer.Text != "" {
+		resp.ShortText = answer.Text
+	}
+}
+
+// splitSentences returns the first n sentences of text and the remainder
+func splitSentences(text string, n int) (string, string) {
+	ends := sentenceEnd.FindAllStringIndex(text, n)
+	if len(ends) < n {
+		return text, ""
+	}
+	cut := ends[n-1][1]
+	return strings.TrimSpace(text[:cut]), strings.TrimSpace(text[cut:])
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestFinalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name         string
+		resp         Response
+		wantText     string
+		wantExpanded string
+	}{
+		{
+			name:     "short answer",
+			resp:     Response{Answer: &Answer{Text: " Mount Everest is 8,849 m tall. "}},
+			wantText: "Mount Everest is 8,849 m tall.",
+		},
+		{
+			name:         "overflow moves to expanded",
+			resp:         Response{Answer: &Answer{Text: "It's 8,849 m. That was measured in 2020. Earlier surveys said 8,848 m.", Expanded: "China and Nepal agreed on it."}},
+			wantText:     "It's 8,849 m. That was measured in 2020.",
+			wantExpanded: "Earlier surveys said 8,848 m.\n\nChina and Nepal agreed on it.",
+		},
+		{
+			name:     "unstructured reply",
+			resp:     Response{Markdown: "**Paris** is the capital of France."},
+			wantText: "Paris is the capital of France.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.resp
+			finalizeAnswer(&resp)
+			if resp.Answer.Text != tt.wantText || resp.Answer.Expanded != tt.wantExpanded {
+				t.Errorf("answer = %+v, want text %q, expanded %q", *resp.Answer, tt.wantText, tt.wantExpanded)
+			}
+			if resp.ShortText != tt.wantText {
+				t.Errorf("ShortText = %q, want %q", resp.ShortText, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Sort key prefix for usage counters in the history table
+const usageSKPrefix = "USAGE#"
+
+// How long usage counters are kept after their window resets (for usage reporting)
+const usageRetention = 90 * 24 * time.Hour
+
+// QuotaLimits are per-principal caps; zero means unlimited
+type QuotaLimits struct {
+	DailyRequests   int64
+	MonthlyRequests int64
+	DailyTokens     int64
+	MonthlyTokens   int64
+}
+
+// usageWindow is one counter (day or month) for a principal
+type usageWindow struct {
+	Name         string // "daily" or "monthly"
+	SK           string
+	ResetAt      time.Time
+	RequestLimit int64
+	TokenLimit   int64
+}
+
+// QuotaExceeded describes which window blocked a request and when it resets
+type QuotaExceeded struct {
+	Window  string
+	ResetAt time.Time
+}
+
+func (q *QuotaExceeded) Error() string {
+	return fmt.Sprintf("%s quota exceeded, resets at %s", q.Window, q.ResetAt.Format(time.RFC3339))
+}
+
+// loadQuotaLimits reads QUOTA_DAILY_REQUESTS, QUOTA_MONTHLY_REQUESTS, QUOTA_DAILY_TOKENS
+// and QUOTA_MONTHLY_TOKENS
+func loadQuotaLimits() QuotaLimits {
+	return QuotaLimits{
+		DailyRequests:   quotaEnv("QUOTA_DAILY_REQUESTS"),
+		MonthlyRequests: quotaEnv("QUOTA_MONTHLY_REQUESTS"),
+		DailyTokens:     quotaEnv("QUOTA_DAILY_TOKENS"),
+		MonthlyTokens:   quotaEnv("QUOTA_MONTHLY_TOKENS"),
+	}
+}
+
+func quotaEnv(key string) int64 {
+	env := os.Getenv(key)
+	if env == "" {
+		return 0
+	}
+	value, err := strconv.ParseInt(env, 10, 64)
+	if err != nil || value < 0 {
+		log.Printf("Invalid %s value: %s, quota disabled", key, env)
+		return 0
+	}
+	return value
+}
+
+// usageWindows returns the day and month counters covering now (UTC)
+func usageWindows(limits QuotaLimits, now time.Time) []usageWindow {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return []usageWindow{
+		{
+			Name:         "daily",
+			SK:           usageSKPrefix + "D#" + day.Format("2006-01-02"),
+			ResetAt:      day.AddDate(0, 0, 1),
+			RequestLimit: limits.DailyRequests,
+			TokenLimit:   limits.DailyTokens,
+		},
+		{
+			Name:         "monthly",
+			SK:           usageSKPrefix + "M#" + month.Format("2006-01"),
+			ResetAt:      month.AddDate(0, 1, 0),
+			RequestLimit: limits.MonthlyRequests,
+			TokenLimit:   limits.MonthlyTokens,
+		},
+	}
+}
+
+// reserveQuota counts a request against the principal's daily and monthly usage, failing
+// with *QuotaExceeded if either window is already at its request or token cap.
+// Both counters are updated in one transaction so a rejected request isn't counted.
+// Storage errors fail open - quotas cap spend, they shouldn't take the API down.
+func reserveQuota(ctx context.Context, principal string, now time.Time) error {
+	if historyTableName == "" {
+		return nil
+	}
+
+	windows := usageWindows(loadQuotaLimits(), now)
+	items := make([]types.TransactWriteItem, len(windows))
+	for i, w := range windows {
+		update := &types.Update{
+			TableName:        aws.String(historyTableName),
+			Key:              usageKey(principal, w),
+			UpdateExpression: aws.String("ADD requests :one SET expiresAt = if_not_exists(expiresAt, :exp)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":one": &types.AttributeValueMemberN{Value: "1"},
+				":exp": &types.AttributeValueMemberN{Value: strconv.FormatInt(w.ResetAt.Add(usageRetention).Unix(), 10)},
+			},
+		}
+
+		var conditions []string
+		if w.RequestLimit > 0 {
+			conditions = append(conditions, "(attribute_not_exists(requests) OR requests < :requestLimit)")
+			update.ExpressionAttributeValues[":requestLimit"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(w.RequestLimit, 10)}
+		}
+		if w.TokenLimit > 0 {
+			conditions = append(conditions, "(attribute_not_exists(tokens) OR tokens < :tokenLimit)")
+			update.ExpressionAttributeValues[":tokenLimit"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(w.TokenLimit, 10)}
+		}
+		if len(conditions) > 0 {
+			update.ConditionExpression = aws.String(strings.Join(conditions, " AND "))
+		}
+		items[i] = types.TransactWriteItem{Update: update}
+	}
+
+	_, err := dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err == nil {
+		return nil
+	}
+
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for i, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" && i < len(windows) {
+				return &QuotaExceeded{Window: windows[i].Name, ResetAt: windows[i].ResetAt}
+			}
+		}
+	}
+	log.Printf("Quota check failed, allowing request: %v", err)
+	return nil
+}
+
+// recordTokenUsage adds a completed request's Bedrock tokens, and their estimated cost on
+// the model that answered, to the principal's counters and the monthly spend of the
+// deployment and the principal's tenant
+func recordTokenUsage(ctx context.Context, principal string, now time.Time, model string, usage Usage) {
+	tokens := usage.InputTokens + usage.OutputTokens
+	if historyTableName == "" || tokens == 0 {
+		return
+	}
+
+	windows := usageWindows(loadQuotaLimits(), now)
+	values := map[string]types.AttributeValue{
+		":tokens": &types.AttributeValueMemberN{Value: strconv.Itoa(tokens)},
+		":spend":  &types.AttributeValueMemberN{Value: strconv.FormatInt(spendMicros(model, usage), 10)},
+	}
+	spendPKs := []string{globalSpendPK}
+	if tenant, _ := splitPrincipal(principal); tenant != "" {
+		spendPKs = append(spendPKs, tenantSpendPK(tenant))
+	}
+	items := make([]types.TransactWriteItem, 0, len(windows)+len(spendPKs))
+	for _, w := range windows {
+		items = append(items, types.TransactWriteItem{Update: &types.Update{
+			TableName:                 aws.String(historyTableName),
+			Key:                       usageKey(principal, w),
+			UpdateExpression:          aws.String("ADD tokens :tokens, spendMicros :spend"),
+			ExpressionAttributeValues: values,
+		}})
+	}
+	month := windows[len(windows)-1]
+	for _, pk := range spendPKs {
+		items = append(items, types.TransactWriteItem{Update: &types.Update{
+			TableName: aws.String(historyTableName),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: pk},
+				"sk": &types.AttributeValueMemberS{Value: month.SK},
+			},
+			UpdateExpression: aws.String("ADD spendMicros :spend SET expiresAt = if_not_exists(expiresAt, :exp)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":spend": values[":spend"],
+				":exp":   &types.AttributeValueMemberN{Value: strconv.FormatInt(month.ResetAt.Add(usageRetention).Unix(), 10)},
+			},
+		}})
+	}
+
+	if _, err := dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items}); err != nil {
+		log.Printf("Failed to record token usage: %v", err)
+	}
+}
+
+// usageKey returns the history table key of a usage counter
+func usageKey(principal string, w usageWindow) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+		"sk": &types.AttributeValueMemberS{Value: w.SK},
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// useFakeDynamo swaps in a fake DynamoDB client and history table for the test
+func useFakeDynamo(t *testing.T, db *fakeDynamo) {
+	t.Helper()
+	origClient, origTable := dynamoClient, historyTableName
+	dynamoClient = db
+	historyTableName = "history"
+	t.Cleanup(func() {
+		dynamoClient, historyTableName = origClient, origTable
+	})
+}
+
+func TestUsageWindows(t *testing.T) {
+	now := time.Date(2025, 1, 31, 22, 30, 0, 0, time.UTC)
+	windows := usageWindows(QuotaLimits{DailyRequests: 50, MonthlyTokens: 100000}, now)
+
+	if windows[0].SK != "USAGE#D#2025-01-31" || !windows[0].ResetAt.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected daily window: %+v", windows[0])
+	}
+	if windows[1].SK != "USAGE#M#2025-01" || !windows[1].ResetAt.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected monthly window: %+v", windows[1])
+	}
+	if windows[0].RequestLimit != 50 || windows[1].TokenLimit != 100000 {
+		t.Errorf("Limits not applied: %+v", windows)
+	}
+}
+
+func TestLoadQuotaLimits(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "100")
+	t.Setenv("QUOTA_MONTHLY_REQUESTS", "-5")
+	t.Setenv("QUOTA_DAILY_TOKENS", "abc")
+	t.Setenv("QUOTA_MONTHLY_TOKENS", "2000000")
+
+	want := QuotaLimits{DailyRequests: 100, MonthlyTokens: 2000000}
+	if got := loadQuotaLimits(); got != want {
+		t.Errorf("loadQuotaLimits() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReserveQuota(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "20")
+	t.Setenv("QUOTA_MONTHLY_TOKENS", "")
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+
+	if err := reserveQuota(context.Background(), "user-123", time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(db.transactions) != 1 || len(db.transactions[0].TransactItems) != 2 {
+		t.Fatalf("Expected one transaction with two updates, got %+v", db.transactions)
+	}
+
+	daily := db.transactions[0].TransactItems[0].Update
+	if pk := daily.Key["pk"].(*types.AttributeValueMemberS).Value; pk != "USER#user-123" {
+		t.Errorf("Expected principal partition, got %s", pk)
+	}
+	if aws.ToString(daily.ConditionExpression) != "(attribute_not_exists(requests) OR requests < :requestLimit)" {
+		t.Errorf("Unexpected daily condition: %s", aws.ToString(daily.ConditionExpression))
+	}
+	if monthly := db.transactions[0].TransactItems[1].Update; monthly.ConditionExpression != nil {
+		t.Errorf("Expected unlimited monthly window to be unconditional, got %s", aws.ToString(monthly.ConditionExpression))
+	}
+}
+
+func TestReserveQuota_Exceeded(t *testing.T) {
+	t.Setenv("QUOTA_MONTHLY_REQUESTS", "500")
+	useFakeDynamo(t, &fakeDynamo{err: &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed")},
+		},
+	}})
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	err := reserveQuota(context.Background(), "user-123", now)
+
+	var exceeded *QuotaExceeded
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("Expected QuotaExceeded, got %v", err)
+	}
+	if exceeded.Window != "monthly" || !exceeded.ResetAt.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected quota result: %+v", exceeded)
+	}
+}
+
+func TestReserveQuota_FailsOpen(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{err: errors.New("throttled")})
+
+	if err := reserveQuota(context.Background(), "user-123", time.Now()); err != nil {
+		t.Errorf("Expected storage errors to fail open, got %v", err)
+	}
+}
+
+func TestRecordTokenUsage(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+
+	recordTokenUsage(context.Background(), "user-123", time.Now(), modelID, Usage{})
+	if len(db.transactions) != 0 {
+		t.Fatal("Expected no write for zero usage")
+	}
+
+	recordTokenUsage(context.Background(), "user-123", time.Now(), "anthropic.claude-haiku-4-5-20251001-v1:0", Usage{InputTokens: 120, OutputTokens: 80})
+	if len(db.transactions) != 1 {
+		t.Fatalf("Expected 1 transaction, got %d", len(db.transactions))
+	}
+	items := db.transactions[0].TransactItems
+	tokens := items[0].Update.ExpressionAttributeValues[":tokens"].(*types.AttributeValueMemberN).Value
+	if tokens != "200" {
+		t.Errorf("Expected 200 tokens recorded, got %s", tokens)
+	}
+	// 120 input tokens at $1/MTok plus 80 output tokens at $5/MTok
+	if len(items) != 3 || items[2].Update.Key["pk"].(*types.AttributeValueMemberS).Value != globalSpendPK {
+		t.Fatalf("Expected principal and global spend counters, got %d items", len(items))
+	}
+	if spend := items[2].Update.ExpressionAttributeValues[":spend"].(*types.AttributeValueMemberN).Value; spend != "520" {
+		t.Errorf("Expected 520 micro-dollars recorded, got %s", spend)
+	}
+
+	recordTokenUsage(context.Background(), "smith-family/user-123", time.Now(), modelID, Usage{InputTokens: 10})
+	items = db.transactions[1].TransactItems
+	if len(items) != 4 || items[3].Update.Key["pk"].(*types.AttributeValueMemberS).Value != tenantSpendPK("smith-family") {
+		t.Errorf("Expected the tenant's spend counter to be updated, got %d items", len(items))
+	}
+}
+
+func TestHandler_QuotaExceeded(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "1")
+	useFakeDynamo(t, &fakeDynamo{err: &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}},
+	}})
+
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Body:       `{"text":"hello"}`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.StatusCode != 429 {
+		t.Fatalf("Expected 429, got %d", resp.StatusCode)
+	}
+	if resp.Headers["Retry-After"] == "" {
+		t.Error("Expected Retry-After header")
+	}
+	if !strings.Contains(resp.Body, `"reason":"usage_quota_daily"`) {
+		t.Errorf("Expected machine-readable reason, got %s", resp.Body)
+	}
+}
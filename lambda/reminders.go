@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Hour a snooze to "tomorrow" lands on when no time is given
+const snoozeDefaultHour = 9
+
+// Reminder statuses GET /reminders filters by (status=, default pending)
+const (
+	reminderStatusPending   = "pending"
+	reminderStatusCompleted = "completed"
+	reminderStatusAll       = "all"
+)
+
+// Most stored reminders a page of GET /reminders reads, newest first
+const maxListedReminders = 500
+
+// reminderRequest is the body of PATCH /reminders/{id}: a snooze, a new due date, or
+// marking the reminder done
+type reminderRequest struct {
+	Snooze    string `json:"snooze,omitempty"`    // "+1h", "+2d", "tomorrow 9am", "today 17:00"
+	DueISO    string `json:"dueISO,omitempty"`    // reschedule to an RFC 3339 datetime
+	Timezone  string `json:"timezone,omitempty"`  // IANA timezone snoozes are read in, default the caller's preferred one, then UTC
+	Completed *bool  `json:"completed,omitempty"` // true marks the reminder done, false reopens it
+}
+
+// parseSnooze resolves a snooze against now with the grammar the model's dates use (see
+// resolveDate), so "+2d" or "tomorrow 9am" mean the same through the API as when
+// dictated. Relative snoozes count from now rather than the old due date, like snoozing
+// on a phone; a snooze must land in the future.
+func parseSnooze(snooze string, now time.Time, loc *time.Location) (time.Time, error) {
+	due, err := resolveDate(snooze, now, loc)
+	if err != nil {
+		return time.Time{}, errors.New(`snooze must look like "+1h", "+2d", "tomorrow 9am" or "friday 17:00"`)
+	}
+	if !due.After(now) {
+		return time.Time{}, errors.New("snooze time is in the past")
+	}
+	return due, nil
+}
+
+// applyReminderUpdate applies a validated PATCH body to a stored reminder. Snoozing or
+// rescheduling a completed reminder reopens it.
+func applyReminderUpdate(item *HistoryItem, body reminderRequest, now time.Time, preferred *time.Location) error {
+	if body.Completed != nil && body.Snooze == "" && body.DueISO == "" {
+		item.CompletedAt = ""
+		if *body.Completed {
+			item.CompletedAt = now.UTC().Format(time.RFC3339)
+		}
+		return nil
+	}
+	if body.Completed != nil {
+		return errors.New("completed can't be combined with snooze or dueISO")
+	}
+	due, err := resolveReminderDue(body, now, preferred)
+	if err != nil {
+		return err
+	}
+	item.DueISO = &due
+	item.CompletedAt = ""
+	return nil
+}
+
+// resolveReminderDue validates a snooze or reschedule and returns the new due date in UTC.
+// A snooze without a timezone is read in preferred, the caller's zone, as dictated dates are.
+func resolveReminderDue(body reminderRequest, now time.Time, preferred *time.Location) (string, error) {
+	if (body.Snooze == "") == (body.DueISO == "") {
+		return "", errors.New("exactly one of snooze, dueISO or completed is required")
+	}
+	if body.DueISO != "" {
+		due, err := time.Parse(time.RFC3339, body.DueISO)
+		if err != nil {
+			return "", errors.New("dueISO must be an RFC 3339 datetime")
+		}
+		return due.UTC().Format(time.RFC3339), nil
+	}
+
+	loc := preferred
+	if body.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(body.Timezone); err != nil {
+			return "", errors.New("timezone must be an IANA timezone, e.g. America/New_York")
+		}
+	}
+	due, err := parseSnooze(body.Snooze, now, loc)
+	if err != nil {
+		return "", err
+	}
+	return due.UTC().Format(time.RFC3339), nil
+}
+
+// ReminderResult is an updated reminder and the outcome of syncing it to the sinks that
+// hold a copy (see syncCapture)
+type ReminderResult struct {
+	HistoryItem
+	Deliveries []DeliveryResult `json:"deliveries,omitempty"`
+}
+
+// ReminderList is the body of GET /reminders; pass nextCursor back as cursor for the
+// reminders created before this page's
+type ReminderList struct {
+	Reminders  []HistoryItem `json:"reminders"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// filterReminders keeps the reminders with the given status that are due before
+// dueBefore (when set; undated reminders are then left out), soonest due first and
+// undated reminders last
+func filterReminders(items []HistoryItem, status string, dueBefore time.Time) []HistoryItem {
+	reminders := []HistoryItem{}
+	for _, item := range items {
+		completed := item.CompletedAt != ""
+		if (status == reminderStatusPending && completed) || (status == reminderStatusCompleted && !completed) {
+			continue
+		}
+		if !dueBefore.IsZero() {
+			if due, ok := reminderDue(item); !ok || !due.Before(dueBefore) {
+				continue
+			}
+		}
+		reminders = append(reminders, item)
+	}
+	sort.SliceStable(reminders, func(i, j int) bool {
+		a, aOK := reminderDue(reminders[i])
+		b, bOK := reminderDue(reminders[j])
+		if !aOK || !bOK {
+			return aOK && !bOK
+		}
+		return a.Before(b)
+	})
+	return reminders
+}
+
+// reminderDue returns when a stored reminder is due, if it has a due date
+func reminderDue(item HistoryItem) (time.Time, bool) {
+	if item.DueISO == nil {
+		return time.Time{}, false
+	}
+	due, err := time.Parse(time.RFC3339, *item.DueISO)
+	return due, err == nil
+}
+
+// isRemindersRequest reports whether the route is part of the reminders API
+func isRemindersRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	path = strings.TrimSuffix(path, "/")
+	return path == "/reminders" || strings.HasPrefix(path, "/reminders/")
+}
+
+// handleReminders serves GET /reminders, which lists stored reminders for the phone app,
+// PATCH /reminders/{id}, which snoozes, reschedules or completes one, and
+// POST /reminders/{id}/complete, a body-less way to mark one done. Updates return the
+// updated capture.
+func handleReminders(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	_, path := apiRoute(event)
+	id := event.PathParameters["id"]
+	var body reminderRequest
+	switch {
+	case id == "" && event.HTTPMethod == "GET":
+	case id != "" && strings.HasSuffix(path, "/complete") && event.HTTPMethod == "POST":
+		completed := true
+		body.Completed = &completed
+	case id != "" && !strings.HasSuffix(path, "/complete") && event.HTTPMethod == "PATCH":
+		if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+			return errorResponse(ctx, apierror.InvalidJSON())
+		}
+	default:
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+	if id == "" {
+		return listReminders(ctx, event)
+	}
+	return updateReminder(ctx, principalFromEvent(event), id, body, time.Now())
+}
+
+// listReminders answers GET /reminders?status=pending|completed|all&due_before=...&cursor=...,
+// where due_before is YYYY-MM-DD (the start of that UTC day) or an RFC 3339 datetime.
+// Pages hold the maxListedReminders most recently created reminders, each page sorted
+// by due date.
+func listReminders(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	status := event.QueryStringParameters["status"]
+	if status == "" {
+		status = reminderStatusPending
+	}
+	if status != reminderStatusPending && status != reminderStatusCompleted && status != reminderStatusAll {
+		return errorResponse(ctx, apierror.InvalidRequest("status must be pending, completed or all"))
+	}
+	dueBefore, err := parseSearchDate(event.QueryStringParameters["due_before"], false)
+	if err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest("due_before: "+err.Error()))
+	}
+
+	items, next, err := loadCapturesByActionPage(ctx, principalFromEvent(event), "reminder", maxListedReminders, event.QueryStringParameters["cursor"])
+	if errors.Is(err, errInvalidCursor) {
+		return errorResponse(ctx, apierror.InvalidRequest("invalid cursor"))
+	}
+	if err != nil {
+		log.Printf("Failed to load reminders: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load reminders"))
+	}
+	return apiResponse(200, ReminderList{Reminders: filterReminders(items, status, dueBefore), NextCursor: next})
+}
+
+// updateReminder applies a snooze, reschedule or completion to a stored reminder and
+// pushes the change to the sinks holding it, so Todoist or CalDAV show the new due date
+func updateReminder(ctx context.Context, principal, id string, body reminderRequest, now time.Time) events.APIGatewayProxyResponse {
+	item, err := loadCapture(ctx, principal, id)
+	if err != nil {
+		log.Printf("Failed to load reminder: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load reminder"))
+	}
+	if item == nil || item.Action != "reminder" {
+		return errorResponse(ctx, apierror.NotFound("Reminder not found"))
+	}
+
+	preferred := time.UTC
+	if body.Snooze != "" && body.Timezone == "" {
+		preferred = preferredLocation(ctx, principal)
+	}
+	if err := applyReminderUpdate(item, body, now, preferred); err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+	}
+	item.UpdatedAt = now.UTC().Format(time.RFC3339)
+	updated, err := saveReminderUpdate(ctx, *item)
+	if errors.Is(err, errReminderGone) {
+		return errorResponse(ctx, apierror.NotFound("Reminder not found"))
+	}
+	if err != nil {
+		log.Printf("Failed to save reminder: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to save reminder"))
+	}
+	return apiResponse(200, ReminderResult{HistoryItem: *updated, Deliveries: syncCapture(ctx, *updated)})
+}
+
+// preferredLocation is the caller's preferred timezone, or UTC when they have none or it
+// can't be read
+func preferredLocation(ctx context.Context, principal string) *time.Location {
+	prefs, err := loadPreferences(ctx, principal)
+	if err != nil {
+		log.Printf("Failed to load preferences, snoozing in UTC: %v", err)
+		return time.UTC
+	}
+	return requestLocation(&Req{preferences: &prefs})
+}
+
+// errReminderGone is returned when a reminder is removed between reading and updating it
+var errReminderGone = errors.New("reminder no longer exists")
+
+// saveReminderUpdate writes only the fields a reminder update changes (due date,
+// completion and updatedAt), so concurrent snoozes and completions of the same reminder
+// each land instead of the last whole-item write winning. It returns the stored item.
+func saveReminderUpdate(ctx context.Context, item HistoryItem) (*HistoryItem, error) {
+	set := []string{"updatedAt = :updatedAt"}
+	values := map[string]types.AttributeValue{
+		":updatedAt": &types.AttributeValueMemberS{Value: item.UpdatedAt},
+	}
+	var remove []string
+	if item.DueISO != nil {
+		set = append(set, "dueISO = :dueISO")
+		values[":dueISO"] = &types.AttributeValueMemberS{Value: *item.DueISO}
+	}
+	if item.CompletedAt != "" {
+		set = append(set, "completedAt = :completedAt")
+		values[":completedAt"] = &types.AttributeValueMemberS{Value: item.CompletedAt}
+	} else {
+		remove = append(remove, "completedAt")
+	}
+	expression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expression += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	out, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: item.PK},
+			"sk": &types.AttributeValueMemberS{Value: item.SK},
+		},
+		UpdateExpression:          aws.String(expression),
+		ExpressionAttributeValues: values,
+		ConditionExpression:       aws.String("attribute_exists(pk)"),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil, errReminderGone
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB UpdateItem failed: %w", err)
+	}
+	var updated HistoryItem
+	if err := attributevalue.UnmarshalMap(out.Attributes, &updated); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reminder: %w", err)
+	}
+	return &updated, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestParseSnooze(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 20, 30, 0, time.UTC) // Wednesday
+	newYork, _ := time.LoadLocation("America/New_York")
+	tests := []struct {
+		snooze string
+		loc    *time.Location
+		want   string
+	}{
+		{"+1h", time.UTC, "2025-01-15T15:20:00Z"},
+		{"+30m", time.UTC, "2025-01-15T14:50:00Z"},
+		{"+1h30m", time.UTC, "2025-01-15T15:50:00Z"},
+		{"+2d", time.UTC, "2025-01-17T14:20:00Z"},
+		{"tomorrow", time.UTC, "2025-01-16T09:00:00Z"},
+		{"Tomorrow 9am", time.UTC, "2025-01-16T09:00:00Z"},
+		{"tomorrow at 12:15pm", time.UTC, "2025-01-16T12:15:00Z"},
+		{"today 17:00", time.UTC, "2025-01-15T17:00:00Z"},
+		{"tomorrow 9am", newYork, "2025-01-16T14:00:00Z"},
+		{"+ 1h 30m", time.UTC, "2025-01-15T15:50:00Z"},
+		{"+1w", time.UTC, "2025-01-22T14:20:00Z"},
+		{"friday 5 pm", time.UTC, "2025-01-17T17:00:00Z"},
+	}
+	for _, tt := range tests {
+		got, err := parseSnooze(tt.snooze, now, tt.loc)
+		if err != nil {
+			t.Errorf("parseSnooze(%q) error: %v", tt.snooze, err)
+			continue
+		}
+		if s := got.UTC().Format(time.RFC3339); s != tt.want {
+			t.Errorf("parseSnooze(%q) = %s, want %s", tt.snooze, s, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "+0m", "later", "today", "today 9am", "tomorrow 13pm", "tomorrow 25:00", "yesterday 17:00"} {
+		if _, err := parseSnooze(bad, now, time.UTC); err == nil {
+			t.Errorf("parseSnooze(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestResolveReminderDue(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 20, 0, 0, time.UTC)
+	due, err := resolveReminderDue(reminderRequest{DueISO: "2025-02-01T10:00:00+01:00"}, now, time.UTC)
+	if err != nil || due != "2025-02-01T09:00:00Z" {
+		t.Errorf("reschedule = %q, %v", due, err)
+	}
+	for _, body := range []reminderRequest{
+		{},
+		{Snooze: "+1h", DueISO: "2025-02-01T10:00:00Z"},
+		{DueISO: "next week"},
+		{Snooze: "tomorrow", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := resolveReminderDue(body, now, time.UTC); err == nil {
+			t.Errorf("resolveReminderDue(%+v) succeeded, want error", body)
+		}
+	}
+}
+
+func TestHandleReminders(t *testing.T) {
+	call := func(method, id, principal, body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/reminders/{id}", Body: body}
+		event.PathParameters = map[string]string{"id": id}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("PATCH", "rem-1", "user-1", `{"snooze":"+1h"}`); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	store := &fakeS3{}
+	useSinks(t, &S3Sink{client: store, bucket: "captures"}, &stubSink{name: "notion"})
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["s3","notion"]}`)
+	due := "2025-01-15T09:00:00Z"
+	ctx := context.Background()
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "rem-1", Principal: "user-1", CreatedAt: time.Now()}, Response{Action: "reminder", Title: "Call mom", DueISO: &due}))
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "note-1", Principal: "user-1", CreatedAt: time.Now()}, Response{Action: "note", Title: "Garden"}))
+
+	t.Run("reschedule", func(t *testing.T) {
+		resp := call("PATCH", "rem-1", "user-1", `{"dueISO":"2030-06-01T08:00:00Z"}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+		var item HistoryItem
+		json.Unmarshal([]byte(resp.Body), &item)
+		if item.Title != "Call mom" || item.DueISO == nil || *item.DueISO != "2030-06-01T08:00:00Z" || item.UpdatedAt == "" {
+			t.Errorf("item = %+v", item)
+		}
+		stored, _ := loadCapture(ctx, "user-1", "rem-1")
+		if stored == nil || *stored.DueISO != "2030-06-01T08:00:00Z" {
+			t.Errorf("stored = %+v", stored)
+		}
+		// notion can't apply edits, so only s3 is synced
+		var result ReminderResult
+		json.Unmarshal([]byte(resp.Body), &result)
+		if len(result.Deliveries) != 1 || !result.Deliveries[0].OK || !strings.Contains(store.body, "2030-06-01T08:00:00Z") {
+			t.Errorf("deliveries = %+v, s3 body %q", result.Deliveries, store.body)
+		}
+	})
+
+	t.Run("snooze", func(t *testing.T) {
+		before := time.Now()
+		resp := call("PATCH", "rem-1", "user-1", `{"snooze":"+1h"}`)
+		var item HistoryItem
+		json.Unmarshal([]byte(resp.Body), &item)
+		got, err := time.Parse(time.RFC3339, *item.DueISO)
+		if resp.StatusCode != 200 || err != nil || got.Sub(before) < 59*time.Minute || got.Sub(before) > time.Hour {
+			t.Errorf("got %d, dueISO %s", resp.StatusCode, *item.DueISO)
+		}
+	})
+
+	t.Run("complete and reopen", func(t *testing.T) {
+		var item HistoryItem
+		json.Unmarshal([]byte(call("PATCH", "rem-1", "user-1", `{"completed":true}`).Body), &item)
+		if item.CompletedAt == "" {
+			t.Errorf("completed: %+v", item)
+		}
+		var reopened HistoryItem
+		json.Unmarshal([]byte(call("PATCH", "rem-1", "user-1", `{"snooze":"+1h"}`).Body), &reopened)
+		if reopened.CompletedAt != "" {
+			t.Errorf("snoozing should reopen: %+v", reopened)
+		}
+		if resp := call("PATCH", "rem-1", "user-1", `{"completed":true,"snooze":"+1h"}`); resp.StatusCode != 400 {
+			t.Errorf("completed with snooze: StatusCode = %d, want 400", resp.StatusCode)
+		}
+	})
+
+	t.Run("only changed fields are written", func(t *testing.T) {
+		call("PATCH", "rem-1", "user-1", `{"dueISO":"2030-06-02T08:00:00Z"}`)
+		update := db.updates[len(db.updates)-1]
+		if expr := aws.ToString(update.UpdateExpression); expr != "SET updatedAt = :updatedAt, dueISO = :dueISO REMOVE completedAt" {
+			t.Errorf("UpdateExpression = %s", expr)
+		}
+		if aws.ToString(update.ConditionExpression) != "attribute_exists(pk)" {
+			t.Errorf("ConditionExpression = %s", aws.ToString(update.ConditionExpression))
+		}
+	})
+
+	t.Run("snooze in the preferred timezone", func(t *testing.T) {
+		savePreferences(ctx, "user-1", Preferences{Timezone: "Asia/Tokyo"}, time.Now())
+		defer savePreferences(ctx, "user-1", Preferences{}, time.Now())
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		local := time.Now().In(tokyo)
+		want := time.Date(local.Year(), local.Month(), local.Day()+1, 9, 0, 0, 0, tokyo).UTC().Format(time.RFC3339)
+
+		var item HistoryItem
+		json.Unmarshal([]byte(call("PATCH", "rem-1", "user-1", `{"snooze":"tomorrow 9am"}`).Body), &item)
+		if derefOrEmpty(item.DueISO) != want {
+			t.Errorf("dueISO = %s, want %s", derefOrEmpty(item.DueISO), want)
+		}
+		// An explicit timezone still wins
+		json.Unmarshal([]byte(call("PATCH", "rem-1", "user-1", `{"snooze":"tomorrow 9am","timezone":"UTC"}`).Body), &item)
+		if due, _ := time.Parse(time.RFC3339, derefOrEmpty(item.DueISO)); due.Hour() != 9 {
+			t.Errorf("dueISO = %s, want 09:00 UTC", derefOrEmpty(item.DueISO))
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for _, tt := range []struct{ id, principal string }{{"missing", "user-1"}, {"note-1", "user-1"}, {"rem-1", "user-2"}} {
+			if resp := call("PATCH", tt.id, tt.principal, `{"snooze":"+1h"}`); resp.StatusCode != 404 {
+				t.Errorf("%s/%s: StatusCode = %d, want 404", tt.principal, tt.id, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if resp := call("PATCH", "rem-1", "user-1", `{"snooze":"whenever"}`); resp.StatusCode != 400 {
+			t.Errorf("StatusCode = %d, want 400", resp.StatusCode)
+		}
+		if resp := call("GET", "rem-1", "user-1", ""); resp.StatusCode != 405 {
+			t.Errorf("StatusCode = %d, want 405", resp.StatusCode)
+		}
+	})
+}
+
+func TestFilterReminders(t *testing.T) {
+	at := func(s string) *string { return &s }
+	items := []HistoryItem{
+		{ID: "later", DueISO: at("2025-03-20T09:00:00Z")},
+		{ID: "undated"},
+		{ID: "done", DueISO: at("2025-03-01T09:00:00Z"), CompletedAt: "2025-03-01T10:00:00Z"},
+		{ID: "soon", DueISO: at("2025-03-10T09:00:00Z")},
+	}
+	ids := func(items []HistoryItem) string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		status    string
+		dueBefore time.Time
+		want      string
+	}{
+		{status: reminderStatusPending, want: "soon,later,undated"},
+		{status: reminderStatusCompleted, want: "done"},
+		{status: reminderStatusAll, want: "done,soon,later,undated"},
+		{status: reminderStatusPending, dueBefore: time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC), want: "soon"},
+	}
+	for _, tt := range tests {
+		if got := ids(filterReminders(items, tt.status, tt.dueBefore)); got != tt.want {
+			t.Errorf("filterReminders(%s, %s) = %s, want %s", tt.status, tt.dueBefore, got, tt.want)
+		}
+	}
+}
+
+func TestHandleReminders_ListAndComplete(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	ctx := context.Background()
+	due, done := "2030-01-15T09:00:00Z", "2030-01-10T09:00:00Z"
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "rem-1", Principal: "user-1", CreatedAt: time.Now()}, Response{Action: "reminder", Title: "Call mom", DueISO: &due}))
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "rem-2", Principal: "user-1", CreatedAt: time.Now()}, Response{Action: "reminder", Title: "Pay rent", DueISO: &done}))
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: "note-1", Principal: "user-1", CreatedAt: time.Now()}, Response{Action: "note", Title: "Garden"}))
+
+	list := func(query map[string]string) (int, []HistoryItem) {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/reminders", QueryStringParameters: query}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(ctx, event)
+		var body ReminderList
+		json.Unmarshal([]byte(resp.Body), &body)
+		return resp.StatusCode, body.Reminders
+	}
+
+	event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Resource: "/reminders/{id}/complete", PathParameters: map[string]string{"id": "rem-2"}}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+	resp, _ := handler(ctx, event)
+	var completed HistoryItem
+	json.Unmarshal([]byte(resp.Body), &completed)
+	if resp.StatusCode != 200 || completed.CompletedAt == "" {
+		t.Fatalf("complete: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	if status, reminders := list(nil); status != 200 || len(reminders) != 1 || reminders[0].ID != "rem-1" {
+		t.Errorf("pending: %d %+v", status, reminders)
+	}
+	if _, reminders := list(map[string]string{"status": "completed"}); len(reminders) != 1 || reminders[0].ID != "rem-2" {
+		t.Errorf("completed: %+v", reminders)
+	}
+	if _, reminders := list(map[string]string{"status": "all", "due_before": "2030-01-12"}); len(reminders) != 1 || reminders[0].ID != "rem-2" {
+		t.Errorf("due_before: %+v", reminders)
+	}
+	for _, query := range []map[string]string{{"status": "snoozed"}, {"due_before": "next week"}} {
+		if status, _ := list(query); status != 400 {
+			t.Errorf("%v: StatusCode = %d, want 400", query, status)
+		}
+	}
+}
+
+func TestHandleReminders_ListPages(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		created := start.Add(time.Duration(i) * time.Hour)
+		saveCapture(ctx, newHistoryItem(captureMeta{ID: captureIDAt(created), Principal: "user-1", CreatedAt: created}, Response{Action: "reminder", Title: fmt.Sprintf("r%d", i)}))
+	}
+	saveCapture(ctx, newHistoryItem(captureMeta{ID: captureIDAt(start.Add(90 * time.Minute)), Principal: "user-1", CreatedAt: start}, Response{Action: "note", Title: "n"}))
+
+	var titles []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		items, next, err := loadCapturesByActionPage(ctx, "user-1", "reminder", 2, cursor)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		for _, item := range items {
+			titles = append(titles, item.Title)
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	if strings.Join(titles, ",") != "r4,r3,r2,r1,r0" {
+		t.Errorf("paged titles = %v", titles)
+	}
+	if _, _, err := loadCapturesByActionPage(ctx, "user-1", "reminder", 2, "not base64!"); !errors.Is(err, errInvalidCursor) {
+		t.Errorf("invalid cursor error = %v", err)
+	}
+
+	list := func(query map[string]string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/reminders", QueryStringParameters: query}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(ctx, event)
+		return resp
+	}
+	var body ReminderList
+	resp := list(nil)
+	json.Unmarshal([]byte(resp.Body), &body)
+	if resp.StatusCode != 200 || len(body.Reminders) != 5 || body.NextCursor != "" {
+		t.Errorf("list = %d, %d reminders, nextCursor %q", resp.StatusCode, len(body.Reminders), body.NextCursor)
+	}
+	if resp := list(map[string]string{"cursor": "%%%"}); resp.StatusCode != 400 {
+		t.Errorf("invalid cursor: StatusCode = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Replay protection (REPLAY_PROTECTION). A client opts in by sending X-Wrist-Timestamp
+// (Unix seconds) and X-Wrist-Nonce with a request: it is refused when the timestamp is
+// outside the skew window or the nonce was already used, so a captured request can't
+// be sent again.
+const (
+	replayProtectionOff      = "off"      // headers are ignored
+	replayProtectionOptional = "optional" // requests carrying the headers are checked
+	replayProtectionRequired = "required" // every request must carry them
+)
+
+const (
+	nonceHeader         = "X-Wrist-Nonce"
+	noncePKPrefix       = "NONCE#"
+	defaultReplayWindow = 5 * time.Minute
+
+	// replayStoreRetryAfter is the back-off hint when the nonce can't be recorded
+	replayStoreRetryAfter = 2 * time.Second
+)
+
+// noncePattern bounds nonces to something a client generates, e.g. a UUID or 16+ random
+// bytes in hex or base64url
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+// localNonces remembers nonces in this instance when there is no history table; it
+// can't see other instances, so deployments that rely on the check need the table
+var localNonces = struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // nonce key -> when it can be forgotten
+}{seen: map[string]time.Time{}}
+
+// replayWindow is how far a request timestamp may be from the server clock
+// (REPLAY_WINDOW_SECONDS, default 300)
+func replayWindow() time.Duration {
+	if seconds, err := strconv.Atoi(getEnv("REPLAY_WINDOW_SECONDS", "")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultReplayWindow
+}
+
+// checkReplay enforces replay protection on an API request, returning the error to
+// answer with when the request is stale, replayed or missing required headers
+func checkReplay(ctx context.Context, event events.APIGatewayProxyRequest, now time.Time) *apierror.Error {
+	mode := strings.ToLower(getEnv("REPLAY_PROTECTION", replayProtectionOptional))
+	if mode == replayProtectionOff {
+		return nil
+	}
+	timestamp, nonce := requestHeader(event, timestampHeader), requestHeader(event, nonceHeader)
+	if timestamp == "" && nonce == "" {
+		if mode == replayProtectionRequired {
+			return replayError("X-Wrist-Timestamp and X-Wrist-Nonce headers are required", "replay_headers_missing")
+		}
+		return nil
+	}
+	if timestamp == "" || nonce == "" {
+		return apierror.InvalidRequest("X-Wrist-Timestamp and X-Wrist-Nonce must be sent together")
+	}
+	if !noncePattern.MatchString(nonce) {
+		return apierror.InvalidRequest("X-Wrist-Nonce must be 16-128 letters, digits, '-' or '_'")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return apierror.InvalidRequest("X-Wrist-Timestamp must be Unix seconds")
+	}
+
+	window := replayWindow()
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > window || skew < -window {
+		return replayError(fmt.Sprintf("request timestamp is more than %d seconds from the server clock", int(window.Seconds())), "request_expired").
+			WithDetail("serverTime", now.Unix())
+	}
+
+	// A nonce is remembered for twice the window, past the last moment its timestamp is accepted
+	fresh, err := rememberNonce(ctx, principalFromEvent(event), nonce, now, now.Add(2*window))
+	if err != nil && mode == replayProtectionRequired {
+		// Required mode never lets an unchecked request through; the client retries with
+		// a fresh nonce, in case this one was recorded after all
+		log.Printf("Failed to record request nonce, refusing the request: %v", err)
+		return apierror.New(503, apierror.CodeServiceUnavailable, "Replay protection is temporarily unavailable. Please try again shortly.").
+			WithReason("replay_check_unavailable").
+			WithRetryAfter(replayStoreRetryAfter)
+	}
+	if err != nil {
+		log.Printf("Failed to record request nonce, allowing the request: %v", err)
+		return nil
+	}
+	if !fresh {
+		log.Printf("Replayed request refused for principal %s", principalFromEvent(event))
+		return replayError("request nonce was already used", "request_replayed")
+	}
+	return nil
+}
+
+// replayError is the 401 for a request refused by replay protection
+func replayError(message, reason string) *apierror.Error {
+	return apierror.New(401, apierror.CodeUnauthorized, message).WithReason(reason)
+}
+
+// rememberNonce records a principal's nonce until expires, reporting false if it was
+// already recorded. Nonces live in the history table (expired by its TTL) so every
+// instance sees them.
+func rememberNonce(ctx context.Context, principal, nonce string, now, expires time.Time) (bool, error) {
+	if historyTableName == "" {
+		return rememberLocalNonce(principal+"#"+nonce, now, expires), nil
+	}
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item: map[string]types.AttributeValue{
+			"pk":        &types.AttributeValueMemberS{Value: noncePKPrefix + principal},
+			"sk":        &types.AttributeValueMemberS{Value: nonce},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+		},
+		// TTL deletion lags, so an expired item counts as free
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return true, nil
+}
+
+// rememberLocalNonce is rememberNonce for this instance only, forgetting expired nonces
+// as it goes
+func rememberLocalNonce(key string, now, expires time.Time) bool {
+	localNonces.mu.Lock()
+	defer localNonces.mu.Unlock()
+	for seen, until := range localNonces.seen {
+		if now.After(until) {
+			delete(localNonces.seen, seen)
+		}
+	}
+	if _, ok := localNonces.seen[key]; ok {
+		return false
+	}
+	localNonces.seen[key] = expires
+	return true
+}
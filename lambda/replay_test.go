@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// nonceDynamo evaluates the conditional put that records a nonce
+type nonceDynamo struct {
+	fakeDynamo
+	seen map[string]bool
+}
+
+func (f *nonceDynamo) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := params.Item["pk"].(*types.AttributeValueMemberS).Value + "/" + params.Item["sk"].(*types.AttributeValueMemberS).Value
+	if f.seen[key] {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	f.seen[key] = true
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// useNonceDynamo swaps in a nonceDynamo as the history table for the test
+func useNonceDynamo(t *testing.T) {
+	t.Helper()
+	origClient, origTable := dynamoClient, historyTableName
+	dynamoClient, historyTableName = &nonceDynamo{seen: map[string]bool{}}, "history"
+	t.Cleanup(func() { dynamoClient, historyTableName = origClient, origTable })
+}
+
+func replayEvent(timestamp, nonce string) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/modes", Headers: map[string]string{}}
+	if timestamp != "" {
+		event.Headers["x-wrist-timestamp"] = timestamp
+	}
+	if nonce != "" {
+		event.Headers["x-wrist-nonce"] = nonce
+	}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+	return event
+}
+
+func TestCheckReplay(t *testing.T) {
+	useNonceDynamo(t)
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	nonce := "3f2a9c1e-7b4d-4e8a-9f6b-2c1d0e5a7b3c"
+
+	if apiErr := checkReplay(context.Background(), replayEvent(ts, nonce), now); apiErr != nil {
+		t.Fatalf("first use: %v", apiErr)
+	}
+
+	tests := []struct {
+		name       string
+		event      events.APIGatewayProxyRequest
+		wantStatus int
+		wantReason string
+	}{
+		{name: "replayed nonce", event: replayEvent(ts, nonce), wantStatus: 401, wantReason: "request_replayed"},
+		{name: "stale timestamp", event: replayEvent(strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), "a-fresh-nonce-0000001"), wantStatus: 401, wantReason: "request_expired"},
+		{name: "future timestamp", event: replayEvent(strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), "a-fresh-nonce-0000002"), wantStatus: 401, wantReason: "request_expired"},
+		{name: "nonce without timestamp", event: replayEvent("", "a-fresh-nonce-0000003"), wantStatus: 400},
+		{name: "short nonce", event: replayEvent(ts, "abc"), wantStatus: 400},
+		{name: "bad timestamp", event: replayEvent("yesterday", "a-fresh-nonce-0000004"), wantStatus: 400},
+		{name: "within the skew window", event: replayEvent(strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), "a-fresh-nonce-0000005")},
+		{name: "no headers", event: replayEvent("", "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := checkReplay(context.Background(), tt.event, now)
+			if tt.wantStatus == 0 {
+				if apiErr != nil {
+					t.Errorf("checkReplay() = %v, want nil", apiErr)
+				}
+				return
+			}
+			if apiErr == nil || apiErr.Status != tt.wantStatus {
+				t.Fatalf("checkReplay() = %v, want status %d", apiErr, tt.wantStatus)
+			}
+			if tt.wantReason != "" && (apiErr.Code != apierror.CodeUnauthorized || apiErr.Details["reason"] != tt.wantReason) {
+				t.Errorf("error = %+v, want reason %s", apiErr, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCheckReplay_Modes(t *testing.T) {
+	now := time.Now()
+
+	t.Setenv("REPLAY_PROTECTION", "required")
+	if apiErr := checkReplay(context.Background(), replayEvent("", ""), now); apiErr == nil || apiErr.Details["reason"] != "replay_headers_missing" {
+		t.Errorf("required without headers: %v", apiErr)
+	}
+
+	t.Setenv("REPLAY_PROTECTION", "off")
+	if apiErr := checkReplay(context.Background(), replayEvent("0", "x"), now); apiErr != nil {
+		t.Errorf("off: %v", apiErr)
+	}
+
+	// A nonce store outage fails open only when the check is optional
+	useFakeDynamo(t, &fakeDynamo{err: errors.New("throttled")})
+	ts := strconv.FormatInt(now.Unix(), 10)
+	t.Setenv("REPLAY_PROTECTION", "optional")
+	if apiErr := checkReplay(context.Background(), replayEvent(ts, "a-fresh-nonce-0000010"), now); apiErr != nil {
+		t.Errorf("optional with the store down: %v", apiErr)
+	}
+	t.Setenv("REPLAY_PROTECTION", "required")
+	apiErr := checkReplay(context.Background(), replayEvent(ts, "a-fresh-nonce-0000011"), now)
+	if apiErr == nil || apiErr.Status != 503 || !apiErr.Retryable || apiErr.Details["reason"] != "replay_check_unavailable" {
+		t.Errorf("required with the store down: %+v", apiErr)
+	}
+}
+
+func TestCheckReplay_LocalNonces(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	historyTableName = ""
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	if apiErr := checkReplay(context.Background(), replayEvent(ts, "local-nonce-000000001"), now); apiErr != nil {
+		t.Fatalf("first use: %v", apiErr)
+	}
+	if apiErr := checkReplay(context.Background(), replayEvent(ts, "local-nonce-000000001"), now); apiErr == nil {
+		t.Error("replay within this instance should be refused")
+	}
+}
+
+func TestHandler_ReplayedRequest(t *testing.T) {
+	useNonceDynamo(t)
+	event := replayEvent(strconv.FormatInt(time.Now().Unix(), 10), "handler-nonce-0000001")
+
+	if resp, _ := handler(context.Background(), event); resp.StatusCode != 200 {
+		t.Fatalf("first request: StatusCode = %d", resp.StatusCode)
+	}
+	if resp, _ := handler(context.Background(), event); resp.StatusCode != 401 {
+		t.Errorf("replay: StatusCode = %d, want 401", resp.StatusCode)
+	}
+}
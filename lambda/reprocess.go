@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"wrist-agent/apierror"
+)
+
+// Where POST /admin/reprocess takes captures from
+const (
+	reprocessSourceDLQ     = "dlq"     // jobs that failed every attempt (JOB_DLQ_URL)
+	reprocessSourcePending = "pending" // captures saved while Bedrock was down
+)
+
+// Batch limits for POST /admin/reprocess. Captures are replayed one after another inside
+// the request, so the batch also stops starting new replays after reprocessTimeBudget to
+// answer within API Gateway's 29-second limit.
+const (
+	defaultReprocessLimit = 5
+	maxReprocessLimit     = 25
+	reprocessTimeBudget   = 20 * time.Second
+)
+
+// deadLetterAPI is the subset of the SQS client used to read the job dead-letter queue
+type deadLetterAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+var (
+	deadLetterClient deadLetterAPI
+	jobDLQURL        string
+)
+
+// ReprocessRequest is the body of POST /admin/reprocess
+type ReprocessRequest struct {
+	Source string `json:"source"` // dlq or pending
+	Limit  int    `json:"limit"`  // captures to replay, default 5, at most 25
+}
+
+// ReprocessResult is one replayed capture
+type ReprocessResult struct {
+	JobID  string `json:"jobId"`
+	Status string `json:"status"`          // succeeded or failed
+	Error  string `json:"error,omitempty"` // error code and message when it failed again
+}
+
+// ReprocessReport is the response of POST /admin/reprocess
+type ReprocessReport struct {
+	Source    string            `json:"source"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Truncated bool              `json:"truncated,omitempty"` // stopped early to answer in time; call again for the rest
+	Results   []ReprocessResult `json:"results"`
+}
+
+// isReprocessRequest reports whether the route is the admin reprocessing endpoint
+func isReprocessRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/admin/reprocess"
+}
+
+// handleReprocess serves POST /admin/reprocess: it replays a batch of failed jobs from the
+// dead-letter queue or of pending captures through the pipeline and reports how each went.
+// The caller is already known to be an admin.
+func handleReprocess(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "POST" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	var body ReprocessRequest
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	if body.Limit == 0 {
+		body.Limit = defaultReprocessLimit
+	}
+	if body.Limit < 0 || body.Limit > maxReprocessLimit {
+		return errorResponse(ctx, apierror.InvalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxReprocessLimit)))
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("history storage not configured"))
+	}
+
+	deadline := time.Now().Add(reprocessTimeBudget)
+	var report *ReprocessReport
+	var err error
+	switch body.Source {
+	case reprocessSourceDLQ:
+		if jobDLQURL == "" {
+			return errorResponse(ctx, apierror.NotConfigured("job dead-letter queue not configured"))
+		}
+		report, err = reprocessDeadLetters(ctx, body.Limit, deadline)
+	case reprocessSourcePending:
+		report, err = reprocessPending(ctx, body.Limit, deadline)
+	default:
+		return errorResponse(ctx, apierror.InvalidRequest(fmt.Sprintf("invalid source: %s (valid: %s, %s)", body.Source, reprocessSourceDLQ, reprocessSourcePending)))
+	}
+	if err != nil {
+		log.Printf("Reprocessing %s failed: %v", body.Source, err)
+		return errorResponse(ctx, apierror.Internal("Failed to read captures to reprocess"))
+	}
+	log.Printf("Reprocessed %s: %d succeeded, %d failed", body.Source, report.Succeeded, report.Failed)
+	return apiResponse(200, report)
+}
+
+// reprocessDeadLetters replays jobs from the dead-letter queue. Replayed messages are
+// deleted; ones that fail again stay and reappear after the queue's visibility timeout.
+func reprocessDeadLetters(ctx context.Context, limit int, deadline time.Time) (*ReprocessReport, error) {
+	report := &ReprocessReport{Source: reprocessSourceDLQ, Results: []ReprocessResult{}}
+	for len(report.Results) < limit {
+		out, err := deadLetterClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(jobDLQURL),
+			MaxNumberOfMessages: int32(min(limit-len(report.Results), 10)), // SQS's per-call maximum
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ReceiveMessage failed: %w", err)
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		for _, message := range out.Messages {
+			if time.Now().After(deadline) {
+				// Unstarted messages reappear after the visibility timeout
+				report.Truncated = true
+				return report, nil
+			}
+			var msg jobMessage
+			if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &msg); err != nil || msg.JobID == "" {
+				report.add(ReprocessResult{JobID: aws.ToString(message.MessageId), Status: jobFailed, Error: "malformed job message"})
+				continue
+			}
+			result := replayJob(ctx, msg)
+			if result.Status == jobSucceeded {
+				if _, err := deadLetterClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+					QueueUrl:      aws.String(jobDLQURL),
+					ReceiptHandle: message.ReceiptHandle,
+				}); err != nil {
+					log.Printf("Failed to delete replayed job %s from the dead-letter queue: %v", msg.JobID, err)
+				}
+			}
+			report.add(result)
+		}
+	}
+	return report, nil
+}
+
+// reprocessPending replays pending captures. Each is claimed first, so the pendingCaptures
+// schedule can't queue it as well; one that fails again is recorded as a failed job.
+func reprocessPending(ctx context.Context, limit int, deadline time.Time) (*ReprocessReport, error) {
+	report := &ReprocessReport{Source: reprocessSourcePending, Results: []ReprocessResult{}}
+	entries, malformed, err := loadPendingCaptures(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	report.Failed = malformed
+	for _, entry := range entries {
+		if time.Now().After(deadline) {
+			report.Truncated = true
+			break
+		}
+		if err := claimPendingCapture(ctx, entry.item, entry.msg); err != nil {
+			log.Printf("Failed to claim pending capture %s: %v", entry.msg.JobID, err)
+			report.add(ReprocessResult{JobID: entry.msg.JobID, Status: jobFailed, Error: "already being processed"})
+			continue
+		}
+		report.add(replayJob(ctx, entry.msg))
+	}
+	return report, nil
+}
+
+// replayJob runs a job's request through the pipeline once more and records the outcome
+// on the job, as the worker's last attempt would
+func replayJob(ctx context.Context, msg jobMessage) ReprocessResult {
+	ctx = apierror.WithRequestID(ctx, msg.JobID)
+	job := startJob(ctx, msg, 1)
+	response, apiErr := runJob(ctx, msg)
+	finishJob(ctx, job, msg, response, apiErr)
+	if apiErr != nil {
+		return ReprocessResult{JobID: msg.JobID, Status: jobFailed, Error: fmt.Sprintf("%s: %s", apiErr.Code, apiErr.Message)}
+	}
+	return ReprocessResult{JobID: msg.JobID, Status: jobSucceeded}
+}
+
+// add appends a result and counts it
+func (r *ReprocessReport) add(result ReprocessResult) {
+	r.Results = append(r.Results, result)
+	if result.Status == jobSucceeded {
+		r.Succeeded++
+	} else {
+		r.Failed++
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fakeDeadLetters serves queued messages and records deleted receipt handles
+type fakeDeadLetters struct {
+	messages []sqstypes.Message
+	deleted  []string
+}
+
+func (f *fakeDeadLetters) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	n := min(int(params.MaxNumberOfMessages), len(f.messages))
+	out := &sqs.ReceiveMessageOutput{Messages: f.messages[:n]}
+	f.messages = f.messages[n:]
+	return out, nil
+}
+
+func (f *fakeDeadLetters) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// useDeadLetters swaps in a fake dead-letter queue for the test
+func useDeadLetters(t *testing.T, dlq *fakeDeadLetters) {
+	t.Helper()
+	origClient, origURL := deadLetterClient, jobDLQURL
+	deadLetterClient, jobDLQURL = dlq, "https://sqs.us-west-2.amazonaws.com/123456789012/jobs-dlq"
+	t.Cleanup(func() { deadLetterClient, jobDLQURL = origClient, origURL })
+}
+
+// deadLetter builds a dead-lettered job message
+func deadLetter(id string) sqstypes.Message {
+	body, _ := json.Marshal(jobMessage{
+		JobID:      id,
+		Principal:  "user-1",
+		APIVersion: 1,
+		CreatedAt:  time.Now().UTC(),
+		Request:    Req{Text: "buy milk", Mode: "reminder", MaxTokens: 800},
+	})
+	return sqstypes.Message{MessageId: aws.String("msg-" + id), ReceiptHandle: aws.String("receipt-" + id), Body: aws.String(string(body))}
+}
+
+func reprocess(t *testing.T, body string) (int, ReprocessReport) {
+	t.Helper()
+	resp, _ := handler(context.Background(), adminEvent("POST", "/admin/reprocess", "", body))
+	var report ReprocessReport
+	json.Unmarshal([]byte(resp.Body), &report)
+	return resp.StatusCode, report
+}
+
+func TestHandleReprocess_DeadLetters(t *testing.T) {
+	db := &fakeDynamo{}
+	useJobQueue(t, &fakeSQS{}, db)
+	useBreaker(t, &CircuitBreaker{})
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"reminder","title":"Buy milk","markdown":"Buy milk"}`})
+	dlq := &fakeDeadLetters{messages: []sqstypes.Message{deadLetter("job-1"), {MessageId: aws.String("msg-bad"), Body: aws.String("not json")}, deadLetter("job-3")}}
+	useDeadLetters(t, dlq)
+
+	status, report := reprocess(t, `{"source":"dlq","limit":2}`)
+	if status != 200 {
+		t.Fatalf("StatusCode = %d", status)
+	}
+	if report.Succeeded != 1 || report.Failed != 1 || len(report.Results) != 2 || report.Results[1].JobID != "msg-bad" {
+		t.Errorf("report = %+v", report)
+	}
+	// Only the replayed message leaves the queue; the rest of the batch waits for the next call
+	if len(dlq.deleted) != 1 || dlq.deleted[0] != "receipt-job-1" || len(dlq.messages) != 1 {
+		t.Errorf("deleted = %v, left %d", dlq.deleted, len(dlq.messages))
+	}
+	job, _ := loadJob(context.Background(), "user-1", "job-1")
+	if job == nil || job.Status != jobSucceeded {
+		t.Errorf("job = %+v, want succeeded", job)
+	}
+}
+
+func TestHandleReprocess_FailsAgain(t *testing.T) {
+	useJobQueue(t, &fakeSQS{}, &fakeDynamo{})
+	openBreaker(t)
+	dlq := &fakeDeadLetters{messages: []sqstypes.Message{deadLetter("job-1")}}
+	useDeadLetters(t, dlq)
+
+	_, report := reprocess(t, `{"source":"dlq"}`)
+	if report.Failed != 1 || report.Results[0].Status != jobFailed || report.Results[0].Error == "" {
+		t.Errorf("report = %+v", report)
+	}
+	if len(dlq.deleted) != 0 {
+		t.Errorf("failed message deleted from the dead-letter queue")
+	}
+}
+
+func TestHandleReprocess_Pending(t *testing.T) {
+	db := &fakeDynamo{items: []map[string]interface{}{pendingItem(t, "20250301T120000Z-aaaa")}}
+	useJobQueue(t, &fakeSQS{}, db)
+	useBreaker(t, &CircuitBreaker{})
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"reminder","title":"Buy milk","markdown":"Buy milk"}`})
+
+	status, report := reprocess(t, `{"source":"pending"}`)
+	if status != 200 || report.Source != reprocessSourcePending || report.Succeeded != 1 {
+		t.Fatalf("StatusCode = %d, report = %+v", status, report)
+	}
+	// The capture is claimed before it is replayed
+	if len(db.transactions) == 0 || db.transactions[0].TransactItems[0].Delete == nil {
+		t.Errorf("transactions = %v, want the pending capture claimed", db.transactions)
+	}
+}
+
+func TestHandleReprocess_Validation(t *testing.T) {
+	useJobQueue(t, &fakeSQS{}, &fakeDynamo{})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "unknown source", body: `{"source":"inbox"}`, status: 400},
+		{name: "limit over the maximum", body: `{"source":"pending","limit":26}`, status: 400},
+		{name: "negative limit", body: `{"source":"pending","limit":-1}`, status: 400},
+		{name: "bad json", body: `{`, status: 400},
+		{name: "dead-letter queue not configured", body: `{"source":"dlq"}`, status: 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := reprocess(t, tt.body); status != tt.status {
+				t.Errorf("StatusCode = %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	event := adminEvent("GET", "/admin/reprocess", "", "")
+	if resp, _ := handler(context.Background(), event); resp.StatusCode != 405 {
+		t.Errorf("GET: StatusCode = %d, want 405", resp.StatusCode)
+	}
+	event.RequestContext.Authorizer["role"] = ""
+	event.HTTPMethod = "POST"
+	if resp, _ := handler(context.Background(), event); resp.StatusCode != 403 {
+		t.Errorf("non-admin: StatusCode = %d, want 403", resp.StatusCode)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	agenttypes "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+
+	"wrist-agent/apierror"
+)
+
+// Research workflow steps, in order. Each runs as a Step Functions task invoking this
+// function with {"workflowStep": <step>, "state": <researchState>}.
+const (
+	stepPlan       = "plan"
+	stepLookup     = "lookup"
+	stepSynthesize = "synthesize"
+	stepSummarize  = "summarize"
+	stepFinish     = "finish"
+	stepFail       = "fail" // catch-all after retries are exhausted
+)
+
+// Research plan size and per-step token budgets
+const (
+	maxResearchQuestions  = 4
+	planMaxTokens         = 400
+	lookupMaxTokens       = 500
+	summaryMaxTokens      = 300
+	knowledgeBaseResults  = 3
+	maxFindingExcerptChar = 1500
+)
+
+// sfnAPI is the subset of the Step Functions client used to start research workflows
+type sfnAPI interface {
+	StartExecution(ctx context.Context, params *sfn.StartExecutionInput, optFns ...func(*sfn.Options)) (*sfn.StartExecutionOutput, error)
+}
+
+// knowledgeBaseAPI is the subset of the Bedrock agent runtime client used for lookups
+type knowledgeBaseAPI interface {
+	Retrieve(ctx context.Context, params *bedrockagentruntime.RetrieveInput, optFns ...func(*bedrockagentruntime.Options)) (*bedrockagentruntime.RetrieveOutput, error)
+}
+
+var (
+	sfnClient               sfnAPI
+	knowledgeBaseClient     knowledgeBaseAPI
+	researchStateMachineArn string // RESEARCH_STATE_MACHINE_ARN; empty runs research jobs in one step
+	researchKnowledgeBaseID string // RESEARCH_KNOWLEDGE_BASE_ID; empty answers lookups with the model
+)
+
+// researchFinding is the result of looking up one planned question
+type researchFinding struct {
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Sources  []string `json:"sources,omitempty"`
+}
+
+// workflowFailure is the error Step Functions catches into $.error
+type workflowFailure struct {
+	Error string `json:"Error"`
+	Cause string `json:"Cause"`
+}
+
+// researchState is the workflow state passed between steps
+type researchState struct {
+	Job       jobMessage        `json:"job"`
+	Completed []string          `json:"completed,omitempty"`
+	Questions []string          `json:"questions,omitempty"`
+	Findings  []researchFinding `json:"findings,omitempty"`
+	Response  *Response         `json:"response,omitempty"`
+	Failure   *workflowFailure  `json:"error,omitempty"`
+}
+
+// workflowEvent is the payload of a research workflow task
+type workflowEvent struct {
+	Step  string        `json:"workflowStep"`
+	State researchState `json:"state"`
+}
+
+// retryableStepError marks step failures the state machine retries (throttling, Bedrock
+// outages). Step Functions matches it by its Lambda error type, "retryableStepError".
+type retryableStepError struct {
+	err *apierror.Error
+}
+
+func (e *retryableStepError) Error() string { return e.err.Error() }
+
+// usesResearchWorkflow reports whether an async request runs as a Step Functions workflow
+func usesResearchWorkflow(req *Req) bool {
+	// The workflow steps only see text, so image and audio requests take the queue
+	if req.ImageKey != "" || req.AudioKey != "" {
+		return false
+	}
+	return req.Mode == "research" && researchStateMachineArn != "" && sfnClient != nil
+}
+
+// startResearchWorkflow starts the research state machine for a queued job. The job ID
+// names the execution, so a duplicate start is rejected rather than run twice.
+func startResearchWorkflow(ctx context.Context, msg jobMessage) error {
+	input, err := json.Marshal(researchState{Job: msg})
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow input: %w", err)
+	}
+	_, err = sfnClient.StartExecution(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: aws.String(researchStateMachineArn),
+		Name:            aws.String(msg.JobID),
+		Input:           aws.String(string(input)),
+	})
+	if err != nil {
+		return fmt.Errorf("StartExecution failed: %w", err)
+	}
+	return nil
+}
+
+// handleWorkflowStep runs one research step and returns the updated state. The job
+// record is checkpointed before each step so GET /jobs/{id} shows progress.
+func handleWorkflowStep(ctx context.Context, event workflowEvent) (researchState, error) {
+	state := event.State
+	msg := state.Job
+	ctx = apierror.WithRequestID(ctx, msg.JobID)
+
+	if event.Step == stepFail {
+		failResearchJob(ctx, state)
+		return state, nil
+	}
+	checkpointResearchJob(ctx, state, event.Step)
+
+	var err error
+	switch event.Step {
+	case stepPlan:
+		err = planResearch(ctx, &state)
+	case stepLookup:
+		err = lookupResearch(ctx, &state)
+	case stepSynthesize:
+		err = synthesizeResearch(ctx, &state)
+	case stepSummarize:
+		err = summarizeResearch(ctx, &state)
+	case stepFinish:
+		err = finishResearch(ctx, &state)
+	default:
+		return state, fmt.Errorf("unknown workflow step %q", event.Step)
+	}
+	if err != nil {
+		log.Printf("Research job %s step %s failed: %v", msg.JobID, event.Step, err)
+		apiErr := bedrockError(err)
+		if apiErr.Retryable {
+			return state, &retryableStepError{err: apiErr}
+		}
+		return state, apiErr
+	}
+
+	state.Completed = append(state.Completed, event.Step)
+	return state, nil
+}
+
+// checkpointResearchJob records the step a job is on
+func checkpointResearchJob(ctx context.Context, state researchState, step string) {
+	job := newJob(state.Job.Principal, state.Job.JobID, state.Job.Request.Mode, state.Job.CreatedAt)
+	job.Status = jobRunning
+	job.Step = step
+	job.Completed = state.Completed
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveJob(ctx, job); err != nil {
+		log.Printf("Failed to checkpoint job %s: %v", state.Job.JobID, err)
+	}
+}
+
+// planResearch splits the request into a few focused questions
+func planResearch(ctx context.Context, state *researchState) error {
+	system := fmt.Sprintf(`You plan research for a voice request from an Apple Watch. Reply with only a JSON array of 1 to %d short, specific questions that together answer the request, e.g. ["question one", "question two"].`, maxResearchQuestions) +
+		vocabularyPrompt(requestVocabulary(ctx, state.Job.Principal))
+	text, usage, err := invokeModel(ctx, system, state.Job.Request.Text, planMaxTokens, 0)
+	if err != nil {
+		return err
+	}
+	recordTokenUsage(ctx, state.Job.Principal, state.Job.CreatedAt, modelFrom(ctx), usage)
+
+	state.Questions = parseResearchPlan(text, state.Job.Request.Text)
+	return nil
+}
+
+// parseResearchPlan reads the planned questions, falling back to the original request
+func parseResearchPlan(text, request string) []string {
+	var questions []string
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start >= 0 && end > start {
+		_ = json.Unmarshal([]byte(text[start:end+1]), &questions)
+	}
+
+	planned := make([]string, 0, len(questions))
+	for _, q := range questions {
+		if q = strings.TrimSpace(q); q != "" && len(planned) < maxResearchQuestions {
+			planned = append(planned, q)
+		}
+	}
+	if len(planned) == 0 {
+		return []string{request}
+	}
+	return planned
+}
+
+// lookupResearch answers each planned question from the knowledge base when one is
+// configured, otherwise from the model
+func lookupResearch(ctx context.Context, state *researchState) error {
+	state.Findings = state.Findings[:0]
+	for _, question := range state.Questions {
+		var finding researchFinding
+		var err error
+		if researchKnowledgeBaseID != "" && knowledgeBaseClient != nil {
+			finding, err = lookupKnowledgeBase(ctx, question)
+		} else {
+			finding, err = lookupModel(ctx, state, question)
+		}
+		if err != nil {
+			return err
+		}
+		state.Findings = append(state.Findings, finding)
+	}
+	return nil
+}
+
+// lookupKnowledgeBase retrieves the top passages for a question from the Bedrock knowledge base
+func lookupKnowledgeBase(ctx context.Context, question string) (researchFinding, error) {
+	out, err := knowledgeBaseClient.Retrieve(ctx, &bedrockagentruntime.RetrieveInput{
+		KnowledgeBaseId: aws.String(researchKnowledgeBaseID),
+		RetrievalQuery:  &agenttypes.KnowledgeBaseQuery{Text: aws.String(question)},
+		RetrievalConfiguration: &agenttypes.KnowledgeBaseRetrievalConfiguration{
+			VectorSearchConfiguration: &agenttypes.KnowledgeBaseVectorSearchConfiguration{
+				NumberOfResults: aws.Int32(knowledgeBaseResults),
+			},
+		},
+	})
+	if err != nil {
+		return researchFinding{}, fmt.Errorf("knowledge base Retrieve failed: %w", err)
+	}
+
+	finding := researchFinding{Question: question}
+	var excerpts []string
+	for _, result := range out.RetrievalResults {
+		if result.Content != nil && result.Content.Text != nil {
+			excerpts = append(excerpts, aws.ToString(result.Content.Text))
+		}
+		if source := retrievalSource(result.Location); source != "" {
+			finding.Sources = append(finding.Sources, source)
+		}
+	}
+	finding.Answer = truncateText(strings.Join(excerpts, "\n\n"), maxFindingExcerptChar)
+	return finding, nil
+}
+
+// retrievalSource returns a citable location (URL or S3 URI) for a retrieved passage
+func retrievalSource(location *agenttypes.RetrievalResultLocation) string {
+	switch {
+	case location == nil:
+		return ""
+	case location.WebLocation != nil:
+		return aws.ToString(location.WebLocation.Url)
+	case location.S3Location != nil:
+		return aws.ToString(location.S3Location.Uri)
+	case location.ConfluenceLocation != nil:
+		return aws.ToString(location.ConfluenceLocation.Url)
+	case location.SharePointLocation != nil:
+		return aws.ToString(location.SharePointLocation.Url)
+	case location.SalesforceLocation != nil:
+		return aws.ToString(location.SalesforceLocation.Url)
+	}
+	return ""
+}
+
+// lookupModel answers a planned question directly with the model
+func lookupModel(ctx context.Context, state *researchState, question string) (researchFinding, error) {
+	system := "Answer the research question factually in a short paragraph. Name your sources where you can."
+	text, usage, err := invokeModel(ctx, system, question, lookupMaxTokens, 0)
+	if err != nil {
+		return researchFinding{}, err
+	}
+	recordTokenUsage(ctx, state.Job.Principal, state.Job.CreatedAt, modelFrom(ctx), usage)
+	return researchFinding{Question: question, Answer: text}, nil
+}
+
+// synthesizeResearch writes the full research response from the findings
+func synthesizeResearch(ctx context.Context, state *researchState) error {
+	var notes strings.Builder
+	for _, finding := range state.Findings {
+		fmt.Fprintf(&notes, "Q: %s\nA: %s\n", finding.Question, finding.Answer)
+		if len(finding.Sources) > 0 {
+			fmt.Fprintf(&notes, "Sources: %s\n", strings.Join(finding.Sources, ", "))
+		}
+		notes.WriteString("\n")
+	}
+
+	req := state.Job.Request
+	user := fmt.Sprintf("Process this request: %s\n\nResearch notes:\n%s", req.Text, notes.String())
+	system := buildSystemPrompt("research") + vocabularyPrompt(requestVocabulary(ctx, state.Job.Principal)) + tagPrompt(requestTags(ctx, state.Job.Principal))
+	text, usage, err := invokeModel(ctx, system, user, req.MaxTokens, req.ThinkingTokens)
+	if err != nil {
+		return err
+	}
+	recordTokenUsage(ctx, state.Job.Principal, state.Job.CreatedAt, modelFrom(ctx), usage)
+
+	state.Response = parseModelResponse(text, req.Mode, usage)
+	return nil
+}
+
+// summarizeResearch condenses the research into a summary that fits the watch screen
+func summarizeResearch(ctx context.Context, state *researchState) error {
+	if state.Response == nil {
+		return fmt.Errorf("no research response to summarize")
+	}
+	system := "Summarize the research in at most three short sentences of plain text for an Apple Watch screen. No markdown."
+	text, usage, err := invokeModel(ctx, system, state.Response.Markdown, summaryMaxTokens, 0)
+	if err != nil {
+		return err
+	}
+	recordTokenUsage(ctx, state.Job.Principal, state.Job.CreatedAt, modelFrom(ctx), usage)
+
+	state.Response.Summary = strings.TrimSpace(text)
+	return nil
+}
+
+// finishResearch delivers the response to sinks and the callback and completes the job
+func finishResearch(ctx context.Context, state *researchState) error {
+	if state.Response == nil {
+		return fmt.Errorf("no research response to deliver")
+	}
+	msg := state.Job
+	req := msg.Request
+	req.warnings = msg.Warnings
+	req.sinks = msg.Sinks
+	deliverResponse(ctx, &req, msg.JobID, msg.Principal, msg.CreatedAt, state.Response)
+
+	job := newJob(msg.Principal, msg.JobID, req.Mode, msg.CreatedAt)
+	job.Status = jobSucceeded
+	job.Completed = append(state.Completed, stepFinish)
+	job.Result, _ = json.Marshal(renderResponse(msg.APIVersion, state.Response))
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveJob(ctx, job); err != nil {
+		// The result is already delivered; don't rerun the step
+		log.Printf("Failed to record job %s result: %v", msg.JobID, err)
+	}
+	log.Printf("Research job %s succeeded", msg.JobID)
+	return nil
+}
+
+// isErrorCode reports whether s looks like an apierror code, e.g. THROTTLED
+func isErrorCode(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// failResearchJob marks the job failed with the error Step Functions caught
+func failResearchJob(ctx context.Context, state researchState) {
+	msg := state.Job
+	apiErr := apierror.Internal("Research workflow failed")
+	if state.Failure != nil {
+		// The cause is the Lambda error, whose message is the step's "<CODE>: <message>"
+		var cause struct {
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if json.Unmarshal([]byte(state.Failure.Cause), &cause) == nil {
+			if code, message, ok := strings.Cut(cause.ErrorMessage, ": "); ok && isErrorCode(code) {
+				apiErr = apierror.New(500, apierror.Code(code), message).WithRetryable(false)
+			}
+		}
+		log.Printf("Research job %s failed: %s %s", msg.JobID, state.Failure.Error, state.Failure.Cause)
+	}
+
+	job := newJob(msg.Principal, msg.JobID, msg.Request.Mode, msg.CreatedAt)
+	job.Status = jobFailed
+	job.Completed = state.Completed
+	job.Error, _ = json.Marshal(apiErr.Envelope(ctx).Error)
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveJob(ctx, job); err != nil {
+		log.Printf("Failed to record job %s failure: %v", msg.JobID, err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	agenttypes "github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+)
+
+// fakeSFN records started executions
+type fakeSFN struct {
+	inputs []*sfn.StartExecutionInput
+	err    error
+}
+
+func (f *fakeSFN) StartExecution(ctx context.Context, params *sfn.StartExecutionInput, optFns ...func(*sfn.Options)) (*sfn.StartExecutionOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.inputs = append(f.inputs, params)
+	return &sfn.StartExecutionOutput{}, nil
+}
+
+// fakeKnowledgeBase returns fixed retrieval results
+type fakeKnowledgeBase struct {
+	results []agenttypes.KnowledgeBaseRetrievalResult
+	queries []string
+}
+
+func (f *fakeKnowledgeBase) Retrieve(ctx context.Context, params *bedrockagentruntime.RetrieveInput, optFns ...func(*bedrockagentruntime.Options)) (*bedrockagentruntime.RetrieveOutput, error) {
+	f.queries = append(f.queries, aws.ToString(params.RetrievalQuery.Text))
+	return &bedrockagentruntime.RetrieveOutput{RetrievalResults: f.results}, nil
+}
+
+// useResearchWorkflow enables the research state machine with a fake client for the test
+func useResearchWorkflow(t *testing.T, client *fakeSFN) {
+	t.Helper()
+	origClient, origArn := sfnClient, researchStateMachineArn
+	sfnClient, researchStateMachineArn = client, "arn:aws:states:us-west-2:123456789012:stateMachine:research"
+	t.Cleanup(func() { sfnClient, researchStateMachineArn = origClient, origArn })
+}
+
+func researchJob() jobMessage {
+	return jobMessage{
+		JobID:      "job-1",
+		Principal:  "user-1",
+		APIVersion: 2,
+		CreatedAt:  time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Request:    Req{Text: "Compare heat pumps", Mode: "research", MaxTokens: 800},
+	}
+}
+
+func TestParseResearchPlan(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"json array", `["What do heat pumps cost?", "How efficient are they?"]`, []string{"What do heat pumps cost?", "How efficient are they?"}},
+		{"wrapped in prose", "Here is the plan:\n[\"Q1\"]\nDone.", []string{"Q1"}},
+		{"capped", `["a","b","c","d","e","f"]`, []string{"a", "b", "c", "d"}},
+		{"blank entries dropped", `["a", "  "]`, []string{"a"}},
+		{"not json", "I would research costs first", []string{"original request"}},
+		{"empty array", `[]`, []string{"original request"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseResearchPlan(tt.text, "original request"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseResearchPlan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupKnowledgeBase(t *testing.T) {
+	kb := &fakeKnowledgeBase{results: []agenttypes.KnowledgeBaseRetrievalResult{
+		{
+			Content:  &agenttypes.RetrievalResultContent{Text: aws.String("Air-source units cost $4k-$8k.")},
+			Location: &agenttypes.RetrievalResultLocation{S3Location: &agenttypes.RetrievalResultS3Location{Uri: aws.String("s3://kb/heat-pumps.pdf")}},
+		},
+		{
+			Content:  &agenttypes.RetrievalResultContent{Text: aws.String("COP is typically 3-4.")},
+			Location: &agenttypes.RetrievalResultLocation{WebLocation: &agenttypes.RetrievalResultWebLocation{Url: aws.String("https://energy.example/cop")}},
+		},
+	}}
+	origClient, origID := knowledgeBaseClient, researchKnowledgeBaseID
+	knowledgeBaseClient, researchKnowledgeBaseID = kb, "KB123"
+	t.Cleanup(func() { knowledgeBaseClient, researchKnowledgeBaseID = origClient, origID })
+
+	state := researchState{Job: researchJob(), Questions: []string{"What do heat pumps cost?"}}
+	if err := lookupResearch(context.Background(), &state); err != nil {
+		t.Fatalf("lookupResearch() error = %v", err)
+	}
+
+	if len(kb.queries) != 1 || kb.queries[0] != "What do heat pumps cost?" {
+		t.Errorf("queries = %v", kb.queries)
+	}
+	finding := state.Findings[0]
+	if !strings.Contains(finding.Answer, "$4k-$8k") || !strings.Contains(finding.Answer, "COP") {
+		t.Errorf("Answer = %q", finding.Answer)
+	}
+	if !reflect.DeepEqual(finding.Sources, []string{"s3://kb/heat-pumps.pdf", "https://energy.example/cop"}) {
+		t.Errorf("Sources = %v", finding.Sources)
+	}
+}
+
+func TestHandler_AsyncResearchStartsWorkflow(t *testing.T) {
+	queue, db, machine := &fakeSQS{}, &fakeDynamo{}, &fakeSFN{}
+	useJobQueue(t, queue, db)
+	useResearchWorkflow(t, machine)
+
+	resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"Compare heat pumps","mode":"research","async":true}`))
+	if resp.StatusCode != 202 {
+		t.Fatalf("StatusCode = %d, want 202: %s", resp.StatusCode, resp.Body)
+	}
+	if len(queue.bodies) != 0 || len(machine.inputs) != 1 {
+		t.Fatalf("research should start a workflow, not queue: %d messages, %d executions", len(queue.bodies), len(machine.inputs))
+	}
+
+	var accepted JobAccepted
+	json.Unmarshal([]byte(resp.Body), &accepted)
+	if aws.ToString(machine.inputs[0].Name) != accepted.JobID {
+		t.Errorf("execution name = %s, want job ID %s", aws.ToString(machine.inputs[0].Name), accepted.JobID)
+	}
+	var input researchState
+	json.Unmarshal([]byte(aws.ToString(machine.inputs[0].Input)), &input)
+	if input.Job.JobID != accepted.JobID || input.Job.Request.Text != "Compare heat pumps" {
+		t.Errorf("workflow input = %+v", input)
+	}
+
+	// Other modes still use the queue
+	handler(context.Background(), asyncEvent("/invoke", `{"text":"buy milk","mode":"note","async":true}`))
+	if len(queue.bodies) != 1 || len(machine.inputs) != 1 {
+		t.Errorf("note should queue: %d messages, %d executions", len(queue.bodies), len(machine.inputs))
+	}
+}
+
+func TestHandler_AsyncResearchStartFails(t *testing.T) {
+	useJobQueue(t, &fakeSQS{}, &fakeDynamo{})
+	useResearchWorkflow(t, &fakeSFN{err: errors.New("ExecutionLimitExceeded")})
+
+	resp, _ := handler(context.Background(), asyncEvent("/invoke", `{"text":"Compare heat pumps","mode":"research","async":true}`))
+	if resp.StatusCode != 503 {
+		t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestHandleWorkflowStep(t *testing.T) {
+	t.Run("retryable failure checkpoints and reports retryableStepError", func(t *testing.T) {
+		db := &fakeDynamo{}
+		useFakeDynamo(t, db)
+		cb := &CircuitBreaker{}
+		tripBreaker(cb, time.Now())
+		useBreaker(t, cb)
+
+		_, err := handleWorkflowStep(context.Background(), workflowEvent{Step: stepPlan, State: researchState{Job: researchJob()}})
+		var retryable *retryableStepError
+		if !errors.As(err, &retryable) {
+			t.Fatalf("error = %T %v, want *retryableStepError", err, err)
+		}
+
+		job, _ := loadJob(context.Background(), "user-1", "job-1")
+		if job == nil || job.Status != jobRunning || job.Step != stepPlan {
+			t.Errorf("checkpoint = %+v", job)
+		}
+	})
+
+	t.Run("finish delivers and completes the job", func(t *testing.T) {
+		db := &fakeDynamo{}
+		useFakeDynamo(t, db)
+		t.Setenv("SINKS", `{"*": []}`)
+
+		state := researchState{
+			Job:       researchJob(),
+			Completed: []string{stepPlan, stepLookup, stepSynthesize, stepSummarize},
+			Response:  &Response{Markdown: "# Heat pumps", Action: "note", Title: "Heat pumps", Summary: "Air-source is cheapest."},
+		}
+		out, err := handleWorkflowStep(context.Background(), workflowEvent{Step: stepFinish, State: state})
+		if err != nil {
+			t.Fatalf("handleWorkflowStep() error = %v", err)
+		}
+		if out.Response.ID != "job-1" {
+			t.Errorf("response ID = %q, want job ID", out.Response.ID)
+		}
+
+		job, _ := loadJob(context.Background(), "user-1", "job-1")
+		if job == nil || job.Status != jobSucceeded || len(job.Completed) != 5 {
+			t.Fatalf("job = %+v", job)
+		}
+		if !strings.Contains(string(job.Result), `"items":[`) || !strings.Contains(string(job.Result), `"summary":"Air-source is cheapest."`) {
+			t.Errorf("result = %s", job.Result)
+		}
+	})
+
+	t.Run("fail records the caught error", func(t *testing.T) {
+		db := &fakeDynamo{}
+		useFakeDynamo(t, db)
+
+		state := researchState{
+			Job:       researchJob(),
+			Completed: []string{stepPlan},
+			Failure: &workflowFailure{
+				Error: "retryableStepError",
+				Cause: `{"errorMessage":"THROTTLED: Service is busy, please retry","errorType":"retryableStepError"}`,
+			},
+		}
+		if _, err := handleWorkflowStep(context.Background(), workflowEvent{Step: stepFail, State: state}); err != nil {
+			t.Fatalf("handleWorkflowStep() error = %v", err)
+		}
+
+		job, _ := loadJob(context.Background(), "user-1", "job-1")
+		if job == nil || job.Status != jobFailed {
+			t.Fatalf("job = %+v", job)
+		}
+		if !strings.Contains(string(job.Error), `"code":"THROTTLED"`) || !strings.Contains(string(job.Error), `"retryable":false`) {
+			t.Errorf("job error = %s", job.Error)
+		}
+	})
+
+	t.Run("unknown step", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		if _, err := handleWorkflowStep(context.Background(), workflowEvent{Step: "teleport", State: researchState{Job: researchJob()}}); err == nil {
+			t.Error("Expected error for unknown step")
+		}
+	})
+}
+
+func TestInvoke_WorkflowStep(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	payload := `{"workflowStep":"fail","state":{"job":{"jobId":"job-1","principal":"user-1","request":{"text":"x","mode":"research"}}}}`
+
+	out, err := invoke(context.Background(), json.RawMessage(payload))
+	if err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	if _, ok := out.(researchState); !ok {
+		t.Errorf("invoke() returned %T, want researchState", out)
+	}
+}
+
+func TestRenderResponse_SummaryIsV2Only(t *testing.T) {
+	resp := &Response{Title: "x", Summary: "short"}
+	if v1 := renderResponse(apiV1, resp).(*Response); v1.Summary != "" {
+		t.Error("v1 response should not include summary")
+	}
+	if v2 := renderResponse(apiV2, resp).(ResponseV2); v2.Items[0].Summary != "short" {
+		t.Error("v2 response should include summary")
+	}
+}
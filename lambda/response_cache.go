@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Partition key prefix of cached model replies in the history table; principals' items
+// all start with USER# or TENANT#, so they can't collide
+const responseCachePKPrefix = "RESPONSECACHE#"
+
+const (
+	defaultResponseCacheModes      = "research,deepthink,question"
+	defaultResponseCacheTTLHours   = 24
+	defaultResponseCacheFreshHours = 6
+
+	// A refresh that hasn't stored a new reply within this long is assumed lost, and the
+	// next stale hit queues another
+	responseCacheRefreshTimeout = 5 * time.Minute
+)
+
+// uncacheableModes answer relative to the current time, so a cached reply would be wrong
+var uncacheableModes = map[string]bool{"reminder": true, "event": true}
+
+// cachedReply is a stored model reply
+type cachedReply struct {
+	PK        string `dynamodbav:"pk"`
+	SK        string `dynamodbav:"sk"`
+	Mode      string `dynamodbav:"mode"`
+	Text      string `dynamodbav:"text"` // the model's reply before parsing
+	CachedAt  string `dynamodbav:"cachedAt"`
+	ExpiresAt int64  `dynamodbav:"expiresAt"`
+
+	RefreshingAt int64 `dynamodbav:"refreshingAt,omitempty"` // when a refresh was queued; cleared by the new reply
+}
+
+// responseCacheTTL reads RESPONSE_CACHE_TTL_HOURS, how long a reply is served from the
+// cache; 0 turns caching off
+func responseCacheTTL() time.Duration {
+	hours := defaultResponseCacheTTLHours
+	if env := os.Getenv("RESPONSE_CACHE_TTL_HOURS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			hours = n
+		} else {
+			log.Printf("Invalid RESPONSE_CACHE_TTL_HOURS value: %s, using default", env)
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// responseCacheFreshness reads RESPONSE_CACHE_FRESH_HOURS: cached replies older than this
+// are still served, but a refresh is queued so the next request gets a new one. 0 turns
+// refreshing off, leaving replies fresh until they expire.
+func responseCacheFreshness() time.Duration {
+	hours := defaultResponseCacheFreshHours
+	if env := os.Getenv("RESPONSE_CACHE_FRESH_HOURS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			hours = n
+		} else {
+			log.Printf("Invalid RESPONSE_CACHE_FRESH_HOURS value: %s, using default", env)
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// responseCacheModes reads RESPONSE_CACHE_MODES, the comma-separated modes whose replies
+// are cached. Reminder and event modes are never cached.
+func responseCacheModes() map[string]bool {
+	modes := map[string]bool{}
+	for _, mode := range splitList(getEnv("RESPONSE_CACHE_MODES", defaultResponseCacheModes)) {
+		if uncacheableModes[mode] {
+			log.Printf("Ignoring %s in RESPONSE_CACHE_MODES: its replies depend on the current time", mode)
+			continue
+		}
+		modes[mode] = true
+	}
+	return modes
+}
+
+// cacheable reports whether a request's reply may be served from or stored in the cache.
+// Images and conversations make a request unique, so they aren't cached.
+func cacheable(req *Req) bool {
+	return historyTableName != "" && req.image == nil && req.conversation == nil &&
+		responseCacheTTL() > 0 && responseCacheModes()[req.Mode]
+}
+
+// normalizeCacheText folds case, whitespace and trailing punctuation so trivially
+// different phrasings of the same query share a cache entry
+func normalizeCacheText(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	return strings.TrimRightFunc(text, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) })
+}
+
+// responseCacheKey identifies a reply by mode, model, prompt version and normalized text.
+// The prompt version covers the mode's prompt, the prompt variant and the caller's
+// personalization (profile, vocabulary, tags), so callers only share replies when the
+// model would have seen the same prompt, and never across tenants.
+func responseCacheKey(req *Req, variant *PromptVariant) string {
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	}
+	write(req.Mode, requestModel(req), buildSystemPrompt(req.Mode), promptVariantPrompt(variant), languagePrompt(req), translationPrompt(req), titleHintPrompt(req),
+		vocabularyPrompt(req.vocabulary), tagPrompt(req.preferredTags),
+		strconv.Itoa(req.MaxTokens), strconv.Itoa(req.ThinkingTokens), req.sampling().cacheKey())
+	if prefs := req.preferences; prefs != nil {
+		write(prefs.Name, prefs.Timezone, prefs.ListApp, prefs.Verbosity)
+	}
+	if req.tenant != "" {
+		write(req.tenant)
+	}
+	write(normalizeCacheText(req.Text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCachedReply returns the cached reply for a key, or nil when there is none or it
+// has expired (DynamoDB deletes expired items lazily)
+func loadCachedReply(ctx context.Context, key string, now time.Time) (*cachedReply, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: responseCachePKPrefix + key},
+			"sk": &types.AttributeValueMemberS{Value: "REPLY"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	var reply cachedReply
+	if err := attributevalue.UnmarshalMap(out.Item, &reply); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached reply: %w", err)
+	}
+	if reply.ExpiresAt <= now.Unix() {
+		return nil, nil
+	}
+	return &reply, nil
+}
+
+// saveCachedReply stores a reply for RESPONSE_CACHE_TTL_HOURS
+func saveCachedReply(ctx context.Context, key, mode, text string, now time.Time) error {
+	item, err := attributevalue.MarshalMap(cachedReply{
+		PK:        responseCachePKPrefix + key,
+		SK:        "REPLY",
+		Mode:      mode,
+		Text:      text,
+		CachedAt:  now.UTC().Format(time.RFC3339),
+		ExpiresAt: now.Add(responseCacheTTL()).Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached reply: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
+
+// cachedResponse answers a request from the cache, or returns nil on a miss. Storage
+// errors are logged and treated as a miss, and cache refreshes always miss.
+func cachedResponse(ctx context.Context, req *Req, key string) *Response {
+	if req.revalidate {
+		return nil
+	}
+	reply, err := loadCachedReply(ctx, key, time.Now())
+	if err != nil {
+		log.Printf("Failed to load cached reply: %v", err)
+		return nil
+	}
+	if reply == nil {
+		return nil
+	}
+	log.Printf("Serving %s request from the response cache (cached %s)", req.Mode, reply.CachedAt)
+	debugTraceFrom(ctx).recordRawText(reply.Text)
+	response := parseModelResponse(reply.Text, req.Mode, Usage{})
+	response.Cached = true
+	response.cachedAt, _ = time.Parse(time.RFC3339, reply.CachedAt)
+	return response
+}
+
+// cacheReply stores a well-formed reply; replies that needed the raw-text fallback or
+// were missing fields aren't worth serving again. Errors are logged and skipped.
+func cacheReply(ctx context.Context, req *Req, key, text string, response *Response) {
+	if response.parsePath != "structured" || response.incomplete {
+		return
+	}
+	if err := saveCachedReply(ctx, key, req.Mode, text, time.Now()); err != nil {
+		log.Printf("Failed to cache reply: %v", err)
+	}
+}
+
+// revalidateCachedReply queues a refresh of a stale cached reply through the job queue,
+// so this request is answered at cache speed and the next one gets a new reply. Only one
+// refresh per entry is queued at a time. Errors are logged and skipped; the stale reply
+// keeps being served until it expires.
+func revalidateCachedReply(ctx context.Context, req *Req, principal string, response *Response) {
+	freshness := responseCacheFreshness()
+	if !response.Cached || freshness == 0 || jobQueueURL == "" || time.Since(response.cachedAt) < freshness {
+		return
+	}
+	key := responseCacheKey(req, req.variant)
+	claimed, err := claimCacheRefresh(ctx, key, time.Now())
+	if err != nil {
+		log.Printf("Failed to claim cache refresh: %v", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	msg := jobMessage{Principal: principal, CreatedAt: time.Now().UTC(), Request: *req, Revalidate: key}
+	if req.variant != nil {
+		msg.Variant = req.variant.Name
+	}
+	if err := sendJobMessage(ctx, msg); err != nil {
+		log.Printf("Failed to queue cache refresh: %v", err)
+		return
+	}
+	log.Printf("Queued refresh of stale %s reply cached %s", req.Mode, response.cachedAt.Format(time.RFC3339))
+}
+
+// claimCacheRefresh marks an entry as being refreshed, reporting false when another
+// request already queued a refresh that hasn't timed out
+func claimCacheRefresh(ctx context.Context, key string, now time.Time) (bool, error) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: responseCachePKPrefix + key},
+			"sk": &types.AttributeValueMemberS{Value: "REPLY"},
+		},
+		UpdateExpression:    aws.String("SET refreshingAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND (attribute_not_exists(refreshingAt) OR refreshingAt < :timeout)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":timeout": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(-responseCacheRefreshTimeout).Unix(), 10)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("DynamoDB UpdateItem failed: %w", err)
+	}
+	return true, nil
+}
+
+// refreshCachedReply runs a queued cache refresh: the request is answered by the model
+// again and the reply replaces the stale one. The caller's personalization is reloaded,
+// and if it changed since the stale reply was served the refresh is dropped, since the
+// new reply would belong to a different entry.
+func refreshCachedReply(ctx context.Context, msg jobMessage) {
+	req := msg.Request
+	req.revalidate = true
+	req.tenant, _ = splitPrincipal(msg.Principal)
+	req.vocabulary = requestVocabulary(ctx, msg.Principal)
+	req.preferredTags = requestTags(ctx, msg.Principal)
+	requestPreferences(ctx, &req, msg.Principal)
+	arms := loadPromptVariants()[req.Mode]
+	for i := range arms {
+		if arms[i].Name == msg.Variant {
+			req.variant = &arms[i]
+		}
+	}
+	if (msg.Variant != "" && req.variant == nil) || responseCacheKey(&req, req.variant) != msg.Revalidate {
+		log.Printf("Dropping refresh of %s reply: its prompt changed", req.Mode)
+		return
+	}
+
+	response, err := callBedrock(ctx, &req)
+	if err != nil {
+		log.Printf("Cache refresh failed: %v", err)
+		return
+	}
+	recordTokenUsage(ctx, msg.Principal, time.Now().UTC(), response.model, response.usage)
+	log.Printf("Refreshed cached %s reply", req.Mode)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNormalizeCacheText(t *testing.T) {
+	if got := normalizeCacheText("  What is the  TALLEST mountain?! "); got != "what is the tallest mountain" {
+		t.Errorf("normalizeCacheText = %q", got)
+	}
+}
+
+func TestResponseCacheModes(t *testing.T) {
+	t.Setenv("RESPONSE_CACHE_MODES", "research, reminder,event,note")
+	modes := responseCacheModes()
+	if !modes["research"] || !modes["note"] || modes["reminder"] || modes["event"] {
+		t.Errorf("modes = %v", modes)
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	base := &Req{Mode: "research", Text: "Tallest mountain?", MaxTokens: 2000}
+	key := responseCacheKey(base, nil)
+	if key != responseCacheKey(&Req{Mode: "research", Text: "tallest   mountain", MaxTokens: 2000}, nil) {
+		t.Error("normalized text should share a key")
+	}
+	for name, other := range map[string]*Req{
+		"mode":        {Mode: "question", Text: "Tallest mountain?", MaxTokens: 2000},
+		"maxTokens":   {Mode: "research", Text: "Tallest mountain?", MaxTokens: 1000},
+		"preferences": {Mode: "research", Text: "Tallest mountain?", MaxTokens: 2000, preferences: &Preferences{Verbosity: "brief"}},
+		"vocabulary":  {Mode: "research", Text: "Tallest mountain?", MaxTokens: 2000, vocabulary: []string{"Denali"}},
+	} {
+		if responseCacheKey(other, nil) == key {
+			t.Errorf("%s should change the key", name)
+		}
+	}
+	if responseCacheKey(base, &PromptVariant{Name: "terse", Instructions: "Be terse."}) == key {
+		t.Error("prompt variant should change the key")
+	}
+}
+
+func TestLoadCachedReply_Expired(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	ctx := context.Background()
+	now := time.Now()
+	saveCachedReply(ctx, "k", "research", `{"title":"x"}`, now)
+	if reply, err := loadCachedReply(ctx, "k", now); err != nil || reply == nil || reply.Text != `{"title":"x"}` {
+		t.Fatalf("reply = %+v, err = %v", reply, err)
+	}
+	if reply, _ := loadCachedReply(ctx, "k", now.Add(responseCacheTTL())); reply != nil {
+		t.Error("expired reply should be a miss")
+	}
+}
+
+func TestHandler_ResponseCache(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	useSinks(t)
+	model := &fakeBedrock{text: `{"action":"note","title":"Mount Everest","markdown":"Everest is 8,849 m.","shortText":"Everest, 8,849 m"}`, usage: Usage{InputTokens: 100, OutputTokens: 50}}
+	useFakeBedrock(t, model)
+	call := func(mode, text string) Response {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: `{"mode":"` + mode + `","text":"` + text + `"}`}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(context.Background(), event)
+		var body Response
+		json.Unmarshal([]byte(resp.Body), &body)
+		if resp.StatusCode != 200 {
+			t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+		return body
+	}
+
+	if first := call("research", "Tallest mountain?"); first.Cached {
+		t.Error("first request should call the model")
+	}
+	second := call("research", "tallest mountain")
+	if !second.Cached || second.Title != "Mount Everest" || model.calls != 1 {
+		t.Errorf("second request: cached = %v, title = %q, model calls = %d", second.Cached, second.Title, model.calls)
+	}
+
+	call("reminder", "Tallest mountain?")
+	if again := call("reminder", "Tallest mountain?"); again.Cached || model.calls != 3 {
+		t.Errorf("reminders should never be cached: cached = %v, model calls = %d", again.Cached, model.calls)
+	}
+
+	model.text = "Everest"
+	call("research", "Deepest lake?")
+	if again := call("research", "Deepest lake?"); again.Cached {
+		t.Error("raw-text replies should not be cached")
+	}
+}
+
+func TestHandler_ResponseCacheRevalidates(t *testing.T) {
+	queue, db := &fakeSQS{}, &fakeDynamo{}
+	useJobQueue(t, queue, db)
+	useSinks(t)
+	model := &fakeBedrock{text: `{"action":"note","title":"Everest","markdown":"Everest","shortText":"Everest"}`}
+	useFakeBedrock(t, model)
+	call := func() Response {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: `{"mode":"research","text":"Tallest mountain?"}`}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(context.Background(), event)
+		var body Response
+		json.Unmarshal([]byte(resp.Body), &body)
+		return body
+	}
+
+	call()
+	var key string
+	for _, item := range db.items {
+		if pk, _ := item["pk"].(string); strings.HasPrefix(pk, responseCachePKPrefix) {
+			key = strings.TrimPrefix(pk, responseCachePKPrefix)
+		}
+	}
+	if key == "" {
+		t.Fatal("reply was not cached")
+	}
+	if call(); len(queue.bodies) != 0 {
+		t.Fatal("fresh reply queued a refresh")
+	}
+
+	// Age the entry past RESPONSE_CACHE_FRESH_HOURS: it's still served, and a refresh is queued
+	saveCachedReply(context.Background(), key, "research", model.text, time.Now().Add(-7*time.Hour))
+	if stale := call(); !stale.Cached || stale.Title != "Everest" {
+		t.Errorf("stale reply: cached = %v, title = %q", stale.Cached, stale.Title)
+	}
+	if len(queue.bodies) != 1 || !strings.Contains(queue.bodies[0], key) {
+		t.Fatalf("queued %v", queue.bodies)
+	}
+
+	model.text = `{"action":"note","title":"Mount Everest","markdown":"Everest","shortText":"Everest"}`
+	if retry := processJobRecord(context.Background(), events.SQSMessage{MessageId: "m1", Body: queue.bodies[0]}); retry {
+		t.Error("refresh should not be retried")
+	}
+	if fresh := call(); !fresh.Cached || fresh.Title != "Mount Everest" || model.calls != 2 || len(queue.bodies) != 1 {
+		t.Errorf("after refresh: cached = %v, title = %q, model calls = %d, queued = %d", fresh.Cached, fresh.Title, model.calls, len(queue.bodies))
+	}
+}
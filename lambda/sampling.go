@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Safe ranges for the request's sampling fields; values outside them are clamped
+const (
+	defaultTemperature   = 0.1
+	maxTopK              = 500
+	maxStopSequences     = 4
+	maxStopSequenceChars = 64
+)
+
+// Sampling holds the decoding controls sent to the model. Nil fields use the model's
+// default, except Temperature, which defaults to 0.1 for stable structured output.
+type Sampling struct {
+	Temperature   *float64
+	TopP          *float64
+	TopK          *int
+	StopSequences []string
+}
+
+// sampling returns the request's decoding controls
+func (req *Req) sampling() Sampling {
+	return Sampling{Temperature: req.Temperature, TopP: req.TopP, TopK: req.TopK, StopSequences: req.StopSequences}
+}
+
+// temperature returns the temperature to send
+func (s Sampling) temperature() float64 {
+	if s.Temperature != nil {
+		return *s.Temperature
+	}
+	return defaultTemperature
+}
+
+// cacheKey renders the controls for the response cache key
+func (s Sampling) cacheKey() string {
+	key := fmt.Sprintf("t=%g", s.temperature())
+	if s.TopP != nil {
+		key += fmt.Sprintf(" p=%g", *s.TopP)
+	}
+	if s.TopK != nil {
+		key += fmt.Sprintf(" k=%d", *s.TopK)
+	}
+	if len(s.StopSequences) > 0 {
+		key += " stop=" + strings.Join(s.StopSequences, "\x1f")
+	}
+	return key
+}
+
+// clampSampling pulls temperature, topP and topK into their safe ranges and trims
+// stopSequences to maxStopSequences non-empty entries of at most maxStopSequenceChars,
+// with a warning for each change rather than an error
+func clampSampling(req *Req) {
+	clampFloat := func(name string, value *float64) {
+		if value == nil {
+			return
+		}
+		if clamped := min(max(*value, 0), 1); clamped != *value {
+			req.warnings = append(req.warnings, fmt.Sprintf("%s clamped from %g to %g", name, *value, clamped))
+			*value = clamped
+		}
+	}
+	clampFloat("temperature", req.Temperature)
+	clampFloat("topP", req.TopP)
+
+	if req.TopK != nil {
+		if clamped := min(max(*req.TopK, 1), maxTopK); clamped != *req.TopK {
+			req.warnings = append(req.warnings, fmt.Sprintf("topK clamped from %d to %d", *req.TopK, clamped))
+			*req.TopK = clamped
+		}
+	}
+
+	if req.StopSequences == nil {
+		return
+	}
+	kept := make([]string, 0, len(req.StopSequences))
+	for _, stop := range req.StopSequences {
+		if strings.TrimSpace(stop) == "" {
+			continue
+		}
+		if utf8.RuneCountInString(stop) > maxStopSequenceChars {
+			req.warnings = append(req.warnings, fmt.Sprintf("stop sequence shortened to %d characters", maxStopSequenceChars))
+			stop = string([]rune(stop)[:maxStopSequenceChars])
+		}
+		kept = append(kept, stop)
+	}
+	if len(kept) > maxStopSequences {
+		req.warnings = append(req.warnings, fmt.Sprintf("only the first %d stopSequences are used", maxStopSequences))
+		kept = kept[:maxStopSequences]
+	}
+	req.StopSequences = kept
+}
+
+type samplingKey struct{}
+
+// withSampling applies a request's decoding controls to the Bedrock calls made with ctx.
+// Only the call that answers the request uses it; helper calls (titles, condensing long
+// text) keep the defaults.
+func withSampling(ctx context.Context, s Sampling) context.Context {
+	return context.WithValue(ctx, samplingKey{}, s)
+}
+
+// samplingFrom returns the decoding controls for Bedrock calls made with ctx
+func samplingFrom(ctx context.Context) Sampling {
+	s, _ := ctx.Value(samplingKey{}).(Sampling)
+	return s
+}
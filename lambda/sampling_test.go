@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClampSampling(t *testing.T) {
+	temperature, topP, topK := 1.7, -0.2, 900
+	req := Req{
+		Temperature:   &temperature,
+		TopP:          &topP,
+		TopK:          &topK,
+		StopSequences: []string{"END", "", strings.Repeat("x", 80), "a", "b", "c"},
+	}
+	clampSampling(&req)
+	if *req.Temperature != 1 || *req.TopP != 0 || *req.TopK != maxTopK {
+		t.Errorf("got temperature %g, topP %g, topK %d", *req.Temperature, *req.TopP, *req.TopK)
+	}
+	if len(req.StopSequences) != maxStopSequences || req.StopSequences[0] != "END" || len(req.StopSequences[1]) != maxStopSequenceChars {
+		t.Errorf("stopSequences = %q", req.StopSequences)
+	}
+	if len(req.warnings) != 5 {
+		t.Errorf("warnings = %q, want 5", req.warnings)
+	}
+
+	inRange := 0.5
+	req = Req{Temperature: &inRange}
+	clampSampling(&req)
+	if *req.Temperature != 0.5 || len(req.warnings) != 0 {
+		t.Errorf("in-range temperature changed: %g, %q", *req.Temperature, req.warnings)
+	}
+}
+
+func TestBuildRequest_Sampling(t *testing.T) {
+	temperature, topP, topK := 0.7, 0.9, 40
+	sampling := Sampling{Temperature: &temperature, TopP: &topP, TopK: &topK, StopSequences: []string{"###"}}
+	messages := []map[string]interface{}{{"role": "user", "content": "Hi"}}
+
+	var anthropic map[string]interface{}
+	body, _ := anthropicProvider{}.BuildRequest("Be brief", messages, 100, 0, sampling)
+	json.Unmarshal(body, &anthropic)
+	if anthropic["temperature"] != 0.7 || anthropic["top_p"] != 0.9 || anthropic["top_k"] != 40.0 || anthropic["stop_sequences"] == nil {
+		t.Errorf("anthropic body = %s", body)
+	}
+
+	var nova struct {
+		InferenceConfig map[string]interface{} `json:"inferenceConfig"`
+	}
+	body, _ = novaProvider{}.BuildRequest("Be brief", messages, 100, 0, sampling)
+	json.Unmarshal(body, &nova)
+	if nova.InferenceConfig["topP"] != 0.9 || nova.InferenceConfig["topK"] != 40.0 || nova.InferenceConfig["stopSequences"] == nil {
+		t.Errorf("nova body = %s", body)
+	}
+
+	var defaults map[string]interface{}
+	body, _ = anthropicProvider{}.BuildRequest("Be brief", messages, 100, 0, Sampling{})
+	json.Unmarshal(body, &defaults)
+	if defaults["temperature"] != defaultTemperature || defaults["top_p"] != nil || defaults["top_k"] != nil {
+		t.Errorf("default body = %s", body)
+	}
+}
+
+func TestAdaptToModel_LlamaSampling(t *testing.T) {
+	topK := 40
+	req := Req{TopK: &topK, StopSequences: []string{"###"}, model: "us.meta.llama3-3-70b-instruct-v1:0"}
+	adaptToModel(&req)
+	if req.TopK != nil || req.StopSequences != nil || len(req.warnings) != 1 {
+		t.Errorf("got topK %v, stopSequences %q, warnings %q", req.TopK, req.StopSequences, req.warnings)
+	}
+}
+
+func TestCallBedrock_Sampling(t *testing.T) {
+	fake := &fakeBedrock{text: `{"action":"note","title":"Tides","markdown":"Tides"}`}
+	useFakeBedrock(t, fake)
+
+	temperature := 0.8
+	if _, err := callBedrock(context.Background(), &Req{Text: "note about tides", Mode: "note", MaxTokens: 800, Temperature: &temperature}); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	json.Unmarshal(fake.body, &body)
+	if body["temperature"] != 0.8 {
+		t.Errorf("temperature = %v, want 0.8", body["temperature"])
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// errScopeDenied marks validation failures caused by token scopes (returned as 403)
+var errScopeDenied = errors.New("forbidden")
+
+// tokenScopes are the restrictions attached to a registered client token, e.g.
+//
+//	mode:note mode:reminder   only these modes
+//	-mode:deepthink           every mode except deepthink
+//	-feature:send             no SES sending (also: deliver, callback, speak)
+//	tier:low                  token ceiling (low, standard, high)
+//	class:economy             highest cost class (economy, standard, premium)
+//
+// A nil tokenScopes (static token, Apple ID) is unrestricted.
+type tokenScopes []string
+
+// tierLimits caps maxTokens and thinkingTokens per cost tier
+var tierLimits = map[string]struct{ maxTokens, thinkingTokens int }{
+	"low":      {maxTokens: 800, thinkingTokens: 0},
+	"standard": {maxTokens: 2000, thinkingTokens: 4000},
+	"high":     {maxTokens: 4096, thinkingTokens: 65536},
+}
+
+// scopesFromEvent reads the space-separated scopes the authorizer put in the policy context
+func scopesFromEvent(event events.APIGatewayProxyRequest) tokenScopes {
+	raw, ok := event.RequestContext.Authorizer["scopes"].(string)
+	if !ok {
+		return nil
+	}
+	return tokenScopes(strings.Fields(raw))
+}
+
+// allows reports whether the scopes permit value for a dimension ("mode", "feature").
+// A "-dimension:value" entry denies; any "dimension:" entries form an allowlist.
+func (s tokenScopes) allows(dimension, value string) bool {
+	allowlisted := false
+	restricted := false
+	for _, scope := range s {
+		switch scope {
+		case "-" + dimension + ":" + value:
+			return false
+		case dimension + ":" + value, dimension + ":*":
+			allowlisted = true
+		}
+		if strings.HasPrefix(scope, dimension+":") {
+			restricted = true
+		}
+	}
+	return allowlisted || !restricted
+}
+
+// tier returns the token's cost tier, or "" when unrestricted
+func (s tokenScopes) tier() string {
+	for _, scope := range s {
+		if tier, ok := strings.CutPrefix(scope, "tier:"); ok {
+			return tier
+		}
+	}
+	return ""
+}
+
+// costClass returns the highest cost class the token may use. Tokens without a class:
+// scope may use any; unknown classes fail closed to the cheapest.
+func (s tokenScopes) costClass() string {
+	for _, scope := range s {
+		if class, ok := strings.CutPrefix(scope, "class:"); ok {
+			if _, known := costClassThinkingTokens[class]; known {
+				return class
+			}
+			return costClassNames[0]
+		}
+	}
+	return costClassNames[len(costClassNames)-1]
+}
+
+// grants checks that a token with these scopes may give another token the requested
+// ones: each must be a scope it holds itself, and its own restrictions (denials, tier,
+// class and mode or feature allowlists) must carry over, so an admin token can't mint
+// or rescope a token broader than its own grant. nil scopes (the owner) grant anything.
+func (s tokenScopes) grants(requested []string) error {
+	if s == nil {
+		return nil
+	}
+	held := make(map[string]bool, len(s))
+	for _, scope := range s {
+		held[scope] = true
+	}
+	kept := make(map[string]bool, len(requested))
+	for _, scope := range requested {
+		if !held[scope] {
+			return fmt.Errorf("%w: scope %s exceeds this token's own scopes", errScopeDenied, scope)
+		}
+		kept[scope] = true
+		if dimension, _, ok := strings.Cut(scope, ":"); ok {
+			kept[dimension+":"] = true // an allowlist for the dimension carries over
+		}
+	}
+	for _, scope := range s {
+		dimension, _, _ := strings.Cut(scope, ":")
+		switch {
+		case strings.HasPrefix(scope, "-"), dimension == "tier", dimension == "class":
+			if !kept[scope] {
+				return fmt.Errorf("%w: scope %s must be kept", errScopeDenied, scope)
+			}
+		case dimension == "mode", dimension == "feature":
+			if !kept[dimension+":"] {
+				return fmt.Errorf("%w: %s scopes must be kept", errScopeDenied, dimension)
+			}
+		}
+	}
+	return nil
+}
+
+// authorize checks a validated request against the token's scopes
+func (s tokenScopes) authorize(req *Req) error {
+	if !s.allows("mode", req.Mode) {
+		return fmt.Errorf("%w: mode %s is not permitted for this token", errScopeDenied, req.Mode)
+	}
+
+	features := map[string]bool{
+		"deliver":  req.Deliver,
+		"send":     req.Send,
+		"callback": req.CallbackURL != "",
+		"speak":    req.Speak,
+	}
+	for _, feature := range []string{"deliver", "send", "callback", "speak"} {
+		if features[feature] && !s.allows("feature", feature) {
+			return fmt.Errorf("%w: %s is not permitted for this token", errScopeDenied, feature)
+		}
+	}
+
+	if tier := s.tier(); tier != "" {
+		limits, ok := tierLimits[tier]
+		if !ok {
+			// Fail closed on unknown tiers
+			limits = tierLimits["low"]
+		}
+		if req.MaxTokens > limits.maxTokens {
+			return fmt.Errorf("%w: maxTokens cannot exceed %d for this token", errScopeDenied, limits.maxTokens)
+		}
+		if req.ThinkingTokens > limits.thinkingTokens {
+			return fmt.Errorf("%w: thinkingTokens cannot exceed %d for this token", errScopeDenied, limits.thinkingTokens)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestScopesFromEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		want       int
+		wantNil    bool
+	}{
+		{name: "no authorizer context", authorizer: nil, wantNil: true},
+		{name: "static token", authorizer: map[string]interface{}{"principalId": "user-1"}, wantNil: true},
+		{name: "scoped token", authorizer: map[string]interface{}{"scopes": "mode:note  tier:low"}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{}
+			event.RequestContext.Authorizer = tt.authorizer
+
+			got := scopesFromEvent(event)
+			if (got == nil) != tt.wantNil || len(got) != tt.want {
+				t.Errorf("scopesFromEvent() = %v", got)
+			}
+		})
+	}
+}
+
+func TestTokenScopesAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  tokenScopes
+		req     Req
+		wantErr bool
+	}{
+		{name: "unrestricted", scopes: nil, req: Req{Mode: "deepthink", MaxTokens: 4096, ThinkingTokens: 10000, Send: true}},
+		{name: "mode allowlist permits", scopes: tokenScopes{"mode:note", "mode:reminder"}, req: Req{Mode: "reminder", MaxTokens: 800}},
+		{name: "mode allowlist denies", scopes: tokenScopes{"mode:note"}, req: Req{Mode: "event", MaxTokens: 800}, wantErr: true},
+		{name: "mode wildcard", scopes: tokenScopes{"mode:*"}, req: Req{Mode: "research", MaxTokens: 800}},
+		{name: "mode denylist", scopes: tokenScopes{"-mode:deepthink"}, req: Req{Mode: "deepthink", MaxTokens: 800}, wantErr: true},
+		{name: "mode denylist permits others", scopes: tokenScopes{"-mode:deepthink"}, req: Req{Mode: "note", MaxTokens: 800}},
+		{name: "feature denied", scopes: tokenScopes{"-feature:send"}, req: Req{Mode: "email", MaxTokens: 800, Send: true}, wantErr: true},
+		{name: "feature denied but unused", scopes: tokenScopes{"-feature:send"}, req: Req{Mode: "email", MaxTokens: 800}},
+		{name: "feature allowlist", scopes: tokenScopes{"feature:deliver"}, req: Req{Mode: "note", MaxTokens: 800, CallbackURL: "https://x"}, wantErr: true},
+		{name: "speak denied", scopes: tokenScopes{"-feature:speak"}, req: Req{Mode: "reminder", MaxTokens: 800, Speak: true}, wantErr: true},
+		{name: "low tier within limits", scopes: tokenScopes{"tier:low"}, req: Req{Mode: "note", MaxTokens: 800}},
+		{name: "low tier maxTokens", scopes: tokenScopes{"tier:low"}, req: Req{Mode: "note", MaxTokens: 1200}, wantErr: true},
+		{name: "low tier thinking", scopes: tokenScopes{"tier:low"}, req: Req{Mode: "deepthink", MaxTokens: 800, ThinkingTokens: 1024}, wantErr: true},
+		{name: "standard tier", scopes: tokenScopes{"tier:standard"}, req: Req{Mode: "deepthink", MaxTokens: 2000, ThinkingTokens: 4000}},
+		{name: "unknown tier fails closed", scopes: tokenScopes{"tier:platinum"}, req: Req{Mode: "note", MaxTokens: 1000}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.scopes.authorize(&tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errScopeDenied) {
+				t.Errorf("Expected errScopeDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenScopesGrants(t *testing.T) {
+	tests := []struct {
+		name      string
+		scopes    tokenScopes
+		requested []string
+		wantErr   bool
+	}{
+		{name: "owner grants anything", scopes: nil, requested: []string{"admin", "class:premium"}},
+		{name: "unrestricted admin", scopes: tokenScopes{"admin"}, requested: []string{}},
+		{name: "held scopes", scopes: tokenScopes{"admin", "mode:note", "mode:reminder", "class:economy"}, requested: []string{"mode:note", "class:economy"}},
+		{name: "scope not held", scopes: tokenScopes{"admin", "class:economy"}, requested: []string{"class:premium"}, wantErr: true},
+		{name: "class dropped", scopes: tokenScopes{"admin", "class:economy"}, requested: []string{}, wantErr: true},
+		{name: "mode allowlist dropped", scopes: tokenScopes{"admin", "mode:note"}, requested: []string{"admin"}, wantErr: true},
+		{name: "denial dropped", scopes: tokenScopes{"admin", "-feature:send", "tier:low"}, requested: []string{"tier:low"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.scopes.grants(tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("grants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errScopeDenied) {
+				t.Errorf("Expected errScopeDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRequest_Scopes(t *testing.T) {
+	// Scopes apply after defaults: an empty mode becomes note, maxTokens 800
+	req := Req{Text: "Test", scopes: tokenScopes{"mode:note", "tier:low"}}
+	if err := validateRequest(&req); err != nil {
+		t.Errorf("Expected defaults to satisfy scopes, got %v", err)
+	}
+
+	req = Req{Text: "Test", Mode: "deepthink", scopes: tokenScopes{"-mode:deepthink"}}
+	if err := validateRequest(&req); !errors.Is(err, errScopeDenied) {
+		t.Errorf("Expected errScopeDenied, got %v", err)
+	}
+}
+
+func TestHandler_ScopeDenied(t *testing.T) {
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Body:       `{"text":"Think hard","mode":"deepthink"}`,
+	}
+	event.RequestContext.Authorizer = map[string]interface{}{"scopes": "mode:note"}
+
+	resp, err := handler(t.Context(), event)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected 403, got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Search paging: results per page, and how many captures the DynamoDB backend reads per
+// request before handing back a cursor
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchScanned   = 2000
+	searchPageSize     = 200
+	searchSnippetRunes = 160
+)
+
+// markdownSyntax is stripped from snippets so they read as plain text on the phone
+var markdownSyntax = regexp.MustCompile("[#*_`>]+")
+
+// SearchQuery is a parsed GET /search request
+type SearchQuery struct {
+	Terms  []string  // lowercase keywords; every one must appear
+	From   time.Time // zero = no lower bound
+	To     time.Time // exclusive; zero = no upper bound
+	Tags   []string  // canonical tags; every one must be present
+	Mode   string
+	Limit  int
+	Cursor string
+}
+
+// SearchResult is one matching capture, with a snippet around the first keyword
+type SearchResult struct {
+	ID        string   `json:"id"`
+	Mode      string   `json:"mode"`
+	Action    string   `json:"action"`
+	Title     string   `json:"title"`
+	Snippet   string   `json:"snippet"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// SearchResults is a page of results, newest first; pass nextCursor back as cursor for more
+type SearchResults struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// searchBackend runs a search over one principal's captures
+type searchBackend interface {
+	search(ctx context.Context, principal string, query SearchQuery) (SearchResults, error)
+}
+
+// parseSearchQuery reads q, from, to (YYYY-MM-DD, inclusive, or RFC 3339), tag
+// (comma-separated), mode, limit and cursor from the query string
+func parseSearchQuery(params map[string]string) (SearchQuery, error) {
+	query, err := parseCaptureFilter(params)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	query.Limit, query.Cursor = defaultSearchLimit, params["cursor"]
+	query.Terms = strings.Fields(strings.ToLower(params["q"]))
+
+	if mode := params["mode"]; mode != "" {
+		if _, ok := lookupMode(mode); !ok {
+			return SearchQuery{}, fmt.Errorf("unknown mode %q", mode)
+		}
+		query.Mode = mode
+	}
+	if limit := params["limit"]; limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return SearchQuery{}, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
+
+// parseCaptureFilter reads the from, to and tag parameters that search and export share
+func parseCaptureFilter(params map[string]string) (SearchQuery, error) {
+	var query SearchQuery
+	var err error
+	if query.From, err = parseSearchDate(params["from"], false); err != nil {
+		return SearchQuery{}, fmt.Errorf("from: %w", err)
+	}
+	if query.To, err = parseSearchDate(params["to"], true); err != nil {
+		return SearchQuery{}, fmt.Errorf("to: %w", err)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return SearchQuery{}, errors.New("from must be before to")
+	}
+
+	for _, tag := range strings.Split(params["tag"], ",") {
+		if key := canonicalTag(tag); key != "" {
+			query.Tags = append(query.Tags, key)
+		}
+	}
+	return query, nil
+}
+
+// parseSearchDate parses a date bound. A bare date is a whole UTC day, so as an upper
+// bound it runs to the end of that day.
+func parseSearchDate(value string, upper bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("must be YYYY-MM-DD or an RFC 3339 datetime")
+	}
+	if upper {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// matchesSearch reports whether a capture passes every filter in the query
+func matchesSearch(item HistoryItem, query SearchQuery) bool {
+	if item.Deleted {
+		return false
+	}
+	if query.Mode != "" && item.Mode != query.Mode {
+		return false
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		created, err := time.Parse(time.RFC3339, item.CreatedAt)
+		if err != nil || (!query.From.IsZero() && created.Before(query.From)) || (!query.To.IsZero() && !created.Before(query.To)) {
+			return false
+		}
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range item.Tags {
+		tags[canonicalTag(tag)] = true
+	}
+	for _, tag := range query.Tags {
+		if !tags[tag] {
+			return false
+		}
+	}
+
+	text := strings.ToLower(searchableText(item))
+	for _, term := range query.Terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchableText is the text keywords are matched against
+func searchableText(item HistoryItem) string {
+	parts := []string{item.Title, item.Markdown, strings.Join(item.Tags, " ")}
+	if item.Notes != nil {
+		parts = append(parts, *item.Notes)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// searchSnippet returns plain text from the capture around the first keyword it contains,
+// or its opening when there are no keywords
+func searchSnippet(item HistoryItem, terms []string) string {
+	text := strings.Join(strings.Fields(markdownSyntax.ReplaceAllString(item.Markdown, "")), " ")
+	if text == "" {
+		text = item.Title
+	}
+	runes := []rune(text)
+	if len(runes) <= searchSnippetRunes {
+		return text
+	}
+
+	start := 0
+	lower := strings.ToLower(text)
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 {
+			// Center the window on the match, counted in runes
+			start = utf8.RuneCountInString(lower[:i]) - searchSnippetRunes/3
+			break
+		}
+	}
+	start = max(0, min(start, len(runes)-searchSnippetRunes))
+	snippet := strings.TrimSpace(string(runes[start : start+searchSnippetRunes]))
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if start+searchSnippetRunes < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// newSearchResult builds a result from a matching capture
+func newSearchResult(item HistoryItem, terms []string) SearchResult {
+	tags := item.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return SearchResult{
+		ID:        item.ID,
+		Mode:      item.Mode,
+		Action:    item.Action,
+		Title:     item.Title,
+		Snippet:   searchSnippet(item, terms),
+		Tags:      tags,
+		CreatedAt: item.CreatedAt,
+	}
+}
+
+// dynamoSearch filters the history table in the function, newest first. It suits a
+// personal history; OpenSearch takes over when that gets too slow.
+type dynamoSearch struct{}
+
+func (dynamoSearch) search(ctx context.Context, principal string, query SearchQuery) (SearchResults, error) {
+	results := SearchResults{Results: []SearchResult{}}
+	var startKey map[string]types.AttributeValue
+	if query.Cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil {
+			return SearchResults{}, errInvalidCursor
+		}
+		startKey = map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+			"sk": &types.AttributeValueMemberS{Value: captureSKPrefix + string(id)},
+		}
+	}
+
+	scanned := 0
+	for {
+		out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(historyTableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":     &types.AttributeValueMemberS{Value: historyPK(principal)},
+				":prefix": &types.AttributeValueMemberS{Value: captureSKPrefix},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			ExclusiveStartKey: startKey,
+			Limit:             aws.Int32(searchPageSize),
+		})
+		if err != nil {
+			return SearchResults{}, fmt.Errorf("DynamoDB Query failed: %w", err)
+		}
+
+		var page []HistoryItem
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return SearchResults{}, fmt.Errorf("failed to unmarshal captures: %w", err)
+		}
+		for _, item := range page {
+			scanned++
+			if created, err := time.Parse(time.RFC3339, item.CreatedAt); err == nil && !query.From.IsZero() && created.Before(query.From) {
+				return results, nil // newest first, so nothing further is in range
+			}
+			if matchesSearch(item, query) {
+				results.Results = append(results.Results, newSearchResult(item, query.Terms))
+			}
+			if len(results.Results) == query.Limit || scanned == maxSearchScanned {
+				results.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(item.ID))
+				return results, nil
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return results, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// errInvalidCursor is returned for a cursor the backend didn't issue
+var errInvalidCursor = errors.New("invalid cursor")
+
+// loadSearchBackend picks the backend named by SEARCH_BACKEND (dynamodb by default)
+func loadSearchBackend() (searchBackend, error) {
+	switch backend := getEnv("SEARCH_BACKEND", "dynamodb"); backend {
+	case "dynamodb":
+		if historyTableName == "" {
+			return nil, nil
+		}
+		return dynamoSearch{}, nil
+	case "opensearch":
+		if os.Getenv("OPENSEARCH_ENDPOINT") == "" {
+			return nil, nil
+		}
+		return newOpenSearchBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown SEARCH_BACKEND %q", backend)
+	}
+}
+
+// isSearchRequest reports whether the route is the search endpoint
+func isSearchRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/search"
+}
+
+// handleSearch serves GET /search over the caller's captures
+func handleSearch(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	backend, err := loadSearchBackend()
+	if err != nil {
+		log.Printf("Search misconfigured: %v", err)
+		return errorResponse(ctx, apierror.NotConfigured("search not configured"))
+	}
+	if backend == nil {
+		return errorResponse(ctx, apierror.NotConfigured("search not configured"))
+	}
+
+	query, err := parseSearchQuery(event.QueryStringParameters)
+	if err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+	}
+	results, err := backend.search(ctx, principalFromEvent(event), query)
+	if errors.Is(err, errInvalidCursor) {
+		return errorResponse(ctx, apierror.InvalidRequest("invalid cursor"))
+	}
+	if err != nil {
+		log.Printf("Search failed: %v", err)
+		return errorResponse(ctx, apierror.Internal("Search failed"))
+	}
+	return apiResponse(200, results)
+}
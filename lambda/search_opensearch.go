@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// awsCredentials signs requests to services without an SDK client (OpenSearch Serverless)
+var awsCredentials aws.CredentialsProvider
+
+// openSearchClient sends SigV4-signed requests to an OpenSearch Serverless collection
+type openSearchClient struct {
+	http     *http.Client
+	endpoint string // https://<collection-id>.<region>.aoss.amazonaws.com
+	index    string
+	region   string
+}
+
+func newOpenSearchClient() *openSearchClient {
+	return &openSearchClient{
+		http:     sinkHTTPClient,
+		endpoint: strings.TrimSuffix(os.Getenv("OPENSEARCH_ENDPOINT"), "/"),
+		index:    getEnv("OPENSEARCH_INDEX", "captures"),
+		region:   getEnv("AWS_REGION", region),
+	}
+}
+
+// do sends a JSON request and returns the response body, failing on non-2xx statuses
+func (c *openSearchClient) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenSearch request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	// OpenSearch Serverless requires the payload hash as a header as well as in the signature
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	httpReq.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds, err := awsCredentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, httpReq, payloadHash, "aoss", c.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign OpenSearch request: %w", err)
+	}
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("OpenSearch request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 4<<20))
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return nil, fmt.Errorf("OpenSearch returned status %d: %s", httpResp.StatusCode, truncateRunes(string(respBody), 200))
+	}
+	return respBody, nil
+}
+
+// searchDocument is a capture as indexed in OpenSearch. tagKeys holds canonical tags,
+// so tag filters ignore case and punctuation as they do with DynamoDB.
+type searchDocument struct {
+	HistoryItem
+	TagKeys []string `json:"tagKeys"`
+}
+
+func newSearchDocument(item HistoryItem) searchDocument {
+	keys := []string{}
+	for _, tag := range item.Tags {
+		if key := canonicalTag(tag); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return searchDocument{HistoryItem: item, TagKeys: keys}
+}
+
+// MarshalJSON adds the principal, which HistoryItem hides from API responses but
+// searches filter on
+func (d searchDocument) MarshalJSON() ([]byte, error) {
+	type document searchDocument
+	return json.Marshal(struct {
+		document
+		Principal string `json:"principal"`
+	}{document(d), d.HistoryItem.Principal})
+}
+
+// OpenSearchSink indexes captures for the opensearch search backend
+type OpenSearchSink struct {
+	client *openSearchClient
+}
+
+func newOpenSearchSink() (Sink, error) {
+	if os.Getenv("OPENSEARCH_ENDPOINT") == "" {
+		return nil, fmt.Errorf("OPENSEARCH_ENDPOINT not configured")
+	}
+	return &OpenSearchSink{client: newOpenSearchClient()}, nil
+}
+
+func (s *OpenSearchSink) Name() string { return "opensearch" }
+
+// Deliver indexes the capture under its ID, so a redelivery replaces rather than duplicates it
+func (s *OpenSearchSink) Deliver(ctx context.Context, resp Response) error {
+	meta := captureMetaFrom(ctx)
+	body, err := json.Marshal(newSearchDocument(newHistoryItem(meta, resp)))
+	if err != nil {
+		return fmt.Errorf("failed to marshal search document: %w", err)
+	}
+	_, err = s.client.do(ctx, http.MethodPut, "/"+url.PathEscape(s.client.index)+"/_doc/"+url.PathEscape(meta.ID), body)
+	return err
+}
+
+// Remove deletes the capture's search document
+func (s *OpenSearchSink) Remove(ctx context.Context) error {
+	_, err := s.client.do(ctx, http.MethodDelete, "/"+url.PathEscape(s.client.index)+"/_doc/"+url.PathEscape(captureMetaFrom(ctx).ID), nil)
+	return err
+}
+
+// openSearchBackend searches the index the opensearch sink writes to. Keywords match
+// whole words (with stemming, per the index's analyzer) across title, markdown, notes and
+// tags, where the DynamoDB backend matches substrings.
+type openSearchBackend struct {
+	client *openSearchClient
+}
+
+func newOpenSearchBackend() searchBackend {
+	return openSearchBackend{client: newOpenSearchClient()}
+}
+
+func (b openSearchBackend) search(ctx context.Context, principal string, query SearchQuery) (SearchResults, error) {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"principal.keyword": principal}},
+	}
+	if query.Mode != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"mode.keyword": query.Mode}})
+	}
+	for _, tag := range query.Tags {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"tagKeys.keyword": tag}})
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		window := map[string]interface{}{}
+		if !query.From.IsZero() {
+			window["gte"] = query.From.UTC().Format(time.RFC3339)
+		}
+		if !query.To.IsZero() {
+			window["lt"] = query.To.UTC().Format(time.RFC3339)
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"createdAt": window}})
+	}
+	boolQuery := map[string]interface{}{"filter": filters}
+	if len(query.Terms) > 0 {
+		boolQuery["must"] = map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    strings.Join(query.Terms, " "),
+				"fields":   []string{"title^2", "markdown", "notes", "tags"},
+				"type":     "cross_fields",
+				"operator": "and",
+			},
+		}
+	}
+	request := map[string]interface{}{
+		"size":  query.Limit,
+		"query": map[string]interface{}{"bool": boolQuery},
+		"sort":  []interface{}{map[string]string{"createdAt": "desc"}, map[string]string{"id.keyword": "desc"}},
+	}
+	if query.Cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil || !json.Valid(after) {
+			return SearchResults{}, errInvalidCursor
+		}
+		request["search_after"] = json.RawMessage(after)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return SearchResults{}, fmt.Errorf("failed to marshal OpenSearch query: %w", err)
+	}
+	respBody, err := b.client.do(ctx, http.MethodPost, "/"+url.PathEscape(b.client.index)+"/_search", body)
+	if err != nil {
+		return SearchResults{}, err
+	}
+
+	var out struct {
+		Hits struct {
+			Hits []struct {
+				Source HistoryItem     `json:"_source"`
+				Sort   json.RawMessage `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return SearchResults{}, fmt.Errorf("failed to parse OpenSearch response: %w", err)
+	}
+
+	results := SearchResults{Results: []SearchResult{}}
+	for _, hit := range out.Hits.Hits {
+		results.Results = append(results.Results, newSearchResult(hit.Source, query.Terms))
+	}
+	if hits := out.Hits.Hits; len(hits) == query.Limit {
+		results.NextCursor = base64.RawURLEncoding.EncodeToString(hits[len(hits)-1].Sort)
+	}
+	return results, nil
+}
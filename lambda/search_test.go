@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func searchCapture(id, mode, title, markdown, createdAt string, tags ...string) HistoryItem {
+	created, _ := time.Parse(time.RFC3339, createdAt)
+	return newHistoryItem(captureMeta{ID: id, Principal: "user-1", Mode: mode, CreatedAt: created}, Response{Action: mode, Title: title, Markdown: markdown, Tags: tags})
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	query, err := parseSearchQuery(map[string]string{"q": "Dentist  Cleaning", "from": "2025-01-01", "to": "2025-01-31", "tag": "Health, to-do", "mode": "reminder", "limit": "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(query.Terms, ",") != "dentist,cleaning" || strings.Join(query.Tags, ",") != "health,todo" || query.Mode != "reminder" || query.Limit != 5 {
+		t.Errorf("query = %+v", query)
+	}
+	if query.From.Format(time.RFC3339) != "2025-01-01T00:00:00Z" || query.To.Format(time.RFC3339) != "2025-02-01T00:00:00Z" {
+		t.Errorf("window = %s to %s", query.From, query.To)
+	}
+
+	if query, _ := parseSearchQuery(nil); query.Limit != defaultSearchLimit {
+		t.Errorf("default limit = %d", query.Limit)
+	}
+	for _, params := range []map[string]string{
+		{"from": "last week"},
+		{"from": "2025-02-01", "to": "2025-01-01"},
+		{"mode": "poetry"},
+		{"limit": "0"},
+		{"limit": "500"},
+	} {
+		if _, err := parseSearchQuery(params); err == nil {
+			t.Errorf("parseSearchQuery(%v) succeeded, want error", params)
+		}
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	short := searchCapture("a", "note", "Title", "# Groceries\n\n**milk** and eggs", "2025-01-01T00:00:00Z")
+	if got := searchSnippet(short, []string{"eggs"}); got != "Groceries milk and eggs" {
+		t.Errorf("short snippet = %q", got)
+	}
+
+	long := searchCapture("b", "note", "Title", strings.Repeat("filler words here ", 30)+"the dentist said floss daily "+strings.Repeat("more filler text ", 30), "2025-01-01T00:00:00Z")
+	got := searchSnippet(long, []string{"dentist"})
+	if !strings.Contains(got, "dentist said floss") || !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("long snippet = %q", got)
+	}
+	if got := searchSnippet(long, nil); !strings.HasPrefix(got, "filler words") {
+		t.Errorf("snippet without terms = %q", got)
+	}
+}
+
+func TestHandleSearch(t *testing.T) {
+	call := func(principal string, params map[string]string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/search", QueryStringParameters: params}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+	ids := func(resp events.APIGatewayProxyResponse) (string, string) {
+		var results SearchResults
+		json.Unmarshal([]byte(resp.Body), &results)
+		var got []string
+		for _, r := range results.Results {
+			got = append(got, r.ID)
+		}
+		return strings.Join(got, ","), results.NextCursor
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("user-1", nil); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503", resp.StatusCode)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+	ctx := context.Background()
+	for _, item := range []HistoryItem{
+		searchCapture("20250103T090000Z-a", "note", "Dentist notes", "Ask about the cleaning", "2025-01-03T09:00:00Z", "Health"),
+		searchCapture("20250105T090000Z-b", "reminder", "Call dentist", "Book a cleaning", "2025-01-05T09:00:00Z", "health", "calls"),
+		searchCapture("20250110T090000Z-c", "note", "Garden", "Plant tomatoes", "2025-01-10T09:00:00Z", "home"),
+		searchCapture("20250112T090000Z-d", "note", "Dentist bill", "Paid", "2025-01-12T09:00:00Z"),
+	} {
+		saveCapture(ctx, item)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   string
+	}{
+		{"everything, newest first", nil, "20250112T090000Z-d,20250110T090000Z-c,20250105T090000Z-b,20250103T090000Z-a"},
+		{"all keywords must match", map[string]string{"q": "dentist cleaning"}, "20250105T090000Z-b,20250103T090000Z-a"},
+		{"tag", map[string]string{"tag": "HEALTH"}, "20250105T090000Z-b,20250103T090000Z-a"},
+		{"mode", map[string]string{"q": "dentist", "mode": "note"}, "20250112T090000Z-d,20250103T090000Z-a"},
+		{"date range", map[string]string{"from": "2025-01-04", "to": "2025-01-10"}, "20250110T090000Z-c,20250105T090000Z-b"},
+		{"no match", map[string]string{"q": "zebra"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call("user-1", tt.params)
+			if got, _ := ids(resp); resp.StatusCode != 200 || got != tt.want {
+				t.Errorf("got %d %q, want %q", resp.StatusCode, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		first, cursor := ids(call("user-1", map[string]string{"limit": "3"}))
+		if first != "20250112T090000Z-d,20250110T090000Z-c,20250105T090000Z-b" || cursor == "" {
+			t.Fatalf("first page = %q, cursor %q", first, cursor)
+		}
+		second, cursor := ids(call("user-1", map[string]string{"limit": "3", "cursor": cursor}))
+		if second != "20250103T090000Z-a" || cursor != "" {
+			t.Errorf("second page = %q, cursor %q", second, cursor)
+		}
+	})
+
+	t.Run("other principals see nothing", func(t *testing.T) {
+		if got, _ := ids(call("user-2", nil)); got != "" {
+			t.Errorf("user-2 got %q", got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if resp := call("user-1", map[string]string{"cursor": "%%%"}); resp.StatusCode != 400 {
+			t.Errorf("bad cursor: StatusCode = %d, want 400", resp.StatusCode)
+		}
+		if resp := call("user-1", map[string]string{"limit": "x"}); resp.StatusCode != 400 {
+			t.Errorf("bad limit: StatusCode = %d, want 400", resp.StatusCode)
+		}
+	})
+}
+
+func TestOpenSearchBackend(t *testing.T) {
+	var request map[string]interface{}
+	var authorization, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		w.Write([]byte(`{"hits":{"hits":[{"_source":{"id":"c1","mode":"note","action":"note","title":"Dentist","markdown":"Ask about the cleaning","tags":["health"],"createdAt":"2025-01-03T09:00:00Z"},"sort":[1735894800000,"c1"]}]}}`))
+	}))
+	defer server.Close()
+
+	orig := awsCredentials
+	awsCredentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+	})
+	t.Cleanup(func() { awsCredentials = orig })
+	t.Setenv("SEARCH_BACKEND", "opensearch")
+	t.Setenv("OPENSEARCH_ENDPOINT", server.URL)
+
+	backend, err := loadSearchBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := backend.search(context.Background(), "user-1", SearchQuery{Terms: []string{"cleaning"}, Tags: []string{"health"}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/captures/_search" || !strings.Contains(authorization, "/aoss/aws4_request") {
+		t.Errorf("path = %s, authorization = %s", path, authorization)
+	}
+	query, _ := json.Marshal(request["query"])
+	if !strings.Contains(string(query), `{"term":{"principal.keyword":"user-1"}}`) || !strings.Contains(string(query), `"tagKeys.keyword":"health"`) {
+		t.Errorf("query = %s", query)
+	}
+	if len(results.Results) != 1 || results.Results[0].Snippet != "Ask about the cleaning" || results.NextCursor == "" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestOpenSearchSink_Deliver(t *testing.T) {
+	var document map[string]interface{}
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&document)
+	}))
+	defer server.Close()
+
+	orig := awsCredentials
+	awsCredentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+	})
+	t.Cleanup(func() { awsCredentials = orig })
+	t.Setenv("OPENSEARCH_ENDPOINT", server.URL)
+
+	sink, err := newOpenSearchSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withCaptureMeta(context.Background(), testMeta())
+	if err := sink.Deliver(ctx, Response{Action: "note", Title: "Hello", Tags: []string{"To-Do"}}); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PUT" || path != "/captures/_doc/"+testMeta().ID {
+		t.Errorf("%s %s", method, path)
+	}
+	if document["principal"] != testMeta().Principal || document["title"] != "Hello" || document["tagKeys"].([]interface{})[0] != "todo" {
+		t.Errorf("document = %v", document)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretsAPI is the subset of the Secrets Manager client used by the handler
+type secretsAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+var (
+	secretsClient secretsAPI
+	secretCache   = &ParamCache{entries: map[string]cachedParam{}}
+)
+
+// getSecret retrieves a Secrets Manager secret string, caching it like getParameter.
+// SECURITY: Never log secret values
+func getSecret(ctx context.Context, secretID string) (string, error) {
+	now := time.Now()
+
+	secretCache.mu.RLock()
+	entry, ok := secretCache.entries[secretID]
+	secretCache.mu.RUnlock()
+
+	if ok && now.Before(entry.expiration) {
+		return entry.value, nil
+	}
+
+	secretsCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	output, err := secretsClient.GetSecretValue(secretsCtx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		if ok && entry.value != "" {
+			log.Printf("GetSecretValue failed, returning stale cached secret: %v", err)
+			return entry.value, nil
+		}
+		return "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	value := aws.ToString(output.SecretString)
+	if value == "" {
+		return "", fmt.Errorf("secret has no string value")
+	}
+
+	secretCache.mu.Lock()
+	secretCache.entries[secretID] = cachedParam{value: value, expiration: now.Add(defaultParamCacheTTL)}
+	secretCache.mu.Unlock()
+
+	return value, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// selfTestText is the fixed request the canary sends: a reminder with a relative date
+// exercises the JSON format, the action and date resolution in one call
+const selfTestText = "Remind me to water the plants tomorrow at 9am"
+
+// SelfTestCheck is one assertion made on the canary's response
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestResult is the body of POST /selftest, returned with 200 when every check
+// passes and 503 otherwise so synthetic monitors can alarm on the status alone
+type SelfTestResult struct {
+	Passed  bool            `json:"passed"`
+	ModelID string          `json:"modelId"`
+	Checks  []SelfTestCheck `json:"checks"`
+	Latency DebugLatency    `json:"latency"`
+}
+
+// selfTestChecks asserts that the canary's response parsed and makes sense
+func selfTestChecks(resp *Response, now time.Time) []SelfTestCheck {
+	check := func(name string, passed bool, detail string) SelfTestCheck {
+		return SelfTestCheck{Name: name, Passed: passed, Detail: detail}
+	}
+	checks := []SelfTestCheck{
+		check("structured", resp.parsePath == "structured", "parse path: "+resp.parsePath),
+		check("action", resp.Action == "reminder", "action: "+resp.Action),
+		check("title", strings.TrimSpace(resp.Title) != "", "title: "+resp.Title),
+	}
+	if resp.DueISO == nil {
+		checks = append(checks, check("dueISO", false, "dueISO missing"))
+	} else if due, err := time.Parse(time.RFC3339, *resp.DueISO); err != nil {
+		checks = append(checks, check("dueISO", false, "dueISO is not RFC 3339: "+*resp.DueISO))
+	} else {
+		checks = append(checks, check("dueISO", due.After(now), "dueISO: "+*resp.DueISO))
+	}
+	return checks
+}
+
+// isSelfTestRequest reports whether the route is the canary endpoint
+func isSelfTestRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/selftest"
+}
+
+// handleSelfTest serves POST /selftest for admin tokens: the fixed canary request runs
+// through the same pipeline as /invoke (prompt, Bedrock, parsing and finalizers) without
+// sinks, history or callbacks, and the response is checked
+func handleSelfTest(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if !callerIsAdmin(event) {
+		log.Printf("Self-test denied for principal %s", principalFromEvent(event))
+		return errorResponse(ctx, apierror.Forbidden("admin access required"))
+	}
+	if event.HTTPMethod != "POST" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+
+	req := Req{Text: selfTestText, Mode: "reminder", Debug: true, admin: true, dryRun: true}
+	if err := validateRequest(&req); err != nil {
+		log.Printf("Self-test request invalid: %v", err)
+		return errorResponse(ctx, apierror.Internal("Self-test request invalid"))
+	}
+
+	requestPreferences(ctx, &req, principalFromEvent(event))
+	now := time.Now().UTC()
+	result := SelfTestResult{ModelID: modelID}
+	response, apiErr := processRequest(ctx, &req, newCaptureID(), principalFromEvent(event), now)
+	if apiErr != nil {
+		result.Checks = []SelfTestCheck{{Name: "model", Passed: false, Detail: apiErr.Message}}
+		result.Latency.TotalMs = time.Since(now).Milliseconds()
+	} else {
+		result.Checks = append([]SelfTestCheck{{Name: "model", Passed: true}}, selfTestChecks(response, now)...)
+		result.Latency = response.Debug.Latency
+	}
+
+	result.Passed = true
+	for _, c := range result.Checks {
+		result.Passed = result.Passed && c.Passed
+	}
+	if !result.Passed {
+		log.Printf("Self-test failed: %+v", result.Checks)
+		return apiResponse(503, result)
+	}
+	return apiResponse(200, result)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestSelfTestChecks(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	failed := func(checks []SelfTestCheck) []string {
+		var names []string
+		for _, c := range checks {
+			if !c.Passed {
+				names = append(names, c.Name)
+			}
+		}
+		return names
+	}
+
+	due := "2025-01-16T09:00:00Z"
+	if got := failed(selfTestChecks(&Response{parsePath: "structured", Action: "reminder", Title: "Water the plants", DueISO: &due}, now)); len(got) != 0 {
+		t.Errorf("good reply failed %v", got)
+	}
+	past := "2025-01-14T09:00:00Z"
+	if got := failed(selfTestChecks(&Response{parsePath: "fallback", Action: "note", DueISO: &past}, now)); len(got) != 4 {
+		t.Errorf("bad reply failed %v, want every check", got)
+	}
+	if got := failed(selfTestChecks(&Response{parsePath: "structured", Action: "reminder", Title: "x"}, now)); len(got) != 1 || got[0] != "dueISO" {
+		t.Errorf("reply without dueISO failed %v", got)
+	}
+}
+
+func TestHandleSelfTest(t *testing.T) {
+	sink := &stubSink{name: "ok"}
+	useSinks(t, sink)
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["ok"]}`)
+	call := func(method, role string) (events.APIGatewayProxyResponse, SelfTestResult) {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/selftest"}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "monitor", "role": role}
+		resp, _ := handler(context.Background(), event)
+		var result SelfTestResult
+		json.Unmarshal([]byte(resp.Body), &result)
+		return resp, result
+	}
+
+	if resp, _ := call("POST", ""); resp.StatusCode != 403 {
+		t.Errorf("non-admin: StatusCode = %d, want 403", resp.StatusCode)
+	}
+	if resp, _ := call("GET", "admin"); resp.StatusCode != 405 {
+		t.Errorf("GET: StatusCode = %d, want 405", resp.StatusCode)
+	}
+
+	due := time.Now().UTC().Add(24 * time.Hour).Format(time.RFC3339)
+	model := &fakeBedrock{text: `{"action":"reminder","title":"Water the plants","markdown":"Water the plants","shortText":"Water plants","dueISO":"` + due + `"}`}
+	useFakeBedrock(t, model)
+	resp, result := call("POST", "admin")
+	if resp.StatusCode != 200 || !result.Passed || len(result.Checks) != 5 || result.ModelID != modelID {
+		t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if sink.got != nil {
+		t.Error("self-test delivered to a sink")
+	}
+
+	model.text = "Water the plants"
+	if resp, result := call("POST", "admin"); resp.StatusCode != 503 || result.Passed {
+		t.Errorf("raw reply: got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "strings"
+
+// Sentiments, as returned in Response.sentiment
+const (
+	sentimentPositive = "positive"
+	sentimentNeutral  = "neutral"
+	sentimentNegative = "negative"
+	sentimentMixed    = "mixed"
+)
+
+// sentimentSynonyms maps values the model sometimes returns onto the four sentiments
+var sentimentSynonyms = map[string]string{
+	"positive": sentimentPositive, "happy": sentimentPositive, "upbeat": sentimentPositive, "good": sentimentPositive,
+	"neutral": sentimentNeutral, "none": sentimentNeutral, "factual": sentimentNeutral,
+	"negative": sentimentNegative, "sad": sentimentNegative, "angry": sentimentNegative, "frustrated": sentimentNegative, "bad": sentimentNegative,
+	"mixed": sentimentMixed, "ambivalent": sentimentMixed,
+}
+
+// normalizeSentiment validates the model's sentiment; anything unrecognised is neutral
+func normalizeSentiment(resp *Response) {
+	if sentiment, ok := sentimentSynonyms[strings.ToLower(strings.TrimSpace(resp.Sentiment))]; ok {
+		resp.Sentiment = sentiment
+		return
+	}
+	resp.Sentiment = sentimentNeutral
+}
+
+// normalizeUrgency validates the model's urgency (low|medium|high, the same scale and
+// synonyms as priority). When it's unusable, a reminder's priority decides, then the
+// phrasing of the request; everything else is medium. Runs after normalizePriority.
+func normalizeUrgency(resp *Response, text string) {
+	if urgency, ok := prioritySynonyms[strings.ToLower(strings.TrimSpace(resp.Urgency))]; ok {
+		resp.Urgency = urgency
+		return
+	}
+
+	switch {
+	case resp.Priority != "":
+		resp.Urgency = resp.Priority
+	case lowPriorityPhrases.MatchString(text):
+		resp.Urgency = priorityLow
+	case highPriorityPhrases.MatchString(text):
+		resp.Urgency = priorityHigh
+	default:
+		resp.Urgency = priorityMedium
+	}
+}
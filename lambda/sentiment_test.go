@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestNormalizeSentiment(t *testing.T) {
+	tests := map[string]string{
+		"positive":   "positive",
+		" Happy ":    "positive",
+		"frustrated": "negative",
+		"mixed":      "mixed",
+		"elated?":    "neutral",
+		"":           "neutral",
+	}
+	for in, want := range tests {
+		resp := Response{Sentiment: in}
+		normalizeSentiment(&resp)
+		if resp.Sentiment != want {
+			t.Errorf("normalizeSentiment(%q) = %q, want %q", in, resp.Sentiment, want)
+		}
+	}
+}
+
+func TestNormalizeUrgency(t *testing.T) {
+	tests := []struct {
+		name string
+		resp Response
+		text string
+		want string
+	}{
+		{"model value", Response{Urgency: "HIGH"}, "", "high"},
+		{"synonym", Response{Urgency: "urgent"}, "", "high"},
+		{"reminder priority", Response{Urgency: "soonish", Priority: "low"}, "call mom", "low"},
+		{"urgent phrasing", Response{}, "email the landlord ASAP", "high"},
+		{"relaxed phrasing", Response{}, "read that book someday", "low"},
+		{"default", Response{}, "note about the garden", "medium"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.resp
+			normalizeUrgency(&resp, tt.text)
+			if resp.Urgency != tt.want {
+				t.Errorf("Urgency = %q, want %q", resp.Urgency, tt.want)
+			}
+		})
+	}
+}
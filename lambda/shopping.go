@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key of a principal's shopping list in the history table
+const shoppingSK = "SHOPPING"
+
+// Shopping list size caps; the whole list is one DynamoDB item
+const (
+	maxShoppingItems     = 200
+	maxShoppingNameChars = 80
+)
+
+// Words ignored when deciding whether two items are the same thing, so "2% milk",
+// "a gallon of milk" and "milk" merge while "almond milk" stays separate
+var shoppingFillerWords = map[string]bool{
+	"a": true, "an": true, "the": true, "some": true, "more": true, "of": true, "few": true,
+	"bag": true, "bags": true, "box": true, "boxes": true, "bottle": true, "bottles": true,
+	"can": true, "cans": true, "carton": true, "cartons": true, "jar": true, "jars": true,
+	"pack": true, "packs": true, "dozen": true, "gallon": true, "gallons": true,
+	"lb": true, "lbs": true, "pound": true, "pounds": true, "oz": true, "kg": true,
+}
+
+// shoppingWord matches the words of an item name; tokens with digits ("2%", "12oz") are dropped
+var shoppingWord = regexp.MustCompile(`[\p{L}\p{N}%']+`)
+
+// ShoppingItem is one entry on a shopping list
+type ShoppingItem struct {
+	ID       string `dynamodbav:"id" json:"id,omitempty"`
+	Name     string `dynamodbav:"name" json:"name"`
+	Quantity string `dynamodbav:"quantity,omitempty" json:"quantity,omitempty"` // free text, e.g. "2" or "1 gallon"
+	Checked  bool   `dynamodbav:"checked" json:"checked"`
+	AddedAt  string `dynamodbav:"addedAt" json:"addedAt,omitempty"`
+}
+
+// ShoppingList is a principal's persistent shopping list
+type ShoppingList struct {
+	PK        string         `dynamodbav:"pk" json:"-"`
+	SK        string         `dynamodbav:"sk" json:"-"`
+	Items     []ShoppingItem `dynamodbav:"items" json:"items"`
+	UpdatedAt string         `dynamodbav:"updatedAt" json:"updatedAt,omitempty"`
+}
+
+// ShoppingCapture is the shopping mode result: the items heard in this request, as
+// merged into the list, and how many items are left to buy
+type ShoppingCapture struct {
+	Items     []ShoppingItem `json:"items"`
+	OpenItems int            `json:"openItems"`
+}
+
+// shoppingItemRequest is the body of PATCH /shopping/items/{id}
+type shoppingItemRequest struct {
+	Checked *bool `json:"checked"`
+}
+
+// shoppingKey reduces an item name to the words that identify it: lowercase, without
+// quantities, packaging or plurals
+func shoppingKey(name string) string {
+	var words []string
+	for _, word := range shoppingWord.FindAllString(strings.ToLower(name), -1) {
+		if shoppingFillerWords[word] || strings.ContainsAny(word, "0123456789") {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(word, "oes"), strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"):
+			word = strings.TrimSuffix(word, "es")
+		case strings.HasSuffix(word, "ies") && len(word) > 4:
+			word = strings.TrimSuffix(word, "ies") + "y"
+		case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && len(word) > 3:
+			word = strings.TrimSuffix(word, "s")
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// normalizeShoppingItems cleans the model's items and merges duplicates within the request
+func normalizeShoppingItems(items []ShoppingItem) []ShoppingItem {
+	normalized := []ShoppingItem{}
+	index := map[string]int{}
+	for _, item := range items {
+		item.Name = strings.Join(strings.Fields(item.Name), " ")
+		item.Quantity = strings.Join(strings.Fields(item.Quantity), " ")
+		if runes := []rune(item.Name); len(runes) > maxShoppingNameChars {
+			item.Name = string(runes[:maxShoppingNameChars])
+		}
+		key := shoppingKey(item.Name)
+		if key == "" {
+			continue
+		}
+		if i, ok := index[key]; ok {
+			normalized[i] = mergeShoppingItem(normalized[i], item)
+			continue
+		}
+		index[key] = len(normalized)
+		normalized = append(normalized, ShoppingItem{Name: item.Name, Quantity: item.Quantity})
+	}
+	return normalized
+}
+
+// mergeShoppingItem folds a newly heard item into an existing one: the more specific
+// name and the latest quantity win, and a checked-off item goes back on the list
+func mergeShoppingItem(existing, heard ShoppingItem) ShoppingItem {
+	if utf8.RuneCountInString(heard.Name) > utf8.RuneCountInString(existing.Name) {
+		existing.Name = heard.Name
+	}
+	if heard.Quantity != "" {
+		existing.Quantity = heard.Quantity
+	}
+	existing.Checked = false
+	return existing
+}
+
+// mergeShoppingList adds heard items to the list, returning the list and the merged
+// entries for the heard items. Checked-off items are dropped, oldest first, to make
+// room; items that still don't fit are skipped.
+func mergeShoppingList(list []ShoppingItem, heard []ShoppingItem, now time.Time) ([]ShoppingItem, []ShoppingItem) {
+	merged := []ShoppingItem{}
+	for _, item := range heard {
+		key := shoppingKey(item.Name)
+		found := false
+		for i := range list {
+			if shoppingKey(list[i].Name) == key {
+				list[i] = mergeShoppingItem(list[i], item)
+				merged = append(merged, list[i])
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		if len(list) >= maxShoppingItems {
+			list = dropOldestChecked(list)
+		}
+		if len(list) >= maxShoppingItems {
+			log.Printf("Shopping list full, skipping %q", item.Name)
+			continue
+		}
+		item.ID = newShoppingItemID()
+		item.Checked = false
+		item.AddedAt = now.UTC().Format(time.RFC3339)
+		list = append(list, item)
+		merged = append(merged, item)
+	}
+	return list, merged
+}
+
+// dropOldestChecked removes the first checked-off item, if any
+func dropOldestChecked(list []ShoppingItem) []ShoppingItem {
+	for i, item := range list {
+		if item.Checked {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// openShoppingItems counts the items not yet checked off
+func openShoppingItems(list []ShoppingItem) int {
+	open := 0
+	for _, item := range list {
+		if !item.Checked {
+			open++
+		}
+	}
+	return open
+}
+
+// newShoppingItemID returns a short random identifier for check-off requests
+func newShoppingItemID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// shoppingKeyAttributes returns the history table key of a principal's shopping list
+func shoppingKeyAttributes(principal string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+		"sk": &types.AttributeValueMemberS{Value: shoppingSK},
+	}
+}
+
+// loadShoppingList reads a principal's shopping list, returning an empty one when none is stored
+func loadShoppingList(ctx context.Context, principal string) (ShoppingList, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key:       shoppingKeyAttributes(principal),
+	})
+	if err != nil {
+		return ShoppingList{}, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	list := ShoppingList{Items: []ShoppingItem{}}
+	if len(out.Item) == 0 {
+		return list, nil
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &list); err != nil {
+		return ShoppingList{}, fmt.Errorf("failed to unmarshal shopping list: %w", err)
+	}
+	return list, nil
+}
+
+// saveShoppingList replaces a principal's shopping list
+func saveShoppingList(ctx context.Context, principal string, items []ShoppingItem, now time.Time) (ShoppingList, error) {
+	list := ShoppingList{
+		PK:        historyPK(principal),
+		SK:        shoppingSK,
+		Items:     items,
+		UpdatedAt: now.UTC().Format(time.RFC3339),
+	}
+	item, err := attributevalue.MarshalMap(list)
+	if err != nil {
+		return ShoppingList{}, fmt.Errorf("failed to marshal shopping list: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return ShoppingList{}, fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return list, nil
+}
+
+// finalizeShopping cleans the model's items and merges them into the caller's list.
+// Without storage (or when it fails) the response still lists the items heard.
+func finalizeShopping(ctx context.Context, meta captureMeta, resp *Response) {
+	if resp.Shopping == nil {
+		resp.Shopping = &ShoppingCapture{}
+	}
+	resp.Action = "shopping"
+	heard := normalizeShoppingItems(resp.Shopping.Items)
+	resp.Shopping.Items = heard
+
+	if historyTableName == "" {
+		return
+	}
+	list, err := loadShoppingList(ctx, meta.Principal)
+	if err != nil {
+		log.Printf("Failed to load shopping list: %v", err)
+		return
+	}
+	items, merged := mergeShoppingList(list.Items, heard, meta.CreatedAt)
+	if _, err := saveShoppingList(ctx, meta.Principal, items, meta.CreatedAt); err != nil {
+		log.Printf("Failed to save shopping list: %v", err)
+		return
+	}
+	resp.Shopping.Items = merged
+	resp.Shopping.OpenItems = openShoppingItems(items)
+}
+
+// isShoppingRequest reports whether the route is part of the shopping list API
+func isShoppingRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	path = strings.TrimSuffix(path, "/")
+	return path == "/shopping" || strings.HasPrefix(path, "/shopping/")
+}
+
+// handleShopping serves GET /shopping (the caller's list) and PATCH
+// /shopping/items/{id} (check an item off, or back on)
+func handleShopping(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	id := event.PathParameters["id"]
+	if (id == "" && event.HTTPMethod != "GET") || (id != "" && event.HTTPMethod != "PATCH") {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("shopping list storage not configured"))
+	}
+	principal := principalFromEvent(event)
+
+	list, err := loadShoppingList(ctx, principal)
+	if err != nil {
+		log.Printf("Failed to load shopping list: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to load shopping list"))
+	}
+	if id == "" {
+		return apiResponse(200, list)
+	}
+
+	var body shoppingItemRequest
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	if body.Checked == nil {
+		return errorResponse(ctx, apierror.InvalidRequest("checked field is required"))
+	}
+	found := false
+	for i := range list.Items {
+		if list.Items[i].ID == id {
+			list.Items[i].Checked = *body.Checked
+			found = true
+		}
+	}
+	if !found {
+		return errorResponse(ctx, apierror.NotFound("Shopping list item not found"))
+	}
+
+	list, err = saveShoppingList(ctx, principal, list.Items, time.Now())
+	if err != nil {
+		log.Printf("Failed to save shopping list: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to save shopping list"))
+	}
+	return apiResponse(200, list)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestShoppingKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"milk", "2% milk", true},
+		{"Milk", "a gallon of milk", true},
+		{"eggs", "a dozen egg", true},
+		{"tomatoes", "Tomato", true},
+		{"berries", "berry", true},
+		{"peaches", "peach", true},
+		{"milk", "almond milk", false},
+		{"bread", "breadcrumbs", false},
+	}
+	for _, tt := range tests {
+		if got := shoppingKey(tt.a) == shoppingKey(tt.b); got != tt.same {
+			t.Errorf("shoppingKey(%q) = %q, shoppingKey(%q) = %q, want same = %v", tt.a, shoppingKey(tt.a), tt.b, shoppingKey(tt.b), tt.same)
+		}
+	}
+	if got := shoppingKey("12 oz"); got != "" {
+		t.Errorf("shoppingKey(\"12 oz\") = %q, want empty", got)
+	}
+}
+
+func TestNormalizeShoppingItems(t *testing.T) {
+	got := normalizeShoppingItems([]ShoppingItem{
+		{Name: "  milk ", Quantity: "1"},
+		{Name: "eggs"},
+		{Name: "2% milk", Quantity: "2 gallons"},
+		{Name: "  "},
+	})
+	want := []ShoppingItem{{Name: "2% milk", Quantity: "2 gallons"}, {Name: "eggs"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("normalizeShoppingItems() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeShoppingList(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	list := []ShoppingItem{
+		{ID: "a1", Name: "2% milk", Quantity: "1", Checked: true},
+		{ID: "b2", Name: "bread"},
+	}
+
+	list, merged := mergeShoppingList(list, []ShoppingItem{{Name: "milk", Quantity: "2"}, {Name: "eggs"}}, now)
+	if len(list) != 3 || len(merged) != 2 {
+		t.Fatalf("list = %+v, merged = %+v", list, merged)
+	}
+	// The existing item keeps its more specific name and ID, and is back on the list
+	if milk := list[0]; milk.ID != "a1" || milk.Name != "2% milk" || milk.Quantity != "2" || milk.Checked {
+		t.Errorf("milk = %+v", milk)
+	}
+	if eggs := list[2]; eggs.ID == "" || eggs.Name != "eggs" || eggs.AddedAt != "2025-01-15T09:00:00Z" {
+		t.Errorf("eggs = %+v", eggs)
+	}
+	if merged[0].ID != "a1" || merged[1].ID != list[2].ID {
+		t.Errorf("merged = %+v", merged)
+	}
+	if open := openShoppingItems(list); open != 3 {
+		t.Errorf("openShoppingItems() = %d, want 3", open)
+	}
+
+	t.Run("full list drops checked items", func(t *testing.T) {
+		full := make([]ShoppingItem, maxShoppingItems)
+		for i := range full {
+			full[i] = ShoppingItem{ID: fmt.Sprint(i), Name: fmt.Sprintf("item %c%c", 'a'+i/26, 'a'+i%26)}
+		}
+		full[5].Checked = true
+
+		got, merged := mergeShoppingList(full, []ShoppingItem{{Name: "coffee"}, {Name: "tea"}}, now)
+		if len(got) != maxShoppingItems || len(merged) != 1 || got[len(got)-1].Name != "coffee" {
+			t.Errorf("got %d items, merged %+v", len(got), merged)
+		}
+		for _, item := range got {
+			if item.ID == "5" {
+				t.Error("checked item was not dropped")
+			}
+		}
+	})
+}
+
+func TestFinalizeShopping(t *testing.T) {
+	meta := captureMeta{ID: "cap-1", Principal: "user-1", CreatedAt: time.Now()}
+
+	t.Run("without storage", func(t *testing.T) {
+		resp := Response{Action: "note", Shopping: &ShoppingCapture{Items: []ShoppingItem{{Name: "milk"}, {Name: "Milk"}}}}
+		finalizeShopping(context.Background(), meta, &resp)
+		if resp.Action != "shopping" || len(resp.Shopping.Items) != 1 || resp.Shopping.Items[0].ID != "" {
+			t.Errorf("got %+v", resp.Shopping)
+		}
+	})
+
+	t.Run("merges into the stored list", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{})
+		for _, name := range []string{"milk", "2% milk", "eggs"} {
+			resp := Response{Shopping: &ShoppingCapture{Items: []ShoppingItem{{Name: name}}}}
+			finalizeShopping(context.Background(), meta, &resp)
+		}
+
+		list, err := loadShoppingList(context.Background(), "user-1")
+		if err != nil {
+			t.Fatalf("loadShoppingList() error = %v", err)
+		}
+		if len(list.Items) != 2 || list.Items[0].Name != "2% milk" || list.Items[1].Name != "eggs" {
+			t.Errorf("list = %+v", list.Items)
+		}
+	})
+}
+
+func TestHandleShopping(t *testing.T) {
+	call := func(method, resource, id, principal, body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: resource, Body: body}
+		if id != "" {
+			event.PathParameters = map[string]string{"id": id}
+		}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("GET", "/shopping", "", "user-1", ""); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+
+	t.Run("empty until something is added", func(t *testing.T) {
+		resp := call("GET", "/shopping", "", "user-1", "")
+		if resp.StatusCode != 200 || resp.Body != `{"items":[]}` {
+			t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	meta := captureMeta{ID: "cap-1", Principal: "user-1", CreatedAt: time.Now()}
+	added := Response{Shopping: &ShoppingCapture{Items: []ShoppingItem{{Name: "milk"}, {Name: "eggs"}}}}
+	finalizeShopping(context.Background(), meta, &added)
+	milkID := added.Shopping.Items[0].ID
+
+	t.Run("check off", func(t *testing.T) {
+		resp := call("PATCH", "/shopping/items/{id}", milkID, "user-1", `{"checked":true}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+		var list ShoppingList
+		json.Unmarshal([]byte(call("GET", "/shopping", "", "user-1", "").Body), &list)
+		if len(list.Items) != 2 || !list.Items[0].Checked || list.Items[1].Checked {
+			t.Errorf("list = %+v", list.Items)
+		}
+	})
+
+	t.Run("other principals can't see or change the list", func(t *testing.T) {
+		if resp := call("GET", "/shopping", "", "user-2", ""); resp.Body != `{"items":[]}` {
+			t.Errorf("other principal got %s", resp.Body)
+		}
+		if resp := call("PATCH", "/shopping/items/{id}", milkID, "user-2", `{"checked":true}`); resp.StatusCode != 404 {
+			t.Errorf("StatusCode = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if resp := call("PATCH", "/shopping/items/{id}", milkID, "user-1", `{}`); resp.StatusCode != 400 {
+			t.Errorf("StatusCode = %d, want 400", resp.StatusCode)
+		}
+		if resp := call("POST", "/shopping", "", "user-1", `{}`); resp.StatusCode != 405 {
+			t.Errorf("StatusCode = %d, want 405", resp.StatusCode)
+		}
+	})
+}
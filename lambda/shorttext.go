@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Default word cap for shortText (overridable via SHORT_TEXT_MAX_WORDS)
+const defaultShortTextWords = 30
+
+// Markdown syntax dropped when deriving shortText from the full markdown
+var (
+	markdownLink   = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownPrefix = regexp.MustCompile(`(?m)^[ \t]*(#{1,6}\s+|[-*+]\s+(\[[ xX]\]\s+)?|\d+[.)]\s+|>\s*)`)
+	markdownMarks  = regexp.MustCompile("[*_`~]+")
+)
+
+func shortTextMaxWords() int {
+	return limitEnv("SHORT_TEXT_MAX_WORDS", defaultShortTextWords, 1)
+}
+
+// finalizeShortText makes sure a response has a glanceable shortText within the word
+// cap. The model writes one alongside the markdown; when it doesn't (fallback
+// responses, older prompts) the research summary or the markdown itself is condensed.
+func finalizeShortText(resp *Response) {
+	text := resp.ShortText
+	if strings.TrimSpace(text) == "" {
+		text = resp.Summary
+	}
+	if strings.TrimSpace(text) == "" {
+		text = plainText(resp.Markdown)
+	}
+	if strings.TrimSpace(text) == "" {
+		text = resp.Title
+	}
+	resp.ShortText = capWords(text, shortTextMaxWords())
+}
+
+// plainText strips common markdown so it reads as a sentence on the watch face
+func plainText(markdown string) string {
+	text := markdownLink.ReplaceAllString(markdown, "$1")
+	text = markdownPrefix.ReplaceAllString(text, "")
+	text = markdownMarks.ReplaceAllString(text, "")
+	return text
+}
+
+// capWords collapses whitespace and keeps at most max words, ending with an ellipsis
+// when words were dropped
+func capWords(text string, max int) string {
+	words := strings.Fields(text)
+	if len(words) <= max {
+		return strings.Join(words, " ")
+	}
+	return strings.TrimRight(strings.Join(words[:max], " "), ".,;:") + "…"
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestCapWords(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"Call mom tomorrow", 5, "Call mom tomorrow"},
+		{"  Call\n mom   tomorrow ", 5, "Call mom tomorrow"},
+		{"One, two, three, four", 2, "One, two…"},
+		{"", 5, ""},
+	}
+	for _, tt := range tests {
+		if got := capWords(tt.text, tt.max); got != tt.want {
+			t.Errorf("capWords(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	got := capWords(plainText("# Trip\n- [ ] **Book** the [flight](https://x.example)\n1. Pack `bags`\n> quoted"), 20)
+	if want := "Trip Book the flight Pack bags quoted"; got != want {
+		t.Errorf("plainText() = %q, want %q", got, want)
+	}
+}
+
+func TestFinalizeShortText(t *testing.T) {
+	t.Setenv("SHORT_TEXT_MAX_WORDS", "4")
+
+	tests := []struct {
+		name string
+		resp Response
+		want string
+	}{
+		{"model short text capped", Response{ShortText: "Call mom tomorrow at 3pm please", Markdown: "x"}, "Call mom tomorrow at…"},
+		{"research summary", Response{Summary: "Tides follow the moon.", Markdown: "# Tides\nLong answer"}, "Tides follow the moon."},
+		{"derived from markdown", Response{Markdown: "## Groceries\n- **milk**\n- eggs\n- bread"}, "Groceries milk eggs bread"},
+		{"title when empty", Response{Title: "Wrist Agent Note"}, "Wrist Agent Note"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			finalizeShortText(&tt.resp)
+			if tt.resp.ShortText != tt.want {
+				t.Errorf("ShortText = %q, want %q", tt.resp.ShortText, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Response signature headers; the same scheme signs callbacks
+const (
+	timestampHeader = "X-Wrist-Timestamp"
+	signatureHeader = "X-Wrist-Signature"
+)
+
+// signResponse adds X-Wrist-Timestamp and X-Wrist-Signature (sha256=<hex HMAC of
+// "<timestamp>.<body>">) to an API response when RESPONSE_SIGNING_PARAM_NAME names the
+// shared secret, so clients can check the body wasn't altered on the way. The signature
+// covers the uncompressed body. If the secret can't be loaded the response goes out
+// unsigned, and clients that require a signature reject it.
+func signResponse(ctx context.Context, resp *events.APIGatewayProxyResponse) {
+	secretParam := os.Getenv("RESPONSE_SIGNING_PARAM_NAME")
+	if secretParam == "" {
+		return
+	}
+	secret, err := getParameter(ctx, secretParam)
+	if err != nil {
+		log.Printf("Failed to load response signing secret, sending unsigned: %v", err)
+		return
+	}
+
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		if body, err = base64.StdEncoding.DecodeString(resp.Body); err != nil {
+			log.Printf("Failed to decode response body for signing, sending unsigned: %v", err)
+			return
+		}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	resp.Headers[timestampHeader] = timestamp
+	resp.Headers[signatureHeader] = "sha256=" + signPayload([]byte(secret), timestamp, body)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestSignResponse(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/response-secret": "secret"}})
+	t.Setenv("RESPONSE_SIGNING_PARAM_NAME", "/wrist-agent/response-secret")
+
+	resp, _ := handler(context.Background(), faultEvent("dev", "", ""))
+	timestamp := resp.Headers[timestampHeader]
+	if timestamp == "" || resp.Headers[signatureHeader] != "sha256="+signPayload([]byte("secret"), timestamp, []byte(resp.Body)) {
+		t.Fatalf("signature does not verify: %v", resp.Headers)
+	}
+
+	// A body altered on the way no longer verifies
+	truncated, _ := handler(context.Background(), faultEvent("dev", "admin", "truncated"))
+	if truncated.Headers[signatureHeader] == "sha256="+signPayload([]byte("secret"), truncated.Headers[timestampHeader], []byte(truncated.Body)) {
+		t.Error("truncated body should not verify")
+	}
+
+	// Binary bodies are signed as the decoded bytes
+	binary := events.APIGatewayProxyResponse{Body: base64.StdEncoding.EncodeToString([]byte("BEGIN:VCALENDAR")), IsBase64Encoded: true}
+	signResponse(context.Background(), &binary)
+	if binary.Headers[signatureHeader] != "sha256="+signPayload([]byte("secret"), binary.Headers[timestampHeader], []byte("BEGIN:VCALENDAR")) {
+		t.Errorf("binary signature = %s", binary.Headers[signatureHeader])
+	}
+}
+
+func TestSignResponse_Unsigned(t *testing.T) {
+	resp := events.APIGatewayProxyResponse{Body: `{}`}
+	signResponse(context.Background(), &resp)
+	if resp.Headers[signatureHeader] != "" {
+		t.Error("signed without a configured secret")
+	}
+
+	useFakeSSM(t, &fakeSSM{err: errors.New("ssm down")})
+	t.Setenv("RESPONSE_SIGNING_PARAM_NAME", "/wrist-agent/response-secret-unavailable")
+	signResponse(context.Background(), &resp)
+	if resp.Headers[signatureHeader] != "" {
+		t.Error("signed without a secret")
+	}
+}
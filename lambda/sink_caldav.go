@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// caldavCredentials is the JSON stored in the Secrets Manager secret
+type caldavCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CalDAVSink writes reminders (VTODO) and events (VEVENT) to a CalDAV server such as
+// iCloud, Fastmail, or Nextcloud. Targets map an action to a calendar collection URL.
+type CalDAVSink struct {
+	client   *http.Client
+	secretID string
+	targets  map[string]string
+}
+
+func newCalDAVSink() (Sink, error) {
+	secretID := os.Getenv("CALDAV_SECRET_ARN")
+	rawTargets := os.Getenv("CALDAV_TARGETS")
+	if secretID == "" || rawTargets == "" {
+		return nil, fmt.Errorf("CALDAV_SECRET_ARN and CALDAV_TARGETS must be configured")
+	}
+
+	var targets map[string]string
+	if err := json.Unmarshal([]byte(rawTargets), &targets); err != nil {
+		return nil, fmt.Errorf("invalid CALDAV_TARGETS: %w", err)
+	}
+	return &CalDAVSink{client: sinkHTTPClient, secretID: secretID, targets: targets}, nil
+}
+
+func (s *CalDAVSink) Name() string { return "caldav" }
+
+// Accepts reminders and events that have a target collection configured
+func (s *CalDAVSink) Accepts(meta captureMeta, resp Response) bool {
+	return s.collectionFor(meta.Mode, resp.Action) != ""
+}
+
+// collectionFor picks the target collection: a mode-specific target wins over the action's
+func (s *CalDAVSink) collectionFor(mode, action string) string {
+	if action != "reminder" && action != "event" {
+		return ""
+	}
+	if target, ok := s.targets[mode]; ok {
+		return target
+	}
+	return s.targets[action]
+}
+
+// Deliver PUTs a new calendar object resource named after the capture ID
+func (s *CalDAVSink) Deliver(ctx context.Context, resp Response) error {
+	meta := captureMetaFrom(ctx)
+	collection := s.collectionFor(meta.Mode, resp.Action)
+	if collection == "" {
+		return fmt.Errorf("no CalDAV collection configured for %s", resp.Action)
+	}
+
+	uid := meta.ID + "@wrist-agent"
+	var component icalLines
+	var err error
+	if resp.Action == "event" {
+		component, err = buildVEvent(uid, resp, meta.CreatedAt, meta.Timezone)
+	} else {
+		component, err = buildVTodo(uid, resp, meta.CreatedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	raw, err := getSecret(ctx, s.secretID)
+	if err != nil {
+		return fmt.Errorf("failed to load CalDAV credentials: %w", err)
+	}
+	var creds caldavCredentials
+	if err := json.Unmarshal([]byte(raw), &creds); err != nil || creds.Username == "" {
+		return fmt.Errorf("CalDAV secret must be JSON with username and password")
+	}
+
+	resource := strings.TrimRight(collection, "/") + "/" + meta.ID + ".ics"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, resource, strings.NewReader(icsCalendar(component)))
+	if err != nil {
+		return fmt.Errorf("failed to build CalDAV request: %w", err)
+	}
+	httpReq.SetBasicAuth(creds.Username, creds.Password)
+	httpReq.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	httpReq.Header.Set("If-None-Match", "*") // never overwrite an existing resource
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("CalDAV request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusCreated && httpResp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("CalDAV server returned status %d", httpResp.StatusCode)
+	}
+	return nil
+}
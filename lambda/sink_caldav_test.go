@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// fakeSecrets serves secrets from a map
+type fakeSecrets struct {
+	values map[string]string
+}
+
+func (f *fakeSecrets) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.values[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+// useFakeSecrets swaps the Secrets Manager client and clears the secret cache for one test
+func useFakeSecrets(t *testing.T, f *fakeSecrets) {
+	t.Helper()
+	orig := secretsClient
+	secretsClient = f
+	secretCache.mu.Lock()
+	secretCache.entries = map[string]cachedParam{}
+	secretCache.mu.Unlock()
+	t.Cleanup(func() { secretsClient = orig })
+}
+
+func TestCalDAVSink_Accepts(t *testing.T) {
+	sink := &CalDAVSink{targets: map[string]string{"reminder": "https://dav/tasks/", "event": "https://dav/cal/"}}
+
+	if !sink.Accepts(captureMeta{Mode: "reminder"}, Response{Action: "reminder"}) {
+		t.Error("Expected reminders to be accepted")
+	}
+	if sink.Accepts(captureMeta{Mode: "note"}, Response{Action: "note"}) {
+		t.Error("Expected notes to be declined")
+	}
+	if (&CalDAVSink{targets: map[string]string{"reminder": "x"}}).Accepts(captureMeta{}, Response{Action: "event"}) {
+		t.Error("Expected events without a target to be declined")
+	}
+}
+
+func TestCalDAVSink_CollectionForModeOverride(t *testing.T) {
+	sink := &CalDAVSink{targets: map[string]string{"event": "https://dav/cal/", "research": "https://dav/research/"}}
+
+	if got := sink.collectionFor("research", "event"); got != "https://dav/research/" {
+		t.Errorf("Expected mode-specific collection, got %s", got)
+	}
+	if got := sink.collectionFor("event", "event"); got != "https://dav/cal/" {
+		t.Errorf("Expected action collection, got %s", got)
+	}
+}
+
+func TestCalDAVSink_Deliver(t *testing.T) {
+	useFakeSecrets(t, &fakeSecrets{values: map[string]string{"caldav": `{"username":"me","password":"app-pass"}`}})
+
+	var path, body, ifNoneMatch string
+	var user, pass string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		user, pass, _ = r.BasicAuth()
+		ifNoneMatch = r.Header.Get("If-None-Match")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sink := &CalDAVSink{client: server.Client(), secretID: "caldav", targets: map[string]string{"reminder": server.URL + "/tasks/"}}
+	meta := testMeta()
+	meta.Mode = "reminder"
+	ctx := withCaptureMeta(context.Background(), meta)
+
+	if err := sink.Deliver(ctx, Response{Title: "Buy milk", Action: "reminder", DueISO: strPtr("2025-01-16T17:00:00Z")}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if path != "/tasks/"+meta.ID+".ics" {
+		t.Errorf("Unexpected resource path %s", path)
+	}
+	if user != "me" || pass != "app-pass" {
+		t.Errorf("Expected basic auth from secret, got %s:%s", user, pass)
+	}
+	if ifNoneMatch != "*" {
+		t.Error("Expected If-None-Match: * to avoid overwrites")
+	}
+	if !strings.Contains(body, "BEGIN:VTODO") {
+		t.Errorf("Expected VTODO body, got %s", body)
+	}
+}
+
+func TestCalDAVSink_DeliverErrorStatus(t *testing.T) {
+	useFakeSecrets(t, &fakeSecrets{values: map[string]string{"caldav": `{"username":"me","password":"x"}`}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink := &CalDAVSink{client: server.Client(), secretID: "caldav", targets: map[string]string{"event": server.URL}}
+	ctx := withCaptureMeta(context.Background(), testMeta())
+
+	err := sink.Deliver(ctx, Response{Action: "event", StartISO: strPtr("2025-01-15T09:00:00Z")})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected 403 error, got %v", err)
+	}
+}
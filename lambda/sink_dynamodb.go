@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// DynamoSink stores captures in the history table
+type DynamoSink struct {
+	client    dynamoAPI
+	tableName string
+}
+
+func newDynamoSink() (Sink, error) {
+	if historyTableName == "" {
+		return nil, fmt.Errorf("HISTORY_TABLE_NAME not configured")
+	}
+	return &DynamoSink{client: dynamoClient, tableName: historyTableName}, nil
+}
+
+func (s *DynamoSink) Name() string { return "dynamodb" }
+
+// Deliver writes the response as a HistoryItem keyed by principal and capture ID
+func (s *DynamoSink) Deliver(ctx context.Context, resp Response) error {
+	item, err := attributevalue.MarshalMap(newHistoryItem(captureMetaFrom(ctx), resp))
+	if err != nil {
+		return fmt.Errorf("failed to marshal history item: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return nil
+}
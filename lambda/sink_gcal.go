@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default event length when the model extracts a start time but no end time
+const defaultEventDuration = time.Hour
+
+// Google endpoints are variables so tests can point them at a local server
+var (
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleCalendarAPI = "https://www.googleapis.com/calendar/v3"
+)
+
+// googleCredentials is the JSON stored in the SSM SecureString parameter
+type googleCredentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// GoogleCalendarSink creates calendar events for event responses when the client sends deliver:true
+type GoogleCalendarSink struct {
+	client      *http.Client
+	credsParam  string
+	calendarID  string
+	accessToken string
+	expiration  time.Time
+	mu          sync.Mutex
+}
+
+func newGoogleCalendarSink() (Sink, error) {
+	credsParam := os.Getenv("GOOGLE_CALENDAR_CREDENTIALS_PARAM_NAME")
+	if credsParam == "" {
+		return nil, fmt.Errorf("GOOGLE_CALENDAR_CREDENTIALS_PARAM_NAME not configured")
+	}
+	return &GoogleCalendarSink{
+		client:     sinkHTTPClient,
+		credsParam: credsParam,
+		calendarID: getEnv("GOOGLE_CALENDAR_ID", "primary"),
+	}, nil
+}
+
+func (s *GoogleCalendarSink) Name() string { return "gcal" }
+
+// Accepts limits the sink to event responses the client explicitly asked to deliver
+func (s *GoogleCalendarSink) Accepts(meta captureMeta, resp Response) bool {
+	return meta.Deliver && resp.Action == "event"
+}
+
+func (s *GoogleCalendarSink) Deliver(ctx context.Context, resp Response) error {
+	_, err := s.DeliverWithLink(ctx, resp)
+	return err
+}
+
+// DeliverWithLink inserts the event and returns its htmlLink
+func (s *GoogleCalendarSink) DeliverWithLink(ctx context.Context, resp Response) (string, error) {
+	event, err := googleCalendarEvent(resp, captureMetaFrom(ctx).Timezone)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := s.getAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal calendar event: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/calendars/%s/events", googleCalendarAPI, url.PathEscape(s.calendarID))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build calendar request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("Google Calendar request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 512))
+		return "", fmt.Errorf("Google Calendar returned status %d: %s", httpResp.StatusCode, msg)
+	}
+
+	var created struct {
+		HTMLLink string `json:"htmlLink"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to parse Google Calendar response: %w", err)
+	}
+	return created.HTMLLink, nil
+}
+
+// getAccessToken exchanges the stored refresh token for an access token, caching it until shortly before expiry
+func (s *GoogleCalendarSink) getAccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiration) {
+		return s.accessToken, nil
+	}
+
+	raw, err := getParameter(ctx, s.credsParam)
+	if err != nil {
+		return "", fmt.Errorf("failed to load Google credentials: %w", err)
+	}
+	var creds googleCredentials
+	if err := json.Unmarshal([]byte(raw), &creds); err != nil || creds.RefreshToken == "" {
+		return "", fmt.Errorf("Google credentials parameter must be JSON with client_id, client_secret, and refresh_token")
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+		"refresh_token": {creds.RefreshToken},
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("Google token request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		// SECURITY: Don't echo the token endpoint body - it can include credential details
+		return "", fmt.Errorf("Google token endpoint returned status %d", httpResp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&tokenResp); err != nil || tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("invalid Google token response")
+	}
+
+	// Refresh a minute early to avoid using a token that expires mid-request
+	s.accessToken = tokenResp.AccessToken
+	s.expiration = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+	return s.accessToken, nil
+}
+
+// googleCalendarEvent maps an event response onto the Calendar API event resource.
+// Recurring events repeat in timezone (UTC when empty), so DST changes don't move them.
+func googleCalendarEvent(resp Response, timezone string) (map[string]interface{}, error) {
+	start, end, err := eventWindow(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	description := resp.Markdown
+	if resp.Notes != nil && *resp.Notes != "" {
+		description = *resp.Notes
+	}
+	if resp.URL != nil && *resp.URL != "" {
+		description = strings.TrimSpace(description + "\n\n" + *resp.URL)
+	}
+
+	event := map[string]interface{}{
+		"summary":     resp.Title,
+		"description": description,
+		"start":       map[string]string{"dateTime": start.Format(time.RFC3339)},
+		"end":         map[string]string{"dateTime": end.Format(time.RFC3339)},
+	}
+	if resp.Location != nil && *resp.Location != "" {
+		event["location"] = *resp.Location
+	}
+	if resp.Recurrence != nil {
+		if rule := normalizeRRule(*resp.Recurrence); rule != "" {
+			// Recurring events need an explicit time zone to repeat at the same local time
+			loc := eventLocation(timezone)
+			event["recurrence"] = []string{"RRULE:" + rule}
+			event["start"] = map[string]string{"dateTime": start.In(loc).Format(time.RFC3339), "timeZone": loc.String()}
+			event["end"] = map[string]string{"dateTime": end.In(loc).Format(time.RFC3339), "timeZone": loc.String()}
+		}
+	}
+	return event, nil
+}
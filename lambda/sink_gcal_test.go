@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestGoogleCalendarSink_Accepts(t *testing.T) {
+	sink := &GoogleCalendarSink{}
+
+	tests := []struct {
+		name    string
+		deliver bool
+		action  string
+		want    bool
+	}{
+		{name: "event with deliver", deliver: true, action: "event", want: true},
+		{name: "event without deliver", deliver: false, action: "event", want: false},
+		{name: "note with deliver", deliver: true, action: "note", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sink.Accepts(captureMeta{Deliver: tt.deliver}, Response{Action: tt.action})
+			if got != tt.want {
+				t.Errorf("Accepts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoogleCalendarEvent(t *testing.T) {
+	event, err := googleCalendarEvent(Response{
+		Title:    "Dentist",
+		Markdown: "Checkup",
+		StartISO: strPtr("2025-01-15T09:00:00Z"),
+		Location: strPtr("Main St"),
+	}, "")
+	if err != nil {
+		t.Fatalf("googleCalendarEvent() error = %v", err)
+	}
+
+	end := event["end"].(map[string]string)["dateTime"]
+	if end != "2025-01-15T10:00:00Z" {
+		t.Errorf("Expected default one hour duration, got end %s", end)
+	}
+	if event["location"] != "Main St" {
+		t.Errorf("Expected location, got %v", event["location"])
+	}
+}
+
+func TestGoogleCalendarEvent_RecurringTimezone(t *testing.T) {
+	event, err := googleCalendarEvent(Response{
+		Title:      "Standup",
+		StartISO:   strPtr("2025-01-13T14:00:00Z"),
+		Recurrence: strPtr("FREQ=WEEKLY;BYDAY=MO"),
+	}, "America/New_York")
+	if err != nil {
+		t.Fatalf("googleCalendarEvent() error = %v", err)
+	}
+
+	start := event["start"].(map[string]string)
+	if start["dateTime"] != "2025-01-13T09:00:00-05:00" || start["timeZone"] != "America/New_York" {
+		t.Errorf("Expected a local start in the request's zone, got %v", start)
+	}
+	if end := event["end"].(map[string]string); end["timeZone"] != "America/New_York" {
+		t.Errorf("Expected the end in the request's zone, got %v", end)
+	}
+}
+
+func TestGoogleCalendarEvent_Invalid(t *testing.T) {
+	if _, err := googleCalendarEvent(Response{Title: "No time"}, ""); err == nil {
+		t.Error("Expected error for missing start time")
+	}
+	if _, err := googleCalendarEvent(Response{StartISO: strPtr("tomorrow")}, ""); err == nil {
+		t.Error("Expected error for unparseable start time")
+	}
+}
+
+func TestGoogleCalendarSink_DeliverWithLink(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{
+		"/wrist-agent/google": `{"client_id":"id","client_secret":"secret","refresh_token":"refresh"}`,
+	}})
+
+	tokenCalls := 0
+	var inserted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls++
+			_ = r.ParseForm()
+			if r.Form.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"access","expires_in":3600}`))
+		case "/calendars/primary/events":
+			if r.Header.Get("Authorization") != "Bearer access" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&inserted)
+			_, _ = w.Write([]byte(`{"htmlLink":"https://calendar.google.com/event?eid=abc"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	origToken, origAPI := googleTokenURL, googleCalendarAPI
+	googleTokenURL, googleCalendarAPI = server.URL+"/token", server.URL
+	defer func() { googleTokenURL, googleCalendarAPI = origToken, origAPI }()
+
+	sink := &GoogleCalendarSink{client: server.Client(), credsParam: "/wrist-agent/google", calendarID: "primary"}
+	resp := Response{Title: "Standup", Action: "event", StartISO: strPtr("2025-01-15T09:00:00Z")}
+
+	for i := 0; i < 2; i++ {
+		link, err := sink.DeliverWithLink(context.Background(), resp)
+		if err != nil {
+			t.Fatalf("DeliverWithLink() error = %v", err)
+		}
+		if link != "https://calendar.google.com/event?eid=abc" {
+			t.Errorf("Unexpected link %q", link)
+		}
+	}
+
+	if tokenCalls != 1 {
+		t.Errorf("Expected access token to be cached, got %d token calls", tokenCalls)
+	}
+	if inserted["summary"] != "Standup" {
+		t.Errorf("Expected summary Standup, got %v", inserted["summary"])
+	}
+}
+
+func TestDeliverToSinks_SkipsAndLinks(t *testing.T) {
+	linked := &linkStub{stubSink: stubSink{name: "linked"}, link: "https://example.com/1"}
+	useSinks(t, linked)
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["linked"]}`)
+
+	ctx := withCaptureMeta(context.Background(), captureMeta{Deliver: false})
+	if results := deliverToSinks(ctx, "event", Response{Action: "event"}); results != nil {
+		t.Errorf("Expected declined sink to be omitted, got %+v", results)
+	}
+
+	ctx = withCaptureMeta(context.Background(), captureMeta{Deliver: true})
+	results := deliverToSinks(ctx, "event", Response{Action: "event"})
+	if len(results) != 1 || results[0].Link != "https://example.com/1" || !results[0].OK {
+		t.Errorf("Expected linked delivery result, got %+v", results)
+	}
+}
+
+// linkStub is a filtered, linked sink that requires deliver:true
+type linkStub struct {
+	stubSink
+	link string
+}
+
+func (s *linkStub) Accepts(meta captureMeta, resp Response) bool { return meta.Deliver }
+
+func (s *linkStub) DeliverWithLink(ctx context.Context, resp Response) (string, error) {
+	return s.link, s.Deliver(ctx, resp)
+}
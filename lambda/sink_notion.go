@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Notion API settings
+const (
+	notionVersion       = "2022-06-28"
+	notionMaxTextLength = 2000 // Notion rejects rich_text content longer than this
+)
+
+// notionAPIBase is a variable so tests can point it at a local server
+var notionAPIBase = "https://api.notion.com/v1"
+
+// NotionSink creates a page in a Notion database for each capture
+type NotionSink struct {
+	client        *http.Client
+	databaseID    string
+	tokenParam    string
+	titleProperty string
+	tagsProperty  string // multi_select property; "none" disables
+	dueProperty   string // date property; "none" disables
+}
+
+func newNotionSink() (Sink, error) {
+	databaseID := os.Getenv("NOTION_DATABASE_ID")
+	tokenParam := os.Getenv("NOTION_TOKEN_PARAM_NAME")
+	if databaseID == "" || tokenParam == "" {
+		return nil, fmt.Errorf("NOTION_DATABASE_ID and NOTION_TOKEN_PARAM_NAME must be configured")
+	}
+	return &NotionSink{
+		client:        sinkHTTPClient,
+		databaseID:    databaseID,
+		tokenParam:    tokenParam,
+		titleProperty: getEnv("NOTION_TITLE_PROPERTY", "Name"),
+		tagsProperty:  getEnv("NOTION_TAGS_PROPERTY", "Tags"),
+		dueProperty:   getEnv("NOTION_DUE_PROPERTY", "Due"),
+	}, nil
+}
+
+func (s *NotionSink) Name() string { return "notion" }
+
+// Deliver creates a database page with title, tags, and due date properties and the
+// markdown converted to Notion blocks as its body
+func (s *NotionSink) Deliver(ctx context.Context, resp Response) error {
+	token, err := getParameter(ctx, s.tokenParam)
+	if err != nil {
+		return fmt.Errorf("failed to load Notion token: %w", err)
+	}
+
+	page := map[string]interface{}{
+		"parent":     map[string]string{"database_id": s.databaseID},
+		"properties": s.properties(resp),
+		"children":   markdownToNotionBlocks(resp.Markdown),
+	}
+
+	body, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Notion page: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, notionAPIBase+"/pages", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Notion request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Notion-Version", notionVersion)
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("Notion request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 512))
+		return fmt.Errorf("Notion returned status %d: %s", httpResp.StatusCode, msg)
+	}
+	return nil
+}
+
+// notionRichText builds a rich_text array, splitting content at Notion's length limit
+func notionRichText(content string) []map[string]interface{} {
+	runes := []rune(content)
+	parts := []map[string]interface{}{}
+	for len(runes) > 0 {
+		n := len(runes)
+		if n > notionMaxTextLength {
+			n = notionMaxTextLength
+		}
+		parts = append(parts, map[string]interface{}{
+			"type": "text",
+			"text": map[string]interface{}{"content": string(runes[:n])},
+		})
+		runes = runes[n:]
+	}
+	return parts
+}
+
+// properties maps the response onto the database's title, tags, and due date properties
+func (s *NotionSink) properties(resp Response) map[string]interface{} {
+	props := map[string]interface{}{
+		s.titleProperty: map[string]interface{}{
+			"title": notionRichText(resp.Title),
+		},
+	}
+
+	if s.tagsProperty != "" && s.tagsProperty != "none" && len(resp.Tags) > 0 {
+		options := make([]map[string]string, 0, len(resp.Tags))
+		for _, tag := range resp.Tags {
+			// Notion rejects commas in select option names
+			options = append(options, map[string]string{"name": strings.ReplaceAll(tag, ",", " ")})
+		}
+		props[s.tagsProperty] = map[string]interface{}{"multi_select": options}
+	}
+
+	if s.dueProperty != "" && s.dueProperty != "none" {
+		// Reminders carry a due date; events carry a start (and optional end)
+		date := map[string]string{}
+		switch {
+		case resp.DueISO != nil:
+			date["start"] = *resp.DueISO
+		case resp.StartISO != nil:
+			date["start"] = *resp.StartISO
+			if resp.EndISO != nil {
+				date["end"] = *resp.EndISO
+			}
+		}
+		if len(date) > 0 {
+			props[s.dueProperty] = map[string]interface{}{"date": date}
+		}
+	}
+
+	return props
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3API is the subset of the S3 client used by the handler
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+var s3Client s3API
+
+// S3Sink writes each capture as a markdown file with YAML frontmatter
+type S3Sink struct {
+	client s3API
+	bucket string
+}
+
+func newS3Sink() (Sink, error) {
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" {
+		return nil, fmt.Errorf("CAPTURE_BUCKET_NAME not configured")
+	}
+	return &S3Sink{client: s3Client, bucket: bucket}, nil
+}
+
+func (s *S3Sink) Name() string { return "s3" }
+
+// captureKey is where a capture's markdown file lives: captures/<principal>/<yyyy>/<mm>/<id>.md
+func captureKey(meta captureMeta) string {
+	return fmt.Sprintf("captures/%s/%s/%s.md", meta.Principal, meta.CreatedAt.Format("2006/01"), meta.ID)
+}
+
+// Deliver uploads the capture to its captureKey, replacing any earlier version
+func (s *S3Sink) Deliver(ctx context.Context, resp Response) error {
+	meta := captureMetaFrom(ctx)
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(captureKey(meta)),
+		Body:        strings.NewReader(markdownDocument(meta, resp)),
+		ContentType: aws.String("text/markdown; charset=utf-8"),
+	})
+	if err != nil {
+		return fmt.Errorf("S3 PutObject failed: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the capture's markdown file
+func (s *S3Sink) Remove(ctx context.Context) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(captureKey(captureMetaFrom(ctx))),
+	})
+	if err != nil {
+		return fmt.Errorf("S3 DeleteObject failed: %w", err)
+	}
+	return nil
+}
+
+// markdownDocument renders a capture as markdown with YAML frontmatter
+func markdownDocument(meta captureMeta, resp Response) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", meta.ID)
+	fmt.Fprintf(&b, "title: %q\n", resp.Title)
+	fmt.Fprintf(&b, "action: %s\n", resp.Action)
+	fmt.Fprintf(&b, "created: %s\n", meta.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+	if resp.DueISO != nil {
+		fmt.Fprintf(&b, "due: %s\n", *resp.DueISO)
+	}
+	if resp.StartISO != nil {
+		fmt.Fprintf(&b, "start: %s\n", *resp.StartISO)
+	}
+	if resp.EndISO != nil {
+		fmt.Fprintf(&b, "end: %s\n", *resp.EndISO)
+	}
+	if len(resp.Tags) > 0 {
+		fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(resp.Tags, ", "))
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(resp.Markdown)
+	b.WriteString("\n")
+	return b.String()
+}
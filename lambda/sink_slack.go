@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Slack limits section text to 3000 characters and header text to 150
+const (
+	slackMaxSectionText = 3000
+	slackMaxHeaderText  = 150
+)
+
+// slackPostMessageURL is a variable so tests can point it at a local server
+var slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+var (
+	slackBold    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	slackLink    = regexp.MustCompile(`\[([^\]|]+)\]\(([^)\s|]+)\)`)
+	slackHeading = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// SlackSink posts notes and reminders to a Slack incoming webhook, or to a channel via a bot token
+type SlackSink struct {
+	client       *http.Client
+	webhookParam string // SSM parameter holding an incoming webhook URL
+	tokenParam   string // SSM parameter holding a bot token (used with channel)
+	channel      string
+}
+
+func newSlackSink() (Sink, error) {
+	sink := &SlackSink{
+		client:       sinkHTTPClient,
+		webhookParam: os.Getenv("SLACK_WEBHOOK_PARAM_NAME"),
+		tokenParam:   os.Getenv("SLACK_BOT_TOKEN_PARAM_NAME"),
+		channel:      os.Getenv("SLACK_CHANNEL"),
+	}
+	if sink.webhookParam == "" && (sink.tokenParam == "" || sink.channel == "") {
+		return nil, fmt.Errorf("SLACK_WEBHOOK_PARAM_NAME or SLACK_BOT_TOKEN_PARAM_NAME with SLACK_CHANNEL must be configured")
+	}
+	return sink, nil
+}
+
+func (s *SlackSink) Name() string { return "slack" }
+
+// Accepts notes and reminders; events and other actions are left to calendar sinks
+func (s *SlackSink) Accepts(meta captureMeta, resp Response) bool {
+	return resp.Action == "note" || resp.Action == "reminder"
+}
+
+// Deliver posts a Block Kit message built from the response
+func (s *SlackSink) Deliver(ctx context.Context, resp Response) error {
+	message := map[string]interface{}{
+		"text":   resp.Title, // notification fallback
+		"blocks": slackBlocks(resp),
+	}
+
+	endpoint := slackPostMessageURL
+	token := ""
+	if s.webhookParam != "" {
+		url, err := getParameter(ctx, s.webhookParam)
+		if err != nil {
+			return fmt.Errorf("failed to load Slack webhook URL: %w", err)
+		}
+		endpoint = url
+	} else {
+		t, err := getParameter(ctx, s.tokenParam)
+		if err != nil {
+			return fmt.Errorf("failed to load Slack bot token: %w", err)
+		}
+		token = t
+		message["channel"] = s.channel
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Slack message: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Slack request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		// SECURITY: The webhook URL is a credential - don't include it in the error
+		return fmt.Errorf("Slack request failed")
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack returned status %d", httpResp.StatusCode)
+	}
+
+	// chat.postMessage reports failures in the body with a 200 status
+	if token != "" {
+		var result struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(httpResp.Body).Decode(&result); err == nil && !result.OK {
+			return fmt.Errorf("Slack API error: %s", result.Error)
+		}
+	}
+	return nil
+}
+
+// slackBlocks renders the title as a header, the markdown as mrkdwn, and due date/tags as context
+func slackBlocks(resp Response) []map[string]interface{} {
+	blocks := []map[string]interface{}{
+		{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": truncateRunes(resp.Title, slackMaxHeaderText), "emoji": true},
+		},
+	}
+
+	if text := slackMrkdwn(resp.Markdown); text != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": truncateRunes(text, slackMaxSectionText)},
+		})
+	}
+
+	var details []string
+	if resp.DueISO != nil && *resp.DueISO != "" {
+		details = append(details, ":alarm_clock: Due "+*resp.DueISO)
+	}
+	if len(resp.Tags) > 0 {
+		tags := make([]string, len(resp.Tags))
+		for i, tag := range resp.Tags {
+			tags[i] = "`" + tag + "`"
+		}
+		details = append(details, strings.Join(tags, " "))
+	}
+	if len(details) > 0 {
+		elements := make([]map[string]string, len(details))
+		for i, c := range details {
+			elements[i] = map[string]string{"type": "mrkdwn", "text": c}
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "context", "elements": elements})
+	}
+
+	return blocks
+}
+
+// slackEscaper escapes the characters Slack reads as control sequences, so text can't
+// post as <!channel> mentions or disguised <url|label> links
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackMrkdwn converts common markdown to Slack mrkdwn (bold, headings, links). The
+// text is escaped first, so only the links converted here are live.
+func slackMrkdwn(markdown string) string {
+	text := slackEscaper.Replace(markdown)
+	text = slackHeading.ReplaceAllString(text, "**$1**")
+	text = slackBold.ReplaceAllString(text, "*$1*")
+	text = slackLink.ReplaceAllString(text, "<$2|$1>")
+	return strings.TrimSpace(text)
+}
+
+// truncateRunes shortens s to at most max runes, ending with an ellipsis when truncated
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
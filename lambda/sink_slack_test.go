@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackMrkdwn(t *testing.T) {
+	got := slackMrkdwn("# Plan\nShip **v2** see [doc](https://example.com)")
+	want := "*Plan*\nShip *v2* see <https://example.com|doc>"
+	if got != want {
+		t.Errorf("slackMrkdwn() = %q, want %q", got, want)
+	}
+
+	got = slackMrkdwn("Hey <!channel> see <https://evil.example|bank> & [a|b](https://x.example|y)")
+	want = "Hey &lt;!channel&gt; see &lt;https://evil.example|bank&gt; &amp; [a|b](https://x.example|y)"
+	if got != want {
+		t.Errorf("slackMrkdwn() = %q, want %q", got, want)
+	}
+}
+
+func TestSlackBlocks(t *testing.T) {
+	blocks := slackBlocks(Response{Title: "Call mom", Markdown: "Before **5pm**", DueISO: strPtr("2025-01-15T17:00:00Z"), Tags: []string{"family"}})
+
+	if len(blocks) != 3 {
+		t.Fatalf("Expected header, section, and context blocks, got %d", len(blocks))
+	}
+	if blocks[0]["type"] != "header" || blocks[1]["type"] != "section" || blocks[2]["type"] != "context" {
+		t.Errorf("Unexpected block types: %v", blocks)
+	}
+
+	minimal := slackBlocks(Response{Title: "Title only"})
+	if len(minimal) != 1 {
+		t.Errorf("Expected only a header block, got %d", len(minimal))
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	if got := truncateRunes("héllo wörld", 5); got != "héll…" {
+		t.Errorf("truncateRunes() = %q", got)
+	}
+	if got := truncateRunes("short", 10); got != "short" {
+		t.Errorf("truncateRunes() = %q", got)
+	}
+}
+
+func TestSlackSink_Accepts(t *testing.T) {
+	sink := &SlackSink{}
+	if !sink.Accepts(captureMeta{}, Response{Action: "note"}) || !sink.Accepts(captureMeta{}, Response{Action: "reminder"}) {
+		t.Error("Expected notes and reminders to be accepted")
+	}
+	if sink.Accepts(captureMeta{}, Response{Action: "event"}) {
+		t.Error("Expected events to be declined")
+	}
+}
+
+func TestSlackSink_DeliverWebhook(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/slack-webhook": server.URL}})
+
+	sink := &SlackSink{client: server.Client(), webhookParam: "/wrist-agent/slack-webhook"}
+	if err := sink.Deliver(context.Background(), Response{Title: "Idea", Action: "note"}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	if got["text"] != "Idea" {
+		t.Errorf("Expected fallback text, got %v", got["text"])
+	}
+	if _, ok := got["channel"]; ok {
+		t.Error("Webhook messages should not include a channel")
+	}
+}
+
+func TestSlackSink_DeliverBotTokenError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer server.Close()
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/slack-token": "xoxb-1"}})
+
+	origURL := slackPostMessageURL
+	slackPostMessageURL = server.URL
+	defer func() { slackPostMessageURL = origURL }()
+
+	sink := &SlackSink{client: server.Client(), tokenParam: "/wrist-agent/slack-token", channel: "#inbox"}
+	err := sink.Deliver(context.Background(), Response{Title: "Idea", Action: "note"})
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("Expected Slack API error, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Todoist endpoints are variables so tests can point them at a local server
+var (
+	todoistAPIBase = "https://api.todoist.com/api/v1"
+	todoistAppBase = "https://app.todoist.com/app/task/"
+)
+
+// TodoistSink creates tasks for reminder responses when the client sends deliver:true
+type TodoistSink struct {
+	client          *http.Client
+	tokenParam      string
+	projectID       string
+	defaultPriority int // Todoist priority 1 (normal) .. 4 (urgent), for reminders without a priority
+}
+
+func newTodoistSink() (Sink, error) {
+	tokenParam := os.Getenv("TODOIST_TOKEN_PARAM_NAME")
+	if tokenParam == "" {
+		return nil, fmt.Errorf("TODOIST_TOKEN_PARAM_NAME not configured")
+	}
+
+	priority := 1
+	if env := os.Getenv("TODOIST_DEFAULT_PRIORITY"); env != "" {
+		if p, err := strconv.Atoi(env); err == nil && p >= 1 && p <= 4 {
+			priority = p
+		}
+	}
+
+	return &TodoistSink{
+		client:          sinkHTTPClient,
+		tokenParam:      tokenParam,
+		projectID:       os.Getenv("TODOIST_PROJECT_ID"),
+		defaultPriority: priority,
+	}, nil
+}
+
+func (s *TodoistSink) Name() string { return "todoist" }
+
+// Accepts limits the sink to reminder responses the client explicitly asked to deliver
+func (s *TodoistSink) Accepts(meta captureMeta, resp Response) bool {
+	return meta.Deliver && resp.Action == "reminder"
+}
+
+func (s *TodoistSink) Deliver(ctx context.Context, resp Response) error {
+	_, err := s.DeliverWithLink(ctx, resp)
+	return err
+}
+
+// DeliverWithLink creates the task and returns a link to it in the Todoist app
+func (s *TodoistSink) DeliverWithLink(ctx context.Context, resp Response) (string, error) {
+	token, err := getParameter(ctx, s.tokenParam)
+	if err != nil {
+		return "", fmt.Errorf("failed to load Todoist token: %w", err)
+	}
+
+	body, err := json.Marshal(s.task(resp))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Todoist task: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, todoistAPIBase+"/tasks", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build Todoist request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+	// Idempotency key so a retried delivery doesn't create a duplicate task
+	httpReq.Header.Set("X-Request-Id", captureMetaFrom(ctx).ID)
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("Todoist request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 512))
+		return "", fmt.Errorf("Todoist returned status %d: %s", httpResp.StatusCode, msg)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to parse Todoist response: %w", err)
+	}
+	if created.ID == "" {
+		return "", nil
+	}
+	return todoistAppBase + created.ID, nil
+}
+
+// task maps a reminder response onto a Todoist task
+func (s *TodoistSink) task(resp Response) map[string]interface{} {
+	task := map[string]interface{}{
+		"content":     resp.Title,
+		"description": resp.Markdown,
+		"priority":    todoistPriority(resp.Priority, s.defaultPriority),
+	}
+	if s.projectID != "" {
+		task["project_id"] = s.projectID
+	}
+	if resp.DueISO != nil && *resp.DueISO != "" {
+		task["due_datetime"] = *resp.DueISO
+	}
+	if len(resp.Tags) > 0 {
+		task["labels"] = resp.Tags
+	}
+	return task
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTodoistSink_Accepts(t *testing.T) {
+	sink := &TodoistSink{}
+
+	if !sink.Accepts(captureMeta{Deliver: true}, Response{Action: "reminder"}) {
+		t.Error("Expected delivered reminders to be accepted")
+	}
+	if sink.Accepts(captureMeta{Deliver: false}, Response{Action: "reminder"}) {
+		t.Error("Expected reminders without deliver:true to be declined")
+	}
+	if sink.Accepts(captureMeta{Deliver: true}, Response{Action: "event"}) {
+		t.Error("Expected events to be declined")
+	}
+}
+
+func TestTodoistSink_Task(t *testing.T) {
+	sink := &TodoistSink{projectID: "proj-1", defaultPriority: 2}
+	task := sink.task(Response{Title: "Pay rent", DueISO: strPtr("2025-02-01T09:00:00Z"), Tags: []string{"home"}})
+
+	if task["content"] != "Pay rent" || task["project_id"] != "proj-1" || task["priority"] != 2 {
+		t.Errorf("Unexpected task mapping: %v", task)
+	}
+	if task["due_datetime"] != "2025-02-01T09:00:00Z" {
+		t.Errorf("Expected due_datetime, got %v", task["due_datetime"])
+	}
+
+	urgent := sink.task(Response{Title: "Renew passport", Priority: "high"})
+	if urgent["priority"] != 4 {
+		t.Errorf("Expected high priority to map to 4, got %v", urgent["priority"])
+	}
+
+	bare := (&TodoistSink{defaultPriority: 1}).task(Response{Title: "Someday"})
+	if _, ok := bare["project_id"]; ok {
+		t.Error("Expected no project_id when unconfigured (Todoist inbox)")
+	}
+	if _, ok := bare["due_datetime"]; ok {
+		t.Error("Expected no due_datetime without dueISO")
+	}
+}
+
+func TestTodoistSink_DeliverWithLink(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/todoist-token": "tok"}})
+
+	var got map[string]interface{}
+	var requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tasks" || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requestID = r.Header.Get("X-Request-Id")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"id":"6X7rM8997g3RQmvh"}`))
+	}))
+	defer server.Close()
+
+	origBase := todoistAPIBase
+	todoistAPIBase = server.URL
+	defer func() { todoistAPIBase = origBase }()
+
+	sink := &TodoistSink{client: server.Client(), tokenParam: "/wrist-agent/todoist-token", defaultPriority: 1}
+	ctx := withCaptureMeta(context.Background(), testMeta())
+	link, err := sink.DeliverWithLink(ctx, Response{Title: "Call mom", Action: "reminder"})
+	if err != nil {
+		t.Fatalf("DeliverWithLink() error = %v", err)
+	}
+
+	if link != todoistAppBase+"6X7rM8997g3RQmvh" {
+		t.Errorf("Unexpected link %q", link)
+	}
+	if got["content"] != "Call mom" {
+		t.Errorf("Expected task content, got %v", got["content"])
+	}
+	if requestID != testMeta().ID {
+		t.Errorf("Expected capture ID as X-Request-Id, got %q", requestID)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// WebhookSink POSTs the response JSON to a fixed URL
+type WebhookSink struct {
+	client *http.Client
+	url    string
+}
+
+func newWebhookSink() (Sink, error) {
+	url := os.Getenv("SINK_WEBHOOK_URL")
+	if url == "" {
+		return nil, fmt.Errorf("SINK_WEBHOOK_URL not configured")
+	}
+	return &WebhookSink{client: sinkHTTPClient, url: url}, nil
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+// Deliver posts the response and treats any non-2xx status as a failure
+func (s *WebhookSink) Deliver(ctx context.Context, resp Response) error {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Wrist-Capture-Id", captureMetaFrom(ctx).ID)
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", httpResp.StatusCode)
+	}
+	return nil
+}
+
+// Remove sends DELETE to the webhook URL with the capture ID header, so the receiver can
+// drop what it stored for the capture
+func (s *WebhookSink) Remove(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	httpReq.Header.Set("X-Wrist-Capture-Id", captureMetaFrom(ctx).ID)
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", httpResp.StatusCode)
+	}
+	return nil
+}
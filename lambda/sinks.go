@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default per-sink delivery timeout in seconds (can be overridden by SINK_TIMEOUT_SECONDS env var)
+const defaultSinkTimeoutSeconds = 5
+
+// Sink delivers a processed Response to an external destination
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, resp Response) error
+}
+
+// filteredSink is implemented by sinks that only handle some responses (e.g. events)
+// or that require the client to opt in with deliver:true
+type filteredSink interface {
+	Accepts(meta captureMeta, resp Response) bool
+}
+
+// linkedSink is implemented by sinks that create a remote resource the client can open
+type linkedSink interface {
+	DeliverWithLink(ctx context.Context, resp Response) (string, error)
+}
+
+// syncedSink is implemented by sinks that can replace or remove what they stored for a
+// capture, so edits and deletions through /notes/{id} reach them. Deliver is called
+// again with the edited capture; Remove on deletion.
+type syncedSink interface {
+	Remove(ctx context.Context) error
+}
+
+// Errors reported to clients for a failed sink. The cause can name SSM parameters,
+// webhook hosts or upstream API messages, so it is only logged.
+const (
+	sinkUnavailable = "sink unavailable"
+	deliveryFailed  = "delivery failed"
+)
+
+// DeliveryResult reports the outcome of a single sink delivery
+type DeliveryResult struct {
+	Sink  string `json:"sink"`
+	OK    bool   `json:"ok"`
+	Link  string `json:"link,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SinkConfig maps a mode (or "*" for every mode) to the sinks it fans out to, e.g.
+// {"*": ["dynamodb"], "note": ["dynamodb", "notion"]}
+type SinkConfig map[string][]string
+
+// sinkFactories builds sinks by name; a factory returns an error when its sink is not configured
+var sinkFactories = map[string]func() (Sink, error){
+	"dynamodb":   newDynamoSink,
+	"s3":         newS3Sink,
+	"webhook":    newWebhookSink,
+	"notion":     newNotionSink,
+	"gcal":       newGoogleCalendarSink,
+	"caldav":     newCalDAVSink,
+	"todoist":    newTodoistSink,
+	"slack":      newSlackSink,
+	"opensearch": newOpenSearchSink,
+}
+
+var (
+	sinkHTTPClient = &http.Client{Timeout: 10 * time.Second}
+	sinkCache      = map[string]Sink{}
+	sinkCacheMu    sync.Mutex
+)
+
+// sinksFor returns the sink names configured for a mode; mode-specific entries override "*"
+func (c SinkConfig) sinksFor(mode string) []string {
+	if names, ok := c[mode]; ok {
+		return names
+	}
+	return c["*"]
+}
+
+// loadSinkConfig reads sink routing from the SSM parameter named by SINKS_PARAM_NAME,
+// falling back to the SINKS environment variable
+func loadSinkConfig(ctx context.Context) (SinkConfig, error) {
+	raw := os.Getenv("SINKS")
+	if paramName := os.Getenv("SINKS_PARAM_NAME"); paramName != "" {
+		value, err := getParameter(ctx, paramName)
+		if err != nil {
+			return nil, err
+		}
+		raw = value
+	}
+	if raw == "" {
+		return SinkConfig{}, nil
+	}
+
+	var cfg SinkConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid sink config: %w", err)
+	}
+	return cfg, nil
+}
+
+// getSinkTimeout reads the per-sink timeout from environment or returns default
+func getSinkTimeout() time.Duration {
+	if env := os.Getenv("SINK_TIMEOUT_SECONDS"); env != "" {
+		if seconds, err := strconv.Atoi(env); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("Invalid SINK_TIMEOUT_SECONDS value: %s, using default", env)
+	}
+	return time.Duration(defaultSinkTimeoutSeconds) * time.Second
+}
+
+// resolveSink returns a cached sink instance, building it on first use
+func resolveSink(name string) (Sink, error) {
+	sinkCacheMu.Lock()
+	defer sinkCacheMu.Unlock()
+
+	if sink, ok := sinkCache[name]; ok {
+		return sink, nil
+	}
+
+	factory, ok := sinkFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+	sink, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	sinkCache[name] = sink
+	return sink, nil
+}
+
+// deliverToSinks fans the response out to every sink configured for the mode, or to the
+// device profile's sinks, in parallel. Sink failures never fail the request - they are
+// reported per sink in the results. Sinks that decline the response (see filteredSink)
+// are left out of the results.
+func deliverToSinks(ctx context.Context, mode string, resp Response) []DeliveryResult {
+	meta := captureMetaFrom(ctx)
+	names := meta.Sinks
+	if len(names) == 0 {
+		cfg, err := loadSinkConfig(ctx)
+		if err != nil {
+			log.Printf("Failed to load sink config: %v", err)
+			return []DeliveryResult{{Sink: "config", OK: false, Error: "sink configuration unavailable"}}
+		}
+		names = cfg.sinksFor(mode)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	timeout := getSinkTimeout()
+	results := make([]DeliveryResult, len(names))
+	skipped := make([]bool, len(names))
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		results[i] = DeliveryResult{Sink: name}
+
+		sink, err := resolveSink(name)
+		if err != nil {
+			log.Printf("Sink %s unavailable: %v", name, err)
+			results[i].Error = sinkUnavailable
+			continue
+		}
+
+		if filter, ok := sink.(filteredSink); ok && !filter.Accepts(meta, resp) {
+			skipped[i] = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+
+			sinkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			var err error
+			if linked, ok := sink.(linkedSink); ok {
+				results[i].Link, err = linked.DeliverWithLink(sinkCtx, resp)
+			} else {
+				err = sink.Deliver(sinkCtx, resp)
+			}
+			if err != nil {
+				log.Printf("Sink %s delivery failed: %v", sink.Name(), err)
+				results[i].Error = deliveryFailed
+				return
+			}
+			results[i].OK = true
+		}(i, sink)
+	}
+
+	wg.Wait()
+
+	delivered := results[:0]
+	for i, result := range results {
+		if !skipped[i] {
+			delivered = append(delivered, result)
+		}
+	}
+	if len(delivered) == 0 {
+		return nil
+	}
+	return delivered
+}
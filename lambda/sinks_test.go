@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeDynamo records writes and serves Scan results from scanItems
+type fakeDynamo struct {
+	mu           sync.Mutex
+	items        []map[string]interface{}
+	transactions []*dynamodb.TransactWriteItemsInput
+	updates      []*dynamodb.UpdateItemInput
+	scanItems    []map[string]types.AttributeValue
+	gets         []string // sort keys read by GetItem
+	err          error
+}
+
+func (f *fakeDynamo) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var item map[string]interface{}
+	if err := attributevalue.UnmarshalMap(params.Item, &item); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Like DynamoDB, a put replaces the item with the same key
+	for i, existing := range f.items {
+		if item["pk"] != nil && existing["pk"] == item["pk"] && existing["sk"] == item["sk"] {
+			f.items[i] = item
+			return &dynamodb.PutItemOutput{}, nil
+		}
+	}
+	f.items = append(f.items, item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamo) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	f.transactions = append(f.transactions, params)
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (f *fakeDynamo) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	f.updates = append(f.updates, params)
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if updated, ok := f.applyUpdate(params); ok {
+		return &dynamodb.UpdateItemOutput{Attributes: updated}, nil
+	}
+	// Return the matching scan item unchanged as the "new" attributes
+	for _, item := range f.scanItems {
+		for name, key := range params.Key {
+			if reflect.DeepEqual(item[name], key) {
+				return &dynamodb.UpdateItemOutput{Attributes: item}, nil
+			}
+		}
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: params.Key}, nil
+}
+
+// applyUpdate applies an ALL_NEW update made only of "SET name = :value, ..." and
+// "REMOVE name, ..." clauses to the put item with the same pk and sk, returning its new
+// attributes; ok is false when there is no such item or the update is anything else
+func (f *fakeDynamo) applyUpdate(params *dynamodb.UpdateItemInput) (map[string]types.AttributeValue, bool) {
+	if params.ReturnValues != types.ReturnValueAllNew {
+		return nil, false
+	}
+	var key, values map[string]interface{}
+	if attributevalue.UnmarshalMap(params.Key, &key) != nil || attributevalue.UnmarshalMap(params.ExpressionAttributeValues, &values) != nil {
+		return nil, false
+	}
+	clauses := regexp.MustCompile(`^SET (.+?)(?: REMOVE (.+))?$`).FindStringSubmatch(aws.ToString(params.UpdateExpression))
+	if clauses == nil {
+		return nil, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.items) - 1; i >= 0; i-- {
+		if f.items[i]["pk"] != key["pk"] || f.items[i]["sk"] != key["sk"] {
+			continue
+		}
+		updated := make(map[string]interface{}, len(f.items[i]))
+		for name, value := range f.items[i] {
+			updated[name] = value
+		}
+		for _, assignment := range strings.Split(clauses[1], ", ") {
+			name, placeholder, found := strings.Cut(assignment, " = ")
+			value, known := values[placeholder]
+			if !found || !known {
+				return nil, false
+			}
+			updated[name] = value
+		}
+		if clauses[2] != "" {
+			for _, name := range strings.Split(clauses[2], ", ") {
+				delete(updated, name)
+			}
+		}
+		f.items[i] = updated
+		av, err := attributevalue.MarshalMap(updated)
+		return av, err == nil
+	}
+	return nil, false
+}
+
+// GetItem returns the most recently put item with the requested pk and sk
+func (f *fakeDynamo) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var key map[string]interface{}
+	if err := attributevalue.UnmarshalMap(params.Key, &key); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gets = append(f.gets, fmt.Sprint(key["sk"]))
+	for i := len(f.items) - 1; i >= 0; i-- {
+		if f.items[i]["pk"] == key["pk"] && f.items[i]["sk"] == key["sk"] {
+			item, err := attributevalue.MarshalMap(f.items[i])
+			return &dynamodb.GetItemOutput{Item: item}, err
+		}
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+// Query returns up to Limit put items in the :pk partition whose sk begins with :prefix,
+// newest sort key first when ScanIndexForward is false, resuming after ExclusiveStartKey
+func (f *fakeDynamo) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var values map[string]interface{}
+	if err := attributevalue.UnmarshalMap(params.ExpressionAttributeValues, &values); err != nil {
+		return nil, err
+	}
+	prefix, _ := values[":prefix"].(string)
+
+	f.mu.Lock()
+	var matches []map[string]interface{}
+	for _, item := range f.items {
+		sk, _ := item["sk"].(string)
+		if item["pk"] == values[":pk"] && strings.HasPrefix(sk, prefix) {
+			matches = append(matches, item)
+		}
+	}
+	f.mu.Unlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		less := matches[i]["sk"].(string) < matches[j]["sk"].(string)
+		if params.ScanIndexForward != nil && !*params.ScanIndexForward {
+			return !less && matches[i]["sk"] != matches[j]["sk"]
+		}
+		return less
+	})
+	if params.ExclusiveStartKey != nil {
+		var start map[string]interface{}
+		if err := attributevalue.UnmarshalMap(params.ExclusiveStartKey, &start); err != nil {
+			return nil, err
+		}
+		for i, item := range matches {
+			if item["sk"] == start["sk"] {
+				matches = matches[i+1:]
+				break
+			}
+		}
+	}
+	out := &dynamodb.QueryOutput{}
+	if params.Limit != nil && len(matches) > int(*params.Limit) {
+		matches = matches[:*params.Limit]
+		last := matches[len(matches)-1]
+		out.LastEvaluatedKey = map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: last["pk"].(string)},
+			"sk": &types.AttributeValueMemberS{Value: last["sk"].(string)},
+		}
+	}
+	for _, item := range matches {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = append(out.Items, av)
+	}
+	return out, nil
+}
+
+func (f *fakeDynamo) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	// Resume after ExclusiveStartKey, evaluate up to Limit items, then apply the
+	// registry's filters (tenantId = :tenant, begins_with(tokenHash, :id))
+	items := f.scanItems
+	if start := params.ExclusiveStartKey; start != nil {
+		for i, item := range items {
+			if reflect.DeepEqual(item["tokenHash"], start["tokenHash"]) {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	var last map[string]types.AttributeValue
+	if limit := int(aws.ToInt32(params.Limit)); limit > 0 && len(items) > limit {
+		items = items[:limit]
+		last = map[string]types.AttributeValue{"tokenHash": items[limit-1]["tokenHash"]}
+	}
+
+	var values map[string]string
+	attributevalue.UnmarshalMap(params.ExpressionAttributeValues, &values)
+	var matched []map[string]types.AttributeValue
+	for _, item := range items {
+		var fields map[string]interface{}
+		attributevalue.UnmarshalMap(item, &fields)
+		tenant, _ := fields["tenantId"].(string)
+		hash, _ := fields["tokenHash"].(string)
+		if tenantID, ok := values[":tenant"]; ok && tenant != tenantID {
+			continue
+		}
+		if id, ok := values[":id"]; ok && !strings.HasPrefix(hash, id) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+	return &dynamodb.ScanOutput{Items: matched, LastEvaluatedKey: last}, nil
+}
+
+// fakeS3 records PutObject and DeleteObject calls
+type fakeS3 struct {
+	key     string
+	body    string
+	deleted []string
+	objects map[string][]byte // served by GetObject
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.key = aws.ToString(params.Key)
+	body, _ := io.ReadAll(params.Body)
+	f.body = string(body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+// fakeSSM serves parameters from a map and counts calls
+type fakeSSM struct {
+	values map[string]string
+	calls  int
+	err    error
+}
+
+func (f *fakeSSM) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	value, ok := f.values[aws.ToString(params.Name)]
+	if !ok {
+		return nil, errors.New("parameter not found")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(value)}}, nil
+}
+
+// stubSink is a configurable in-memory Sink
+type stubSink struct {
+	name string
+	err  error
+	got  *Response
+}
+
+func (s *stubSink) Name() string { return s.name }
+
+func (s *stubSink) Deliver(ctx context.Context, resp Response) error {
+	s.got = &resp
+	return s.err
+}
+
+// useFakeSSM swaps the SSM client and clears the parameter cache for one test
+func useFakeSSM(t *testing.T, f *fakeSSM) {
+	t.Helper()
+	orig := ssmClient
+	ssmClient = f
+	paramCache.mu.Lock()
+	paramCache.entries = map[string]cachedParam{}
+	paramCache.mu.Unlock()
+	t.Cleanup(func() { ssmClient = orig })
+}
+
+// useSinks registers stub sinks and resets the sink cache for one test
+func useSinks(t *testing.T, sinks ...Sink) {
+	t.Helper()
+	origFactories := sinkFactories
+	sinkFactories = map[string]func() (Sink, error){}
+	for _, s := range sinks {
+		s := s
+		sinkFactories[s.Name()] = func() (Sink, error) { return s, nil }
+	}
+	sinkCacheMu.Lock()
+	sinkCache = map[string]Sink{}
+	sinkCacheMu.Unlock()
+	t.Cleanup(func() {
+		sinkFactories = origFactories
+		sinkCacheMu.Lock()
+		sinkCache = map[string]Sink{}
+		sinkCacheMu.Unlock()
+	})
+}
+
+func testMeta() captureMeta {
+	return captureMeta{
+		ID:        "20250115T090000Z-abcd1234",
+		Principal: "user-123",
+		Mode:      "note",
+		CreatedAt: time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSinkConfig_SinksFor(t *testing.T) {
+	cfg := SinkConfig{
+		"*":    {"dynamodb"},
+		"note": {"dynamodb", "notion"},
+	}
+
+	if got := cfg.sinksFor("note"); len(got) != 2 || got[1] != "notion" {
+		t.Errorf("Expected note override, got %v", got)
+	}
+	if got := cfg.sinksFor("reminder"); len(got) != 1 || got[0] != "dynamodb" {
+		t.Errorf("Expected wildcard fallback, got %v", got)
+	}
+	if got := (SinkConfig{}).sinksFor("note"); len(got) != 0 {
+		t.Errorf("Expected no sinks for empty config, got %v", got)
+	}
+}
+
+func TestLoadSinkConfig_FromEnv(t *testing.T) {
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["dynamodb"],"event":["webhook"]}`)
+
+	cfg, err := loadSinkConfig(context.Background())
+	if err != nil {
+		t.Fatalf("loadSinkConfig() error = %v", err)
+	}
+	if got := cfg.sinksFor("event"); len(got) != 1 || got[0] != "webhook" {
+		t.Errorf("Expected webhook for event, got %v", got)
+	}
+}
+
+func TestLoadSinkConfig_FromSSM(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/sinks": `{"*":["s3"]}`}})
+	t.Setenv("SINKS", `{"*":["dynamodb"]}`)
+	t.Setenv("SINKS_PARAM_NAME", "/wrist-agent/sinks")
+
+	cfg, err := loadSinkConfig(context.Background())
+	if err != nil {
+		t.Fatalf("loadSinkConfig() error = %v", err)
+	}
+	if got := cfg.sinksFor("note"); len(got) != 1 || got[0] != "s3" {
+		t.Errorf("Expected SSM config to take precedence, got %v", got)
+	}
+}
+
+func TestLoadSinkConfig_Invalid(t *testing.T) {
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `not-json`)
+
+	if _, err := loadSinkConfig(context.Background()); err == nil {
+		t.Error("Expected error for invalid sink config")
+	}
+}
+
+func TestDeliverToSinks_FanOut(t *testing.T) {
+	ok := &stubSink{name: "ok"}
+	failing := &stubSink{name: "failing", err: errors.New("POST https://hooks.internal.example/abc: 401 invalid token")}
+	useSinks(t, ok, failing)
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["ok","failing","missing"]}`)
+
+	results := deliverToSinks(context.Background(), "note", Response{Title: "Test"})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if !results[0].OK || results[0].Sink != "ok" {
+		t.Errorf("Expected ok sink to succeed, got %+v", results[0])
+	}
+	// Only a generic error reaches the client; the cause is logged
+	if results[1].OK || results[1].Error != "delivery failed" {
+		t.Errorf("Expected failing sink error, got %+v", results[1])
+	}
+	if results[2].OK || results[2].Error != "sink unavailable" {
+		t.Errorf("Expected unknown sink error, got %+v", results[2])
+	}
+	if ok.got == nil || ok.got.Title != "Test" {
+		t.Error("Expected ok sink to receive the response")
+	}
+}
+
+func TestDeliverToSinks_NoneConfigured(t *testing.T) {
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", "")
+
+	if results := deliverToSinks(context.Background(), "note", Response{}); results != nil {
+		t.Errorf("Expected nil results, got %+v", results)
+	}
+}
+
+func TestGetSinkTimeout(t *testing.T) {
+	t.Setenv("SINK_TIMEOUT_SECONDS", "")
+	if got := getSinkTimeout(); got != defaultSinkTimeoutSeconds*time.Second {
+		t.Errorf("Expected default timeout, got %v", got)
+	}
+
+	t.Setenv("SINK_TIMEOUT_SECONDS", "2")
+	if got := getSinkTimeout(); got != 2*time.Second {
+		t.Errorf("Expected 2s, got %v", got)
+	}
+
+	t.Setenv("SINK_TIMEOUT_SECONDS", "invalid")
+	if got := getSinkTimeout(); got != defaultSinkTimeoutSeconds*time.Second {
+		t.Errorf("Expected default timeout for invalid value, got %v", got)
+	}
+}
+
+func TestDynamoSink_Deliver(t *testing.T) {
+	db := &fakeDynamo{}
+	sink := &DynamoSink{client: db, tableName: "history"}
+	due := "2025-01-16T09:00:00Z"
+
+	ctx := withCaptureMeta(context.Background(), testMeta())
+	err := sink.Deliver(ctx, Response{Title: "Call mom", Action: "reminder", DueISO: &due, Tags: []string{"family"}})
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if len(db.items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(db.items))
+	}
+	item := db.items[0]
+	if item["pk"] != "USER#user-123" {
+		t.Errorf("Expected pk USER#user-123, got %v", item["pk"])
+	}
+	if item["sk"] != "CAPTURE#20250115T090000Z-abcd1234" {
+		t.Errorf("Expected capture sort key, got %v", item["sk"])
+	}
+	if item["dueISO"] != due {
+		t.Errorf("Expected dueISO %s, got %v", due, item["dueISO"])
+	}
+	if _, exists := item["startISO"]; exists {
+		t.Error("Expected nil startISO to be omitted")
+	}
+}
+
+func TestDynamoSink_DeliverError(t *testing.T) {
+	sink := &DynamoSink{client: &fakeDynamo{err: errors.New("throttled")}, tableName: "history"}
+
+	if err := sink.Deliver(context.Background(), Response{}); err == nil {
+		t.Error("Expected error from failing PutItem")
+	}
+}
+
+func TestS3Sink_Deliver(t *testing.T) {
+	store := &fakeS3{}
+	sink := &S3Sink{client: store, bucket: "captures"}
+
+	ctx := withCaptureMeta(context.Background(), testMeta())
+	if err := sink.Deliver(ctx, Response{Title: "Meeting", Action: "note", Markdown: "# Meeting", Tags: []string{"work"}}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if store.key != "captures/user-123/2025/01/20250115T090000Z-abcd1234.md" {
+		t.Errorf("Unexpected object key: %s", store.key)
+	}
+	if !strings.HasPrefix(store.body, "---\nid: 20250115T090000Z-abcd1234\n") {
+		t.Errorf("Expected frontmatter, got %q", store.body)
+	}
+	if !strings.Contains(store.body, "tags: [work]") || !strings.HasSuffix(store.body, "# Meeting\n") {
+		t.Errorf("Expected tags and markdown body, got %q", store.body)
+	}
+}
+
+func TestWebhookSink_Deliver(t *testing.T) {
+	var received Response
+	var captureID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captureID = r.Header.Get("X-Wrist-Capture-Id")
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{client: server.Client(), url: server.URL}
+	ctx := withCaptureMeta(context.Background(), testMeta())
+	if err := sink.Deliver(ctx, Response{Title: "Hello"}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if received.Title != "Hello" {
+		t.Errorf("Expected title Hello, got %s", received.Title)
+	}
+	if captureID != testMeta().ID {
+		t.Errorf("Expected capture ID header, got %s", captureID)
+	}
+}
+
+func TestWebhookSink_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{client: server.Client(), url: server.URL}
+	if err := sink.Deliver(context.Background(), Response{}); err == nil {
+		t.Error("Expected error for non-2xx status")
+	}
+}
+
+func TestNotionSink_Deliver(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/notion-token": "secret_abc"}})
+
+	var page map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&page)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	origBase := notionAPIBase
+	notionAPIBase = server.URL
+	defer func() { notionAPIBase = origBase }()
+
+	sink := &NotionSink{client: server.Client(), databaseID: "db-1", tokenParam: "/wrist-agent/notion-token", titleProperty: "Name"}
+	if err := sink.Deliver(context.Background(), Response{Title: "Idea", Markdown: "Build a thing"}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if auth != "Bearer secret_abc" {
+		t.Errorf("Expected bearer token from SSM, got %q", auth)
+	}
+	parent, _ := page["parent"].(map[string]interface{})
+	if parent["database_id"] != "db-1" {
+		t.Errorf("Expected database parent, got %v", page["parent"])
+	}
+}
+
+func TestNotionRichText_SplitsLongContent(t *testing.T) {
+	parts := notionRichText(strings.Repeat("é", notionMaxTextLength+10))
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 rich text parts, got %d", len(parts))
+	}
+}
+
+func TestGetParameter_Caches(t *testing.T) {
+	f := &fakeSSM{values: map[string]string{"/p": "  value  "}}
+	useFakeSSM(t, f)
+
+	for i := 0; i < 3; i++ {
+		got, err := getParameter(context.Background(), "/p")
+		if err != nil {
+			t.Fatalf("getParameter() error = %v", err)
+		}
+		if got != "value" {
+			t.Errorf("Expected trimmed value, got %q", got)
+		}
+	}
+	if f.calls != 1 {
+		t.Errorf("Expected 1 SSM call, got %d", f.calls)
+	}
+}
+
+func TestGetParameter_StaleOnFailure(t *testing.T) {
+	f := &fakeSSM{values: map[string]string{"/p": "value"}}
+	useFakeSSM(t, f)
+
+	if _, err := getParameter(context.Background(), "/p"); err != nil {
+		t.Fatalf("getParameter() error = %v", err)
+	}
+
+	// Expire the entry and make SSM fail
+	paramCache.mu.Lock()
+	entry := paramCache.entries["/p"]
+	entry.expiration = time.Now().Add(-time.Minute)
+	paramCache.entries["/p"] = entry
+	paramCache.mu.Unlock()
+	f.err = errors.New("ssm down")
+
+	got, err := getParameter(context.Background(), "/p")
+	if err != nil || got != "value" {
+		t.Errorf("Expected stale value, got %q, %v", got, err)
+	}
+}
+
+func TestPrincipalFromEvent(t *testing.T) {
+	event := events.APIGatewayProxyRequest{}
+	if got := principalFromEvent(event); got != "anonymous" {
+		t.Errorf("Expected anonymous, got %s", got)
+	}
+
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-abc"}
+	if got := principalFromEvent(event); got != "user-abc" {
+		t.Errorf("Expected user-abc, got %s", got)
+	}
+}
+
+func TestNewCaptureID(t *testing.T) {
+	a, b := newCaptureID(), newCaptureID()
+	if a == b {
+		t.Error("Expected unique capture IDs")
+	}
+	if len(a) != len("20060102T150405Z-")+8 {
+		t.Errorf("Unexpected capture ID format: %s", a)
+	}
+}
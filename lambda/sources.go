@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// Source is an entry point's Lambda event shape. invoke offers each payload to the
+// sources in order, and the first that matches handles it. Sources that carry captures
+// (Telegram, Alexa, email, WebSocket messages) turn them into a CaptureRequest and run
+// it with runCapture, so a new entry point is a new Source and nothing else changes.
+type Source interface {
+	Name() string
+	// Matches reports whether a payload is this source's event
+	Matches(payload json.RawMessage) bool
+	// Handle serves the event, returning what the Lambda returns to its caller
+	Handle(ctx context.Context, payload json.RawMessage) (interface{}, error)
+}
+
+// sources lists the entry points in the order they are tried; API Gateway REST requests
+// have no distinguishing field, so they come last and take everything else
+var sources = []Source{
+	scheduledTaskSource{},
+	workflowSource{},
+	jobQueueSource{},
+	inboundEmailSource{},
+	webSocketSource{},
+	alexaSource{},
+	functionURLSource{},
+	apiGatewaySource{},
+}
+
+// invoke routes a Lambda payload to the source it came from, so one function serves
+// them all
+func invoke(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	for _, source := range sources {
+		if source.Matches(payload) {
+			return source.Handle(ctx, payload)
+		}
+	}
+	return nil, fmt.Errorf("unrecognized event")
+}
+
+// CaptureRequest is a capture from any entry point, normalized for the invoke pipeline
+type CaptureRequest struct {
+	Source    string                 // entry point, for logs
+	RequestID string                 // the entry point's ID for the request, e.g. an email's message ID
+	Caller    map[string]interface{} // who it runs as, shaped like the authorizer context (principalId, scopes, ...)
+	Fields    map[string]interface{} // the invoke request body
+	Version   int                    // response shape, apiV1 (default) or apiV2
+}
+
+// CaptureResult is the invoke pipeline's answer to a CaptureRequest
+type CaptureResult struct {
+	Status   int
+	Body     string    // the response body as the REST API returns it
+	Response *Response // the response, when a v1 request succeeded
+	Error    string    // the error message, when it failed
+}
+
+// runCapture runs a capture through the invoke pipeline exactly as the REST API would
+// for its caller, with the response in JSON
+func runCapture(ctx context.Context, capture CaptureRequest) CaptureResult {
+	fields := map[string]interface{}{}
+	for name, value := range capture.Fields {
+		fields[name] = value
+	}
+	fields["format"] = "json"
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return CaptureResult{Status: 400, Error: "invalid request"}
+	}
+	version := capture.Version
+	if version == 0 {
+		version = apiV1
+	}
+
+	event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Body: string(body), Headers: map[string]string{}}
+	event.RequestContext.RequestID = capture.RequestID
+	event.RequestContext.Authorizer = capture.Caller
+	resp := handleInvoke(ctx, event, version)
+
+	result := CaptureResult{Status: resp.StatusCode, Body: resp.Body}
+	if resp.StatusCode >= 300 {
+		var envelope struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal([]byte(resp.Body), &envelope)
+		result.Error = envelope.Error.Message
+		log.Printf("%s capture %s failed with %d: %s", capture.Source, capture.RequestID, resp.StatusCode, result.Error)
+		return result
+	}
+	if version == apiV1 {
+		var response Response
+		if err := json.Unmarshal([]byte(resp.Body), &response); err == nil {
+			result.Response = &response
+		}
+	}
+	return result
+}
+
+// principalCaller is the caller for a principal with no scopes or profile
+func principalCaller(principal string) map[string]interface{} {
+	return map[string]interface{}{"principalId": principal}
+}
+
+// scheduledTaskSource runs EventBridge schedules ({"scheduledTask": "<name>"})
+type scheduledTaskSource struct{}
+
+func (scheduledTaskSource) Name() string { return "schedule" }
+
+func (scheduledTaskSource) Matches(payload json.RawMessage) bool {
+	var probe struct {
+		ScheduledTask string `json:"scheduledTask"`
+	}
+	return json.Unmarshal(payload, &probe) == nil && probe.ScheduledTask != ""
+}
+
+func (scheduledTaskSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event struct {
+		ScheduledTask string `json:"scheduledTask"`
+	}
+	json.Unmarshal(payload, &event)
+	return handleScheduledTask(ctx, event.ScheduledTask)
+}
+
+// workflowSource runs research workflow steps from Step Functions
+type workflowSource struct{}
+
+func (workflowSource) Name() string { return "workflow" }
+
+func (workflowSource) Matches(payload json.RawMessage) bool {
+	var probe struct {
+		WorkflowStep string `json:"workflowStep"`
+	}
+	return json.Unmarshal(payload, &probe) == nil && probe.WorkflowStep != ""
+}
+
+func (workflowSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event workflowEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow event: %w", err)
+	}
+	return handleWorkflowStep(ctx, event)
+}
+
+// jobQueueSource runs SQS batches from the job queue. Their jobs were normalized and
+// validated when they were queued, so the worker runs them directly.
+type jobQueueSource struct{}
+
+func (jobQueueSource) Name() string { return "sqs" }
+
+func (jobQueueSource) Matches(payload json.RawMessage) bool {
+	return recordsFrom(payload, "aws:sqs")
+}
+
+func (jobQueueSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.SQSEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse SQS event: %w", err)
+	}
+	return handleJobQueue(ctx, event)
+}
+
+// inboundEmailSource captures emails received by SES
+type inboundEmailSource struct{}
+
+func (inboundEmailSource) Name() string { return "email" }
+
+func (inboundEmailSource) Matches(payload json.RawMessage) bool {
+	return recordsFrom(payload, "aws:ses")
+}
+
+func (inboundEmailSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.SimpleEmailEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse SES event: %w", err)
+	}
+	return handleInboundEmail(ctx, event)
+}
+
+// webSocketSource serves the WebSocket API's routes
+type webSocketSource struct{}
+
+func (webSocketSource) Name() string { return "websocket" }
+
+func (webSocketSource) Matches(payload json.RawMessage) bool {
+	var probe struct {
+		RequestContext struct {
+			ConnectionID string `json:"connectionId"`
+			EventType    string `json:"eventType"`
+		} `json:"requestContext"`
+	}
+	return json.Unmarshal(payload, &probe) == nil && probe.RequestContext.ConnectionID != "" && probe.RequestContext.EventType != ""
+}
+
+func (webSocketSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.APIGatewayWebsocketProxyRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse WebSocket event: %w", err)
+	}
+	return handleWebSocket(ctx, event)
+}
+
+// alexaSource answers the Alexa skill
+type alexaSource struct{}
+
+func (alexaSource) Name() string { return "alexa" }
+
+func (alexaSource) Matches(payload json.RawMessage) bool {
+	var probe alexaRequest
+	return json.Unmarshal(payload, &probe) == nil &&
+		probe.Context.System.Application.ApplicationID != "" && probe.Request.Type != ""
+}
+
+func (alexaSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var req alexaRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse Alexa request: %w", err)
+	}
+	return handleAlexa(ctx, req)
+}
+
+// functionURLSource serves the function's URL like the REST API. The URL uses IAM
+// auth: the signed caller's IAM identity is the principal, as there is no authorizer.
+type functionURLSource struct{}
+
+func (functionURLSource) Name() string { return "function-url" }
+
+func (functionURLSource) Matches(payload json.RawMessage) bool {
+	var probe events.LambdaFunctionURLRequest
+	return json.Unmarshal(payload, &probe) == nil && probe.Version == "2.0" && probe.RequestContext.HTTP.Method != ""
+}
+
+func (functionURLSource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var req events.LambdaFunctionURLRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse function URL request: %w", err)
+	}
+	event := functionURLEvent(req)
+	var resp events.APIGatewayProxyResponse
+	if event.RequestContext.Authorizer == nil {
+		resp = errorResponse(apierror.WithRequestID(ctx, event.RequestContext.RequestID),
+			apierror.New(401, apierror.CodeUnauthorized, "Function URL requests must be signed with IAM credentials"))
+	} else {
+		var err error
+		if resp, err = handler(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         resp.Headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+	}, nil
+}
+
+// functionURLEvent converts a function URL request to the REST API's event, with the
+// IAM caller as the authorizer context (none when the URL's auth type is NONE)
+func functionURLEvent(req events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod:            req.RequestContext.HTTP.Method,
+		Path:                  req.RawPath,
+		Headers:               req.Headers,
+		QueryStringParameters: req.QueryStringParameters,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+	}
+	if req.IsBase64Encoded {
+		if body, err := base64.StdEncoding.DecodeString(req.Body); err == nil {
+			event.Body, event.IsBase64Encoded = string(body), false
+		}
+	}
+	event.RequestContext.RequestID = req.RequestContext.RequestID
+	event.RequestContext.Identity.SourceIP = req.RequestContext.HTTP.SourceIP
+	event.RequestContext.RequestTimeEpoch = req.RequestContext.TimeEpoch
+	if event.RequestContext.RequestTimeEpoch == 0 {
+		event.RequestContext.RequestTimeEpoch = time.Now().UnixMilli()
+	}
+	// Function URLs have no resource templates, so the path is matched to the documented ones
+	event.Resource, event.PathParameters = functionURLResource(req.RawPath)
+	if auth := req.RequestContext.Authorizer; auth != nil && auth.IAM != nil && auth.IAM.UserID != "" {
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "iam-" + auth.IAM.UserID}
+	}
+	return event
+}
+
+// functionURLResource finds the OpenAPI path template a request path is for, with its
+// path parameters, as API Gateway's resource would give them. Paths that match no
+// template keep their raw path.
+func functionURLResource(path string) (string, map[string]string) {
+	openAPIOnce.Do(func() { openAPISpec = buildOpenAPISpec() })
+	paths, _ := openAPISpec["paths"].(map[string]interface{})
+
+	prefix := ""
+	if match := versionPrefix.FindString(path); match != "" {
+		prefix = strings.TrimSuffix(match, "/")
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+	for template := range paths {
+		if !strings.Contains(template, "{") || versionPrefix.MatchString(template) {
+			continue
+		}
+		parts := strings.Split(strings.Trim(template, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") && segments[i] != "" {
+				params[strings.Trim(part, "{}")] = segments[i]
+			} else if part != segments[i] {
+				params = nil
+				break
+			}
+		}
+		if params != nil {
+			return prefix + template, params
+		}
+	}
+	return "", nil
+}
+
+// apiGatewaySource serves the REST API
+type apiGatewaySource struct{}
+
+func (apiGatewaySource) Name() string { return "api" }
+
+func (apiGatewaySource) Matches(payload json.RawMessage) bool { return true }
+
+func (apiGatewaySource) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.APIGatewayProxyRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse API Gateway event: %w", err)
+	}
+	return handler(ctx, event)
+}
+
+// recordsFrom reports whether a payload is a batch of records from an event source
+func recordsFrom(payload json.RawMessage, eventSource string) bool {
+	var probe struct {
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+	}
+	return json.Unmarshal(payload, &probe) == nil && len(probe.Records) > 0 && probe.Records[0].EventSource == eventSource
+}
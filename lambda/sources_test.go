@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// functionURLPayload builds a function URL request as the Lambda receives it
+func functionURLPayload(t *testing.T, method, path, body, userID string) json.RawMessage {
+	t.Helper()
+	req := events.LambdaFunctionURLRequest{Version: "2.0", RawPath: path, Body: body, Headers: map[string]string{}}
+	req.RequestContext.RequestID = "url-req-1"
+	req.RequestContext.HTTP.Method = method
+	req.RequestContext.HTTP.Path = path
+	if userID != "" {
+		req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+			IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserID: userID},
+		}
+	}
+	return mustJSON(t, req)
+}
+
+func TestSources_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload json.RawMessage
+		want    string
+	}{
+		{"schedule", json.RawMessage(`{"scheduledTask":"dailyDigest"}`), "schedule"},
+		{"workflow", json.RawMessage(`{"workflowStep":"plan"}`), "workflow"},
+		{"sqs", json.RawMessage(`{"Records":[{"eventSource":"aws:sqs"}]}`), "sqs"},
+		{"ses", json.RawMessage(`{"Records":[{"eventSource":"aws:ses"}]}`), "email"},
+		{"websocket", mustJSON(t, wsEvent("MESSAGE", "{}")), "websocket"},
+		{"alexa", alexaPayload("LaunchRequest", "", "", "", ""), "alexa"},
+		{"function url", functionURLPayload(t, "GET", "/modes", "", "AIDAEXAMPLE"), "function-url"},
+		{"api gateway", json.RawMessage(`{"httpMethod":"GET","resource":"/modes","path":"/modes"}`), "api"},
+		{"unknown records", json.RawMessage(`{"Records":[{"eventSource":"aws:s3"}]}`), "api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, source := range sources {
+				if source.Matches(tt.payload) {
+					if source.Name() != tt.want {
+						t.Errorf("Matched source %q, want %q", source.Name(), tt.want)
+					}
+					return
+				}
+			}
+			t.Errorf("No source matched, want %q", tt.want)
+		})
+	}
+}
+
+func TestFunctionURLEvent(t *testing.T) {
+	var req events.LambdaFunctionURLRequest
+	json.Unmarshal(functionURLPayload(t, "POST", "/v2/reminders/r-42/complete", base64.StdEncoding.EncodeToString([]byte(`{"a":1}`)), "AIDAEXAMPLE"), &req)
+	req.IsBase64Encoded = true
+
+	event := functionURLEvent(req)
+	if event.HTTPMethod != "POST" || event.Body != `{"a":1}` || event.IsBase64Encoded {
+		t.Errorf("Unexpected request: %s %q (base64 %v)", event.HTTPMethod, event.Body, event.IsBase64Encoded)
+	}
+	if event.Resource != "/v2/reminders/{id}/complete" || event.PathParameters["id"] != "r-42" {
+		t.Errorf("Resource = %q %v, want /v2/reminders/{id}/complete with id r-42", event.Resource, event.PathParameters)
+	}
+	if version, path := apiRoute(event); version != apiV2 || path != "/reminders/{id}/complete" {
+		t.Errorf("apiRoute() = %d %q", version, path)
+	}
+	if got := principalFromEvent(event); got != "iam-AIDAEXAMPLE" {
+		t.Errorf("principal = %q, want iam-AIDAEXAMPLE", got)
+	}
+
+	var unsigned events.LambdaFunctionURLRequest
+	json.Unmarshal(functionURLPayload(t, "GET", "/modes", "", ""), &unsigned)
+	event = functionURLEvent(unsigned)
+	if event.Resource != "" || event.PathParameters != nil || event.RequestContext.Authorizer != nil {
+		t.Errorf("Unexpected event for unsigned GET /modes: %+v", event)
+	}
+}
+
+func TestFunctionURLSource(t *testing.T) {
+	out, err := invoke(context.Background(), functionURLPayload(t, "GET", "/modes", "", "AIDAEXAMPLE"))
+	if err != nil {
+		t.Fatalf("invoke() error = %v", err)
+	}
+	resp, ok := out.(events.LambdaFunctionURLResponse)
+	if !ok || resp.StatusCode != 200 || !strings.Contains(resp.Body, "reminder") {
+		t.Errorf("Signed request returned %+v", out)
+	}
+
+	out, _ = invoke(context.Background(), functionURLPayload(t, "GET", "/modes", "", ""))
+	if resp, ok := out.(events.LambdaFunctionURLResponse); !ok || resp.StatusCode != 401 {
+		t.Errorf("Unsigned request returned %+v, want 401", out)
+	}
+}
+
+func TestRunCapture(t *testing.T) {
+	model := &fakeBedrock{text: `{"action":"note","title":"Buy bread","markdown":"Buy bread","shortText":"Buy bread"}`}
+	useFakeBedrock(t, model)
+
+	result := runCapture(context.Background(), CaptureRequest{
+		Source:    "test",
+		RequestID: "capture-1",
+		Caller:    principalCaller("user-1"),
+		Fields:    map[string]interface{}{"text": "buy bread", "mode": "note"},
+	})
+	if result.Status != 200 || result.Error != "" || result.Response == nil || result.Response.Title != "Buy bread" {
+		t.Fatalf("runCapture() = %+v", result)
+	}
+	if !strings.Contains(string(model.body), "buy bread") {
+		t.Errorf("Model wasn't sent the text: %s", model.body)
+	}
+
+	result = runCapture(context.Background(), CaptureRequest{Source: "test", Caller: principalCaller("user-1"), Fields: map[string]interface{}{"mode": "note"}})
+	if result.Status != 400 || result.Error == "" || result.Response != nil {
+		t.Errorf("runCapture() without text = %+v, want a 400 with its message", result)
+	}
+
+	result = runCapture(context.Background(), CaptureRequest{
+		Source:  "test",
+		Caller:  principalCaller("user-1"),
+		Fields:  map[string]interface{}{"text": "buy bread", "mode": "note"},
+		Version: apiV2,
+	})
+	if result.Status != 200 || result.Response != nil || !strings.Contains(result.Body, `"items"`) {
+		t.Errorf("runCapture() v2 = %+v, want the v2 body", result)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/polly"
+	pollytypes "github.com/aws/aws-sdk-go-v2/service/polly/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Presigned speech links only need to last until the watch plays the reply
+const speechURLExpiry = time.Hour
+
+// Longest spoken confirmation; anything longer stops being a glance and becomes a podcast
+const maxSpeechChars = 300
+
+// Default Polly voice (overridable via POLLY_VOICE_ID); neural voices sound best on the watch speaker
+const defaultPollyVoice = "Joanna"
+
+// pollyAPI is the subset of the Polly client used by the handler
+type pollyAPI interface {
+	SynthesizeSpeech(ctx context.Context, params *polly.SynthesizeSpeechInput, optFns ...func(*polly.Options)) (*polly.SynthesizeSpeechOutput, error)
+}
+
+var pollyClient pollyAPI
+
+// spokenConfirmation is the short sentence read back for a processed request,
+// e.g. "Reminder set: Call mom, Monday, January 15 at 3:00 PM."
+func spokenConfirmation(resp Response) string {
+	var text string
+	switch resp.Action {
+	case "reminder":
+		text = "Reminder set: " + resp.Title
+		if when := spokenTime(resp.DueISO); when != "" {
+			text += ", " + when
+		}
+	case "event":
+		text = "Event added: " + resp.Title
+		if when := spokenTime(resp.StartISO); when != "" {
+			text += ", " + when
+		}
+	case "email":
+		text = "Email drafted: " + resp.Title
+		if resp.Email != nil && resp.Email.Sent {
+			text = "Email sent: " + resp.Title
+		}
+	default:
+		text = resp.ShortText
+		if text == "" {
+			text = "Saved: " + resp.Title
+		}
+	}
+
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxSpeechChars {
+		text = string(runes[:maxSpeechChars-3]) + "..."
+	}
+	if !strings.HasSuffix(text, ".") && !strings.HasSuffix(text, "?") && !strings.HasSuffix(text, "!") {
+		text += "."
+	}
+	return text
+}
+
+// spokenTime renders an ISO timestamp the way it would be said, in its own offset
+func spokenTime(iso *string) string {
+	if iso == nil {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, *iso)
+	if err != nil {
+		return ""
+	}
+	return t.Format("Monday, January 2 at 3:04 PM")
+}
+
+// attachSpeech synthesizes the spoken confirmation with Polly, stores it under
+// speech/<principal>/<id>.mp3 and sets a presigned audioUrl. Failures are logged and
+// leave the response without audio rather than failing the request.
+func attachSpeech(ctx context.Context, meta captureMeta, resp *Response) {
+	url, err := synthesizeSpeech(ctx, meta, spokenConfirmation(*resp))
+	if err != nil {
+		log.Printf("Skipping spoken reply: %v", err)
+		return
+	}
+	resp.AudioURL = url
+}
+
+// synthesizeSpeech renders text as MP3 and returns a presigned URL for it
+func synthesizeSpeech(ctx context.Context, meta captureMeta, text string) (string, error) {
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" || pollyClient == nil {
+		return "", fmt.Errorf("spoken replies not configured")
+	}
+
+	out, err := pollyClient.SynthesizeSpeech(ctx, &polly.SynthesizeSpeechInput{
+		Text:         aws.String(text),
+		OutputFormat: pollytypes.OutputFormatMp3,
+		VoiceId:      pollytypes.VoiceId(getEnv("POLLY_VOICE_ID", defaultPollyVoice)),
+		Engine:       pollytypes.Engine(getEnv("POLLY_ENGINE", string(pollytypes.EngineNeural))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Polly SynthesizeSpeech failed: %w", err)
+	}
+	defer out.AudioStream.Close()
+	audio, err := io.ReadAll(out.AudioStream)
+	if err != nil {
+		return "", fmt.Errorf("failed to read synthesized speech: %w", err)
+	}
+
+	key := fmt.Sprintf("speech/%s/%s.mp3", meta.Principal, meta.ID)
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(audio),
+		ContentType: aws.String("audio/mpeg"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("S3 PutObject failed: %w", err)
+	}
+
+	presigned, err := s3Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(speechURLExpiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign speech URL: %w", err)
+	}
+	return presigned.URL, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/polly"
+)
+
+// fakePolly returns the request text as the "audio"
+type fakePolly struct {
+	input *polly.SynthesizeSpeechInput
+	err   error
+}
+
+func (f *fakePolly) SynthesizeSpeech(ctx context.Context, params *polly.SynthesizeSpeechInput, optFns ...func(*polly.Options)) (*polly.SynthesizeSpeechOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.input = params
+	return &polly.SynthesizeSpeechOutput{AudioStream: io.NopCloser(strings.NewReader("mp3:" + aws.ToString(params.Text)))}, nil
+}
+
+// useFakePolly swaps the Polly client for one test
+func useFakePolly(t *testing.T, fake *fakePolly) {
+	t.Helper()
+	orig := pollyClient
+	pollyClient = fake
+	t.Cleanup(func() { pollyClient = orig })
+}
+
+func TestSpokenConfirmation(t *testing.T) {
+	due := "2025-01-15T15:00:00-08:00"
+	tests := []struct {
+		name string
+		resp Response
+		want string
+	}{
+		{"reminder", Response{Action: "reminder", Title: "Call mom", DueISO: &due}, "Reminder set: Call mom, Wednesday, January 15 at 3:00 PM."},
+		{"reminder without due", Response{Action: "reminder", Title: "Call mom"}, "Reminder set: Call mom."},
+		{"event", Response{Action: "event", Title: "Team standup", StartISO: &due}, "Event added: Team standup, Wednesday, January 15 at 3:00 PM."},
+		{"email draft", Response{Action: "email", Title: "Invoice", Email: &EmailDraft{}}, "Email drafted: Invoice."},
+		{"email sent", Response{Action: "email", Title: "Invoice", Email: &EmailDraft{Sent: true}}, "Email sent: Invoice."},
+		{"note", Response{Action: "note", Title: "Grocery ideas"}, "Saved: Grocery ideas."},
+		{"short text", Response{Action: "note", Title: "Research", ShortText: "Tides follow the moon!"}, "Tides follow the moon!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spokenConfirmation(tt.resp); got != tt.want {
+				t.Errorf("spokenConfirmation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	long := spokenConfirmation(Response{Action: "note", ShortText: strings.Repeat("word ", 200)})
+	if n := len([]rune(long)); n > maxSpeechChars+1 {
+		t.Errorf("long confirmation is %d chars, want at most %d", n, maxSpeechChars+1)
+	}
+}
+
+func TestAttachSpeech(t *testing.T) {
+	meta := captureMeta{ID: "cap-1", Principal: "user-1", CreatedAt: time.Now()}
+
+	t.Run("uploads and presigns", func(t *testing.T) {
+		t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+		t.Setenv("POLLY_VOICE_ID", "Matthew")
+		store := &fakeS3{}
+		useFakeS3(t, store, &fakePresigner{})
+		fake := &fakePolly{}
+		useFakePolly(t, fake)
+
+		resp := Response{Action: "reminder", Title: "Call mom"}
+		attachSpeech(context.Background(), meta, &resp)
+
+		if store.key != "speech/user-1/cap-1.mp3" || store.body != "mp3:Reminder set: Call mom." {
+			t.Errorf("stored %q: %q", store.key, store.body)
+		}
+		if fake.input.VoiceId != "Matthew" || fake.input.OutputFormat != "mp3" || fake.input.Engine != "neural" {
+			t.Errorf("input = %+v", fake.input)
+		}
+		if !strings.Contains(resp.AudioURL, "speech/user-1/cap-1.mp3") {
+			t.Errorf("AudioURL = %q", resp.AudioURL)
+		}
+	})
+
+	t.Run("failures leave the response without audio", func(t *testing.T) {
+		t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+		useFakeS3(t, &fakeS3{}, &fakePresigner{})
+		useFakePolly(t, &fakePolly{err: errors.New("TextLengthExceededException")})
+
+		resp := Response{Action: "note", Title: "x"}
+		attachSpeech(context.Background(), meta, &resp)
+		if resp.AudioURL != "" {
+			t.Errorf("AudioURL = %q, want empty", resp.AudioURL)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		t.Setenv("CAPTURE_BUCKET_NAME", "")
+		useFakePolly(t, &fakePolly{})
+
+		resp := Response{Action: "note", Title: "x"}
+		attachSpeech(context.Background(), meta, &resp)
+		if resp.AudioURL != "" {
+			t.Errorf("AudioURL = %q, want empty", resp.AudioURL)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"wrist-agent/apierror"
+)
+
+// Strict field checking (STRICT_REQUEST_FIELDS). Off by default so existing Shortcuts
+// that send extra fields keep working.
+const (
+	strictFieldsOff = "off" // unknown fields are ignored
+	strictFieldsV2  = "v2"  // /v2 routes reject unknown fields
+	strictFieldsAll = "all" // every version rejects unknown fields
+)
+
+// strictFieldsEnabled reports whether request bodies on this API version must only use
+// known fields
+func strictFieldsEnabled(version int) bool {
+	switch strings.ToLower(getEnv("STRICT_REQUEST_FIELDS", strictFieldsOff)) {
+	case strictFieldsAll:
+		return true
+	case strictFieldsV2:
+		return version == apiV2
+	}
+	return false
+}
+
+// decodeRequest parses a JSON body into v, a pointer to a request struct. In strict mode
+// keys must match a field's JSON name exactly (encoding/json would otherwise accept
+// "maxtokens" for maxTokens, and ignore "max_tokens") and values must have the field's
+// type; each offending field is listed in details.fields.
+func decodeRequest(body string, strict bool, v interface{}) *apierror.Error {
+	if !strict {
+		if err := json.Unmarshal([]byte(body), v); err != nil {
+			return apierror.InvalidJSON()
+		}
+		return nil
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &keys); err != nil {
+		return apierror.InvalidJSON()
+	}
+	if fields := unknownFields(keys, reflect.TypeOf(v).Elem()); len(fields) > 0 {
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.Field
+		}
+		message := "unknown field: " + names[0]
+		if len(fields) > 1 {
+			message = "unknown fields: " + strings.Join(names, ", ")
+		} else if fields[0].Suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %s?)", fields[0].Suggestion)
+		}
+		return apierror.InvalidRequest(message).WithFields(fields)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			field := apierror.FieldError{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)}
+			return apierror.InvalidRequest(fmt.Sprintf("%s %s", field.Field, field.Message)).WithFields([]apierror.FieldError{field})
+		}
+		// Unknown fields inside nested objects
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			name = strings.Trim(name, `"`)
+			return apierror.InvalidRequest("unknown field: " + name).WithFields([]apierror.FieldError{{Field: name, Message: "unknown field"}})
+		}
+		return apierror.InvalidJSON()
+	}
+	return nil
+}
+
+// unknownFields lists the body keys that aren't exactly a JSON field name of t, in key
+// order, suggesting the field each probably meant
+func unknownFields(keys map[string]json.RawMessage, t reflect.Type) []apierror.FieldError {
+	known := jsonFieldNames(t)
+	var fields []apierror.FieldError
+	for key := range keys {
+		if known[key] {
+			continue
+		}
+		field := apierror.FieldError{Field: key, Message: "unknown field"}
+		for name := range known {
+			if foldFieldName(name) == foldFieldName(key) {
+				field.Suggestion = name
+			}
+		}
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return fields
+}
+
+// jsonFieldNames returns the JSON names of t's exported fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// foldFieldName normalizes a field name for typo suggestions, so maxtokens, max_tokens
+// and max-tokens all match maxTokens
+func foldFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// jsonTypeName describes the JSON value a Go type decodes from
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a valid value"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"wrist-agent/apierror"
+)
+
+func TestStrictFieldsEnabled(t *testing.T) {
+	if strictFieldsEnabled(apiV1) || strictFieldsEnabled(apiV2) {
+		t.Error("strict fields should be off by default")
+	}
+	t.Setenv("STRICT_REQUEST_FIELDS", "v2")
+	if strictFieldsEnabled(apiV1) || !strictFieldsEnabled(apiV2) {
+		t.Error("v2 should only be strict on /v2")
+	}
+	t.Setenv("STRICT_REQUEST_FIELDS", "all")
+	if !strictFieldsEnabled(apiV1) {
+		t.Error("all should be strict on v1")
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		strict     bool
+		wantCode   apierror.Code
+		wantFields []apierror.FieldError
+	}{
+		{name: "lenient ignores unknown fields", body: `{"text":"hi","maxtokens":100,"colour":"red"}`},
+		{name: "lenient bad json", body: `{`, wantCode: apierror.CodeInvalidJSON},
+		{name: "strict accepts known fields", body: `{"text":"hi","maxTokens":100,"temperature":0.5}`, strict: true},
+		{
+			name: "strict miscased field", body: `{"text":"hi","maxtokens":100}`, strict: true,
+			wantCode:   apierror.CodeInvalidRequest,
+			wantFields: []apierror.FieldError{{Field: "maxtokens", Message: "unknown field", Suggestion: "maxTokens"}},
+		},
+		{
+			name: "strict lists every unknown field", body: `{"text":"hi","max_tokens":100,"colour":"red"}`, strict: true,
+			wantCode: apierror.CodeInvalidRequest,
+			wantFields: []apierror.FieldError{
+				{Field: "colour", Message: "unknown field"},
+				{Field: "max_tokens", Message: "unknown field", Suggestion: "maxTokens"},
+			},
+		},
+		{
+			name: "strict wrong type", body: `{"text":"hi","maxTokens":"800"}`, strict: true,
+			wantCode:   apierror.CodeInvalidRequest,
+			wantFields: []apierror.FieldError{{Field: "maxTokens", Message: "must be an integer"}},
+		},
+		{name: "strict bad json", body: `["hi"]`, strict: true, wantCode: apierror.CodeInvalidJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req Req
+			apiErr := decodeRequest(tt.body, tt.strict, &req)
+			if tt.wantCode == "" {
+				if apiErr != nil || req.Text != "hi" {
+					t.Fatalf("decodeRequest() = %v, req %+v", apiErr, req)
+				}
+				return
+			}
+			if apiErr == nil || apiErr.Code != tt.wantCode {
+				t.Fatalf("decodeRequest() = %v, want %s", apiErr, tt.wantCode)
+			}
+			got, _ := json.Marshal(apiErr.Details["fields"])
+			want, _ := json.Marshal(tt.wantFields)
+			if tt.wantFields != nil && string(got) != string(want) {
+				t.Errorf("fields = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHandler_StrictFields(t *testing.T) {
+	t.Setenv("STRICT_REQUEST_FIELDS", "v2")
+
+	resp, _ := handler(context.Background(), asyncEvent("/v2/invoke", `{"text":"buy milk","mode":"reminder","maxtokens":100}`))
+	if resp.StatusCode != 400 {
+		t.Fatalf("StatusCode = %d, want 400: %s", resp.StatusCode, resp.Body)
+	}
+	var envelope apierror.Envelope
+	json.Unmarshal([]byte(resp.Body), &envelope)
+	if envelope.Error.Message != "unknown field: maxtokens (did you mean maxTokens?)" || envelope.Error.Details["fields"] == nil {
+		t.Errorf("error = %+v", envelope.Error)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Default chunk size for map-reduce summarization (overridable via SUMMARIZE_CHUNK_CHARS).
+// Texts up to this size are summarized in a single call.
+const defaultSummarizeChunkChars = 24000
+
+// Token budget for each chunk's intermediate notes, and caps on the final digest
+const (
+	summarizeChunkMaxTokens = 700
+	maxDigestBullets        = 10
+	maxDigestActionItems    = 10
+)
+
+// Digest is the summarize mode result: key points and anything the reader has to do
+type Digest struct {
+	Bullets     []string `json:"bullets"`
+	ActionItems []string `json:"actionItems"`
+}
+
+func summarizeChunkChars() int {
+	return limitEnv("SUMMARIZE_CHUNK_CHARS", defaultSummarizeChunkChars, 1000)
+}
+
+// chunkText splits text into pieces of at most size characters, preferring to break at
+// a paragraph, then a sentence, then a word in the last fifth of each piece
+func chunkText(text string, size int) []string {
+	var chunks []string
+	for {
+		text = strings.TrimSpace(text)
+		if utf8.RuneCountInString(text) <= size {
+			if text != "" {
+				chunks = append(chunks, text)
+			}
+			return chunks
+		}
+
+		window := string([]rune(text)[:size])
+		cut := len(window)
+		minCut := len(string([]rune(window)[:size*4/5]))
+		for _, sep := range []string{"\n\n", ". ", "\n", " "} {
+			if i := strings.LastIndex(window, sep); i >= minCut {
+				cut = i + len(sep)
+				break
+			}
+		}
+		chunks = append(chunks, strings.TrimSpace(window[:cut]))
+		text = text[cut:]
+	}
+}
+
+// condenseForSummary is the map step of summarization: text longer than one chunk is
+// split and each chunk reduced to notes, which replace the text for the final summary
+// call. Shorter text is returned unchanged. The returned usage covers the chunk calls.
+func condenseForSummary(ctx context.Context, text string) (string, Usage, error) {
+	chunks := chunkText(text, summarizeChunkChars())
+	if len(chunks) <= 1 {
+		return text, Usage{}, nil
+	}
+
+	system := `You are condensing one part of a long document so it can be summarized as a whole. Write plain-text notes, one point per line starting with "- ", covering the key facts, decisions, numbers and names in this part. List any tasks, deadlines or requests addressed to the reader on lines starting with "- ACTION: ". Don't add commentary or anything that isn't in the text.`
+
+	var notes []string
+	var usage Usage
+	for i, chunk := range chunks {
+		part, chunkUsage, err := invokeModel(ctx, system, chunk, summarizeChunkMaxTokens, 0)
+		if err != nil {
+			return "", usage, fmt.Errorf("summarizing part %d of %d: %w", i+1, len(chunks), err)
+		}
+		usage.InputTokens += chunkUsage.InputTokens
+		usage.OutputTokens += chunkUsage.OutputTokens
+		notes = append(notes, fmt.Sprintf("Notes on part %d of %d:\n%s", i+1, len(chunks), strings.TrimSpace(part)))
+	}
+	return "Summarize this document from the notes on each of its parts.\n\n" + strings.Join(notes, "\n\n"), usage, nil
+}
+
+// finalizeDigest cleans the model's bullets and action items
+func finalizeDigest(resp *Response) {
+	if resp.Digest == nil {
+		resp.Digest = &Digest{}
+	}
+	resp.Digest.Bullets = cleanDigestLines(resp.Digest.Bullets, maxDigestBullets)
+	resp.Digest.ActionItems = cleanDigestLines(resp.Digest.ActionItems, maxDigestActionItems)
+}
+
+// cleanDigestLines trims list markers and whitespace, dropping blanks, up to max lines
+func cleanDigestLines(lines []string, max int) []string {
+	cleaned := []string{}
+	for _, line := range lines {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+		if line == "" {
+			continue
+		}
+		cleaned = append(cleaned, line)
+		if len(cleaned) == max {
+			break
+		}
+	}
+	return cleaned
+}
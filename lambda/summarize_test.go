@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// fakeBedrock answers every InvokeModel call with the same text and usage
+type fakeBedrock struct {
+	text  string
+	usage Usage
+	err   error
+	calls int
+	model string // ModelId of the last call
+	body  []byte // request body of the last call
+}
+
+func (f *fakeBedrock) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	f.calls++
+	f.model = aws.ToString(params.ModelId)
+	f.body = params.Body
+	if f.err != nil {
+		return nil, f.err
+	}
+	body, err := json.Marshal(BedrockResponse{Content: []Content{{Type: "text", Text: f.text}}, Usage: f.usage})
+	return &bedrockruntime.InvokeModelOutput{Body: body}, err
+}
+
+// useFakeBedrock swaps the Bedrock client for one test
+func useFakeBedrock(t *testing.T, fake *fakeBedrock) {
+	t.Helper()
+	orig := bedrockClient
+	bedrockClient = fake
+	t.Cleanup(func() { bedrockClient = orig })
+}
+
+func TestChunkText(t *testing.T) {
+	if got := chunkText("  short text  ", 100); len(got) != 1 || got[0] != "short text" {
+		t.Errorf("chunkText(short) = %q", got)
+	}
+
+	paragraph := strings.Repeat("word ", 18) + "end." // 94 chars
+	text := paragraph + "\n\n" + paragraph + "\n\n" + paragraph
+	chunks := chunkText(text, 100)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3: %q", len(chunks), chunks)
+	}
+	for _, chunk := range chunks {
+		if chunk != paragraph {
+			t.Errorf("chunk = %q, want a whole paragraph", chunk)
+		}
+	}
+
+	// Without whitespace the text is still split, on character boundaries
+	chunks = chunkText(strings.Repeat("é", 250), 100)
+	if len(chunks) != 3 || utf8.RuneCountInString(chunks[0]) != 100 || !utf8.ValidString(chunks[2]) {
+		t.Errorf("chunkText(no spaces) = %d chunks", len(chunks))
+	}
+	if strings.Join(chunks, "") != strings.Repeat("é", 250) {
+		t.Error("chunks don't add up to the original text")
+	}
+}
+
+func TestCondenseForSummary(t *testing.T) {
+	t.Setenv("SUMMARIZE_CHUNK_CHARS", "1000")
+
+	t.Run("short text is summarized in one call", func(t *testing.T) {
+		fake := &fakeBedrock{}
+		useFakeBedrock(t, fake)
+		text, usage, err := condenseForSummary(context.Background(), "a short memo")
+		if err != nil || text != "a short memo" || usage != (Usage{}) || fake.calls != 0 {
+			t.Errorf("got %q, %+v, %v after %d calls", text, usage, err, fake.calls)
+		}
+	})
+
+	t.Run("long text is condensed per chunk", func(t *testing.T) {
+		fake := &fakeBedrock{text: "- a point\n- ACTION: reply by Friday", usage: Usage{InputTokens: 300, OutputTokens: 20}}
+		useFakeBedrock(t, fake)
+		long := strings.Repeat(strings.Repeat("word ", 99)+"end.\n\n", 5) // 5 paragraphs of 504 chars
+		text, usage, err := condenseForSummary(context.Background(), long)
+		if err != nil {
+			t.Fatalf("condenseForSummary() error = %v", err)
+		}
+		if fake.calls != 3 || usage.InputTokens != 900 || usage.OutputTokens != 60 {
+			t.Errorf("calls = %d, usage = %+v", fake.calls, usage)
+		}
+		if !strings.Contains(text, "Notes on part 3 of 3:\n- a point\n- ACTION: reply by Friday") {
+			t.Errorf("text = %q", text)
+		}
+	})
+
+	t.Run("chunk failures fail the request", func(t *testing.T) {
+		useFakeBedrock(t, &fakeBedrock{err: errors.New("throttled")})
+		if _, _, err := condenseForSummary(context.Background(), strings.Repeat("word ", 500)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestFinalizeDigest(t *testing.T) {
+	resp := Response{Digest: &Digest{
+		Bullets:     []string{"- Budget approved ", "", "• Launch moved to May"},
+		ActionItems: nil,
+	}}
+	finalizeDigest(&resp)
+	if strings.Join(resp.Digest.Bullets, "|") != "Budget approved|Launch moved to May" || resp.Digest.ActionItems == nil {
+		t.Errorf("digest = %+v", *resp.Digest)
+	}
+
+	resp = Response{}
+	finalizeDigest(&resp)
+	if resp.Digest == nil || len(resp.Digest.Bullets) != 0 {
+		t.Errorf("digest = %+v", resp.Digest)
+	}
+}
+
+func TestCheckBodySize_SummarizeAllowance(t *testing.T) {
+	limits := sizeLimits{MaxBodyBytes: 100, SummarizeMaxTextChars: 1000}
+	text := strings.Repeat("a", 2000)
+
+	if err := limits.checkBodySize(`{"mode":"summarize","text":"` + text + `"}`); err != nil {
+		t.Errorf("summarize body within the allowance was rejected: %v", err)
+	}
+	if err := limits.checkBodySize(`{"mode":"note","text":"` + text + `"}`); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("body for another mode should keep the base limit, got %v", err)
+	}
+	if err := limits.checkBodySize(`{"mode":"note","text":"\"summarize\" ` + text + `"}`); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("\"summarize\" in the text should not raise the limit, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// How much history informs tag suggestions: the most recent captures, and how many of
+// their most used tags are offered to the model
+const (
+	tagHistoryCaptures = 200
+	maxPreferredTags   = 20
+)
+
+// Tag caps: tags kept per capture (overridable via TAG_MAX_COUNT), and entries in a
+// user's alias table
+const (
+	defaultTagMaxCount = 5
+	maxTagAliases      = 100
+)
+
+func tagMaxCount() int {
+	return limitEnv("TAG_MAX_COUNT", defaultTagMaxCount, 1)
+}
+
+// loadTopTags returns a principal's most used tags across their recent captures, most
+// used first (ties alphabetically)
+func loadTopTags(ctx context.Context, principal string) ([]string, error) {
+	out, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(historyTableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":     &types.AttributeValueMemberS{Value: historyPK(principal)},
+			":prefix": &types.AttributeValueMemberS{Value: captureSKPrefix},
+		},
+		ProjectionExpression: aws.String("tags, deleted"),
+		ScanIndexForward:     aws.Bool(false), // capture IDs sort by time, so newest first
+		Limit:                aws.Int32(tagHistoryCaptures),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB Query failed: %w", err)
+	}
+
+	var captures []struct {
+		Tags    []string `dynamodbav:"tags"`
+		Deleted bool     `dynamodbav:"deleted"`
+	}
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &captures); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capture tags: %w", err)
+	}
+
+	var tagLists [][]string
+	for _, capture := range captures {
+		if !capture.Deleted {
+			tagLists = append(tagLists, capture.Tags)
+		}
+	}
+	ranked := rankTags(tagLists, maxPreferredTags)
+	tags := make([]string, len(ranked))
+	for i, tag := range ranked {
+		tags[i] = tag.Tag
+	}
+	return tags, nil
+}
+
+// TagCount is a tag and how many captures used it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// rankTags counts tags by canonical form across captures and returns the n most used,
+// most used first (ties alphabetically), each in its most common spelling
+func rankTags(tagLists [][]string, n int) []TagCount {
+	counts := map[string]int{}
+	spellings := map[string]map[string]int{}
+	for _, tags := range tagLists {
+		for _, tag := range tags {
+			key := canonicalTag(tag)
+			if key == "" {
+				continue
+			}
+			counts[key]++
+			if spellings[key] == nil {
+				spellings[key] = map[string]int{}
+			}
+			spellings[key][strings.TrimSpace(tag)]++
+		}
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+
+	ranked := make([]TagCount, len(keys))
+	for i, key := range keys {
+		ranked[i] = TagCount{Tag: mostCommon(spellings[key]), Count: counts[key]}
+	}
+	return ranked
+}
+
+// mostCommon returns the most frequent string in counts, alphabetically first on ties
+func mostCommon(counts map[string]int) string {
+	best := ""
+	for value, count := range counts {
+		if best == "" || count > counts[best] || (count == counts[best] && value < best) {
+			best = value
+		}
+	}
+	return best
+}
+
+// canonicalTag reduces a tag to lowercase letters and digits, so "To-Do", "todo" and
+// "to do" compare equal
+func canonicalTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, tag)
+}
+
+// requestTags returns the tags to suggest in a request's system prompt. Storage errors
+// are logged and skipped - suggestions keep tags tidy but aren't required.
+func requestTags(ctx context.Context, principal string) []string {
+	if historyTableName == "" {
+		return nil
+	}
+	tags, err := loadTopTags(ctx, principal)
+	if err != nil {
+		log.Printf("Failed to load tag history, continuing without it: %v", err)
+		return nil
+	}
+	return tags
+}
+
+// tagPrompt is the system prompt section listing the caller's established tags
+func tagPrompt(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return `
+
+Preferred tags:
+The user already tags captures with the tags below. Reuse them whenever one fits, spelled exactly as listed, and only invent a new tag when none of them does:
+- ` + strings.Join(tags, "\n- ")
+}
+
+// preferTags rewrites tags that differ from an established tag only in case or
+// punctuation to the established spelling, dropping duplicates this creates
+func preferTags(tags, preferred []string) []string {
+	if len(tags) == 0 {
+		return tags
+	}
+	spelling := map[string]string{}
+	for _, tag := range preferred {
+		spelling[canonicalTag(tag)] = tag
+	}
+
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		key := canonicalTag(tag)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if established, ok := spelling[key]; ok {
+			tag = established
+		}
+		out = append(out, strings.TrimSpace(tag))
+	}
+	return out
+}
+
+// slugTag turns a tag into a lowercase slug: runs of anything but letters and digits
+// become one hyphen, so "Work Travel!" is "work-travel". A slash separates the levels of
+// a nested tag ("Projects / Q3 Launch" is "projects/q3-launch"), as Obsidian reads them.
+func slugTag(tag string) string {
+	var levels []string
+	for _, level := range strings.Split(tag, "/") {
+		words := strings.FieldsFunc(strings.ToLower(level), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) > 0 {
+			levels = append(levels, strings.Join(words, "-"))
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// normalizeTags gives a capture's tags a consistent taxonomy: each tag is renamed
+// through the caller's aliases (matched on canonical form; an alias to "" drops the
+// tag), slugified, deduplicated and capped at TAG_MAX_COUNT, keeping the first ones
+func normalizeTags(tags []string, aliases map[string]string) []string {
+	if tags == nil {
+		return nil
+	}
+	limit := tagMaxCount()
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		if alias, ok := aliases[canonicalTag(tag)]; ok {
+			tag = alias
+		}
+		tag = slugTag(tag)
+		key := canonicalTag(tag)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, tag)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+// normalizeTagAliases validates an alias table (tag -> replacement), keying it by
+// canonical form and slugifying the replacements; an empty replacement drops the tag
+func normalizeTagAliases(aliases map[string]string) (map[string]string, error) {
+	if len(aliases) > maxTagAliases {
+		return nil, fmt.Errorf("tagAliases cannot have more than %d entries", maxTagAliases)
+	}
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(aliases))
+	for from, to := range aliases {
+		key := canonicalTag(from)
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag alias %q", from)
+		}
+		slug := slugTag(to)
+		if slug == "" && strings.TrimSpace(to) != "" {
+			return nil, fmt.Errorf("invalid replacement %q for tag alias %q", to, from)
+		}
+		out[key] = slug
+	}
+	return out, nil
+}
+
+// tagAliases returns the caller's alias table, if their preferences were loaded
+func tagAliases(prefs *Preferences) map[string]string {
+	if prefs == nil {
+		return nil
+	}
+	return prefs.TagAliases
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalTag(t *testing.T) {
+	for _, tag := range []string{"todo", "To-Do", "to do", " TODO! "} {
+		if got := canonicalTag(tag); got != "todo" {
+			t.Errorf("canonicalTag(%q) = %q, want todo", tag, got)
+		}
+	}
+}
+
+func TestLoadTopTags(t *testing.T) {
+	store := &fakeDynamo{}
+	useFakeDynamo(t, store)
+	ctx := context.Background()
+	put := func(principal string, i int, tags ...string) {
+		item := map[string]interface{}{"pk": historyPK(principal), "sk": fmt.Sprintf("%s%04d", captureSKPrefix, i)}
+		var list []interface{}
+		for _, tag := range tags {
+			list = append(list, tag)
+		}
+		item["tags"] = list
+		store.items = append(store.items, item)
+	}
+	put("user-1", 1, "work", "to-do")
+	put("user-1", 2, "Work", "todo", "health")
+	put("user-1", 3, "work", "todo")
+	put("user-2", 4, "travel", "travel", "travel")
+
+	tags, err := loadTopTags(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("loadTopTags() error = %v", err)
+	}
+	if strings.Join(tags, "|") != "todo|work|health" {
+		t.Errorf("loadTopTags() = %q, want [todo work health]", tags)
+	}
+
+	t.Run("only recent captures count", func(t *testing.T) {
+		put("user-3", 0, "ancient")
+		for i := 1; i <= tagHistoryCaptures; i++ {
+			put("user-3", i, "recent")
+		}
+		tags, _ := loadTopTags(ctx, "user-3")
+		if strings.Join(tags, "|") != "recent" {
+			t.Errorf("loadTopTags() = %q, want [recent]", tags)
+		}
+	})
+}
+
+func TestRequestTags(t *testing.T) {
+	if got := requestTags(context.Background(), "user-1"); got != nil {
+		t.Errorf("requestTags() without a table = %v, want nil", got)
+	}
+	useFakeDynamo(t, &fakeDynamo{err: errors.New("table down")})
+	if got := requestTags(context.Background(), "user-1"); got != nil {
+		t.Errorf("requestTags() on storage errors = %v, want nil", got)
+	}
+}
+
+func TestTagPrompt(t *testing.T) {
+	if got := tagPrompt(nil); got != "" {
+		t.Errorf("tagPrompt(nil) = %q, want empty", got)
+	}
+	if got := tagPrompt([]string{"work", "todo"}); !strings.Contains(got, "Preferred tags") || !strings.Contains(got, "\n- work\n- todo") {
+		t.Errorf("tagPrompt() = %q", got)
+	}
+}
+
+func TestPreferTags(t *testing.T) {
+	got := preferTags([]string{"To-Do", "todo", "groceries", "WORK", "!!"}, []string{"todo", "work"})
+	if strings.Join(got, "|") != "todo|groceries|work" {
+		t.Errorf("preferTags() = %q, want [todo groceries work]", got)
+	}
+	if got := preferTags(nil, []string{"todo"}); got != nil {
+		t.Errorf("preferTags(nil) = %v, want nil", got)
+	}
+}
+
+func TestSlugTag(t *testing.T) {
+	tests := map[string]string{
+		"Work Travel!":         "work-travel",
+		"  to_do ":             "to-do",
+		"Projects / Q3 Launch": "projects/q3-launch",
+		"Café":                 "café",
+		"#urgent":              "urgent",
+		"//":                   "",
+		"日本 旅行":                "日本-旅行",
+	}
+	for in, want := range tests {
+		if got := slugTag(in); got != want {
+			t.Errorf("slugTag(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	aliases := map[string]string{"todo": "tasks", "misc": ""}
+	got := normalizeTags([]string{"To-Do", "Tasks", "Misc", "Work Travel", "work_travel", "!!", "Home"}, aliases)
+	if strings.Join(got, "|") != "tasks|work-travel|home" {
+		t.Errorf("normalizeTags() = %q, want [tasks work-travel home]", got)
+	}
+
+	t.Setenv("TAG_MAX_COUNT", "2")
+	if got := normalizeTags([]string{"a", "b", "c"}, nil); strings.Join(got, "|") != "a|b" {
+		t.Errorf("normalizeTags() with TAG_MAX_COUNT=2 = %q, want [a b]", got)
+	}
+	if got := normalizeTags(nil, aliases); got != nil {
+		t.Errorf("normalizeTags(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"wrist-agent/apierror"
+)
+
+// Telegram bot adapter: Telegram POSTs updates to /telegram (set with setWebhook and a
+// secret_token), each text message runs through the invoke pipeline, and the reply is
+// sent back as the webhook response, so no bot token is needed.
+const (
+	telegramSecretHeader   = "X-Telegram-Bot-Api-Secret-Token"
+	telegramMaxMessageText = 4096 // Telegram's limit on a message's text, in characters
+	telegramUpdateTTL      = 24 * time.Hour
+)
+
+// telegramCommandAliases are chat commands besides the mode names, e.g. "/remind"
+var telegramCommandAliases = map[string]string{
+	"remind": "reminder",
+	"buy":    "shopping",
+	"ask":    "question",
+	"tldr":   "summarize",
+}
+
+// telegramUpdate is the part of a Telegram Update the adapter reads
+type telegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// telegramReply is a sendMessage call made by answering the webhook
+type telegramReply struct {
+	Method             string                 `json:"method"`
+	ChatID             int64                  `json:"chat_id"`
+	Text               string                 `json:"text"`
+	ParseMode          string                 `json:"parse_mode,omitempty"`
+	ReplyParameters    map[string]interface{} `json:"reply_parameters,omitempty"`
+	LinkPreviewOptions map[string]bool        `json:"link_preview_options"`
+}
+
+// isTelegramRequest reports whether the route is the Telegram webhook
+func isTelegramRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/telegram"
+}
+
+// handleTelegram serves the Telegram webhook. The route has no API Gateway authorizer:
+// Telegram proves itself with the secret token from TELEGRAM_SECRET_PARAM_NAME, and only
+// chats listed in TELEGRAM_CHATS are answered. Anything the bot doesn't act on still
+// gets a 200, or Telegram would keep redelivering it.
+func handleTelegram(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "POST" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	secretParam := os.Getenv("TELEGRAM_SECRET_PARAM_NAME")
+	if secretParam == "" {
+		return errorResponse(ctx, apierror.NotFound("Telegram bot is not configured"))
+	}
+	secret, err := getParameter(ctx, secretParam)
+	if err != nil {
+		log.Printf("Failed to load Telegram secret: %v", err)
+		return errorResponse(ctx, apierror.Internal("Telegram secret unavailable"))
+	}
+	if subtle.ConstantTimeCompare([]byte(requestHeader(event, telegramSecretHeader)), []byte(secret)) != 1 {
+		return errorResponse(ctx, apierror.New(401, apierror.CodeUnauthorized, "Invalid Telegram secret token"))
+	}
+
+	var update telegramUpdate
+	if err := json.Unmarshal([]byte(event.Body), &update); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	msg := update.Message
+	if msg == nil {
+		// Edits, reactions and other update types
+		return telegramAck()
+	}
+	principal, ok := telegramChats()[msg.Chat.ID]
+	if !ok {
+		log.Printf("Telegram message from unlisted chat %d ignored", msg.Chat.ID)
+		return telegramAck()
+	}
+	if strings.TrimSpace(msg.Text) == "" {
+		return telegramAnswer(msg, "Send me a text message.", "")
+	}
+
+	// Telegram redelivers updates it didn't see answered in time
+	fresh, err := rememberNonce(ctx, principal, "telegram-"+strconv.FormatInt(update.UpdateID, 10), time.Now(), time.Now().Add(telegramUpdateTTL))
+	if err != nil {
+		log.Printf("Failed to record Telegram update %d: %v", update.UpdateID, err)
+	} else if !fresh {
+		return telegramAck()
+	}
+
+	mode, text, ok := telegramCommand(msg.Text)
+	if !ok {
+		return telegramAnswer(msg, telegramHelp(), "")
+	}
+	if mode == "" {
+		mode = inferMode(text)
+	}
+	result := runCapture(ctx, CaptureRequest{
+		Source:    "telegram",
+		RequestID: event.RequestContext.RequestID,
+		Caller:    principalCaller(principal),
+		Fields: map[string]interface{}{
+			"text":           text,
+			"mode":           mode,
+			"conversationId": "telegram-" + strconv.FormatInt(msg.Chat.ID, 10),
+		},
+	})
+	if result.Status >= 300 {
+		return telegramAnswer(msg, "⚠️ "+result.Error, "")
+	}
+	if result.Response == nil {
+		return telegramAnswer(msg, "⚠️ Something went wrong. Please try again.", "")
+	}
+	resp := *result.Response
+	if text := telegramHTML(resp); len([]rune(text)) <= telegramMaxMessageText {
+		return telegramAnswer(msg, text, "HTML")
+	}
+	// Cutting HTML could leave a tag open, so long replies go as plain text
+	return telegramAnswer(msg, truncateRunes(resp.Title+"\n\n"+plainText(resp.Markdown), telegramMaxMessageText), "")
+}
+
+// telegramChats reads TELEGRAM_CHATS, a comma-separated list of chat IDs allowed to use
+// the bot, each optionally "=principal" to share that principal's history and settings;
+// others get the principal "telegram-<chat ID>"
+func telegramChats() map[int64]string {
+	chats := map[int64]string{}
+	for _, entry := range strings.Split(os.Getenv("TELEGRAM_CHATS"), ",") {
+		id, principal, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		chatID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			continue
+		}
+		if principal = strings.TrimSpace(principal); principal == "" {
+			principal = "telegram-" + strconv.FormatInt(chatID, 10)
+		}
+		chats[chatID] = principal
+	}
+	return chats
+}
+
+// telegramCommand splits a leading "/mode" command (or an alias, optionally addressed
+// as "/mode@BotName") from a message. Other commands, like /start and /help, aren't ok.
+func telegramCommand(text string) (mode, rest string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", text, true
+	}
+	command, rest, _ := strings.Cut(text[1:], " ")
+	command, _, _ = strings.Cut(strings.ToLower(command), "@")
+	if alias, found := telegramCommandAliases[command]; found {
+		command = alias
+	}
+	if _, found := lookupMode(command); !found || strings.TrimSpace(rest) == "" {
+		return "", "", false
+	}
+	return command, strings.TrimSpace(rest), true
+}
+
+// telegramHelp lists the bot's commands
+func telegramHelp() string {
+	var b strings.Builder
+	b.WriteString("Send a message and I'll pick the mode, or start it with a command:\n")
+	for _, mode := range modes {
+		fmt.Fprintf(&b, "\n/%s - %s", mode.Name, mode.Description)
+	}
+	return b.String()
+}
+
+// telegramHTML renders a response in Telegram's HTML subset: the title in bold, the
+// markdown's lines with their inline formatting, then the due date and tags
+func telegramHTML(resp Response) string {
+	var b strings.Builder
+	b.WriteString("<b>" + html.EscapeString(resp.Title) + "</b>\n\n")
+
+	lines := strings.Split(strings.ReplaceAll(resp.Markdown, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre>" + html.EscapeString(strings.Join(code, "\n")) + "</pre>\n")
+		case strings.HasPrefix(trimmed, "#"):
+			b.WriteString("<b>" + inlineHTML(strings.TrimSpace(strings.TrimLeft(trimmed, "#"))) + "</b>\n")
+		case trimmed == "---" || trimmed == "***":
+			b.WriteString("\n")
+		case strings.HasPrefix(trimmed, "- [ ] "):
+			b.WriteString("☐ " + inlineHTML(trimmed[6:]) + "\n")
+		case strings.HasPrefix(trimmed, "- [x] ") || strings.HasPrefix(trimmed, "- [X] "):
+			b.WriteString("☑ " + inlineHTML(trimmed[6:]) + "\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			b.WriteString("• " + inlineHTML(trimmed[2:]) + "\n")
+		case strings.HasPrefix(trimmed, ">"):
+			b.WriteString("<blockquote>" + inlineHTML(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		default:
+			b.WriteString(inlineHTML(trimmed) + "\n")
+		}
+	}
+
+	var details []string
+	if resp.DueISO != nil && *resp.DueISO != "" {
+		details = append(details, "⏰ Due "+html.EscapeString(*resp.DueISO))
+	}
+	if resp.StartISO != nil && *resp.StartISO != "" {
+		details = append(details, "📅 "+html.EscapeString(*resp.StartISO))
+	}
+	if len(resp.Tags) > 0 {
+		details = append(details, html.EscapeString("#"+strings.Join(resp.Tags, " #")))
+	}
+	if len(details) > 0 {
+		b.WriteString("\n" + strings.Join(details, "\n"))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// telegramAnswer answers the webhook with a sendMessage replying to msg
+func telegramAnswer(msg *telegramMessage, text, parseMode string) events.APIGatewayProxyResponse {
+	return apiResponse(200, telegramReply{
+		Method:             "sendMessage",
+		ChatID:             msg.Chat.ID,
+		Text:               text,
+		ParseMode:          parseMode,
+		ReplyParameters:    map[string]interface{}{"message_id": msg.MessageID, "allow_sending_without_reply": true},
+		LinkPreviewOptions: map[string]bool{"is_disabled": true},
+	})
+}
+
+// telegramAck answers the webhook without replying
+func telegramAck() events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: map[string]string{}}
+}
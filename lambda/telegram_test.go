@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// telegramEvent builds a webhook delivery of a text message from chat 42
+func telegramEvent(updateID int, text, secret string) events.APIGatewayProxyRequest {
+	body, _ := json.Marshal(map[string]interface{}{
+		"update_id": updateID,
+		"message":   map[string]interface{}{"message_id": 7, "chat": map[string]int{"id": 42}, "text": text},
+	})
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Resource:   "/telegram",
+		Headers:    map[string]string{"X-Telegram-Bot-Api-Secret-Token": secret},
+		Body:       string(body),
+	}
+}
+
+// useTelegram configures the bot's secret and allows chat 42 as user-123
+func useTelegram(t *testing.T) {
+	t.Helper()
+	useFakeSSM(t, &fakeSSM{values: map[string]string{"/wrist-agent/telegram-secret": "hook-secret"}})
+	t.Setenv("TELEGRAM_SECRET_PARAM_NAME", "/wrist-agent/telegram-secret")
+	t.Setenv("TELEGRAM_CHATS", "42=user-123, 99")
+}
+
+func TestTelegramCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantMode string
+		wantRest string
+		wantOK   bool
+	}{
+		{"buy milk", "", "buy milk", true},
+		{"/reminder call mom at 5", "reminder", "call mom at 5", true},
+		{"/remind@WristAgentBot call mom", "reminder", "call mom", true},
+		{"/Translate hola", "translate", "hola", true},
+		{"/start", "", "", false},
+		{"/note", "", "", false},
+		{"/poem roses", "", "", false},
+	}
+	for _, tt := range tests {
+		mode, rest, ok := telegramCommand(tt.text)
+		if mode != tt.wantMode || rest != tt.wantRest || ok != tt.wantOK {
+			t.Errorf("telegramCommand(%q) = %q, %q, %v", tt.text, mode, rest, ok)
+		}
+	}
+}
+
+func TestTelegramChats(t *testing.T) {
+	t.Setenv("TELEGRAM_CHATS", "42=user-123, -1001, nope,")
+	chats := telegramChats()
+	if len(chats) != 2 || chats[42] != "user-123" || chats[-1001] != "telegram--1001" {
+		t.Errorf("Unexpected chats: %v", chats)
+	}
+}
+
+func TestTelegramHTML(t *testing.T) {
+	due := "2025-03-01T17:00:00Z"
+	got := telegramHTML(Response{
+		Title:    "Call <Mom>",
+		Markdown: "## Why\n- **Birthday** plans\n- [ ] book [table](https://example.com)\n> soon",
+		DueISO:   &due,
+		Tags:     []string{"family", "calls"},
+	})
+	want := "<b>Call &lt;Mom&gt;</b>\n\n<b>Why</b>\n• <strong>Birthday</strong> plans\n☐ book <a href=\"https://example.com\">table</a>\n" +
+		"<blockquote>soon</blockquote>\n\n⏰ Due 2025-03-01T17:00:00Z\n#family #calls"
+	if got != want {
+		t.Errorf("telegramHTML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHandler_Telegram(t *testing.T) {
+	useTelegram(t)
+	model := &fakeBedrock{text: `{"action":"reminder","title":"Call Mom","markdown":"Call **Mom** at 5","shortText":"Call Mom"}`}
+	useFakeBedrock(t, model)
+
+	resp, _ := handler(context.Background(), telegramEvent(1, "Remind me to call mom at 5", "hook-secret"))
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	var reply telegramReply
+	json.Unmarshal([]byte(resp.Body), &reply)
+	if reply.Method != "sendMessage" || reply.ChatID != 42 || reply.ParseMode != "HTML" || reply.Text != "<b>Call Mom</b>\n\nCall <strong>Mom</strong> at 5" {
+		t.Errorf("Unexpected reply: %+v", reply)
+	}
+	if !strings.Contains(string(model.body), "reminder") {
+		t.Errorf("Expected the inferred reminder mode in the prompt")
+	}
+
+	// A redelivered update is acknowledged without running again
+	model.body = nil
+	resp, _ = handler(context.Background(), telegramEvent(1, "Remind me to call mom at 5", "hook-secret"))
+	if resp.StatusCode != 200 || resp.Body != "" || model.body != nil {
+		t.Errorf("Expected a redelivery to be acknowledged only, got %d %q", resp.StatusCode, resp.Body)
+	}
+
+	// Unknown commands get the help text
+	resp, _ = handler(context.Background(), telegramEvent(2, "/start", "hook-secret"))
+	reply = telegramReply{}
+	json.Unmarshal([]byte(resp.Body), &reply)
+	if !strings.Contains(reply.Text, "/reminder - ") || reply.ParseMode != "" {
+		t.Errorf("Expected the help text, got %+v", reply)
+	}
+
+	// Validation errors are replied as text
+	resp, _ = handler(context.Background(), telegramEvent(3, "/translate "+strings.Repeat("x", 9000), "hook-secret"))
+	reply = telegramReply{}
+	json.Unmarshal([]byte(resp.Body), &reply)
+	if resp.StatusCode != 200 || !strings.HasPrefix(reply.Text, "⚠️ ") {
+		t.Errorf("Expected an error reply, got %d %+v", resp.StatusCode, reply)
+	}
+}
+
+func TestHandler_TelegramRejected(t *testing.T) {
+	t.Setenv("TELEGRAM_SECRET_PARAM_NAME", "")
+	if resp, _ := handler(context.Background(), telegramEvent(1, "hi", "")); resp.StatusCode != 404 {
+		t.Errorf("Expected 404 when the bot isn't configured, got %d", resp.StatusCode)
+	}
+
+	useTelegram(t)
+	if resp, _ := handler(context.Background(), telegramEvent(1, "hi", "wrong")); resp.StatusCode != 401 {
+		t.Errorf("Expected 401 for a wrong secret, got %d", resp.StatusCode)
+	}
+
+	// Unlisted chats are acknowledged but not answered
+	event := telegramEvent(1, "hi", "hook-secret")
+	event.Body = strings.Replace(event.Body, `"id":42`, `"id":7`, 1)
+	if resp, _ := handler(context.Background(), event); resp.StatusCode != 200 || resp.Body != "" {
+		t.Errorf("Expected an unlisted chat to be ignored, got %d %q", resp.StatusCode, resp.Body)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Tenants let one deployment serve a family or small team. The owner gives a registered
+// token a tenantId through the admin API and the authorizer passes it in the policy
+// context. The handler then qualifies the token's principal with the tenant
+// ("<tenant>/<principal>"), so history, preferences and usage counters are all keyed
+// under the tenant. A tenant's admins only see and manage their own tenant's tokens.
+const tenantSeparator = "/"
+
+// validTenant matches tenant IDs: short lowercase slugs such as "smith-family"
+var validTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// tenantFromEvent returns the tenant ID set by the Lambda Authorizer, or "" for tokens
+// that don't belong to a tenant (including the owner's SSM token)
+func tenantFromEvent(event events.APIGatewayProxyRequest) string {
+	tenant, _ := event.RequestContext.Authorizer["tenantId"].(string)
+	return tenant
+}
+
+// tenantPrincipal qualifies a principal with its tenant; principals without a tenant are
+// left as they are, so single-user deployments keep their existing keys
+func tenantPrincipal(tenant, principal string) string {
+	if tenant == "" {
+		return principal
+	}
+	return tenant + tenantSeparator + principal
+}
+
+// splitPrincipal splits a qualified principal into its tenant ("" for none) and ID
+func splitPrincipal(principal string) (tenant, id string) {
+	if tenant, id, ok := strings.Cut(principal, tenantSeparator); ok {
+		return tenant, id
+	}
+	return "", principal
+}
+
+// tenantSpendPK returns the partition key of a tenant's spend counters
+func tenantSpendPK(tenant string) string {
+	return globalSpendPK + "#TENANT#" + tenant
+}
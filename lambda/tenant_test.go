@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestPrincipalFromEvent_Tenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		want       string
+		wantPK     string
+	}{
+		{name: "owner device", authorizer: map[string]interface{}{"principalId": "user-abc"}, want: "user-abc", wantPK: "USER#user-abc"},
+		{name: "tenant device", authorizer: map[string]interface{}{"principalId": "user-abc", "tenantId": "smith-family"}, want: "smith-family/user-abc", wantPK: "TENANT#smith-family#USER#user-abc"},
+		{name: "anonymous", authorizer: nil, want: "anonymous", wantPK: "USER#anonymous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{}
+			event.RequestContext.Authorizer = tt.authorizer
+			got := principalFromEvent(event)
+			if got != tt.want || historyPK(got) != tt.wantPK {
+				t.Errorf("principalFromEvent() = %q (pk %q), want %q (pk %q)", got, historyPK(got), tt.want, tt.wantPK)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKey_Tenant(t *testing.T) {
+	req := &Req{Text: "What is the boiling point of water?", Mode: "question", MaxTokens: 800}
+	untenanted := responseCacheKey(req, nil)
+	req.tenant = "smith-family"
+	if responseCacheKey(req, nil) == untenanted {
+		t.Error("tenants must not share cached replies")
+	}
+}
+
+func TestHandler_TenantPreferences(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+
+	event := events.APIGatewayProxyRequest{HTTPMethod: "PUT", Resource: "/preferences", Body: `{"name":"Ana"}`}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-abc", "tenantId": "smith-family"}
+	resp, _ := handler(context.Background(), event)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if len(db.items) != 1 || db.items[0]["pk"] != "TENANT#smith-family#USER#user-abc" {
+		t.Errorf("Expected preferences stored under the tenant, got %v", db.items)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Thinking policies: thinkingTokens as sent (the default), or a budget picked per request
+const thinkingPolicyAuto = "auto"
+
+// Auto budgets grow by the mode's base for every autoThinkingCharsPerStep characters of
+// input, up to autoThinkingMaxScale times the base, rounded down to whole
+// autoThinkingRounding blocks (Claude's minimum thinking budget)
+const (
+	autoThinkingCharsPerStep = 4000
+	autoThinkingMaxScale     = 4
+	autoThinkingRounding     = 1024
+)
+
+// autoThinkingTokens scales a mode's AutoThinkingTokens by the length of the text. Modes
+// without a base (e.g. note) get none however long the text is.
+func autoThinkingTokens(mode ModeInfo, text string) int {
+	if mode.AutoThinkingTokens == 0 {
+		return 0
+	}
+	scale := min(1+float64(utf8.RuneCountInString(text))/autoThinkingCharsPerStep, autoThinkingMaxScale)
+	tokens := int(float64(mode.AutoThinkingTokens) * scale)
+	return tokens / autoThinkingRounding * autoThinkingRounding
+}
+
+// resolveThinkingPolicy sets thinkingTokens for thinkingPolicy auto. The budget is capped
+// quietly at what the cost class, the token's tier and the model allow, since the client
+// didn't ask for a number; it is echoed in the response's thinkingTokens.
+func resolveThinkingPolicy(req *Req, mode ModeInfo) error {
+	switch req.ThinkingPolicy {
+	case "":
+		return nil
+	case thinkingPolicyAuto:
+	default:
+		return fmt.Errorf("invalid thinkingPolicy: %s (valid: %s)", req.ThinkingPolicy, thinkingPolicyAuto)
+	}
+	if req.ThinkingTokens != 0 {
+		return fmt.Errorf("thinkingTokens can't be combined with thinkingPolicy %s", thinkingPolicyAuto)
+	}
+
+	if !supportsThinking(requestModel(req)) {
+		return nil
+	}
+	tokens := min(autoThinkingTokens(mode, req.Text), costClassThinkingTokens[req.CostClass])
+	if tier := req.scopes.tier(); tier != "" {
+		limits, ok := tierLimits[tier]
+		if !ok {
+			limits = tierLimits["low"]
+		}
+		tokens = min(tokens, limits.thinkingTokens)
+	}
+	req.ThinkingTokens = tokens
+	return nil
+}
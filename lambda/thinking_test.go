@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAutoThinkingTokens(t *testing.T) {
+	deepthink, _ := lookupMode("deepthink")
+	note, _ := lookupMode("note")
+	tests := []struct {
+		name string
+		mode ModeInfo
+		text string
+		want int
+	}{
+		{"note stays off", note, strings.Repeat("x", 20000), 0},
+		{"short deepthink", deepthink, "Should I move?", 16384},
+		{"longer deepthink", deepthink, strings.Repeat("x", 4000), 32768},
+		{"capped at 4x", deepthink, strings.Repeat("x", 40000), 65536},
+		{"rounded down to 1024", deepthink, strings.Repeat("x", 1000), 20480},
+	}
+	for _, tt := range tests {
+		if got := autoThinkingTokens(tt.mode, tt.text); got != tt.want {
+			t.Errorf("%s: autoThinkingTokens = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveThinkingPolicy(t *testing.T) {
+	deepthink, _ := lookupMode("deepthink")
+
+	req := Req{Text: "Should I move?", Mode: "deepthink", ThinkingPolicy: "auto", CostClass: "premium"}
+	if err := resolveThinkingPolicy(&req, deepthink); err != nil || req.ThinkingTokens != 16384 {
+		t.Errorf("premium: got %d, %v", req.ThinkingTokens, err)
+	}
+
+	// Capped by the cost class and the tier without warnings
+	req = Req{Text: strings.Repeat("x", 40000), Mode: "deepthink", ThinkingPolicy: "auto", CostClass: "standard"}
+	if err := resolveThinkingPolicy(&req, deepthink); err != nil || req.ThinkingTokens != 16384 || len(req.warnings) != 0 {
+		t.Errorf("standard: got %d, %v, warnings %q", req.ThinkingTokens, err, req.warnings)
+	}
+	req = Req{Text: "Should I move?", Mode: "deepthink", ThinkingPolicy: "auto", CostClass: "premium", scopes: tokenScopes{"tier:standard"}}
+	if err := resolveThinkingPolicy(&req, deepthink); err != nil || req.ThinkingTokens != 4000 {
+		t.Errorf("tier:standard: got %d, %v", req.ThinkingTokens, err)
+	}
+
+	// Models without extended thinking get none
+	req = Req{Text: "Should I move?", Mode: "deepthink", ThinkingPolicy: "auto", CostClass: "premium", model: "amazon.nova-pro-v1:0"}
+	if err := resolveThinkingPolicy(&req, deepthink); err != nil || req.ThinkingTokens != 0 {
+		t.Errorf("nova: got %d, %v", req.ThinkingTokens, err)
+	}
+
+	for _, req := range []Req{
+		{ThinkingPolicy: "max"},
+		{ThinkingPolicy: "auto", ThinkingTokens: 2000},
+	} {
+		if err := resolveThinkingPolicy(&req, deepthink); err == nil {
+			t.Errorf("resolveThinkingPolicy(%+v) succeeded, want an error", req)
+		}
+	}
+}
+
+func TestHandler_AutoThinkingEcho(t *testing.T) {
+	t.Setenv("SINKS_PARAM_NAME", "")
+	t.Setenv("SINKS", `{"*":["ok"]}`)
+	useSinks(t, &stubSink{name: "ok"})
+	useFakeBedrock(t, &fakeBedrock{text: `{"action":"note","title":"Move","markdown":"Stay"}`})
+
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Resource:   "/",
+		Body:       `{"text": "Should I move?", "mode": "note", "thinkingPolicy": "auto"}`,
+	})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("status %d, err %v: %s", resp.StatusCode, err, resp.Body)
+	}
+	var body map[string]interface{}
+	json.Unmarshal([]byte(resp.Body), &body)
+	if body["thinkingTokens"] != 0.0 {
+		t.Errorf("thinkingTokens = %v, want 0 echoed", body["thinkingTokens"])
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Timers run for at most a day, the longest the Clock app accepts; labels are cut to fit
+// the timer's title
+const (
+	maxTimerSeconds    = 24 * 60 * 60
+	maxTimerLabelRunes = 40
+)
+
+// Timer is the countdown extracted in timer mode, in both forms a Shortcut can start
+// a native timer with
+type Timer struct {
+	Seconds  int    `json:"seconds"`
+	Duration string `json:"duration"`        // ISO 8601 duration, e.g. PT1H30M
+	Label    string `json:"label,omitempty"` // what the timer is for, e.g. "Pasta"
+}
+
+var (
+	isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+	// spokenDurationPart is one "25 minutes", "1.5 hours" or "90s" in a request
+	spokenDurationPart = regexp.MustCompile(`(?i)\b(\d+(?:[.,]\d+)?|an?|half an?)[\s-]*(hours?|hrs?|h|minutes?|mins?|m|seconds?|secs?|s)\b(\s+and\s+a\s+half)?`)
+)
+
+// durationUnits are the seconds in each unit spokenDurationPart recognises
+var durationUnits = map[string]int{
+	"hour": 3600, "hours": 3600, "hr": 3600, "hrs": 3600, "h": 3600,
+	"minute": 60, "minutes": 60, "min": 60, "mins": 60, "m": 60,
+	"second": 1, "seconds": 1, "sec": 1, "secs": 1, "s": 1,
+}
+
+// parseISODuration returns the seconds in an ISO 8601 duration made of days, hours,
+// minutes and seconds (years, months and weeks are no use for a timer), rounding
+// fractional seconds
+func parseISODuration(duration string) (int, bool) {
+	duration = strings.ToUpper(strings.TrimSpace(duration))
+	match := isoDuration.FindStringSubmatch(duration)
+	if match == nil || duration == "P" || strings.HasSuffix(duration, "T") {
+		return 0, false
+	}
+	seconds := 0
+	for i, unit := range []int{86400, 3600, 60} {
+		if match[i+1] != "" {
+			n, err := strconv.Atoi(match[i+1])
+			if err != nil {
+				return 0, false
+			}
+			seconds += n * unit
+		}
+	}
+	if match[4] != "" {
+		s, err := strconv.ParseFloat(strings.Replace(match[4], ",", ".", 1), 64)
+		if err != nil {
+			return 0, false
+		}
+		seconds += int(s + 0.5)
+	}
+	return seconds, true
+}
+
+// formatISODuration writes seconds as an ISO 8601 duration in hours, minutes and
+// seconds, e.g. 5400 is PT1H30M
+func formatISODuration(seconds int) string {
+	if seconds <= 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	b.WriteString("PT")
+	if h := seconds / 3600; h > 0 {
+		fmt.Fprintf(&b, "%dH", h)
+	}
+	if m := seconds % 3600 / 60; m > 0 {
+		fmt.Fprintf(&b, "%dM", m)
+	}
+	if s := seconds % 60; s > 0 {
+		fmt.Fprintf(&b, "%dS", s)
+	}
+	return b.String()
+}
+
+// parseSpokenDuration adds up the durations written in a request, so "1 hour and 30
+// minutes", "an hour and a half" and "90s" all read as 5400, 5400 and 90 seconds
+func parseSpokenDuration(text string) (int, bool) {
+	total, found := 0.0, false
+	for _, match := range spokenDurationPart.FindAllStringSubmatch(text, -1) {
+		amount, unit := strings.ToLower(match[1]), strings.ToLower(match[2])
+		if (amount[0] == 'a' || amount[0] == 'h') && (len(unit) == 1 || durationUnits[unit] == 1) {
+			continue // "a second timer" isn't one second long
+		}
+		var n float64
+		switch {
+		case amount == "a" || amount == "an":
+			n = 1
+		case strings.HasPrefix(amount, "half"):
+			n = 0.5
+		default:
+			var err error
+			if n, err = strconv.ParseFloat(strings.Replace(amount, ",", ".", 1), 64); err != nil {
+				continue
+			}
+		}
+		if match[3] != "" {
+			n += 0.5
+		}
+		total += n * float64(durationUnits[unit])
+		found = true
+	}
+	return int(total + 0.5), found
+}
+
+// finalizeTimer settles the timer's duration. The request's own words decide it when
+// they name one, so "25 minutes" is always 1500 seconds; otherwise the model's ISO 8601
+// duration is used (it reads spelled-out numbers and other languages). A timer with no
+// usable duration keeps 0 seconds and gets a warning, so the Shortcut can ask.
+func finalizeTimer(req *Req, resp *Response) {
+	if resp.Timer == nil {
+		resp.Timer = &Timer{}
+	}
+	resp.Action = "timer"
+
+	timer := resp.Timer
+	seconds, ok := parseSpokenDuration(req.Text)
+	if !ok || seconds <= 0 {
+		seconds, ok = parseISODuration(timer.Duration)
+	}
+	if !ok || seconds <= 0 || seconds > maxTimerSeconds {
+		seconds = 0
+		resp.Warnings = append(resp.Warnings, "no timer duration between 1 second and 24 hours was found")
+	}
+	timer.Seconds = seconds
+	timer.Duration = formatISODuration(seconds)
+
+	timer.Label = truncateRunes(strings.Join(strings.Fields(timer.Label), " "), maxTimerLabelRunes)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   int
+		wantOK bool
+	}{
+		{"PT25M", 1500, true},
+		{"pt1h30m", 5400, true},
+		{"PT45S", 45, true},
+		{"PT1.6S", 2, true},
+		{"P1D", 86400, true},
+		{"P1DT2H", 93600, true},
+		{"PT0S", 0, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1W", 0, false},
+		{"P1M", 0, false},
+		{"25 minutes", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseISODuration(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseISODuration(%q) = %d, %v, want %d, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFormatISODuration(t *testing.T) {
+	tests := map[int]string{0: "PT0S", 45: "PT45S", 1500: "PT25M", 5400: "PT1H30M", 3661: "PT1H1M1S", 86400: "PT24H"}
+	for seconds, want := range tests {
+		if got := formatISODuration(seconds); got != want {
+			t.Errorf("formatISODuration(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestParseSpokenDuration(t *testing.T) {
+	tests := []struct {
+		text   string
+		want   int
+		wantOK bool
+	}{
+		{"set a timer for 25 minutes", 1500, true},
+		{"Set a 10-minute timer for the pasta", 600, true},
+		{"1 hour and 30 minutes", 5400, true},
+		{"an hour and a half", 5400, true},
+		{"half an hour", 1800, true},
+		{"timer 90s", 90, true},
+		{"1.5 hrs", 5400, true},
+		{"2h 15m", 8100, true},
+		{"a minute", 60, true},
+		{"set a second timer for 5 min", 300, true},
+		{"pasta timer", 0, false},
+		{"un minuto", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSpokenDuration(tt.text)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseSpokenDuration(%q) = %d, %v, want %d, %v", tt.text, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFinalizeTimer(t *testing.T) {
+	// The request's words win over the model's arithmetic
+	resp := &Response{Action: "note", Timer: &Timer{Duration: "PT20M", Label: "  Pasta\n"}}
+	finalizeTimer(&Req{Text: "Set a timer for 25 minutes for the pasta"}, resp)
+	if resp.Action != "timer" || resp.Timer.Seconds != 1500 || resp.Timer.Duration != "PT25M" || resp.Timer.Label != "Pasta" || len(resp.Warnings) != 0 {
+		t.Errorf("finalizeTimer() = %s %+v %v", resp.Action, *resp.Timer, resp.Warnings)
+	}
+
+	// Spelled-out durations fall back to the model's
+	resp = &Response{Timer: &Timer{Duration: "PT1H30M", Label: strings.Repeat("x", 50)}}
+	finalizeTimer(&Req{Text: "un temporizador de noventa minutos"}, resp)
+	if resp.Timer.Seconds != 5400 || resp.Timer.Duration != "PT1H30M" || len([]rune(resp.Timer.Label)) != maxTimerLabelRunes {
+		t.Errorf("finalizeTimer() = %+v", *resp.Timer)
+	}
+
+	for _, tt := range []struct {
+		text  string
+		timer *Timer
+	}{
+		{"timer please", nil},
+		{"timer please", &Timer{Duration: "soon"}},
+		{"set a timer for 30 hours", &Timer{Duration: "PT30H"}},
+	} {
+		resp := &Response{Timer: tt.timer}
+		finalizeTimer(&Req{Text: tt.text}, resp)
+		if resp.Timer == nil || resp.Timer.Seconds != 0 || resp.Timer.Duration != "PT0S" || len(resp.Warnings) != 1 {
+			t.Errorf("finalizeTimer(%q) = %+v %v, want 0 seconds and a warning", tt.text, resp.Timer, resp.Warnings)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Longest accepted titleHint, in characters
+const maxTitleHintChars = 200
+
+// validateTitleHint checks a request's titleHint and folds it onto one line
+func validateTitleHint(req *Req) error {
+	req.TitleHint = strings.Join(strings.Fields(req.TitleHint), " ")
+	if utf8.RuneCountInString(req.TitleHint) > maxTitleHintChars {
+		return fmt.Errorf("titleHint cannot exceed %d characters", maxTitleHintChars)
+	}
+	return nil
+}
+
+// titleHintPrompt passes the caller's suggested title to the model, which keeps it unless
+// the text calls for a clearer one
+func titleHintPrompt(req *Req) string {
+	if req.TitleHint == "" {
+		return ""
+	}
+	return "\n\nSuggested title (use it unless the text calls for a clearer one): " + req.TitleHint
+}
+
+// Default title cap in characters (overridable via TITLE_MAX_CHARS)
+const defaultTitleMaxChars = 50
+
+func titleMaxChars() int {
+	return limitEnv("TITLE_MAX_CHARS", defaultTitleMaxChars, 10)
+}
+
+// Inline markdown dropped from titles; each keeps the text it wraps
+var titleMarkup = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile("`([^`]+)`"), "$1"},
+	{regexp.MustCompile(`\*\*(.+?)\*\*`), "$1"},
+	{regexp.MustCompile(`__(.+?)__`), "$1"},
+	{regexp.MustCompile(`~~(.+?)~~`), "$1"},
+	{regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`), "$1"},
+	{regexp.MustCompile(`(^|[^\pL\pN_])_([^_\s](?:[^_]*[^_\s])?)_([^\pL\pN_]|$)`), "$1$2$3"},
+}
+
+// titleLinePrefix matches what starts a markdown line without being part of its text:
+// heading marks, list markers, task boxes and quotes
+var titleLinePrefix = regexp.MustCompile(`^\s*(#{1,6}\s+|[-*+•]\s+(\[[ xX]?\]\s*)?|\d+[.)]\s+|>\s*)+`)
+
+// cleanTitle turns a line of markdown into title text: no heading or list markers, no
+// emphasis, links reduced to their text, and whitespace folded onto one line
+func cleanTitle(line string) string {
+	line = titleLinePrefix.ReplaceAllString(strings.Join(strings.Fields(line), " "), "")
+	for _, markup := range titleMarkup {
+		line = markup.pattern.ReplaceAllString(line, markup.replacement)
+	}
+	return strings.TrimSpace(strings.TrimRight(line, "# "))
+}
+
+// truncateTitle shortens a title to at most max user-perceived characters, so emoji,
+// flags and accented letters are never split. A cut title ends at a word boundary when
+// one is near and always with an ellipsis, which counts toward max.
+func truncateTitle(title string, max int) string {
+	clusters := graphemes(title)
+	if len(clusters) <= max {
+		return title
+	}
+	kept := clusters[:max-1]
+	for i := len(kept) - 1; i >= len(kept)/2 && clusters[len(kept)] != " "; i-- {
+		if kept[i] == " " {
+			kept = kept[:i]
+			break
+		}
+	}
+	return strings.TrimRight(strings.Join(kept, ""), " .,;:-–—") + "…"
+}
+
+// finalizeTitle cleans the model's title like one taken from the markdown and caps its
+// length, falling back to the markdown's first line when it is left empty
+func finalizeTitle(resp *Response, mode string) {
+	title := cleanTitle(resp.Title)
+	if title == "" {
+		title = extractTitle(resp.Markdown, mode)
+	}
+	resp.Title = truncateTitle(title, titleMaxChars())
+}
+
+// genericTitle is the title a response gets when nothing better can be read from it
+func genericTitle(mode string) string {
+	// Use cases.Title instead of deprecated strings.Title (Go 1.18+)
+	caser := cases.Title(language.English)
+	return fmt.Sprintf("Wrist Agent %s", caser.String(mode))
+}
+
+// Title generation: one short call with only the markdown, capped so it costs a fraction
+// of the request it names
+const (
+	titleModelMaxTokens  = 30
+	titleModelInputRunes = 4000
+)
+
+// titleModel returns the model generated titles come from: TITLE_MODEL_ID, else the
+// economy cost class's model, else BEDROCK_MODEL_ID
+func titleModel() string {
+	if model := os.Getenv("TITLE_MODEL_ID"); model != "" {
+		return model
+	}
+	if model := costClassModel("economy"); model != "" {
+		return model
+	}
+	return modelID
+}
+
+// generateTitle replaces a generic title (see genericTitle) with a 5-8 word one written
+// by a cheap model from the markdown. It is off unless TITLE_GENERATION=true, as it adds
+// a model call; when the call fails the generic title stays.
+func generateTitle(ctx context.Context, req *Req, principal string, now time.Time, resp *Response) {
+	if os.Getenv("TITLE_GENERATION") != "true" || resp.Title != genericTitle(req.Mode) || strings.TrimSpace(resp.Markdown) == "" {
+		return
+	}
+	system := `Write a title of 5 to 8 words for the user's note. Use the note's own language and key nouns. Return only the title: no quotes, no markdown and no closing period.`
+	model := titleModel()
+	text, usage, err := invokeModel(withModel(ctx, model), system, truncateRunes(resp.Markdown, titleModelInputRunes), titleModelMaxTokens, 0)
+	recordTokenUsage(ctx, principal, now, model, usage)
+	if err != nil {
+		log.Printf("Title generation failed, keeping %q: %v", resp.Title, err)
+		return
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title := strings.TrimRight(strings.Trim(cleanTitle(first), `"'“”‘’`), ".")
+	if title == "" {
+		return
+	}
+	resp.Title = truncateTitle(title, titleMaxChars())
+}
+
+// graphemes splits s into user-perceived characters: a base character with the
+// combining marks, variation selectors, emoji modifiers and tags that follow it, emoji
+// joined by zero-width joiners, flag pairs and CR LF. It approximates Unicode text
+// segmentation closely enough for cutting titles.
+func graphemes(s string) []string {
+	var clusters []string
+	start, prev, regional := 0, rune(-1), 0
+	for i, r := range s {
+		extends := prev >= 0 && (unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+			r == zeroWidthJoiner || prev == zeroWidthJoiner ||
+			(r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF) || // variation selectors
+			(r >= 0x1F3FB && r <= 0x1F3FF) || // skin tone modifiers
+			(r >= 0xE0020 && r <= 0xE007F) || // tag characters (subdivision flags)
+			(prev == '\r' && r == '\n') ||
+			(isRegionalIndicator(r) && regional%2 == 1))
+		if !extends && i > 0 {
+			clusters = append(clusters, s[start:i])
+			start = i
+		}
+		if isRegionalIndicator(r) {
+			regional++
+		} else {
+			regional = 0
+		}
+		prev = r
+	}
+	if start < len(s) {
+		clusters = append(clusters, s[start:])
+	}
+	return clusters
+}
+
+const zeroWidthJoiner = '\u200d'
+
+// isRegionalIndicator reports whether r is one of the letters that pair up into flags
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"abc", []string{"a", "b", "c"}},
+		{"ét", []string{"é", "t"}},             // combining acute accent
+		{"👍🏽!", []string{"👍🏽", "!"}},             // skin tone
+		{"👩‍👩‍👧 x", []string{"👩‍👩‍👧", " ", "x"}}, // ZWJ family
+		{"🇺🇸🇫🇷", []string{"🇺🇸", "🇫🇷"}},           // flags pair up
+		{"❤️a", []string{"❤️", "a"}},             // variation selector
+		{"🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", []string{"🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F"}}, // England flag
+		{"a\r\nb", []string{"a", "\r\n", "b"}},
+	}
+	for _, tt := range tests {
+		if got := graphemes(tt.in); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("graphemes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		max   int
+		want  string
+	}{
+		{"short", "Buy milk", 10, "Buy milk"},
+		{"exact", "0123456789", 10, "0123456789"},
+		{"word boundary", "Call the plumber about the leak", 20, "Call the plumber…"},
+		{"long word", "Supercalifragilisticexpialidocious", 10, "Supercali…"},
+		{"emoji kept whole", "🎉👩‍👩‍👧👩‍👩‍👧👩‍👩‍👧👩‍👩‍👧", 4, "🎉👩‍👩‍👧👩‍👩‍👧…"},
+		{"flags kept whole", "🇺🇸🇫🇷🇩🇪🇯🇵🇮🇹🇪🇸🇬🇧🇨🇦🇧🇷🇲🇽🇦🇺", 10, "🇺🇸🇫🇷🇩🇪🇯🇵🇮🇹🇪🇸🇬🇧🇨🇦🇧🇷…"},
+		{"punctuation before the cut", "Dinner, drinks, and then the late movie", 16, "Dinner, drinks…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateTitle(tt.title, tt.max)
+			if got != tt.want {
+				t.Errorf("truncateTitle() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) || len(graphemes(got)) > tt.max {
+				t.Errorf("truncateTitle() = %q is invalid or longer than %d", got, tt.max)
+			}
+		})
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := map[string]string{
+		"## Weekly **Review** ##":           "Weekly Review",
+		"- [x] ~~Old~~ task":                "Old task",
+		"> *Quote* of the `day`":            "Quote of the day",
+		"1. First   step\n continued":       "First step continued",
+		"snake_case_name stays":             "snake_case_name stays",
+		"![chart](https://x.example/c.png)": "chart",
+		"• Bullet from the model":           "Bullet from the model",
+	}
+	for in, want := range tests {
+		if got := cleanTitle(in); got != want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFinalizeTitle(t *testing.T) {
+	t.Setenv("TITLE_MAX_CHARS", "12")
+	resp := &Response{Title: "**Renew passport** before the trip"}
+	finalizeTitle(resp, "reminder")
+	if resp.Title != "Renew…" {
+		t.Errorf("Title = %q, want Renew…", resp.Title)
+	}
+
+	resp = &Response{Title: "  ", Markdown: "# Garden plan\n- tomatoes"}
+	finalizeTitle(resp, "note")
+	if resp.Title != "Garden plan" {
+		t.Errorf("Empty title: got %q, want the markdown's heading", resp.Title)
+	}
+}
+
+func TestGenerateTitle(t *testing.T) {
+	t.Setenv("TITLE_GENERATION", "true")
+	t.Setenv("TITLE_MODEL_ID", "anthropic.claude-3-haiku-20240307-v1:0")
+	model := &fakeBedrock{text: "\"Quarterly Budget Review Meeting Notes.\"\nExtra line"}
+	useFakeBedrock(t, model)
+	req := &Req{Mode: "note"}
+
+	resp := &Response{Title: "Wrist Agent Note", Markdown: "{\n  the quarterly budget review went long"}
+	generateTitle(context.Background(), req, "user-1", time.Now(), resp)
+	if resp.Title != "Quarterly Budget Review Meeting Notes" {
+		t.Errorf("Title = %q", resp.Title)
+	}
+	if model.model != "anthropic.claude-3-haiku-20240307-v1:0" || !strings.Contains(string(model.body), "quarterly budget") {
+		t.Errorf("Unexpected title call to %s: %s", model.model, model.body)
+	}
+
+	// Only generic titles are replaced, and only when there is markdown to read
+	model.calls = 0
+	for _, resp := range []*Response{
+		{Title: "Budget review", Markdown: "notes"},
+		{Title: "Wrist Agent Note", Markdown: "  "},
+		{Title: "Wrist Agent Reminder", Markdown: "notes"},
+	} {
+		generateTitle(context.Background(), req, "user-1", time.Now(), resp)
+	}
+	if model.calls != 0 {
+		t.Errorf("Made %d title calls for responses that don't need one", model.calls)
+	}
+
+	// A failed call keeps the generic title
+	model.err = errors.New("throttled")
+	resp = &Response{Title: "Wrist Agent Note", Markdown: "notes"}
+	generateTitle(context.Background(), req, "user-1", time.Now(), resp)
+	if resp.Title != "Wrist Agent Note" {
+		t.Errorf("Failed call: Title = %q", resp.Title)
+	}
+
+	t.Setenv("TITLE_GENERATION", "")
+	model.err, model.calls = nil, 0
+	generateTitle(context.Background(), req, "user-1", time.Now(), resp)
+	if model.calls != 0 || resp.Title != "Wrist Agent Note" {
+		t.Errorf("Disabled: made %d calls, Title = %q", model.calls, resp.Title)
+	}
+}
+
+func TestTitleModel(t *testing.T) {
+	t.Setenv("TITLE_MODEL_ID", "")
+	t.Setenv("COST_CLASS_ECONOMY_MODEL_ID", "")
+	if got := titleModel(); got != modelID {
+		t.Errorf("titleModel() = %q, want BEDROCK_MODEL_ID", got)
+	}
+	t.Setenv("COST_CLASS_ECONOMY_MODEL_ID", "economy-model")
+	if got := titleModel(); got != "economy-model" {
+		t.Errorf("titleModel() = %q, want the economy model", got)
+	}
+	t.Setenv("TITLE_MODEL_ID", "title-model")
+	if got := titleModel(); got != "title-model" {
+		t.Errorf("titleModel() = %q, want TITLE_MODEL_ID", got)
+	}
+}
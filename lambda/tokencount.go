@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"wrist-agent/apierror"
+)
+
+// tokenCounterAPI is the Bedrock runtime call used by POST /tokens/count
+type tokenCounterAPI interface {
+	CountTokens(ctx context.Context, params *bedrockruntime.CountTokensInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.CountTokensOutput, error)
+}
+
+var tokenCounter tokenCounterAPI
+
+// Ways a token count is made
+const (
+	countMethodTokenizer = "count_tokens" // Bedrock CountTokens, the model's own tokenizer
+	countMethodEstimate  = "estimate"     // estimateTokens, when the model has no CountTokens
+)
+
+// TokenCountRequest is the body of POST /tokens/count
+type TokenCountRequest struct {
+	Text string `json:"text"`
+	Mode string `json:"mode"` // optional; summarize accepts longer text
+}
+
+// TokenCount is the response of POST /tokens/count
+type TokenCount struct {
+	InputTokens   int    `json:"inputTokens"`
+	Method        string `json:"method"` // count_tokens or estimate
+	ModelID       string `json:"modelId"`
+	Characters    int    `json:"characters"`
+	MaxTextChars  int    `json:"maxTextChars"`  // longest text the mode accepts before truncating or rejecting it
+	ContextTokens int    `json:"contextTokens"` // the model's context window (MODEL_CONTEXT_TOKENS)
+	Fits          bool   `json:"fits"`          // within maxTextChars and contextTokens
+}
+
+// isTokenCountRequest reports whether the route is the token counter
+func isTokenCountRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/tokens/count"
+}
+
+// handleTokenCount serves POST /tokens/count: how many tokens a text is for the active
+// model, so clients can warn before sending an oversized transcript. It doesn't count
+// against usage quotas.
+func handleTokenCount(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "POST" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	limits := loadSizeLimits()
+	if err := limits.checkBodySize(event.Body); err != nil {
+		return errorResponse(ctx, apierror.PayloadTooLarge(err.Error()))
+	}
+	var req TokenCountRequest
+	version, _ := apiRoute(event)
+	if apiErr := decodeRequest(event.Body, strictFieldsEnabled(version), &req); apiErr != nil {
+		return errorResponse(ctx, apiErr)
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return errorResponse(ctx, apierror.InvalidRequest("text field is required"))
+	}
+	if req.Mode == "" {
+		req.Mode = defaultMode
+	}
+	if _, ok := lookupMode(req.Mode); !ok {
+		return errorResponse(ctx, apierror.InvalidRequest(fmt.Sprintf("invalid mode: %s (valid: %s)", req.Mode, strings.Join(modeNames(), ", "))))
+	}
+
+	count := TokenCount{
+		ModelID:       modelID,
+		Characters:    utf8.RuneCountInString(req.Text),
+		MaxTextChars:  limits.textLimit(req.Mode),
+		ContextTokens: limitEnv("MODEL_CONTEXT_TOKENS", defaultModelContextTokens, 1),
+	}
+	count.InputTokens, count.Method = countTokens(ctx, modelID, req.Text)
+	count.Fits = count.Characters <= count.MaxTextChars && count.InputTokens <= count.ContextTokens
+	return apiResponse(200, count)
+}
+
+// countTokens counts a user message's tokens with Bedrock CountTokens, which only Claude
+// models named by their foundation model ID support. Other models, and CountTokens
+// errors, fall back to estimateTokens.
+func countTokens(ctx context.Context, model, text string) (int, string) {
+	base := baseModelID(model)
+	if tokenCounter == nil || modelFamily(model) != familyAnthropic || strings.HasPrefix(base, "arn:") {
+		return estimateTokens(text), countMethodEstimate
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"anthropic_version": "bedrock-2023-05-31",
+		"max_tokens":        1,
+		"messages":          []map[string]interface{}{{"role": "user", "content": text}},
+	})
+	if err != nil {
+		return estimateTokens(text), countMethodEstimate
+	}
+	out, err := tokenCounter.CountTokens(ctx, &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(base),
+		Input:   &types.CountTokensInputMemberInvokeModel{Value: types.InvokeModelTokensRequest{Body: body}},
+	})
+	if err != nil || out.InputTokens == nil {
+		log.Printf("CountTokens failed, estimating instead: %v", err)
+		return estimateTokens(text), countMethodEstimate
+	}
+	return int(*out.InputTokens), countMethodTokenizer
+}
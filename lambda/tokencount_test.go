@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// fakeTokenCounter answers CountTokens with a fixed count or error
+type fakeTokenCounter struct {
+	tokens int32
+	err    error
+	model  string
+}
+
+func (f *fakeTokenCounter) CountTokens(ctx context.Context, params *bedrockruntime.CountTokensInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.CountTokensOutput, error) {
+	f.model = aws.ToString(params.ModelId)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &bedrockruntime.CountTokensOutput{InputTokens: aws.Int32(f.tokens)}, nil
+}
+
+func useTokenCounter(t *testing.T, fake *fakeTokenCounter) {
+	t.Helper()
+	orig := tokenCounter
+	tokenCounter = fake
+	t.Cleanup(func() { tokenCounter = orig })
+}
+
+func TestCountTokens(t *testing.T) {
+	counter := &fakeTokenCounter{tokens: 42}
+	useTokenCounter(t, counter)
+	ctx := context.Background()
+
+	if n, method := countTokens(ctx, "us.anthropic.claude-haiku-4-5-20251001-v1:0", "hello"); n != 42 || method != countMethodTokenizer || counter.model != "anthropic.claude-haiku-4-5-20251001-v1:0" {
+		t.Errorf("claude: got %d by %s for %s", n, method, counter.model)
+	}
+	if n, method := countTokens(ctx, "amazon.nova-lite-v1:0", "hello world!"); n != 3 || method != countMethodEstimate {
+		t.Errorf("nova: got %d by %s", n, method)
+	}
+	if _, method := countTokens(ctx, "arn:aws:bedrock:us-west-2:123456789012:provisioned-model/x9y8z7", "hello"); method != countMethodEstimate {
+		t.Errorf("provisioned: got %s", method)
+	}
+	counter.err = errors.New("unsupported model")
+	if _, method := countTokens(ctx, "anthropic.claude-3-haiku-20240307-v1:0", "hello"); method != countMethodEstimate {
+		t.Errorf("CountTokens error: got %s", method)
+	}
+}
+
+func TestHandleTokenCount(t *testing.T) {
+	useTokenCounter(t, &fakeTokenCounter{tokens: 9000})
+	t.Setenv("MAX_TEXT_CHARS", "100")
+	t.Setenv("MODEL_CONTEXT_TOKENS", "10000")
+	call := func(method, body string) (events.APIGatewayProxyResponse, TokenCount) {
+		resp, _ := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/tokens/count", Body: body})
+		var count TokenCount
+		json.Unmarshal([]byte(resp.Body), &count)
+		return resp, count
+	}
+
+	resp, count := call("POST", `{"text":"a short transcript"}`)
+	if resp.StatusCode != 200 || count.InputTokens != 9000 || count.Characters != 18 || count.MaxTextChars != 100 || count.ContextTokens != 10000 || !count.Fits {
+		t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	long := make([]byte, 150)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if _, count := call("POST", `{"text":"`+string(long)+`"}`); count.Fits {
+		t.Error("text over maxTextChars fits")
+	}
+
+	for _, tt := range []struct {
+		method, body string
+		status       int
+	}{
+		{"GET", "", 405},
+		{"POST", `{"text":" "}`, 400},
+		{"POST", `{"text":"hi","mode":"poetry"}`, 400},
+		{"POST", `{`, 400},
+	} {
+		if resp, _ := call(tt.method, tt.body); resp.StatusCode != tt.status {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.body, resp.StatusCode, tt.status)
+		}
+	}
+}
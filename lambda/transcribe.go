@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/transcribe"
+	transcribetypes "github.com/aws/aws-sdk-go-v2/service/transcribe/types"
+
+	"wrist-agent/apierror"
+)
+
+// Default audio limits (overridable via MAX_AUDIO_BYTES and TRANSCRIBE_TIMEOUT_SECONDS).
+// The timeout leaves room for the model call within API Gateway's 29 second limit;
+// async requests get the full Lambda timeout.
+const (
+	defaultMaxAudioBytes      = 4 * 1024 * 1024
+	defaultTranscribeTimeout  = 15
+	defaultTranscribeLanguage = "en-US"
+)
+
+// transcribePollInterval is how often a running transcription job is checked
+var transcribePollInterval = time.Second
+
+// transcribeAPI is the subset of the Transcribe client used by the handler
+type transcribeAPI interface {
+	StartTranscriptionJob(ctx context.Context, params *transcribe.StartTranscriptionJobInput, optFns ...func(*transcribe.Options)) (*transcribe.StartTranscriptionJobOutput, error)
+	GetTranscriptionJob(ctx context.Context, params *transcribe.GetTranscriptionJobInput, optFns ...func(*transcribe.Options)) (*transcribe.GetTranscriptionJobOutput, error)
+}
+
+var transcribeClient transcribeAPI
+
+// audioUploadTypes maps the audio content types accepted by /uploads to file extensions
+var audioUploadTypes = map[string]string{
+	"audio/mp4":  "m4a",
+	"audio/mpeg": "mp3",
+	"audio/wav":  "wav",
+	"audio/flac": "flac",
+	"audio/ogg":  "ogg",
+	"audio/amr":  "amr",
+	"audio/webm": "webm",
+}
+
+// Transcription failures that aren't the caller's fault
+var (
+	errTranscribeTimeout       = errors.New("transcription timed out")
+	errTranscribeUnavailable   = errors.New("transcription unavailable")
+	errTranscribeNotConfigured = errors.New("audio transcription is not configured")
+)
+
+func maxAudioBytes() int {
+	return limitEnv("MAX_AUDIO_BYTES", defaultMaxAudioBytes, 1)
+}
+
+// sniffAudio returns the Transcribe media format of an audio clip from its magic bytes
+func sniffAudio(data []byte) (transcribetypes.MediaFormat, bool) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return transcribetypes.MediaFormatWav, true
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return transcribetypes.MediaFormatMp3, true
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return transcribetypes.MediaFormatFlac, true
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return transcribetypes.MediaFormatOgg, true
+	case bytes.HasPrefix(data, []byte("#!AMR")):
+		return transcribetypes.MediaFormatAmr, true
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return transcribetypes.MediaFormatWebm, true
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		if string(data[8:12]) == "M4A " {
+			return transcribetypes.MediaFormatM4a, true
+		}
+		return transcribetypes.MediaFormatMp4, true
+	}
+	return "", false
+}
+
+// validateAudio checks the optional audio fields. Inline clips are decoded and checked
+// here; uploaded clips are checked by Transcribe itself.
+func validateAudio(req *Req) error {
+	if req.AudioBase64 != "" && req.AudioKey != "" {
+		return fmt.Errorf("send either audioBase64 or audioKey, not both")
+	}
+	if (req.AudioBase64 != "" || req.AudioKey != "") && strings.TrimSpace(req.Text) != "" {
+		return fmt.Errorf("send either text or audio, not both")
+	}
+
+	if req.AudioKey != "" {
+		if !strings.HasPrefix(req.AudioKey, uploadKeyPrefix) || strings.Contains(req.AudioKey, "..") {
+			return fmt.Errorf("audioKey must be a key returned by /uploads")
+		}
+		if _, ok := audioFormatFromKey(req.AudioKey); !ok {
+			return fmt.Errorf("audioKey must be an audio upload")
+		}
+		return nil
+	}
+
+	if req.AudioBase64 == "" {
+		return nil
+	}
+	// SQS messages are capped at 256 KB, so queued requests must reference an upload
+	if req.Async {
+		return fmt.Errorf("async requests must upload the audio and pass audioKey instead of audioBase64")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(req.AudioBase64)
+	if err != nil {
+		return fmt.Errorf("audioBase64 is not valid base64")
+	}
+	if limit := maxAudioBytes(); len(data) > limit {
+		return fmt.Errorf("%w: audio is %d bytes, limit is %d", errPayloadTooLarge, len(data), limit)
+	}
+	if _, ok := sniffAudio(data); !ok {
+		return fmt.Errorf("unsupported audio format (supported: m4a, mp4, mp3, wav, flac, ogg, amr, webm)")
+	}
+	req.audio = data
+	return nil
+}
+
+// audioFormatFromKey returns the media format for an upload key's extension
+func audioFormatFromKey(key string) (transcribetypes.MediaFormat, bool) {
+	ext := key[strings.LastIndex(key, ".")+1:]
+	for _, uploadExt := range audioUploadTypes {
+		if ext == uploadExt {
+			return transcribetypes.MediaFormat(ext), true
+		}
+	}
+	return "", false
+}
+
+// transcribeAudio replaces req.Text with the transcript of the request's audio clip.
+// Inline clips are staged under uploads/<principal>/ first, since Transcribe reads
+// media from S3. The transcript is subject to the usual text limits.
+func transcribeAudio(ctx context.Context, req *Req, id, principal string) error {
+	if req.AudioKey == "" && req.audio == nil {
+		return nil
+	}
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" || transcribeClient == nil {
+		return errTranscribeNotConfigured
+	}
+
+	key, format := req.AudioKey, transcribetypes.MediaFormat("")
+	if key != "" {
+		if !strings.HasPrefix(key, uploadKeyPrefix+principal+"/") {
+			return fmt.Errorf("audioKey not found")
+		}
+		format, _ = audioFormatFromKey(key)
+	} else {
+		format, _ = sniffAudio(req.audio)
+		key = fmt.Sprintf("%s%s/%s-audio.%s", uploadKeyPrefix, principal, id, format)
+		if _, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(req.audio),
+		}); err != nil {
+			return fmt.Errorf("%w: failed to stage audio: %v", errTranscribeUnavailable, err)
+		}
+	}
+
+	transcript, err := runTranscription(ctx, bucket, key, format, id, principal)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(transcript) == "" {
+		return fmt.Errorf("no speech was recognised in the audio")
+	}
+
+	req.Text = transcript
+	req.transcript = transcript
+	return loadSizeLimits().limitText(req)
+}
+
+// runTranscription starts a Transcribe job for s3://bucket/key and waits for its
+// transcript, which Transcribe writes under transcripts/<principal>/
+func runTranscription(ctx context.Context, bucket, key string, format transcribetypes.MediaFormat, id, principal string) (string, error) {
+	jobName := "wrist-agent-" + id
+	outputKey := fmt.Sprintf("transcripts/%s/%s.json", principal, id)
+
+	_, err := transcribeClient.StartTranscriptionJob(ctx, &transcribe.StartTranscriptionJobInput{
+		TranscriptionJobName: aws.String(jobName),
+		LanguageCode:         transcribetypes.LanguageCode(getEnv("TRANSCRIBE_LANGUAGE_CODE", defaultTranscribeLanguage)),
+		MediaFormat:          format,
+		Media:                &transcribetypes.Media{MediaFileUri: aws.String(fmt.Sprintf("s3://%s/%s", bucket, key))},
+		OutputBucketName:     aws.String(bucket),
+		OutputKey:            aws.String(outputKey),
+	})
+	// A retried async job finds its transcription already started; wait for that one
+	var conflict *transcribetypes.ConflictException
+	if err != nil && !errors.As(err, &conflict) {
+		return "", fmt.Errorf("%w: failed to start transcription: %v", errTranscribeUnavailable, err)
+	}
+
+	deadline := time.Now().Add(time.Duration(limitEnv("TRANSCRIBE_TIMEOUT_SECONDS", defaultTranscribeTimeout, 1)) * time.Second)
+	for {
+		out, err := transcribeClient.GetTranscriptionJob(ctx, &transcribe.GetTranscriptionJobInput{
+			TranscriptionJobName: aws.String(jobName),
+		})
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to check transcription: %v", errTranscribeUnavailable, err)
+		}
+
+		switch out.TranscriptionJob.TranscriptionJobStatus {
+		case transcribetypes.TranscriptionJobStatusCompleted:
+			return readTranscript(ctx, bucket, outputKey)
+		case transcribetypes.TranscriptionJobStatusFailed:
+			return "", fmt.Errorf("transcription failed: %s", aws.ToString(out.TranscriptionJob.FailureReason))
+		}
+
+		if time.Now().After(deadline) {
+			log.Printf("Transcription job %s still running at deadline", jobName)
+			return "", errTranscribeTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(transcribePollInterval):
+		}
+	}
+}
+
+// readTranscript extracts the transcript text from Transcribe's JSON output
+func readTranscript(ctx context.Context, bucket, key string) (string, error) {
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to read transcript: %v", errTranscribeUnavailable, err)
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read transcript: %w", err)
+	}
+	var result struct {
+		Results struct {
+			Transcripts []struct {
+				Transcript string `json:"transcript"`
+			} `json:"transcripts"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse transcript: %w", err)
+	}
+
+	parts := make([]string, 0, len(result.Results.Transcripts))
+	for _, t := range result.Results.Transcripts {
+		parts = append(parts, t.Transcript)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// transcribeError maps a transcription failure to user-facing feedback. Timeouts and
+// service failures are retryable, so queued audio requests are tried again.
+func transcribeError(err error) *apierror.Error {
+	switch {
+	case errors.Is(err, errPayloadTooLarge):
+		return apierror.PayloadTooLarge(err.Error())
+	case errors.Is(err, errTranscribeNotConfigured):
+		return apierror.NotConfigured("Audio transcription is not configured")
+	case errors.Is(err, errTranscribeTimeout):
+		return apierror.New(504, apierror.CodeUpstreamTimeout, "Transcription timed out. Please try a shorter clip or send it with async:true.")
+	case errors.Is(err, errTranscribeUnavailable):
+		return apierror.New(503, apierror.CodeServiceUnavailable, "Transcription is temporarily unavailable. Please try again shortly.")
+	default:
+		return apierror.InvalidRequest(err.Error())
+	}
+}
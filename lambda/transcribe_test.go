@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/transcribe"
+	transcribetypes "github.com/aws/aws-sdk-go-v2/service/transcribe/types"
+)
+
+// Smallest byte strings sniffAudio recognises as each format
+var (
+	testWAV = []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+	testM4A = []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00")
+)
+
+// fakeTranscribe records started jobs and reports each job with a fixed status
+type fakeTranscribe struct {
+	started  *transcribe.StartTranscriptionJobInput
+	status   transcribetypes.TranscriptionJobStatus
+	startErr error
+	polls    int
+}
+
+func (f *fakeTranscribe) StartTranscriptionJob(ctx context.Context, params *transcribe.StartTranscriptionJobInput, optFns ...func(*transcribe.Options)) (*transcribe.StartTranscriptionJobOutput, error) {
+	if f.startErr != nil {
+		return nil, f.startErr
+	}
+	f.started = params
+	return &transcribe.StartTranscriptionJobOutput{}, nil
+}
+
+func (f *fakeTranscribe) GetTranscriptionJob(ctx context.Context, params *transcribe.GetTranscriptionJobInput, optFns ...func(*transcribe.Options)) (*transcribe.GetTranscriptionJobOutput, error) {
+	f.polls++
+	job := &transcribetypes.TranscriptionJob{TranscriptionJobStatus: f.status}
+	if f.status == transcribetypes.TranscriptionJobStatusFailed {
+		job.FailureReason = aws.String("unsupported sample rate")
+	}
+	return &transcribe.GetTranscriptionJobOutput{TranscriptionJob: job}, nil
+}
+
+// useFakeTranscribe swaps the Transcribe client for one test
+func useFakeTranscribe(t *testing.T, fake *fakeTranscribe) {
+	t.Helper()
+	orig, origInterval := transcribeClient, transcribePollInterval
+	transcribeClient, transcribePollInterval = fake, time.Millisecond
+	t.Cleanup(func() { transcribeClient, transcribePollInterval = orig, origInterval })
+}
+
+func TestSniffAudio(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want transcribetypes.MediaFormat
+	}{
+		{"wav", testWAV, transcribetypes.MediaFormatWav},
+		{"m4a", testM4A, transcribetypes.MediaFormatM4a},
+		{"mp4", []byte("\x00\x00\x00\x20ftypisom"), transcribetypes.MediaFormatMp4},
+		{"mp3 with id3", []byte("ID3\x04\x00"), transcribetypes.MediaFormatMp3},
+		{"mp3 frame", []byte{0xFF, 0xFB, 0x90}, transcribetypes.MediaFormatMp3},
+		{"flac", []byte("fLaC\x00"), transcribetypes.MediaFormatFlac},
+		{"ogg", []byte("OggS\x00"), transcribetypes.MediaFormatOgg},
+		{"amr", []byte("#!AMR\n"), transcribetypes.MediaFormatAmr},
+		{"webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, transcribetypes.MediaFormatWebm},
+		{"text", []byte("hello world"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sniffAudio(tt.data)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("sniffAudio() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAudio(t *testing.T) {
+	wav64 := base64.StdEncoding.EncodeToString(testWAV)
+
+	tests := []struct {
+		name      string
+		req       Req
+		wantErr   string
+		wantAudio bool
+	}{
+		{name: "no audio", req: Req{Text: "hello"}},
+		{name: "wav", req: Req{AudioBase64: wav64}, wantAudio: true},
+		{name: "not base64", req: Req{AudioBase64: "%%%"}, wantErr: "not valid base64"},
+		{name: "not audio", req: Req{AudioBase64: base64.StdEncoding.EncodeToString([]byte("hello world"))}, wantErr: "unsupported audio format"},
+		{name: "both fields", req: Req{AudioBase64: wav64, AudioKey: "uploads/user-1/a.wav"}, wantErr: "not both"},
+		{name: "text and audio", req: Req{Text: "hello", AudioBase64: wav64}, wantErr: "text or audio"},
+		{name: "async inline", req: Req{AudioBase64: wav64, Async: true}, wantErr: "audioKey"},
+		{name: "key outside uploads", req: Req{AudioKey: "transcripts/user-1/a.json"}, wantErr: "returned by /uploads"},
+		{name: "key traversal", req: Req{AudioKey: "uploads/../ics/a.m4a"}, wantErr: "returned by /uploads"},
+		{name: "image key", req: Req{AudioKey: "uploads/user-1/a.png"}, wantErr: "audio upload"},
+		{name: "key is transcribed later", req: Req{AudioKey: "uploads/user-1/a.m4a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAudio(&tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validateAudio() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateAudio() error = %v", err)
+			}
+			if (tt.req.audio != nil) != tt.wantAudio {
+				t.Errorf("audio = %v, want decoded: %v", tt.req.audio, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestValidateAudio_TooLarge(t *testing.T) {
+	t.Setenv("MAX_AUDIO_BYTES", "8")
+	req := Req{AudioBase64: base64.StdEncoding.EncodeToString(testWAV)}
+	if err := validateAudio(&req); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("validateAudio() error = %v, want errPayloadTooLarge", err)
+	}
+}
+
+func TestValidateRequest_AudioReplacesText(t *testing.T) {
+	req := Req{AudioKey: "uploads/user-1/a.m4a"}
+	if err := validateRequest(&req); err != nil {
+		t.Errorf("validateRequest() rejected an audio-only request: %v", err)
+	}
+}
+
+func TestTranscribeAudio(t *testing.T) {
+	t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+	const transcriptJSON = `{"results":{"transcripts":[{"transcript":"Remind me to call mom at five."}]}}`
+
+	t.Run("inline clip is staged and transcribed", func(t *testing.T) {
+		store := &fakeS3{objects: map[string][]byte{"transcripts/user-1/cap-1.json": []byte(transcriptJSON)}}
+		useFakeS3(t, store, &fakePresigner{})
+		fake := &fakeTranscribe{status: transcribetypes.TranscriptionJobStatusCompleted}
+		useFakeTranscribe(t, fake)
+
+		req := Req{audio: testWAV}
+		if err := transcribeAudio(context.Background(), &req, "cap-1", "user-1"); err != nil {
+			t.Fatalf("transcribeAudio() error = %v", err)
+		}
+		if store.key != "uploads/user-1/cap-1-audio.wav" || store.body != string(testWAV) {
+			t.Errorf("staged %q (%d bytes)", store.key, len(store.body))
+		}
+		if got := aws.ToString(fake.started.Media.MediaFileUri); got != "s3://captures/uploads/user-1/cap-1-audio.wav" {
+			t.Errorf("MediaFileUri = %q", got)
+		}
+		if fake.started.MediaFormat != transcribetypes.MediaFormatWav || fake.started.LanguageCode != "en-US" {
+			t.Errorf("started = %+v", fake.started)
+		}
+		if req.Text != "Remind me to call mom at five." || req.transcript != req.Text {
+			t.Errorf("Text = %q, transcript = %q", req.Text, req.transcript)
+		}
+	})
+
+	t.Run("uploaded clip", func(t *testing.T) {
+		store := &fakeS3{objects: map[string][]byte{"transcripts/user-1/cap-2.json": []byte(transcriptJSON)}}
+		useFakeS3(t, store, &fakePresigner{})
+		fake := &fakeTranscribe{status: transcribetypes.TranscriptionJobStatusCompleted}
+		useFakeTranscribe(t, fake)
+
+		req := Req{AudioKey: "uploads/user-1/memo.m4a"}
+		if err := transcribeAudio(context.Background(), &req, "cap-2", "user-1"); err != nil {
+			t.Fatalf("transcribeAudio() error = %v", err)
+		}
+		if store.key != "" {
+			t.Errorf("uploaded clip was staged again as %q", store.key)
+		}
+		if fake.started.MediaFormat != transcribetypes.MediaFormatM4a {
+			t.Errorf("MediaFormat = %q", fake.started.MediaFormat)
+		}
+	})
+
+	t.Run("other principal's upload", func(t *testing.T) {
+		useFakeTranscribe(t, &fakeTranscribe{})
+		req := Req{AudioKey: "uploads/user-1/memo.m4a"}
+		err := transcribeAudio(context.Background(), &req, "cap-3", "user-2")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("transcribeAudio() error = %v, want not found", err)
+		}
+	})
+
+	t.Run("silence", func(t *testing.T) {
+		useFakeS3(t, &fakeS3{objects: map[string][]byte{"transcripts/user-1/cap-4.json": []byte(`{"results":{"transcripts":[{"transcript":""}]}}`)}}, &fakePresigner{})
+		useFakeTranscribe(t, &fakeTranscribe{status: transcribetypes.TranscriptionJobStatusCompleted})
+		req := Req{audio: testWAV}
+		if err := transcribeAudio(context.Background(), &req, "cap-4", "user-1"); err == nil || !strings.Contains(err.Error(), "no speech") {
+			t.Errorf("transcribeAudio() error = %v, want no speech", err)
+		}
+	})
+
+	t.Run("job failed", func(t *testing.T) {
+		useFakeS3(t, &fakeS3{}, &fakePresigner{})
+		useFakeTranscribe(t, &fakeTranscribe{status: transcribetypes.TranscriptionJobStatusFailed})
+		req := Req{audio: testWAV}
+		err := transcribeAudio(context.Background(), &req, "cap-5", "user-1")
+		if err == nil || !strings.Contains(err.Error(), "unsupported sample rate") {
+			t.Errorf("transcribeAudio() error = %v, want failure reason", err)
+		}
+		if transcribeError(err).Status != 400 {
+			t.Errorf("failed job should be the caller's error, got %d", transcribeError(err).Status)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Setenv("TRANSCRIBE_TIMEOUT_SECONDS", "1")
+		useFakeS3(t, &fakeS3{}, &fakePresigner{})
+		fake := &fakeTranscribe{status: transcribetypes.TranscriptionJobStatusInProgress}
+		useFakeTranscribe(t, fake)
+		transcribePollInterval = 100 * time.Millisecond
+
+		req := Req{audio: testWAV}
+		err := transcribeAudio(context.Background(), &req, "cap-6", "user-1")
+		if !errors.Is(err, errTranscribeTimeout) {
+			t.Fatalf("transcribeAudio() error = %v, want errTranscribeTimeout", err)
+		}
+		if fake.polls < 2 {
+			t.Errorf("polls = %d, want the job polled until the deadline", fake.polls)
+		}
+		if transcribeError(err).Status != 504 {
+			t.Errorf("Status = %d, want 504", transcribeError(err).Status)
+		}
+	})
+
+	t.Run("start failure is retryable", func(t *testing.T) {
+		useFakeS3(t, &fakeS3{}, &fakePresigner{})
+		useFakeTranscribe(t, &fakeTranscribe{startErr: errors.New("ThrottlingException")})
+		req := Req{audio: testWAV}
+		err := transcribeAudio(context.Background(), &req, "cap-7", "user-1")
+		if !errors.Is(err, errTranscribeUnavailable) || transcribeError(err).Status != 503 {
+			t.Errorf("transcribeAudio() error = %v, want errTranscribeUnavailable", err)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		t.Setenv("CAPTURE_BUCKET_NAME", "")
+		req := Req{audio: testWAV}
+		if err := transcribeAudio(context.Background(), &req, "cap-8", "user-1"); !errors.Is(err, errTranscribeNotConfigured) {
+			t.Errorf("transcribeAudio() error = %v, want errTranscribeNotConfigured", err)
+		}
+	})
+}
+
+func TestHandleUploads_Audio(t *testing.T) {
+	t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+	useFakeS3(t, &fakeS3{}, &fakePresigner{})
+
+	event := events.APIGatewayProxyRequest{HTTPMethod: "POST", Resource: "/uploads", Body: `{"contentType":"audio/mp4"}`}
+	event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+	resp, _ := handler(context.Background(), event)
+	if resp.StatusCode != 200 || !strings.Contains(resp.Body, `.m4a"`) {
+		t.Fatalf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestHandler_InvalidAudioRejected(t *testing.T) {
+	resp, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Body:       `{"audioBase64":"` + base64.StdEncoding.EncodeToString([]byte("not audio")) + `"}`,
+	})
+	if resp.StatusCode != 400 || !strings.Contains(resp.Body, "unsupported audio format") {
+		t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
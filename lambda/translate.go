@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Target language when a translate request doesn't name one
+const defaultTargetLanguage = "English"
+
+// targetLanguagePattern accepts language names and BCP 47 tags ("Japanese", "pt-BR",
+// "Chinese (Traditional)"); the value goes into the system prompt, so nothing else is allowed
+var targetLanguagePattern = regexp.MustCompile(`^\p{L}[\p{L} ()\-]{0,39}$`)
+
+// Translation is the translate mode result, kept short for the watch face
+type Translation struct {
+	Text           string `json:"text"`
+	SourceLanguage string `json:"sourceLanguage"`         // detected language of the request, e.g. "Spanish"
+	TargetLanguage string `json:"targetLanguage"`         // language translated into
+	Romanization   string `json:"romanization,omitempty"` // Latin-script reading for non-Latin translations
+}
+
+// validateTranslation defaults and checks targetLanguage for translate requests;
+// other modes ignore the field
+func validateTranslation(req *Req) error {
+	if req.Mode != "translate" {
+		return nil
+	}
+	req.TargetLanguage = strings.Join(strings.Fields(req.TargetLanguage), " ")
+	if req.TargetLanguage == "" {
+		req.TargetLanguage = defaultTargetLanguage
+	}
+	if !targetLanguagePattern.MatchString(req.TargetLanguage) {
+		return fmt.Errorf("targetLanguage must be a language name or code, e.g. \"Japanese\" or \"pt-BR\"")
+	}
+	return nil
+}
+
+// translationPrompt is the system prompt section naming the target language
+func translationPrompt(req *Req) string {
+	if req.Mode != "translate" {
+		return ""
+	}
+	return "\n\nTarget language: " + req.TargetLanguage
+}
+
+// finalizeTranslation fills in what the model left out and puts the translation on the
+// watch face. Romanization is only kept when the translation isn't already in Latin script.
+func finalizeTranslation(req *Req, resp *Response) {
+	if resp.Translation == nil {
+		// Fallback path (unstructured model output): the reply is the translation
+		resp.Translation = &Translation{Text: resp.Markdown}
+	}
+	resp.Action = "translate"
+
+	translation := resp.Translation
+	translation.Text = strings.TrimSpace(translation.Text)
+	translation.TargetLanguage = req.TargetLanguage
+	translation.SourceLanguage = strings.TrimSpace(translation.SourceLanguage)
+	if translation.SourceLanguage == "" {
+		translation.SourceLanguage = "unknown"
+	}
+	translation.Romanization = strings.TrimSpace(translation.Romanization)
+	if !hasNonLatinLetters(translation.Text) {
+		translation.Romanization = ""
+	}
+
+	if translation.Text != "" {
+		resp.ShortText = translation.Text
+	}
+}
+
+// hasNonLatinLetters reports whether text contains letters outside the Latin script
+func hasNonLatinLetters(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) {
+			return true
+		}
+	}
+	return false
+}
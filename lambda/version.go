@@ -0,0 +1,67 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// API versions. Unversioned routes (/invoke) are v1 so existing Shortcuts keep working.
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+// versionPrefix matches a leading /v<N> path segment
+var versionPrefix = regexp.MustCompile(`^/v(\d+)(/|$)`)
+
+// ResponseV2 is the /v2 invoke response. Results are a list so a single dictation can
+// produce several items; request-level warnings move out of the item.
+type ResponseV2 struct {
+	Items    []Response `json:"items"`
+	Warnings []string   `json:"warnings,omitempty"`
+}
+
+// routePath returns the API Gateway resource (or raw path) for the request
+func routePath(event events.APIGatewayProxyRequest) string {
+	if event.Resource != "" {
+		return event.Resource
+	}
+	return event.Path
+}
+
+// apiRoute splits a route into its API version and unversioned path, e.g. /v2/invoke is
+// (2, "/invoke") and /invoke is (1, "/invoke"). Unsupported versions return 0.
+func apiRoute(event events.APIGatewayProxyRequest) (int, string) {
+	path := routePath(event)
+	match := versionPrefix.FindStringSubmatch(path)
+	if match == nil {
+		return apiV1, path
+	}
+
+	rest := path[len("/v"+match[1]):]
+	if rest == "" {
+		rest = "/"
+	}
+	switch version, _ := strconv.Atoi(match[1]); version {
+	case apiV1, apiV2:
+		return version, rest
+	default:
+		return 0, rest
+	}
+}
+
+// renderResponse shapes an invoke result for the requested API version. v1 keeps the
+// original flat Response; new response features land in ResponseV2.
+func renderResponse(version int, resp *Response) interface{} {
+	if version != apiV2 {
+		// v2-only fields stay out of the v1 shape
+		v1 := *resp
+		v1.Summary = ""
+		return &v1
+	}
+	item := *resp
+	item.Warnings = nil
+	return ResponseV2{Items: []Response{item}, Warnings: resp.Warnings}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAPIRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		resource    string
+		path        string
+		wantVersion int
+		wantPath    string
+	}{
+		{name: "unversioned is v1", resource: "/invoke", wantVersion: 1, wantPath: "/invoke"},
+		{name: "v1", resource: "/v1/invoke", wantVersion: 1, wantPath: "/invoke"},
+		{name: "v2", resource: "/v2/invoke", wantVersion: 2, wantPath: "/invoke"},
+		{name: "v2 admin", resource: "/v2/admin/tokens/{id}", wantVersion: 2, wantPath: "/admin/tokens/{id}"},
+		{name: "path fallback", path: "/v2/modes", wantVersion: 2, wantPath: "/modes"},
+		{name: "bare version", resource: "/v2", wantVersion: 2, wantPath: "/"},
+		{name: "unsupported version", resource: "/v9/invoke", wantVersion: 0, wantPath: "/invoke"},
+		{name: "not a version segment", resource: "/videos", wantVersion: 1, wantPath: "/videos"},
+		{name: "empty", wantVersion: 1, wantPath: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, path := apiRoute(events.APIGatewayProxyRequest{Resource: tt.resource, Path: tt.path})
+			if version != tt.wantVersion || path != tt.wantPath {
+				t.Errorf("apiRoute() = (%d, %q), want (%d, %q)", version, path, tt.wantVersion, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestRenderResponse(t *testing.T) {
+	resp := &Response{Markdown: "# Note", Action: "note", Title: "Note", Warnings: []string{"text truncated"}}
+
+	v1, _ := json.Marshal(renderResponse(apiV1, resp))
+	var flat map[string]interface{}
+	json.Unmarshal(v1, &flat)
+	if flat["title"] != "Note" || flat["warnings"] == nil {
+		t.Errorf("v1 response should be the flat Response, got %s", v1)
+	}
+
+	v2, ok := renderResponse(apiV2, resp).(ResponseV2)
+	if !ok {
+		t.Fatalf("v2 response is %T, want ResponseV2", renderResponse(apiV2, resp))
+	}
+	if len(v2.Items) != 1 || v2.Items[0].Title != "Note" {
+		t.Errorf("v2 items = %+v", v2.Items)
+	}
+	if v2.Items[0].Warnings != nil || len(v2.Warnings) != 1 {
+		t.Errorf("v2 warnings should move out of the item: %+v", v2)
+	}
+	if resp.Warnings == nil {
+		t.Error("renderResponse must not modify the original response")
+	}
+}
+
+func TestHandler_UnsupportedVersion(t *testing.T) {
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST", Resource: "/v9/invoke", Body: `{"text":"hi"}`})
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("StatusCode = %d, want 404: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestHandler_VersionedModesRoute(t *testing.T) {
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Resource: "/v2/modes"})
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("StatusCode = %d, want 200: %s", resp.StatusCode, resp.Body)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"wrist-agent/apierror"
+)
+
+// Bedrock accepts images up to 3.75 MB (overridable via MAX_IMAGE_BYTES)
+const defaultMaxImageBytes = 3932160
+
+// Presigned upload URLs are short-lived; the client uploads immediately after asking
+const uploadURLExpiry = 15 * time.Minute
+
+// uploadKeyPrefix is where clients upload images for imageKey requests
+const uploadKeyPrefix = "uploads/"
+
+// imageTypes maps the image formats Claude accepts to their file extensions
+var imageTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// imageInput is a validated image ready to send to Bedrock
+type imageInput struct {
+	MediaType string
+	Data      []byte
+}
+
+// UploadRequest asks for a presigned URL to upload an image, audio clip or notes zip
+type UploadRequest struct {
+	ContentType string `json:"contentType"` // image/jpeg|image/png|image/gif|image/webp, audio/mp4|audio/mpeg|..., or application/zip
+}
+
+// UploadTicket is a presigned PUT; pass Key as imageKey or audioKey on /invoke, or zipKey on /import
+type UploadTicket struct {
+	Key         string    `json:"key"`
+	UploadURL   string    `json:"uploadUrl"`
+	ContentType string    `json:"contentType"` // must be sent as the Content-Type header of the PUT
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+func maxImageBytes() int {
+	return limitEnv("MAX_IMAGE_BYTES", defaultMaxImageBytes, 1)
+}
+
+// validateImage checks the optional image fields. Inline images are decoded and
+// checked here; uploaded images are fetched and checked by loadImage.
+func validateImage(req *Req) error {
+	if req.ImageBase64 != "" && req.ImageKey != "" {
+		return fmt.Errorf("send either imageBase64 or imageKey, not both")
+	}
+
+	if req.ImageKey != "" {
+		if !strings.HasPrefix(req.ImageKey, uploadKeyPrefix) || strings.Contains(req.ImageKey, "..") {
+			return fmt.Errorf("imageKey must be a key returned by /uploads")
+		}
+		return nil
+	}
+
+	if req.ImageBase64 == "" {
+		return nil
+	}
+	// SQS messages are capped at 256 KB, so queued requests must reference an upload
+	if req.Async {
+		return fmt.Errorf("async requests must upload the image and pass imageKey instead of imageBase64")
+	}
+
+	// Accept data URLs as produced by canvas/FileReader
+	data := req.ImageBase64
+	if i := strings.Index(data, ";base64,"); strings.HasPrefix(data, "data:") && i >= 0 {
+		data = data[i+len(";base64,"):]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("imageBase64 is not valid base64")
+	}
+
+	image, err := checkImage(decoded)
+	if err != nil {
+		return err
+	}
+	req.image = image
+	return nil
+}
+
+// checkImage enforces the image size limit and sniffs the format from its content
+func checkImage(data []byte) (*imageInput, error) {
+	if limit := maxImageBytes(); len(data) > limit {
+		return nil, fmt.Errorf("%w: image is %d bytes, limit is %d", errPayloadTooLarge, len(data), limit)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	mediaType := http.DetectContentType(data)
+	if _, ok := imageTypes[mediaType]; !ok {
+		return nil, fmt.Errorf("unsupported image format %s (supported: jpeg, png, gif, webp)", mediaType)
+	}
+	return &imageInput{MediaType: mediaType, Data: data}, nil
+}
+
+// loadImage fetches an uploaded image for req.ImageKey. Callers may only use their
+// own uploads.
+func loadImage(ctx context.Context, req *Req, principal string) error {
+	if req.ImageKey == "" || req.image != nil {
+		return nil
+	}
+	if !strings.HasPrefix(req.ImageKey, uploadKeyPrefix+principal+"/") {
+		return fmt.Errorf("imageKey not found")
+	}
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" {
+		return fmt.Errorf("image uploads are not configured")
+	}
+
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(req.ImageKey),
+	})
+	if err != nil {
+		log.Printf("Failed to fetch image %s: %v", req.ImageKey, err)
+		return fmt.Errorf("imageKey not found")
+	}
+	defer out.Body.Close()
+
+	// Read one byte past the limit so oversize uploads are detected without buffering them
+	data, err := io.ReadAll(io.LimitReader(out.Body, int64(maxImageBytes())+1))
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+	image, err := checkImage(data)
+	if err != nil {
+		return err
+	}
+	req.image = image
+	return nil
+}
+
+// imageContent renders an image as a Claude content block
+func imageContent(image *imageInput) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "image",
+		"source": map[string]interface{}{
+			"type":       "base64",
+			"media_type": image.MediaType,
+			"data":       base64.StdEncoding.EncodeToString(image.Data),
+		},
+	}
+}
+
+func isUploadsRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/uploads"
+}
+
+// handleUploads presigns a PUT for an image, audio clip or notes zip under uploads/<principal>/. The upload
+// itself doesn't count against usage quotas; the /invoke that uses it does.
+func handleUploads(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "POST" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	bucket := os.Getenv("CAPTURE_BUCKET_NAME")
+	if bucket == "" {
+		return errorResponse(ctx, apierror.NotConfigured("Image uploads are not configured"))
+	}
+
+	var body UploadRequest
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	ext, ok := imageTypes[body.ContentType]
+	if !ok {
+		ext, ok = audioUploadTypes[body.ContentType]
+	}
+	if !ok {
+		ext, ok = importUploadTypes[body.ContentType]
+	}
+	if !ok {
+		return errorResponse(ctx, apierror.InvalidRequest("contentType must be an image (image/jpeg, image/png, image/gif, image/webp), "+
+			"audio (audio/mp4, audio/mpeg, audio/wav, audio/flac, audio/ogg, audio/amr, audio/webm) or application/zip (for /import) type"))
+	}
+
+	key := fmt.Sprintf("%s%s/%s.%s", uploadKeyPrefix, principalFromEvent(event), newCaptureID(), ext)
+	presigned, err := s3Presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(body.ContentType),
+	}, s3.WithPresignExpires(uploadURLExpiry))
+	if err != nil {
+		log.Printf("Failed to presign upload: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to create upload URL"))
+	}
+
+	return apiResponse(200, UploadTicket{
+		Key:         key,
+		UploadURL:   presigned.URL,
+		ContentType: body.ContentType,
+		ExpiresAt:   time.Now().UTC().Add(uploadURLExpiry),
+	})
+}
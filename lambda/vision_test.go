@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Smallest byte strings http.DetectContentType recognises as each format
+var (
+	testPNG  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	testJPEG = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+)
+
+func TestValidateImage(t *testing.T) {
+	png64 := base64.StdEncoding.EncodeToString(testPNG)
+
+	tests := []struct {
+		name      string
+		req       Req
+		wantErr   string
+		wantType  string
+		wantLarge bool
+	}{
+		{name: "no image", req: Req{}},
+		{name: "png", req: Req{ImageBase64: png64}, wantType: "image/png"},
+		{name: "jpeg data url", req: Req{ImageBase64: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(testJPEG)}, wantType: "image/jpeg"},
+		{name: "not base64", req: Req{ImageBase64: "%%%"}, wantErr: "not valid base64"},
+		{name: "not an image", req: Req{ImageBase64: base64.StdEncoding.EncodeToString([]byte("hello world"))}, wantErr: "unsupported image format"},
+		{name: "both fields", req: Req{ImageBase64: png64, ImageKey: "uploads/user-1/a.png"}, wantErr: "not both"},
+		{name: "async inline", req: Req{ImageBase64: png64, Async: true}, wantErr: "imageKey"},
+		{name: "key outside uploads", req: Req{ImageKey: "ics/user-1/a.ics"}, wantErr: "returned by /uploads"},
+		{name: "key traversal", req: Req{ImageKey: "uploads/../ics/a.ics"}, wantErr: "returned by /uploads"},
+		{name: "key is loaded later", req: Req{ImageKey: "uploads/user-1/a.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateImage(&tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validateImage() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateImage() error = %v", err)
+			}
+			if tt.wantType == "" {
+				if tt.req.image != nil {
+					t.Errorf("image = %+v, want nil", tt.req.image)
+				}
+				return
+			}
+			if tt.req.image == nil || tt.req.image.MediaType != tt.wantType {
+				t.Errorf("image = %+v, want %s", tt.req.image, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestValidateImage_TooLarge(t *testing.T) {
+	t.Setenv("MAX_IMAGE_BYTES", "8")
+	req := Req{ImageBase64: base64.StdEncoding.EncodeToString(testPNG)}
+	if err := validateImage(&req); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("validateImage() error = %v, want errPayloadTooLarge", err)
+	}
+}
+
+func TestCheckBodySize_ImageAllowance(t *testing.T) {
+	t.Setenv("MAX_IMAGE_BYTES", "300")
+	limits := sizeLimits{MaxBodyBytes: 100}
+	image := strings.Repeat("A", 400) // base64 of 300 bytes
+
+	if err := limits.checkBodySize(`{"text":"x","imageBase64":"` + image + `"}`); err != nil {
+		t.Errorf("body with an image within the allowance was rejected: %v", err)
+	}
+	if err := limits.checkBodySize(`{"text":"` + image + `"}`); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("body without an image should keep the base limit, got %v", err)
+	}
+	if err := limits.checkBodySize(`{"text":"imageBase64 audioBase64 summarize ` + image + `"}`); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("field names in the text should not raise the limit, got %v", err)
+	}
+	if err := limits.checkBodySize(`{"text":"` + image + `","imageBase64":"AAAA"}`); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("a small image should only raise the limit by its own size, got %v", err)
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+	store := &fakeS3{objects: map[string][]byte{
+		"uploads/user-1/plant.jpg": testJPEG,
+		"uploads/user-1/notes.txt": []byte("plain text"),
+	}}
+	useFakeS3(t, store, &fakePresigner{})
+
+	tests := []struct {
+		name      string
+		key       string
+		principal string
+		wantErr   string
+	}{
+		{name: "own upload", key: "uploads/user-1/plant.jpg", principal: "user-1"},
+		{name: "other principal", key: "uploads/user-1/plant.jpg", principal: "user-2", wantErr: "not found"},
+		{name: "missing object", key: "uploads/user-1/missing.jpg", principal: "user-1", wantErr: "not found"},
+		{name: "not an image", key: "uploads/user-1/notes.txt", principal: "user-1", wantErr: "unsupported image format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := Req{ImageKey: tt.key}
+			err := loadImage(context.Background(), &req, tt.principal)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadImage() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadImage() error = %v", err)
+			}
+			if req.image == nil || req.image.MediaType != "image/jpeg" {
+				t.Errorf("image = %+v", req.image)
+			}
+		})
+	}
+}
+
+func TestImageContent(t *testing.T) {
+	block := imageContent(&imageInput{MediaType: "image/png", Data: testPNG})
+	source := block["source"].(map[string]interface{})
+	if block["type"] != "image" || source["type"] != "base64" || source["media_type"] != "image/png" {
+		t.Errorf("block = %v", block)
+	}
+	if source["data"] != base64.StdEncoding.EncodeToString(testPNG) {
+		t.Errorf("data = %v", source["data"])
+	}
+}
+
+func TestHandleUploads(t *testing.T) {
+	upload := func(method, body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/uploads", Body: body}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1"}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		t.Setenv("CAPTURE_BUCKET_NAME", "")
+		if resp := upload("POST", `{"contentType":"image/png"}`); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Setenv("CAPTURE_BUCKET_NAME", "captures")
+	useFakeS3(t, &fakeS3{}, &fakePresigner{})
+
+	t.Run("presigns a key under the caller's prefix", func(t *testing.T) {
+		resp := upload("POST", `{"contentType":"image/jpeg"}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("StatusCode = %d, want 200: %s", resp.StatusCode, resp.Body)
+		}
+		var ticket UploadTicket
+		json.Unmarshal([]byte(resp.Body), &ticket)
+		if !strings.HasPrefix(ticket.Key, "uploads/user-1/") || !strings.HasSuffix(ticket.Key, ".jpg") {
+			t.Errorf("Key = %q", ticket.Key)
+		}
+		if !strings.Contains(ticket.UploadURL, ticket.Key) || ticket.ContentType != "image/jpeg" || ticket.ExpiresAt.IsZero() {
+			t.Errorf("ticket = %+v", ticket)
+		}
+
+		// The key is accepted by validation and loading for the same principal
+		req := Req{ImageKey: ticket.Key}
+		if err := validateImage(&req); err != nil {
+			t.Errorf("validateImage() rejected an upload key: %v", err)
+		}
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		if resp := upload("POST", `{"contentType":"application/pdf"}`); resp.StatusCode != 400 {
+			t.Errorf("StatusCode = %d, want 400: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		if resp := upload("GET", ""); resp.StatusCode != 405 {
+			t.Errorf("StatusCode = %d, want 405: %s", resp.StatusCode, resp.Body)
+		}
+	})
+}
+
+func TestHandler_InvalidImageRejected(t *testing.T) {
+	resp, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Body:       `{"text":"what plant is this","imageBase64":"` + base64.StdEncoding.EncodeToString([]byte("not an image")) + `"}`,
+	})
+	if resp.StatusCode != 400 || !strings.Contains(resp.Body, "unsupported image format") {
+		t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
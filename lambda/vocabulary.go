@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// Sort key of a principal's custom vocabulary in the history table
+const vocabularySK = "VOCABULARY"
+
+// Vocabulary size caps; every term is sent with every request, so the list stays short
+const (
+	maxVocabularyTerms     = 200
+	maxVocabularyTermChars = 64
+)
+
+// Vocabulary is a principal's list of names, project codenames and jargon, added to
+// the system prompt so misheard dictation is normalized to the intended spelling
+type Vocabulary struct {
+	PK        string   `dynamodbav:"pk" json:"-"`
+	SK        string   `dynamodbav:"sk" json:"-"`
+	Terms     []string `dynamodbav:"terms" json:"terms"`
+	UpdatedAt string   `dynamodbav:"updatedAt" json:"updatedAt,omitempty"`
+}
+
+// vocabularyRequest is the body of PUT /vocabulary
+type vocabularyRequest struct {
+	Terms []string `json:"terms"`
+}
+
+// normalizeVocabulary trims terms, drops blanks and case-insensitive duplicates, and
+// enforces the size caps. Terms are single lines so they can't restructure the prompt.
+func normalizeVocabulary(terms []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, term := range terms {
+		term = strings.Join(strings.Fields(term), " ")
+		if term == "" || seen[strings.ToLower(term)] {
+			continue
+		}
+		if utf8.RuneCountInString(term) > maxVocabularyTermChars {
+			return nil, fmt.Errorf("vocabulary terms cannot exceed %d characters: %q", maxVocabularyTermChars, term)
+		}
+		seen[strings.ToLower(term)] = true
+		normalized = append(normalized, term)
+	}
+	if len(normalized) > maxVocabularyTerms {
+		return nil, fmt.Errorf("vocabulary cannot exceed %d terms", maxVocabularyTerms)
+	}
+	return normalized, nil
+}
+
+// vocabularyKey returns the history table key of a principal's vocabulary
+func vocabularyKey(principal string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: historyPK(principal)},
+		"sk": &types.AttributeValueMemberS{Value: vocabularySK},
+	}
+}
+
+// loadVocabulary reads a principal's vocabulary, returning an empty one when none is stored
+func loadVocabulary(ctx context.Context, principal string) (Vocabulary, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key:       vocabularyKey(principal),
+	})
+	if err != nil {
+		return Vocabulary{}, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	vocabulary := Vocabulary{Terms: []string{}}
+	if len(out.Item) == 0 {
+		return vocabulary, nil
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &vocabulary); err != nil {
+		return Vocabulary{}, fmt.Errorf("failed to unmarshal vocabulary: %w", err)
+	}
+	return vocabulary, nil
+}
+
+// saveVocabulary replaces a principal's vocabulary
+func saveVocabulary(ctx context.Context, principal string, terms []string, now time.Time) (Vocabulary, error) {
+	vocabulary := Vocabulary{
+		PK:        historyPK(principal),
+		SK:        vocabularySK,
+		Terms:     terms,
+		UpdatedAt: now.UTC().Format(time.RFC3339),
+	}
+	item, err := attributevalue.MarshalMap(vocabulary)
+	if err != nil {
+		return Vocabulary{}, fmt.Errorf("failed to marshal vocabulary: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(historyTableName),
+		Item:      item,
+	})
+	if err != nil {
+		return Vocabulary{}, fmt.Errorf("DynamoDB PutItem failed: %w", err)
+	}
+	return vocabulary, nil
+}
+
+// requestVocabulary returns the terms to add to a request's system prompt. Storage
+// errors are logged and skipped - the vocabulary improves answers but isn't required.
+func requestVocabulary(ctx context.Context, principal string) []string {
+	if historyTableName == "" {
+		return nil
+	}
+	vocabulary, err := loadVocabulary(ctx, principal)
+	if err != nil {
+		log.Printf("Failed to load vocabulary, continuing without it: %v", err)
+		return nil
+	}
+	return vocabulary.Terms
+}
+
+// vocabularyPrompt is the system prompt section listing the caller's terms
+func vocabularyPrompt(terms []string) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	return `
+
+Custom vocabulary:
+The request was dictated, so names and jargon may be misheard. The user often says the terms below. When a word or phrase sounds like one of them (e.g. "cooper nettie's" for "Kubernetes"), write the term exactly as listed:
+- ` + strings.Join(terms, "\n- ")
+}
+
+// isVocabularyRequest reports whether the route is /vocabulary
+func isVocabularyRequest(event events.APIGatewayProxyRequest) bool {
+	_, path := apiRoute(event)
+	return strings.TrimSuffix(path, "/") == "/vocabulary"
+}
+
+// handleVocabulary serves GET /vocabulary and PUT /vocabulary (replace the list; an
+// empty list clears it) for the caller's own vocabulary
+func handleVocabulary(ctx context.Context, event events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	if event.HTTPMethod != "GET" && event.HTTPMethod != "PUT" {
+		return errorResponse(ctx, apierror.MethodNotAllowed())
+	}
+	if historyTableName == "" {
+		return errorResponse(ctx, apierror.NotConfigured("vocabulary storage not configured"))
+	}
+	principal := principalFromEvent(event)
+
+	if event.HTTPMethod == "GET" {
+		vocabulary, err := loadVocabulary(ctx, principal)
+		if err != nil {
+			log.Printf("Failed to load vocabulary: %v", err)
+			return errorResponse(ctx, apierror.Internal("Failed to load vocabulary"))
+		}
+		return apiResponse(200, vocabulary)
+	}
+
+	var body vocabularyRequest
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errorResponse(ctx, apierror.InvalidJSON())
+	}
+	if body.Terms == nil {
+		return errorResponse(ctx, apierror.InvalidRequest("terms field is required"))
+	}
+	terms, err := normalizeVocabulary(body.Terms)
+	if err != nil {
+		return errorResponse(ctx, apierror.InvalidRequest(err.Error()))
+	}
+
+	vocabulary, err := saveVocabulary(ctx, principal, terms, time.Now())
+	if err != nil {
+		log.Printf("Failed to save vocabulary: %v", err)
+		return errorResponse(ctx, apierror.Internal("Failed to save vocabulary"))
+	}
+	return apiResponse(200, vocabulary)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNormalizeVocabulary(t *testing.T) {
+	got, err := normalizeVocabulary([]string{"  Kubernetes ", "", "kubernetes", "Project\nBluebird", "Siobhán"})
+	if err != nil {
+		t.Fatalf("normalizeVocabulary() error = %v", err)
+	}
+	want := []string{"Kubernetes", "Project Bluebird", "Siobhán"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("normalizeVocabulary() = %q, want %q", got, want)
+	}
+
+	if _, err := normalizeVocabulary([]string{strings.Repeat("x", maxVocabularyTermChars+1)}); err == nil {
+		t.Error("expected an error for an overlong term")
+	}
+	tooMany := make([]string, maxVocabularyTerms+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("x", i%maxVocabularyTermChars+1) + string(rune('a'+i/maxVocabularyTermChars))
+	}
+	if _, err := normalizeVocabulary(tooMany); err == nil {
+		t.Error("expected an error for too many terms")
+	}
+}
+
+func TestVocabularyPrompt(t *testing.T) {
+	if got := vocabularyPrompt(nil); got != "" {
+		t.Errorf("vocabularyPrompt(nil) = %q, want empty", got)
+	}
+	got := vocabularyPrompt([]string{"Kubernetes", "Siobhán"})
+	if !strings.Contains(got, "Custom vocabulary") || !strings.Contains(got, "\n- Kubernetes\n- Siobhán") {
+		t.Errorf("vocabularyPrompt() = %q", got)
+	}
+}
+
+func TestRequestVocabulary(t *testing.T) {
+	t.Run("no table", func(t *testing.T) {
+		if got := requestVocabulary(context.Background(), "user-1"); got != nil {
+			t.Errorf("requestVocabulary() = %v, want nil", got)
+		}
+	})
+
+	t.Run("storage errors are skipped", func(t *testing.T) {
+		useFakeDynamo(t, &fakeDynamo{err: errors.New("table down")})
+		if got := requestVocabulary(context.Background(), "user-1"); got != nil {
+			t.Errorf("requestVocabulary() = %v, want nil", got)
+		}
+	})
+}
+
+func TestHandleVocabulary(t *testing.T) {
+	call := func(method, principal, body string) events.APIGatewayProxyResponse {
+		event := events.APIGatewayProxyRequest{HTTPMethod: method, Resource: "/vocabulary", Body: body}
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		resp, _ := handler(context.Background(), event)
+		return resp
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := call("GET", "user-1", ""); resp.StatusCode != 503 {
+			t.Errorf("StatusCode = %d, want 503: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	useFakeDynamo(t, &fakeDynamo{})
+
+	t.Run("empty until set", func(t *testing.T) {
+		resp := call("GET", "user-1", "")
+		if resp.StatusCode != 200 || resp.Body != `{"terms":[]}` {
+			t.Errorf("got %d: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Run("put then get", func(t *testing.T) {
+		resp := call("PUT", "user-1", `{"terms":["Kubernetes"," kubernetes","Bluebird"]}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("PUT StatusCode = %d: %s", resp.StatusCode, resp.Body)
+		}
+
+		resp = call("GET", "user-1", "")
+		var vocabulary Vocabulary
+		json.Unmarshal([]byte(resp.Body), &vocabulary)
+		if strings.Join(vocabulary.Terms, "|") != "Kubernetes|Bluebird" || vocabulary.UpdatedAt == "" {
+			t.Errorf("GET = %s", resp.Body)
+		}
+		if got := requestVocabulary(context.Background(), "user-1"); len(got) != 2 {
+			t.Errorf("requestVocabulary() = %v", got)
+		}
+
+		// Each principal has its own list
+		if resp := call("GET", "user-2", ""); resp.Body != `{"terms":[]}` {
+			t.Errorf("other principal got %s", resp.Body)
+		}
+	})
+
+	t.Run("empty list clears", func(t *testing.T) {
+		call("PUT", "user-1", `{"terms":[]}`)
+		if got := requestVocabulary(context.Background(), "user-1"); len(got) != 0 {
+			t.Errorf("requestVocabulary() = %v, want empty", got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"terms":"Kubernetes"}`, `{"terms":["` + strings.Repeat("x", 100) + `"]}`} {
+			if resp := call("PUT", "user-1", body); resp.StatusCode != 400 {
+				t.Errorf("PUT %s: StatusCode = %d, want 400", body, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		if resp := call("POST", "user-1", `{"terms":[]}`); resp.StatusCode != 405 {
+			t.Errorf("StatusCode = %d, want 405", resp.StatusCode)
+		}
+	})
+}
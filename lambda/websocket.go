@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"wrist-agent/apierror"
+)
+
+// WebSocket sessions (API Gateway WebSocket API, routes $connect, $disconnect and
+// $default). $connect is authorized by the Lambda Authorizer like any REST request; the
+// handler keeps the authorizer's context on a connection record in the history table,
+// so every later message on the connection runs as that caller without sending its
+// token again. Each message is an invoke request. Its progress stages, the reply's text
+// as the model writes it and the final result are posted back on the connection, and
+// requests without a conversationId continue the session's conversation.
+const (
+	wsConnectionPKPrefix = "WSCONN#"
+	wsConnectionSK       = "CONNECTION"
+)
+
+// API Gateway closes WebSocket connections after two hours
+const wsConnectionTTL = 2 * time.Hour
+
+// Streamed reply text is posted once this many bytes (or a line break) are buffered
+const wsDeltaMinBytes = 48
+
+// WebSocket message types posted to the client
+const (
+	wsProgress = "progress" // a pipeline stage was reached
+	wsDelta    = "delta"    // more of the reply's markdown
+	wsResult   = "result"   // the request's response, as the REST API returns it
+	wsError    = "error"    // the request failed; error is the usual error object
+	wsPong     = "pong"     // answer to a ping
+)
+
+// errConnectionGone means the client has disconnected (410 from the management API)
+var errConnectionGone = errors.New("websocket connection is gone")
+
+// wsConversationUnsafe matches what a connection ID can hold but a conversationId can't
+var wsConversationUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// wsConnection is an open WebSocket connection (pk = WSCONN#<id>, sk = CONNECTION)
+type wsConnection struct {
+	PK             string `dynamodbav:"pk"`
+	SK             string `dynamodbav:"sk"`
+	ConnectionID   string `dynamodbav:"connectionId"`
+	Authorizer     string `dynamodbav:"authorizer"` // the $connect authorizer context, as JSON
+	ConversationID string `dynamodbav:"conversationId"`
+	ConnectedAt    string `dynamodbav:"connectedAt"`
+	ExpiresAt      int64  `dynamodbav:"expiresAt"`
+}
+
+// authorizer returns the connection's authorizer context as a REST request carries it
+func (c *wsConnection) authorizer() map[string]interface{} {
+	authorizerContext := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(c.Authorizer), &authorizerContext); err != nil {
+		log.Printf("Invalid authorizer context on connection %s: %v", c.ConnectionID, err)
+	}
+	return authorizerContext
+}
+
+// wsInbound is a message from the client
+type wsInbound struct {
+	Action     string          `json:"action"`     // invoke (default) or ping
+	RequestID  string          `json:"requestId"`  // client-chosen, echoed on every message about the request
+	APIVersion int             `json:"apiVersion"` // result shape: 1 (default) or 2
+	Request    json.RawMessage `json:"request"`    // the invoke request body
+}
+
+// wsOutbound is a message posted to the client
+type wsOutbound struct {
+	Type      string          `json:"type"`
+	RequestID string          `json:"requestId,omitempty"`
+	Stage     string          `json:"stage,omitempty"`  // progress
+	Text      string          `json:"text,omitempty"`   // delta
+	Status    int             `json:"status,omitempty"` // result and error: the REST API's status code
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     json.RawMessage `json:"error,omitempty"`
+}
+
+// handleWebSocket serves the WebSocket API's routes. Only a non-2xx answer to $connect
+// reaches the client (it refuses the connection); messages are answered by posting to
+// the connection.
+func handleWebSocket(ctx context.Context, event events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	ctx = apierror.WithRequestID(ctx, event.RequestContext.RequestID)
+	if historyTableName == "" {
+		log.Printf("WebSocket %s refused: sessions need the history table", event.RequestContext.EventType)
+		return errorResponse(ctx, apierror.NotConfigured("WebSocket sessions not configured")), nil
+	}
+
+	switch event.RequestContext.EventType {
+	case "CONNECT":
+		return wsConnect(ctx, event), nil
+	case "DISCONNECT":
+		wsDisconnect(ctx, event.RequestContext.ConnectionID)
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	case "MESSAGE":
+		wsMessage(ctx, event)
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	default:
+		return errorResponse(ctx, apierror.NotFound("unsupported WebSocket event")), nil
+	}
+}
+
+// wsConnect records a new connection with its authorizer context
+func wsConnect(ctx context.Context, event events.APIGatewayWebsocketProxyRequest) events.APIGatewayProxyResponse {
+	authorizer, _ := json.Marshal(event.RequestContext.Authorizer)
+	now := time.Now().UTC()
+	id := event.RequestContext.ConnectionID
+	conn := wsConnection{
+		PK:             wsConnectionPKPrefix + id,
+		SK:             wsConnectionSK,
+		ConnectionID:   id,
+		Authorizer:     string(authorizer),
+		ConversationID: truncateRunes("ws-"+wsConversationUnsafe.ReplaceAllString(id, ""), 64),
+		ConnectedAt:    now.Format(time.RFC3339),
+		ExpiresAt:      now.Add(wsConnectionTTL).Unix(),
+	}
+	item, err := attributevalue.MarshalMap(conn)
+	if err == nil {
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(historyTableName), Item: item})
+	}
+	if err != nil {
+		log.Printf("Failed to record WebSocket connection %s: %v", id, err)
+		return errorResponse(ctx, apierror.Internal("Failed to open session"))
+	}
+	log.Printf("WebSocket connected: %s", id)
+	return events.APIGatewayProxyResponse{StatusCode: 200}
+}
+
+// wsDisconnect expires a connection's record; TTL deletes it later
+func wsDisconnect(ctx context.Context, id string) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: wsConnectionPKPrefix + id},
+			"sk": &types.AttributeValueMemberS{Value: wsConnectionSK},
+		},
+		UpdateExpression:    aws.String("SET expiresAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionErr) {
+		log.Printf("Failed to close WebSocket connection %s: %v", id, err)
+	}
+}
+
+// loadConnection reads an open connection, returning nil when it doesn't exist or has
+// expired (TTL deletion lags)
+func loadConnection(ctx context.Context, id string) (*wsConnection, error) {
+	out, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(historyTableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: wsConnectionPKPrefix + id},
+			"sk": &types.AttributeValueMemberS{Value: wsConnectionSK},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	var conn wsConnection
+	if err := attributevalue.UnmarshalMap(out.Item, &conn); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal connection: %w", err)
+	}
+	if conn.ExpiresAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	return &conn, nil
+}
+
+// wsMessage runs one message from a connection
+func wsMessage(ctx context.Context, event events.APIGatewayWebsocketProxyRequest) {
+	id := event.RequestContext.ConnectionID
+	var msg wsInbound
+	decodeErr := json.Unmarshal([]byte(event.Body), &msg)
+	session := &wsSession{ctx: ctx, poster: newConnectionPoster(event), connectionID: id, requestID: msg.RequestID}
+
+	conn, err := loadConnection(ctx, id)
+	if err != nil {
+		log.Printf("Failed to load WebSocket connection %s: %v", id, err)
+		session.fail(apierror.Internal("Failed to load session"))
+		return
+	}
+	if conn == nil {
+		session.fail(apierror.New(401, apierror.CodeUnauthorized, "Session not found; reconnect"))
+		return
+	}
+	if decodeErr != nil {
+		session.fail(apierror.InvalidJSON())
+		return
+	}
+
+	switch msg.Action {
+	case "ping":
+		session.send(wsOutbound{Type: wsPong})
+	case "", "invoke":
+		wsInvoke(ctx, session, conn, msg, event.RequestContext.RequestID)
+	default:
+		session.fail(apierror.InvalidRequest(fmt.Sprintf("unknown action: %s (valid: invoke, ping)", msg.Action)))
+	}
+}
+
+// wsInvoke runs an invoke request from a connection through the REST API's invoke path
+// as the connection's caller, posting its progress, reply text and result
+func wsInvoke(ctx context.Context, session *wsSession, conn *wsConnection, msg wsInbound, requestID string) {
+	version := msg.APIVersion
+	if version == 0 {
+		version = apiV1
+	}
+	if version != apiV1 && version != apiV2 {
+		session.fail(apierror.InvalidRequest("apiVersion must be 1 or 2"))
+		return
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(msg.Request, &fields); err != nil {
+		session.fail(apierror.InvalidRequest("request must be a JSON object"))
+		return
+	}
+	// Follow-ups continue the session's conversation
+	if _, ok := fields["conversationId"]; !ok {
+		fields["conversationId"] = conn.ConversationID
+	}
+
+	ctx = withProgress(ctx, func(stage string) {
+		session.flush()
+		session.send(wsOutbound{Type: wsProgress, Stage: stage})
+	})
+	ctx = withReplyStream(ctx, session.delta)
+	session.send(wsOutbound{Type: wsProgress, Stage: stageThinking})
+	result := runCapture(ctx, CaptureRequest{
+		Source:    "websocket",
+		RequestID: requestID,
+		Caller:    conn.authorizer(),
+		Fields:    fields,
+		Version:   version,
+	})
+	session.flush()
+	session.finish(events.APIGatewayProxyResponse{StatusCode: result.Status, Body: result.Body})
+}
+
+// wsSession posts the messages about one request to its connection
+type wsSession struct {
+	ctx          context.Context
+	poster       *connectionPoster
+	connectionID string
+	requestID    string
+	pending      strings.Builder // reply text not posted yet
+	gone         bool
+}
+
+// send posts a message, giving up on the connection once the client has gone
+func (s *wsSession) send(msg wsOutbound) {
+	if s.gone {
+		return
+	}
+	msg.RequestID = s.requestID
+	data, _ := json.Marshal(msg)
+	err := s.poster.post(s.ctx, s.connectionID, data)
+	if errors.Is(err, errConnectionGone) {
+		log.Printf("WebSocket connection %s is gone", s.connectionID)
+		s.gone = true
+		wsDisconnect(s.ctx, s.connectionID)
+	} else if err != nil {
+		log.Printf("Failed to post to WebSocket connection %s: %v", s.connectionID, err)
+	}
+}
+
+// delta buffers streamed reply text, posting it in pieces of a line or a few words
+func (s *wsSession) delta(text string) {
+	s.pending.WriteString(text)
+	if s.pending.Len() >= wsDeltaMinBytes || strings.Contains(text, "\n") {
+		s.flush()
+	}
+}
+
+// flush posts the buffered reply text
+func (s *wsSession) flush() {
+	if s.pending.Len() > 0 {
+		s.send(wsOutbound{Type: wsDelta, Text: s.pending.String()})
+		s.pending.Reset()
+	}
+}
+
+// finish posts the REST response of the request: the result, or the error from its
+// envelope
+func (s *wsSession) finish(resp events.APIGatewayProxyResponse) {
+	if resp.StatusCode < 300 {
+		s.send(wsOutbound{Type: wsResult, Status: resp.StatusCode, Result: json.RawMessage(resp.Body)})
+		return
+	}
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	json.Unmarshal([]byte(resp.Body), &envelope)
+	s.send(wsOutbound{Type: wsError, Status: resp.StatusCode, Error: envelope.Error})
+}
+
+// fail posts an error that happened before the request could run
+func (s *wsSession) fail(apiErr *apierror.Error) {
+	s.finish(errorResponse(s.ctx, apiErr))
+}
+
+// connectionPoster posts to WebSocket connections through the API Gateway management
+// API, SigV4-signed like the OpenSearch client as there is no SDK client for it here
+type connectionPoster struct {
+	http     *http.Client
+	endpoint string // https://<api-id>.execute-api.<region>.amazonaws.com/<stage>
+	region   string
+}
+
+// newConnectionPoster posts to the API the event came from, or WEBSOCKET_ENDPOINT (for
+// custom domains)
+func newConnectionPoster(event events.APIGatewayWebsocketProxyRequest) *connectionPoster {
+	endpoint := os.Getenv("WEBSOCKET_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://" + event.RequestContext.DomainName + "/" + event.RequestContext.Stage
+	}
+	return &connectionPoster{
+		http:     sinkHTTPClient,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   getEnv("AWS_REGION", region),
+	}
+}
+
+// post sends data to a connection, returning errConnectionGone once it has closed
+func (p *connectionPoster) post(ctx context.Context, connectionID string, data []byte) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint+"/@connections/"+url.PathEscape(connectionID), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build PostToConnection request: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	creds, err := awsCredentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, httpReq, hex.EncodeToString(hash[:]), "execute-api", p.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign PostToConnection request: %w", err)
+	}
+
+	httpResp, err := p.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("PostToConnection failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode == http.StatusGone {
+		return errConnectionGone
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return fmt.Errorf("PostToConnection returned status %d: %s", httpResp.StatusCode, truncateRunes(string(body), 200))
+	}
+	return nil
+}
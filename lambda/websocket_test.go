@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeBedrockStream streams a Claude reply in small text deltas
+type fakeBedrockStream struct {
+	text string
+	body []byte
+}
+
+func (f *fakeBedrockStream) StreamModel(ctx context.Context, model string, body []byte, onChunk func([]byte) error) error {
+	f.body = body
+	chunks := []string{`{"type":"message_start","message":{"usage":{"input_tokens":12}}}`}
+	for text := f.text; text != ""; {
+		n := min(7, len(text))
+		delta, _ := json.Marshal(map[string]interface{}{"type": "content_block_delta", "delta": map[string]string{"type": "text_delta", "text": text[:n]}})
+		chunks = append(chunks, string(delta))
+		text = text[n:]
+	}
+	chunks = append(chunks, `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":30}}`)
+	for _, chunk := range chunks {
+		if err := onChunk([]byte(chunk)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// useFakeBedrockStream swaps in a fake streaming client for the test
+func useFakeBedrockStream(t *testing.T, stream *fakeBedrockStream) {
+	t.Helper()
+	orig := bedrockStreamClient
+	bedrockStreamClient = stream
+	t.Cleanup(func() { bedrockStreamClient = orig })
+}
+
+// fakeConnections records messages posted through the management API
+type fakeConnections struct {
+	mu       sync.Mutex
+	paths    []string
+	messages []wsOutbound
+	status   int
+}
+
+// useFakeConnections serves the management API for the test
+func useFakeConnections(t *testing.T, conns *fakeConnections) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var msg wsOutbound
+		json.Unmarshal(body, &msg)
+		conns.mu.Lock()
+		defer conns.mu.Unlock()
+		conns.paths = append(conns.paths, r.URL.Path)
+		conns.messages = append(conns.messages, msg)
+		if conns.status != 0 {
+			w.WriteHeader(conns.status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("WEBSOCKET_ENDPOINT", server.URL+"/prod")
+
+	orig := awsCredentials
+	awsCredentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+	})
+	t.Cleanup(func() { awsCredentials = orig })
+}
+
+// wsEvent builds a WebSocket event on connection conn-1
+func wsEvent(eventType, body string) events.APIGatewayWebsocketProxyRequest {
+	event := events.APIGatewayWebsocketProxyRequest{Body: body}
+	event.RequestContext.EventType = eventType
+	event.RequestContext.ConnectionID = "conn-1="
+	event.RequestContext.RequestID = "req-" + strings.ToLower(eventType)
+	if eventType == "CONNECT" {
+		event.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-1", "scopes": "invoke"}
+	}
+	return event
+}
+
+func TestReplyTextSoFar(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{``, ``},
+		{`{"action":"note","title":"Idea"`, ``},
+		{`{"action":"note","markdown": "Line one\nLi`, "Line one\nLi"},
+		{`{"markdown":"Tab\`, "Tab"},
+		{`{"markdown":"Caf\u00e`, "Caf"},
+		{`{"markdown":"Café \ud83d`, "Café "},
+		{`{"markdown":"Café 😀 \"ok\"","title":"x"}`, `Café 😀 "ok"`},
+		{"```json\n{\"markdown\":\"Fenced", "Fenced"},
+		{`Plain text reply`, `Plain text reply`},
+	}
+	for _, tt := range tests {
+		if got := replyTextSoFar(tt.raw); got != tt.want {
+			t.Errorf("replyTextSoFar(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestHandleWebSocket_Session(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	conns := &fakeConnections{}
+	useFakeConnections(t, conns)
+	reply := `{"action":"note","title":"Idea","markdown":"An **idea** worth keeping\nSecond line of the note","shortText":"An idea"}`
+	stream := &fakeBedrockStream{text: reply}
+	useFakeBedrockStream(t, stream)
+
+	resp, err := invoke(context.Background(), mustJSON(t, wsEvent("CONNECT", "")))
+	if err != nil || resp.(events.APIGatewayProxyResponse).StatusCode != 200 {
+		t.Fatalf("connect = %+v, %v", resp, err)
+	}
+	if len(db.items) != 1 || db.items[0]["pk"] != "WSCONN#conn-1=" || db.items[0]["conversationId"] != "ws-conn-1" {
+		t.Fatalf("connection record = %v", db.items)
+	}
+
+	handleWebSocket(context.Background(), wsEvent("MESSAGE", `{"requestId":"r1","request":{"text":"an idea worth keeping","mode":"note"}}`))
+
+	var types, text []string
+	var result wsOutbound
+	for _, msg := range conns.messages {
+		types = append(types, msg.Type+":"+msg.Stage)
+		if msg.Type == wsDelta {
+			text = append(text, msg.Text)
+		}
+		if msg.Type == wsResult {
+			result = msg
+		}
+		if msg.RequestID != "r1" {
+			t.Errorf("Expected every message to carry the requestId, got %+v", msg)
+		}
+	}
+	if conns.paths[0] != "/prod/@connections/conn-1=" {
+		t.Errorf("Unexpected management API path: %s", conns.paths[0])
+	}
+	if strings.Join(text, "") != "An **idea** worth keeping\nSecond line of the note" || len(text) < 2 {
+		t.Errorf("Expected the markdown streamed in pieces, got %q", text)
+	}
+	if types[0] != "progress:thinking" || types[1] != "progress:generating" || types[len(types)-2] != "progress:delivering-to-sinks" || types[len(types)-1] != "result:" {
+		t.Errorf("Unexpected message sequence: %v", types)
+	}
+	var response Response
+	json.Unmarshal(result.Result, &response)
+	if result.Status != 200 || response.Title != "Idea" || response.ConversationID != "ws-conn-1" {
+		t.Errorf("Unexpected result: %d %+v", result.Status, response)
+	}
+
+	// Pings are answered, unknown connections get an error
+	conns.messages = nil
+	handleWebSocket(context.Background(), wsEvent("MESSAGE", `{"action":"ping","requestId":"p1"}`))
+	if len(conns.messages) != 1 || conns.messages[0].Type != wsPong {
+		t.Errorf("Expected a pong, got %+v", conns.messages)
+	}
+	conns.messages = nil
+	unknown := wsEvent("MESSAGE", `{"request":{"text":"hi"}}`)
+	unknown.RequestContext.ConnectionID = "conn-2"
+	handleWebSocket(context.Background(), unknown)
+	if len(conns.messages) != 1 || conns.messages[0].Status != 401 || !strings.Contains(string(conns.messages[0].Error), "UNAUTHORIZED") {
+		t.Errorf("Expected a 401 error, got %+v", conns.messages)
+	}
+
+	// Disconnecting expires the record
+	handleWebSocket(context.Background(), wsEvent("DISCONNECT", ""))
+	if len(db.updates) == 0 || aws.ToString(db.updates[len(db.updates)-1].UpdateExpression) != "SET expiresAt = :now" {
+		t.Errorf("Expected the connection expired on disconnect")
+	}
+}
+
+func TestHandleWebSocket_InvalidRequest(t *testing.T) {
+	db := &fakeDynamo{}
+	useFakeDynamo(t, db)
+	conns := &fakeConnections{}
+	useFakeConnections(t, conns)
+	handleWebSocket(context.Background(), wsEvent("CONNECT", ""))
+
+	handleWebSocket(context.Background(), wsEvent("MESSAGE", `{"requestId":"r2","request":{"text":"x","mode":"poetry"}}`))
+	last := conns.messages[len(conns.messages)-1]
+	if last.Type != wsError || last.Status != 400 || !strings.Contains(string(last.Error), "invalid mode") {
+		t.Errorf("Expected a validation error, got %+v", conns.messages)
+	}
+
+	// A client that has gone stops the session's messages
+	conns.messages, conns.status = nil, http.StatusGone
+	handleWebSocket(context.Background(), wsEvent("MESSAGE", `{"action":"ping"}`))
+	if aws.ToString(db.updates[len(db.updates)-1].UpdateExpression) != "SET expiresAt = :now" {
+		t.Errorf("Expected a gone connection to be expired")
+	}
+}
+
+func TestHandleWebSocket_NotConfigured(t *testing.T) {
+	resp, _ := handleWebSocket(context.Background(), wsEvent("CONNECT", ""))
+	if resp.StatusCode != 503 {
+		t.Errorf("Expected connections refused without a history table, got %d", resp.StatusCode)
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Weekly summary sizes: captures read for the week, and items shown per list
+const (
+	weeklySummaryCaptures   = 2000
+	weeklySummaryTopTags    = 5
+	weeklySummaryHighlights = 5
+)
+
+// WeeklySummary is the rollup of a principal's past seven days
+type WeeklySummary struct {
+	Principal          string
+	From, To           string // first and last day covered, in DIGEST_TIMEZONE
+	Captures           int
+	ByMode             []ModeCount
+	CompletedReminders []string
+	TopTags            []TagCount
+	Highlights         []string
+}
+
+// ModeCount is how many captures a mode handled
+type ModeCount struct {
+	Mode  string
+	Count int
+}
+
+// WeeklySummaryRun reports what a scheduled weekly summary run did
+type WeeklySummaryRun struct {
+	Principals int `json:"principals"`
+	Sent       int `json:"sent"`
+	Failed     int `json:"failed"`
+}
+
+// weeklySummaryRecipients parses WEEKLY_SUMMARY_RECIPIENTS, comma-separated
+// principal=address pairs; principals not listed haven't opted in. Only the bare address
+// is kept, so a "Name <address>" entry is sent and allowlisted as its address.
+func weeklySummaryRecipients() map[string]string {
+	recipients := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("WEEKLY_SUMMARY_RECIPIENTS"), ",") {
+		principal, address, ok := strings.Cut(pair, "=")
+		principal, address = strings.TrimSpace(principal), strings.TrimSpace(address)
+		if !ok || principal == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(address)
+		if err != nil {
+			log.Printf("Ignoring weekly summary recipient for %s: invalid address %q", principal, address)
+			continue
+		}
+		recipients[principal] = addr.Address
+	}
+	return recipients
+}
+
+// compileWeeklySummary rolls up the seven days before the day containing now. captures
+// are the week's captures; reminders are all stored reminders, since one created weeks
+// ago may have been completed this week. Highlights are high-urgency or upbeat captures,
+// newest first.
+func compileWeeklySummary(principal string, captures, reminders []HistoryItem, now time.Time, loc *time.Location) WeeklySummary {
+	local := now.In(loc)
+	end := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	start := end.AddDate(0, 0, -7)
+	within := func(iso string) bool {
+		t, err := time.Parse(time.RFC3339, iso)
+		return err == nil && !t.Before(start) && t.Before(end)
+	}
+
+	summary := WeeklySummary{
+		Principal: principal,
+		From:      start.Format("2006-01-02"),
+		To:        end.AddDate(0, 0, -1).Format("2006-01-02"),
+	}
+
+	modes := map[string]int{}
+	var tagLists [][]string
+	for _, capture := range captures {
+		if !within(capture.CreatedAt) {
+			continue
+		}
+		summary.Captures++
+		modes[capture.Mode]++
+		tagLists = append(tagLists, capture.Tags)
+		if len(summary.Highlights) < weeklySummaryHighlights && (capture.Urgency == priorityHigh || capture.Sentiment == sentimentPositive) {
+			summary.Highlights = append(summary.Highlights, capture.Title)
+		}
+	}
+	for mode, count := range modes {
+		summary.ByMode = append(summary.ByMode, ModeCount{Mode: mode, Count: count})
+	}
+	sort.Slice(summary.ByMode, func(i, j int) bool {
+		if summary.ByMode[i].Count != summary.ByMode[j].Count {
+			return summary.ByMode[i].Count > summary.ByMode[j].Count
+		}
+		return summary.ByMode[i].Mode < summary.ByMode[j].Mode
+	})
+	summary.TopTags = rankTags(tagLists, weeklySummaryTopTags)
+
+	for _, reminder := range reminders {
+		if within(reminder.CompletedAt) {
+			summary.CompletedReminders = append(summary.CompletedReminders, reminder.Title)
+		}
+	}
+	return summary
+}
+
+// weeklySummaryHTML is the email body; html/template escapes capture titles and tags
+var weeklySummaryHTML = template.Must(template.New("weekly").Parse(`<!DOCTYPE html>
+<html><body style="font-family: -apple-system, Helvetica, Arial, sans-serif; color: #1c1c1e; max-width: 560px;">
+<h1 style="font-size: 22px;">Your week: {{.From}} to {{.To}}</h1>
+<p>{{.Captures}} capture{{if ne .Captures 1}}s{{end}} this week.</p>
+{{if .ByMode}}<h2 style="font-size: 17px;">By mode</h2>
+<table cellpadding="4">{{range .ByMode}}<tr><td>{{.Mode}}</td><td align="right">{{.Count}}</td></tr>{{end}}</table>{{end}}
+{{if .CompletedReminders}}<h2 style="font-size: 17px;">Completed reminders</h2>
+<ul>{{range .CompletedReminders}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .TopTags}}<h2 style="font-size: 17px;">Top tags</h2>
+<p>{{range $i, $t := .TopTags}}{{if $i}}, {{end}}{{$t.Tag}} ({{$t.Count}}){{end}}</p>{{end}}
+{{if .Highlights}}<h2 style="font-size: 17px;">Highlights</h2>
+<ul>{{range .Highlights}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</body></html>
+`))
+
+// renderWeeklySummary returns the summary's plain-text and HTML email bodies
+func renderWeeklySummary(summary WeeklySummary) (string, string, error) {
+	var text strings.Builder
+	fmt.Fprintf(&text, "Your week: %s to %s\n\n%d captures this week.\n", summary.From, summary.To, summary.Captures)
+	list := func(heading string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&text, "\n%s\n", heading)
+		for _, line := range lines {
+			fmt.Fprintf(&text, "- %s\n", line)
+		}
+	}
+	var modes, tags []string
+	for _, mode := range summary.ByMode {
+		modes = append(modes, fmt.Sprintf("%s: %d", mode.Mode, mode.Count))
+	}
+	for _, tag := range summary.TopTags {
+		tags = append(tags, fmt.Sprintf("%s (%d)", tag.Tag, tag.Count))
+	}
+	list("By mode", modes)
+	list("Completed reminders", summary.CompletedReminders)
+	list("Top tags", tags)
+	list("Highlights", summary.Highlights)
+
+	var html bytes.Buffer
+	if err := weeklySummaryHTML.Execute(&html, summary); err != nil {
+		return "", "", fmt.Errorf("failed to render weekly summary: %w", err)
+	}
+	return text.String(), html.String(), nil
+}
+
+// sendWeeklySummary compiles a principal's week and emails it
+func sendWeeklySummary(ctx context.Context, principal, address string, now time.Time) error {
+	loc := locationFromEnv("DIGEST_TIMEZONE")
+	local := now.In(loc)
+	since := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -7)
+
+	captures, err := loadCapturesSince(ctx, principal, since, weeklySummaryCaptures)
+	if err != nil {
+		return err
+	}
+	reminders, err := loadCapturesByAction(ctx, principal, "reminder", dailyDigestCaptures)
+	if err != nil {
+		return err
+	}
+	summary := compileWeeklySummary(principal, captures, reminders, now, loc)
+	text, html, err := renderWeeklySummary(summary)
+	if err != nil {
+		return err
+	}
+	_, err = sendSESEmail(ctx, []string{address}, "Your week: "+summary.From+" to "+summary.To, text, html)
+	return err
+}
+
+// runWeeklySummary emails every opted-in principal their weekly rollup. As with the
+// daily digest, failures are logged per principal and the run never returns an error.
+func runWeeklySummary(ctx context.Context, now time.Time) (WeeklySummaryRun, error) {
+	recipients := weeklySummaryRecipients()
+	run := WeeklySummaryRun{Principals: len(recipients)}
+	if historyTableName == "" {
+		log.Printf("Weekly summary skipped: history table not configured")
+		return run, nil
+	}
+
+	principals := make([]string, 0, len(recipients))
+	for principal := range recipients {
+		principals = append(principals, principal)
+	}
+	sort.Strings(principals)
+	for _, principal := range principals {
+		if err := sendWeeklySummary(ctx, principal, recipients[principal], now); err != nil {
+			log.Printf("Weekly summary failed for %s: %v", principal, err)
+			run.Failed++
+			continue
+		}
+		run.Sent++
+	}
+	log.Printf("Weekly summary: %d principals, %d sent, %d failed", run.Principals, run.Sent, run.Failed)
+	return run, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func weekCapture(id, mode, title, createdAt string, tags ...string) HistoryItem {
+	created, _ := time.Parse(time.RFC3339, createdAt)
+	return newHistoryItem(captureMeta{ID: id, Principal: "user-1", Mode: mode, CreatedAt: created}, Response{Action: mode, Title: title, Tags: tags})
+}
+
+func TestWeeklySummaryRecipients(t *testing.T) {
+	t.Setenv("WEEKLY_SUMMARY_RECIPIENTS", "user-1=me@example.com, user-2 = Sam <sam@example.com>,user-3=not-an-address,broken")
+	got := weeklySummaryRecipients()
+	if len(got) != 2 || got["user-1"] != "me@example.com" || got["user-2"] != "sam@example.com" {
+		t.Errorf("recipients = %v", got)
+	}
+}
+
+func TestCompileWeeklySummary(t *testing.T) {
+	now := time.Date(2025, 1, 13, 8, 0, 0, 0, time.UTC) // Monday
+	urgent := weekCapture("c3", "reminder", "Pay rent", "2025-01-10T09:00:00Z", "Home")
+	urgent.Urgency = "high"
+	happy := weekCapture("c4", "journal", "Great hike", "2025-01-11T19:00:00Z", "outdoors")
+	happy.Sentiment = "positive"
+	captures := []HistoryItem{
+		weekCapture("c6", "note", "Today, not last week", "2025-01-13T07:00:00Z", "work"),
+		happy,
+		urgent,
+		weekCapture("c2", "note", "Standup notes", "2025-01-07T10:00:00Z", "work", "home"),
+		weekCapture("c1", "note", "Kickoff", "2025-01-06T00:00:00Z", "work"),
+		weekCapture("c0", "note", "Too old", "2025-01-05T23:59:00Z", "old"),
+	}
+	done := weekCapture("r1", "reminder", "Call mom", "2024-12-20T10:00:00Z")
+	done.CompletedAt = "2025-01-08T12:00:00Z"
+	earlier := weekCapture("r2", "reminder", "Done last month", "2024-12-01T10:00:00Z")
+	earlier.CompletedAt = "2024-12-02T12:00:00Z"
+
+	summary := compileWeeklySummary("user-1", captures, []HistoryItem{done, earlier, urgent}, now, time.UTC)
+	if summary.From != "2025-01-06" || summary.To != "2025-01-12" || summary.Captures != 4 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(summary.ByMode) != 3 || summary.ByMode[0] != (ModeCount{"note", 2}) || summary.ByMode[1] != (ModeCount{"journal", 1}) {
+		t.Errorf("ByMode = %v", summary.ByMode)
+	}
+	if len(summary.TopTags) != 3 || summary.TopTags[0] != (TagCount{"Home", 2}) || summary.TopTags[1] != (TagCount{"work", 2}) {
+		t.Errorf("TopTags = %v", summary.TopTags)
+	}
+	if len(summary.CompletedReminders) != 1 || summary.CompletedReminders[0] != "Call mom" {
+		t.Errorf("CompletedReminders = %v", summary.CompletedReminders)
+	}
+	if len(summary.Highlights) != 2 || summary.Highlights[0] != "Great hike" || summary.Highlights[1] != "Pay rent" {
+		t.Errorf("Highlights = %v", summary.Highlights)
+	}
+}
+
+func TestRenderWeeklySummary(t *testing.T) {
+	text, html, err := renderWeeklySummary(WeeklySummary{
+		From: "2025-01-06", To: "2025-01-12", Captures: 2,
+		ByMode:     []ModeCount{{"note", 2}},
+		TopTags:    []TagCount{{"work", 2}},
+		Highlights: []string{"<script>alert(1)</script>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "Your week: 2025-01-06 to 2025-01-12") || !strings.Contains(text, "- note: 2") || !strings.Contains(text, "- work (2)") {
+		t.Errorf("text =\n%s", text)
+	}
+	if strings.Contains(html, "<script>") || !strings.Contains(html, "&lt;script&gt;") || strings.Contains(html, "Completed reminders") {
+		t.Errorf("html =\n%s", html)
+	}
+}
+
+func TestRunWeeklySummary(t *testing.T) {
+	useFakeDynamo(t, &fakeDynamo{})
+	ses := &fakeSES{}
+	useFakeSES(t, ses)
+	t.Setenv("WEEKLY_SUMMARY_RECIPIENTS", "user-1=me@example.com")
+	t.Setenv("SES_FROM_ADDRESS", "agent@example.com")
+
+	now := time.Now()
+	saveCapture(context.Background(), weekCapture("c1", "note", "Kickoff", now.AddDate(0, 0, -2).UTC().Format(time.RFC3339), "work"))
+
+	run, err := runWeeklySummary(context.Background(), now)
+	if err != nil || run.Sent != 1 || run.Failed != 0 {
+		t.Fatalf("run = %+v, %v", run, err)
+	}
+	body := ses.input.Content.Simple.Body
+	if body.Html == nil || !strings.Contains(*body.Html.Data, "<td>note</td>") || body.Text == nil {
+		t.Errorf("email body = %+v", body)
+	}
+	if to := ses.input.Destination.ToAddresses; len(to) != 1 || to[0] != "me@example.com" {
+		t.Errorf("to = %v", to)
+	}
+}